@@ -0,0 +1,75 @@
+// SPDX-FileCopyrightText: 2021 The Go-SSB Authors
+//
+// SPDX-License-Identifier: MIT
+
+package ssb
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	refs "github.com/ssbc/go-ssb-refs"
+)
+
+// MaxBlobRefsDepth is how deeply objects and arrays can be nested in content passed to ExtractBlobRefs.
+const MaxBlobRefsDepth = 64
+
+// ErrContentTooDeep is returned by ExtractBlobRefs if the content is nested deeper than MaxBlobRefsDepth.
+var ErrContentTooDeep = errors.New("ssb: content nested too deeply")
+
+// ExtractBlobRefs returns the blob references (&...sha256) in the JSON content of a message.
+// It looks at all string values, regardless of their field name or how deep they are in objects and arrays,
+// so it finds mentions as well as images and other fields. Each blob is returned once, in the order they appear.
+// Strings which aren't valid blob references and non-object content, like the boxed string of a private message, are skipped.
+func ExtractBlobRefs(content []byte) ([]refs.BlobRef, error) {
+	dec := json.NewDecoder(bytes.NewReader(content))
+
+	var (
+		found []refs.BlobRef
+		seen  = make(map[string]struct{})
+		depth int
+	)
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			if depth != 0 {
+				return nil, fmt.Errorf("ssb: failed to read content: %w", io.ErrUnexpectedEOF)
+			}
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("ssb: failed to read content: %w", err)
+		}
+
+		switch v := tok.(type) {
+		case json.Delim:
+			if v == '{' || v == '[' {
+				depth++
+				if depth > MaxBlobRefsDepth {
+					return nil, ErrContentTooDeep
+				}
+			} else {
+				depth--
+			}
+
+		case string:
+			if !strings.HasPrefix(v, "&") {
+				continue
+			}
+			if _, has := seen[v]; has {
+				continue
+			}
+			br, err := refs.ParseBlobRef(v)
+			if err != nil {
+				continue
+			}
+			seen[v] = struct{}{}
+			found = append(found, br)
+		}
+	}
+	return found, nil
+}
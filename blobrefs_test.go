@@ -0,0 +1,64 @@
+// SPDX-FileCopyrightText: 2021 The Go-SSB Authors
+//
+// SPDX-License-Identifier: MIT
+
+package ssb
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestExtractBlobRefs(t *testing.T) {
+	r := require.New(t)
+
+	const (
+		mentioned = "&hB2vsBGwqPAfkBQ5IQGIrLfHXzytmExYC3iJ6FC08F8=.sha256"
+		image     = "&O1yVZ3wsCoGSwSyJqWQqyDCrQzl8gjgA4jXxPpJcHaM=.sha256"
+	)
+
+	content := `{
+		"type": "post",
+		"text": "look at this ![pic](` + image + `)",
+		"mentions": [
+			{"link": "` + mentioned + `", "name": "cat.png", "type": "image/png"},
+			{"link": "@hxGxqPrplLjRG2vtjQL87abX4QKqeLgCwQpS730nNwE=.ed25519", "name": "alice"}
+		],
+		"fancy": {"cover": {"image": {"blob": "` + image + `"}}, "again": ["` + mentioned + `"]},
+		"broken": "&not-a-blob.sha256",
+		"msg": "%6Jke7N/zqjxBlv3c6GgmQ96mGfpzszdhnKAnh2RnPR8=.sha256",
+		"count": 3,
+		"ok": true,
+		"nothing": null
+	}`
+
+	brs, err := ExtractBlobRefs([]byte(content))
+	r.NoError(err)
+	r.Len(brs, 2)
+	r.Equal(mentioned, brs[0].Sigil())
+	r.Equal(image, brs[1].Sigil())
+
+	// private messages are just a string
+	brs, err = ExtractBlobRefs([]byte(`"c29tZXRoaW5nIGJveGVk.box"`))
+	r.NoError(err)
+	r.Empty(brs)
+
+	brs, err = ExtractBlobRefs([]byte(`"` + image + `"`))
+	r.NoError(err)
+	r.Len(brs, 1)
+
+	_, err = ExtractBlobRefs([]byte(`{"type": `))
+	r.Error(err)
+
+	deep := strings.Repeat("[", MaxBlobRefsDepth+1) + strings.Repeat("]", MaxBlobRefsDepth+1)
+	_, err = ExtractBlobRefs([]byte(deep))
+	r.True(errors.Is(err, ErrContentTooDeep), "wrong error: %v", err)
+
+	deep = strings.Repeat("[", MaxBlobRefsDepth) + `"` + image + `"` + strings.Repeat("]", MaxBlobRefsDepth)
+	brs, err = ExtractBlobRefs([]byte(deep))
+	r.NoError(err)
+	r.Len(brs, 1)
+}
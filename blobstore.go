@@ -63,6 +63,9 @@ type WantManager interface {
 	Want(ref refs.BlobRef) error
 	Wants(ref refs.BlobRef) bool
 	WantWithDist(ref refs.BlobRef, dist int64) error
+	// WantFrom wants a blob which was referenced by the feed from.
+	// The blobs of feeds which are closer to us are fetched first.
+	WantFrom(ref refs.BlobRef, from refs.FeedRef) error
 	//Unwant(ref refs.BlobRef) error
 	CreateWants(context.Context, *muxrpc.ByteSink, muxrpc.Endpoint) luigi.Sink
 
@@ -0,0 +1,105 @@
+// SPDX-FileCopyrightText: 2021 The Go-SSB Authors
+//
+// SPDX-License-Identifier: MIT
+
+package blobstore
+
+import (
+	"container/heap"
+	"sync"
+)
+
+// fetchQueue holds the blobs peers offered us until the want manager gets to fetch them.
+// It hands out the one with the lowest priority value first and keeps the order they were offered in otherwise.
+type fetchQueue struct {
+	mu     sync.Mutex
+	items  hasBlobHeap
+	added  uint64
+	closed bool
+
+	// wake has an element if items were added or the queue was closed
+	wake chan struct{}
+}
+
+func newFetchQueue() *fetchQueue {
+	return &fetchQueue{wake: make(chan struct{}, 1)}
+}
+
+func (q *fetchQueue) push(hs ...*hasBlob) {
+	if len(hs) == 0 {
+		return
+	}
+	q.mu.Lock()
+	if q.closed {
+		q.mu.Unlock()
+		return
+	}
+	for _, h := range hs {
+		q.added++
+		heap.Push(&q.items, queuedBlob{hasBlob: h, order: q.added})
+	}
+	q.mu.Unlock()
+	q.signal()
+}
+
+// pop blocks until there is something to fetch. It returns false once the queue is closed.
+func (q *fetchQueue) pop() (*hasBlob, bool) {
+	for {
+		q.mu.Lock()
+		if q.closed {
+			q.mu.Unlock()
+			return nil, false
+		}
+		if len(q.items) > 0 {
+			qb := heap.Pop(&q.items).(queuedBlob)
+			q.mu.Unlock()
+			return qb.hasBlob, true
+		}
+		q.mu.Unlock()
+		<-q.wake
+	}
+}
+
+func (q *fetchQueue) close() {
+	q.mu.Lock()
+	q.closed = true
+	q.items = nil
+	q.mu.Unlock()
+	q.signal()
+}
+
+func (q *fetchQueue) signal() {
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+}
+
+type queuedBlob struct {
+	*hasBlob
+	order uint64
+}
+
+// hasBlobHeap implements heap.Interface
+type hasBlobHeap []queuedBlob
+
+func (h hasBlobHeap) Len() int { return len(h) }
+
+func (h hasBlobHeap) Less(i, j int) bool {
+	if h[i].priority != h[j].priority {
+		return h[i].priority < h[j].priority
+	}
+	return h[i].order < h[j].order
+}
+
+func (h hasBlobHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+
+func (h *hasBlobHeap) Push(x interface{}) { *h = append(*h, x.(queuedBlob)) }
+
+func (h *hasBlobHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	x := old[n-1]
+	*h = old[:n-1]
+	return x
+}
@@ -0,0 +1,104 @@
+// SPDX-FileCopyrightText: 2021 The Go-SSB Authors
+//
+// SPDX-License-Identifier: MIT
+
+package blobstore
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/ssbc/go-ssb"
+	refs "github.com/ssbc/go-ssb-refs"
+)
+
+// ManyHaser is implemented by blob stores which can look up a lot of blobs at once, faster than with a Size call for each of them.
+type ManyHaser interface {
+	// HasMany returns the sizes of the passed blobs which are stored, by their sigil. Absent blobs are left out.
+	HasMany(blobs []refs.BlobRef) (map[string]int64, error)
+}
+
+var _ ManyHaser = (*blobStore)(nil)
+
+// HasMany returns the sizes of the passed blobs which bs has, by their sigil. Absent blobs are left out.
+// It uses bs.HasMany if the store is a ManyHaser and calls Size for each blob otherwise.
+func HasMany(bs ssb.BlobStore, blobs []refs.BlobRef) (map[string]int64, error) {
+	if mh, ok := bs.(ManyHaser); ok {
+		return mh.HasMany(blobs)
+	}
+
+	sizes := make(map[string]int64)
+	for _, br := range blobs {
+		sz, err := bs.Size(br)
+		if err != nil {
+			if errors.Is(err, ErrNoSuchBlob) {
+				continue
+			}
+			return nil, fmt.Errorf("blobstore: failed to get size of %s: %w", br.ShortSigil(), err)
+		}
+		sizes[br.Sigil()] = sz
+	}
+	return sizes, nil
+}
+
+// HasMany reads each of the directories the blobs would be in once, instead of looking at every blob file by itself.
+func (store *blobStore) HasMany(blobs []refs.BlobRef) (map[string]int64, error) {
+	byDir := make(map[string][]refs.BlobRef)
+	for _, br := range blobs {
+		dir, err := store.getHexDirPath(br)
+		if err != nil {
+			return nil, fmt.Errorf("blobstore: HasMany: %w", err)
+		}
+		byDir[dir] = append(byDir[dir], br)
+	}
+
+	sizes := make(map[string]int64)
+	for dir, inDir := range byDir {
+		// a single stat is cheaper than reading the directory
+		if len(inDir) == 1 {
+			sz, err := store.Size(inDir[0])
+			if err == nil {
+				sizes[inDir[0].Sigil()] = sz
+			} else if !errors.Is(err, ErrNoSuchBlob) {
+				return nil, fmt.Errorf("blobstore: HasMany: %w", err)
+			}
+			continue
+		}
+
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return nil, fmt.Errorf("blobstore: HasMany: failed to read %s: %w", dir, err)
+		}
+		files := make(map[string]os.DirEntry, len(entries))
+		for _, e := range entries {
+			if e.Type().IsRegular() {
+				files[e.Name()] = e
+			}
+		}
+
+		for _, br := range inDir {
+			p, err := store.getPath(br)
+			if err != nil {
+				return nil, fmt.Errorf("blobstore: HasMany: %w", err)
+			}
+			e, has := files[filepath.Base(p)]
+			if !has {
+				continue
+			}
+			fi, err := e.Info()
+			if err != nil {
+				if os.IsNotExist(err) { // deleted in the meantime
+					continue
+				}
+				return nil, fmt.Errorf("blobstore: HasMany: %w", err)
+			}
+			sizes[br.Sigil()] = fi.Size()
+		}
+	}
+	return sizes, nil
+}
@@ -0,0 +1,121 @@
+// SPDX-FileCopyrightText: 2021 The Go-SSB Authors
+//
+// SPDX-License-Identifier: MIT
+
+package blobstore
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/ssbc/go-ssb"
+	refs "github.com/ssbc/go-ssb-refs"
+)
+
+// HTTPHandler serves the blobs of store over HTTP, for instance for a web interface.
+// A blob is requested by its reference as the path, like /&ZR3jMW+ifnTWqd5hnrrGjjt4HpUn%2FdAMXvcUOx+lgbY=.sha256.
+//
+// The reference is the ETag of the response, since the content of a blob never changes.
+// Paths which aren't a blob reference are rejected with 400, missing blobs with 404.
+// The path is only used to compute the hash, so it can't point outside of the store.
+//
+// Blobs can be added by anyone, so they are served in a way that they can't run scripts in the origin of the handler:
+// only images, audio, video and plain text get their detected type, everything else is sent as application/octet-stream,
+// and the browser is told not to sniff the type and to sandbox the content.
+func HTTPHandler(store ssb.BlobStore) http.Handler {
+	return httpHandler{store: store}
+}
+
+type httpHandler struct {
+	store ssb.BlobStore
+}
+
+func (h httpHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet && req.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	ref, err := refs.ParseBlobRef(strings.TrimPrefix(req.URL.Path, "/"))
+	if err != nil {
+		http.Error(w, "not a blob reference", http.StatusBadRequest)
+		return
+	}
+
+	etag := strconv.Quote(ref.Sigil())
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+
+	size, err := h.store.Size(ref)
+	if errors.Is(err, ErrNoSuchBlob) {
+		http.Error(w, "no such blob", http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, "failed to get blob", http.StatusInternalServerError)
+		return
+	}
+
+	if etagMatches(req.Header.Get("If-None-Match"), etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	rd, err := h.store.Get(ref)
+	if errors.Is(err, ErrNoSuchBlob) {
+		http.Error(w, "no such blob", http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, "failed to get blob", http.StatusInternalServerError)
+		return
+	}
+	defer rd.Close()
+
+	// blobs don't have a type, guess it from the start like http.ServeContent does
+	buffered := bufio.NewReaderSize(rd, 512)
+	start, _ := buffered.Peek(512)
+	w.Header().Set("Content-Type", safeContentType(http.DetectContentType(start)))
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Content-Security-Policy", "sandbox")
+	w.Header().Set("Content-Length", strconv.FormatInt(size, 10))
+	w.WriteHeader(http.StatusOK)
+
+	if req.Method == http.MethodHead {
+		return
+	}
+	// the status is already sent, a failed copy just cuts the response short
+	io.Copy(w, buffered)
+}
+
+// safeContentType returns detected if it is a type which can't contain scripts, otherwise application/octet-stream.
+func safeContentType(detected string) string {
+	mediaType := detected
+	if i := strings.IndexByte(mediaType, ';'); i >= 0 {
+		mediaType = mediaType[:i]
+	}
+
+	switch {
+	case mediaType == "text/plain",
+		strings.HasPrefix(mediaType, "image/") && mediaType != "image/svg+xml",
+		strings.HasPrefix(mediaType, "audio/"),
+		strings.HasPrefix(mediaType, "video/"):
+		return detected
+	default:
+		return "application/octet-stream"
+	}
+}
+
+// etagMatches checks the value of an If-None-Match header against etag
+func etagMatches(header, etag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == "*" || candidate == etag {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,105 @@
+// SPDX-FileCopyrightText: 2021 The Go-SSB Authors
+//
+// SPDX-License-Identifier: MIT
+
+package blobstore
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestHTTPHandler(t *testing.T) {
+	r := require.New(t)
+
+	tRepo := filepath.Join("testrun", t.Name())
+	os.RemoveAll(tRepo)
+	bs, err := New(tRepo)
+	r.NoError(err)
+
+	const content = "hello blob"
+	ref, err := bs.Put(strings.NewReader(content))
+	r.NoError(err)
+
+	srv := httptest.NewServer(HTTPHandler(bs))
+	defer srv.Close()
+
+	get := func(path string, header http.Header) (*http.Response, string) {
+		req, err := http.NewRequest(http.MethodGet, srv.URL+path, nil)
+		r.NoError(err)
+		for k, v := range header {
+			req.Header[k] = v
+		}
+		resp, err := http.DefaultClient.Do(req)
+		r.NoError(err)
+		defer resp.Body.Close()
+		body, err := ioutil.ReadAll(resp.Body)
+		r.NoError(err)
+		return resp, string(body)
+	}
+	blobPath := func(sigil string) string { return "/" + url.PathEscape(sigil) }
+
+	// hit
+	resp, body := get(blobPath(ref.Sigil()), nil)
+	r.Equal(http.StatusOK, resp.StatusCode)
+	r.Equal(content, body)
+	r.Equal(strconv.Itoa(len(content)), resp.Header.Get("Content-Length"))
+	etag := resp.Header.Get("ETag")
+	r.Equal(strconv.Quote(ref.Sigil()), etag)
+	r.True(strings.HasPrefix(resp.Header.Get("Content-Type"), "text/plain"), resp.Header.Get("Content-Type"))
+	r.Equal("nosniff", resp.Header.Get("X-Content-Type-Options"))
+	r.Equal("sandbox", resp.Header.Get("Content-Security-Policy"))
+
+	// markup isn't served as such
+	htmlRef, err := bs.Put(strings.NewReader("<html><script>alert(1)</script></html>"))
+	r.NoError(err)
+	resp, _ = get(blobPath(htmlRef.Sigil()), nil)
+	r.Equal(http.StatusOK, resp.StatusCode)
+	r.Equal("application/octet-stream", resp.Header.Get("Content-Type"))
+	r.Equal("nosniff", resp.Header.Get("X-Content-Type-Options"))
+
+	// conditional requests
+	resp, body = get(blobPath(ref.Sigil()), http.Header{"If-None-Match": {etag}})
+	r.Equal(http.StatusNotModified, resp.StatusCode)
+	r.Empty(body)
+	resp, _ = get(blobPath(ref.Sigil()), http.Header{"If-None-Match": {`"other", ` + etag}})
+	r.Equal(http.StatusNotModified, resp.StatusCode)
+	resp, body = get(blobPath(ref.Sigil()), http.Header{"If-None-Match": {`"other"`}})
+	r.Equal(http.StatusOK, resp.StatusCode)
+	r.Equal(content, body)
+
+	// miss
+	missing := "&ZR3jMW+ifnTWqd5hnrrGjjt4HpUn/dAMXvcUOx+lgbY=.sha256"
+	resp, _ = get(blobPath(missing), nil)
+	r.Equal(http.StatusNotFound, resp.StatusCode)
+
+	// malformed references and escapes from the store
+	for _, path := range []string{
+		"/",
+		"/foo",
+		"/" + url.PathEscape("&tooshort=.sha256"),
+		"/" + url.PathEscape("%ZR3jMW+ifnTWqd5hnrrGjjt4HpUn/dAMXvcUOx+lgbY=.sha256"),
+		"/../../../etc/passwd",
+		"/%2e%2e%2f%2e%2e%2fetc%2fpasswd",
+		"/sha256/" + ref.Sigil()[1:3],
+	} {
+		resp, _ = get(path, nil)
+		r.Equal(http.StatusBadRequest, resp.StatusCode, path)
+	}
+
+	req, err := http.NewRequest(http.MethodPost, srv.URL+blobPath(ref.Sigil()), nil)
+	r.NoError(err)
+	resp, err = http.DefaultClient.Do(req)
+	r.NoError(err)
+	resp.Body.Close()
+	r.Equal(http.StatusMethodNotAllowed, resp.StatusCode)
+}
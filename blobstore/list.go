@@ -7,7 +7,9 @@ package blobstore
 import (
 	"context"
 	"encoding/hex"
+	"errors"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 	"sync"
@@ -17,55 +19,94 @@ import (
 	"github.com/ssbc/go-luigi"
 )
 
+// listBatchSize is the number of directory entries read at once, so that big stores aren't read into memory in one go
+const listBatchSize = 128
+
+// listSource walks the hex directories of the store and returns the refs of the blob files in them.
+// Blobs can be added and removed while it runs. Added ones might be missed and removed ones are skipped if they are already gone.
+// Files and directories that don't look like blobs, like leftovers of an interrupted Put, are skipped.
 type listSource struct {
 	basePath string
 
-	l     sync.Mutex
-	dirs  []string
-	files []string
+	l    sync.Mutex
+	dirs []string
+
+	curDirName string
+	curDir     *os.File
+	files      []string
 }
 
 func (src *listSource) initialize() error {
 	root, err := os.Open(src.basePath)
 	if err != nil {
+		if os.IsNotExist(err) {
+			src.dirs = []string{}
+			return nil
+		}
 		return fmt.Errorf("error opening blobs directory: %w", err)
 	}
+	defer root.Close()
 
-	dirs, err := root.Readdir(0)
+	// at most 256 of them
+	names, err := root.Readdirnames(0)
 	if err != nil {
 		return fmt.Errorf("error reading blobs directory: %w", err)
 	}
 
-	src.dirs = make([]string, len(dirs))
-	for i := range dirs {
-		src.dirs[i] = dirs[i].Name()
+	src.dirs = make([]string, 0, len(names))
+	for _, name := range names {
+		if isHexName(name, 2) {
+			src.dirs = append(src.dirs, name)
+		}
 	}
 
 	return nil
 }
 
+// nextDir opens the next directory that still exists
 func (src *listSource) nextDir() error {
-	var dirPath string
-	dirPath, src.dirs = src.dirs[0], src.dirs[1:]
+	var dirName string
+	dirName, src.dirs = src.dirs[0], src.dirs[1:]
 
-	dir, err := os.Open(filepath.Join(src.basePath, dirPath))
+	dir, err := os.Open(filepath.Join(src.basePath, dirName))
 	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
 		return fmt.Errorf("error opening subdirectory: %w", err)
 	}
 
-	blobs, err := dir.Readdir(0)
-	if err != nil {
+	src.curDirName = dirName
+	src.curDir = dir
+	return nil
+}
+
+// nextFiles reads the next batch of names in the current directory and closes it once all are read
+func (src *listSource) nextFiles() error {
+	names, err := src.curDir.Readdirnames(listBatchSize)
+	if err != nil && !errors.Is(err, io.EOF) {
+		src.closeDir()
 		return fmt.Errorf("error reading blobs subdirectory: %w", err)
 	}
 
-	src.files = make([]string, len(blobs))
-	for i := range blobs {
-		src.files[i] = dirPath + blobs[i].Name()
+	if len(names) == 0 {
+		return src.closeDir()
 	}
 
+	for _, name := range names {
+		if isHexName(name, 62) {
+			src.files = append(src.files, name)
+		}
+	}
 	return nil
 }
 
+func (src *listSource) closeDir() error {
+	err := src.curDir.Close()
+	src.curDir = nil
+	return err
+}
+
 func (src *listSource) Next(ctx context.Context) (interface{}, error) {
 	src.l.Lock()
 	defer src.l.Unlock()
@@ -77,24 +118,50 @@ func (src *listSource) Next(ctx context.Context) (interface{}, error) {
 		}
 	}
 
-	for len(src.files) == 0 {
-		if len(src.dirs) == 0 {
-			return nil, luigi.EOS{}
+	for {
+		if err := ctx.Err(); err != nil {
+			return nil, err
 		}
 
-		err := src.nextDir()
-		if err != nil {
-			return nil, fmt.Errorf("error reading next subdirectory: %w", err)
+		for len(src.files) == 0 {
+			if src.curDir != nil {
+				if err := src.nextFiles(); err != nil {
+					return nil, fmt.Errorf("error reading next blobs: %w", err)
+				}
+				continue
+			}
+
+			if len(src.dirs) == 0 {
+				return nil, luigi.EOS{}
+			}
+
+			if err := src.nextDir(); err != nil {
+				return nil, fmt.Errorf("error reading next subdirectory: %w", err)
+			}
 		}
-	}
 
-	var file string
-	file, src.files = src.files[0], src.files[1:]
+		var file string
+		file, src.files = src.files[0], src.files[1:]
 
-	raw, err := hex.DecodeString(file)
-	if err != nil {
-		return nil, fmt.Errorf("error decoding hex file name %q: %w", file, err)
+		// it might have been deleted since the directory was read
+		fi, err := os.Lstat(filepath.Join(src.basePath, src.curDirName, file))
+		if err != nil || !fi.Mode().IsRegular() {
+			continue
+		}
+
+		raw, err := hex.DecodeString(src.curDirName + file)
+		if err != nil {
+			return nil, fmt.Errorf("error decoding hex file name %q: %w", file, err)
+		}
+
+		return refs.NewBlobRefFromBytes(raw, refs.RefAlgoBlobSSB1)
 	}
+}
 
-	return refs.NewBlobRefFromBytes(raw, refs.RefAlgoBlobSSB1)
+func isHexName(name string, length int) bool {
+	if len(name) != length {
+		return false
+	}
+	_, err := hex.DecodeString(name)
+	return err == nil
 }
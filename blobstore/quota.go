@@ -0,0 +1,195 @@
+// SPDX-FileCopyrightText: 2021 The Go-SSB Authors
+//
+// SPDX-License-Identifier: MIT
+
+package blobstore
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ssbc/go-luigi"
+	refs "github.com/ssbc/go-ssb-refs"
+)
+
+// ErrQuotaExceeded is returned by Put if storing the blob would use more space than the disk quota allows.
+var ErrQuotaExceeded = errors.New("ssb: blob store quota exceeded")
+
+// QuotaPolicy decides what happens if a new blob doesn't fit into the disk quota.
+type QuotaPolicy uint
+
+const (
+	// QuotaReject makes Put fail with ErrQuotaExceeded.
+	QuotaReject QuotaPolicy = iota
+
+	// QuotaEvictLRU deletes the blobs which weren't read or written for the longest time until the new one fits.
+	// Blobs which are bigger than the whole quota are still rejected.
+	QuotaEvictLRU
+)
+
+// DiskUsager is implemented by blob stores which keep track of the space their blobs use.
+type DiskUsager interface {
+	// DiskUsage returns the bytes used by blobs and the quota. A quota of zero means there is none.
+	DiskUsage() (used, quota int64)
+}
+
+var _ DiskUsager = (*blobStore)(nil)
+
+// diskQuota keeps track of the used space and the order in which blobs were accessed.
+// The front of lru is the most recently used blob.
+type diskQuota struct {
+	limit  int64
+	policy QuotaPolicy
+
+	mu      sync.Mutex
+	used    int64
+	lru     *list.List
+	entries map[string]*list.Element
+}
+
+type quotaEntry struct {
+	ref  refs.BlobRef
+	size int64
+}
+
+func newDiskQuota(limit int64, policy QuotaPolicy) *diskQuota {
+	return &diskQuota{
+		limit:   limit,
+		policy:  policy,
+		lru:     list.New(),
+		entries: make(map[string]*list.Element),
+	}
+}
+
+// load adds the blobs which are already in the store, the ones modified most recently count as used most recently.
+// This is the only time the store is scanned, afterwards the usage is updated by Put and Delete.
+func (q *diskQuota) load(store *blobStore) error {
+	type existing struct {
+		quotaEntry
+		mtime time.Time
+	}
+	var blobs []existing
+
+	src := store.List()
+	for {
+		v, err := src.Next(context.TODO())
+		if luigi.IsEOS(err) {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("failed to list blobs: %w", err)
+		}
+
+		ref := v.(refs.BlobRef)
+		blobPath, err := store.getPath(ref)
+		if err != nil {
+			return err
+		}
+		fi, err := os.Stat(blobPath)
+		if err != nil {
+			// removed in the meantime
+			continue
+		}
+		blobs = append(blobs, existing{quotaEntry{ref, fi.Size()}, fi.ModTime()})
+	}
+
+	sort.Slice(blobs, func(i, j int) bool {
+		return blobs[i].mtime.Before(blobs[j].mtime)
+	})
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for _, b := range blobs {
+		q.entries[b.ref.Sigil()] = q.lru.PushFront(&quotaEntry{b.ref, b.size})
+		q.used += b.size
+	}
+	return nil
+}
+
+// touch marks the blob as used most recently.
+func (q *diskQuota) touch(ref refs.BlobRef) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if el, has := q.entries[ref.Sigil()]; has {
+		q.lru.MoveToFront(el)
+	}
+}
+
+// reserve adds the new blob to the used space. added is false if the blob was already stored.
+// With QuotaEvictLRU it returns the blobs that need to be deleted to make room for it. They are already subtracted from the used space.
+// If the new blob isn't stored after all, the reservation is undone with cancel.
+func (q *diskQuota) reserve(ref refs.BlobRef, size int64) (evicted []quotaEntry, added bool, err error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if el, has := q.entries[ref.Sigil()]; has {
+		q.lru.MoveToFront(el)
+		return nil, false, nil
+	}
+
+	if q.used+size > q.limit {
+		if q.policy != QuotaEvictLRU || size > q.limit {
+			return nil, false, ErrQuotaExceeded
+		}
+	}
+
+	for q.used+size > q.limit {
+		el := q.lru.Back()
+		entry := el.Value.(*quotaEntry)
+		q.lru.Remove(el)
+		delete(q.entries, entry.ref.Sigil())
+		q.used -= entry.size
+		evicted = append(evicted, *entry)
+	}
+
+	q.entries[ref.Sigil()] = q.lru.PushFront(&quotaEntry{ref, size})
+	q.used += size
+	return evicted, true, nil
+}
+
+// cancel undoes reserve. The space of ref is freed and the blobs which would have been evicted for it are added back as the least recently used.
+func (q *diskQuota) cancel(ref refs.BlobRef, evicted []quotaEntry) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if el, has := q.entries[ref.Sigil()]; has {
+		q.lru.Remove(el)
+		delete(q.entries, ref.Sigil())
+		q.used -= el.Value.(*quotaEntry).size
+	}
+
+	// the last one evicted was the most recently used of them
+	for i := len(evicted) - 1; i >= 0; i-- {
+		entry := evicted[i]
+		if _, has := q.entries[entry.ref.Sigil()]; has {
+			continue
+		}
+		q.entries[entry.ref.Sigil()] = q.lru.PushBack(&entry)
+		q.used += entry.size
+	}
+}
+
+// remove frees the space of the blob.
+func (q *diskQuota) remove(ref refs.BlobRef) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	el, has := q.entries[ref.Sigil()]
+	if !has {
+		return
+	}
+	q.lru.Remove(el)
+	delete(q.entries, ref.Sigil())
+	q.used -= el.Value.(*quotaEntry).size
+}
+
+func (q *diskQuota) usage() int64 {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.used
+}
@@ -15,6 +15,7 @@ import (
 	"log"
 	"os"
 	"path/filepath"
+	"time"
 
 	"github.com/ssbc/go-luigi"
 	"github.com/ssbc/go-ssb/internal/broadcasts"
@@ -29,7 +30,7 @@ var ErrNoSuchBlob = errors.New("ssb: no such blob")
 // New creates a new BlobStore, storing it's blobs at the given path.
 // This store is functionally equivalent to the javascript implementation and thus can share it's path.
 // ie: 'ln -s ~/.ssb/blobs ~/.ssb-go/blobs' works to deduplicate the storage.
-func New(basePath string) (ssb.BlobStore, error) {
+func New(basePath string, opts ...Option) (ssb.BlobStore, error) {
 	err := os.MkdirAll(filepath.Join(basePath, "sha256"), 0700)
 	if err != nil {
 		return nil, fmt.Errorf("error making dir for hash sha256: %w", err)
@@ -45,12 +46,32 @@ func New(basePath string) (ssb.BlobStore, error) {
 		bcst:     broadcasts.NewBlobStoreBroadcast(),
 	}
 
+	for i, o := range opts {
+		if err := o(bs); err != nil {
+			return nil, fmt.Errorf("blobstore: failed to apply option %d: %w", i, err)
+		}
+	}
+
+	if bs.quotaLimit > 0 {
+		bs.quota = newDiskQuota(bs.quotaLimit, bs.quotaPolicy)
+		if err := bs.quota.load(bs); err != nil {
+			return nil, fmt.Errorf("blobstore: failed to compute disk usage: %w", err)
+		}
+	}
+
 	return bs, nil
 }
 
 type blobStore struct {
 	basePath string
 
+	verifyOnRead bool
+	quarantine   bool
+
+	quotaLimit  int64
+	quotaPolicy QuotaPolicy
+	quota       *diskQuota
+
 	bcst *broadcasts.BlobStoreBroadcast
 }
 
@@ -106,23 +127,40 @@ func (store *blobStore) Get(b refs.BlobRef) (io.ReadCloser, error) {
 		return nil, fmt.Errorf("error opening blob file: %w", err)
 	}
 
+	if store.quota != nil {
+		store.quota.touch(b)
+	}
+
+	if store.verifyOnRead {
+		return newVerifyingReader(store, b, blobPath, f), nil
+	}
+
 	return f, nil
 }
 
 func (store *blobStore) Put(blob io.Reader) (refs.BlobRef, error) {
+	// every Put gets its own tmp file, so concurrent ones never write to the same file
 	f, err := ioutil.TempFile(filepath.Join(store.basePath, "tmp"), "rxblob-*")
 	if err != nil {
 		return refs.BlobRef{}, fmt.Errorf("blobstore.Put: error creating tmp file: %w", err)
 	}
+	tmpPath := f.Name()
+
+	// the name of a moved tmp file might already be in use by another Put
+	moved := false
+	defer func() {
+		if !moved {
+			os.Remove(tmpPath)
+		}
+	}()
 
 	h := sha256.New()
 	n, err := io.Copy(io.MultiWriter(f, h), blob)
 	if err != nil && !luigi.IsEOS(err) {
+		f.Close()
 		return refs.BlobRef{}, fmt.Errorf("blobstore.Put: error copying: %w", err)
 	}
 
-	tmpPath := f.Name()
-
 	if err := f.Close(); err != nil {
 		return refs.BlobRef{}, fmt.Errorf("blobstore.Put: error closing tmp file: %w", err)
 	}
@@ -132,6 +170,26 @@ func (store *blobStore) Put(blob io.Reader) (refs.BlobRef, error) {
 		return refs.BlobRef{}, err
 	}
 
+	// the evicted blobs are only deleted once the new one is stored, until then the reservation is undone on errors
+	var (
+		evicted []quotaEntry
+		stored  bool
+	)
+	if store.quota != nil {
+		var added bool
+		evicted, added, err = store.quota.reserve(ref, n)
+		if err != nil {
+			return refs.BlobRef{}, fmt.Errorf("blobstore.Put: %w", err)
+		}
+		if added {
+			defer func() {
+				if !stored {
+					store.quota.cancel(ref, evicted)
+				}
+			}()
+		}
+	}
+
 	hexDirPath, err := store.getHexDirPath(ref)
 	if err != nil {
 		return refs.BlobRef{}, fmt.Errorf("blobstore.Put: error getting hex dir path: %w", err)
@@ -150,8 +208,12 @@ func (store *blobStore) Put(blob io.Reader) (refs.BlobRef, error) {
 		return refs.BlobRef{}, fmt.Errorf("blobstore.Put: error getting final path: %w", err)
 	}
 
+	// blobs are content-addressed, so if another Put of the same content got there first, both are done.
+	// Rename replaces an existing file atomically on unix but fails on windows, which is why the error is checked against the final path.
 	err = os.Rename(tmpPath, finalPath)
-	if err != nil {
+	if err == nil {
+		moved = true
+	} else if !isRegularFile(finalPath) {
 		if _, ok := err.(*os.LinkError); ok {
 			_, err1 := os.Stat(tmpPath)
 			_, err2 := os.Stat(hexDirPath)
@@ -161,6 +223,13 @@ func (store *blobStore) Put(blob io.Reader) (refs.BlobRef, error) {
 		}
 		return refs.BlobRef{}, fmt.Errorf("error moving blob from temp path %q to final path %q: %w", tmpPath, finalPath, err)
 	}
+	stored = true
+
+	for _, old := range evicted {
+		if err := store.remove(old.ref); err != nil && !errors.Is(err, ErrNoSuchBlob) {
+			return refs.BlobRef{}, fmt.Errorf("blobstore.Put: failed to evict %s: %w", old.ref.ShortSigil(), err)
+		}
+	}
 
 	err = store.bcst.EmitBlob(ssb.BlobStoreNotification{
 		Op:  ssb.BlobStoreOpPut,
@@ -175,7 +244,24 @@ func (store *blobStore) Put(blob io.Reader) (refs.BlobRef, error) {
 	return ref, nil
 }
 
+func isRegularFile(path string) bool {
+	fi, err := os.Lstat(path)
+	return err == nil && fi.Mode().IsRegular()
+}
+
 func (store *blobStore) Delete(ref refs.BlobRef) error {
+	if err := store.remove(ref); err != nil {
+		return err
+	}
+
+	if store.quota != nil {
+		store.quota.remove(ref)
+	}
+	return nil
+}
+
+// remove deletes the file of the blob and notifies about it, without updating the quota.
+func (store *blobStore) remove(ref refs.BlobRef) error {
 	p, err := store.getPath(ref)
 	if err != nil {
 		return fmt.Errorf("error getting blob path: %w", err)
@@ -206,6 +292,15 @@ func (store *blobStore) List() luigi.Source {
 	}
 }
 
+// DiskUsage returns the space used by the blobs in the store and the quota.
+// Without a quota, the usage isn't tracked and both are zero.
+func (store *blobStore) DiskUsage() (used, quota int64) {
+	if store.quota == nil {
+		return 0, 0
+	}
+	return store.quota.usage(), store.quota.limit
+}
+
 func (store *blobStore) Size(ref refs.BlobRef) (int64, error) {
 	blobPath, err := store.getPath(ref)
 	if err != nil {
@@ -224,3 +319,29 @@ func (store *blobStore) Size(ref refs.BlobRef) (int64, error) {
 	return fi.Size(), nil
 
 }
+
+// ModTimer is implemented by blob stores which know when a blob was stored.
+type ModTimer interface {
+	// ModTime returns when the blob with the given ref was written to the store.
+	ModTime(ref refs.BlobRef) (time.Time, error)
+}
+
+var _ ModTimer = (*blobStore)(nil)
+
+func (store *blobStore) ModTime(ref refs.BlobRef) (time.Time, error) {
+	blobPath, err := store.getPath(ref)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("error getting path: %w", err)
+	}
+
+	fi, err := os.Stat(blobPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return time.Time{}, ErrNoSuchBlob
+		}
+
+		return time.Time{}, fmt.Errorf("error getting file info: %w", err)
+	}
+
+	return fi.ModTime(), nil
+}
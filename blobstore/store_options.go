@@ -0,0 +1,48 @@
+// SPDX-FileCopyrightText: 2021 The Go-SSB Authors
+//
+// SPDX-License-Identifier: MIT
+
+package blobstore
+
+import "fmt"
+
+// Option is used to tune different aspects of the blob store.
+type Option func(*blobStore) error
+
+// WithVerifyOnRead makes Get hash the blob while it is being read.
+// Readers returned by Get then fail with ErrHashMismatch at the end of the blob if the stored bytes don't match the requested reference.
+func WithVerifyOnRead(yes bool) Option {
+	return func(store *blobStore) error {
+		store.verifyOnRead = yes
+		return nil
+	}
+}
+
+// WithQuarantine moves blobs that failed verification out of the store and into the quarantine directory.
+// It only has an effect together with WithVerifyOnRead.
+func WithQuarantine(yes bool) Option {
+	return func(store *blobStore) error {
+		store.quarantine = yes
+		return nil
+	}
+}
+
+// WithDiskQuota limits the space the blobs in the store can use to the passed number of bytes.
+// The blobs already in the store are counted once when it is opened. What happens to blobs that don't fit is decided by WithQuotaPolicy.
+func WithDiskQuota(bytes int64) Option {
+	return func(store *blobStore) error {
+		if bytes <= 0 {
+			return fmt.Errorf("disk quota needs to be positive, got %d", bytes)
+		}
+		store.quotaLimit = bytes
+		return nil
+	}
+}
+
+// WithQuotaPolicy sets what Put does if a blob doesn't fit into the disk quota. The default is QuotaReject.
+func WithQuotaPolicy(policy QuotaPolicy) Option {
+	return func(store *blobStore) error {
+		store.quotaPolicy = policy
+		return nil
+	}
+}
@@ -5,12 +5,17 @@
 package blobstore
 
 import (
+	"bytes"
 	"context"
+	"crypto/sha256"
 	"fmt"
 	"io/ioutil"
 	"os"
+	"path/filepath"
 	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	refs "github.com/ssbc/go-ssb-refs"
 	"github.com/stretchr/testify/assert"
@@ -187,3 +192,438 @@ func TestStore(t *testing.T) {
 		t.Run(fmt.Sprint(i), mkTest(tc))
 	}
 }
+
+func TestStoreVerifyOnRead(t *testing.T) {
+	r := require.New(t)
+
+	name := "TestStoreVerifyOnRead"
+	os.RemoveAll(name)
+	defer os.RemoveAll(name)
+
+	plain, err := New(name)
+	r.NoError(err)
+
+	ref, err := plain.Put(strings.NewReader("omg"))
+	r.NoError(err)
+
+	// corrupt the stored file
+	blobPath, err := plain.(*blobStore).getPath(ref)
+	r.NoError(err)
+	err = ioutil.WriteFile(blobPath, []byte("wat"), 0600)
+	r.NoError(err)
+
+	// without verification the wrong bytes are served
+	rd, err := plain.Get(ref)
+	r.NoError(err)
+	data, err := ioutil.ReadAll(rd)
+	r.NoError(err)
+	r.Equal("wat", string(data))
+	r.NoError(rd.Close())
+
+	verifying, err := New(name, WithVerifyOnRead(true), WithQuarantine(true), WithDiskQuota(100))
+	r.NoError(err)
+	used, _ := verifying.(DiskUsager).DiskUsage()
+	r.EqualValues(3, used)
+
+	removed := make(chan refs.BlobRef, 1)
+	verifying.Register(broadcasts.BlobStoreFuncEmitter(func(not ssb.BlobStoreNotification) error {
+		if not.Op == ssb.BlobStoreOpRm {
+			removed <- not.Ref
+		}
+		return nil
+	}))
+
+	rd, err = verifying.Get(ref)
+	r.NoError(err)
+	_, err = ioutil.ReadAll(rd)
+	r.ErrorIs(err, ErrHashMismatch)
+	r.NoError(rd.Close())
+
+	// the corrupted file was moved out of the way and no longer counts against the quota
+	_, err = verifying.Get(ref)
+	r.Equal(ErrNoSuchBlob, err)
+	used, _ = verifying.(DiskUsager).DiskUsage()
+	r.EqualValues(0, used)
+	select {
+	case rm := <-removed:
+		r.True(rm.Equal(ref))
+	case <-time.After(5 * time.Second):
+		t.Fatal("no notification that the quarantined blob is gone")
+	}
+
+	// intact blobs still verify
+	ref, err = verifying.Put(strings.NewReader("omg"))
+	r.NoError(err)
+	rd, err = verifying.Get(ref)
+	r.NoError(err)
+	data, err = ioutil.ReadAll(rd)
+	r.NoError(err)
+	r.Equal("omg", string(data))
+	r.NoError(rd.Close())
+}
+
+func TestStoreList(t *testing.T) {
+	r := require.New(t)
+
+	name := "TestStoreList"
+	os.RemoveAll(name)
+	defer os.RemoveAll(name)
+
+	bs, err := New(name)
+	r.NoError(err)
+
+	want := make(map[string]struct{})
+	var stored []refs.BlobRef
+	for i := 0; i < 20; i++ {
+		ref, err := bs.Put(strings.NewReader(fmt.Sprint("blob ", i)))
+		r.NoError(err)
+		want[ref.Sigil()] = struct{}{}
+		stored = append(stored, ref)
+	}
+
+	// things that aren't blobs are skipped
+	blobPath, err := bs.(*blobStore).getPath(stored[0])
+	r.NoError(err)
+	r.NoError(ioutil.WriteFile(blobPath+".partial", []byte("junk"), 0600))
+	r.NoError(os.MkdirAll(filepath.Join(name, "sha256", "not-hex"), 0700))
+	r.NoError(ioutil.WriteFile(filepath.Join(name, "sha256", "not-hex", "file"), []byte("junk"), 0600))
+
+	listAll := func() map[string]struct{} {
+		got := make(map[string]struct{})
+		src := bs.List()
+		for {
+			v, err := src.Next(context.TODO())
+			if luigi.IsEOS(err) {
+				return got
+			}
+			r.NoError(err)
+
+			ref, ok := v.(refs.BlobRef)
+			r.True(ok, "got something that is not a blobref in list: %v(%T)", v, v)
+			got[ref.Sigil()] = struct{}{}
+		}
+	}
+	r.Equal(want, listAll())
+
+	// removing blobs while listing doesn't break it
+	src := bs.List()
+	v, err := src.Next(context.TODO())
+	r.NoError(err)
+	first := v.(refs.BlobRef)
+
+	for _, ref := range stored {
+		if ref.Equal(first) {
+			continue
+		}
+		r.NoError(bs.Delete(ref))
+	}
+
+	for {
+		v, err := src.Next(context.TODO())
+		if luigi.IsEOS(err) {
+			break
+		}
+		r.NoError(err)
+		r.True(v.(refs.BlobRef).Equal(first), "got deleted blob %s", v)
+	}
+}
+
+func TestStoreQuotaReject(t *testing.T) {
+	r := require.New(t)
+
+	name := "TestStoreQuotaReject"
+	os.RemoveAll(name)
+	defer os.RemoveAll(name)
+
+	bs, err := New(name, WithDiskQuota(10))
+	r.NoError(err)
+	du := bs.(DiskUsager)
+
+	ref1, err := bs.Put(strings.NewReader("12345"))
+	r.NoError(err)
+	_, err = bs.Put(strings.NewReader("abcde"))
+	r.NoError(err)
+
+	used, quota := du.DiskUsage()
+	r.EqualValues(10, used)
+	r.EqualValues(10, quota)
+
+	// storing the same blob again doesn't need more space
+	_, err = bs.Put(strings.NewReader("12345"))
+	r.NoError(err)
+
+	_, err = bs.Put(strings.NewReader("!"))
+	r.ErrorIs(err, ErrQuotaExceeded)
+	used, _ = du.DiskUsage()
+	r.EqualValues(10, used)
+
+	tmpFiles, err := ioutil.ReadDir(filepath.Join(name, "tmp"))
+	r.NoError(err)
+	r.Len(tmpFiles, 0, "rejected blob left behind")
+
+	r.NoError(bs.Delete(ref1))
+	used, _ = du.DiskUsage()
+	r.EqualValues(5, used)
+
+	_, err = bs.Put(strings.NewReader("xyz"))
+	r.NoError(err)
+
+	// the usage of existing blobs is picked up when the store is opened again
+	bs, err = New(name, WithDiskQuota(10))
+	r.NoError(err)
+	used, _ = bs.(DiskUsager).DiskUsage()
+	r.EqualValues(8, used)
+
+	_, err = bs.Put(strings.NewReader("uvw"))
+	r.ErrorIs(err, ErrQuotaExceeded)
+}
+
+func TestStoreQuotaQuarantine(t *testing.T) {
+	r := require.New(t)
+
+	name := "TestStoreQuotaQuarantine"
+	os.RemoveAll(name)
+	defer os.RemoveAll(name)
+
+	bs, err := New(name, WithDiskQuota(10), WithVerifyOnRead(true), WithQuarantine(true))
+	r.NoError(err)
+	du := bs.(DiskUsager)
+
+	corrupted, err := bs.Put(strings.NewReader("12345"))
+	r.NoError(err)
+	_, err = bs.Put(strings.NewReader("abcde"))
+	r.NoError(err)
+
+	_, err = bs.Put(strings.NewReader("xyz"))
+	r.ErrorIs(err, ErrQuotaExceeded)
+
+	blobPath, err := bs.(*blobStore).getPath(corrupted)
+	r.NoError(err)
+	r.NoError(ioutil.WriteFile(blobPath, []byte("54321"), 0600))
+
+	rd, err := bs.Get(corrupted)
+	r.NoError(err)
+	_, err = ioutil.ReadAll(rd)
+	r.ErrorIs(err, ErrHashMismatch)
+	r.NoError(rd.Close())
+
+	// the quarantined bytes don't count anymore
+	used, _ := du.DiskUsage()
+	r.EqualValues(5, used)
+
+	_, err = bs.Put(strings.NewReader("xyz"))
+	r.NoError(err)
+	used, _ = du.DiskUsage()
+	r.EqualValues(8, used)
+
+	// not after opening the store again either
+	bs, err = New(name, WithDiskQuota(10))
+	r.NoError(err)
+	used, _ = bs.(DiskUsager).DiskUsage()
+	r.EqualValues(8, used)
+}
+
+func TestStoreQuotaEvictLRU(t *testing.T) {
+	r := require.New(t)
+
+	name := "TestStoreQuotaEvictLRU"
+	os.RemoveAll(name)
+	defer os.RemoveAll(name)
+
+	bs, err := New(name, WithDiskQuota(9), WithQuotaPolicy(QuotaEvictLRU))
+	r.NoError(err)
+	du := bs.(DiskUsager)
+
+	has := func(ref refs.BlobRef) bool {
+		_, err := bs.Size(ref)
+		if err == ErrNoSuchBlob {
+			return false
+		}
+		r.NoError(err)
+		return true
+	}
+
+	refA, err := bs.Put(strings.NewReader("aaa"))
+	r.NoError(err)
+	refB, err := bs.Put(strings.NewReader("bbb"))
+	r.NoError(err)
+	refC, err := bs.Put(strings.NewReader("ccc"))
+	r.NoError(err)
+
+	// reading a makes b the least recently used
+	rd, err := bs.Get(refA)
+	r.NoError(err)
+	r.NoError(rd.Close())
+
+	refD, err := bs.Put(strings.NewReader("ddd"))
+	r.NoError(err)
+
+	r.False(has(refB), "b should have been evicted")
+	r.True(has(refA))
+	r.True(has(refC))
+	r.True(has(refD))
+
+	used, _ := du.DiskUsage()
+	r.EqualValues(9, used)
+
+	// exactly at the boundary, c and a have to go
+	refE, err := bs.Put(strings.NewReader("eeeeee"))
+	r.NoError(err)
+
+	r.False(has(refC))
+	r.False(has(refA))
+	r.True(has(refD))
+	r.True(has(refE))
+	used, _ = du.DiskUsage()
+	r.EqualValues(9, used)
+
+	// blobs bigger than the whole quota don't evict anything
+	_, err = bs.Put(strings.NewReader("0123456789"))
+	r.ErrorIs(err, ErrQuotaExceeded)
+	r.True(has(refD))
+	r.True(has(refE))
+	used, _ = du.DiskUsage()
+	r.EqualValues(9, used)
+
+	// a blob that can't be stored doesn't evict anything either
+	sum := sha256.Sum256([]byte("fff"))
+	refF, err := refs.NewBlobRefFromBytes(sum[:], refs.RefAlgoBlobSSB1)
+	r.NoError(err)
+	hexDir, err := bs.(*blobStore).getHexDirPath(refF)
+	r.NoError(err)
+	r.NoError(ioutil.WriteFile(hexDir, []byte("in the way"), 0600))
+
+	_, err = bs.Put(strings.NewReader("fff"))
+	r.Error(err)
+	r.True(has(refD))
+	r.True(has(refE))
+	used, _ = du.DiskUsage()
+	r.EqualValues(9, used)
+
+	// once it can, d is still the least recently used
+	r.NoError(os.Remove(hexDir))
+	_, err = bs.Put(strings.NewReader("fff"))
+	r.NoError(err)
+	r.False(has(refD))
+	r.True(has(refE))
+	r.True(has(refF))
+	used, _ = du.DiskUsage()
+	r.EqualValues(9, used)
+}
+
+func TestStoreConcurrentPut(t *testing.T) {
+	r := require.New(t)
+
+	bs, err := New(t.TempDir())
+	r.NoError(err)
+	store := bs.(*blobStore)
+
+	const n = 50
+	same := []byte("the same content, put many times at once")
+
+	type result struct {
+		ref     refs.BlobRef
+		content []byte
+		err     error
+	}
+	results := make(chan result, 2*n)
+
+	var start sync.WaitGroup
+	start.Add(1)
+	for i := 0; i < n; i++ {
+		distinct := []byte(fmt.Sprintf("distinct content #%d", i))
+		for _, content := range [][]byte{same, distinct} {
+			go func(content []byte) {
+				start.Wait()
+				ref, err := bs.Put(bytes.NewReader(content))
+				results <- result{ref, content, err}
+			}(content)
+		}
+	}
+	start.Done()
+
+	stored := make(map[string][]byte)
+	for i := 0; i < 2*n; i++ {
+		res := <-results
+		r.NoError(res.err)
+		stored[res.ref.Sigil()] = res.content
+	}
+	r.Len(stored, n+1)
+
+	for sigil, want := range stored {
+		ref, err := refs.ParseBlobRef(sigil)
+		r.NoError(err)
+
+		rd, err := bs.Get(ref)
+		r.NoError(err)
+		got, err := ioutil.ReadAll(rd)
+		r.NoError(err)
+		r.NoError(rd.Close())
+		r.Equal(want, got, "wrong content for %s", sigil)
+	}
+
+	listed := 0
+	src := bs.List()
+	for {
+		_, err := src.Next(context.TODO())
+		if luigi.IsEOS(err) {
+			break
+		}
+		r.NoError(err)
+		listed++
+	}
+	r.Equal(n+1, listed)
+
+	tmpFiles, err := ioutil.ReadDir(filepath.Join(store.basePath, "tmp"))
+	r.NoError(err)
+	r.Empty(tmpFiles, "left over tmp files")
+}
+
+func TestStoreHasMany(t *testing.T) {
+	r := require.New(t)
+
+	name := "TestStoreHasMany"
+	os.RemoveAll(name)
+	defer os.RemoveAll(name)
+
+	bs, err := New(name)
+	r.NoError(err)
+
+	var (
+		asked []refs.BlobRef
+		want  = make(map[string]int64)
+	)
+	for i := 0; i < 10; i++ {
+		content := strings.Repeat("x", i+1)
+		ref, err := bs.Put(strings.NewReader(content))
+		r.NoError(err)
+		asked = append(asked, ref)
+		want[ref.Sigil()] = int64(len(content))
+
+		// an absent blob in the same directory as the stored one
+		hash := make([]byte, 32)
+		r.NoError(ref.CopyHashTo(hash))
+		hash[31] ^= 0xff
+		absent, err := refs.NewBlobRefFromBytes(hash, refs.RefAlgoBlobSSB1)
+		r.NoError(err)
+		asked = append(asked, absent)
+
+		// and one somewhere else
+		absent, err = refs.NewBlobRefFromBytes(bytes.Repeat([]byte{byte(i)}, 32), refs.RefAlgoBlobSSB1)
+		r.NoError(err)
+		asked = append(asked, absent)
+	}
+
+	sizes, err := HasMany(bs, asked)
+	r.NoError(err)
+	r.Equal(want, sizes)
+
+	// stores without HasMany are asked for each size
+	sizes, err = HasMany(struct{ ssb.BlobStore }{bs}, asked)
+	r.NoError(err)
+	r.Equal(want, sizes)
+
+	none, err := HasMany(bs, nil)
+	r.NoError(err)
+	r.Len(none, 0)
+}
@@ -0,0 +1,110 @@
+// SPDX-FileCopyrightText: 2021 The Go-SSB Authors
+//
+// SPDX-License-Identifier: MIT
+
+package blobstore
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
+
+	refs "github.com/ssbc/go-ssb-refs"
+
+	"github.com/ssbc/go-ssb"
+)
+
+// ErrHashMismatch is returned by readers from Get if the content of a stored blob doesn't match its reference
+var ErrHashMismatch = errors.New("ssb: blob hash mismatch")
+
+// verifyingReader hashes the blob while it is read and checks the sum once the underlying file is exhausted.
+type verifyingReader struct {
+	store *blobStore
+
+	ref  refs.BlobRef
+	path string
+
+	f *os.File
+	h hash.Hash
+
+	err error
+}
+
+func (vr *verifyingReader) Read(p []byte) (int, error) {
+	if vr.err != nil {
+		return 0, vr.err
+	}
+
+	n, err := vr.f.Read(p)
+	vr.h.Write(p[:n])
+	if err == io.EOF {
+		if verr := vr.verify(); verr != nil {
+			vr.err = verr
+			return n, verr
+		}
+	}
+	return n, err
+}
+
+func (vr *verifyingReader) verify() error {
+	var want = make([]byte, 32)
+	err := vr.ref.CopyHashTo(want)
+	if err != nil {
+		return err
+	}
+
+	if bytes.Equal(want, vr.h.Sum(nil)) {
+		return nil
+	}
+
+	if vr.store.quarantine {
+		vr.store.quarantineBlob(vr.ref, vr.path)
+	}
+
+	return ErrHashMismatch
+}
+
+func (vr *verifyingReader) Close() error {
+	return vr.f.Close()
+}
+
+func newVerifyingReader(store *blobStore, ref refs.BlobRef, path string, f *os.File) *verifyingReader {
+	return &verifyingReader{
+		store: store,
+		ref:   ref,
+		path:  path,
+		f:     f,
+		h:     sha256.New(),
+	}
+}
+
+// quarantineBlob moves a corrupted blob file into the quarantine directory.
+// The blob is then no longer served and can be fetched again from peers.
+// Like Delete, it frees the space of the blob from the quota and notifies that the blob is gone.
+func (store *blobStore) quarantineBlob(ref refs.BlobRef, blobPath string) {
+	qDir := filepath.Join(store.basePath, "quarantine")
+	err := os.MkdirAll(qDir, 0700)
+	if err != nil {
+		return
+	}
+
+	// the blob path is split into a directory for the first byte of the hash and the rest
+	name := filepath.Base(filepath.Dir(blobPath)) + filepath.Base(blobPath)
+	if err := os.Rename(blobPath, filepath.Join(qDir, name)); err != nil {
+		return
+	}
+
+	if store.quota != nil {
+		store.quota.remove(ref)
+	}
+
+	// the read already fails with ErrHashMismatch, errors of the handlers don't change that
+	store.bcst.EmitBlob(ssb.BlobStoreNotification{
+		Op:  ssb.BlobStoreOpRm,
+		Ref: ref,
+	})
+}
@@ -7,7 +7,9 @@ package blobstore
 import (
 	"context"
 
+	"github.com/dgraph-io/badger/v3"
 	"github.com/go-kit/kit/metrics"
+	refs "github.com/ssbc/go-ssb-refs"
 	"go.mindeco.de/log"
 )
 
@@ -25,7 +27,8 @@ func WantWithContext(ctx context.Context) WantManagerOption {
 // DefaultMaxSize is 5 megabyte. Blobs that are biggere are not fetched.
 const DefaultMaxSize = 5 * 1024 * 1024
 
-// WantWithMaxSize can be used to change DefaultMaxSize
+// WantWithMaxSize can be used to change DefaultMaxSize.
+// It is also the biggest blob the want manager tells peers about.
 func WantWithMaxSize(sz uint) WantManagerOption {
 	return func(mgr *WantManager) error {
 		mgr.maxSize = sz
@@ -49,3 +52,25 @@ func WantWithMetrics(g metrics.Gauge, ctr metrics.Counter) WantManagerOption {
 		return nil
 	}
 }
+
+// FeedDistance returns how many follows away from us a feed is, with our own feed at 0, and if we block it.
+// A negative distance means the feed can't be reached.
+type FeedDistance func(refs.FeedRef) (dist int, blocked bool)
+
+// WantWithFeedDistance makes WantFrom fetch the blobs of closer feeds first and ignore the ones of blocked feeds.
+// Without it, the blobs are fetched in the order the peers offer them.
+func WantWithFeedDistance(fd FeedDistance) WantManagerOption {
+	return func(mgr *WantManager) error {
+		mgr.feedDist = fd
+		return nil
+	}
+}
+
+// WantWithStore keeps the outstanding wants in db, so that they are wanted again after a restart.
+// db should not be used for anything else.
+func WantWithStore(db *badger.DB) WantManagerOption {
+	return func(mgr *WantManager) error {
+		mgr.store = &wantStore{db: db}
+		return nil
+	}
+}
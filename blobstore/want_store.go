@@ -0,0 +1,135 @@
+// SPDX-FileCopyrightText: 2021 The Go-SSB Authors
+//
+// SPDX-License-Identifier: MIT
+
+package blobstore
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/dgraph-io/badger/v3"
+	refs "github.com/ssbc/go-ssb-refs"
+	"go.mindeco.de/log/level"
+)
+
+// wantStore keeps the outstanding wants of a WantManager, so that they survive a restart.
+// The keys are the blob references, the values the JSON encoded storedWant.
+type wantStore struct {
+	db *badger.DB
+}
+
+type storedWant struct {
+	Dist int64 `json:"dist"`
+
+	// the feed which referenced the blob, if it was wanted with WantFrom
+	From *refs.FeedRef `json:"from,omitempty"`
+}
+
+func (ws wantStore) put(ref string, w storedWant) error {
+	val, err := json.Marshal(w)
+	if err != nil {
+		return fmt.Errorf("want store: failed to encode want: %w", err)
+	}
+	return ws.db.Update(func(txn *badger.Txn) error {
+		return txn.Set([]byte(ref), val)
+	})
+}
+
+func (ws wantStore) delete(ref string) error {
+	return ws.db.Update(func(txn *badger.Txn) error {
+		return txn.Delete([]byte(ref))
+	})
+}
+
+// all returns the stored wants by blob reference
+func (ws wantStore) all() (map[string]storedWant, error) {
+	wants := make(map[string]storedWant)
+	err := ws.db.View(func(txn *badger.Txn) error {
+		iter := txn.NewIterator(badger.DefaultIteratorOptions)
+		defer iter.Close()
+
+		for iter.Rewind(); iter.Valid(); iter.Next() {
+			it := iter.Item()
+			ref := string(it.KeyCopy(nil))
+			err := it.Value(func(val []byte) error {
+				var w storedWant
+				if err := json.Unmarshal(val, &w); err != nil {
+					return fmt.Errorf("want store: failed to decode want for %s: %w", ref, err)
+				}
+				wants[ref] = w
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return wants, nil
+}
+
+// persist writes the want for ref to the store, if there is one. wmgr.l needs to be locked.
+func (wmgr *WantManager) persist(ref string) {
+	if wmgr.store == nil {
+		return
+	}
+	w := storedWant{Dist: wmgr.wants[ref]}
+	if from, has := wmgr.sources[ref]; has {
+		w.From = &from
+	}
+	if err := wmgr.store.put(ref, w); err != nil {
+		level.Warn(wmgr.info).Log("event", "failed to persist want", "ref", ref, "err", err)
+	}
+}
+
+// unpersist removes the want for ref from the store, if there is one. wmgr.l needs to be locked.
+func (wmgr *WantManager) unpersist(ref string) {
+	if wmgr.store == nil {
+		return
+	}
+	if err := wmgr.store.delete(ref); err != nil {
+		level.Warn(wmgr.info).Log("event", "failed to remove persisted want", "ref", ref, "err", err)
+	}
+}
+
+// loadWants restores the wants of an earlier run from the store.
+// Wants for blobs which were stored in the meantime, or whose feed is blocked now, are dropped.
+func (wmgr *WantManager) loadWants() {
+	stored, err := wmgr.store.all()
+	if err != nil {
+		level.Warn(wmgr.info).Log("event", "failed to load persisted wants", "err", err)
+		return
+	}
+
+	for ref, w := range stored {
+		br, err := refs.ParseBlobRef(ref)
+		if err != nil {
+			level.Warn(wmgr.info).Log("event", "dropping invalid persisted want", "ref", ref, "err", err)
+			wmgr.unpersist(ref)
+			continue
+		}
+
+		if _, err := wmgr.bs.Size(br); err == nil { // received while we were offline
+			wmgr.unpersist(ref)
+			continue
+		}
+
+		if w.From != nil {
+			priority, blocked := wmgr.feedPriority(*w.From)
+			if blocked {
+				wmgr.unpersist(ref)
+				continue
+			}
+			wmgr.priorities[ref] = priority
+			wmgr.sources[ref] = *w.From
+		}
+		wmgr.wants[ref] = w.Dist
+	}
+
+	level.Debug(wmgr.info).Log("event", "loaded persisted wants", "n", len(wmgr.wants), "dropped", len(stored)-len(wmgr.wants))
+	wmgr.promGaugeSet("nwants", len(wmgr.wants))
+}
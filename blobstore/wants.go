@@ -10,6 +10,7 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"math"
 	"sync"
 	"time"
 
@@ -31,14 +32,16 @@ var ErrBlobBlocked = errors.New("ssb: unable to receive blob correctly")
 // NewWantManager returns the configured WantManager, using bs for storage and opts to configure it.
 func NewWantManager(bs ssb.BlobStore, opts ...WantManagerOption) *WantManager {
 	wmgr := &WantManager{
-		bs:        bs,
-		info:      log.NewNopLogger(),
-		maxSize:   DefaultMaxSize,
-		longCtx:   context.Background(),
-		wants:     make(map[string]int64),
-		blocked:   make(map[string]struct{}),
-		procs:     make(map[string]*wantProc),
-		available: make(chan *hasBlob),
+		bs:         bs,
+		info:       log.NewNopLogger(),
+		maxSize:    DefaultMaxSize,
+		longCtx:    context.Background(),
+		wants:      make(map[string]int64),
+		priorities: make(map[string]int),
+		sources:    make(map[string]refs.FeedRef),
+		blocked:    make(map[string]struct{}),
+		procs:      make(map[string]*wantProc),
+		available:  newFetchQueue(),
 	}
 
 	for i, o := range opts {
@@ -51,6 +54,10 @@ func NewWantManager(bs ssb.BlobStore, opts ...WantManagerOption) *WantManager {
 		wmgr.maxSize = DefaultMaxSize
 	}
 
+	if wmgr.store != nil {
+		wmgr.loadWants()
+	}
+
 	wmgr.promGaugeSet("proc", 0)
 
 	wmgr.wantsEmitter, wmgr.BlobWantsBroadcast = broadcasts.NewBlobWantsEmitter()
@@ -78,10 +85,20 @@ type WantManager struct {
 	wants        map[string]int64
 	wantsEmitter ssb.BlobWantsEmitter
 
+	// the distance of the closest feed which referenced a wanted blob, lower is fetched first
+	priorities map[string]int
+	feedDist   FeedDistance
+
+	// the feed which referenced a wanted blob, if it was wanted with WantFrom
+	sources map[string]refs.FeedRef
+
+	// where the wants are kept over restarts, see WantWithStore
+	store *wantStore
+
 	// the set of peers we interact with
 	procs map[string]*wantProc
 
-	available chan *hasBlob
+	available *fetchQueue
 
 	l sync.Mutex // TODO: what is this protecting
 
@@ -91,7 +108,11 @@ type WantManager struct {
 }
 
 func (wmgr *WantManager) replicateLoop() {
-	for has := range wmgr.available {
+	for {
+		has, ok := wmgr.available.pop()
+		if !ok {
+			return
+		}
 		wmgr.handleHasBlob(has)
 	}
 }
@@ -144,6 +165,9 @@ func (wmgr *WantManager) EmitBlob(n ssb.BlobStoreNotification) error {
 	if n.Op == ssb.BlobStoreOpPut {
 		if _, ok := wmgr.wants[n.Ref.Sigil()]; ok {
 			delete(wmgr.wants, n.Ref.Sigil())
+			delete(wmgr.priorities, n.Ref.Sigil())
+			delete(wmgr.sources, n.Ref.Sigil())
+			wmgr.unpersist(n.Ref.Sigil())
 
 			wmgr.promGaugeSet("nwants", len(wmgr.wants))
 		}
@@ -156,6 +180,8 @@ type hasBlob struct {
 	want    ssb.BlobWant
 	remote  muxrpc.Endpoint
 	connCtx context.Context
+
+	priority int
 }
 
 func (wmgr *WantManager) getBlob(ctx context.Context, edp muxrpc.Endpoint, ref refs.BlobRef) error {
@@ -213,7 +239,7 @@ func (wmgr *WantManager) Close() error {
 	wmgr.l.Lock()
 	defer wmgr.l.Unlock()
 	// TODO: wait for wantproce
-	close(wmgr.available)
+	wmgr.available.close()
 	return nil
 }
 
@@ -246,6 +272,53 @@ func (wmgr *WantManager) Want(ref refs.BlobRef) error {
 	return wmgr.WantWithDist(ref, -1)
 }
 
+// WantFrom wants ref, which was referenced by the feed from.
+// With WantWithFeedDistance, the blobs of closer feeds are fetched first and the blobs of blocked feeds are not wanted at all.
+func (wmgr *WantManager) WantFrom(ref refs.BlobRef, from refs.FeedRef) error {
+	priority, blocked := wmgr.feedPriority(from)
+	if blocked {
+		level.Debug(wmgr.info).Log("event", "not wanting blob of blocked feed", "ref", ref.ShortSigil(), "from", from.ShortSigil())
+		return nil
+	}
+
+	if err := wmgr.Want(ref); err != nil {
+		return err
+	}
+
+	wmgr.l.Lock()
+	defer wmgr.l.Unlock()
+	if _, wanted := wmgr.wants[ref.Sigil()]; !wanted {
+		return nil
+	}
+	if p, has := wmgr.priorities[ref.Sigil()]; !has || priority < p {
+		wmgr.priorities[ref.Sigil()] = priority
+		wmgr.sources[ref.Sigil()] = from
+		wmgr.persist(ref.Sigil())
+	}
+	return nil
+}
+
+// feedPriority returns the fetch priority of the blobs referenced by from and if from is blocked, see WantWithFeedDistance.
+func (wmgr *WantManager) feedPriority(from refs.FeedRef) (int, bool) {
+	if wmgr.feedDist == nil {
+		return 0, false
+	}
+	dist, blocked := wmgr.feedDist(from)
+	if blocked {
+		return 0, true
+	}
+	if dist < 0 { // out of reach, after everything else
+		return math.MaxInt32, false
+	}
+	return dist, false
+}
+
+func (wmgr *WantManager) priority(ref refs.BlobRef) int {
+	wmgr.l.Lock()
+	defer wmgr.l.Unlock()
+	return wmgr.priorities[ref.Sigil()]
+}
+
 func (wmgr *WantManager) WantWithDist(ref refs.BlobRef, dist int64) error {
 	_, err := wmgr.bs.Size(ref)
 	if err == nil {
@@ -265,6 +338,7 @@ func (wmgr *WantManager) WantWithDist(ref refs.BlobRef, dist int64) error {
 	}
 
 	wmgr.wants[ref.Sigil()] = dist
+	wmgr.persist(ref.Sigil())
 	wmgr.promGaugeSet("nwants", len(wmgr.wants))
 
 	wmgr.wantsEmitter.EmitWant(ssb.BlobWant{Ref: ref, Dist: dist})
@@ -359,6 +433,11 @@ func (proc *wantProc) EmitBlob(notif ssb.BlobStoreNotification) error {
 	}
 
 	sz := notif.Size
+	if sz > 0 && uint(sz) > proc.wmgr.maxSize {
+		// we don't serve it
+		delete(proc.remoteWants, notif.Ref.Sigil())
+		return nil
+	}
 
 	m := map[string]int64{notif.Ref.Sigil(): sz}
 	err := proc.out.Encode(m)
@@ -425,6 +504,24 @@ func (proc *wantProc) Pour(ctx context.Context, v interface{}) error {
 	}
 	mOut := make(map[string]int64)
 
+	// the blobs the remote has for us, queued all at once so that the closest one is fetched first
+	var fetch []*hasBlob
+	defer func() {
+		proc.wmgr.available.push(fetch...)
+	}()
+
+	// look up all the blobs the remote wants at once
+	var asked []refs.BlobRef
+	for _, w := range mIn {
+		if w.Dist < 0 && w.Dist >= -4 {
+			asked = append(asked, w.Ref)
+		}
+	}
+	sizes, err := HasMany(proc.bs, asked)
+	if err != nil {
+		return fmt.Errorf("error getting blob sizes: %w", err)
+	}
+
 	for _, w := range mIn {
 		if _, blocked := proc.wmgr.blocked[w.Ref.Sigil()]; blocked {
 			continue
@@ -434,26 +531,25 @@ func (proc *wantProc) Pour(ctx context.Context, v interface{}) error {
 			if w.Dist < -4 {
 				continue // ignore, too far off
 			}
-			s, err := proc.bs.Size(w.Ref)
-			if err != nil {
-				if err == ErrNoSuchBlob {
-					proc.l.Lock()
-					proc.remoteWants[w.Ref.Sigil()] = w.Dist
-					proc.l.Unlock()
-
-					wErr := proc.wmgr.WantWithDist(w.Ref, w.Dist-1)
-					if wErr != nil {
-						return fmt.Errorf("forwarding want faild: %w", err)
-					}
-					continue
+			s, has := sizes[w.Ref.Sigil()]
+			if !has {
+				proc.l.Lock()
+				proc.remoteWants[w.Ref.Sigil()] = w.Dist
+				proc.l.Unlock()
+
+				wErr := proc.wmgr.WantWithDist(w.Ref, w.Dist-1)
+				if wErr != nil {
+					return fmt.Errorf("forwarding want faild: %w", wErr)
 				}
-
-				return fmt.Errorf("error getting blob size: %w", err)
+				continue
 			}
 
 			proc.l.Lock()
 			delete(proc.remoteWants, w.Ref.Sigil())
 			proc.l.Unlock()
+			if uint(s) > proc.wmgr.maxSize {
+				continue // we don't serve it
+			}
 			mOut[w.Ref.Sigil()] = s
 		} else {
 			if proc.wmgr.Wants(w.Ref) {
@@ -464,11 +560,12 @@ func (proc *wantProc) Pour(ctx context.Context, v interface{}) error {
 					continue
 				}
 
-				proc.wmgr.available <- &hasBlob{
-					connCtx: ctx,
-					want:    w,
-					remote:  proc.edp,
-				}
+				fetch = append(fetch, &hasBlob{
+					connCtx:  ctx,
+					want:     w,
+					remote:   proc.edp,
+					priority: proc.wmgr.priority(w.Ref),
+				})
 			}
 		}
 	}
@@ -478,7 +575,7 @@ func (proc *wantProc) Pour(ctx context.Context, v interface{}) error {
 		return nil
 	}
 
-	err := proc.out.Encode(mOut)
+	err = proc.out.Encode(mOut)
 	if err != nil {
 		return fmt.Errorf("error responding to wants: %w", err)
 	}
@@ -13,9 +13,13 @@ import (
 	"io/ioutil"
 	"net"
 	"os"
+	"path/filepath"
 	"strings"
+	"sync"
 	"testing"
+	"time"
 
+	"github.com/dgraph-io/badger/v3"
 	refs "github.com/ssbc/go-ssb-refs"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -226,3 +230,169 @@ func XTestWantManager(t *testing.T) {
 		t.Run(fmt.Sprint(i), mkTest(tc))
 	}
 }
+
+func TestWantFromPriority(t *testing.T) {
+	r := require.New(t)
+
+	dir, err := ioutil.TempDir("", t.Name())
+	r.NoError(err)
+	defer os.RemoveAll(dir)
+
+	bs, err := New(dir)
+	r.NoError(err)
+
+	feed := func(i byte) refs.FeedRef {
+		ref, err := refs.NewFeedRefFromBytes(bytes.Repeat([]byte{i}, 32), refs.RefAlgoFeedSSB1)
+		r.NoError(err)
+		return ref
+	}
+	var (
+		friend  = feed(1)
+		distant = feed(3)
+		blocked = feed(4)
+	)
+	dists := map[string]int{friend.Sigil(): 1, distant.Sigil(): 3}
+	wmgr := NewWantManager(bs,
+		WantWithLogger(testutils.NewRelativeTimeLogger(nil)),
+		WantWithFeedDistance(func(f refs.FeedRef) (int, bool) {
+			if f.Equal(blocked) {
+				return -1, true
+			}
+			return dists[f.Sigil()], false
+		}),
+	)
+	defer wmgr.Close()
+
+	blobRef := func(data string) refs.BlobRef {
+		h := sha256.Sum256([]byte(data))
+		ref, err := refs.NewBlobRefFromBytes(h[:], refs.RefAlgoBlobSSB1)
+		r.NoError(err)
+		return ref
+	}
+	var (
+		farBlob     = blobRef("from three hops")
+		nearBlob    = blobRef("from a friend")
+		blockedBlob = blobRef("from a blocked feed")
+	)
+
+	r.NoError(wmgr.WantFrom(farBlob, distant))
+	r.NoError(wmgr.WantFrom(nearBlob, friend))
+	r.NoError(wmgr.WantFrom(blockedBlob, blocked))
+	r.True(wmgr.Wants(farBlob))
+	r.True(wmgr.Wants(nearBlob))
+	r.False(wmgr.Wants(blockedBlob), "blobs of blocked feeds are not wanted")
+
+	// the order in which the blobs are requested, the fetches fail so that the test doesn't need to send the data
+	var (
+		mu        sync.Mutex
+		requested []string
+	)
+	edp := &muxrpc.FakeEndpoint{
+		SourceStub: func(ctx context.Context, enc muxrpc.RequestEncoding, method muxrpc.Method, args ...interface{}) (*muxrpc.ByteSource, error) {
+			ref := args[0].(GetWithSize).Key.Sigil()
+			mu.Lock()
+			defer mu.Unlock()
+			if len(requested) == 0 || requested[len(requested)-1] != ref { // a failed fetch is retried
+				requested = append(requested, ref)
+			}
+			return nil, ErrNoSuchBlob
+		},
+		RemoteStub: func() net.Addr {
+			return &net.TCPAddr{Port: 666}
+		},
+	}
+
+	ctx := context.Background()
+	proc := wmgr.CreateWants(ctx, muxrpc.NewTestSink(&bytes.Buffer{}), edp)
+
+	// the peer has both, the far one comes first
+	err = proc.Pour(ctx, WantMsg{
+		{Ref: farBlob, Dist: 15},
+		{Ref: nearBlob, Dist: 13},
+	})
+	r.NoError(err)
+
+	r.Eventually(func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(requested) == 2
+	}, time.Second, 10*time.Millisecond)
+	r.Equal([]string{nearBlob.Sigil(), farBlob.Sigil()}, requested, "the blob of the friend should be fetched first")
+}
+
+func TestWantsPersisted(t *testing.T) {
+	r := require.New(t)
+
+	dir, err := ioutil.TempDir("", t.Name())
+	r.NoError(err)
+	defer os.RemoveAll(dir)
+
+	bs, err := New(filepath.Join(dir, "blobs"))
+	r.NoError(err)
+
+	dbPath := filepath.Join(dir, "wants")
+	openDB := func() *badger.DB {
+		db, err := badger.Open(badger.DefaultOptions(dbPath).WithLogger(nil))
+		r.NoError(err)
+		return db
+	}
+
+	author, err := refs.NewFeedRefFromBytes(bytes.Repeat([]byte{1}, 32), refs.RefAlgoFeedSSB1)
+	r.NoError(err)
+	dists := func(refs.FeedRef) (int, bool) { return 2, false }
+
+	blobRef := func(data string) refs.BlobRef {
+		h := sha256.Sum256([]byte(data))
+		ref, err := refs.NewBlobRefFromBytes(h[:], refs.RefAlgoBlobSSB1)
+		r.NoError(err)
+		return ref
+	}
+	var (
+		plain    = blobRef("wanted directly")
+		fromFeed = blobRef("referenced by a feed")
+		gotIt    = blobRef("stored before the restart")
+		offline  = blobRef("stored while offline")
+	)
+
+	db := openDB()
+	wmgr := NewWantManager(bs, WantWithStore(db), WantWithFeedDistance(dists))
+	r.NoError(wmgr.WantWithDist(plain, -2))
+	r.NoError(wmgr.WantFrom(fromFeed, author))
+	r.NoError(wmgr.Want(gotIt))
+	r.NoError(wmgr.Want(offline))
+	r.Len(wmgr.AllWants(), 4)
+
+	_, err = bs.Put(strings.NewReader("stored before the restart"))
+	r.NoError(err)
+	r.Eventually(func() bool { return !wmgr.Wants(gotIt) }, time.Second, 10*time.Millisecond)
+
+	// "restart" the manager
+	r.NoError(wmgr.Close())
+	r.NoError(db.Close())
+
+	offlineBr, err := bs.Put(strings.NewReader("stored while offline"))
+	r.NoError(err)
+	r.True(offlineBr.Equal(offline))
+
+	db = openDB()
+	defer db.Close()
+	wmgr = NewWantManager(bs, WantWithStore(db), WantWithFeedDistance(dists))
+	defer wmgr.Close()
+
+	wants := make(map[string]int64)
+	for _, w := range wmgr.AllWants() {
+		wants[w.Ref.Sigil()] = w.Dist
+	}
+	r.Equal(map[string]int64{
+		plain.Sigil():    -2,
+		fromFeed.Sigil(): -1,
+	}, wants)
+	r.Equal(2, wmgr.priority(fromFeed), "the priority should be restored from the source feed")
+
+	// the dropped wants are removed from the store, too
+	stored, err := wmgr.store.all()
+	r.NoError(err)
+	r.Len(stored, 2)
+	r.NotNil(stored[fromFeed.Sigil()].From)
+	r.True(stored[fromFeed.Sigil()].From.Equal(author))
+}
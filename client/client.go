@@ -7,7 +7,6 @@ package client
 
 import (
 	"context"
-	"encoding/base64"
 	"errors"
 	"fmt"
 	"io"
@@ -61,7 +60,7 @@ func newClientWithOptions(opts []Option) (*Client, error) {
 
 	if c.appKeyBytes == nil {
 		var err error
-		c.appKeyBytes, err = base64.StdEncoding.DecodeString("1KHLiKZvAvjbY1ziZEHMXawbCEIM6qwjCDm3VYRan/s=")
+		c.appKeyBytes, err = ssb.DecodeAppKey(ssb.DefaultAppKey)
 		if err != nil {
 			return nil, fmt.Errorf("client: failed to decode default app key: %w", err)
 		}
@@ -6,10 +6,11 @@ package client
 
 import (
 	"context"
-	"encoding/base64"
 	"fmt"
 
 	"go.mindeco.de/log"
+
+	"github.com/ssbc/go-ssb"
 )
 
 type Option func(*Client) error
@@ -31,12 +32,9 @@ func WithLogger(l log.Logger) Option {
 func WithSHSAppKey(appKey string) Option {
 	return func(c *Client) error {
 		var err error
-		c.appKeyBytes, err = base64.StdEncoding.DecodeString(appKey)
+		c.appKeyBytes, err = ssb.DecodeAppKey(appKey)
 		if err != nil {
-			return fmt.Errorf("ssbClient: failed to decode secret-handshake appKey: %w", err)
-		}
-		if n := len(c.appKeyBytes); n != 32 {
-			return fmt.Errorf("ssbClient: invalid length for appKey: %d", n)
+			return fmt.Errorf("ssbClient: invalid secret-handshake appKey: %w", err)
 		}
 		return nil
 	}
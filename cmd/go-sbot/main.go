@@ -106,7 +106,7 @@ func initFlags() {
 	flag.UintVar(&flagHops, "hops", 1, "how many hops to fetch (1: friends, 2:friends of friends)")
 	flag.BoolVar(&flagPromisc, "promisc", false, "bypass graph auth and fetch remote's feed")
 
-	flag.StringVar(&appKey, "shscap", "1KHLiKZvAvjbY1ziZEHMXawbCEIM6qwjCDm3VYRan/s=", "secret-handshake app-key (or capability)")
+	flag.StringVar(&appKey, "shscap", ssb.DefaultAppKey, "secret-handshake app-key (or capability)")
 	flag.StringVar(&hmacSec, "hmac", "", "if set, sign with hmac hash of msg, instead of plain message object, using this key")
 
 	flag.StringVar(&listenAddr, "lis", ":8008", "address to listen on")
@@ -313,7 +313,7 @@ func runSbot() error {
 		//logging.SetupLogging(os.Stderr)
 	}
 
-	ak, err := base64.StdEncoding.DecodeString(appKey)
+	ak, err := ssb.DecodeAppKey(appKey)
 	if err != nil {
 		return fmt.Errorf("invalid application key/shs-cap: %w", err)
 	}
@@ -377,6 +377,10 @@ func runSbot() error {
 		opts = append(opts, mksbot.WithHMACSigning(hcbytes))
 	}
 
+	if pass := os.Getenv("SSB_SECRET_PASSPHRASE"); pass != "" {
+		opts = append(opts, mksbot.WithSecretPassphrase([]byte(pass)))
+	}
+
 	sbot, err := mksbot.New(opts...)
 	if err != nil {
 		return fmt.Errorf("failed to instantiate ssb server: %w", err)
@@ -80,7 +80,7 @@ Please note, global options must be placed before sub-commands, e.g.
 
 	Flags: []cli.Flag{
 		&configFileFlag,
-		&cli.StringFlag{Name: "shscap", Value: "1KHLiKZvAvjbY1ziZEHMXawbCEIM6qwjCDm3VYRan/s=", Usage: "SHS key"},
+		&cli.StringFlag{Name: "shscap", Value: ssb.DefaultAppKey, Usage: "SHS key"},
 		&cli.StringFlag{Name: "addr", Value: "localhost:8008", Usage: "TCP address of the sbot to connect to (or listen on)"},
 		&cli.StringFlag{Name: "remotekey", Aliases: []string{"remoteKey"}, Value: "", Usage: "The remote pubkey you are connecting to (by default the local key)"},
 		&keyFileFlag,
@@ -43,6 +43,7 @@ func getStreamArgs(ctx *cli.Context) message.CreateHistArgs {
 		ID:     ref,
 		Seq:    ctx.Int64("seq"),
 		AsJSON: ctx.Bool("asJSON"),
+		Type:   ctx.String("type"),
 	}
 	args.Limit = ctx.Int64("limit")
 	args.Gt = message.RoundedInteger(ctx.Int64("gt"))
@@ -58,7 +59,7 @@ func getStreamArgs(ctx *cli.Context) message.CreateHistArgs {
 var historyStreamCmd = &cli.Command{
 	Name:  "hist",
 	Usage: "Fetch all messages authored by the local keypair / author",
-	Flags: append(streamFlags, &cli.StringFlag{Name: "id"}, &cli.BoolFlag{Name: "asJSON"}),
+	Flags: append(streamFlags, &cli.StringFlag{Name: "id"}, &cli.BoolFlag{Name: "asJSON"}, &cli.StringFlag{Name: "type", Usage: "only messages with this content type"}),
 	Action: func(ctx *cli.Context) error {
 		client, err := newClient(ctx)
 		if err != nil {
@@ -0,0 +1,41 @@
+// SPDX-FileCopyrightText: 2021 The Go-SSB Authors
+//
+// SPDX-License-Identifier: MIT
+
+package ssb
+
+import (
+	"fmt"
+
+	refs "github.com/ssbc/go-ssb-refs"
+)
+
+// PublishFollow publishes a contact message on p which follows target, or unfollows it if following is false.
+// The graph picks it up once the contacts index processed the message.
+func PublishFollow(p Publisher, target refs.FeedRef, following bool) (refs.Message, error) {
+	c := refs.Contact{
+		Type:      "contact",
+		Contact:   target,
+		Following: following,
+	}
+	msg, err := p.Publish(c)
+	if err != nil {
+		return nil, fmt.Errorf("ssb: failed to publish follow of %s: %w", target.ShortSigil(), err)
+	}
+	return msg, nil
+}
+
+// PublishBlock publishes a contact message on p which blocks target, or unblocks it if blocking is false.
+// Blocking a feed also stops following it.
+func PublishBlock(p Publisher, target refs.FeedRef, blocking bool) (refs.Message, error) {
+	c := refs.Contact{
+		Type:     "contact",
+		Contact:  target,
+		Blocking: blocking,
+	}
+	msg, err := p.Publish(c)
+	if err != nil {
+		return nil, fmt.Errorf("ssb: failed to publish block of %s: %w", target.ShortSigil(), err)
+	}
+	return msg, nil
+}
@@ -0,0 +1,97 @@
+// SPDX-FileCopyrightText: 2021 The Go-SSB Authors
+//
+// SPDX-License-Identifier: MIT
+
+package ssb_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/ssbc/go-ssb"
+	refs "github.com/ssbc/go-ssb-refs"
+	"github.com/ssbc/go-ssb/graph"
+	"github.com/ssbc/go-ssb/internal/asynctesting"
+	"github.com/ssbc/go-ssb/internal/storedrefs"
+	"github.com/ssbc/go-ssb/internal/testutils"
+	"github.com/ssbc/go-ssb/message"
+	"github.com/ssbc/go-ssb/multilogs"
+	"github.com/ssbc/go-ssb/repo"
+)
+
+func TestPublishContact(t *testing.T) {
+	r := require.New(t)
+	ctx, cancel := context.WithCancel(context.TODO())
+	defer cancel()
+
+	rpath := filepath.Join("testrun", t.Name())
+	os.RemoveAll(rpath)
+	testRepo := repo.New(rpath)
+
+	rl, err := repo.OpenLog(testRepo)
+	r.NoError(err)
+
+	userFeeds, userFeedsSnk, err := repo.OpenStandaloneMultiLog(testRepo, "testUsers", multilogs.UserFeedsUpdate)
+	r.NoError(err)
+	defer userFeeds.Close()
+	usersErrc := asynctesting.ServeLog(ctx, "users", rl, userFeedsSnk, true)
+
+	db, err := repo.OpenBadgerDB(testRepo.GetPath(repo.PrefixIndex, "contacts", "db"))
+	r.NoError(err)
+	defer db.Close()
+	builder := graph.NewBuilder(testutils.NewRelativeTimeLogger(nil), db, nil)
+	_, contactsSnk := builder.OpenContactsIndex()
+	contactsErrc := asynctesting.ServeLog(ctx, "contacts", rl, contactsSnk, true)
+
+	kp, err := ssb.NewKeyPair(nil, refs.RefAlgoFeedSSB1)
+	r.NoError(err)
+	me := kp.ID()
+	publisher, err := message.OpenPublishLog(rl, userFeeds, kp)
+	r.NoError(err)
+	sublog, err := userFeeds.Get(storedrefs.Feed(me))
+	r.NoError(err)
+
+	target, err := ssb.NewKeyPair(nil, refs.RefAlgoFeedSSB1)
+	r.NoError(err)
+
+	// publishes with f and waits until the graph has the change
+	published := int64(-1)
+	check := func(f func() (refs.Message, error), holds func(*graph.Graph) bool) {
+		msg, err := f()
+		r.NoError(err)
+		published++
+		r.EqualValues(published+1, msg.Seq())
+
+		want := published
+		r.Eventually(func() bool {
+			return sublog.Seq() == want
+		}, time.Second, 10*time.Millisecond)
+		r.Eventually(func() bool {
+			fg, err := builder.Build()
+			r.NoError(err)
+			return holds(fg)
+		}, time.Second, 10*time.Millisecond)
+	}
+
+	check(func() (refs.Message, error) { return ssb.PublishFollow(publisher, target.ID(), true) },
+		func(fg *graph.Graph) bool { return fg.Follows(me, target.ID()) })
+
+	check(func() (refs.Message, error) { return ssb.PublishFollow(publisher, target.ID(), false) },
+		func(fg *graph.Graph) bool { return !fg.Follows(me, target.ID()) && !fg.Blocks(me, target.ID()) })
+
+	check(func() (refs.Message, error) { return ssb.PublishBlock(publisher, target.ID(), true) },
+		func(fg *graph.Graph) bool { return fg.Blocks(me, target.ID()) })
+
+	check(func() (refs.Message, error) { return ssb.PublishBlock(publisher, target.ID(), false) },
+		func(fg *graph.Graph) bool { return !fg.Blocks(me, target.ID()) })
+
+	r.NoError(rl.Close())
+	cancel()
+	r.NoError(<-usersErrc)
+	r.NoError(<-contactsErrc)
+}
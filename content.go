@@ -0,0 +1,138 @@
+// SPDX-FileCopyrightText: 2021 The Go-SSB Authors
+//
+// SPDX-License-Identifier: MIT
+
+package ssb
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	refs "github.com/ssbc/go-ssb-refs"
+)
+
+// ContentDecoder turns the JSON content of a message into a value.
+type ContentDecoder func([]byte) (interface{}, error)
+
+var contentDecoders = struct {
+	sync.RWMutex
+	byType map[string]ContentDecoder
+}{byType: make(map[string]ContentDecoder)}
+
+// RegisterContentType sets the decoder DecodeContent uses for content with the passed type.
+// Registering a type again replaces the previous decoder.
+func RegisterContentType(name string, dec ContentDecoder) {
+	contentDecoders.Lock()
+	defer contentDecoders.Unlock()
+	contentDecoders.byType[name] = dec
+}
+
+func getContentDecoder(name string) (ContentDecoder, bool) {
+	contentDecoders.RLock()
+	defer contentDecoders.RUnlock()
+	dec, has := contentDecoders.byType[name]
+	return dec, has
+}
+
+// MessageDecrypter decrypts the content of private messages, like private.Manager does.
+type MessageDecrypter interface {
+	DecryptMessage(refs.Message) ([]byte, error)
+}
+
+// ContentKind tells what kind of content DecodeContent found.
+type ContentKind uint
+
+const (
+	// ContentPublic is the plaintext content of a public message.
+	ContentPublic ContentKind = iota
+
+	// ContentPrivate is the decrypted content of a private message.
+	ContentPrivate
+
+	// ContentUnreadable is the content of a private message that isn't for us.
+	ContentUnreadable
+)
+
+func (ck ContentKind) String() string {
+	switch ck {
+	case ContentPublic:
+		return "public"
+	case ContentPrivate:
+		return "private"
+	case ContentUnreadable:
+		return "unreadable"
+	default:
+		return fmt.Sprintf("ContentKind(%d)", uint(ck))
+	}
+}
+
+// DecodedContent is the result of DecodeContent.
+type DecodedContent struct {
+	Kind ContentKind
+
+	// Type is the type field of the content. It is empty for unreadable content.
+	Type string
+
+	// Value is what the decoder registered for Type returned.
+	// If there is none, it is the content as json.RawMessage.
+	Value interface{}
+}
+
+// DecodeContent tries to decrypt the content of msg with dec and falls back to the plaintext content.
+// dec can be nil, then all private messages are unreadable.
+// Content with a registered type is passed through its ContentDecoder.
+func DecodeContent(msg refs.Message, dec MessageDecrypter) (DecodedContent, error) {
+	content := msg.ContentBytes()
+	kind := ContentPublic
+
+	if dec != nil {
+		if plain, err := dec.DecryptMessage(msg); err == nil {
+			content = plain
+			kind = ContentPrivate
+		}
+	}
+
+	// boxed content is a string in the classic format and not json at all in the others
+	if kind == ContentPublic && !bytes.HasPrefix(bytes.TrimSpace(content), []byte("{")) {
+		return DecodedContent{Kind: ContentUnreadable}, nil
+	}
+
+	var typed struct {
+		Type string `json:"type"`
+	}
+	if err := json.Unmarshal(content, &typed); err != nil {
+		return DecodedContent{}, fmt.Errorf("ssb: failed to decode %s content of %s: %w", kind, msg.Key().ShortSigil(), err)
+	}
+
+	decoded := DecodedContent{
+		Kind:  kind,
+		Type:  typed.Type,
+		Value: json.RawMessage(content),
+	}
+
+	if decodeFn, has := getContentDecoder(typed.Type); has {
+		v, err := decodeFn(content)
+		if err != nil {
+			return DecodedContent{}, fmt.Errorf("ssb: failed to decode %s content of %s: %w", typed.Type, msg.Key().ShortSigil(), err)
+		}
+		decoded.Value = v
+	}
+	return decoded, nil
+}
+
+// ContentType returns the type field of the public content of a message.
+// It returns false for private messages and content that isn't a JSON object, those don't have a readable type.
+func ContentType(content []byte) (string, bool) {
+	if !bytes.HasPrefix(bytes.TrimSpace(content), []byte("{")) {
+		return "", false
+	}
+	var typed struct {
+		Type string `json:"type"`
+	}
+	if err := json.Unmarshal(content, &typed); err != nil || typed.Type == "" {
+		return "", false
+	}
+	return typed.Type, true
+}
@@ -0,0 +1,88 @@
+// SPDX-FileCopyrightText: 2021 The Go-SSB Authors
+//
+// SPDX-License-Identifier: MIT
+
+package ssb
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	refs "github.com/ssbc/go-ssb-refs"
+	"github.com/stretchr/testify/require"
+)
+
+type testCodecVote struct {
+	Type  string `json:"type"`
+	Value int    `json:"value"`
+}
+
+func TestDecodeContent(t *testing.T) {
+	r := require.New(t)
+
+	RegisterContentType("test-codec-vote", func(content []byte) (interface{}, error) {
+		var v testCodecVote
+		err := json.Unmarshal(content, &v)
+		return v, err
+	})
+
+	vote := []byte(`{"type":"test-codec-vote","value":3}`)
+	post := []byte(`{"type":"post","text":"hello"}`)
+	boxed := []byte(`"c2VjcmV0.box"`)
+
+	// a registered type
+	dc, err := DecodeContent(&contentMsg{content: vote}, nil)
+	r.NoError(err)
+	r.Equal(ContentPublic, dc.Kind)
+	r.Equal("test-codec-vote", dc.Type)
+	r.Equal(testCodecVote{Type: "test-codec-vote", Value: 3}, dc.Value)
+
+	// without a decoder, the raw content is returned
+	dc, err = DecodeContent(&contentMsg{content: post}, nil)
+	r.NoError(err)
+	r.Equal(ContentPublic, dc.Kind)
+	r.Equal("post", dc.Type)
+	r.Equal(json.RawMessage(post), dc.Value)
+
+	// private, but not for us
+	dc, err = DecodeContent(&contentMsg{content: boxed}, contentDecrypter{})
+	r.NoError(err)
+	r.Equal(ContentUnreadable, dc.Kind)
+	r.Equal("", dc.Type)
+	r.Nil(dc.Value)
+
+	dc, err = DecodeContent(&contentMsg{content: boxed}, nil)
+	r.NoError(err)
+	r.Equal(ContentUnreadable, dc.Kind)
+
+	// private and for us
+	dc, err = DecodeContent(&contentMsg{content: boxed}, contentDecrypter{plain: vote})
+	r.NoError(err)
+	r.Equal(ContentPrivate, dc.Kind)
+	r.Equal(testCodecVote{Type: "test-codec-vote", Value: 3}, dc.Value)
+
+	_, err = DecodeContent(&contentMsg{content: []byte(`{"type":`)}, nil)
+	r.Error(err, "expected an error for broken content")
+}
+
+type contentMsg struct {
+	refs.Message
+
+	content []byte
+}
+
+func (msg *contentMsg) Key() refs.MessageRef { return refs.MessageRef{} }
+func (msg *contentMsg) ContentBytes() []byte { return msg.content }
+
+// contentDecrypter returns plain for all messages, or fails if it is nil
+type contentDecrypter struct {
+	plain []byte
+}
+
+func (cd contentDecrypter) DecryptMessage(refs.Message) ([]byte, error) {
+	if cd.plain == nil {
+		return nil, errors.New("not for us")
+	}
+	return cd.plain, nil
+}
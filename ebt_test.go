@@ -0,0 +1,55 @@
+// SPDX-FileCopyrightText: 2021 The Go-SSB Authors
+//
+// SPDX-License-Identifier: MIT
+
+package ssb
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	refs "github.com/ssbc/go-ssb-refs"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNetworkFrontierJSNotes(t *testing.T) {
+	r := require.New(t)
+
+	feed := func(i byte, algo refs.RefAlgo) string {
+		ref, err := refs.NewFeedRefFromBytes(bytes.Repeat([]byte{i}, 32), algo)
+		r.NoError(err)
+		return ref.String()
+	}
+	var (
+		eager   = feed(1, refs.RefAlgoFeedSSB1)
+		lazy    = feed(2, refs.RefAlgoFeedSSB1)
+		ignored = feed(3, refs.RefAlgoFeedSSB1)
+		empty   = feed(4, refs.RefAlgoFeedSSB1)
+		gabby   = feed(5, refs.RefAlgoFeedGabby)
+	)
+
+	// as sent by the JS ebt module: seq<<1 with the lowest bit set if the peer doesn't want to receive the messages, -1 to stop replicating
+	jsNotes := fmt.Sprintf(`{%q: 10, %q: 11, %q: -1, %q: 0, %q: 4, "not-a-feed": 2}`,
+		eager, lazy, ignored, empty, gabby)
+
+	var nf NetworkFrontier
+	r.NoError(json.Unmarshal([]byte(jsNotes), &nf))
+	r.Len(nf, 4, "invalid and unsupported feeds are skipped")
+
+	r.Equal(Note{Seq: 5, Replicate: true, Receive: true}, nf[eager])
+	r.Equal(Note{Seq: 5, Replicate: true, Receive: false}, nf[lazy])
+	r.False(nf[ignored].Replicate)
+	r.Equal(Note{Seq: 0, Replicate: true, Receive: true}, nf[empty])
+
+	// and back to the same encoding
+	encoded, err := json.Marshal(nf)
+	r.NoError(err)
+	r.JSONEq(fmt.Sprintf(`{%q: 10, %q: 11, %q: -1, %q: 0}`, eager, lazy, ignored, empty), string(encoded))
+
+	// margaret's empty sequence is sent as zero
+	encoded, err = json.Marshal(Note{Seq: -1, Replicate: true, Receive: true})
+	r.NoError(err)
+	r.Equal("0", string(encoded))
+}
@@ -14,13 +14,41 @@ import (
 
 var ErrShuttingDown = fmt.Errorf("ssb: shutting down now") // this is fine
 
+// ErrBlocked is wrapped by ErrOutOfReach if the peer is blocked directly. Check for it with errors.Is.
+var ErrBlocked = errors.New("ssb/graph: peer is blocked")
+
+// ErrOutOfReach is returned by an Authorizer for peers which are further away than it allows.
 type ErrOutOfReach struct {
+	// Dist is the number of hops on the shortest path to the peer, 0 for direct follows.
+	// It is negative if there is no such path.
 	Dist int
 	Max  int
+
+	// Via is the last feed on the shortest path to the peer which is still within Max hops.
+	// It is nil if there is no path or it doesn't go through other feeds.
+	Via *refs.FeedRef
+
+	// Blocked is set if the peer is blocked directly by the feed the distance was measured from.
+	Blocked bool
 }
 
 func (e ErrOutOfReach) Error() string {
-	return fmt.Sprintf("ssb/graph: peer not in reach. d:%d, max:%d", e.Dist, e.Max)
+	msg := fmt.Sprintf("ssb/graph: peer not in reach. d:%d, max:%d", e.Dist, e.Max)
+	if e.Via != nil {
+		msg += ", via:" + e.Via.ShortSigil()
+	}
+	if e.Blocked {
+		msg += ", blocked"
+	}
+	return msg
+}
+
+// Unwrap returns ErrBlocked if the peer is blocked directly.
+func (e ErrOutOfReach) Unwrap() error {
+	if e.Blocked {
+		return ErrBlocked
+	}
+	return nil
 }
 
 func IsMessageUnusable(err error) bool {
@@ -62,6 +90,9 @@ func (ewt ErrWrongType) Error() string {
 
 var ErrUnuspportedFormat = fmt.Errorf("ssb: unsupported format")
 
+// ErrMsgNotFound is returned if there is no message with the requested key
+var ErrMsgNotFound = errors.New("ssb: message not found")
+
 // ErrWrongSequence is returned if there is a glitch on the current
 // sequence number on the feed between in the offsetlog and the logical entry on the feed
 type ErrWrongSequence struct {
@@ -75,3 +106,14 @@ func (e ErrWrongSequence) Error() string {
 		e.Stored,
 		e.Logical)
 }
+
+// ErrSequenceGap is returned by the verification sinks if a message is too far ahead of the latest stored message of its feed
+// to be held back until the messages in between arrive.
+type ErrSequenceGap struct {
+	Ref         refs.FeedRef
+	Latest, Got int64
+}
+
+func (e ErrSequenceGap) Error() string {
+	return fmt.Sprintf("ssb: sequence gap on feed %s: latest is %d, got %d", e.Ref.String(), e.Latest, e.Got)
+}
@@ -0,0 +1,181 @@
+// SPDX-FileCopyrightText: 2021 The Go-SSB Authors
+//
+// SPDX-License-Identifier: MIT
+
+package ssb
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/ssbc/go-luigi"
+	"github.com/ssbc/go-luigi/mfr"
+	refs "github.com/ssbc/go-ssb-refs"
+	"github.com/ssbc/margaret"
+	"github.com/ssbc/margaret/multilog"
+
+	"github.com/ssbc/go-ssb/internal/mutil"
+	"github.com/ssbc/go-ssb/internal/storedrefs"
+)
+
+// FeedQuery builds a query over the messages of a single feed, like createHistoryStream does.
+// The zero value is not usable, use NewFeedQuery.
+//
+//	src, err := ssb.NewFeedQuery().Feed(ref).Gte(10).Limit(5).Keys(false).Query(rxLog, userFeeds)
+type FeedQuery struct {
+	feed    *refs.FeedRef
+	origin  int64
+	seq     int64
+	lt, gt  int64
+	limit   int
+	live    bool
+	keys    bool
+	reverse bool
+	tipe    string
+}
+
+// NewFeedQuery returns a query without a limit which returns whole messages.
+func NewFeedQuery() *FeedQuery {
+	return &FeedQuery{
+		origin: 1,
+		limit:  -1,
+		keys:   true,
+	}
+}
+
+// Feed sets the feed to query. It is required.
+func (q *FeedQuery) Feed(ref refs.FeedRef) *FeedQuery {
+	q.feed = &ref
+	return q
+}
+
+// Origin sets the sequence of the first stored message of the feed, for feeds which don't start at 1 like sliced ones.
+// The default is 1. See message.FeedOrigin.
+func (q *FeedQuery) Origin(seq int64) *FeedQuery {
+	q.origin = seq
+	return q
+}
+
+// Gte only returns messages with a sequence greater or equal to seq.
+// Like in createHistoryStream the sequences of a feed start at 1.
+func (q *FeedQuery) Gte(seq int64) *FeedQuery {
+	q.seq = seq
+	return q
+}
+
+// Lt only returns messages with a sequence lower than seq.
+func (q *FeedQuery) Lt(seq int64) *FeedQuery {
+	q.lt = seq
+	return q
+}
+
+// Gt only returns messages with a sequence greater than seq.
+func (q *FeedQuery) Gt(seq int64) *FeedQuery {
+	q.gt = seq
+	return q
+}
+
+// Limit returns at most n messages. A negative n means no limit.
+func (q *FeedQuery) Limit(n int) *FeedQuery {
+	q.limit = n
+	return q
+}
+
+// Live keeps the source open and returns new messages as they are added to the feed.
+func (q *FeedQuery) Live() *FeedQuery {
+	q.live = true
+	return q
+}
+
+// Keys decides if the source returns the refs.Message values (the default)
+// or only the signed values of the messages as json.RawMessage.
+func (q *FeedQuery) Keys(keys bool) *FeedQuery {
+	q.keys = keys
+	return q
+}
+
+// Reverse returns the newest messages first.
+func (q *FeedQuery) Reverse() *FeedQuery {
+	q.reverse = true
+	return q
+}
+
+// Type only returns messages with public content of type t, see ContentType.
+// Private messages and content that can't be decoded are skipped.
+// Gte and Limit still count all the messages of the feed, like in createHistoryStream.
+func (q *FeedQuery) Type(t string) *FeedQuery {
+	q.tipe = t
+	return q
+}
+
+// Specs returns the query specs for the sublog of the feed in the user feeds multilog.
+func (q *FeedQuery) Specs() []margaret.QuerySpec {
+	specs := []margaret.QuerySpec{
+		margaret.Limit(q.limit),
+		margaret.Live(q.live),
+		margaret.Reverse(q.reverse),
+	}
+
+	// sublogs are 0 indexed and start at the origin of the feed
+	if idx := q.seq - q.origin; idx > 0 {
+		specs = append(specs, margaret.Gte(idx))
+	}
+	if q.lt > 0 {
+		specs = append(specs, margaret.Lt(q.lt-q.origin))
+	}
+	if q.gt >= q.origin {
+		specs = append(specs, margaret.Gt(q.gt-q.origin))
+	}
+	return specs
+}
+
+// Query returns a source with the selected messages of the feed.
+// userFeeds needs to be the multilog of sequences in rxLog by author (see storedrefs.Feed).
+// Nulled messages and the ones that don't match Type are skipped.
+func (q *FeedQuery) Query(rxLog margaret.Log, userFeeds multilog.MultiLog) (luigi.Source, error) {
+	if q.feed == nil {
+		return nil, errors.New("feed query: no feed set")
+	}
+
+	userLog, err := userFeeds.Get(storedrefs.Feed(*q.feed))
+	if err != nil {
+		return nil, fmt.Errorf("feed query: failed to open sublog for user: %w", err)
+	}
+
+	src, err := mutil.Indirect(rxLog, userLog).Query(q.Specs()...)
+	if err != nil {
+		return nil, fmt.Errorf("feed query: invalid user log query: %w", err)
+	}
+
+	src = mfr.SourceFilter(src, func(ctx context.Context, v interface{}) (bool, error) {
+		if err, ok := v.(error); ok {
+			if margaret.IsErrNulled(err) {
+				return false, nil
+			}
+			return false, err
+		}
+		if q.tipe == "" {
+			return true, nil
+		}
+		msg, ok := v.(refs.Message)
+		if !ok {
+			return false, fmt.Errorf("feed query: unexpected value in feed: %T", v)
+		}
+		t, ok := ContentType(msg.ContentBytes())
+		return ok && t == q.tipe, nil
+	})
+
+	if q.keys {
+		return src, nil
+	}
+
+	return mfr.SourceMap(src, func(ctx context.Context, v interface{}) (interface{}, error) {
+		msg, ok := v.(refs.Message)
+		if !ok {
+			return nil, fmt.Errorf("feed query: unexpected value in feed: %T", v)
+		}
+		return json.RawMessage(msg.ValueContentJSON()), nil
+	}), nil
+}
@@ -0,0 +1,264 @@
+// SPDX-FileCopyrightText: 2021 The Go-SSB Authors
+//
+// SPDX-License-Identifier: MIT
+
+package ssb
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/ssbc/go-luigi"
+	refs "github.com/ssbc/go-ssb-refs"
+	"github.com/ssbc/margaret"
+	"github.com/ssbc/margaret/indexes"
+	"github.com/ssbc/margaret/mem"
+	"github.com/ssbc/margaret/multilog"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ssbc/go-ssb/internal/storedrefs"
+)
+
+func TestFeedQuery(t *testing.T) {
+	r := require.New(t)
+
+	fq := newFeedQueryFixture(t, 5)
+
+	type tcase struct {
+		name string
+		qry  *FeedQuery
+		want []int64
+	}
+	cases := []tcase{
+		{"all", NewFeedQuery().Feed(fq.author), []int64{1, 2, 3, 4, 5}},
+		{"gte", NewFeedQuery().Feed(fq.author).Gte(3), []int64{3, 4, 5}},
+		{"gte first", NewFeedQuery().Feed(fq.author).Gte(1), []int64{1, 2, 3, 4, 5}},
+		{"limit", NewFeedQuery().Feed(fq.author).Limit(2), []int64{1, 2}},
+		{"gte and limit", NewFeedQuery().Feed(fq.author).Gte(2).Limit(2), []int64{2, 3}},
+		{"past the end", NewFeedQuery().Feed(fq.author).Gte(6), nil},
+		{"lt", NewFeedQuery().Feed(fq.author).Lt(3), []int64{1, 2}},
+		{"gt", NewFeedQuery().Feed(fq.author).Gt(3), []int64{4, 5}},
+		{"between", NewFeedQuery().Feed(fq.author).Gt(1).Lt(5), []int64{2, 3, 4}},
+		{"other feed", NewFeedQuery().Feed(testFeedRef(t, 2)), nil},
+	}
+
+	for _, tc := range cases {
+		src, err := tc.qry.Query(fq.rootLog, fq.userFeeds)
+		r.NoError(err, tc.name)
+
+		var got []int64
+		for _, v := range drainFeedQuery(t, src) {
+			msg, ok := v.(refs.Message)
+			r.True(ok, "%s: wrong type %T", tc.name, v)
+			got = append(got, msg.Seq())
+		}
+		r.Equal(tc.want, got, tc.name)
+	}
+
+	_, err := NewFeedQuery().Query(fq.rootLog, fq.userFeeds)
+	r.Error(err, "expected an error without a feed")
+}
+
+func TestFeedQuerySliced(t *testing.T) {
+	r := require.New(t)
+
+	// the feed starts at 11
+	fq := newFeedQueryFixture(t, 0)
+	for seq := int64(11); seq <= 15; seq++ {
+		fq.append(t, seq)
+	}
+
+	cases := []struct {
+		name string
+		qry  *FeedQuery
+		want []int64
+	}{
+		{"all", NewFeedQuery().Feed(fq.author).Origin(11), []int64{11, 12, 13, 14, 15}},
+		{"gte", NewFeedQuery().Feed(fq.author).Origin(11).Gte(13), []int64{13, 14, 15}},
+		{"gte before the origin", NewFeedQuery().Feed(fq.author).Origin(11).Gte(2), []int64{11, 12, 13, 14, 15}},
+		{"lt", NewFeedQuery().Feed(fq.author).Origin(11).Lt(13), []int64{11, 12}},
+		{"gt and limit", NewFeedQuery().Feed(fq.author).Origin(11).Gt(11).Limit(2), []int64{12, 13}},
+		{"gt before the origin", NewFeedQuery().Feed(fq.author).Origin(11).Gt(3).Limit(2), []int64{11, 12}},
+		{"lt the origin", NewFeedQuery().Feed(fq.author).Origin(11).Lt(11), nil},
+	}
+	for _, tc := range cases {
+		src, err := tc.qry.Query(fq.rootLog, fq.userFeeds)
+		r.NoError(err, tc.name)
+
+		var got []int64
+		for _, v := range drainFeedQuery(t, src) {
+			got = append(got, v.(refs.Message).Seq())
+		}
+		r.Equal(tc.want, got, tc.name)
+	}
+}
+
+func TestFeedQueryNoKeys(t *testing.T) {
+	r := require.New(t)
+
+	fq := newFeedQueryFixture(t, 3)
+
+	src, err := NewFeedQuery().Feed(fq.author).Gte(2).Keys(false).Query(fq.rootLog, fq.userFeeds)
+	r.NoError(err)
+
+	vals := drainFeedQuery(t, src)
+	r.Len(vals, 2)
+	for i, v := range vals {
+		raw, ok := v.(json.RawMessage)
+		r.True(ok, "wrong type %T", v)
+		r.Equal(fmt.Sprintf(`{"sequence":%d}`, i+2), string(raw))
+	}
+}
+
+func TestFeedQueryLive(t *testing.T) {
+	r := require.New(t)
+
+	fq := newFeedQueryFixture(t, 2)
+
+	src, err := NewFeedQuery().Feed(fq.author).Gte(3).Live().Query(fq.rootLog, fq.userFeeds)
+	r.NoError(err)
+
+	fq.append(t, 3)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	v, err := src.Next(ctx)
+	r.NoError(err)
+	msg, ok := v.(refs.Message)
+	r.True(ok, "wrong type %T", v)
+	r.EqualValues(3, msg.Seq())
+}
+
+func TestFeedQueryType(t *testing.T) {
+	r := require.New(t)
+
+	fq := newFeedQueryFixture(t, 0)
+	for i, content := range []string{
+		`{"type":"post","text":"one"}`,
+		`{"type":"contact"}`,
+		`{"type":"post","text":"two"}`,
+		`"c2VjcmV0.box"`,
+		`{"type":`,
+		`{"text":"no type"}`,
+		`{"type":"post","text":"three"}`,
+	} {
+		fq.appendContent(t, int64(i+1), content)
+	}
+
+	cases := []struct {
+		name string
+		qry  *FeedQuery
+		want []int64
+	}{
+		{"posts", NewFeedQuery().Feed(fq.author).Type("post"), []int64{1, 3, 7}},
+		{"contacts", NewFeedQuery().Feed(fq.author).Type("contact"), []int64{2}},
+		{"gte", NewFeedQuery().Feed(fq.author).Type("post").Gte(2), []int64{3, 7}},
+		{"limit counts the feed", NewFeedQuery().Feed(fq.author).Type("post").Limit(3), []int64{1, 3}},
+		{"unknown", NewFeedQuery().Feed(fq.author).Type("vote"), nil},
+		{"no filter", NewFeedQuery().Feed(fq.author), []int64{1, 2, 3, 4, 5, 6, 7}},
+	}
+	for _, tc := range cases {
+		src, err := tc.qry.Query(fq.rootLog, fq.userFeeds)
+		r.NoError(err, tc.name)
+
+		var got []int64
+		for _, v := range drainFeedQuery(t, src) {
+			got = append(got, v.(refs.Message).Seq())
+		}
+		r.Equal(tc.want, got, tc.name)
+	}
+}
+
+// feedQueryFixture holds one feed in a root log
+type feedQueryFixture struct {
+	author    refs.FeedRef
+	rootLog   margaret.Log
+	userFeeds feedQueryUserFeeds
+}
+
+func newFeedQueryFixture(t *testing.T, n int64) *feedQueryFixture {
+	author := testFeedRef(t, 1)
+	fq := &feedQueryFixture{
+		author:  author,
+		rootLog: mem.New(),
+		userFeeds: feedQueryUserFeeds{
+			author: author,
+			feed:   mem.New(),
+		},
+	}
+
+	// another feed in the root log, to make sure the sequences are translated
+	_, err := fq.rootLog.Append(&feedQueryMsg{seq: 1})
+	require.NoError(t, err)
+
+	for seq := int64(1); seq <= n; seq++ {
+		fq.append(t, seq)
+	}
+	return fq
+}
+
+func (fq *feedQueryFixture) append(t *testing.T, seq int64) {
+	fq.appendContent(t, seq, `{"type":"test"}`)
+}
+
+func (fq *feedQueryFixture) appendContent(t *testing.T, seq int64, content string) {
+	rxSeq, err := fq.rootLog.Append(&feedQueryMsg{seq: seq, content: content})
+	require.NoError(t, err)
+
+	_, err = fq.userFeeds.feed.Append(rxSeq)
+	require.NoError(t, err)
+}
+
+// feedQueryUserFeeds is a multilog that only knows the sublog of one author
+type feedQueryUserFeeds struct {
+	multilog.MultiLog
+
+	author refs.FeedRef
+	feed   margaret.Log
+}
+
+func (uf feedQueryUserFeeds) Get(addr indexes.Addr) (margaret.Log, error) {
+	if addr != storedrefs.Feed(uf.author) {
+		return mem.New(), nil
+	}
+	return uf.feed, nil
+}
+
+// feedQueryMsg only has the parts of a message that FeedQuery looks at
+type feedQueryMsg struct {
+	refs.Message
+
+	seq     int64
+	content string
+}
+
+func (msg *feedQueryMsg) Seq() int64 { return msg.seq }
+
+func (msg *feedQueryMsg) ContentBytes() []byte { return []byte(msg.content) }
+
+func (msg *feedQueryMsg) ValueContentJSON() json.RawMessage {
+	return json.RawMessage(fmt.Sprintf(`{"sequence":%d}`, msg.seq))
+}
+
+func drainFeedQuery(t *testing.T, src luigi.Source) []interface{} {
+	var vals []interface{}
+	for {
+		v, err := src.Next(context.TODO())
+		if luigi.IsEOS(err) {
+			return vals
+		}
+		require.NoError(t, err)
+		vals = append(vals, v)
+	}
+}
+
+func testFeedRef(t *testing.T, i byte) refs.FeedRef {
+	ref, err := refs.NewFeedRefFromBytes(bytes.Repeat([]byte{i}, 32), refs.RefAlgoFeedSSB1)
+	require.NoError(t, err)
+	return ref
+}
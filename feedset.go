@@ -6,6 +6,7 @@ package ssb
 
 import (
 	"fmt"
+	"sort"
 	"sync"
 
 	librarian "github.com/ssbc/margaret/indexes"
@@ -79,3 +80,69 @@ func (fs StrFeedSet) Has(ref refs.FeedRef) bool {
 	_, has := fs.set[storedrefs.Feed(ref)]
 	return has
 }
+
+// Union returns a new set with the feeds which are in fs, other or both.
+func (fs *StrFeedSet) Union(other *StrFeedSet) *StrFeedSet {
+	ours, theirs := fs.snapshot(), other.snapshot()
+	u := NewFeedSet(len(ours) + len(theirs))
+	for feed := range ours {
+		u.set[feed] = struct{}{}
+	}
+	for feed := range theirs {
+		u.set[feed] = struct{}{}
+	}
+	return u
+}
+
+// Intersect returns a new set with the feeds which are in both fs and other.
+func (fs *StrFeedSet) Intersect(other *StrFeedSet) *StrFeedSet {
+	ours, theirs := fs.snapshot(), other.snapshot()
+	i := NewFeedSet(0)
+	for feed := range ours {
+		if _, has := theirs[feed]; has {
+			i.set[feed] = struct{}{}
+		}
+	}
+	return i
+}
+
+// Difference returns a new set with the feeds of fs which are not in other.
+func (fs *StrFeedSet) Difference(other *StrFeedSet) *StrFeedSet {
+	ours, theirs := fs.snapshot(), other.snapshot()
+	d := NewFeedSet(0)
+	for feed := range ours {
+		if _, has := theirs[feed]; !has {
+			d.set[feed] = struct{}{}
+		}
+	}
+	return d
+}
+
+// Range calls fn for each feed in the set, sorted by their reference, until it returns false.
+// The set can be changed from fn, Range goes over the feeds it had when it was called.
+func (fs *StrFeedSet) Range(fn func(refs.FeedRef) bool) error {
+	lst, err := fs.List()
+	if err != nil {
+		return err
+	}
+	sort.Slice(lst, func(i, j int) bool {
+		return lst[i].String() < lst[j].String()
+	})
+	for _, feed := range lst {
+		if !fn(feed) {
+			break
+		}
+	}
+	return nil
+}
+
+// snapshot copies the map, so that two sets can be compared without holding both locks
+func (fs *StrFeedSet) snapshot() strFeedMap {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	cp := make(strFeedMap, len(fs.set))
+	for feed := range fs.set {
+		cp[feed] = struct{}{}
+	}
+	return cp
+}
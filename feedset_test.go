@@ -5,6 +5,7 @@
 package ssb
 
 import (
+	"sort"
 	"testing"
 
 	refs "github.com/ssbc/go-ssb-refs"
@@ -56,3 +57,85 @@ func TestFeedSetCount(t *testing.T) {
 	r.NoError(err)
 	r.Len(lst, 50, "some len(List()) wrong")
 }
+
+func TestFeedSetAlgebra(t *testing.T) {
+	r := require.New(t)
+
+	var feeds []refs.FeedRef
+	for i := 0; i < 5; i++ {
+		kp, err := NewKeyPair(nil, refs.RefAlgoFeedSSB1)
+		r.NoError(err)
+		feeds = append(feeds, kp.ID())
+	}
+	setOf := func(idx ...int) *StrFeedSet {
+		fs := NewFeedSet(len(idx))
+		for _, i := range idx {
+			r.NoError(fs.AddRef(feeds[i]))
+		}
+		return fs
+	}
+	equal := func(want, got *StrFeedSet) {
+		r.Equal(want.Count(), got.Count())
+		wantLst, err := want.List()
+		r.NoError(err)
+		for _, f := range wantLst {
+			r.True(got.Has(f), "missing %s", f.ShortSigil())
+		}
+	}
+
+	a, b := setOf(0, 1, 2), setOf(2, 3)
+
+	equal(setOf(0, 1, 2, 3), a.Union(b))
+	equal(setOf(2), a.Intersect(b))
+	equal(setOf(0, 1), a.Difference(b))
+	equal(setOf(3), b.Difference(a))
+	equal(setOf(), a.Intersect(setOf(4)))
+	equal(setOf(), a.Difference(a))
+	equal(a, a.Union(a))
+
+	// the operands are unchanged and the results are independent of them
+	equal(setOf(0, 1, 2), a)
+	equal(setOf(2, 3), b)
+	u := a.Union(b)
+	r.NoError(u.Delete(feeds[0]))
+	r.True(a.Has(feeds[0]))
+}
+
+func TestFeedSetRange(t *testing.T) {
+	r := require.New(t)
+
+	fs := NewFeedSet(20)
+	for i := 0; i < 20; i++ {
+		kp, err := NewKeyPair(nil, refs.RefAlgoFeedSSB1)
+		r.NoError(err)
+		r.NoError(fs.AddRef(kp.ID()))
+	}
+
+	collect := func() []string {
+		var got []string
+		err := fs.Range(func(f refs.FeedRef) bool {
+			got = append(got, f.String())
+			return true
+		})
+		r.NoError(err)
+		return got
+	}
+
+	first := collect()
+	r.Len(first, 20)
+	r.True(sort.StringsAreSorted(first))
+	for i := 0; i < 5; i++ {
+		r.Equal(first, collect(), "iteration order changed")
+	}
+
+	// stop early and change the set while ranging over it
+	var n int
+	err := fs.Range(func(f refs.FeedRef) bool {
+		r.NoError(fs.Delete(f))
+		n++
+		return n < 3
+	})
+	r.NoError(err)
+	r.Equal(3, n)
+	r.Equal(17, fs.Count())
+}
@@ -5,13 +5,17 @@
 package graph
 
 import (
+	"errors"
 	"fmt"
 	"math"
+	"sync"
+	"time"
 
 	"github.com/ssbc/go-ssb"
 	refs "github.com/ssbc/go-ssb-refs"
 	"go.mindeco.de/log"
 	"go.mindeco.de/log/level"
+	"gonum.org/v1/gonum/graph"
 )
 
 type authorizer struct {
@@ -19,8 +23,25 @@ type authorizer struct {
 	from    refs.FeedRef
 	maxHops int
 	log     log.Logger
+
+	// how long decisions of Authorize are reused, see WithAuthCache
+	cacheTTL         time.Duration
+	negativeCacheTTL time.Duration
+
+	cacheMu sync.Mutex
+	cache   map[string]authDecision
+}
+
+// authDecision is a cached result of Authorize, valid for the graph version it was made with until it expires
+type authDecision struct {
+	err     error
+	version int64
+	expires time.Time
 }
 
+// authCacheSweep is the number of cached decisions from which on expired ones are dropped when a new one is added
+const authCacheSweep = 512
+
 // ErrNoSuchFrom should only happen if you reconstruct your existing log from the network
 type ErrNoSuchFrom struct {
 	Who refs.FeedRef
@@ -30,7 +51,67 @@ func (nsf ErrNoSuchFrom) Error() string {
 	return fmt.Sprintf("ssb/graph: no such from: %s", nsf.Who.String())
 }
 
+// BulkAuthorizer can check many feeds at once, using the same graph and distance lookup for all of them.
+type BulkAuthorizer interface {
+	ssb.Authorizer
+
+	// AuthorizeMany returns the result of Authorize for each feed in to, in the same order.
+	// The error is only set if the graph or the distance lookup couldn't be constructed.
+	AuthorizeMany(to []refs.FeedRef) ([]error, error)
+}
+
+var _ BulkAuthorizer = (*authorizer)(nil)
+
+// Authorize checks if to is within the distance of the authorizer.
+// If caching is enabled, a decision is reused until it expires or the graph changes.
 func (a *authorizer) Authorize(to refs.FeedRef) error {
+	if a.cacheTTL <= 0 && a.negativeCacheTTL <= 0 {
+		return a.authorize(to)
+	}
+
+	// taken before the decision, so that a change while deciding makes the next call decide again
+	version := a.b.CurrentVersion()
+	key := to.String()
+	now := time.Now()
+
+	a.cacheMu.Lock()
+	d, has := a.cache[key]
+	a.cacheMu.Unlock()
+	if has && d.version == version && now.Before(d.expires) {
+		return d.err
+	}
+
+	err := a.authorize(to)
+
+	ttl := a.cacheTTL
+	if err != nil {
+		var oor *ssb.ErrOutOfReach
+		if !errors.As(err, &oor) { // not a decision, like a failure to build the graph
+			return err
+		}
+		ttl = a.negativeCacheTTL
+	}
+	if ttl <= 0 {
+		return err
+	}
+
+	a.cacheMu.Lock()
+	defer a.cacheMu.Unlock()
+	if a.cache == nil {
+		a.cache = make(map[string]authDecision)
+	}
+	if len(a.cache) >= authCacheSweep {
+		for k, d := range a.cache {
+			if !now.Before(d.expires) || d.version != version {
+				delete(a.cache, k)
+			}
+		}
+	}
+	a.cache[key] = authDecision{err: err, version: version, expires: now.Add(ttl)}
+	return err
+}
+
+func (a *authorizer) authorize(to refs.FeedRef) error {
 	fg, err := a.b.Build()
 	if err != nil {
 		return fmt.Errorf("graph/Authorize: failed to make friendgraph: %w", err)
@@ -54,17 +135,74 @@ func (a *authorizer) Authorize(to refs.FeedRef) error {
 		return fmt.Errorf("graph/Authorize: failed to construct dijkstra: %w", err)
 	}
 
-	// dist includes start and end of the path so Alice to Bob will be
-	// p:=[Alice, some, friends, Bob]
-	// len(p) == 4
+	return a.checkDist(fg, distLookup, to)
+}
+
+func (a *authorizer) AuthorizeMany(to []refs.FeedRef) ([]error, error) {
+	fg, err := a.b.Build()
+	if err != nil {
+		return nil, fmt.Errorf("graph/AuthorizeMany: failed to make friendgraph: %w", err)
+	}
+
+	results := make([]error, len(to))
+
+	if fg.NodeCount() == 0 {
+		level.Warn(a.log).Log("msg", "authbypass - trust on first use", "feeds", len(to))
+		return results, nil
+	}
+
+	var distLookup *Lookup
+	for i, feed := range to {
+		if fg.Follows(a.from, feed) {
+			continue
+		}
+
+		// only construct the lookup if someone isn't followed directly
+		if distLookup == nil {
+			distLookup, err = fg.MakeDijkstra(a.from)
+			if err != nil {
+				return nil, fmt.Errorf("graph/AuthorizeMany: failed to construct dijkstra: %w", err)
+			}
+		}
+
+		results[i] = a.checkDist(fg, distLookup, feed)
+	}
+	return results, nil
+}
+
+func (a *authorizer) checkDist(fg *Graph, distLookup *Lookup, to refs.FeedRef) error {
 	p, d := distLookup.Dist(to)
-	hops := len(p) - 2
-	if math.IsInf(d, -1) || math.IsInf(d, 1) || hops < 0 || hops > a.maxHops {
-		// d == -Inf: peer not connected to the graph
-		// d == +Inf: peer directly blocked
-		//level.Debug(a.log).Log("event", "out-of-reach", "d", d, "p", fmt.Sprintf("%v", p), "to", to.ShortRef())
-		return &ssb.ErrOutOfReach{Dist: hops, Max: a.maxHops}
+	hops, ok := withinHops(p, d, a.maxHops)
+	if ok {
+		return nil
 	}
-	return nil
+	//level.Debug(a.log).Log("event", "out-of-reach", "d", d, "p", fmt.Sprintf("%v", p), "to", to.ShortRef())
+	return &ssb.ErrOutOfReach{
+		Dist:    hops,
+		Max:     a.maxHops,
+		Via:     lastInReach(p, d, a.maxHops),
+		Blocked: fg.Blocks(a.from, to),
+	}
+}
 
+// lastInReach returns the last feed on the path p which is at most max hops away from its start.
+// It returns nil if the path doesn't go through other feeds or only with a block.
+func lastInReach(p []graph.Node, d float64, max int) *refs.FeedRef {
+	// p includes start and end, p[i] is i-1 hops away
+	if math.IsInf(d, 0) || len(p) < 3 {
+		return nil
+	}
+	i := max + 1
+	if i > len(p)-2 {
+		i = len(p) - 2
+	}
+	if i < 1 {
+		return nil
+	}
+	cn, ok := p[i].(*contactNode)
+	if !ok {
+		return nil
+	}
+	feed := cn.feed
+	return &feed
 }
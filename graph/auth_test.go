@@ -0,0 +1,263 @@
+// SPDX-FileCopyrightText: 2021 The Go-SSB Authors
+//
+// SPDX-License-Identifier: MIT
+
+package graph
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.mindeco.de/log"
+	"gonum.org/v1/gonum/graph/simple"
+
+	"github.com/ssbc/go-ssb"
+	refs "github.com/ssbc/go-ssb-refs"
+	"github.com/ssbc/go-ssb/internal/storedrefs"
+)
+
+// staticBuilder returns the same prebuilt graph, to measure the authorizer without the database
+type staticBuilder struct {
+	Builder
+
+	g *Graph
+}
+
+func (sb staticBuilder) Build() (*Graph, error) { return sb.g, nil }
+
+func (sb staticBuilder) Authorizer(from refs.FeedRef, maxHops int) ssb.Authorizer {
+	return &authorizer{
+		b:       sb,
+		from:    from,
+		maxHops: maxHops,
+		log:     log.NewNopLogger(),
+	}
+}
+
+// makeFanoutGraph makes a graph where self follows friends feeds which each follow perFriend other feeds.
+// It returns the graph, self and all other feeds. Every tenth of the followed feeds is blocked by self.
+func makeFanoutGraph(t testing.TB, friends, perFriend int) (*Graph, refs.FeedRef, []refs.FeedRef) {
+	r := require.New(t)
+	g := NewGraph()
+
+	var i uint32
+	newNode := func() (refs.FeedRef, *contactNode) {
+		pub := make([]byte, 32)
+		binary.BigEndian.PutUint32(pub, i)
+		i++
+		ref, err := refs.NewFeedRefFromBytes(pub, refs.RefAlgoFeedSSB1)
+		r.NoError(err)
+		n := &contactNode{g.NewNode(), ref, ""}
+		g.AddNode(n)
+		g.lookup[storedrefs.Feed(ref)] = n
+		return ref, n
+	}
+	follow := func(from, to *contactNode) {
+		g.SetWeightedEdge(contactEdge{WeightedEdge: simple.WeightedEdge{F: from, T: to, W: 1}})
+	}
+
+	self, selfNode := newNode()
+
+	var all []refs.FeedRef
+	for f := 0; f < friends; f++ {
+		friend, friendNode := newNode()
+		follow(selfNode, friendNode)
+		all = append(all, friend)
+
+		for p := 0; p < perFriend; p++ {
+			other, otherNode := newNode()
+			follow(friendNode, otherNode)
+			if p%10 == 0 {
+				g.SetWeightedEdge(contactEdge{
+					WeightedEdge: simple.WeightedEdge{F: selfNode, T: otherNode, W: math.Inf(1)},
+					isBlock:      true,
+				})
+			}
+			all = append(all, other)
+		}
+	}
+
+	return g, self, all
+}
+
+func TestAuthorizeMany(t *testing.T) {
+	r := require.New(t)
+
+	g, self, feeds := makeFanoutGraph(t, 5, 20)
+	sb := staticBuilder{g: g}
+
+	for _, hops := range []int{0, 1} {
+		auth := sb.Authorizer(self, hops).(BulkAuthorizer)
+
+		results, err := auth.AuthorizeMany(feeds)
+		r.NoError(err)
+		r.Len(results, len(feeds))
+
+		for i, feed := range feeds {
+			single := auth.Authorize(feed)
+			if single == nil {
+				r.NoError(results[i], "hops %d: feed %d", hops, i)
+			} else {
+				r.Error(results[i], "hops %d: feed %d", hops, i)
+			}
+		}
+	}
+}
+
+// BenchmarkAuthorize compares authorizing 1010 feeds (10 friends following 100 feeds each) one by one and with AuthorizeMany.
+//
+//	go test ./graph -run '^$' -bench BenchmarkAuthorize
+//
+// AuthorizeMany should be a few hundred times faster, since it looks up the hops once instead of once per feed.
+func BenchmarkAuthorize(b *testing.B) {
+	g, self, feeds := makeFanoutGraph(b, 10, 100)
+	sb := staticBuilder{g: g}
+	auth := sb.Authorizer(self, 1).(BulkAuthorizer)
+
+	b.Run("loop", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			for _, feed := range feeds {
+				auth.Authorize(feed)
+			}
+		}
+	})
+
+	b.Run("many", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			if _, err := auth.AuthorizeMany(feeds); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+func TestAuthorizeOutOfReach(t *testing.T) {
+	r := require.New(t)
+
+	// self follows friend, who follows fof and enemy. fof follows far.
+	// self blocks enemy and loner, whom nobody follows.
+	const self, friend, fof, far, enemy, loner = 0, 1, 2, 3, 4, 5
+	g := NewGraph()
+	var feeds []refs.FeedRef
+	for i := 0; i < 6; i++ {
+		f := testIncrementalFeed(t, i)
+		feeds = append(feeds, f)
+		node := &contactNode{g.NewNode(), f, ""}
+		g.AddNode(node)
+		g.lookup[storedrefs.Feed(f)] = node
+	}
+	edge := func(from, to int, w float64) {
+		nFrom := g.lookup[storedrefs.Feed(feeds[from])]
+		nTo := g.lookup[storedrefs.Feed(feeds[to])]
+		g.SetWeightedEdge(contactEdge{WeightedEdge: simple.WeightedEdge{F: nFrom, T: nTo, W: w}, isBlock: math.IsInf(w, 1)})
+	}
+	edge(self, friend, 1)
+	edge(friend, fof, 1)
+	edge(friend, enemy, 1)
+	edge(fof, far, 1)
+	edge(self, enemy, math.Inf(1))
+	edge(self, loner, math.Inf(1))
+
+	sb := staticBuilder{g: g}
+	outOfReach := func(maxHops, to int) *ssb.ErrOutOfReach {
+		err := sb.Authorizer(feeds[self], maxHops).Authorize(feeds[to])
+		r.Error(err)
+		var oor *ssb.ErrOutOfReach
+		r.True(errors.As(err, &oor), "actual err: %T\n%+v", err, err)
+		return oor
+	}
+
+	// far is two hops away, friend and fof are the feeds in between
+	oor := outOfReach(0, far)
+	r.Equal(2, oor.Dist)
+	r.Equal(0, oor.Max)
+	r.NotNil(oor.Via)
+	r.True(oor.Via.Equal(feeds[friend]))
+	r.False(oor.Blocked)
+	r.False(errors.Is(oor, ssb.ErrBlocked))
+
+	oor = outOfReach(1, far)
+	r.Equal(2, oor.Dist)
+	r.NotNil(oor.Via)
+	r.True(oor.Via.Equal(feeds[fof]), "fof is the last feed in reach with one hop")
+
+	// enemy is followed by friend but blocked by self
+	oor = outOfReach(0, enemy)
+	r.Equal(1, oor.Dist)
+	r.NotNil(oor.Via)
+	r.True(oor.Via.Equal(feeds[friend]))
+	r.True(oor.Blocked)
+	r.True(errors.Is(oor, ssb.ErrBlocked))
+	r.Contains(oor.Error(), "blocked")
+
+	// loner can only be reached through the block
+	oor = outOfReach(2, loner)
+	r.True(oor.Dist < 0)
+	r.Nil(oor.Via)
+	r.True(oor.Blocked)
+}
+
+// countingBuilder counts the graphs built for the authorizer and has a version which the test changes
+type countingBuilder struct {
+	staticBuilder
+
+	builds  int
+	version int64
+}
+
+func (cb *countingBuilder) Build() (*Graph, error) {
+	cb.builds++
+	return cb.g, nil
+}
+
+func (cb *countingBuilder) CurrentVersion() int64 { return cb.version }
+
+func TestAuthorizeCache(t *testing.T) {
+	r := require.New(t)
+
+	g, self, feeds := makeFanoutGraph(t, 2, 3)
+	cb := &countingBuilder{staticBuilder: staticBuilder{g: g}}
+	auth := &authorizer{
+		b:       cb,
+		from:    self,
+		maxHops: 0,
+		log:     log.NewNopLogger(),
+
+		cacheTTL:         time.Minute,
+		negativeCacheTTL: 50 * time.Millisecond,
+	}
+	friend, fof := feeds[0], feeds[2]
+
+	// accepted peers are cached
+	r.NoError(auth.Authorize(friend))
+	r.Equal(1, cb.builds)
+	r.NoError(auth.Authorize(friend))
+	r.Equal(1, cb.builds, "the decision should be reused")
+
+	// so are rejected ones
+	err := auth.Authorize(fof)
+	r.Error(err)
+	r.Equal(2, cb.builds)
+	r.Equal(err, auth.Authorize(fof))
+	r.Equal(2, cb.builds)
+
+	// a change of the graph invalidates all decisions
+	cb.version++
+	r.NoError(auth.Authorize(friend))
+	r.Equal(3, cb.builds)
+	r.Error(auth.Authorize(fof))
+	r.Equal(4, cb.builds)
+	r.NoError(auth.Authorize(friend))
+	r.Equal(4, cb.builds)
+
+	// rejections expire sooner
+	time.Sleep(100 * time.Millisecond)
+	r.Error(auth.Authorize(fof))
+	r.Equal(5, cb.builds)
+	r.NoError(auth.Authorize(friend))
+	r.Equal(5, cb.builds, "the acceptance should still be cached")
+}
@@ -4,7 +4,14 @@
 
 package graph
 
-import "fmt"
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	refs "github.com/ssbc/go-ssb-refs"
+	"github.com/stretchr/testify/require"
+)
 
 /*
 Quoting from https://github.com/ssbc/ssb-friends README.md
@@ -164,6 +171,26 @@ var blockScenarios = []PeopleTestCase{
 			PeopleAssertOnBlocklist("3"),
 		},
 	},
+	{
+		name: "blocked by",
+		ops: []PeopleOp{
+			PeopleOpNewPeer{"alice"},
+			PeopleOpNewPeer{"bob"},
+			PeopleOpNewPeer{"claire"},
+
+			PeopleOpBlock{"alice", "claire"},
+
+			PeopleOpBlock{"bob", "claire"},
+			PeopleOpUnblock{"bob", "claire"},
+
+			PeopleOpFollow{"claire", "bob"},
+		},
+		asserts: []PeopleAssertMaker{
+			PeopleAssertBlockedBy("claire", "alice"),
+			PeopleAssertBlockedBy("bob"),
+			PeopleAssertBlockedBy("alice"),
+		},
+	},
 }
 
 func PeopleAssertOnBlocklist(from string, who ...string) PeopleAssertMaker {
@@ -201,3 +228,73 @@ func PeopleAssertOnBlocklist(from string, who ...string) PeopleAssertMaker {
 		}
 	}
 }
+
+func PeopleAssertBlockedBy(to string, who ...string) PeopleAssertMaker {
+	return func(state *testState) PeopleAssert {
+		pTo, ok := state.peers[to]
+		if !ok {
+			state.t.Fatal("no such wanted peer:", to)
+			return nil
+		}
+
+		return func(bld Builder) error {
+			g, err := bld.Build()
+			if err != nil {
+				return err
+			}
+
+			set := g.BlockedBy(pTo.key.ID())
+			got := set.Count()
+			if got != len(who) {
+				return fmt.Errorf("BlockedBy() wrong length: %d", got)
+			}
+
+			for _, want := range who {
+				pFrom, ok := state.peers[want]
+				if !ok {
+					state.t.Fatal("no such wanted peer:", want)
+					return nil
+				}
+				if !set.Has(pFrom.key.ID()) {
+					state.t.Errorf("expected %s to block %s", want, to)
+				}
+			}
+			return nil
+		}
+	}
+}
+
+func TestMutualBlocks(t *testing.T) {
+	r := require.New(t)
+
+	var feeds []refs.FeedRef
+	for i := 0; i < 5; i++ {
+		feeds = append(feeds, testIncrementalFeed(t, i))
+	}
+	a, b, c, d, e := feeds[0], feeds[1], feeds[2], feeds[3], feeds[4]
+
+	jsGraph := map[string]map[string]int{
+		// a and b block each other
+		a.Sigil(): {b.Sigil(): jsBlock, e.Sigil(): jsFollow},
+		b.Sigil(): {a.Sigil(): jsBlock},
+		// c only blocks d
+		c.Sigil(): {d.Sigil(): jsBlock},
+		// a follows e, e blocks a
+		e.Sigil(): {a.Sigil(): jsBlock},
+	}
+	data, err := json.Marshal(jsGraph)
+	r.NoError(err)
+	g, err := UnmarshalJS(data)
+	r.NoError(err)
+
+	pairs := g.MutualBlocks()
+	r.Len(pairs, 1)
+	want := FeedPair{From: a, To: b}
+	if b.Sigil() < a.Sigil() {
+		want = FeedPair{From: b, To: a}
+	}
+	r.True(pairs[0].From.Equal(want.From))
+	r.True(pairs[0].To.Equal(want.To))
+
+	r.Empty(NewGraph().MutualBlocks())
+}
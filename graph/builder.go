@@ -10,8 +10,10 @@ import (
 	"math"
 	"net/http"
 	"sync"
+	"time"
 
 	"github.com/dgraph-io/badger/v3"
+	"github.com/ssbc/margaret"
 	librarian "github.com/ssbc/margaret/indexes"
 	libbadger "github.com/ssbc/margaret/indexes/badger"
 	"go.mindeco.de/log"
@@ -32,6 +34,10 @@ type Builder interface {
 	// Build a complete graph of all follow/block relations
 	Build() (*Graph, error)
 
+	// CurrentVersion returns the version the next call to Build would return.
+	// It can be compared to Graph.Version to see if a snapshot is stale.
+	CurrentVersion() int64
+
 	// Follows returns a set of all people ref follows
 	Follows(refs.FeedRef) (*ssb.StrFeedSet, error)
 
@@ -41,6 +47,12 @@ type Builder interface {
 	Authorizer(from refs.FeedRef, maxHops int) ssb.Authorizer
 
 	DeleteAuthor(who refs.FeedRef) error
+
+	// Forget removes who and all the relations to and from it
+	Forget(who refs.FeedRef) error
+
+	// Subscribe returns the changes of the follows and blocks from or to feed
+	Subscribe(feed refs.FeedRef) *Subscription
 }
 
 type IndexingBuilder interface {
@@ -65,8 +77,30 @@ type BadgerBuilder struct {
 
 	cacheLock   sync.Mutex
 	cachedGraph *Graph
+	version     int64
+
+	// with debounce set, index updates are collected in pendingVersion until the timer fires
+	debounce       time.Duration
+	debounceTimer  *time.Timer
+	pendingVersion int64
 
 	hmacSecret *[32]byte
+
+	authHops        int
+	replicationHops int
+	trustDecay      float64
+
+	centralityDamping float64
+
+	authCacheTTL         time.Duration
+	authNegativeCacheTTL time.Duration
+
+	subsMu sync.Mutex
+	subs   map[*Subscription]struct{}
+
+	checkpointInterval int
+	checkpointMu       sync.Mutex
+	sinceCheckpoint    int
 }
 
 var (
@@ -75,14 +109,49 @@ var (
 )
 
 // NewBuilder creates a Builder that is backed by a badger database
-func NewBuilder(log log.Logger, db *badger.DB, hmacSecret *[32]byte) *BadgerBuilder {
+func NewBuilder(log log.Logger, db *badger.DB, hmacSecret *[32]byte, opts ...BuilderOption) *BadgerBuilder {
 	b := &BadgerBuilder{
 		kv:  db,
 		log: log,
 
 		idx: libbadger.NewIndexWithKeyPrefix(db, 0, dbKeyPrefix),
 
+		version:        margaret.SeqEmpty,
+		pendingVersion: margaret.SeqEmpty,
+
 		hmacSecret: hmacSecret,
+
+		authHops:        DefaultAuthHops,
+		replicationHops: DefaultReplicationHops,
+		trustDecay:      DefaultTrustDecay,
+
+		centralityDamping: DefaultCentralityDamping,
+
+		authCacheTTL:         DefaultAuthCacheTTL,
+		authNegativeCacheTTL: DefaultAuthNegativeCacheTTL,
+
+		subs: make(map[*Subscription]struct{}),
+
+		checkpointInterval: DefaultCheckpointInterval,
+	}
+
+	for _, o := range opts {
+		o(b)
+	}
+
+	if err := b.restoreCheckpoint(); err != nil {
+		level.Error(log).Log("event", "graph checkpoint", "err", err)
+	}
+
+	// the stored graph reflects everything the index processed so far,
+	// the stored version also counts the changes that didn't come from messages
+	if seq, err := b.idx.GetSeq(); err == nil {
+		b.version = seq
+	}
+	if v, has, err := b.readVersion(); err != nil {
+		level.Error(log).Log("event", "graph version", "err", err)
+	} else if has && v > b.version {
+		b.version = v
 	}
 
 	// make sure we initialize the waitgroup so we have an opportunity to index
@@ -96,7 +165,7 @@ func (b *BadgerBuilder) DeleteAuthor(who refs.FeedRef) error {
 	b.WaitUntilIndexesAreSynced()
 	b.cacheLock.Lock()
 	defer b.cacheLock.Unlock()
-	b.cachedGraph = nil
+	b.graphChanged(b.version)
 	return b.kv.Update(func(txn *badger.Txn) error {
 		iter := txn.NewIterator(badger.DefaultIteratorOptions)
 		defer iter.Close()
@@ -114,18 +183,123 @@ func (b *BadgerBuilder) DeleteAuthor(who refs.FeedRef) error {
 	})
 }
 
+// Forget removes who from the graph, dropping its own relations like DeleteAuthor and also all the relations of others to it.
+// The contact messages stay in the log, so a new contact message about who or by who adds it again.
+func (b *BadgerBuilder) Forget(who refs.FeedRef) error {
+	b.WaitUntilIndexesAreSynced()
+	b.cacheLock.Lock()
+	defer b.cacheLock.Unlock()
+	b.graphChanged(b.version)
+
+	whoAddr := []byte(storedrefs.Feed(who))
+	return b.kv.Update(func(txn *badger.Txn) error {
+		iter := txn.NewIterator(badger.DefaultIteratorOptions)
+		defer iter.Close()
+
+		for iter.Seek(dbKeyPrefix); iter.ValidForPrefix(dbKeyPrefix); iter.Next() {
+			k := iter.Item().KeyCopy(nil)
+			if len(k) != 68+dbKeyPrefixLen {
+				continue
+			}
+
+			rawFrom := k[dbKeyPrefixLen : 34+dbKeyPrefixLen]
+			rawTo := k[34+dbKeyPrefixLen:]
+			if !bytes.Equal(rawFrom, whoAddr) && !bytes.Equal(rawTo, whoAddr) {
+				continue
+			}
+
+			if err := txn.Delete(k); err != nil {
+				return fmt.Errorf("Forget: failed to drop record %x: %w", k, err)
+			}
+		}
+		return nil
+	})
+}
+
+// CurrentVersion returns the root log sequence of the latest change to the graph.
+func (b *BadgerBuilder) CurrentVersion() int64 {
+	b.WaitUntilIndexesAreSynced()
+	b.cacheLock.Lock()
+	defer b.cacheLock.Unlock()
+	return b.version
+}
+
+// graphChanged drops the cached graph and advances the version to seq.
+// Changes that don't come from a newer message, like DeleteAuthor, advance it by one instead.
+// Updates that are still debounced are applied with it.
+// Needs to be called with cacheLock held.
+func (b *BadgerBuilder) graphChanged(seq int64) {
+	if b.debounceTimer != nil {
+		b.debounceTimer.Stop()
+		b.debounceTimer = nil
+	}
+	if b.pendingVersion > seq {
+		seq = b.pendingVersion
+	}
+	b.pendingVersion = margaret.SeqEmpty
+
+	b.cachedGraph = nil
+	if seq > b.version {
+		b.version = seq
+	} else {
+		b.version++
+	}
+	b.storeVersion()
+}
+
+// indexChanged is graphChanged for the updates from the indexes, which are debounced if WithDebounce was used.
+// Until the updates stop for the debounce duration, Build keeps returning the graph it built before them.
+// Needs to be called with cacheLock held.
+func (b *BadgerBuilder) indexChanged(seq int64) {
+	// without a cached graph the next Build has to read the database anyway
+	if b.debounce <= 0 || b.cachedGraph == nil {
+		b.graphChanged(seq)
+		return
+	}
+
+	if seq > b.pendingVersion {
+		b.pendingVersion = seq
+	}
+	if b.debounceTimer != nil {
+		b.debounceTimer.Stop()
+	}
+	var timer *time.Timer
+	timer = time.AfterFunc(b.debounce, func() {
+		b.cacheLock.Lock()
+		defer b.cacheLock.Unlock()
+		// a later update or graphChanged replaced this timer
+		if b.debounceTimer != timer {
+			return
+		}
+		b.graphChanged(b.pendingVersion)
+	})
+	b.debounceTimer = timer
+}
+
 func (b *BadgerBuilder) Authorizer(from refs.FeedRef, maxHops int) ssb.Authorizer {
 	return &authorizer{
 		b:       b,
 		from:    from,
 		maxHops: maxHops,
 		log:     b.log,
+
+		cacheTTL:         b.authCacheTTL,
+		negativeCacheTTL: b.authNegativeCacheTTL,
 	}
 }
 
+// DefaultAuthorizer returns an authorizer for from that uses the distance configured with WithAuthHops.
+func (b *BadgerBuilder) DefaultAuthorizer(from refs.FeedRef) ssb.Authorizer {
+	return b.Authorizer(from, b.authHops)
+}
+
 func (b *BadgerBuilder) Build() (*Graph, error) {
 	b.WaitUntilIndexesAreSynced()
 	dg := NewGraph()
+	dg.replicationHops = b.replicationHops
+	dg.trustHops = b.authHops
+	dg.trustDecay = b.trustDecay
+	dg.centralityDamping = b.centralityDamping
 
 	b.cacheLock.Lock()
 	defer b.cacheLock.Unlock()
@@ -133,6 +307,7 @@ func (b *BadgerBuilder) Build() (*Graph, error) {
 	if b.cachedGraph != nil {
 		return b.cachedGraph, nil
 	}
+	dg.version = b.version
 
 	err := b.kv.View(func(txn *badger.Txn) error {
 		iter := txn.NewIterator(badger.DefaultIteratorOptions)
@@ -241,9 +416,15 @@ func (b *BadgerBuilder) Build() (*Graph, error) {
 type Lookup struct {
 	dijk   path.Shortest
 	lookup key2node
+
+	// inc is set for lookups made by IncrementalLookup.Lookup
+	inc *IncrementalLookup
 }
 
 func (l Lookup) Dist(to refs.FeedRef) ([]graph.Node, float64) {
+	if l.inc != nil {
+		return l.inc.distFeed(to)
+	}
 	bto := storedrefs.Feed(to)
 	nTo, has := l.lookup[bto]
 	if !has {
@@ -365,6 +546,9 @@ func (b *BadgerBuilder) Subfeeds(metaFeed refs.FeedRef) (*ssb.StrFeedSet, error)
 	return fs, err
 }
 
+// ssb.GraphFilter looks up the hops once per version
+var _ ssb.VersionedHopsLister = (*BadgerBuilder)(nil)
+
 // Hops returns a slice of feed refrences that are in a particulare range of from
 //
 //    * max == 0: only direct follows of from
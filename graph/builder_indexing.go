@@ -86,7 +86,7 @@ func (b *BadgerBuilder) updateAnnouncement(ctx context.Context, seq int64, val i
 		return fmt.Errorf("db/idx announcements: failed to update index %+v: %w", announceMsg, err)
 	}
 
-	b.cachedGraph = nil
+	b.indexChanged(seq)
 	// TODO: patch existing graph instead of invalidating
 	return nil
 }
@@ -95,7 +95,7 @@ func (b *BadgerBuilder) OpenAnnouncementIndex() (librarian.SeqSetterIndex, libra
 	b.indexSyncStart()
 	defer b.indexSyncDone()
 	if b.idxSinkAnnouncements == nil {
-		b.idxSinkAnnouncements = librarian.NewSinkIndex(b.updateAnnouncement, b.idx)
+		b.idxSinkAnnouncements = b.withCheckpoints(librarian.NewSinkIndex(b.updateAnnouncement, b.idx))
 	}
 	return b.idx, b.idxSinkAnnouncements
 }
@@ -130,13 +130,20 @@ func (b *BadgerBuilder) updateContacts(ctx context.Context, seq int64, val inter
 
 	addr := storedrefs.Feed(abs.Author())
 	addr += storedrefs.Feed(c.Contact)
+	change := EdgeChange{
+		FeedPair: FeedPair{From: abs.Author(), To: c.Contact},
+		Seq:      seq,
+	}
 	switch {
 	case c.Following:
 		err = idx.Set(ctx, addr, idxRelValueFollowing)
+		change.Kind = EdgeFollow
 	case c.Blocking:
 		err = idx.Set(ctx, addr, idxRelValueBlocking)
+		change.Kind = EdgeBlock
 	default:
 		err = idx.Set(ctx, addr, idxRelValueNone)
+		change.Kind = EdgeUnfollow
 		// cryptix: not sure why this doesn't work
 		// it also removes the node if this is the only follow from that peer
 		// 3 state handling seems saner
@@ -146,7 +153,8 @@ func (b *BadgerBuilder) updateContacts(ctx context.Context, seq int64, val inter
 		return fmt.Errorf("db/idx contacts: failed to update index. %+v: %w", c, err)
 	}
 
-	b.cachedGraph = nil
+	b.indexChanged(seq)
+	b.notifySubscriptions(change)
 	// TODO: patch existing graph instead of invalidating
 	return nil
 }
@@ -155,7 +163,7 @@ func (b *BadgerBuilder) OpenContactsIndex() (librarian.SeqSetterIndex, librarian
 	b.indexSyncStart()
 	defer b.indexSyncDone()
 	if b.idxSinkContacts == nil {
-		b.idxSinkContacts = librarian.NewSinkIndex(b.updateContacts, b.idx)
+		b.idxSinkContacts = b.withCheckpoints(librarian.NewSinkIndex(b.updateContacts, b.idx))
 	}
 	return b.idx, b.idxSinkContacts
 }
@@ -276,12 +284,14 @@ func (b *BadgerBuilder) updateMetafeeds(ctx context.Context, seq int64, val inte
 
 	default:
 		level.Warn(msgLogger).Log("warning", "unhandeled message type", "type", justTheType.Type)
+		return nil
 	}
 
 	if err != nil {
 		return fmt.Errorf("failed to update metafeed index with message %s: %w", msg.Key().String(), err)
 	}
 
+	b.indexChanged(seq)
 	return nil
 
 }
@@ -290,7 +300,7 @@ func (b *BadgerBuilder) OpenMetafeedsIndex() (librarian.SeqSetterIndex, libraria
 	b.indexSyncStart()
 	defer b.indexSyncDone()
 	if b.idxSinkMetaFeeds == nil {
-		b.idxSinkMetaFeeds = librarian.NewSinkIndex(b.updateMetafeeds, b.idx)
+		b.idxSinkMetaFeeds = b.withCheckpoints(librarian.NewSinkIndex(b.updateMetafeeds, b.idx))
 	}
 	return b.idx, b.idxSinkMetaFeeds
 }
@@ -68,6 +68,10 @@ func openUserMultilogs(t *testing.T) (multilog.MultiLog, multilog.Sink) {
 }
 
 func makeBadger(t *testing.T) testStore {
+	return makeBadgerWithOptions(t)
+}
+
+func makeBadgerWithOptions(t *testing.T, opts ...BuilderOption) testStore {
 	r := require.New(t)
 	info := testutils.NewRelativeTimeLogger(nil)
 
@@ -99,7 +103,7 @@ func makeBadger(t *testing.T) testStore {
 	badgerDB, err := badger.Open(badgerOpts)
 	r.NoError(err, "db/idx: badger failed to open")
 
-	builder = NewBuilder(info, badgerDB, nil)
+	builder = NewBuilder(info, badgerDB, nil, opts...)
 
 	idxSetter, idxContactsSink := builder.OpenContactsIndex()
 	cErrc := serveLog(ctx, "badgerContacts", tRootLog, idxContactsSink, true)
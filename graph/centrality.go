@@ -0,0 +1,93 @@
+// SPDX-FileCopyrightText: 2021 The Go-SSB Authors
+//
+// SPDX-License-Identifier: MIT
+
+package graph
+
+import (
+	"sort"
+)
+
+// Centrality returns a PageRank-style score for each feed in the graph, keyed by its sigil.
+// A feed ranks high if it is followed by many feeds which rank high themselves, which makes it useful to find well-trusted hubs.
+// Only follows count, blocks and metafeed edges are ignored.
+//
+// Each of the iterations starts from the scores of the previous one, beginning with the same score for all feeds.
+// With the probability of the damping factor (see WithCentralityDamping) the score flows along the follows of a feed,
+// split evenly between them, and otherwise it is spread over all feeds.
+// The score of feeds that follow no one is spread over all feeds as well, so the scores always add up to 1.
+// The feeds are processed in a fixed order, so the same graph always gives the same scores.
+func (g *Graph) Centrality(iterations int) map[string]float64 {
+	g.Mutex.Lock()
+	defer g.Mutex.Unlock()
+
+	var ids []int64
+	nodes := g.Nodes()
+	for nodes.Next() {
+		ids = append(ids, nodes.Node().ID())
+	}
+	scores := make(map[string]float64, len(ids))
+	if len(ids) == 0 {
+		return scores
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+
+	idx := make(map[int64]int, len(ids))
+	for i, id := range ids {
+		idx[id] = i
+	}
+
+	// the followed feeds of each feed, by their index in ids
+	follows := make([][]int, len(ids))
+	for i, id := range ids {
+		to := g.From(id)
+		for to.Next() {
+			toID := to.Node().ID()
+			if edg := g.WeightedEdge(id, toID); edg == nil || edg.Weight() != 1 {
+				continue
+			}
+			follows[i] = append(follows[i], idx[toID])
+		}
+		sort.Ints(follows[i])
+	}
+
+	var (
+		n      = float64(len(ids))
+		damp   = g.centralityDamping
+		rank   = make([]float64, len(ids))
+		next   = make([]float64, len(ids))
+		jumpTo = (1 - damp) / n
+	)
+	for i := range rank {
+		rank[i] = 1 / n
+	}
+
+	for it := 0; it < iterations; it++ {
+		var dangling float64
+		for i, r := range rank {
+			if len(follows[i]) == 0 {
+				dangling += r
+			}
+		}
+
+		base := jumpTo + damp*dangling/n
+		for i := range next {
+			next[i] = base
+		}
+		for i, r := range rank {
+			if len(follows[i]) == 0 {
+				continue
+			}
+			share := damp * r / float64(len(follows[i]))
+			for _, to := range follows[i] {
+				next[to] += share
+			}
+		}
+		rank, next = next, rank
+	}
+
+	for i, id := range ids {
+		scores[g.Node(id).(*contactNode).feed.Sigil()] = rank[i]
+	}
+	return scores
+}
@@ -0,0 +1,69 @@
+// SPDX-FileCopyrightText: 2021 The Go-SSB Authors
+//
+// SPDX-License-Identifier: MIT
+
+package graph
+
+import (
+	"encoding/json"
+	"testing"
+
+	refs "github.com/ssbc/go-ssb-refs"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCentrality(t *testing.T) {
+	r := require.New(t)
+
+	var feeds []refs.FeedRef
+	for i := 0; i < 6; i++ {
+		feeds = append(feeds, testIncrementalFeed(t, i))
+	}
+
+	// a star: all the leaves follow the hub 0, which follows no one.
+	// the block between two leaves doesn't count
+	edges := map[int]map[int]int{
+		1: {0: jsFollow},
+		2: {0: jsFollow},
+		3: {0: jsFollow},
+		4: {0: jsFollow, 5: jsBlock},
+		5: {0: jsFollow},
+	}
+	jsGraph := make(map[string]map[string]int)
+	for from, tos := range edges {
+		jsGraph[feeds[from].Sigil()] = make(map[string]int)
+		for to, state := range tos {
+			jsGraph[feeds[from].Sigil()][feeds[to].Sigil()] = state
+		}
+	}
+	data, err := json.Marshal(jsGraph)
+	r.NoError(err)
+	g, err := UnmarshalJS(data)
+	r.NoError(err)
+
+	scores := g.Centrality(50)
+	r.Len(scores, len(feeds))
+
+	var sum float64
+	for _, s := range scores {
+		sum += s
+	}
+	r.InDelta(1, sum, 1e-9)
+
+	hub := scores[feeds[0].Sigil()]
+	leaf := scores[feeds[1].Sigil()]
+	r.Greater(hub, leaf)
+	for _, f := range feeds[2:] {
+		r.Equal(leaf, scores[f.Sigil()], "leaf %s", f.ShortSigil())
+	}
+
+	r.Equal(scores, g.Centrality(50), "not deterministic")
+
+	// without damping the leaves pass all of their score to the hub, which spreads its own evenly
+	g.centralityDamping = 1
+	scores = g.Centrality(1)
+	r.InDelta(5.0/6+1.0/36, scores[feeds[0].Sigil()], 1e-9)
+	r.InDelta(1.0/36, scores[feeds[1].Sigil()], 1e-9)
+
+	r.Empty(NewGraph().Centrality(10))
+}
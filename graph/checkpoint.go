@@ -0,0 +1,188 @@
+// SPDX-FileCopyrightText: 2021 The Go-SSB Authors
+//
+// SPDX-License-Identifier: MIT
+
+package graph
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+
+	"github.com/dgraph-io/badger/v3"
+	"github.com/ssbc/margaret"
+	librarian "github.com/ssbc/margaret/indexes"
+	"go.mindeco.de/log/level"
+)
+
+// The index batches the relations it writes but stores its sequence right away.
+// If the process stops before a batch is written, the stored sequence is ahead of the stored relations and the missing ones are never indexed.
+// A checkpoint is a sequence up to which everything was written. On startup the index is rolled back to it and the messages after it are processed again.
+// Processing contact messages again in order ends up with the same relations, so this is safe.
+
+// checkpointKey is outside of dbKeyPrefix so that it isn't read as a relation.
+var checkpointKey = []byte("graph-checkpoint")
+
+// a checkpoint is the sequence in the encoding the index uses for it, followed by its CRC-32 checksum
+const checkpointLen = 8 + 4
+
+var errCorruptCheckpoint = errors.New("graph: corrupt checkpoint")
+
+func encodeCheckpoint(seq int64) []byte {
+	raw := make([]byte, checkpointLen)
+	binary.BigEndian.PutUint64(raw[:8], uint64(seq))
+	binary.BigEndian.PutUint32(raw[8:], crc32.ChecksumIEEE(raw[:8]))
+	return raw
+}
+
+func decodeCheckpoint(raw []byte) (int64, error) {
+	if len(raw) != checkpointLen {
+		return 0, fmt.Errorf("%w: expected %d bytes, got %d", errCorruptCheckpoint, checkpointLen, len(raw))
+	}
+	if crc32.ChecksumIEEE(raw[:8]) != binary.BigEndian.Uint32(raw[8:]) {
+		return 0, fmt.Errorf("%w: checksum mismatch", errCorruptCheckpoint)
+	}
+	return int64(binary.BigEndian.Uint64(raw[:8])), nil
+}
+
+// readCheckpoint returns the stored checkpoint. has is false if there is none.
+func (b *BadgerBuilder) readCheckpoint() (seq int64, has bool, err error) {
+	err = b.kv.View(func(txn *badger.Txn) error {
+		it, err := txn.Get(checkpointKey)
+		if err != nil {
+			return err
+		}
+		return it.Value(func(raw []byte) error {
+			seq, err = decodeCheckpoint(raw)
+			return err
+		})
+	})
+	if errors.Is(err, badger.ErrKeyNotFound) {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, err
+	}
+	return seq, true, nil
+}
+
+// checkpoint writes everything the index has batched and stores the sequence it had before as the new checkpoint.
+// The sequence is read first, so that messages which are processed concurrently can't end up in the checkpoint without being written.
+func (b *BadgerBuilder) checkpoint() error {
+	seq, err := b.idx.GetSeq()
+	if err != nil {
+		return fmt.Errorf("graph/checkpoint: failed to get index sequence: %w", err)
+	}
+	if seq < 0 {
+		return nil
+	}
+
+	if f, ok := b.idx.(interface{ Flush() error }); ok {
+		if err := f.Flush(); err != nil {
+			return fmt.Errorf("graph/checkpoint: failed to flush index: %w", err)
+		}
+	}
+
+	err = b.kv.Update(func(txn *badger.Txn) error {
+		return txn.Set(checkpointKey, encodeCheckpoint(seq))
+	})
+	if err != nil {
+		return fmt.Errorf("graph/checkpoint: failed to store checkpoint: %w", err)
+	}
+	return nil
+}
+
+// restoreCheckpoint rolls the index back to the stored checkpoint.
+// If the checkpoint can't be read, nothing about the index can be trusted and it is dropped completely so that it is built again.
+// Indexes from before checkpoints existed are used as they are.
+func (b *BadgerBuilder) restoreCheckpoint() error {
+	cpSeq, has, err := b.readCheckpoint()
+	if err != nil {
+		if !errors.Is(err, errCorruptCheckpoint) {
+			return fmt.Errorf("graph/checkpoint: failed to read checkpoint: %w", err)
+		}
+		level.Warn(b.log).Log("event", "graph checkpoint", "msg", "rebuilding the graph", "reason", err)
+		return b.resetIndex()
+	}
+	if !has {
+		return nil
+	}
+
+	seq, err := b.idx.GetSeq()
+	if err != nil {
+		return fmt.Errorf("graph/checkpoint: failed to get index sequence: %w", err)
+	}
+
+	switch {
+	case seq > cpSeq:
+		level.Info(b.log).Log("event", "graph checkpoint", "msg", "resuming from checkpoint", "index", seq, "checkpoint", cpSeq)
+		if err := b.idx.SetSeq(cpSeq); err != nil {
+			return fmt.Errorf("graph/checkpoint: failed to roll back index: %w", err)
+		}
+	case seq < cpSeq:
+		// the index was reset after the checkpoint was taken
+		err = b.kv.Update(func(txn *badger.Txn) error {
+			return txn.Delete(checkpointKey)
+		})
+		if err != nil {
+			return fmt.Errorf("graph/checkpoint: failed to drop stale checkpoint: %w", err)
+		}
+	}
+	return nil
+}
+
+// resetIndex drops all the relations, the sequence of the index and the checkpoint.
+func (b *BadgerBuilder) resetIndex() error {
+	err := b.kv.Update(func(txn *badger.Txn) error {
+		iter := txn.NewIterator(badger.DefaultIteratorOptions)
+		defer iter.Close()
+
+		for iter.Seek(dbKeyPrefix); iter.ValidForPrefix(dbKeyPrefix); iter.Next() {
+			k := iter.Item().KeyCopy(nil)
+			if err := txn.Delete(k); err != nil {
+				return fmt.Errorf("failed to drop record %x: %w", k, err)
+			}
+		}
+		return txn.Delete(checkpointKey)
+	})
+	if err != nil {
+		return fmt.Errorf("graph/checkpoint: failed to reset index: %w", err)
+	}
+
+	if err := b.idx.SetSeq(margaret.SeqEmpty); err != nil {
+		return fmt.Errorf("graph/checkpoint: failed to reset index sequence: %w", err)
+	}
+	return nil
+}
+
+// checkpointSink takes a checkpoint every checkpointInterval messages that were poured into the sinks of the builder.
+type checkpointSink struct {
+	librarian.SinkIndex
+
+	b *BadgerBuilder
+}
+
+func (b *BadgerBuilder) withCheckpoints(snk librarian.SinkIndex) librarian.SinkIndex {
+	if b.checkpointInterval <= 0 {
+		return snk
+	}
+	return checkpointSink{SinkIndex: snk, b: b}
+}
+
+func (cs checkpointSink) Pour(ctx context.Context, v interface{}) error {
+	if err := cs.SinkIndex.Pour(ctx, v); err != nil {
+		return err
+	}
+
+	b := cs.b
+	b.checkpointMu.Lock()
+	defer b.checkpointMu.Unlock()
+	b.sinceCheckpoint++
+	if b.sinceCheckpoint < b.checkpointInterval {
+		return nil
+	}
+	b.sinceCheckpoint = 0
+	return b.checkpoint()
+}
@@ -0,0 +1,177 @@
+// SPDX-FileCopyrightText: 2021 The Go-SSB Authors
+//
+// SPDX-License-Identifier: MIT
+
+package graph
+
+import (
+	"context"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/dgraph-io/badger/v3"
+	"github.com/ssbc/go-luigi"
+	"github.com/ssbc/margaret"
+	librarian "github.com/ssbc/margaret/indexes"
+	"github.com/stretchr/testify/require"
+	"go.mindeco.de/log"
+
+	"github.com/ssbc/go-ssb"
+	"github.com/ssbc/go-ssb/internal/ctxutils"
+	"github.com/ssbc/go-ssb/repo"
+)
+
+func TestCheckpointResume(t *testing.T) {
+	r := require.New(t)
+	ctx, cancel := ctxutils.WithError(context.Background(), ssb.ErrShuttingDown)
+	defer cancel()
+
+	tRepoPath := filepath.Join("testrun", t.Name())
+	os.RemoveAll(tRepoPath)
+
+	tRepo := repo.New(tRepoPath)
+	root, err := repo.OpenLog(tRepo)
+	r.NoError(err)
+	t.Cleanup(func() { root.Close() })
+
+	uf, serveUF := openUserMultilogs(t)
+	ufErrc := serveLog(ctx, "user feeds", root, serveUF, true)
+
+	var feeds []*publisher
+	for i := 0; i < 6; i++ {
+		feeds = append(feeds, newPublisher(t, root, uf))
+	}
+	rnd := rand.New(rand.NewSource(42))
+	const msgCount = 40
+	for i := 0; i < msgCount; i++ {
+		from, to := feeds[rnd.Intn(len(feeds))], feeds[rnd.Intn(len(feeds))]
+		switch rnd.Intn(3) {
+		case 0, 1:
+			from.follow(to.key.ID())
+		default:
+			from.block(to.key.ID())
+		}
+	}
+	r.EqualValues(msgCount-1, root.Seq())
+
+	pour := func(snk librarian.SinkIndex, limit int) {
+		spec := []margaret.QuerySpec{snk.QuerySpec()}
+		if limit > 0 {
+			spec = append(spec, margaret.Limit(limit))
+		}
+		src, err := root.Query(spec...)
+		r.NoError(err)
+		r.NoError(luigi.Pump(ctx, snk, src))
+	}
+
+	// the graph of a build which wasn't interrupted
+	memDB, err := badger.Open(badger.DefaultOptions("").WithInMemory(true).WithLoggingLevel(badger.ERROR))
+	r.NoError(err)
+	want := NewBuilder(log.NewNopLogger(), memDB, nil)
+	_, snk := want.OpenContactsIndex()
+	pour(snk, 0)
+	wantGraph, err := want.Build()
+	r.NoError(err)
+	r.NoError(snk.Close())
+	r.NoError(memDB.Close())
+
+	openDB := func(dir string) *badger.DB {
+		db, err := badger.Open(badger.DefaultOptions(filepath.Join(tRepoPath, dir)).WithLoggingLevel(badger.ERROR))
+		r.NoError(err)
+		return db
+	}
+
+	// interrupted indexes the first messages and stops without writing the pending updates of the index
+	interrupted := func(dir string) {
+		db := openDB(dir)
+		b := NewBuilder(log.NewNopLogger(), db, nil, WithCheckpointInterval(5))
+		_, snk := b.OpenContactsIndex()
+		pour(snk, 12)
+
+		seq, err := b.idx.GetSeq()
+		r.NoError(err)
+		r.EqualValues(11, seq)
+
+		r.NoError(db.Close())
+		r.Error(snk.Close(), "pending updates were written after the database was closed")
+	}
+
+	// resume continues the build and checks that it ends up with the same graph
+	resume := func(t *testing.T, b *BadgerBuilder) {
+		r := require.New(t)
+		_, snk := b.OpenContactsIndex()
+		pour(snk, 0)
+
+		g, err := b.Build()
+		r.NoError(err)
+		d := Diff(wantGraph, g)
+		r.True(d.Empty(), "graphs differ: %+v", d)
+		r.NoError(snk.Close())
+	}
+
+	t.Run("resume", func(t *testing.T) {
+		r := require.New(t)
+		interrupted("resume")
+
+		db := openDB("resume")
+		defer db.Close()
+		b := NewBuilder(log.NewNopLogger(), db, nil, WithCheckpointInterval(5))
+
+		seq, err := b.idx.GetSeq()
+		r.NoError(err)
+		r.EqualValues(9, seq, "not rolled back to the last checkpoint")
+
+		resume(t, b)
+	})
+
+	corruptions := map[string]func([]byte) []byte{
+		"partial": func(raw []byte) []byte { return raw[:5] },
+		"checksum": func(raw []byte) []byte {
+			raw = append([]byte{}, raw...)
+			raw[7] ^= 0xff
+			return raw
+		},
+	}
+	for name, corrupt := range corruptions {
+		corrupt := corrupt
+		t.Run(name, func(t *testing.T) {
+			r := require.New(t)
+			interrupted(name)
+
+			db := openDB(name)
+			defer db.Close()
+			err := db.Update(func(txn *badger.Txn) error {
+				it, err := txn.Get(checkpointKey)
+				if err != nil {
+					return err
+				}
+				raw, err := it.ValueCopy(nil)
+				if err != nil {
+					return err
+				}
+				return txn.Set(checkpointKey, corrupt(raw))
+			})
+			r.NoError(err)
+
+			b := NewBuilder(log.NewNopLogger(), db, nil, WithCheckpointInterval(5))
+
+			seq, err := b.idx.GetSeq()
+			r.NoError(err)
+			r.EqualValues(margaret.SeqEmpty, seq, "index not reset")
+
+			g, err := b.Build()
+			r.NoError(err)
+			r.Equal(0, g.Nodes().Len(), "relations left after reset")
+
+			resume(t, b)
+		})
+	}
+
+	cancel()
+	r.NoError(uf.Close())
+	for err := range ufErrc {
+		r.NoError(err)
+	}
+}
@@ -0,0 +1,74 @@
+// SPDX-FileCopyrightText: 2021 The Go-SSB Authors
+//
+// SPDX-License-Identifier: MIT
+
+package graph
+
+import (
+	"sort"
+
+	refs "github.com/ssbc/go-ssb-refs"
+	"gonum.org/v1/gonum/graph"
+)
+
+// Components returns the weakly-connected components of the follow graph, largest first.
+// The direction of a follow doesn't matter and blocks and metafeed edges are ignored,
+// so feeds which are only blocked or not followed by anyone end up in a component of their own.
+// Components of the same size are sorted by their first feed and the feeds of each component by their sigil.
+func (g *Graph) Components() [][]refs.FeedRef {
+	g.Mutex.Lock()
+	defer g.Mutex.Unlock()
+
+	isFollow := func(from, to int64) bool {
+		edg := g.WeightedEdge(from, to)
+		return edg != nil && edg.Weight() == 1
+	}
+
+	var (
+		components [][]refs.FeedRef
+		seen       = make(map[int64]struct{})
+	)
+
+	nodes := g.Nodes()
+	for nodes.Next() {
+		start := nodes.Node().ID()
+		if _, has := seen[start]; has {
+			continue
+		}
+		seen[start] = struct{}{}
+
+		var component []refs.FeedRef
+		queue := []int64{start}
+		for len(queue) > 0 {
+			id := queue[0]
+			queue = queue[1:]
+			component = append(component, g.Node(id).(*contactNode).feed)
+
+			visit := func(neighbours graph.Nodes, followed func(other int64) bool) {
+				for neighbours.Next() {
+					other := neighbours.Node().ID()
+					if _, has := seen[other]; has || !followed(other) {
+						continue
+					}
+					seen[other] = struct{}{}
+					queue = append(queue, other)
+				}
+			}
+			visit(g.From(id), func(other int64) bool { return isFollow(id, other) })
+			visit(g.To(id), func(other int64) bool { return isFollow(other, id) })
+		}
+
+		sort.Slice(component, func(i, j int) bool {
+			return component[i].String() < component[j].String()
+		})
+		components = append(components, component)
+	}
+
+	sort.Slice(components, func(i, j int) bool {
+		if li, lj := len(components[i]), len(components[j]); li != lj {
+			return li > lj
+		}
+		return components[i][0].String() < components[j][0].String()
+	})
+	return components
+}
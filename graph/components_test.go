@@ -0,0 +1,72 @@
+// SPDX-FileCopyrightText: 2021 The Go-SSB Authors
+//
+// SPDX-License-Identifier: MIT
+
+package graph
+
+import (
+	"encoding/json"
+	"sort"
+	"testing"
+
+	refs "github.com/ssbc/go-ssb-refs"
+	"github.com/stretchr/testify/require"
+)
+
+func TestComponents(t *testing.T) {
+	r := require.New(t)
+
+	var feeds []refs.FeedRef
+	for i := 0; i < 7; i++ {
+		feeds = append(feeds, testIncrementalFeed(t, i))
+	}
+
+	// two triangles (0,1,2) and (3,4,5), with follows in one direction only.
+	// 6 is only blocked, which doesn't connect it to anything
+	edges := map[int]map[int]int{
+		0: {1: jsFollow},
+		1: {2: jsFollow},
+		2: {0: jsFollow, 6: jsBlock},
+		3: {4: jsFollow, 5: jsFollow},
+		5: {4: jsFollow, 1: jsBlock},
+	}
+	jsGraph := make(map[string]map[string]int)
+	for from, tos := range edges {
+		jsGraph[feeds[from].Sigil()] = make(map[string]int)
+		for to, state := range tos {
+			jsGraph[feeds[from].Sigil()][feeds[to].Sigil()] = state
+		}
+	}
+	data, err := json.Marshal(jsGraph)
+	r.NoError(err)
+	g, err := UnmarshalJS(data)
+	r.NoError(err)
+
+	components := g.Components()
+	r.Len(components, 3)
+	r.Len(components[0], 3)
+	r.Len(components[1], 3)
+	r.Equal([]refs.FeedRef{feeds[6]}, components[2])
+
+	var triangles [][]string
+	for _, c := range components[:2] {
+		var sigils []string
+		for _, f := range c {
+			sigils = append(sigils, f.Sigil())
+		}
+		triangles = append(triangles, sigils)
+	}
+	r.Contains(triangles, sortedSigils(feeds[0], feeds[1], feeds[2]))
+	r.Contains(triangles, sortedSigils(feeds[3], feeds[4], feeds[5]))
+
+	r.Empty(NewGraph().Components())
+}
+
+func sortedSigils(feeds ...refs.FeedRef) []string {
+	var sigils []string
+	for _, f := range feeds {
+		sigils = append(sigils, f.Sigil())
+	}
+	sort.Strings(sigils)
+	return sigils
+}
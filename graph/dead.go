@@ -0,0 +1,70 @@
+// SPDX-FileCopyrightText: 2021 The Go-SSB Authors
+//
+// SPDX-License-Identifier: MIT
+
+package graph
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	refs "github.com/ssbc/go-ssb-refs"
+
+	"github.com/ssbc/go-ssb/indexes"
+)
+
+// Activity looks up how many messages of a feed are stored and when it published them, like indexes.ActivityIndex.
+type Activity interface {
+	Activity(feed refs.FeedRef) (indexes.FeedActivity, error)
+}
+
+// DeadFeeds returns the feeds which could be dropped by me: the ones which didn't publish anything for longer than olderThan
+// and are at least minHops away from me. Like for ShouldReplicate, direct follows are 0 hops away and they are never returned.
+// Feeds which can't be reached from me count as far away. Feeds of which nothing is stored are left out, there is nothing to drop.
+// The feeds are sorted.
+func (g *Graph) DeadFeeds(me refs.FeedRef, activity Activity, olderThan time.Duration, minHops int) ([]refs.FeedRef, error) {
+	distLookup, err := g.MakeDijkstra(me)
+	if err != nil {
+		return nil, err
+	}
+
+	g.Mutex.Lock()
+	var far []refs.FeedRef
+	for _, node := range g.lookup {
+		if node.feed.Equal(me) {
+			continue
+		}
+		p, d := distLookup.dijk.To(node.ID())
+		hops, ok := withinHops(p, d, math.MaxInt32)
+		if ok && hops < minHops {
+			continue
+		}
+		far = append(far, node.feed)
+	}
+	g.Mutex.Unlock()
+
+	cutoff := time.Now().Add(-olderThan)
+	var dead []refs.FeedRef
+	for _, feed := range far {
+		// a direct follow is 0 hops away, but check in case minHops is negative
+		if g.Follows(me, feed) {
+			continue
+		}
+
+		fa, err := activity.Activity(feed)
+		if err != nil {
+			return nil, fmt.Errorf("graph: failed to get activity of %s: %w", feed.ShortSigil(), err)
+		}
+		if fa.Count == 0 || !fa.Last.Before(cutoff) {
+			continue
+		}
+		dead = append(dead, feed)
+	}
+
+	sort.Slice(dead, func(i, j int) bool {
+		return dead[i].String() < dead[j].String()
+	})
+	return dead, nil
+}
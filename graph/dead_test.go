@@ -0,0 +1,99 @@
+// SPDX-FileCopyrightText: 2021 The Go-SSB Authors
+//
+// SPDX-License-Identifier: MIT
+
+package graph
+
+import (
+	"sort"
+	"testing"
+	"time"
+
+	refs "github.com/ssbc/go-ssb-refs"
+	"github.com/stretchr/testify/require"
+	"gonum.org/v1/gonum/graph/simple"
+
+	"github.com/ssbc/go-ssb/indexes"
+	"github.com/ssbc/go-ssb/internal/storedrefs"
+)
+
+// testActivity maps feeds to the time of their latest message
+type testActivity map[string]time.Time
+
+func (ta testActivity) Activity(feed refs.FeedRef) (indexes.FeedActivity, error) {
+	last, has := ta[feed.String()]
+	if !has {
+		return indexes.FeedActivity{Feed: feed}, nil
+	}
+	return indexes.FeedActivity{Feed: feed, Count: 1, First: last, Last: last}, nil
+}
+
+func TestDeadFeeds(t *testing.T) {
+	r := require.New(t)
+
+	// me follows a, which follows b, which follows c, which follows d.
+	// e isn't connected to me at all.
+	const me, a, b, c, d, e = 0, 1, 2, 3, 4, 5
+	gr := NewGraph()
+	var feeds []refs.FeedRef
+	for i := 0; i < 6; i++ {
+		feed := testIncrementalFeed(t, i)
+		feeds = append(feeds, feed)
+		node := &contactNode{gr.NewNode(), feed, ""}
+		gr.AddNode(node)
+		gr.lookup[storedrefs.Feed(feed)] = node
+	}
+	follow := func(from, to int) {
+		gr.SetWeightedEdge(contactEdge{
+			WeightedEdge: simple.WeightedEdge{
+				F: gr.lookup[storedrefs.Feed(feeds[from])],
+				T: gr.lookup[storedrefs.Feed(feeds[to])],
+				W: 1,
+			},
+		})
+	}
+	follow(me, a)
+	follow(a, b)
+	follow(b, c)
+	follow(c, d)
+
+	now := time.Now()
+	stale := now.Add(-90 * 24 * time.Hour)
+	activity := testActivity{
+		feeds[me].String(): stale,
+		feeds[a].String():  stale, // a stale direct follow
+		feeds[b].String():  now,
+		feeds[c].String():  stale, // a stale feed, 2 hops away
+		feeds[e].String():  stale, // a stale feed that can't be reached
+		// nothing is stored of d
+	}
+
+	dead, err := gr.DeadFeeds(feeds[me], activity, 30*24*time.Hour, 2)
+	r.NoError(err)
+	r.Equal(sortedFeeds(feeds[c], feeds[e]), dead)
+
+	// the direct follow is never included
+	dead, err = gr.DeadFeeds(feeds[me], activity, 30*24*time.Hour, 0)
+	r.NoError(err)
+	r.Equal(sortedFeeds(feeds[c], feeds[e]), dead)
+
+	// c is too close
+	dead, err = gr.DeadFeeds(feeds[me], activity, 30*24*time.Hour, 3)
+	r.NoError(err)
+	r.Equal([]refs.FeedRef{feeds[e]}, dead)
+
+	// and not old enough
+	dead, err = gr.DeadFeeds(feeds[me], activity, 180*24*time.Hour, 0)
+	r.NoError(err)
+	r.Empty(dead)
+
+	_, err = gr.DeadFeeds(testIncrementalFeed(t, 99), activity, time.Hour, 0)
+	r.Error(err, "unknown feed")
+}
+
+func sortedFeeds(feeds ...refs.FeedRef) []refs.FeedRef {
+	sort.Slice(feeds, func(i, j int) bool {
+		return feeds[i].String() < feeds[j].String()
+	})
+	return feeds
+}
@@ -0,0 +1,72 @@
+// SPDX-FileCopyrightText: 2021 The Go-SSB Authors
+//
+// SPDX-License-Identifier: MIT
+
+package graph
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBuilderDebounce(t *testing.T) {
+	r := require.New(t)
+
+	const debounce = 500 * time.Millisecond
+	tc := makeBadgerWithOptions(t, WithDebounce(debounce))
+
+	alice := tc.newPublisher(t)
+	bob := tc.newPublisher(t)
+	alice.follow(bob.key.ID())
+
+	r.Eventually(func() bool {
+		g, err := tc.gbuilder.Build()
+		r.NoError(err)
+		return g.Follows(alice.key.ID(), bob.key.ID())
+	}, 5*time.Second, 10*time.Millisecond)
+	before, err := tc.gbuilder.Build()
+	r.NoError(err)
+
+	// a burst of contacts, querying the graph in between.
+	// Build waits until the indexes are synced, so it isn't called for each of them to keep the test fast.
+	const n = 100
+	followed := make([]*publisher, n)
+	built := make(map[*Graph]struct{})
+	for i := 0; i < n; i++ {
+		followed[i] = tc.newPublisher(t)
+		alice.follow(followed[i].key.ID())
+		if i%10 != 9 {
+			continue
+		}
+
+		g, err := tc.gbuilder.Build()
+		r.NoError(err)
+		built[g] = struct{}{}
+		r.Equal(g.Version(), tc.gbuilder.CurrentVersion(), "the version doesn't match the snapshot")
+		r.True(g.Follows(alice.key.ID(), bob.key.ID()))
+	}
+	r.LessOrEqual(len(built), 2, "the graph was built for too many updates")
+	_, has := built[before]
+	r.True(has, "the snapshot from before the burst wasn't used")
+
+	// once the updates stop, the graph is built again with all of them
+	var after *Graph
+	r.Eventually(func() bool {
+		after, err = tc.gbuilder.Build()
+		r.NoError(err)
+		return after.Follows(alice.key.ID(), followed[n-1].key.ID())
+	}, 10*time.Second, 50*time.Millisecond)
+	for _, p := range followed {
+		r.True(after.Follows(alice.key.ID(), p.key.ID()))
+	}
+	r.Greater(after.Version(), before.Version())
+	r.Equal(after.Version(), tc.gbuilder.CurrentVersion())
+
+	// explicit changes aren't debounced
+	r.NoError(tc.gbuilder.DeleteAuthor(alice.key.ID()))
+	g, err := tc.gbuilder.Build()
+	r.NoError(err)
+	r.False(g.Follows(alice.key.ID(), bob.key.ID()))
+}
@@ -38,6 +38,55 @@ var deleteScenarios = []PeopleTestCase{
 			PeopleAssertAuthorize("alice", "claire", 1, false),
 		},
 	},
+
+	{
+		name: "forget bob",
+		ops: append(forgetPeople(),
+			PeopleOpForget{"bob"},
+
+			// brings bob back into the graph, but none of the forgotten relations
+			PeopleOpFollow{"bob", "claire"},
+		),
+		asserts: []PeopleAssertMaker{
+			PeopleAssertFollows("alice", "bob", false),
+			PeopleAssertFollows("bob", "claire", true),
+			PeopleAssertFollows("bob", "dee", false),
+			PeopleAssertPathDist("alice", "dee", 2),
+			PeopleAssertHops("alice", 0, "claire"),
+		},
+	},
+
+	{
+		name: "forget bob and follow again",
+		ops: append(forgetPeople(),
+			PeopleOpForget{"bob"},
+			PeopleOpFollow{"alice", "bob"},
+		),
+		asserts: []PeopleAssertMaker{
+			PeopleAssertFollows("alice", "bob", true),
+			PeopleAssertFollows("bob", "dee", false),
+			PeopleAssertPathDist("alice", "bob", 0),
+			PeopleAssertPathDist("alice", "dee", 2),
+		},
+	},
+}
+
+// forgetPeople sets up a short path from alice to dee through bob and a longer one through claire and eve
+func forgetPeople() []PeopleOp {
+	return []PeopleOp{
+		PeopleOpNewPeer{"alice"},
+		PeopleOpNewPeer{"bob"},
+		PeopleOpNewPeer{"claire"},
+		PeopleOpNewPeer{"dee"},
+		PeopleOpNewPeer{"eve"},
+
+		PeopleOpFollow{"alice", "bob"},
+		PeopleOpFollow{"bob", "dee"},
+
+		PeopleOpFollow{"alice", "claire"},
+		PeopleOpFollow{"claire", "eve"},
+		PeopleOpFollow{"eve", "dee"},
+	}
 }
 
 type PeopleOpDeleteAuthor struct {
@@ -52,3 +101,15 @@ func (op PeopleOpDeleteAuthor) Op(state *testState) error {
 	err := state.store.gbuilder.DeleteAuthor(who.key.ID())
 	return err
 }
+
+type PeopleOpForget struct {
+	who string
+}
+
+func (op PeopleOpForget) Op(state *testState) error {
+	who, ok := state.peers[op.who]
+	if !ok {
+		return fmt.Errorf("forget: no such who %s", op.who)
+	}
+	return state.store.gbuilder.Forget(who.key.ID())
+}
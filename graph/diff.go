@@ -0,0 +1,120 @@
+// SPDX-FileCopyrightText: 2021 The Go-SSB Authors
+//
+// SPDX-License-Identifier: MIT
+
+package graph
+
+import (
+	"math"
+	"sort"
+
+	refs "github.com/ssbc/go-ssb-refs"
+	librarian "github.com/ssbc/margaret/indexes"
+	"gonum.org/v1/gonum/graph"
+
+	"github.com/ssbc/go-ssb/internal/storedrefs"
+)
+
+// FeedPair is a directed relation between two feeds, like a follow from From to To.
+type FeedPair struct {
+	From, To refs.FeedRef
+}
+
+// GraphDelta is the difference between two graphs, as returned by Diff.
+// Each list is sorted by the From and then the To feed.
+type GraphDelta struct {
+	AddedFollows   []FeedPair
+	RemovedFollows []FeedPair
+	AddedBlocks    []FeedPair
+	RemovedBlocks  []FeedPair
+}
+
+// Empty returns true if the two graphs had the same follows and blocks.
+func (d GraphDelta) Empty() bool {
+	return len(d.AddedFollows) == 0 &&
+		len(d.RemovedFollows) == 0 &&
+		len(d.AddedBlocks) == 0 &&
+		len(d.RemovedBlocks) == 0
+}
+
+// Diff returns the follows and blocks which are in new but not in old and the other way around.
+// A follow that turned into a block shows up as a removed follow and an added block.
+// Like MarshalJS, it ignores the edges between metafeeds and their subfeeds.
+// Both graphs are read once, apart from sorting the changes it takes time linear in the number of edges.
+func Diff(old, new *Graph) GraphDelta {
+	oldEdges := old.relations()
+	newEdges := new.relations()
+
+	var d GraphDelta
+	for key, rel := range newEdges {
+		if oldRel, has := oldEdges[key]; has && oldRel.block == rel.block {
+			continue
+		}
+		if rel.block {
+			d.AddedBlocks = append(d.AddedBlocks, rel.FeedPair)
+		} else {
+			d.AddedFollows = append(d.AddedFollows, rel.FeedPair)
+		}
+	}
+	for key, rel := range oldEdges {
+		if newRel, has := newEdges[key]; has && newRel.block == rel.block {
+			continue
+		}
+		if rel.block {
+			d.RemovedBlocks = append(d.RemovedBlocks, rel.FeedPair)
+		} else {
+			d.RemovedFollows = append(d.RemovedFollows, rel.FeedPair)
+		}
+	}
+
+	sortFeedPairs(d.AddedFollows)
+	sortFeedPairs(d.RemovedFollows)
+	sortFeedPairs(d.AddedBlocks)
+	sortFeedPairs(d.RemovedBlocks)
+	return d
+}
+
+type relation struct {
+	FeedPair
+	block bool
+}
+
+// relations returns the follows and blocks of the graph by the stored addresses of their feeds
+func (g *Graph) relations() map[[2]librarian.Addr]relation {
+	g.Mutex.Lock()
+	defer g.Mutex.Unlock()
+
+	rels := make(map[[2]librarian.Addr]relation)
+	for fromAddr, node := range g.lookup {
+		edgs := g.From(node.ID())
+		for edgs.Next() {
+			nTo := edgs.Node().(*contactNode)
+			edg := g.Edge(node.ID(), nTo.ID()).(graph.WeightedEdge)
+
+			var block bool
+			switch w := edg.Weight(); {
+			case w == 1:
+			case math.IsInf(w, 1):
+				block = true
+			default:
+				continue
+			}
+
+			rels[[2]librarian.Addr{fromAddr, storedrefs.Feed(nTo.feed)}] = relation{
+				FeedPair: FeedPair{From: node.feed, To: nTo.feed},
+				block:    block,
+			}
+		}
+	}
+	return rels
+}
+
+func sortFeedPairs(pairs []FeedPair) {
+	sort.Slice(pairs, func(i, j int) bool {
+		fi, fj := pairs[i].From.Sigil(), pairs[j].From.Sigil()
+		if fi != fj {
+			return fi < fj
+		}
+		return pairs[i].To.Sigil() < pairs[j].To.Sigil()
+	})
+}
@@ -0,0 +1,80 @@
+// SPDX-FileCopyrightText: 2021 The Go-SSB Authors
+//
+// SPDX-License-Identifier: MIT
+
+package graph
+
+import (
+	"encoding/json"
+	"testing"
+
+	refs "github.com/ssbc/go-ssb-refs"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiff(t *testing.T) {
+	r := require.New(t)
+
+	var feeds []refs.FeedRef
+	for i := 0; i < 5; i++ {
+		feeds = append(feeds, testIncrementalFeed(t, i))
+	}
+
+	makeGraph := func(edges map[int]map[int]int) *Graph {
+		jsGraph := make(map[string]map[string]int)
+		for from, tos := range edges {
+			jsGraph[feeds[from].Sigil()] = make(map[string]int)
+			for to, state := range tos {
+				jsGraph[feeds[from].Sigil()][feeds[to].Sigil()] = state
+			}
+		}
+		data, err := json.Marshal(jsGraph)
+		r.NoError(err)
+		g, err := UnmarshalJS(data)
+		r.NoError(err)
+		return g
+	}
+
+	old := makeGraph(map[int]map[int]int{
+		0: {1: jsFollow, 2: jsFollow},
+		1: {0: jsFollow},
+		3: {4: jsBlock},
+	})
+	// 2 followed 0, 3 blocked 1
+	updated := makeGraph(map[int]map[int]int{
+		0: {1: jsFollow, 2: jsFollow},
+		1: {0: jsFollow},
+		2: {0: jsFollow},
+		3: {1: jsBlock, 4: jsBlock},
+	})
+
+	d := Diff(old, updated)
+	r.Equal(GraphDelta{
+		AddedFollows: []FeedPair{{From: feeds[2], To: feeds[0]}},
+		AddedBlocks:  []FeedPair{{From: feeds[3], To: feeds[1]}},
+	}, d)
+
+	// the other way around
+	d = Diff(updated, old)
+	r.Equal(GraphDelta{
+		RemovedFollows: []FeedPair{{From: feeds[2], To: feeds[0]}},
+		RemovedBlocks:  []FeedPair{{From: feeds[3], To: feeds[1]}},
+	}, d)
+
+	r.True(Diff(updated, updated).Empty())
+
+	// a follow turns into a block, another one is dropped
+	changed := makeGraph(map[int]map[int]int{
+		0: {1: jsBlock, 2: jsUnfollow},
+		1: {0: jsFollow},
+		2: {0: jsFollow},
+		3: {1: jsBlock, 4: jsBlock},
+	})
+	d = Diff(updated, changed)
+	r.Nil(d.AddedFollows)
+	r.Nil(d.RemovedBlocks)
+	r.Equal([]FeedPair{{From: feeds[0], To: feeds[1]}}, d.AddedBlocks)
+	wantRemoved := []FeedPair{{From: feeds[0], To: feeds[1]}, {From: feeds[0], To: feeds[2]}}
+	sortFeedPairs(wantRemoved)
+	r.Equal(wantRemoved, d.RemovedFollows)
+}
@@ -24,15 +24,37 @@ type Graph struct {
 	sync.Mutex
 	*simple.WeightedDirectedGraph
 	lookup key2node
+
+	replicationHops int
+
+	// used by TrustScore
+	trustHops  int
+	trustDecay float64
+
+	// used by Centrality
+	centralityDamping float64
+
+	version int64
 }
 
 func NewGraph() *Graph {
 	return &Graph{
 		WeightedDirectedGraph: simple.NewWeightedDirectedGraph(0, math.Inf(1)),
 		lookup:                make(key2node),
+		replicationHops:       DefaultReplicationHops,
+		trustHops:             DefaultAuthHops,
+		trustDecay:            DefaultTrustDecay,
+		centralityDamping:     DefaultCentralityDamping,
 	}
 }
 
+// Version returns the root log sequence of the latest message that changed the graph before it was built.
+// Two graphs from the same Builder with equal versions have identical contents.
+// Versions only go up, also when the Builder is opened again on the same database.
+func (g *Graph) Version() int64 {
+	return g.version
+}
+
 func (g *Graph) getNode(feed refs.FeedRef) (*contactNode, bool) {
 	node, has := g.lookup[storedrefs.Feed(feed)]
 	if !has {
@@ -105,6 +127,62 @@ func (g *Graph) BlockedList(from refs.FeedRef) *ssb.StrFeedSet {
 	return blocked
 }
 
+// BlockedBy returns all the feeds which currently block to.
+// Like the rest of the graph, only the latest contact message of each feed about to counts.
+func (g *Graph) BlockedBy(to refs.FeedRef) *ssb.StrFeedSet {
+	g.Mutex.Lock()
+	defer g.Mutex.Unlock()
+	blockers := ssb.NewFeedSet(0)
+	nTo, has := g.lookup[storedrefs.Feed(to)]
+	if !has {
+		return blockers
+	}
+	toID := nTo.ID()
+	edgs := g.To(toID)
+	for edgs.Next() {
+		nFrom := edgs.Node()
+		edg := g.Edge(nFrom.ID(), toID).(graph.WeightedEdge)
+		if math.IsInf(edg.Weight(), 1) {
+			ctNode := nFrom.(*contactNode)
+			blockers.AddRef(ctNode.feed)
+		}
+	}
+	return blockers
+}
+
+// MutualBlocks returns all the pairs of feeds which block each other.
+// Each pair is listed once, with the feed whose reference sorts first as From. The pairs are sorted like the ones of a GraphDelta.
+// Apart from sorting the result, it takes time linear in the number of edges.
+func (g *Graph) MutualBlocks() []FeedPair {
+	g.Mutex.Lock()
+	defer g.Mutex.Unlock()
+
+	var pairs []FeedPair
+	for _, nFrom := range g.lookup {
+		fromID := nFrom.ID()
+		edgs := g.From(fromID)
+		for edgs.Next() {
+			nTo := edgs.Node().(*contactNode)
+			// only look at each pair from one side
+			if nFrom.feed.Sigil() >= nTo.feed.Sigil() {
+				continue
+			}
+
+			edg := g.Edge(fromID, nTo.ID()).(graph.WeightedEdge)
+			if !math.IsInf(edg.Weight(), 1) {
+				continue
+			}
+			back := g.Edge(nTo.ID(), fromID)
+			if back == nil || !math.IsInf(back.(graph.WeightedEdge).Weight(), 1) {
+				continue
+			}
+			pairs = append(pairs, FeedPair{From: nFrom.feed, To: nTo.feed})
+		}
+	}
+	sortFeedPairs(pairs)
+	return pairs
+}
+
 func (g *Graph) MakeDijkstra(from refs.FeedRef) (*Lookup, error) {
 	g.Mutex.Lock()
 	defer g.Mutex.Unlock()
@@ -113,7 +191,36 @@ func (g *Graph) MakeDijkstra(from refs.FeedRef) (*Lookup, error) {
 		return nil, ErrNoSuchFrom{Who: from}
 	}
 	return &Lookup{
-		path.DijkstraFrom(nFrom, g),
-		g.lookup,
+		dijk:   path.DijkstraFrom(nFrom, g),
+		lookup: g.lookup,
 	}, nil
 }
+
+// ReplicationSet returns all the feeds which are at most the configured replication hops away from from.
+// Like the authorizer, it counts direct follows as distance 0 and skips feeds that can only be reached through a block.
+func (g *Graph) ReplicationSet(from refs.FeedRef) (*ssb.StrFeedSet, error) {
+	distLookup, err := g.MakeDijkstra(from)
+	if err != nil {
+		return nil, err
+	}
+
+	g.Mutex.Lock()
+	defer g.Mutex.Unlock()
+
+	set := ssb.NewFeedSet(0)
+	for _, node := range g.lookup {
+		if node.feed.Equal(from) {
+			continue
+		}
+
+		p, d := distLookup.dijk.To(node.ID())
+		if _, ok := withinHops(p, d, g.replicationHops); !ok {
+			continue
+		}
+
+		if err := set.AddRef(node.feed); err != nil {
+			return nil, err
+		}
+	}
+	return set, nil
+}
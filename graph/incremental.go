@@ -0,0 +1,328 @@
+// SPDX-FileCopyrightText: 2021 The Go-SSB Authors
+//
+// SPDX-License-Identifier: MIT
+
+package graph
+
+import (
+	"container/heap"
+	"math"
+	"sync"
+
+	refs "github.com/ssbc/go-ssb-refs"
+	"gonum.org/v1/gonum/graph"
+	"gonum.org/v1/gonum/graph/simple"
+
+	"github.com/ssbc/go-ssb/internal/storedrefs"
+)
+
+// DefaultRecomputeRatio is the share of nodes an update can invalidate before IncrementalLookup recomputes all distances.
+const DefaultRecomputeRatio = 0.25
+
+// IncrementalLookup keeps the distances from one feed up to date while follows, blocks and unfollows are applied to the graph.
+// Instead of running Dijkstra over the whole graph after each change, it only updates the feeds whose distance changed.
+// Adding a follow only walks the feeds that got closer. Removing an edge of a shortest path invalidates the feeds that were reached through it
+// and only those are computed again, unless they are more than RecomputeRatio of the graph. Then all distances are computed again.
+//
+// Once it is made, all changes to the graph need to go through it. Use Lookup to query the distances.
+type IncrementalLookup struct {
+	// RecomputeRatio is the share of nodes an update can invalidate before all distances are computed again.
+	RecomputeRatio float64
+
+	mu sync.Mutex
+
+	g      *Graph
+	source int64
+
+	dist   map[int64]float64
+	parent map[int64]int64
+
+	// recomputes counts the full recomputations, for testing
+	recomputes int
+}
+
+// MakeIncremental returns a lookup for the distances from from which can be updated.
+func (g *Graph) MakeIncremental(from refs.FeedRef) (*IncrementalLookup, error) {
+	g.Mutex.Lock()
+	defer g.Mutex.Unlock()
+	nFrom, has := g.lookup[storedrefs.Feed(from)]
+	if !has {
+		return nil, ErrNoSuchFrom{Who: from}
+	}
+
+	il := &IncrementalLookup{
+		RecomputeRatio: DefaultRecomputeRatio,
+
+		g:      g,
+		source: nFrom.ID(),
+	}
+	il.recompute()
+	return il, nil
+}
+
+// Lookup returns a distance lookup which always answers with the current distances.
+func (il *IncrementalLookup) Lookup() *Lookup {
+	return &Lookup{inc: il}
+}
+
+// Follow adds or changes the edge between from and to to a follow and updates the distances.
+func (il *IncrementalLookup) Follow(from, to refs.FeedRef) {
+	il.setEdge(from, to, 1, false)
+}
+
+// Block adds or changes the edge between from and to to a block and updates the distances.
+func (il *IncrementalLookup) Block(from, to refs.FeedRef) {
+	il.setEdge(from, to, math.Inf(1), true)
+}
+
+// Unfollow removes the edge between from and to and updates the distances.
+func (il *IncrementalLookup) Unfollow(from, to refs.FeedRef) {
+	il.mu.Lock()
+	defer il.mu.Unlock()
+	il.g.Mutex.Lock()
+	defer il.g.Mutex.Unlock()
+
+	nFrom, hasFrom := il.g.lookup[storedrefs.Feed(from)]
+	nTo, hasTo := il.g.lookup[storedrefs.Feed(to)]
+	if !hasFrom || !hasTo || !il.g.HasEdgeFromTo(nFrom.ID(), nTo.ID()) {
+		return
+	}
+
+	il.g.RemoveEdge(nFrom.ID(), nTo.ID())
+	il.increased(nFrom.ID(), nTo.ID())
+}
+
+func (il *IncrementalLookup) setEdge(from, to refs.FeedRef, w float64, isBlock bool) {
+	il.mu.Lock()
+	defer il.mu.Unlock()
+	il.g.Mutex.Lock()
+	defer il.g.Mutex.Unlock()
+
+	nFrom := il.getOrAddNode(from)
+	nTo := il.getOrAddNode(to)
+	if nFrom.ID() == nTo.ID() {
+		return
+	}
+
+	oldW := math.Inf(1)
+	if edg := il.g.WeightedEdge(nFrom.ID(), nTo.ID()); edg != nil {
+		oldW = edg.Weight()
+	}
+
+	il.g.SetWeightedEdge(contactEdge{
+		WeightedEdge: simple.WeightedEdge{F: nFrom, T: nTo, W: w},
+		isBlock:      isBlock,
+	})
+
+	switch {
+	case w < oldW:
+		il.decreased(nFrom.ID(), nTo.ID(), w)
+	case w > oldW:
+		il.increased(nFrom.ID(), nTo.ID())
+	}
+}
+
+func (il *IncrementalLookup) getOrAddNode(feed refs.FeedRef) *contactNode {
+	addr := storedrefs.Feed(feed)
+	node, has := il.g.lookup[addr]
+	if !has {
+		node = &contactNode{il.g.NewNode(), feed, ""}
+		il.g.AddNode(node)
+		il.g.lookup[addr] = node
+	}
+	return node
+}
+
+func (il *IncrementalLookup) distTo(id int64) float64 {
+	d, has := il.dist[id]
+	if !has {
+		return math.Inf(1)
+	}
+	return d
+}
+
+// decreased handles a new edge or one that got cheaper: only the feeds which are now closer are visited.
+func (il *IncrementalLookup) decreased(u, v int64, w float64) {
+	cand := il.distTo(u) + w
+	if !(cand < il.distTo(v)) {
+		return
+	}
+	il.dist[v] = cand
+	il.parent[v] = u
+
+	q := &distQueue{{id: v, dist: cand}}
+	il.relax(q)
+}
+
+// increased handles a removed edge or one that got more expensive.
+// If it wasn't part of a shortest path, nothing changes.
+// Otherwise the feeds reached through it are computed again, from the edges that lead to them from the rest of the graph.
+func (il *IncrementalLookup) increased(u, v int64) {
+	if p, has := il.parent[v]; !has || p != u {
+		return
+	}
+
+	// the feeds whose shortest path went through the edge
+	affected := map[int64]struct{}{v: {}}
+	stack := []int64{v}
+	for len(stack) > 0 {
+		x := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+
+		children := il.g.From(x)
+		for children.Next() {
+			c := children.Node().ID()
+			if p, has := il.parent[c]; has && p == x {
+				if _, seen := affected[c]; !seen {
+					affected[c] = struct{}{}
+					stack = append(stack, c)
+				}
+			}
+		}
+	}
+
+	if float64(len(affected)) > il.RecomputeRatio*float64(il.g.Nodes().Len()) {
+		il.recompute()
+		return
+	}
+
+	for x := range affected {
+		delete(il.dist, x)
+		delete(il.parent, x)
+	}
+
+	// the best way into each of them from the unaffected part of the graph
+	q := &distQueue{}
+	for x := range affected {
+		best, bestParent := math.Inf(1), int64(-1)
+
+		in := il.g.To(x)
+		for in.Next() {
+			y := in.Node().ID()
+			if _, isAffected := affected[y]; isAffected {
+				continue
+			}
+			cand := il.distTo(y) + il.g.WeightedEdge(y, x).Weight()
+			if cand < best {
+				best, bestParent = cand, y
+			}
+		}
+
+		if !math.IsInf(best, 1) {
+			il.dist[x] = best
+			il.parent[x] = bestParent
+			heap.Push(q, distItem{id: x, dist: best})
+		}
+	}
+	il.relax(q)
+}
+
+// recompute runs Dijkstra over the whole graph.
+func (il *IncrementalLookup) recompute() {
+	il.recomputes++
+	il.dist = map[int64]float64{il.source: 0}
+	il.parent = make(map[int64]int64)
+	il.relax(&distQueue{{id: il.source, dist: 0}})
+}
+
+// relax runs Dijkstra from the feeds in q, whose distances are already set.
+func (il *IncrementalLookup) relax(q *distQueue) {
+	heap.Init(q)
+	for q.Len() > 0 {
+		item := heap.Pop(q).(distItem)
+		if item.dist > il.distTo(item.id) {
+			// outdated entry
+			continue
+		}
+
+		out := il.g.From(item.id)
+		for out.Next() {
+			z := out.Node().ID()
+			w := il.g.WeightedEdge(item.id, z).Weight()
+			if math.IsInf(w, 1) {
+				continue
+			}
+
+			cand := item.dist + w
+			if cand < il.distTo(z) {
+				il.dist[z] = cand
+				il.parent[z] = item.id
+				heap.Push(q, distItem{id: z, dist: cand})
+			}
+		}
+	}
+}
+
+// To returns the shortest path to the node with the id vid and its weight, like path.Shortest.
+// If it can't be reached, the path is nil and the weight +Inf.
+func (il *IncrementalLookup) To(vid int64) ([]graph.Node, float64) {
+	il.mu.Lock()
+	defer il.mu.Unlock()
+	il.g.Mutex.Lock()
+	defer il.g.Mutex.Unlock()
+	return il.to(vid)
+}
+
+func (il *IncrementalLookup) to(vid int64) ([]graph.Node, float64) {
+	d, has := il.dist[vid]
+	if !has {
+		return nil, math.Inf(1)
+	}
+
+	var p []graph.Node
+	for id := vid; ; id = il.parent[id] {
+		p = append(p, il.g.Node(id))
+		if id == il.source {
+			break
+		}
+	}
+	for i, j := 0, len(p)-1; i < j; i, j = i+1, j-1 {
+		p[i], p[j] = p[j], p[i]
+	}
+	return p, d
+}
+
+// distFeed is Lookup.Dist for incremental lookups.
+func (il *IncrementalLookup) distFeed(to refs.FeedRef) ([]graph.Node, float64) {
+	il.mu.Lock()
+	defer il.mu.Unlock()
+	il.g.Mutex.Lock()
+	defer il.g.Mutex.Unlock()
+
+	nTo, has := il.g.lookup[storedrefs.Feed(to)]
+	if !has {
+		return nil, math.Inf(-1)
+	}
+	return il.to(nTo.ID())
+}
+
+// feeds returns all the feeds in the graph
+func (il *IncrementalLookup) feeds() []refs.FeedRef {
+	il.g.Mutex.Lock()
+	defer il.g.Mutex.Unlock()
+	feeds := make([]refs.FeedRef, 0, len(il.g.lookup))
+	for _, n := range il.g.lookup {
+		feeds = append(feeds, n.feed)
+	}
+	return feeds
+}
+
+type distItem struct {
+	id   int64
+	dist float64
+}
+
+// distQueue is a min-heap of distances
+type distQueue []distItem
+
+func (q distQueue) Len() int            { return len(q) }
+func (q distQueue) Less(i, j int) bool  { return q[i].dist < q[j].dist }
+func (q distQueue) Swap(i, j int)       { q[i], q[j] = q[j], q[i] }
+func (q *distQueue) Push(x interface{}) { *q = append(*q, x.(distItem)) }
+func (q *distQueue) Pop() interface{} {
+	old := *q
+	n := len(old)
+	item := old[n-1]
+	*q = old[:n-1]
+	return item
+}
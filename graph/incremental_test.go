@@ -0,0 +1,218 @@
+// SPDX-FileCopyrightText: 2021 The Go-SSB Authors
+//
+// SPDX-License-Identifier: MIT
+
+package graph
+
+import (
+	"encoding/binary"
+	"math"
+	"math/rand"
+	"testing"
+
+	refs "github.com/ssbc/go-ssb-refs"
+	"github.com/stretchr/testify/require"
+	"gonum.org/v1/gonum/graph/path"
+	"gonum.org/v1/gonum/graph/simple"
+
+	"github.com/ssbc/go-ssb/internal/storedrefs"
+)
+
+func TestIncrementalLookup(t *testing.T) {
+	for _, ratio := range []float64{DefaultRecomputeRatio, 0, 1} {
+		rnd := rand.New(rand.NewSource(42))
+		g, feeds := randomGraph(t, rnd, 200, 3)
+
+		il, err := g.MakeIncremental(feeds[0])
+		require.NoError(t, err)
+		il.RecomputeRatio = ratio
+		checkIncremental(t, g, il, feeds)
+
+		for i := 0; i < 500; i++ {
+			from, to := feeds[rnd.Intn(len(feeds))], feeds[rnd.Intn(len(feeds))]
+			switch op := rnd.Intn(10); {
+			case op < 5:
+				il.Follow(from, to)
+			case op < 7:
+				il.Block(from, to)
+			default:
+				// unfollow an existing edge, most of the time
+				if edge := randomEdge(g, rnd); edge != nil {
+					from, to = edge[0], edge[1]
+				}
+				il.Unfollow(from, to)
+			}
+			checkIncremental(t, g, il, feeds)
+		}
+
+		// new feeds are added to the graph
+		newFeed := testIncrementalFeed(t, len(feeds))
+		il.Follow(feeds[0], newFeed)
+		p, d := il.Lookup().Dist(newFeed)
+		require.Len(t, p, 2)
+		require.Equal(t, 1.0, d)
+
+		_, d = il.Lookup().Dist(testIncrementalFeed(t, len(feeds)+1))
+		require.True(t, math.IsInf(d, -1), "unknown feeds are -Inf away")
+
+		t.Logf("ratio %v: %d full recomputations", ratio, il.recomputes)
+	}
+}
+
+func TestIncrementalLookupFallback(t *testing.T) {
+	r := require.New(t)
+
+	// a chain a -> b -> c -> d
+	g := NewGraph()
+	var feeds []refs.FeedRef
+	for i := 0; i < 4; i++ {
+		feeds = append(feeds, testIncrementalFeed(t, i))
+	}
+	for _, f := range feeds {
+		node := &contactNode{g.NewNode(), f, ""}
+		g.AddNode(node)
+		g.lookup[storedrefs.Feed(f)] = node
+	}
+	il, err := g.MakeIncremental(feeds[0])
+	r.NoError(err)
+	r.Equal(1, il.recomputes)
+
+	for i := 0; i < 3; i++ {
+		il.Follow(feeds[i], feeds[i+1])
+	}
+	_, d := il.Lookup().Dist(feeds[3])
+	r.Equal(3.0, d)
+	r.Equal(1, il.recomputes, "adding edges doesn't recompute")
+
+	// removing the last edge only invalidates d
+	il.Unfollow(feeds[2], feeds[3])
+	r.Equal(1, il.recomputes)
+	_, d = il.Lookup().Dist(feeds[3])
+	r.True(math.IsInf(d, 1))
+
+	// removing the first one invalidates b and c, more than a quarter
+	il.Unfollow(feeds[0], feeds[1])
+	r.Equal(2, il.recomputes)
+	_, d = il.Lookup().Dist(feeds[2])
+	r.True(math.IsInf(d, 1))
+
+	// a block on a shortest path is like a removal
+	il.Follow(feeds[0], feeds[1])
+	il.Follow(feeds[0], feeds[2])
+	il.Follow(feeds[1], feeds[3])
+	il.Follow(feeds[2], feeds[3])
+	_, d = il.Lookup().Dist(feeds[3])
+	r.Equal(2.0, d)
+	il.Block(feeds[0], feeds[1])
+	checkIncremental(t, g, il, feeds)
+	p, d := il.Lookup().Dist(feeds[3])
+	r.Equal(2.0, d)
+	r.Len(p, 3)
+	r.Equal(feeds[2], p[1].(*contactNode).feed)
+}
+
+func BenchmarkIncrementalFollow(b *testing.B) {
+	rnd := rand.New(rand.NewSource(42))
+	g, feeds := randomGraph(b, rnd, 5000, 10)
+
+	il, err := g.MakeIncremental(feeds[0])
+	require.NoError(b, err)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		from, to := feeds[rnd.Intn(len(feeds))], feeds[rnd.Intn(len(feeds))]
+		il.Follow(from, to)
+		il.Unfollow(from, to)
+	}
+}
+
+func BenchmarkFullDijkstra(b *testing.B) {
+	rnd := rand.New(rand.NewSource(42))
+	g, feeds := randomGraph(b, rnd, 5000, 10)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, err := g.MakeDijkstra(feeds[0])
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// checkIncremental compares all distances of il to the ones of a full Dijkstra run and makes sure the paths are valid.
+func checkIncremental(t testing.TB, g *Graph, il *IncrementalLookup, feeds []refs.FeedRef) {
+	src := g.lookup[storedrefs.Feed(feeds[0])]
+	full := path.DijkstraFrom(src, g)
+
+	lookup := il.Lookup()
+	for _, f := range feeds {
+		node := g.lookup[storedrefs.Feed(f)]
+		_, want := full.To(node.ID())
+
+		p, got := lookup.Dist(f)
+		if math.IsInf(want, 1) {
+			require.True(t, math.IsInf(got, 1), "%s: expected +Inf, got %v", f.ShortSigil(), got)
+			require.Nil(t, p)
+			continue
+		}
+		require.InDelta(t, want, got, 1e-9, "%s: wrong distance", f.ShortSigil())
+
+		require.Equal(t, src.ID(), p[0].ID())
+		require.Equal(t, node.ID(), p[len(p)-1].ID())
+		var sum float64
+		for i := 1; i < len(p); i++ {
+			edg := g.WeightedEdge(p[i-1].ID(), p[i].ID())
+			require.NotNil(t, edg, "path uses a missing edge")
+			sum += edg.Weight()
+		}
+		require.InDelta(t, got, sum, 1e-9)
+	}
+}
+
+// randomGraph makes a graph of n feeds with degree random follows each
+func randomGraph(t testing.TB, rnd *rand.Rand, n, degree int) (*Graph, []refs.FeedRef) {
+	g := NewGraph()
+	feeds := make([]refs.FeedRef, n)
+	for i := range feeds {
+		feeds[i] = testIncrementalFeed(t, i)
+		node := &contactNode{g.NewNode(), feeds[i], ""}
+		g.AddNode(node)
+		g.lookup[storedrefs.Feed(feeds[i])] = node
+	}
+
+	for i := range feeds {
+		from := g.lookup[storedrefs.Feed(feeds[i])]
+		for j := 0; j < degree; j++ {
+			to := g.lookup[storedrefs.Feed(feeds[rnd.Intn(n)])]
+			if from.ID() == to.ID() {
+				continue
+			}
+			g.SetWeightedEdge(contactEdge{WeightedEdge: simple.WeightedEdge{F: from, T: to, W: 1}})
+		}
+	}
+	return g, feeds
+}
+
+func randomEdge(g *Graph, rnd *rand.Rand) []refs.FeedRef {
+	edges := g.Edges()
+	n := edges.Len()
+	if n == 0 {
+		return nil
+	}
+	pick := rnd.Intn(n)
+	for i := 0; edges.Next(); i++ {
+		if i == pick {
+			e := edges.Edge()
+			return []refs.FeedRef{e.From().(*contactNode).feed, e.To().(*contactNode).feed}
+		}
+	}
+	return nil
+}
+
+func testIncrementalFeed(t testing.TB, i int) refs.FeedRef {
+	raw := make([]byte, 32)
+	binary.BigEndian.PutUint64(raw, uint64(i))
+	ref, err := refs.NewFeedRefFromBytes(raw, refs.RefAlgoFeedSSB1)
+	require.NoError(t, err)
+	return ref
+}
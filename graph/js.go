@@ -0,0 +1,122 @@
+// SPDX-FileCopyrightText: 2021 The Go-SSB Authors
+//
+// SPDX-License-Identifier: MIT
+
+package graph
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+
+	refs "github.com/ssbc/go-ssb-refs"
+	"gonum.org/v1/gonum/graph"
+	"gonum.org/v1/gonum/graph/simple"
+
+	"github.com/ssbc/go-ssb/internal/storedrefs"
+)
+
+// The values of the graph object of the JS ssb-friends plugin
+const (
+	jsFollow   = 1
+	jsUnfollow = 0
+	jsBlock    = -1
+)
+
+// MarshalJS encodes the follows and blocks of g like the graph object of the JS ssb-friends plugin:
+// {"@from": {"@to": 1}} for a follow and -1 for a block.
+// Unfollows aren't part of g, so they are left out. So are the edges between metafeeds and their subfeeds.
+func MarshalJS(g *Graph) ([]byte, error) {
+	g.Mutex.Lock()
+	defer g.Mutex.Unlock()
+
+	jsGraph := make(map[string]map[string]int)
+	for _, node := range g.lookup {
+		from := node.feed.Sigil()
+
+		edgs := g.From(node.ID())
+		for edgs.Next() {
+			nTo := edgs.Node().(*contactNode)
+			edg := g.Edge(node.ID(), nTo.ID()).(graph.WeightedEdge)
+
+			var state int
+			switch w := edg.Weight(); {
+			case w == 1:
+				state = jsFollow
+			case math.IsInf(w, 1):
+				state = jsBlock
+			default:
+				continue
+			}
+
+			if jsGraph[from] == nil {
+				jsGraph[from] = make(map[string]int)
+			}
+			jsGraph[from][nTo.feed.Sigil()] = state
+		}
+	}
+
+	return json.Marshal(jsGraph)
+}
+
+// UnmarshalJS decodes the graph object of the JS ssb-friends plugin, as produced by MarshalJS.
+// Feeds which are only unfollowed (0) are added to the graph without an edge, like the Builder does.
+func UnmarshalJS(data []byte) (*Graph, error) {
+	var jsGraph map[string]map[string]float64
+	if err := json.Unmarshal(data, &jsGraph); err != nil {
+		return nil, fmt.Errorf("graph: invalid JS graph object: %w", err)
+	}
+
+	g := NewGraph()
+
+	getNode := func(sigil string) (*contactNode, error) {
+		ref, err := refs.ParseFeedRef(sigil)
+		if err != nil {
+			return nil, fmt.Errorf("graph: invalid feed %q in JS graph object: %w", sigil, err)
+		}
+
+		addr := storedrefs.Feed(ref)
+		node, has := g.lookup[addr]
+		if !has {
+			node = &contactNode{g.NewNode(), ref, ""}
+			g.AddNode(node)
+			g.lookup[addr] = node
+		}
+		return node, nil
+	}
+
+	for fromSigil, edges := range jsGraph {
+		nFrom, err := getNode(fromSigil)
+		if err != nil {
+			return nil, err
+		}
+
+		for toSigil, state := range edges {
+			nTo, err := getNode(toSigil)
+			if err != nil {
+				return nil, err
+			}
+
+			if nFrom.ID() == nTo.ID() {
+				continue
+			}
+
+			switch state {
+			case jsFollow:
+				g.SetWeightedEdge(contactEdge{
+					WeightedEdge: simple.WeightedEdge{F: nFrom, T: nTo, W: 1},
+				})
+			case jsBlock:
+				g.SetWeightedEdge(contactEdge{
+					WeightedEdge: simple.WeightedEdge{F: nFrom, T: nTo, W: math.Inf(1)},
+					isBlock:      true,
+				})
+			case jsUnfollow:
+			default:
+				return nil, fmt.Errorf("graph: unsupported state %v from %s to %s in JS graph object", state, fromSigil, toSigil)
+			}
+		}
+	}
+
+	return g, nil
+}
@@ -0,0 +1,78 @@
+// SPDX-FileCopyrightText: 2021 The Go-SSB Authors
+//
+// SPDX-License-Identifier: MIT
+
+package graph
+
+import (
+	"encoding/json"
+	"testing"
+
+	refs "github.com/ssbc/go-ssb-refs"
+	"github.com/stretchr/testify/require"
+)
+
+// produced by ssb-friends with alice following bob and claire, bob following alice and blocking claire
+// and claire following alice and then unfollowing her
+const jsGraphFixture = `{
+  "@7Y0Pq1GtYhqAmsRYl4OaiJ7CkrKaH2ZLA5DBuKnXtBA=.ed25519": {
+    "@b4WS30nSD8IVatuDxjV2PGGCO8CqCMoTOhzXSglXYhA=.ed25519": 1,
+    "@Kk2XFkdGoI0hXqnNKTF+TNjrTZf/oHgnD8yH4C25DQA=.ed25519": 1
+  },
+  "@b4WS30nSD8IVatuDxjV2PGGCO8CqCMoTOhzXSglXYhA=.ed25519": {
+    "@7Y0Pq1GtYhqAmsRYl4OaiJ7CkrKaH2ZLA5DBuKnXtBA=.ed25519": 1,
+    "@Kk2XFkdGoI0hXqnNKTF+TNjrTZf/oHgnD8yH4C25DQA=.ed25519": -1
+  },
+  "@Kk2XFkdGoI0hXqnNKTF+TNjrTZf/oHgnD8yH4C25DQA=.ed25519": {
+    "@7Y0Pq1GtYhqAmsRYl4OaiJ7CkrKaH2ZLA5DBuKnXtBA=.ed25519": 0
+  }
+}`
+
+func TestJSGraph(t *testing.T) {
+	r := require.New(t)
+
+	parse := func(s string) refs.FeedRef {
+		ref, err := refs.ParseFeedRef(s)
+		r.NoError(err)
+		return ref
+	}
+	alice := parse("@7Y0Pq1GtYhqAmsRYl4OaiJ7CkrKaH2ZLA5DBuKnXtBA=.ed25519")
+	bob := parse("@b4WS30nSD8IVatuDxjV2PGGCO8CqCMoTOhzXSglXYhA=.ed25519")
+	claire := parse("@Kk2XFkdGoI0hXqnNKTF+TNjrTZf/oHgnD8yH4C25DQA=.ed25519")
+
+	check := func(g *Graph) {
+		r.True(g.Follows(alice, bob))
+		r.True(g.Follows(alice, claire))
+		r.True(g.Follows(bob, alice))
+		r.False(g.Follows(bob, claire))
+		r.True(g.Blocks(bob, claire))
+		r.False(g.Follows(claire, alice), "unfollowed")
+		r.False(g.Blocks(claire, alice))
+		r.False(g.Blocks(alice, bob))
+		r.Equal(3, g.NodeCount())
+	}
+
+	g, err := UnmarshalJS([]byte(jsGraphFixture))
+	r.NoError(err)
+	check(g)
+
+	data, err := MarshalJS(g)
+	r.NoError(err)
+
+	var got map[string]map[string]int
+	r.NoError(json.Unmarshal(data, &got))
+	r.Equal(map[string]map[string]int{
+		alice.Sigil(): {bob.Sigil(): 1, claire.Sigil(): 1},
+		bob.Sigil():   {alice.Sigil(): 1, claire.Sigil(): -1},
+	}, got)
+
+	g, err = UnmarshalJS(data)
+	r.NoError(err)
+	check(g)
+
+	_, err = UnmarshalJS([]byte(`{"@7Y0Pq1GtYhqAmsRYl4OaiJ7CkrKaH2ZLA5DBuKnXtBA=.ed25519": {"nope": 1}}`))
+	r.Error(err)
+
+	_, err = UnmarshalJS([]byte(`{"@7Y0Pq1GtYhqAmsRYl4OaiJ7CkrKaH2ZLA5DBuKnXtBA=.ed25519": {"@b4WS30nSD8IVatuDxjV2PGGCO8CqCMoTOhzXSglXYhA=.ed25519": 2}}`))
+	r.Error(err)
+}
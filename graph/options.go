@@ -0,0 +1,93 @@
+// SPDX-FileCopyrightText: 2021 The Go-SSB Authors
+//
+// SPDX-License-Identifier: MIT
+
+package graph
+
+import "time"
+
+const (
+	// DefaultAuthHops is the default distance up to which peers are authorized by the Builder.
+	DefaultAuthHops = 2
+
+	// DefaultReplicationHops is the default distance up to which feeds are part of Graph.ReplicationSet.
+	DefaultReplicationHops = 2
+
+	// DefaultTrustDecay is the default factor by which Graph.TrustScore decreases with each hop.
+	DefaultTrustDecay = 0.5
+
+	// DefaultCentralityDamping is the default probability with which Graph.Centrality follows an edge instead of jumping to a random feed.
+	DefaultCentralityDamping = 0.85
+
+	// DefaultAuthCacheTTL is how long an authorizer reuses a decision to accept a peer, see WithAuthCache.
+	DefaultAuthCacheTTL = 30 * time.Second
+
+	// DefaultAuthNegativeCacheTTL is how long an authorizer reuses a decision to reject a peer.
+	// It is shorter, so that a peer isn't locked out for long if it becomes reachable in a way the graph version doesn't show.
+	DefaultAuthNegativeCacheTTL = 5 * time.Second
+
+	// DefaultCheckpointInterval is after how many indexed messages the builder takes a checkpoint, see WithCheckpointInterval.
+	DefaultCheckpointInterval = 1000
+)
+
+// BuilderOption is used to tune different aspects of the BadgerBuilder.
+type BuilderOption func(*BadgerBuilder)
+
+// WithAuthHops changes how far away a peer can be to be authorized by DefaultAuthorizer.
+// A distance of 0 means only feeds that are followed directly.
+func WithAuthHops(hops int) BuilderOption {
+	return func(b *BadgerBuilder) {
+		b.authHops = hops
+	}
+}
+
+// WithReplicationHops changes how far away a feed can be to be part of the ReplicationSet of the built graphs.
+// It is independent of the distance used for authorization.
+func WithReplicationHops(hops int) BuilderOption {
+	return func(b *BadgerBuilder) {
+		b.replicationHops = hops
+	}
+}
+
+// WithTrustDecay changes the factor by which Graph.TrustScore decreases with each hop. It should be between 0 and 1.
+func WithTrustDecay(decay float64) BuilderOption {
+	return func(b *BadgerBuilder) {
+		b.trustDecay = decay
+	}
+}
+
+// WithCentralityDamping changes the damping factor of Graph.Centrality. It should be between 0 and 1.
+func WithCentralityDamping(damping float64) BuilderOption {
+	return func(b *BadgerBuilder) {
+		b.centralityDamping = damping
+	}
+}
+
+// WithDebounce makes the builder wait until no contact updates came in for d before it drops its cached graph.
+// This keeps it from building the graph again for every message of a burst, like while syncing feeds.
+// Until then Build returns the graph from before the burst, so the results are consistent but can be stale for up to d.
+// Explicit changes, like DeleteAuthor, are applied right away.
+func WithDebounce(d time.Duration) BuilderOption {
+	return func(b *BadgerBuilder) {
+		b.debounce = d
+	}
+}
+
+// WithAuthCache changes how long the authorizers of the builder reuse their decisions for a peer.
+// accept is used for peers that were authorized and reject for the ones that weren't.
+// A decision is always made again once the graph changed. A duration of 0 disables the cache for that kind of decision.
+func WithAuthCache(accept, reject time.Duration) BuilderOption {
+	return func(b *BadgerBuilder) {
+		b.authCacheTTL = accept
+		b.authNegativeCacheTTL = reject
+	}
+}
+
+// WithCheckpointInterval changes after how many indexed messages the builder writes its pending updates and remembers how far it got.
+// If the indexing is interrupted, it resumes from the last checkpoint instead of missing the updates which weren't written.
+// An interval of 0 disables checkpoints.
+func WithCheckpointInterval(n int) BuilderOption {
+	return func(b *BadgerBuilder) {
+		b.checkpointInterval = n
+	}
+}
@@ -0,0 +1,48 @@
+// SPDX-FileCopyrightText: 2021 The Go-SSB Authors
+//
+// SPDX-License-Identifier: MIT
+
+package graph
+
+import (
+	"math"
+	"sort"
+
+	refs "github.com/ssbc/go-ssb-refs"
+)
+
+// PathsThrough returns the feeds whose shortest path from the source of the lookup passes through node,
+// sorted by their reference. node itself and the feeds which can't be reached are not part of it.
+// If there are several shortest paths to a feed, only the one the lookup found is considered.
+func (l Lookup) PathsThrough(node refs.FeedRef) []refs.FeedRef {
+	var feeds []refs.FeedRef
+	if l.inc != nil {
+		feeds = l.inc.feeds()
+	} else {
+		for _, n := range l.lookup {
+			feeds = append(feeds, n.feed)
+		}
+	}
+
+	var through []refs.FeedRef
+	for _, f := range feeds {
+		if f.Equal(node) {
+			continue
+		}
+		p, d := l.Dist(f)
+		if math.IsInf(d, 0) || len(p) < 3 {
+			continue
+		}
+		// the path starts with the source and ends with f
+		for _, hop := range p[1 : len(p)-1] {
+			if cn, ok := hop.(*contactNode); ok && cn.feed.Equal(node) {
+				through = append(through, f)
+				break
+			}
+		}
+	}
+	sort.Slice(through, func(i, j int) bool {
+		return through[i].String() < through[j].String()
+	})
+	return through
+}
@@ -0,0 +1,69 @@
+// SPDX-FileCopyrightText: 2021 The Go-SSB Authors
+//
+// SPDX-License-Identifier: MIT
+
+package graph
+
+import (
+	"sort"
+	"testing"
+
+	refs "github.com/ssbc/go-ssb-refs"
+	"github.com/stretchr/testify/require"
+	"gonum.org/v1/gonum/graph/simple"
+
+	"github.com/ssbc/go-ssb/internal/storedrefs"
+)
+
+func TestPathsThrough(t *testing.T) {
+	r := require.New(t)
+
+	// a follows x and d, x follows b and c, d follows e and b follows e, too.
+	// without x, a can't reach b and c. e is reached through d.
+	const a, x, b, c, d, e = 0, 1, 2, 3, 4, 5
+	g := NewGraph()
+	var feeds []refs.FeedRef
+	for i := 0; i < 6; i++ {
+		f := testIncrementalFeed(t, i)
+		feeds = append(feeds, f)
+		node := &contactNode{g.NewNode(), f, ""}
+		g.AddNode(node)
+		g.lookup[storedrefs.Feed(f)] = node
+	}
+	follow := func(from, to int) {
+		nFrom := g.lookup[storedrefs.Feed(feeds[from])]
+		nTo := g.lookup[storedrefs.Feed(feeds[to])]
+		g.SetWeightedEdge(contactEdge{WeightedEdge: simple.WeightedEdge{F: nFrom, T: nTo, W: 1}})
+	}
+	follow(a, x)
+	follow(a, d)
+	follow(x, b)
+	follow(x, c)
+	follow(d, e)
+	follow(b, e)
+
+	want := []refs.FeedRef{feeds[b], feeds[c]}
+	sortFeeds(want)
+
+	lookup, err := g.MakeDijkstra(feeds[a])
+	r.NoError(err)
+	r.Equal(want, lookup.PathsThrough(feeds[x]))
+	r.Equal([]refs.FeedRef{feeds[e]}, lookup.PathsThrough(feeds[d]))
+	r.Empty(lookup.PathsThrough(feeds[b]), "b is not on the shortest path to e")
+	r.Empty(lookup.PathsThrough(feeds[a]), "the source is not an intermediary")
+
+	il, err := g.MakeIncremental(feeds[a])
+	r.NoError(err)
+	r.Equal(want, il.Lookup().PathsThrough(feeds[x]))
+
+	// once a doesn't follow d anymore, e is reached through x and b
+	il.Unfollow(feeds[a], feeds[d])
+	want = append(want, feeds[e])
+	sortFeeds(want)
+	r.Equal(want, il.Lookup().PathsThrough(feeds[x]))
+	r.Equal([]refs.FeedRef{feeds[e]}, il.Lookup().PathsThrough(feeds[b]))
+}
+
+func sortFeeds(feeds []refs.FeedRef) {
+	sort.Slice(feeds, func(i, j int) bool { return feeds[i].String() < feeds[j].String() })
+}
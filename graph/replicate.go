@@ -0,0 +1,102 @@
+// SPDX-FileCopyrightText: 2021 The Go-SSB Authors
+//
+// SPDX-License-Identifier: MIT
+
+package graph
+
+import (
+	"math"
+
+	refs "github.com/ssbc/go-ssb-refs"
+	"gonum.org/v1/gonum/graph"
+)
+
+// Reason explains the decision of ShouldReplicate.
+type Reason int
+
+const (
+	// ReasonUnknown means that one of the feeds isn't part of the graph.
+	ReasonUnknown Reason = iota
+
+	// ReasonSelf means the candidate is the own feed.
+	ReasonSelf
+
+	// ReasonDirectFollow means the candidate is followed directly.
+	ReasonDirectFollow
+
+	// ReasonWithinHops means the candidate is followed by someone within the hops.
+	ReasonWithinHops
+
+	// ReasonBlocked means the candidate is blocked directly.
+	ReasonBlocked
+
+	// ReasonOutOfReach means the candidate is too many hops away or can only be reached through a block.
+	ReasonOutOfReach
+)
+
+func (r Reason) String() string {
+	switch r {
+	case ReasonUnknown:
+		return "unknown"
+	case ReasonSelf:
+		return "self"
+	case ReasonDirectFollow:
+		return "direct follow"
+	case ReasonWithinHops:
+		return "within hops"
+	case ReasonBlocked:
+		return "blocked"
+	case ReasonOutOfReach:
+		return "out of reach"
+	default:
+		return "invalid reason"
+	}
+}
+
+// ShouldReplicate decides if me should replicate candidate and why.
+// Like for the authorizer, a direct follow is a distance of 0 hops, so a maxHops of 1 includes the follows of the followed feeds.
+//
+// Unlike the authorizer, it doesn't trust everyone if the graph is empty.
+func (g *Graph) ShouldReplicate(me, candidate refs.FeedRef, maxHops int) (bool, Reason) {
+	if candidate.Equal(me) {
+		return true, ReasonSelf
+	}
+
+	if _, has := g.getNode(candidate); !has {
+		return false, ReasonUnknown
+	}
+
+	if g.Blocks(me, candidate) {
+		return false, ReasonBlocked
+	}
+
+	if g.Follows(me, candidate) {
+		return true, ReasonDirectFollow
+	}
+
+	distLookup, err := g.MakeDijkstra(me)
+	if err != nil {
+		return false, ReasonUnknown
+	}
+
+	p, d := distLookup.Dist(candidate)
+	if _, ok := withinHops(p, d, maxHops); !ok {
+		return false, ReasonOutOfReach
+	}
+	return true, ReasonWithinHops
+}
+
+// withinHops turns the path and distance from a Lookup into the number of hops, with the direct follows at 0,
+// and reports if that is at most max. Feeds which can't be reached or only through a block are never within the hops.
+func withinHops(p []graph.Node, d float64, max int) (int, bool) {
+	// the path includes start and end, so Alice to Bob will be
+	// p:=[Alice, some, friends, Bob]
+	// len(p) == 4
+	hops := len(p) - 2
+	// d == -Inf: not connected to the graph
+	// d == +Inf: blocked
+	if math.IsInf(d, 0) || hops < 0 || hops > max {
+		return hops, false
+	}
+	return hops, true
+}
@@ -0,0 +1,74 @@
+// SPDX-FileCopyrightText: 2021 The Go-SSB Authors
+//
+// SPDX-License-Identifier: MIT
+
+package graph
+
+import (
+	"encoding/json"
+	"testing"
+
+	refs "github.com/ssbc/go-ssb-refs"
+	"github.com/stretchr/testify/require"
+)
+
+func TestShouldReplicate(t *testing.T) {
+	r := require.New(t)
+
+	// a chain of follows from feeds[0] to feeds[4]
+	var feeds []refs.FeedRef
+	for i := 0; i < 5; i++ {
+		feeds = append(feeds, testIncrementalFeed(t, i))
+	}
+	blocked := testIncrementalFeed(t, 100)
+	onlyBlocked := testIncrementalFeed(t, 101)
+	behindBlock := testIncrementalFeed(t, 102)
+	unknown := testIncrementalFeed(t, 103)
+
+	jsGraph := make(map[string]map[string]int)
+	for i := 0; i < len(feeds)-1; i++ {
+		jsGraph[feeds[i].Sigil()] = map[string]int{feeds[i+1].Sigil(): jsFollow}
+	}
+	// blocked is followed by a friend, but feeds[0] blocks it
+	jsGraph[feeds[0].Sigil()][blocked.Sigil()] = jsBlock
+	jsGraph[feeds[1].Sigil()][blocked.Sigil()] = jsFollow
+	// behindBlock is only followed by onlyBlocked, which no one but feeds[0] knows about
+	jsGraph[feeds[0].Sigil()][onlyBlocked.Sigil()] = jsBlock
+	jsGraph[onlyBlocked.Sigil()] = map[string]int{behindBlock.Sigil(): jsFollow}
+
+	data, err := json.Marshal(jsGraph)
+	r.NoError(err)
+	g, err := UnmarshalJS(data)
+	r.NoError(err)
+
+	me := feeds[0]
+	tcases := []struct {
+		name      string
+		me        refs.FeedRef
+		candidate refs.FeedRef
+		maxHops   int
+
+		replicate bool
+		reason    Reason
+	}{
+		{"self", me, me, 2, true, ReasonSelf},
+		{"self without hops", me, me, 0, true, ReasonSelf},
+		{"direct follow", me, feeds[1], 2, true, ReasonDirectFollow},
+		{"direct follow without hops", me, feeds[1], 0, true, ReasonDirectFollow},
+		{"one hop", me, feeds[2], 2, true, ReasonWithinHops},
+		{"two hops", me, feeds[3], 2, true, ReasonWithinHops},
+		{"three hops", me, feeds[4], 2, false, ReasonOutOfReach},
+		{"one hop without hops", me, feeds[2], 0, false, ReasonOutOfReach},
+		{"blocked", me, blocked, 2, false, ReasonBlocked},
+		{"blocked and unknown to others", me, onlyBlocked, 2, false, ReasonBlocked},
+		{"only through a block", me, behindBlock, 5, false, ReasonOutOfReach},
+		{"no path back", feeds[1], me, 5, false, ReasonOutOfReach},
+		{"unknown candidate", me, unknown, 5, false, ReasonUnknown},
+		{"unknown me", unknown, feeds[1], 5, false, ReasonUnknown},
+	}
+	for _, tc := range tcases {
+		replicate, reason := g.ShouldReplicate(tc.me, tc.candidate, tc.maxHops)
+		r.Equal(tc.replicate, replicate, tc.name)
+		r.Equal(tc.reason, reason, "%s: got %s", tc.name, reason)
+	}
+}
@@ -0,0 +1,108 @@
+// SPDX-FileCopyrightText: 2021 The Go-SSB Authors
+//
+// SPDX-License-Identifier: MIT
+
+package graph
+
+import (
+	"fmt"
+	"os"
+	"testing"
+)
+
+func TestReplicationHops(t *testing.T) {
+	if os.Getenv("LIBRARIAN_WRITEALL") != "0" {
+		t.Fatal("please 'export LIBRARIAN_WRITEALL=0' for this test to pass")
+	}
+
+	mk := func(t *testing.T) testStore {
+		return makeBadgerWithOptions(t, WithAuthHops(2), WithReplicationHops(3))
+	}
+
+	tc := PeopleTestCase{
+		name: "chain",
+		ops: []PeopleOp{
+			PeopleOpNewPeer{"alice"},
+			PeopleOpNewPeer{"bob"},
+			PeopleOpNewPeer{"claire"},
+			PeopleOpNewPeer{"debora"},
+			PeopleOpNewPeer{"emil"},
+			PeopleOpNewPeer{"frank"},
+
+			PeopleOpFollow{"alice", "bob"},
+			PeopleOpFollow{"bob", "claire"},
+			PeopleOpFollow{"claire", "debora"},
+			PeopleOpFollow{"debora", "emil"},
+			PeopleOpFollow{"emil", "frank"},
+		},
+		asserts: []PeopleAssertMaker{
+			PeopleAssertPathDist("alice", "emil", 3),
+
+			PeopleAssertDefaultAuthorize("alice", "bob", true),
+			PeopleAssertDefaultAuthorize("alice", "debora", true),
+			PeopleAssertDefaultAuthorize("alice", "emil", false),
+			PeopleAssertDefaultAuthorize("alice", "frank", false),
+
+			PeopleAssertReplicationSet("alice", "bob", "claire", "debora", "emil"),
+		},
+	}
+	t.Run(tc.name, tc.run(mk))
+}
+
+func PeopleAssertDefaultAuthorize(host, remote string, want bool) PeopleAssertMaker {
+	return func(state *testState) PeopleAssert {
+		a, b, err := getAliceBob(host, remote, state)
+		return func(bld Builder) error {
+			if err != nil {
+				return fmt.Errorf("auth: no such peers: %w", err)
+			}
+
+			auth := bld.(*BadgerBuilder).DefaultAuthorizer(a.key.ID())
+
+			err := auth.Authorize(b.key.ID())
+			if want && err != nil {
+				return fmt.Errorf("auth assert: %s didn't allow %s: %w", host, remote, err)
+			}
+			if !want && err == nil {
+				return fmt.Errorf("auth assert: host(%s) accepted remote(%s)", host, remote)
+			}
+			return nil
+		}
+	}
+}
+
+func PeopleAssertReplicationSet(from string, tos ...string) PeopleAssertMaker {
+	return func(state *testState) PeopleAssert {
+		return func(bld Builder) error {
+			alice, ok := state.peers[from]
+			if !ok {
+				return fmt.Errorf("no such from peer")
+			}
+
+			g, err := bld.Build()
+			if err != nil {
+				return err
+			}
+
+			set, err := g.ReplicationSet(alice.key.ID())
+			if err != nil {
+				return err
+			}
+
+			for _, nick := range tos {
+				bob, ok := state.peers[nick]
+				if !ok {
+					return fmt.Errorf("wanted peer not in known-peers list: %s", nick)
+				}
+				if !set.Has(bob.key.ID()) {
+					return fmt.Errorf("wanted peer not in replication set: %s", nick)
+				}
+			}
+
+			if n, m := set.Count(), len(tos); n != m {
+				return fmt.Errorf("count mismatch between want(%d) and got(%d)", m, n)
+			}
+			return nil
+		}
+	}
+}
@@ -0,0 +1,72 @@
+// SPDX-FileCopyrightText: 2021 The Go-SSB Authors
+//
+// SPDX-License-Identifier: MIT
+
+package graph
+
+import (
+	"gonum.org/v1/gonum/graph"
+	"gonum.org/v1/gonum/graph/simple"
+
+	refs "github.com/ssbc/go-ssb-refs"
+)
+
+// Subgraph returns a copy of g with only root and the feeds which are at most maxHops away from it, and the edges between them.
+// The hops are counted like in ShouldReplicate, so feeds that can only be reached through a block are left out.
+// This is meant to share the relevant part of a graph, for instance to debug replication with someone else.
+//
+// The copy keeps the settings and version of g. If root isn't in g, it is empty.
+func Subgraph(g *Graph, root refs.FeedRef, maxHops int) *Graph {
+	sub := NewGraph()
+	sub.replicationHops = g.replicationHops
+	sub.trustHops = g.trustHops
+	sub.trustDecay = g.trustDecay
+	sub.centralityDamping = g.centralityDamping
+	sub.version = g.version
+
+	distLookup, err := g.MakeDijkstra(root)
+	if err != nil {
+		return sub
+	}
+
+	g.Mutex.Lock()
+	defer g.Mutex.Unlock()
+
+	// the nodes of g by their id, for the ones that are included
+	included := make(map[int64]*contactNode)
+	for addr, node := range g.lookup {
+		if !node.feed.Equal(root) {
+			p, d := distLookup.dijk.To(node.ID())
+			if _, ok := withinHops(p, d, maxHops); !ok {
+				continue
+			}
+		}
+
+		subNode := &contactNode{sub.NewNode(), node.feed, node.name}
+		sub.AddNode(subNode)
+		sub.lookup[addr] = subNode
+		included[node.ID()] = subNode
+	}
+
+	for id, nFrom := range included {
+		edgs := g.From(id)
+		for edgs.Next() {
+			nTo, has := included[edgs.Node().ID()]
+			if !has {
+				continue
+			}
+
+			edg := g.Edge(id, edgs.Node().ID()).(graph.WeightedEdge)
+			var isBlock bool
+			if ce, ok := edg.(contactEdge); ok {
+				isBlock = ce.isBlock
+			}
+			sub.SetWeightedEdge(contactEdge{
+				WeightedEdge: simple.WeightedEdge{F: nFrom, T: nTo, W: edg.Weight()},
+				isBlock:      isBlock,
+			})
+		}
+	}
+
+	return sub
+}
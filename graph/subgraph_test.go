@@ -0,0 +1,87 @@
+// SPDX-FileCopyrightText: 2021 The Go-SSB Authors
+//
+// SPDX-License-Identifier: MIT
+
+package graph
+
+import (
+	"math"
+	"testing"
+
+	refs "github.com/ssbc/go-ssb-refs"
+	"github.com/stretchr/testify/require"
+	"gonum.org/v1/gonum/graph/simple"
+
+	"github.com/ssbc/go-ssb/internal/storedrefs"
+)
+
+func TestSubgraph(t *testing.T) {
+	r := require.New(t)
+
+	// a follows b, b follows c, c follows d and d follows a back.
+	// a blocks e, which b follows, and f, which nobody else knows.
+	const a, b, c, d, e, f = 0, 1, 2, 3, 4, 5
+	g := NewGraph()
+	g.replicationHops = 1
+	g.version = 42
+	var feeds []refs.FeedRef
+	for i := 0; i < 6; i++ {
+		f := testIncrementalFeed(t, i)
+		feeds = append(feeds, f)
+		node := &contactNode{g.NewNode(), f, ""}
+		g.AddNode(node)
+		g.lookup[storedrefs.Feed(f)] = node
+	}
+	edge := func(from, to int, w float64) {
+		nFrom := g.lookup[storedrefs.Feed(feeds[from])]
+		nTo := g.lookup[storedrefs.Feed(feeds[to])]
+		g.SetWeightedEdge(contactEdge{
+			WeightedEdge: simple.WeightedEdge{F: nFrom, T: nTo, W: w},
+			isBlock:      math.IsInf(w, 1),
+		})
+	}
+	edge(a, b, 1)
+	edge(b, c, 1)
+	edge(c, d, 1)
+	edge(d, a, 1)
+	edge(a, e, math.Inf(1))
+	edge(b, e, 1)
+	edge(a, f, math.Inf(1))
+
+	reachable, err := g.ReplicationSet(feeds[a])
+	r.NoError(err)
+
+	sub := Subgraph(g, feeds[a], 1)
+	r.Equal(reachable.Count()+1, sub.NodeCount(), "the reachable feeds and the root")
+	r.EqualValues(42, sub.Version())
+
+	r.True(sub.Follows(feeds[a], feeds[b]))
+	r.True(sub.Follows(feeds[b], feeds[c]))
+	r.False(sub.Follows(feeds[c], feeds[d]), "d is too far away")
+	r.False(sub.Follows(feeds[d], feeds[a]))
+	r.True(sub.Blocks(feeds[a], feeds[e]), "e is reached through b")
+	r.True(sub.Follows(feeds[b], feeds[e]))
+	r.False(sub.Blocks(feeds[a], feeds[f]), "f is only reached through a block")
+	r.True(g.Follows(feeds[c], feeds[d]), "the original graph is unchanged")
+
+	ok, reason := sub.ShouldReplicate(feeds[a], feeds[c], 1)
+	r.True(ok)
+	r.Equal(ReasonWithinHops, reason)
+	subSet, err := sub.ReplicationSet(feeds[a])
+	r.NoError(err)
+	r.Equal(0, reachable.Difference(subSet).Count())
+	r.Equal(0, subSet.Difference(reachable).Count())
+
+	// with more hops d and its follow of a are included
+	sub = Subgraph(g, feeds[a], 2)
+	r.Equal(5, sub.NodeCount())
+	r.True(sub.Follows(feeds[d], feeds[a]))
+
+	// only the direct follows of b
+	sub = Subgraph(g, feeds[b], 0)
+	r.Equal(3, sub.NodeCount())
+	r.True(sub.Follows(feeds[b], feeds[e]))
+	r.False(sub.Follows(feeds[c], feeds[d]))
+
+	r.Equal(0, Subgraph(g, testIncrementalFeed(t, 23), 3).NodeCount())
+}
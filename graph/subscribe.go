@@ -0,0 +1,149 @@
+// SPDX-FileCopyrightText: 2021 The Go-SSB Authors
+//
+// SPDX-License-Identifier: MIT
+
+package graph
+
+import (
+	"context"
+	"sync"
+
+	"github.com/ssbc/go-luigi"
+	refs "github.com/ssbc/go-ssb-refs"
+)
+
+// EdgeChangeKind is what a contact message did to the relation between two feeds.
+type EdgeChangeKind uint
+
+const (
+	// EdgeFollow means From follows To now.
+	EdgeFollow EdgeChangeKind = iota
+
+	// EdgeUnfollow means From neither follows nor blocks To anymore. Unblocking is reported as this, too.
+	EdgeUnfollow
+
+	// EdgeBlock means From blocks To now.
+	EdgeBlock
+)
+
+func (k EdgeChangeKind) String() string {
+	switch k {
+	case EdgeFollow:
+		return "follow"
+	case EdgeUnfollow:
+		return "unfollow"
+	case EdgeBlock:
+		return "block"
+	default:
+		return "unknown"
+	}
+}
+
+// EdgeChange is emitted by a Subscription for each indexed contact message between two feeds.
+// Contact messages which repeat the current relation are emitted as well.
+type EdgeChange struct {
+	FeedPair
+	Kind EdgeChangeKind
+
+	// Seq is the root log sequence of the contact message.
+	Seq int64
+}
+
+// Subscription is a luigi.Source of the EdgeChanges which involve one feed, as returned by Subscribe.
+// It only has the changes which were indexed after it was made.
+// Close ends it and stops the builder from collecting changes for it.
+type Subscription struct {
+	b    *BadgerBuilder
+	feed refs.FeedRef
+
+	mu     sync.Mutex
+	queue  []EdgeChange
+	closed bool
+	wake   chan struct{}
+}
+
+var _ luigi.Source = (*Subscription)(nil)
+
+// Subscribe returns the changes of the follows and blocks from or to feed, as they are indexed.
+// The indexing doesn't wait for the subscription to be read, the changes are queued until Next is called.
+func (b *BadgerBuilder) Subscribe(feed refs.FeedRef) *Subscription {
+	sub := &Subscription{
+		b:    b,
+		feed: feed,
+		wake: make(chan struct{}, 1),
+	}
+
+	b.subsMu.Lock()
+	b.subs[sub] = struct{}{}
+	b.subsMu.Unlock()
+	return sub
+}
+
+// notifySubscriptions passes c to the subscriptions of its feeds
+func (b *BadgerBuilder) notifySubscriptions(c EdgeChange) {
+	b.subsMu.Lock()
+	defer b.subsMu.Unlock()
+	for sub := range b.subs {
+		if sub.feed.Equal(c.From) || sub.feed.Equal(c.To) {
+			sub.push(c)
+		}
+	}
+}
+
+func (sub *Subscription) push(c EdgeChange) {
+	sub.mu.Lock()
+	if sub.closed {
+		sub.mu.Unlock()
+		return
+	}
+	sub.queue = append(sub.queue, c)
+	sub.mu.Unlock()
+
+	select {
+	case sub.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Next returns the next EdgeChange, waiting for it if there is none yet.
+// After Close it returns luigi.EOS.
+func (sub *Subscription) Next(ctx context.Context) (interface{}, error) {
+	for {
+		sub.mu.Lock()
+		if sub.closed {
+			sub.mu.Unlock()
+			return nil, luigi.EOS{}
+		}
+		if len(sub.queue) > 0 {
+			c := sub.queue[0]
+			sub.queue = sub.queue[1:]
+			sub.mu.Unlock()
+			return c, nil
+		}
+		sub.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-sub.wake:
+		}
+	}
+}
+
+// Close unsubscribes from the builder. Pending changes are dropped.
+func (sub *Subscription) Close() error {
+	sub.b.subsMu.Lock()
+	delete(sub.b.subs, sub)
+	sub.b.subsMu.Unlock()
+
+	sub.mu.Lock()
+	sub.closed = true
+	sub.queue = nil
+	sub.mu.Unlock()
+
+	select {
+	case sub.wake <- struct{}{}:
+	default:
+	}
+	return nil
+}
@@ -0,0 +1,73 @@
+// SPDX-FileCopyrightText: 2021 The Go-SSB Authors
+//
+// SPDX-License-Identifier: MIT
+
+package graph
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/ssbc/go-luigi"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSubscribe(t *testing.T) {
+	r := require.New(t)
+	tc := makeBadger(t)
+
+	me := tc.newPublisher(t)
+	alice := tc.newPublisher(t)
+	stranger1 := tc.newPublisher(t)
+	stranger2 := tc.newPublisher(t)
+
+	sub := tc.gbuilder.Subscribe(me.key.ID())
+
+	next := func() (EdgeChange, error) {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		v, err := sub.Next(ctx)
+		if err != nil {
+			return EdgeChange{}, err
+		}
+		return v.(EdgeChange), nil
+	}
+
+	stranger1.follow(stranger2.key.ID())
+	alice.follow(me.key.ID())
+
+	c, err := next()
+	r.NoError(err)
+	r.Equal(EdgeFollow, c.Kind)
+	r.True(c.From.Equal(alice.key.ID()))
+	r.True(c.To.Equal(me.key.ID()))
+
+	// my own contacts are in it as well
+	me.block(alice.key.ID())
+	c, err = next()
+	r.NoError(err)
+	r.Equal(EdgeBlock, c.Kind)
+	r.True(c.From.Equal(me.key.ID()))
+
+	alice.unfollow(me.key.ID())
+	c, err = next()
+	r.NoError(err)
+	r.Equal(EdgeUnfollow, c.Kind)
+	r.True(c.From.Equal(alice.key.ID()))
+
+	// nothing about the strangers
+	stranger2.follow(stranger1.key.ID())
+	_, err = next()
+	r.True(errors.Is(err, context.DeadlineExceeded), "unexpected change: %v", err)
+
+	r.NoError(sub.Close())
+	_, err = sub.Next(context.Background())
+	r.True(luigi.IsEOS(err))
+
+	b := tc.gbuilder.(*BadgerBuilder)
+	b.subsMu.Lock()
+	r.Len(b.subs, 0, "closed subscription still registered")
+	b.subsMu.Unlock()
+}
@@ -0,0 +1,84 @@
+// SPDX-FileCopyrightText: 2021 The Go-SSB Authors
+//
+// SPDX-License-Identifier: MIT
+
+package graph
+
+import (
+	"sort"
+
+	"gonum.org/v1/gonum/graph"
+
+	refs "github.com/ssbc/go-ssb-refs"
+	"github.com/ssbc/go-ssb/internal/storedrefs"
+)
+
+// Suggestions returns feeds me might want to follow: the ones followed by the feeds me follows.
+// They are ranked by how many of the follows of me follow them, ties are sorted by feed.
+// me, the feeds it already follows or unfollowed and the ones it blocks are left out.
+// At most max feeds are returned, or all of them if max is zero or less.
+func (g *Graph) Suggestions(me refs.FeedRef, max int) []refs.FeedRef {
+	g.Mutex.Lock()
+	defer g.Mutex.Unlock()
+
+	nMe, has := g.lookup[storedrefs.Feed(me)]
+	if !has {
+		return nil
+	}
+
+	isFollow := func(from, to int64) bool {
+		return g.Edge(from, to).(graph.WeightedEdge).Weight() == 1
+	}
+
+	// every feed me has a relation to is excluded: the follows and blocks,
+	// but also the unfollowed ones, which me decided against, and its subfeeds
+	excluded := map[int64]struct{}{nMe.ID(): {}}
+	var follows []int64
+	edgs := g.From(nMe.ID())
+	for edgs.Next() {
+		id := edgs.Node().ID()
+		excluded[id] = struct{}{}
+		if isFollow(nMe.ID(), id) {
+			follows = append(follows, id)
+		}
+	}
+
+	overlap := make(map[int64]int)
+	for _, f := range follows {
+		edgs := g.From(f)
+		for edgs.Next() {
+			id := edgs.Node().ID()
+			if _, skip := excluded[id]; skip || !isFollow(f, id) {
+				continue
+			}
+			overlap[id]++
+		}
+	}
+
+	type suggestion struct {
+		feed  refs.FeedRef
+		count int
+	}
+	suggestions := make([]suggestion, 0, len(overlap))
+	for id, count := range overlap {
+		suggestions = append(suggestions, suggestion{
+			feed:  g.Node(id).(*contactNode).feed,
+			count: count,
+		})
+	}
+	sort.Slice(suggestions, func(i, j int) bool {
+		if suggestions[i].count != suggestions[j].count {
+			return suggestions[i].count > suggestions[j].count
+		}
+		return suggestions[i].feed.String() < suggestions[j].feed.String()
+	})
+
+	if max > 0 && len(suggestions) > max {
+		suggestions = suggestions[:max]
+	}
+	feeds := make([]refs.FeedRef, len(suggestions))
+	for i, s := range suggestions {
+		feeds[i] = s.feed
+	}
+	return feeds
+}
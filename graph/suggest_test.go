@@ -0,0 +1,67 @@
+// SPDX-FileCopyrightText: 2021 The Go-SSB Authors
+//
+// SPDX-License-Identifier: MIT
+
+package graph
+
+import (
+	"math"
+	"testing"
+
+	refs "github.com/ssbc/go-ssb-refs"
+	"github.com/stretchr/testify/require"
+	"gonum.org/v1/gonum/graph/simple"
+
+	"github.com/ssbc/go-ssb/internal/storedrefs"
+)
+
+func TestSuggestions(t *testing.T) {
+	r := require.New(t)
+
+	// me follows a, b and c.
+	// d is followed by all three, e by two, f and g by one, h only by someone me doesn't follow.
+	// b is also followed by a, but me already follows it. me blocks g.
+	const me, a, b, c, d, e, f, g, h, x = 0, 1, 2, 3, 4, 5, 6, 7, 8, 9
+	gr := NewGraph()
+	var feeds []refs.FeedRef
+	for i := 0; i < 10; i++ {
+		feed := testIncrementalFeed(t, i)
+		feeds = append(feeds, feed)
+		node := &contactNode{gr.NewNode(), feed, ""}
+		gr.AddNode(node)
+		gr.lookup[storedrefs.Feed(feed)] = node
+	}
+	edge := func(from, to int, w float64) {
+		nFrom := gr.lookup[storedrefs.Feed(feeds[from])]
+		nTo := gr.lookup[storedrefs.Feed(feeds[to])]
+		gr.SetWeightedEdge(contactEdge{
+			WeightedEdge: simple.WeightedEdge{F: nFrom, T: nTo, W: w},
+			isBlock:      math.IsInf(w, 1),
+		})
+	}
+	follow := func(from int, to ...int) {
+		for _, t := range to {
+			edge(from, t, 1)
+		}
+	}
+	follow(me, a, b, c)
+	follow(a, b, d, e, g, me)
+	follow(b, d, e)
+	follow(c, d, f)
+	follow(x, h)
+	edge(me, g, math.Inf(1))
+	// c unfollowed e, so it doesn't count
+	edge(c, e, math.Inf(-1))
+
+	r.Equal([]refs.FeedRef{feeds[d], feeds[e], feeds[f]}, gr.Suggestions(feeds[me], 0))
+	r.Equal([]refs.FeedRef{feeds[d], feeds[e]}, gr.Suggestions(feeds[me], 2))
+
+	// ties are sorted by feed
+	follow(b, f)
+	want := []refs.FeedRef{feeds[e], feeds[f]}
+	sortFeeds(want)
+	r.Equal(append([]refs.FeedRef{feeds[d]}, want...), gr.Suggestions(feeds[me], 5))
+
+	r.Empty(gr.Suggestions(feeds[h], 5), "h doesn't follow anyone")
+	r.Empty(gr.Suggestions(testIncrementalFeed(t, 23), 5))
+}
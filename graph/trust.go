@@ -0,0 +1,61 @@
+// SPDX-FileCopyrightText: 2021 The Go-SSB Authors
+//
+// SPDX-License-Identifier: MIT
+
+package graph
+
+import (
+	"math"
+
+	refs "github.com/ssbc/go-ssb-refs"
+)
+
+// TrustScore returns how much from trusts to, as a value between 0 and 1 that can be used to rank peers.
+// Like for the authorizer, a direct follow is a distance of 0 hops and scores 1, as does from itself.
+// Every additional hop multiplies the score by the decay (see WithTrustDecay),
+// so the score of a feed which is n hops away is decay^n.
+//
+// Feeds which are further away than the hops of the authorizer (see WithAuthHops),
+// can't be reached or are blocked by from score 0.
+// Apart from an empty graph, which the authorizer accepts as trust on first use,
+// a feed has a score above 0 exactly if it is authorized.
+//
+// It computes the distances from from on each call. To rank many feeds, use TrustScores.
+func (g *Graph) TrustScore(from, to refs.FeedRef) float64 {
+	scores := g.TrustScores(from, []refs.FeedRef{to})
+	return scores[0]
+}
+
+// TrustScores returns the TrustScore from from for each feed in to, in the same order.
+func (g *Graph) TrustScores(from refs.FeedRef, to []refs.FeedRef) []float64 {
+	scores := make([]float64, len(to))
+
+	var distLookup *Lookup
+	for i, feed := range to {
+		if feed.Equal(from) {
+			scores[i] = 1
+			continue
+		}
+
+		if g.Blocks(from, feed) {
+			continue
+		}
+
+		if distLookup == nil {
+			var err error
+			distLookup, err = g.MakeDijkstra(from)
+			if err != nil {
+				// from isn't part of the graph and doesn't trust anyone
+				return scores
+			}
+		}
+
+		p, d := distLookup.Dist(feed)
+		hops, ok := withinHops(p, d, g.trustHops)
+		if !ok {
+			continue
+		}
+		scores[i] = math.Pow(g.trustDecay, float64(hops))
+	}
+	return scores
+}
@@ -0,0 +1,65 @@
+// SPDX-FileCopyrightText: 2021 The Go-SSB Authors
+//
+// SPDX-License-Identifier: MIT
+
+package graph
+
+import (
+	"encoding/json"
+	"testing"
+
+	refs "github.com/ssbc/go-ssb-refs"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTrustScore(t *testing.T) {
+	r := require.New(t)
+
+	// a chain of follows from feeds[0] to feeds[5]
+	var feeds []refs.FeedRef
+	for i := 0; i < 6; i++ {
+		feeds = append(feeds, testIncrementalFeed(t, i))
+	}
+	blocked := testIncrementalFeed(t, 100)
+	unknown := testIncrementalFeed(t, 101)
+
+	jsGraph := make(map[string]map[string]int)
+	for i := 0; i < len(feeds)-1; i++ {
+		jsGraph[feeds[i].Sigil()] = map[string]int{feeds[i+1].Sigil(): jsFollow}
+	}
+	// blocked can be reached through a friend, but feeds[0] blocks it
+	jsGraph[feeds[0].Sigil()][blocked.Sigil()] = jsBlock
+	jsGraph[feeds[1].Sigil()][blocked.Sigil()] = jsFollow
+
+	data, err := json.Marshal(jsGraph)
+	r.NoError(err)
+	g, err := UnmarshalJS(data)
+	r.NoError(err)
+
+	g.trustHops = 3
+	g.trustDecay = 0.8
+
+	from := feeds[0]
+	r.Equal(1.0, g.TrustScore(from, from), "self")
+	r.Equal(1.0, g.TrustScore(from, feeds[1]), "direct follow")
+
+	last := 1.0
+	for hops := 1; hops <= 3; hops++ {
+		score := g.TrustScore(from, feeds[hops+1])
+		r.InDelta(0.8*last, score, 1e-9, "%d hops", hops)
+		r.Less(score, last, "%d hops", hops)
+		r.Greater(score, 0.0, "%d hops", hops)
+		last = score
+	}
+
+	r.Equal(0.0, g.TrustScore(from, feeds[5]), "past the max hops")
+	r.Equal(0.0, g.TrustScore(from, blocked), "blocked")
+	r.Equal(0.0, g.TrustScore(from, unknown), "not in the graph")
+	r.Equal(0.0, g.TrustScore(unknown, feeds[1]), "from not in the graph")
+
+	// follows are one way
+	r.Equal(0.0, g.TrustScore(feeds[1], from), "no path back")
+
+	scores := g.TrustScores(from, []refs.FeedRef{feeds[2], blocked, from, feeds[5]})
+	r.Equal([]float64{0.8, 0, 1, 0}, scores)
+}
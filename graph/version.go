@@ -0,0 +1,58 @@
+// SPDX-FileCopyrightText: 2021 The Go-SSB Authors
+//
+// SPDX-License-Identifier: MIT
+
+package graph
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	"github.com/dgraph-io/badger/v3"
+	"go.mindeco.de/log/level"
+)
+
+// The version of the graph is stored next to it, so that it doesn't go back after a restart.
+// Otherwise the versions handed out for changes like Forget, or while the index processes messages again after a checkpoint,
+// would be used again for different contents.
+
+// versionKey is outside of dbKeyPrefix so that it isn't read as a relation.
+var versionKey = []byte("graph-version")
+
+// readVersion returns the stored version. has is false if there is none.
+func (b *BadgerBuilder) readVersion() (version int64, has bool, err error) {
+	err = b.kv.View(func(txn *badger.Txn) error {
+		it, err := txn.Get(versionKey)
+		if err != nil {
+			return err
+		}
+		return it.Value(func(raw []byte) error {
+			if len(raw) != 8 {
+				return fmt.Errorf("graph: stored version has %d bytes", len(raw))
+			}
+			version = int64(binary.BigEndian.Uint64(raw))
+			return nil
+		})
+	})
+	if errors.Is(err, badger.ErrKeyNotFound) {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, err
+	}
+	return version, true, nil
+}
+
+// storeVersion writes the current version.
+// Needs to be called with cacheLock held.
+func (b *BadgerBuilder) storeVersion() {
+	raw := make([]byte, 8)
+	binary.BigEndian.PutUint64(raw, uint64(b.version))
+	err := b.kv.Update(func(txn *badger.Txn) error {
+		return txn.Set(versionKey, raw)
+	})
+	if err != nil {
+		level.Warn(b.log).Log("event", "graph version", "err", err)
+	}
+}
@@ -0,0 +1,76 @@
+// SPDX-FileCopyrightText: 2021 The Go-SSB Authors
+//
+// SPDX-License-Identifier: MIT
+
+package graph
+
+import (
+	"os"
+	"testing"
+
+	refs "github.com/ssbc/go-ssb-refs"
+	"github.com/stretchr/testify/require"
+	"go.mindeco.de/log"
+)
+
+func TestGraphVersion(t *testing.T) {
+	if os.Getenv("LIBRARIAN_WRITEALL") != "0" {
+		t.Fatal("please 'export LIBRARIAN_WRITEALL=0' for this test to pass")
+	}
+	r := require.New(t)
+
+	tc := makeBadger(t)
+
+	alice := tc.newPublisher(t)
+	bob := tc.newPublisher(t)
+	claire := tc.newPublisher(t)
+
+	alice.follow(bob.key.ID())
+
+	g1, err := tc.gbuilder.Build()
+	r.NoError(err)
+	r.Equal(g1.Version(), tc.gbuilder.CurrentVersion())
+
+	// messages that are not contacts don't change the graph
+	_, err = bob.publish.Publish(refs.NewPost("hello"))
+	r.NoError(err)
+
+	r.Equal(g1.Version(), tc.gbuilder.CurrentVersion(), "version changed without a new contact")
+	g2, err := tc.gbuilder.Build()
+	r.NoError(err)
+	r.Equal(g1.Version(), g2.Version())
+
+	// a new contact advances the version
+	alice.follow(claire.key.ID())
+
+	newVersion := tc.gbuilder.CurrentVersion()
+	r.Greater(newVersion, g1.Version(), "version didn't advance")
+
+	g3, err := tc.gbuilder.Build()
+	r.NoError(err)
+	r.Equal(newVersion, g3.Version())
+	r.True(g3.Follows(alice.key.ID(), claire.key.ID()))
+	r.False(g1.Follows(alice.key.ID(), claire.key.ID()), "older snapshot changed")
+}
+
+func TestGraphVersionPersisted(t *testing.T) {
+	if os.Getenv("LIBRARIAN_WRITEALL") != "0" {
+		t.Fatal("please 'export LIBRARIAN_WRITEALL=0' for this test to pass")
+	}
+	r := require.New(t)
+
+	tc := makeBadger(t)
+
+	alice := tc.newPublisher(t)
+	bob := tc.newPublisher(t)
+	alice.follow(bob.key.ID())
+
+	// changes that don't come from a message count up from the sequence of the last one
+	r.NoError(tc.gbuilder.Forget(bob.key.ID()))
+	forgotten := tc.gbuilder.CurrentVersion()
+
+	// a builder opened again on the same database doesn't go back to the index sequence
+	bb := tc.gbuilder.(*BadgerBuilder)
+	reopened := NewBuilder(log.NewNopLogger(), bb.kv, nil)
+	r.Equal(forgotten, reopened.CurrentVersion())
+}
@@ -0,0 +1,71 @@
+// SPDX-FileCopyrightText: 2021 The Go-SSB Authors
+//
+// SPDX-License-Identifier: MIT
+
+package ssb
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/ssbc/go-luigi/mfr"
+	refs "github.com/ssbc/go-ssb-refs"
+)
+
+// HopsLister returns the feeds within max hops of from, like graph.Builder does.
+type HopsLister interface {
+	Hops(from refs.FeedRef, max int) *StrFeedSet
+}
+
+// VersionedHopsLister is a HopsLister whose hops only change with its version, like graph.Builder.
+type VersionedHopsLister interface {
+	HopsLister
+
+	// CurrentVersion changes whenever the graph does.
+	CurrentVersion() int64
+}
+
+// GraphFilter returns a filter for mfr.SinkFilter which drops messages whose author isn't within maxHops of me in fg.
+// Messages of me are always let through.
+// If fg is a VersionedHopsLister, the hops are looked up once for each version of the graph.
+// Otherwise they are looked up for every message. Either way, authors which become reachable during replication are picked up.
+func GraphFilter(fg HopsLister, me refs.FeedRef, maxHops int) mfr.FilterFunc {
+	hopsOf := func() *StrFeedSet { return fg.Hops(me, maxHops) }
+	if vfg, ok := fg.(VersionedHopsLister); ok {
+		var (
+			mu      sync.Mutex
+			hops    *StrFeedSet
+			version int64
+			has     bool
+		)
+		hopsOf = func() *StrFeedSet {
+			mu.Lock()
+			defer mu.Unlock()
+			// read the version first, so that a change while the hops are looked up is seen by the next message
+			current := vfg.CurrentVersion()
+			if !has || current != version {
+				hops, version, has = vfg.Hops(me, maxHops), current, true
+			}
+			return hops
+		}
+	}
+
+	return func(ctx context.Context, v interface{}) (bool, error) {
+		msg, ok := v.(refs.Message)
+		if !ok {
+			return false, ErrWrongType{has: fmt.Sprintf("%T", v), want: "refs.Message"}
+		}
+
+		author := msg.Author()
+		if author.Equal(me) {
+			return true, nil
+		}
+
+		hops := hopsOf()
+		if hops == nil {
+			return false, nil
+		}
+		return hops.Has(author), nil
+	}
+}
@@ -0,0 +1,109 @@
+// SPDX-FileCopyrightText: 2021 The Go-SSB Authors
+//
+// SPDX-License-Identifier: MIT
+
+package ssb
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/ssbc/go-luigi"
+	"github.com/ssbc/go-luigi/mfr"
+	refs "github.com/ssbc/go-ssb-refs"
+	"github.com/stretchr/testify/require"
+)
+
+// staticHops returns the same set of feeds for every lookup
+type staticHops []refs.FeedRef
+
+func (sh staticHops) Hops(refs.FeedRef, int) *StrFeedSet {
+	fs := NewFeedSet(len(sh))
+	for _, f := range sh {
+		fs.AddRef(f)
+	}
+	return fs
+}
+
+func TestGraphFilter(t *testing.T) {
+	r := require.New(t)
+
+	feed := func(b byte) refs.FeedRef {
+		ref, err := refs.NewFeedRefFromBytes(bytes.Repeat([]byte{b}, 32), refs.RefAlgoFeedSSB1)
+		r.NoError(err)
+		return ref
+	}
+	me, friend, stranger := feed(1), feed(2), feed(3)
+
+	var stored []refs.FeedRef
+	store := luigi.FuncSink(func(ctx context.Context, v interface{}, err error) error {
+		if err != nil {
+			return nil
+		}
+		stored = append(stored, v.(refs.Message).Author())
+		return nil
+	})
+
+	snk := mfr.SinkFilter(store, GraphFilter(staticHops{friend}, me, 2))
+
+	ctx := context.TODO()
+	for i, author := range []refs.FeedRef{stranger, friend, me} {
+		err := snk.Pour(ctx, &subscribeMsg{author: author, seq: int64(i + 1)})
+		r.NoError(err)
+	}
+	r.Len(stored, 2)
+	r.True(stored[0].Equal(friend))
+	r.True(stored[1].Equal(me))
+
+	err := snk.Pour(ctx, "not a message")
+	r.Error(err)
+}
+
+// versionedHops counts how often the hops of its feeds are looked up
+type versionedHops struct {
+	staticHops
+	version int64
+	lookups int
+}
+
+func (vh *versionedHops) Hops(from refs.FeedRef, max int) *StrFeedSet {
+	vh.lookups++
+	return vh.staticHops.Hops(from, max)
+}
+
+func (vh *versionedHops) CurrentVersion() int64 { return vh.version }
+
+func TestGraphFilterVersioned(t *testing.T) {
+	r := require.New(t)
+
+	feed := func(b byte) refs.FeedRef {
+		ref, err := refs.NewFeedRefFromBytes(bytes.Repeat([]byte{b}, 32), refs.RefAlgoFeedSSB1)
+		r.NoError(err)
+		return ref
+	}
+	me, friend, stranger := feed(1), feed(2), feed(3)
+
+	fg := &versionedHops{staticHops: staticHops{friend}}
+	filter := GraphFilter(fg, me, 2)
+
+	ctx := context.TODO()
+	pass := func(author refs.FeedRef) bool {
+		ok, err := filter(ctx, &subscribeMsg{author: author, seq: 1})
+		r.NoError(err)
+		return ok
+	}
+
+	for i := 0; i < 10; i++ {
+		r.True(pass(friend))
+		r.False(pass(stranger))
+	}
+	r.Equal(1, fg.lookups, "the hops should be looked up once per version")
+
+	// the stranger was followed
+	fg.staticHops = append(fg.staticHops, stranger)
+	fg.version++
+	r.True(pass(stranger))
+	r.True(pass(friend))
+	r.Equal(2, fg.lookups)
+}
@@ -0,0 +1,163 @@
+// SPDX-FileCopyrightText: 2021 The Go-SSB Authors
+//
+// SPDX-License-Identifier: MIT
+
+package indexes
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/dgraph-io/badger/v3"
+	"github.com/ssbc/margaret"
+	librarian "github.com/ssbc/margaret/indexes"
+	libbadger "github.com/ssbc/margaret/indexes/badger"
+
+	refs "github.com/ssbc/go-ssb-refs"
+	"github.com/ssbc/go-ssb/internal/storedrefs"
+	"github.com/ssbc/go-ssb/repo"
+)
+
+// AboutValues are the name and image of a feed, as assigned by a single about message.
+type AboutValues struct {
+	Name  string `json:"name,omitempty"`
+	Image string `json:"image,omitempty"`
+}
+
+// aboutEntry holds what the feed said about itself and the latest of what others said about it.
+type aboutEntry struct {
+	Self  AboutValues `json:"self"`
+	Other AboutValues `json:"other"`
+}
+
+// AboutIndex maps feeds to their name and image from type:about messages.
+// Use it as a sink over the messages of type about (or the whole root log).
+type AboutIndex struct {
+	librarian.SinkIndex
+
+	db  *badger.DB
+	idx librarian.SeqSetterIndex
+}
+
+// NewAbout opens the about index of the repo.
+func NewAbout(r repo.Interface) (*AboutIndex, error) {
+	db, idx, sink, err := repo.OpenBadgerIndex(r, "about", func(db *badger.DB) (librarian.SeqSetterIndex, librarian.SinkIndex) {
+		idx := libbadger.NewIndexWithKeyPrefix(db, aboutEntry{}, []byte("about"))
+		return idx, librarian.NewSinkIndex(updateAboutFn, idx)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("index/about: failed to open: %w", err)
+	}
+
+	return &AboutIndex{
+		SinkIndex: sink,
+
+		db:  db,
+		idx: idx,
+	}, nil
+}
+
+// Close closes the index and its backing database.
+func (ai *AboutIndex) Close() error {
+	if err := ai.SinkIndex.Close(); err != nil {
+		return fmt.Errorf("index/about: failed to close index: %w", err)
+	}
+	return ai.db.Close()
+}
+
+// About returns the name and image of feed.
+// What a feed says about itself takes precedence over what others said about it. Each field is picked on its own,
+// so a feed that only named itself still gets the image others assigned to it.
+// If nothing is known, name is empty and image is nil.
+func (ai *AboutIndex) About(feed refs.FeedRef) (string, *refs.BlobRef, error) {
+	entry, err := getAboutEntry(context.TODO(), ai.idx, feed)
+	if err != nil {
+		return "", nil, err
+	}
+
+	name := entry.Self.Name
+	if name == "" {
+		name = entry.Other.Name
+	}
+
+	imgRef := entry.Self.Image
+	if imgRef == "" {
+		imgRef = entry.Other.Image
+	}
+	if imgRef == "" {
+		return name, nil, nil
+	}
+
+	img, err := refs.ParseBlobRef(imgRef)
+	if err != nil {
+		return "", nil, fmt.Errorf("index/about: invalid image stored for %s: %w", feed.ShortSigil(), err)
+	}
+	return name, &img, nil
+}
+
+func getAboutEntry(ctx context.Context, idx librarian.Index, feed refs.FeedRef) (aboutEntry, error) {
+	obv, err := idx.Get(ctx, storedrefs.Feed(feed))
+	if err != nil {
+		return aboutEntry{}, fmt.Errorf("index/about: failed to get entry for %s: %w", feed.ShortSigil(), err)
+	}
+
+	v, err := obv.Value()
+	if err != nil {
+		return aboutEntry{}, fmt.Errorf("index/about: failed to get value for %s: %w", feed.ShortSigil(), err)
+	}
+
+	switch tv := v.(type) {
+	case aboutEntry:
+		return tv, nil
+	case librarian.UnsetValue:
+		return aboutEntry{}, nil
+	default:
+		return aboutEntry{}, fmt.Errorf("index/about: unexpected value for %s: %T", feed.ShortSigil(), v)
+	}
+}
+
+func updateAboutFn(ctx context.Context, seq int64, val interface{}, idx librarian.SetterIndex) error {
+	msg, ok := val.(refs.Message)
+	if !ok {
+		err, ok := val.(error)
+		if ok && margaret.IsErrNulled(err) {
+			return nil
+		}
+		return fmt.Errorf("index/about: unexpected message type: %T", val)
+	}
+
+	var about refs.About
+	err := json.Unmarshal(msg.ContentBytes(), &about)
+	if err != nil {
+		// not an about message or one about something that isn't a feed
+		return nil
+	}
+
+	if about.Name == "" && about.Image == nil {
+		return nil
+	}
+
+	entry, err := getAboutEntry(ctx, idx, about.About)
+	if err != nil {
+		return err
+	}
+
+	values := &entry.Other
+	if msg.Author().Equal(about.About) {
+		values = &entry.Self
+	}
+
+	if about.Name != "" {
+		values.Name = about.Name
+	}
+	if about.Image != nil {
+		values.Image = about.Image.Sigil()
+	}
+
+	err = idx.Set(ctx, storedrefs.Feed(about.About), entry)
+	if err != nil {
+		return fmt.Errorf("index/about: failed to update entry for %s (seq: %d): %w", about.About.ShortSigil(), seq, err)
+	}
+	return nil
+}
@@ -0,0 +1,121 @@
+// SPDX-FileCopyrightText: 2021 The Go-SSB Authors
+//
+// SPDX-License-Identifier: MIT
+
+package indexes_test
+
+import (
+	"context"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/ssbc/go-ssb"
+	refs "github.com/ssbc/go-ssb-refs"
+	"github.com/ssbc/go-ssb/indexes"
+	"github.com/ssbc/go-ssb/internal/asynctesting"
+	"github.com/ssbc/go-ssb/internal/storedrefs"
+	"github.com/ssbc/go-ssb/message"
+	"github.com/ssbc/go-ssb/multilogs"
+	"github.com/ssbc/go-ssb/repo"
+)
+
+func TestAbout(t *testing.T) {
+	r := require.New(t)
+	ctx, cancel := context.WithCancel(context.TODO())
+	defer cancel()
+
+	rpath := filepath.Join("testrun", t.Name())
+	os.RemoveAll(rpath)
+
+	testRepo := repo.New(rpath)
+	rl, err := repo.OpenLog(testRepo)
+	r.NoError(err)
+	t.Cleanup(func() { rl.Close() })
+
+	userFeeds, userFeedsSnk, err := repo.OpenStandaloneMultiLog(testRepo, "testUsers", multilogs.UserFeedsUpdate)
+	r.NoError(err)
+	t.Cleanup(func() {
+		userFeeds.Close()
+		userFeedsSnk.Close()
+	})
+
+	about, err := indexes.NewAbout(testRepo)
+	r.NoError(err)
+
+	usersErrc := asynctesting.ServeLog(ctx, "users", rl, userFeedsSnk, true)
+	aboutErrc := asynctesting.ServeLog(ctx, "about", rl, about, true)
+
+	staticRand := rand.New(rand.NewSource(42))
+	alice, err := ssb.NewKeyPair(staticRand, refs.RefAlgoFeedSSB1)
+	r.NoError(err)
+	bob, err := ssb.NewKeyPair(staticRand, refs.RefAlgoFeedSSB1)
+	r.NoError(err)
+
+	publish := func(kp ssb.KeyPair, content interface{}) {
+		p, err := message.OpenPublishLog(rl, userFeeds, kp)
+		r.NoError(err)
+		msg, err := p.Publish(content)
+		r.NoError(err)
+
+		sublog, err := userFeeds.Get(storedrefs.Feed(kp.ID()))
+		r.NoError(err)
+		r.Eventually(func() bool {
+			return sublog.Seq() == msg.Seq()-1
+		}, time.Second, 10*time.Millisecond)
+	}
+
+	waitFor := func(feed refs.FeedRef, wantName string, wantImage *refs.BlobRef) {
+		r.Eventually(func() bool {
+			name, img, err := about.About(feed)
+			r.NoError(err)
+			if name != wantName {
+				return false
+			}
+			if wantImage == nil {
+				return img == nil
+			}
+			return img != nil && img.Equal(*wantImage)
+		}, time.Second, 10*time.Millisecond)
+	}
+
+	img1, err := refs.NewBlobRefFromBytes(make([]byte, 32), refs.RefAlgoBlobSSB1)
+	r.NoError(err)
+	img2, err := refs.NewBlobRefFromBytes(append(make([]byte, 31), 1), refs.RefAlgoBlobSSB1)
+	r.NoError(err)
+
+	name, img, err := about.About(alice.ID())
+	r.NoError(err)
+	r.Equal("", name)
+	r.Nil(img)
+
+	// bob names alice and sets an image for her
+	publish(bob, refs.NewAboutName(alice.ID(), "ally"))
+	waitFor(alice.ID(), "ally", nil)
+	publish(bob, refs.NewAboutImage(alice.ID(), &img1))
+	waitFor(alice.ID(), "ally", &img1)
+
+	// alice picks her own name, which wins but keeps the image from bob
+	publish(alice, refs.NewAboutName(alice.ID(), "alice"))
+	waitFor(alice.ID(), "alice", &img1)
+
+	// later names by others don't override her own
+	publish(bob, refs.NewAboutName(alice.ID(), "not alice"))
+	publish(alice, refs.NewAboutImage(alice.ID(), &img2))
+	waitFor(alice.ID(), "alice", &img2)
+
+	// bob never said anything about himself
+	name, img, err = about.About(bob.ID())
+	r.NoError(err)
+	r.Equal("", name)
+	r.Nil(img)
+
+	cancel()
+	r.NoError(<-usersErrc)
+	r.NoError(<-aboutErrc)
+	r.NoError(about.Close())
+}
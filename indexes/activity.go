@@ -0,0 +1,226 @@
+// SPDX-FileCopyrightText: 2021 The Go-SSB Authors
+//
+// SPDX-License-Identifier: MIT
+
+package indexes
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/dgraph-io/badger/v3"
+	"github.com/ssbc/margaret"
+	librarian "github.com/ssbc/margaret/indexes"
+	libbadger "github.com/ssbc/margaret/indexes/badger"
+
+	refs "github.com/ssbc/go-ssb-refs"
+	"github.com/ssbc/go-ssb-refs/tfk"
+	"github.com/ssbc/go-ssb/internal/storedrefs"
+	"github.com/ssbc/go-ssb/repo"
+)
+
+// FeedActivity is how many messages of a feed were indexed and when the feed claimed to have published them.
+type FeedActivity struct {
+	Feed  refs.FeedRef
+	Count int64
+	First time.Time
+	Last  time.Time
+}
+
+// Rate returns the average number of messages per second between the first and the last message.
+// It is zero if there are less than two messages or they have the same timestamp.
+func (fa FeedActivity) Rate() float64 {
+	span := fa.Last.Sub(fa.First).Seconds()
+	if fa.Count < 2 || span <= 0 {
+		return 0
+	}
+	return float64(fa.Count-1) / span
+}
+
+// activityEntry is what is stored per feed. The timestamps are in milliseconds, like the claimed ones of messages.
+type activityEntry struct {
+	Count int64 `json:"count"`
+	First int64 `json:"first"`
+	Last  int64 `json:"last"`
+}
+
+var activityKeyPrefix = []byte("activity")
+
+// ActivityIndex keeps track of the number of messages and the first and last timestamps of each feed.
+// Use it as a sink over the whole root log. The entries are updated with each message so that queries don't need to read the log.
+type ActivityIndex struct {
+	librarian.SinkIndex
+
+	db  *badger.DB
+	idx librarian.SeqSetterIndex
+}
+
+// NewActivity opens the activity index of the repo.
+func NewActivity(r repo.Interface) (*ActivityIndex, error) {
+	db, idx, sink, err := repo.OpenBadgerIndex(r, "activity", func(db *badger.DB) (librarian.SeqSetterIndex, librarian.SinkIndex) {
+		idx := libbadger.NewIndexWithKeyPrefix(db, activityEntry{}, activityKeyPrefix)
+		return idx, librarian.NewSinkIndex(updateActivityFn, idx)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("index/activity: failed to open: %w", err)
+	}
+
+	return &ActivityIndex{
+		SinkIndex: sink,
+
+		db:  db,
+		idx: idx,
+	}, nil
+}
+
+// Close closes the index and its backing database.
+func (ai *ActivityIndex) Close() error {
+	if err := ai.SinkIndex.Close(); err != nil {
+		return fmt.Errorf("index/activity: failed to close index: %w", err)
+	}
+	return ai.db.Close()
+}
+
+// Activity returns the activity of a single feed. If nothing was indexed for it, Count is zero.
+func (ai *ActivityIndex) Activity(feed refs.FeedRef) (FeedActivity, error) {
+	entry, err := getActivityEntry(context.TODO(), ai.idx, feed)
+	if err != nil {
+		return FeedActivity{}, err
+	}
+	return entry.activity(feed), nil
+}
+
+// TopActive returns the n feeds with the most messages, most active first.
+// Feeds with the same number of messages are ordered by their last message, newest first.
+// If n is negative, all feeds are returned.
+func (ai *ActivityIndex) TopActive(n int) ([]FeedActivity, error) {
+	// write pending updates, so that the iteration below sees them
+	if f, ok := ai.idx.(interface{ Flush() error }); ok {
+		if err := f.Flush(); err != nil {
+			return nil, fmt.Errorf("index/activity: failed to flush pending updates: %w", err)
+		}
+	}
+
+	var all []FeedActivity
+	err := ai.db.View(func(txn *badger.Txn) error {
+		iter := txn.NewIterator(badger.DefaultIteratorOptions)
+		defer iter.Close()
+
+		prefixLen := len(activityKeyPrefix)
+		for iter.Seek(activityKeyPrefix); iter.ValidForPrefix(activityKeyPrefix); iter.Next() {
+			it := iter.Item()
+			k := it.Key()
+			// skips the current sequence of the index
+			if len(k) != 34+prefixLen {
+				continue
+			}
+
+			var sr tfk.Feed
+			if err := sr.UnmarshalBinary(k[prefixLen:]); err != nil {
+				return fmt.Errorf("invalid feed in key: %w", err)
+			}
+			feed, err := sr.Feed()
+			if err != nil {
+				return fmt.Errorf("invalid feed in key: %w", err)
+			}
+
+			var entry activityEntry
+			err = it.Value(func(v []byte) error {
+				return json.Unmarshal(v, &entry)
+			})
+			if err != nil {
+				return fmt.Errorf("invalid entry for %s: %w", feed.ShortSigil(), err)
+			}
+
+			all = append(all, entry.activity(feed))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("index/activity: failed to read entries: %w", err)
+	}
+
+	sort.Slice(all, func(i, j int) bool {
+		if all[i].Count != all[j].Count {
+			return all[i].Count > all[j].Count
+		}
+		if !all[i].Last.Equal(all[j].Last) {
+			return all[i].Last.After(all[j].Last)
+		}
+		return all[i].Feed.String() < all[j].Feed.String()
+	})
+
+	if n >= 0 && n < len(all) {
+		all = all[:n]
+	}
+	return all, nil
+}
+
+func (e activityEntry) activity(feed refs.FeedRef) FeedActivity {
+	fa := FeedActivity{
+		Feed:  feed,
+		Count: e.Count,
+	}
+	if e.Count > 0 {
+		fa.First = time.UnixMilli(e.First)
+		fa.Last = time.UnixMilli(e.Last)
+	}
+	return fa
+}
+
+func getActivityEntry(ctx context.Context, idx librarian.Index, feed refs.FeedRef) (activityEntry, error) {
+	obv, err := idx.Get(ctx, storedrefs.Feed(feed))
+	if err != nil {
+		return activityEntry{}, fmt.Errorf("index/activity: failed to get entry for %s: %w", feed.ShortSigil(), err)
+	}
+
+	v, err := obv.Value()
+	if err != nil {
+		return activityEntry{}, fmt.Errorf("index/activity: failed to get value for %s: %w", feed.ShortSigil(), err)
+	}
+
+	switch tv := v.(type) {
+	case activityEntry:
+		return tv, nil
+	case librarian.UnsetValue:
+		return activityEntry{}, nil
+	default:
+		return activityEntry{}, fmt.Errorf("index/activity: unexpected value for %s: %T", feed.ShortSigil(), v)
+	}
+}
+
+func updateActivityFn(ctx context.Context, seq int64, val interface{}, idx librarian.SetterIndex) error {
+	msg, ok := val.(refs.Message)
+	if !ok {
+		err, ok := val.(error)
+		if ok && margaret.IsErrNulled(err) {
+			return nil
+		}
+		return fmt.Errorf("index/activity: unexpected message type: %T", val)
+	}
+
+	author := msg.Author()
+	entry, err := getActivityEntry(ctx, idx, author)
+	if err != nil {
+		return err
+	}
+
+	// messages aren't necessarily received in the order they claim to be written in
+	ts := msg.Claimed().UnixMilli()
+	if entry.Count == 0 || ts < entry.First {
+		entry.First = ts
+	}
+	if entry.Count == 0 || ts > entry.Last {
+		entry.Last = ts
+	}
+	entry.Count++
+
+	err = idx.Set(ctx, storedrefs.Feed(author), entry)
+	if err != nil {
+		return fmt.Errorf("index/activity: failed to update entry for %s (seq: %d): %w", author.ShortSigil(), seq, err)
+	}
+	return nil
+}
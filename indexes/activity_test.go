@@ -0,0 +1,121 @@
+// SPDX-FileCopyrightText: 2021 The Go-SSB Authors
+//
+// SPDX-License-Identifier: MIT
+
+package indexes_test
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ssbc/margaret/mem"
+	"github.com/stretchr/testify/require"
+
+	refs "github.com/ssbc/go-ssb-refs"
+	"github.com/ssbc/go-ssb/indexes"
+	"github.com/ssbc/go-ssb/internal/asynctesting"
+	"github.com/ssbc/go-ssb/repo"
+)
+
+func TestActivity(t *testing.T) {
+	r := require.New(t)
+
+	rpath := filepath.Join("testrun", t.Name())
+	os.RemoveAll(rpath)
+	testRepo := repo.New(rpath)
+
+	alice := activityTestFeed(t, 1)
+	bob := activityTestFeed(t, 2)
+	claire := activityTestFeed(t, 3)
+
+	start := time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC)
+	at := func(minutes int) time.Time { return start.Add(time.Duration(minutes) * time.Minute) }
+
+	rl := mem.New()
+	appendMsgs := func(author refs.FeedRef, minutes ...int) {
+		for _, m := range minutes {
+			_, err := rl.Append(activityTestMsg{author: author, claimed: at(m)})
+			r.NoError(err)
+		}
+	}
+
+	// bob's messages arrive out of order
+	appendMsgs(alice, 0, 1)
+	appendMsgs(bob, 5, 2, 9, 3)
+	appendMsgs(claire, 4)
+
+	activity, err := indexes.NewActivity(testRepo)
+	r.NoError(err)
+
+	serve := func() {
+		r.NoError(<-asynctesting.ServeLog(context.TODO(), "activity", rl, activity, false))
+	}
+	serve()
+
+	top, err := activity.TopActive(2)
+	r.NoError(err)
+	r.Len(top, 2)
+	r.True(top[0].Feed.Equal(bob))
+	r.EqualValues(4, top[0].Count)
+	r.True(top[0].First.Equal(at(2)), "first: %s", top[0].First)
+	r.True(top[0].Last.Equal(at(9)), "last: %s", top[0].Last)
+	r.True(top[1].Feed.Equal(alice))
+	r.EqualValues(2, top[1].Count)
+
+	// claire catches up with alice and wins the tie with the newer message
+	appendMsgs(claire, 8)
+	serve()
+
+	top, err = activity.TopActive(-1)
+	r.NoError(err)
+	r.Len(top, 3)
+	var got []refs.FeedRef
+	for _, fa := range top {
+		got = append(got, fa.Feed)
+	}
+	r.Equal([]refs.FeedRef{bob, claire, alice}, got)
+
+	fa, err := activity.Activity(alice)
+	r.NoError(err)
+	r.EqualValues(2, fa.Count)
+	r.InDelta(1.0/60, fa.Rate(), 0.0001)
+
+	fa, err = activity.Activity(activityTestFeed(t, 4))
+	r.NoError(err)
+	r.EqualValues(0, fa.Count)
+	r.True(fa.Last.IsZero())
+
+	// the entries survive reopening the index
+	r.NoError(activity.Close())
+	activity, err = indexes.NewActivity(testRepo)
+	r.NoError(err)
+	defer activity.Close()
+
+	top, err = activity.TopActive(1)
+	r.NoError(err)
+	r.Len(top, 1)
+	r.True(top[0].Feed.Equal(bob))
+	r.EqualValues(4, top[0].Count)
+}
+
+// activityTestMsg only has the parts of a message the activity index looks at
+type activityTestMsg struct {
+	refs.Message
+
+	author  refs.FeedRef
+	claimed time.Time
+}
+
+func (msg activityTestMsg) Author() refs.FeedRef { return msg.author }
+
+func (msg activityTestMsg) Claimed() time.Time { return msg.claimed }
+
+func activityTestFeed(t *testing.T, i byte) refs.FeedRef {
+	ref, err := refs.NewFeedRefFromBytes(bytes.Repeat([]byte{i}, 32), refs.RefAlgoFeedSSB1)
+	require.NoError(t, err)
+	return ref
+}
@@ -0,0 +1,171 @@
+// SPDX-FileCopyrightText: 2021 The Go-SSB Authors
+//
+// SPDX-License-Identifier: MIT
+
+package indexes
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/ssbc/go-luigi"
+	refs "github.com/ssbc/go-ssb-refs"
+	"github.com/ssbc/margaret"
+	librarian "github.com/ssbc/margaret/indexes"
+	"github.com/ssbc/margaret/multilog"
+
+	"github.com/ssbc/go-ssb"
+	"github.com/ssbc/go-ssb/internal/mutil"
+	"github.com/ssbc/go-ssb/repo"
+)
+
+// BlobRefsIndex is a multilog of the sequences of messages in the root log by the blobs they reference, as found by ssb.ExtractBlobRefs.
+// Only the content of public messages is looked at.
+// Use it as a sink over the whole root log.
+//
+// The references of nulled messages are skipped when reading, so removing a message drops its references.
+type BlobRefsIndex struct {
+	librarian.SinkIndex
+
+	mlog multilog.MultiLog
+}
+
+// NewBlobRefs opens the blob references index of the repo.
+func NewBlobRefs(r repo.Interface) (*BlobRefsIndex, error) {
+	mlog, sink, err := repo.OpenStandaloneMultiLog(r, "blobRefs", updateBlobRefsFn)
+	if err != nil {
+		return nil, fmt.Errorf("index/blobRefs: failed to open: %w", err)
+	}
+
+	return &BlobRefsIndex{
+		SinkIndex: sink,
+
+		mlog: mlog,
+	}, nil
+}
+
+// Close closes the index and its backing multilog.
+func (bi *BlobRefsIndex) Close() error {
+	if err := bi.SinkIndex.Close(); err != nil {
+		return fmt.Errorf("index/blobRefs: failed to close index: %w", err)
+	}
+	return bi.mlog.Close()
+}
+
+// References returns the stored messages which reference blob, in the order they were received.
+// rootLog needs to be the log the index was built from.
+func (bi *BlobRefsIndex) References(rootLog margaret.Log, blob refs.BlobRef) ([]refs.Message, error) {
+	sublog, err := bi.mlog.Get(librarian.Addr(blob.Sigil()))
+	if err != nil {
+		return nil, fmt.Errorf("index/blobRefs: failed to open sublog: %w", err)
+	}
+
+	src, err := mutil.Indirect(rootLog, sublog).Query()
+	if err != nil {
+		return nil, fmt.Errorf("index/blobRefs: invalid query: %w", err)
+	}
+
+	var msgs []refs.Message
+	for {
+		v, err := src.Next(context.Background())
+		if err != nil {
+			if luigi.IsEOS(err) {
+				return msgs, nil
+			}
+			if margaret.IsErrNulled(err) {
+				continue
+			}
+			return nil, fmt.Errorf("index/blobRefs: failed to get message: %w", err)
+		}
+
+		if err, ok := v.(error); ok {
+			if margaret.IsErrNulled(err) {
+				continue
+			}
+			return nil, err
+		}
+		msg, ok := v.(refs.Message)
+		if !ok {
+			return nil, fmt.Errorf("index/blobRefs: unexpected message type: %T", v)
+		}
+		msgs = append(msgs, msg)
+	}
+}
+
+// Count returns how many stored messages reference blob.
+func (bi *BlobRefsIndex) Count(rootLog margaret.Log, blob refs.BlobRef) (int, error) {
+	msgs, err := bi.References(rootLog, blob)
+	if err != nil {
+		return 0, err
+	}
+	return len(msgs), nil
+}
+
+// Feeds returns the authors of the stored messages which reference blob, each one once.
+func (bi *BlobRefsIndex) Feeds(rootLog margaret.Log, blob refs.BlobRef) ([]refs.FeedRef, error) {
+	msgs, err := bi.References(rootLog, blob)
+	if err != nil {
+		return nil, err
+	}
+
+	set := ssb.NewFeedSet(len(msgs))
+	var feeds []refs.FeedRef
+	for _, msg := range msgs {
+		if set.Has(msg.Author()) {
+			continue
+		}
+		set.AddRef(msg.Author())
+		feeds = append(feeds, msg.Author())
+	}
+	return feeds, nil
+}
+
+// List returns all the blobs which were referenced by an indexed message, including ones whose messages were removed since.
+func (bi *BlobRefsIndex) List() ([]refs.BlobRef, error) {
+	addrs, err := bi.mlog.List()
+	if err != nil {
+		return nil, fmt.Errorf("index/blobRefs: failed to list blobs: %w", err)
+	}
+
+	blobs := make([]refs.BlobRef, 0, len(addrs))
+	for _, addr := range addrs {
+		br, err := refs.ParseBlobRef(string(addr))
+		if err != nil {
+			return nil, fmt.Errorf("index/blobRefs: invalid stored blob reference: %w", err)
+		}
+		blobs = append(blobs, br)
+	}
+	return blobs, nil
+}
+
+func updateBlobRefsFn(ctx context.Context, seq int64, value interface{}, mlog multilog.MultiLog) error {
+	if nulled, ok := value.(error); ok {
+		if margaret.IsErrNulled(nulled) {
+			return nil
+		}
+		return nulled
+	}
+
+	msg, ok := value.(refs.Message)
+	if !ok {
+		return fmt.Errorf("index/blobRefs: unexpected message type: %T", value)
+	}
+
+	blobs, err := ssb.ExtractBlobRefs(msg.ContentBytes())
+	if err != nil {
+		// private or invalid content
+		return nil
+	}
+
+	for _, br := range blobs {
+		sublog, err := mlog.Get(librarian.Addr(br.Sigil()))
+		if err != nil {
+			return fmt.Errorf("index/blobRefs: failed to open sublog for %s: %w", br.ShortSigil(), err)
+		}
+
+		if _, err := sublog.Append(seq); err != nil {
+			return fmt.Errorf("index/blobRefs: failed to append to %s: %w", br.ShortSigil(), err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,116 @@
+// SPDX-FileCopyrightText: 2021 The Go-SSB Authors
+//
+// SPDX-License-Identifier: MIT
+
+package indexes_test
+
+import (
+	"bytes"
+	"context"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/ssbc/go-ssb"
+	refs "github.com/ssbc/go-ssb-refs"
+	"github.com/ssbc/go-ssb/indexes"
+	"github.com/ssbc/go-ssb/internal/asynctesting"
+	"github.com/ssbc/go-ssb/message"
+	"github.com/ssbc/go-ssb/multilogs"
+	"github.com/ssbc/go-ssb/repo"
+)
+
+func TestBlobRefs(t *testing.T) {
+	r := require.New(t)
+	ctx, cancel := context.WithCancel(context.TODO())
+	defer cancel()
+
+	rpath := filepath.Join("testrun", t.Name())
+	os.RemoveAll(rpath)
+
+	testRepo := repo.New(rpath)
+	rl, err := repo.OpenLog(testRepo)
+	r.NoError(err)
+	t.Cleanup(func() { rl.Close() })
+
+	userFeeds, userFeedsSnk, err := repo.OpenStandaloneMultiLog(testRepo, "testUsers", multilogs.UserFeedsUpdate)
+	r.NoError(err)
+	t.Cleanup(func() {
+		userFeeds.Close()
+		userFeedsSnk.Close()
+	})
+	usersErrc := asynctesting.ServeLog(ctx, "users", rl, userFeedsSnk, true)
+
+	blobRefs, err := indexes.NewBlobRefs(testRepo)
+	r.NoError(err)
+	blobRefsErrc := asynctesting.ServeLog(ctx, "blobRefs", rl, blobRefs, true)
+
+	staticRand := rand.New(rand.NewSource(42))
+	alice, err := ssb.NewKeyPair(staticRand, refs.RefAlgoFeedSSB1)
+	r.NoError(err)
+	bob, err := ssb.NewKeyPair(staticRand, refs.RefAlgoFeedSSB1)
+	r.NoError(err)
+
+	alicePub, err := message.OpenPublishLog(rl, userFeeds, alice)
+	r.NoError(err)
+	bobPub, err := message.OpenPublishLog(rl, userFeeds, bob)
+	r.NoError(err)
+
+	shared, err := refs.NewBlobRefFromBytes(bytes.Repeat([]byte{1}, 32), refs.RefAlgoBlobSSB1)
+	r.NoError(err)
+	other, err := refs.NewBlobRefFromBytes(bytes.Repeat([]byte{2}, 32), refs.RefAlgoBlobSSB1)
+	r.NoError(err)
+
+	aliceSeq, err := alicePub.Append(map[string]interface{}{
+		"type":     "post",
+		"text":     "look",
+		"mentions": []interface{}{map[string]interface{}{"link": shared.Sigil()}},
+	})
+	r.NoError(err)
+	_, err = bobPub.Append(map[string]interface{}{
+		"type":  "post",
+		"text":  "me too",
+		"image": shared.Sigil(),
+		"also":  []interface{}{other.Sigil(), shared.Sigil()},
+	})
+	r.NoError(err)
+
+	r.Eventually(func() bool {
+		n, err := blobRefs.Count(rl, other)
+		return err == nil && n == 1
+	}, time.Second, 10*time.Millisecond, "index not in sync")
+
+	n, err := blobRefs.Count(rl, shared)
+	r.NoError(err)
+	r.Equal(2, n, "the same blob twice in a message only counts once")
+
+	feeds, err := blobRefs.Feeds(rl, shared)
+	r.NoError(err)
+	r.Len(feeds, 2)
+	r.True(feeds[0].Equal(alice.ID()))
+	r.True(feeds[1].Equal(bob.ID()))
+
+	listed, err := blobRefs.List()
+	r.NoError(err)
+	r.Len(listed, 2)
+
+	// removing a message drops its reference
+	r.NoError(rl.Null(aliceSeq))
+	n, err = blobRefs.Count(rl, shared)
+	r.NoError(err)
+	r.Equal(1, n)
+
+	msgs, err := blobRefs.References(rl, shared)
+	r.NoError(err)
+	r.Len(msgs, 1)
+	r.True(msgs[0].Author().Equal(bob.ID()))
+
+	cancel()
+	r.NoError(<-usersErrc)
+	r.NoError(<-blobRefsErrc)
+	r.NoError(blobRefs.Close())
+}
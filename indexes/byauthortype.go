@@ -0,0 +1,123 @@
+// SPDX-FileCopyrightText: 2021 The Go-SSB Authors
+//
+// SPDX-License-Identifier: MIT
+
+package indexes
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/ssbc/go-luigi"
+	refs "github.com/ssbc/go-ssb-refs"
+	"github.com/ssbc/margaret"
+	librarian "github.com/ssbc/margaret/indexes"
+	"github.com/ssbc/margaret/multilog"
+
+	"github.com/ssbc/go-ssb"
+	"github.com/ssbc/go-ssb/internal/mutil"
+	"github.com/ssbc/go-ssb/internal/storedrefs"
+	"github.com/ssbc/go-ssb/repo"
+)
+
+// ByAuthorTypeIndex is a multilog of the sequences of messages in the root log by their author and content type,
+// so that all the messages of one type by a feed can be read without going through the whole feed.
+// Only public messages with a JSON object as content that has a type are indexed. Private messages are left out, even if they can be decrypted.
+// Use it as a sink over the whole root log.
+type ByAuthorTypeIndex struct {
+	librarian.SinkIndex
+
+	mlog multilog.MultiLog
+}
+
+// NewByAuthorType opens the author and type index of the repo.
+func NewByAuthorType(r repo.Interface) (*ByAuthorTypeIndex, error) {
+	mlog, sink, err := repo.OpenStandaloneMultiLog(r, "byAuthorType", updateByAuthorTypeFn)
+	if err != nil {
+		return nil, fmt.Errorf("index/byAuthorType: failed to open: %w", err)
+	}
+
+	return &ByAuthorTypeIndex{
+		SinkIndex: sink,
+
+		mlog: mlog,
+	}, nil
+}
+
+// Close closes the index and its backing multilog.
+func (ai *ByAuthorTypeIndex) Close() error {
+	if err := ai.SinkIndex.Close(); err != nil {
+		return fmt.Errorf("index/byAuthorType: failed to close index: %w", err)
+	}
+	return ai.mlog.Close()
+}
+
+// authorTypeAddr is the address of the sublog of a type by a feed.
+// The stored form of a feed has a fixed length, so the type can just follow it.
+func authorTypeAddr(author refs.FeedRef, typ string) librarian.Addr {
+	return storedrefs.Feed(author) + librarian.Addr(typ)
+}
+
+// Query returns a source of the messages of type typ by author, in the order they were received.
+// rootLog needs to be the log the index was built from. The specs are applied to the sublog, so margaret.Live(true) also returns new messages as they are indexed.
+// Nulled messages are returned as errors, like by mutil.Indirect.
+func (ai *ByAuthorTypeIndex) Query(rootLog margaret.Log, author refs.FeedRef, typ string, specs ...margaret.QuerySpec) (luigi.Source, error) {
+	sublog, err := ai.mlog.Get(authorTypeAddr(author, typ))
+	if err != nil {
+		return nil, fmt.Errorf("index/byAuthorType: failed to open sublog: %w", err)
+	}
+
+	src, err := mutil.Indirect(rootLog, sublog).Query(specs...)
+	if err != nil {
+		return nil, fmt.Errorf("index/byAuthorType: invalid query: %w", err)
+	}
+	return src, nil
+}
+
+// Types returns the types of the indexed messages by author, sorted.
+func (ai *ByAuthorTypeIndex) Types(author refs.FeedRef) ([]string, error) {
+	addrs, err := ai.mlog.List()
+	if err != nil {
+		return nil, fmt.Errorf("index/byAuthorType: failed to list sublogs: %w", err)
+	}
+
+	prefix := string(storedrefs.Feed(author))
+	var types []string
+	for _, addr := range addrs {
+		if strings.HasPrefix(string(addr), prefix) {
+			types = append(types, strings.TrimPrefix(string(addr), prefix))
+		}
+	}
+	sort.Strings(types)
+	return types, nil
+}
+
+func updateByAuthorTypeFn(ctx context.Context, seq int64, value interface{}, mlog multilog.MultiLog) error {
+	if nulled, ok := value.(error); ok {
+		if margaret.IsErrNulled(nulled) {
+			return nil
+		}
+		return nulled
+	}
+
+	msg, ok := value.(refs.Message)
+	if !ok {
+		return fmt.Errorf("index/byAuthorType: unexpected message type: %T", value)
+	}
+
+	typ, ok := ssb.ContentType(msg.ContentBytes())
+	if !ok {
+		return nil
+	}
+
+	sublog, err := mlog.Get(authorTypeAddr(msg.Author(), typ))
+	if err != nil {
+		return fmt.Errorf("index/byAuthorType: failed to open sublog: %w", err)
+	}
+	if _, err := sublog.Append(seq); err != nil {
+		return fmt.Errorf("index/byAuthorType: failed to append to sublog: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,135 @@
+// SPDX-FileCopyrightText: 2021 The Go-SSB Authors
+//
+// SPDX-License-Identifier: MIT
+
+package indexes_test
+
+import (
+	"context"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ssbc/go-luigi"
+	"github.com/ssbc/margaret"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ssbc/go-ssb"
+	refs "github.com/ssbc/go-ssb-refs"
+	"github.com/ssbc/go-ssb/indexes"
+	"github.com/ssbc/go-ssb/internal/asynctesting"
+	"github.com/ssbc/go-ssb/message"
+	"github.com/ssbc/go-ssb/multilogs"
+	"github.com/ssbc/go-ssb/repo"
+)
+
+func TestByAuthorType(t *testing.T) {
+	r := require.New(t)
+	ctx, cancel := context.WithCancel(context.TODO())
+	defer cancel()
+
+	rpath := filepath.Join("testrun", t.Name())
+	os.RemoveAll(rpath)
+
+	testRepo := repo.New(rpath)
+	rl, err := repo.OpenLog(testRepo)
+	r.NoError(err)
+	t.Cleanup(func() { rl.Close() })
+
+	userFeeds, userFeedsSnk, err := repo.OpenStandaloneMultiLog(testRepo, "testUsers", multilogs.UserFeedsUpdate)
+	r.NoError(err)
+	t.Cleanup(func() {
+		userFeeds.Close()
+		userFeedsSnk.Close()
+	})
+	usersErrc := asynctesting.ServeLog(ctx, "users", rl, userFeedsSnk, true)
+
+	byAuthorType, err := indexes.NewByAuthorType(testRepo)
+	r.NoError(err)
+	idxErrc := asynctesting.ServeLog(ctx, "byAuthorType", rl, byAuthorType, true)
+
+	staticRand := rand.New(rand.NewSource(42))
+	alice, err := ssb.NewKeyPair(staticRand, refs.RefAlgoFeedSSB1)
+	r.NoError(err)
+	bob, err := ssb.NewKeyPair(staticRand, refs.RefAlgoFeedSSB1)
+	r.NoError(err)
+
+	alicePub, err := message.OpenPublishLog(rl, userFeeds, alice)
+	r.NoError(err)
+	bobPub, err := message.OpenPublishLog(rl, userFeeds, bob)
+	r.NoError(err)
+
+	publish := func(pub ssb.Publisher, content interface{}) refs.MessageRef {
+		msg, err := pub.Publish(content)
+		r.NoError(err)
+		return msg.Key()
+	}
+	posts := []refs.MessageRef{
+		publish(alicePub, refs.NewPost("hello")),
+	}
+	contacts := []refs.MessageRef{
+		publish(alicePub, refs.NewContactFollow(bob.ID())),
+	}
+	publish(bobPub, refs.NewPost("not alice"))
+	posts = append(posts, publish(alicePub, refs.NewPost("world")))
+	// private content isn't indexed
+	publish(alicePub, "c2VjcmV0.box")
+	contacts = append(contacts, publish(alicePub, refs.NewContactBlock(bob.ID())))
+
+	// the last message is indexed once the second contact is there
+	r.Eventually(func() bool {
+		src, err := byAuthorType.Query(rl, alice.ID(), "contact")
+		r.NoError(err)
+		n := 0
+		for {
+			_, err := src.Next(ctx)
+			if luigi.IsEOS(err) {
+				return n == len(contacts)
+			}
+			r.NoError(err)
+			n++
+		}
+	}, time.Second, 10*time.Millisecond)
+
+	// readKeys reads n messages from src and returns their keys
+	readKeys := func(ctx context.Context, src luigi.Source, n int) []refs.MessageRef {
+		var keys []refs.MessageRef
+		for i := 0; i < n; i++ {
+			v, err := src.Next(ctx)
+			r.NoError(err)
+			msg, ok := v.(refs.Message)
+			r.True(ok, "not a message: %T", v)
+			r.True(msg.Author().Equal(alice.ID()))
+			keys = append(keys, msg.Key())
+		}
+		return keys
+	}
+
+	for typ, want := range map[string][]refs.MessageRef{"post": posts, "contact": contacts} {
+		src, err := byAuthorType.Query(rl, alice.ID(), typ)
+		r.NoError(err)
+		r.Equal(want, readKeys(ctx, src, len(want)), "type %s", typ)
+		_, err = src.Next(ctx)
+		r.True(luigi.IsEOS(err), "more %s messages than expected: %v", typ, err)
+	}
+
+	types, err := byAuthorType.Types(alice.ID())
+	r.NoError(err)
+	r.Equal([]string{"contact", "post"}, types)
+
+	// a live query gets the new messages
+	liveCtx, liveCancel := context.WithTimeout(ctx, 5*time.Second)
+	defer liveCancel()
+	src, err := byAuthorType.Query(rl, alice.ID(), "post", margaret.Live(true))
+	r.NoError(err)
+	publish(alicePub, refs.NewContactFollow(bob.ID()))
+	newPost := publish(alicePub, refs.NewPost("live"))
+	r.Equal(append(posts, newPost), readKeys(liveCtx, src, len(posts)+1))
+
+	cancel()
+	r.NoError(<-usersErrc)
+	r.NoError(<-idxErrc)
+	r.NoError(byAuthorType.Close())
+}
@@ -0,0 +1,59 @@
+// SPDX-FileCopyrightText: 2021 The Go-SSB Authors
+//
+// SPDX-License-Identifier: MIT
+
+package indexes
+
+import (
+	"fmt"
+
+	"github.com/dgraph-io/badger/v3"
+	refs "github.com/ssbc/go-ssb-refs"
+	"github.com/ssbc/margaret"
+	librarian "github.com/ssbc/margaret/indexes"
+	libbadger "github.com/ssbc/margaret/indexes/badger"
+
+	"github.com/ssbc/go-ssb/repo"
+)
+
+// ByKeyIndex maps message keys to their sequence in the root log.
+// Use it as a sink over the whole root log.
+// If the index is deleted, it starts again from the beginning of the log the next time it is served.
+type ByKeyIndex struct {
+	librarian.SinkIndex
+
+	db  *badger.DB
+	idx librarian.SeqSetterIndex
+}
+
+// NewByKey opens the by-key index of the repo.
+func NewByKey(r repo.Interface) (*ByKeyIndex, error) {
+	db, idx, sink, err := repo.OpenBadgerIndex(r, "bykey", func(db *badger.DB) (librarian.SeqSetterIndex, librarian.SinkIndex) {
+		idx := libbadger.NewIndexWithKeyPrefix(db, int64(0), []byte("byMsgRef"))
+		return idx, librarian.NewSinkIndex(updateGetFn, idx)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("index/bykey: failed to open: %w", err)
+	}
+
+	return &ByKeyIndex{
+		SinkIndex: sink,
+
+		db:  db,
+		idx: idx,
+	}, nil
+}
+
+// Close closes the index and its backing database.
+func (bk *ByKeyIndex) Close() error {
+	if err := bk.SinkIndex.Close(); err != nil {
+		return fmt.Errorf("index/bykey: failed to close index: %w", err)
+	}
+	return bk.db.Close()
+}
+
+// Get returns the message with the passed key from rootLog, which needs to be the log the index was built from.
+// If the key isn't known, the error wraps ssb.ErrMsgNotFound.
+func (bk *ByKeyIndex) Get(rootLog margaret.Log, key refs.MessageRef) (refs.Message, error) {
+	return repo.Get(rootLog, bk.idx, key)
+}
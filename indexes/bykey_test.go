@@ -0,0 +1,102 @@
+// SPDX-FileCopyrightText: 2021 The Go-SSB Authors
+//
+// SPDX-License-Identifier: MIT
+
+package indexes_test
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/ssbc/go-ssb"
+	refs "github.com/ssbc/go-ssb-refs"
+	"github.com/ssbc/go-ssb/indexes"
+	"github.com/ssbc/go-ssb/internal/asynctesting"
+	"github.com/ssbc/go-ssb/message"
+	"github.com/ssbc/go-ssb/multilogs"
+	"github.com/ssbc/go-ssb/repo"
+)
+
+func TestByKey(t *testing.T) {
+	r := require.New(t)
+	ctx, cancel := context.WithCancel(context.TODO())
+	defer cancel()
+
+	rpath := filepath.Join("testrun", t.Name())
+	os.RemoveAll(rpath)
+
+	testRepo := repo.New(rpath)
+	rl, err := repo.OpenLog(testRepo)
+	r.NoError(err)
+	t.Cleanup(func() { rl.Close() })
+
+	userFeeds, userFeedsSnk, err := repo.OpenStandaloneMultiLog(testRepo, "testUsers", multilogs.UserFeedsUpdate)
+	r.NoError(err)
+	t.Cleanup(func() {
+		userFeeds.Close()
+		userFeedsSnk.Close()
+	})
+	usersErrc := asynctesting.ServeLog(ctx, "users", rl, userFeedsSnk, true)
+
+	staticRand := rand.New(rand.NewSource(42))
+	alice, err := ssb.NewKeyPair(staticRand, refs.RefAlgoFeedSSB1)
+	r.NoError(err)
+
+	p, err := message.OpenPublishLog(rl, userFeeds, alice)
+	r.NoError(err)
+
+	var published []refs.Message
+	for i := 0; i < 5; i++ {
+		msg, err := p.Publish(refs.NewPost("hello"))
+		r.NoError(err)
+		published = append(published, msg)
+	}
+
+	assertAll := func(byKey *indexes.ByKeyIndex) {
+		for _, want := range published {
+			var got refs.Message
+			r.Eventually(func() bool {
+				got, err = byKey.Get(rl, want.Key())
+				return err == nil
+			}, time.Second, 10*time.Millisecond, "message %d not indexed", want.Seq())
+			r.True(got.Key().Equal(want.Key()))
+			r.Equal(want.Seq(), got.Seq())
+		}
+	}
+
+	byKey, err := indexes.NewByKey(testRepo)
+	r.NoError(err)
+	idxCtx, idxCancel := context.WithCancel(ctx)
+	byKeyErrc := asynctesting.ServeLog(idxCtx, "bykey", rl, byKey, true)
+
+	assertAll(byKey)
+
+	unknown, err := refs.NewMessageRefFromBytes(make([]byte, 32), refs.RefAlgoMessageSSB1)
+	r.NoError(err)
+	_, err = byKey.Get(rl, unknown)
+	r.True(errors.Is(err, ssb.ErrMsgNotFound), "wrong error: %v", err)
+
+	// drop the index and make sure it is built again
+	idxCancel()
+	r.NoError(<-byKeyErrc)
+	r.NoError(byKey.Close())
+	r.NoError(os.RemoveAll(testRepo.GetPath(repo.PrefixIndex, "bykey")))
+
+	byKey, err = indexes.NewByKey(testRepo)
+	r.NoError(err)
+	byKeyErrc = asynctesting.ServeLog(ctx, "bykey", rl, byKey, true)
+
+	assertAll(byKey)
+
+	cancel()
+	r.NoError(<-usersErrc)
+	r.NoError(<-byKeyErrc)
+	r.NoError(byKey.Close())
+}
@@ -0,0 +1,204 @@
+// SPDX-FileCopyrightText: 2021 The Go-SSB Authors
+//
+// SPDX-License-Identifier: MIT
+
+package indexes
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/dgraph-io/badger/v3"
+	"github.com/ssbc/go-luigi"
+	"github.com/ssbc/margaret"
+	librarian "github.com/ssbc/margaret/indexes"
+	libbadger "github.com/ssbc/margaret/indexes/badger"
+
+	refs "github.com/ssbc/go-ssb-refs"
+	"github.com/ssbc/go-ssb/repo"
+)
+
+// MaxClockSkew is how far the claimed timestamp of a message can be ahead of the time it was received
+// before the ByTimeIndex treats the message as skewed.
+const MaxClockSkew = 10 * time.Minute
+
+// TimedSeq is an entry of the ByTimeIndex.
+type TimedSeq struct {
+	// Seq is the sequence of the message in the root log.
+	Seq int64
+
+	// Claimed is the timestamp the author asserted, Received when it was added to the root log.
+	Claimed  time.Time
+	Received time.Time
+
+	// Skewed is true if Claimed is more than MaxClockSkew after Received.
+	// Skewed messages are sorted by their received instead of their claimed time.
+	Skewed bool
+}
+
+// timedEntry is what is stored per message. The timestamps are in milliseconds.
+type timedEntry struct {
+	Seq      int64 `json:"seq"`
+	Claimed  int64 `json:"claimed"`
+	Received int64 `json:"received"`
+	Skewed   bool  `json:"skewed,omitempty"`
+}
+
+func (e timedEntry) timedSeq() TimedSeq {
+	return TimedSeq{
+		Seq:      e.Seq,
+		Claimed:  time.UnixMilli(e.Claimed),
+		Received: time.UnixMilli(e.Received),
+		Skewed:   e.Skewed,
+	}
+}
+
+var byTimeKeyPrefix = []byte("bytime")
+
+// the two orderings of the index
+const (
+	byTimeClaimed  byte = 'c'
+	byTimeReceived byte = 'r'
+)
+
+// timed keys are the ordering, the timestamp and the root log sequence
+const byTimeKeyLen = 1 + 8 + 8
+
+// ByTimeIndex orders the messages of the root log by their timestamps, across all feeds.
+// Use it as a sink over the whole root log.
+// Messages which are nulled after they were indexed keep their entries, resolving them returns margaret's nulled error.
+type ByTimeIndex struct {
+	librarian.SinkIndex
+
+	db  *badger.DB
+	idx librarian.SeqSetterIndex
+}
+
+// NewByTime opens the timestamp index of the repo.
+func NewByTime(r repo.Interface) (*ByTimeIndex, error) {
+	db, idx, sink, err := repo.OpenBadgerIndex(r, "bytime", func(db *badger.DB) (librarian.SeqSetterIndex, librarian.SinkIndex) {
+		idx := libbadger.NewIndexWithKeyPrefix(db, timedEntry{}, byTimeKeyPrefix)
+		return idx, librarian.NewSinkIndex(updateByTimeFn, idx)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("index/bytime: failed to open: %w", err)
+	}
+
+	return &ByTimeIndex{
+		SinkIndex: sink,
+
+		db:  db,
+		idx: idx,
+	}, nil
+}
+
+// Close closes the index and its backing database.
+func (bt *ByTimeIndex) Close() error {
+	if err := bt.SinkIndex.Close(); err != nil {
+		return fmt.Errorf("index/bytime: failed to close index: %w", err)
+	}
+	return bt.db.Close()
+}
+
+// TimeRange returns a source of TimedSeq values for the messages which claim to be published from (inclusive) to (exclusive), oldest first.
+// Skewed messages are included by the time they were received.
+func (bt *ByTimeIndex) TimeRange(from, to time.Time) (luigi.Source, error) {
+	return bt.query(byTimeClaimed, from, to)
+}
+
+// ReceivedRange is like TimeRange but uses the time the messages were received.
+func (bt *ByTimeIndex) ReceivedRange(from, to time.Time) (luigi.Source, error) {
+	return bt.query(byTimeReceived, from, to)
+}
+
+func (bt *ByTimeIndex) query(ordering byte, from, to time.Time) (luigi.Source, error) {
+	// write pending updates, so that the iteration below sees them
+	if f, ok := bt.idx.(interface{ Flush() error }); ok {
+		if err := f.Flush(); err != nil {
+			return nil, fmt.Errorf("index/bytime: failed to flush pending updates: %w", err)
+		}
+	}
+
+	prefix := append(append([]byte{}, byTimeKeyPrefix...), ordering)
+	start := append(append([]byte{}, byTimeKeyPrefix...), byTimeKey(ordering, from.UnixMilli(), 0)...)
+	end := append(append([]byte{}, byTimeKeyPrefix...), byTimeKey(ordering, to.UnixMilli(), 0)...)
+
+	var src luigi.SliceSource
+	err := bt.db.View(func(txn *badger.Txn) error {
+		iter := txn.NewIterator(badger.DefaultIteratorOptions)
+		defer iter.Close()
+
+		for iter.Seek(start); iter.ValidForPrefix(prefix); iter.Next() {
+			it := iter.Item()
+			k := it.Key()
+			if string(k) >= string(end) {
+				break
+			}
+			if len(k) != len(byTimeKeyPrefix)+byTimeKeyLen {
+				continue
+			}
+
+			var entry timedEntry
+			err := it.Value(func(v []byte) error {
+				return json.Unmarshal(v, &entry)
+			})
+			if err != nil {
+				return fmt.Errorf("invalid entry: %w", err)
+			}
+
+			src = append(src, entry.timedSeq())
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("index/bytime: failed to read entries: %w", err)
+	}
+
+	return &src, nil
+}
+
+// byTimeKey encodes ts so that the keys sort by time, including timestamps before 1970.
+func byTimeKey(ordering byte, ts int64, seq int64) []byte {
+	k := make([]byte, byTimeKeyLen)
+	k[0] = ordering
+	binary.BigEndian.PutUint64(k[1:], uint64(ts)^(1<<63))
+	binary.BigEndian.PutUint64(k[9:], uint64(seq))
+	return k
+}
+
+func updateByTimeFn(ctx context.Context, seq int64, val interface{}, idx librarian.SetterIndex) error {
+	msg, ok := val.(refs.Message)
+	if !ok {
+		err, ok := val.(error)
+		if ok && margaret.IsErrNulled(err) {
+			return nil
+		}
+		return fmt.Errorf("index/bytime: unexpected message type: %T", val)
+	}
+
+	entry := timedEntry{
+		Seq:      seq,
+		Claimed:  msg.Claimed().UnixMilli(),
+		Received: msg.Received().UnixMilli(),
+	}
+
+	// don't let messages from the future stay on top of everything
+	sortBy := entry.Claimed
+	if !msg.Received().IsZero() && entry.Claimed > entry.Received+MaxClockSkew.Milliseconds() {
+		entry.Skewed = true
+		sortBy = entry.Received
+	}
+
+	for _, k := range [][]byte{
+		byTimeKey(byTimeClaimed, sortBy, seq),
+		byTimeKey(byTimeReceived, entry.Received, seq),
+	} {
+		if err := idx.Set(ctx, librarian.Addr(k), entry); err != nil {
+			return fmt.Errorf("index/bytime: failed to set entry (seq: %d): %w", seq, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,107 @@
+// SPDX-FileCopyrightText: 2021 The Go-SSB Authors
+//
+// SPDX-License-Identifier: MIT
+
+package indexes_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ssbc/go-luigi"
+	"github.com/ssbc/margaret/mem"
+	"github.com/stretchr/testify/require"
+
+	refs "github.com/ssbc/go-ssb-refs"
+	"github.com/ssbc/go-ssb/indexes"
+	"github.com/ssbc/go-ssb/internal/asynctesting"
+	"github.com/ssbc/go-ssb/repo"
+)
+
+func TestByTime(t *testing.T) {
+	r := require.New(t)
+
+	rpath := filepath.Join("testrun", t.Name())
+	os.RemoveAll(rpath)
+	testRepo := repo.New(rpath)
+
+	alice := activityTestFeed(t, 1)
+	bob := activityTestFeed(t, 2)
+
+	start := time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC)
+	at := func(minutes int) time.Time { return start.Add(time.Duration(minutes) * time.Minute) }
+
+	rl := mem.New()
+	appendMsg := func(author refs.FeedRef, claimed, received int) {
+		_, err := rl.Append(byTimeTestMsg{
+			activityTestMsg: activityTestMsg{author: author, claimed: at(claimed)},
+			received:        at(received),
+		})
+		r.NoError(err)
+	}
+
+	appendMsg(alice, 0, 30)   // 0
+	appendMsg(bob, 10, 30)    // 1
+	appendMsg(alice, 5, 31)   // 2
+	appendMsg(bob, 20, 32)    // 3
+	appendMsg(alice, -60, 33) // 4: before start
+	appendMsg(bob, 600, 34)   // 5: claims to be from the future
+	appendMsg(alice, 40, 40)  // 6
+
+	byTime, err := indexes.NewByTime(testRepo)
+	r.NoError(err)
+	r.NoError(<-asynctesting.ServeLog(context.TODO(), "bytime", rl, byTime, false))
+
+	collect := func(src luigi.Source, err error) []indexes.TimedSeq {
+		r.NoError(err)
+		var got []indexes.TimedSeq
+		for {
+			v, err := src.Next(context.TODO())
+			if luigi.IsEOS(err) {
+				return got
+			}
+			r.NoError(err)
+			got = append(got, v.(indexes.TimedSeq))
+		}
+	}
+	seqs := func(entries []indexes.TimedSeq) []int64 {
+		var s []int64
+		for _, e := range entries {
+			s = append(s, e.Seq)
+		}
+		return s
+	}
+
+	got := collect(byTime.TimeRange(at(0), at(20)))
+	r.Equal([]int64{0, 2, 1}, seqs(got))
+	r.True(got[1].Claimed.Equal(at(5)))
+	r.True(got[1].Received.Equal(at(31)))
+	r.False(got[1].Skewed)
+
+	// the upper bound is exclusive, the lower one inclusive
+	r.Equal([]int64{2, 1, 3}, seqs(collect(byTime.TimeRange(at(5), at(21)))))
+	r.Equal([]int64{4}, seqs(collect(byTime.TimeRange(at(-120), at(0)))))
+
+	// the skewed message is sorted by its received time but keeps its claim
+	got = collect(byTime.TimeRange(at(30), at(60)))
+	r.Equal([]int64{5, 6}, seqs(got))
+	r.True(got[0].Skewed)
+	r.True(got[0].Claimed.Equal(at(600)))
+	r.Empty(collect(byTime.TimeRange(at(500), at(700))))
+
+	r.Equal([]int64{2, 3, 4}, seqs(collect(byTime.ReceivedRange(at(31), at(34)))))
+
+	r.NoError(byTime.Close())
+}
+
+// byTimeTestMsg adds a received timestamp to activityTestMsg
+type byTimeTestMsg struct {
+	activityTestMsg
+
+	received time.Time
+}
+
+func (msg byTimeTestMsg) Received() time.Time { return msg.received }
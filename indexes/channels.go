@@ -0,0 +1,194 @@
+// SPDX-FileCopyrightText: 2021 The Go-SSB Authors
+//
+// SPDX-License-Identifier: MIT
+
+package indexes
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/ssbc/go-luigi"
+	"github.com/ssbc/go-luigi/mfr"
+	refs "github.com/ssbc/go-ssb-refs"
+	"github.com/ssbc/margaret"
+	librarian "github.com/ssbc/margaret/indexes"
+	"github.com/ssbc/margaret/multilog"
+
+	"github.com/ssbc/go-ssb/internal/mutil"
+	"github.com/ssbc/go-ssb/repo"
+)
+
+// ChannelsIndex is a multilog of the sequences of messages in the root log by channel.
+// A message is part of the channel in its channel field and of the hashtags it mentions,
+// either in its mentions (as a link starting with #) or inline in its text.
+// Use it as a sink over the whole root log.
+type ChannelsIndex struct {
+	librarian.SinkIndex
+
+	mlog multilog.MultiLog
+}
+
+// NewChannels opens the channels index of the repo.
+func NewChannels(r repo.Interface) (*ChannelsIndex, error) {
+	mlog, sink, err := repo.OpenStandaloneMultiLog(r, "channels", updateChannelsFn)
+	if err != nil {
+		return nil, fmt.Errorf("index/channels: failed to open: %w", err)
+	}
+
+	return &ChannelsIndex{
+		SinkIndex: sink,
+
+		mlog: mlog,
+	}, nil
+}
+
+// Close closes the index and its backing multilog.
+func (ci *ChannelsIndex) Close() error {
+	if err := ci.SinkIndex.Close(); err != nil {
+		return fmt.Errorf("index/channels: failed to close index: %w", err)
+	}
+	return ci.mlog.Close()
+}
+
+// List returns the names of all the channels, as returned by NormalizeChannel.
+func (ci *ChannelsIndex) List() ([]string, error) {
+	addrs, err := ci.mlog.List()
+	if err != nil {
+		return nil, fmt.Errorf("index/channels: failed to list channels: %w", err)
+	}
+
+	names := make([]string, len(addrs))
+	for i, addr := range addrs {
+		names[i] = string(addr)
+	}
+	return names, nil
+}
+
+// Query returns a source of the refs.Message values in channel, newest first.
+// rootLog needs to be the log the index was built from. A negative limit means all of them.
+// Nulled messages are skipped.
+func (ci *ChannelsIndex) Query(rootLog margaret.Log, channel string, limit int) (luigi.Source, error) {
+	name := NormalizeChannel(channel)
+	if name == "" {
+		return nil, fmt.Errorf("index/channels: invalid channel name: %q", channel)
+	}
+
+	sublog, err := ci.mlog.Get(librarian.Addr(name))
+	if err != nil {
+		return nil, fmt.Errorf("index/channels: failed to open sublog: %w", err)
+	}
+
+	src, err := mutil.Indirect(rootLog, sublog).Query(
+		margaret.Reverse(true),
+		margaret.Limit(limit),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("index/channels: invalid query: %w", err)
+	}
+
+	return mfr.SourceFilter(src, func(ctx context.Context, v interface{}) (bool, error) {
+		if err, ok := v.(error); ok {
+			if margaret.IsErrNulled(err) {
+				return false, nil
+			}
+			return false, err
+		}
+		return true, nil
+	}), nil
+}
+
+// NormalizeChannel returns the name a channel is indexed by: lowercase and without a leading #.
+func NormalizeChannel(name string) string {
+	name = strings.TrimSpace(name)
+	name = strings.TrimLeft(name, "#")
+	return strings.ToLower(name)
+}
+
+// inlineHashtag matches #tags at the start of the text or after whitespace,
+// so that links with fragments and the like aren't picked up.
+var inlineHashtag = regexp.MustCompile(`(?:^|\s)#([^\s#.,;:!?()\[\]{}"'<>]+)`)
+
+// channelContent has the fields of a message which reference channels
+type channelContent struct {
+	Channel  interface{}     `json:"channel"`
+	Text     interface{}     `json:"text"`
+	Mentions json.RawMessage `json:"mentions"`
+}
+
+// messageChannels returns the normalized channels of the content, without duplicates.
+func messageChannels(content []byte) []string {
+	var c channelContent
+	if err := json.Unmarshal(content, &c); err != nil {
+		// private or unexpected content
+		return nil
+	}
+
+	var (
+		names []string
+		seen  = make(map[string]struct{})
+	)
+	add := func(name string) {
+		name = NormalizeChannel(name)
+		if name == "" {
+			return
+		}
+		if _, has := seen[name]; has {
+			return
+		}
+		seen[name] = struct{}{}
+		names = append(names, name)
+	}
+
+	if channel, ok := c.Channel.(string); ok {
+		add(channel)
+	}
+
+	var mentions []struct {
+		Link string `json:"link"`
+	}
+	if err := json.Unmarshal(c.Mentions, &mentions); err == nil {
+		for _, m := range mentions {
+			if strings.HasPrefix(m.Link, "#") {
+				add(m.Link)
+			}
+		}
+	}
+
+	if text, ok := c.Text.(string); ok {
+		for _, match := range inlineHashtag.FindAllStringSubmatch(text, -1) {
+			add(match[1])
+		}
+	}
+
+	return names
+}
+
+func updateChannelsFn(ctx context.Context, seq int64, value interface{}, mlog multilog.MultiLog) error {
+	if nulled, ok := value.(error); ok {
+		if margaret.IsErrNulled(nulled) {
+			return nil
+		}
+		return nulled
+	}
+
+	msg, ok := value.(refs.Message)
+	if !ok {
+		return fmt.Errorf("index/channels: unexpected message type: %T", value)
+	}
+
+	for _, name := range messageChannels(msg.ContentBytes()) {
+		sublog, err := mlog.Get(librarian.Addr(name))
+		if err != nil {
+			return fmt.Errorf("index/channels: failed to open sublog for %q: %w", name, err)
+		}
+
+		if _, err := sublog.Append(seq); err != nil {
+			return fmt.Errorf("index/channels: failed to append to %q: %w", name, err)
+		}
+	}
+	return nil
+}
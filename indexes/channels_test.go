@@ -0,0 +1,127 @@
+// SPDX-FileCopyrightText: 2021 The Go-SSB Authors
+//
+// SPDX-License-Identifier: MIT
+
+package indexes_test
+
+import (
+	"context"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/ssbc/go-luigi"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ssbc/go-ssb"
+	refs "github.com/ssbc/go-ssb-refs"
+	"github.com/ssbc/go-ssb/indexes"
+	"github.com/ssbc/go-ssb/internal/asynctesting"
+	"github.com/ssbc/go-ssb/internal/storedrefs"
+	"github.com/ssbc/go-ssb/message"
+	"github.com/ssbc/go-ssb/multilogs"
+	"github.com/ssbc/go-ssb/repo"
+)
+
+func TestChannels(t *testing.T) {
+	r := require.New(t)
+	ctx, cancel := context.WithCancel(context.TODO())
+	defer cancel()
+
+	rpath := filepath.Join("testrun", t.Name())
+	os.RemoveAll(rpath)
+
+	testRepo := repo.New(rpath)
+	rl, err := repo.OpenLog(testRepo)
+	r.NoError(err)
+	t.Cleanup(func() { rl.Close() })
+
+	userFeeds, userFeedsSnk, err := repo.OpenStandaloneMultiLog(testRepo, "testUsers", multilogs.UserFeedsUpdate)
+	r.NoError(err)
+	t.Cleanup(func() {
+		userFeeds.Close()
+		userFeedsSnk.Close()
+	})
+	usersErrc := asynctesting.ServeLog(ctx, "users", rl, userFeedsSnk, true)
+
+	channels, err := indexes.NewChannels(testRepo)
+	r.NoError(err)
+	channelsErrc := asynctesting.ServeLog(ctx, "channels", rl, channels, true)
+
+	staticRand := rand.New(rand.NewSource(42))
+	alice, err := ssb.NewKeyPair(staticRand, refs.RefAlgoFeedSSB1)
+	r.NoError(err)
+
+	p, err := message.OpenPublishLog(rl, userFeeds, alice)
+	r.NoError(err)
+
+	type post map[string]interface{}
+	posts := []post{
+		{"type": "post", "text": "hello", "channel": "#GoLang"},
+		{"type": "post", "text": "about #ssb and #golang."},
+		// the same channel twice only counts once
+		{"type": "post", "text": "#SSB rocks", "channel": "ssb"},
+		{"type": "post", "text": "dinner", "mentions": []interface{}{
+			map[string]interface{}{"link": "#Cooking"},
+			map[string]interface{}{"link": alice.ID().String()},
+		}},
+		{"type": "post", "text": "no channels on https://example.com/#anchor or x#y"},
+	}
+
+	sublog, err := userFeeds.Get(storedrefs.Feed(alice.ID()))
+	r.NoError(err)
+	for _, content := range posts {
+		msg, err := p.Publish(content)
+		r.NoError(err)
+
+		// the sequence of the next message comes from the index
+		r.Eventually(func() bool {
+			return sublog.Seq() == msg.Seq()-1
+		}, time.Second, 10*time.Millisecond)
+	}
+
+	query := func(channel string, limit int) []int64 {
+		src, err := channels.Query(rl, channel, limit)
+		r.NoError(err)
+
+		var seqs []int64
+		for {
+			v, err := src.Next(ctx)
+			if luigi.IsEOS(err) {
+				return seqs
+			}
+			r.NoError(err)
+			msg, ok := v.(refs.Message)
+			r.True(ok, "wrong type: %T", v)
+			seqs = append(seqs, msg.Seq())
+		}
+	}
+
+	r.Eventually(func() bool {
+		return len(query("cooking", -1)) == 1
+	}, time.Second, 10*time.Millisecond, "index not in sync")
+
+	// newest first
+	r.Equal([]int64{2, 1}, query("golang", -1))
+	r.Equal([]int64{3, 2}, query("#SSB", -1))
+	r.Equal([]int64{3}, query("ssb", 1))
+	r.Equal([]int64{4}, query("Cooking", -1))
+	r.Empty(query("anchor", -1))
+	r.Empty(query("y", -1))
+
+	_, err = channels.Query(rl, "#", -1)
+	r.Error(err)
+
+	names, err := channels.List()
+	r.NoError(err)
+	sort.Strings(names)
+	r.Equal([]string{"cooking", "golang", "ssb"}, names)
+
+	cancel()
+	r.NoError(<-usersErrc)
+	r.NoError(<-channelsErrc)
+	r.NoError(channels.Close())
+}
@@ -29,6 +29,7 @@ type mapOfSinks map[*muxrpc.ByteSink]sinkContext
 type sinkContext struct {
 	ctx   context.Context
 	until int64
+	keep  func(msg []byte) bool
 }
 
 var _ margaret.Seqer = (*MultiSink)(nil)
@@ -58,6 +59,23 @@ func (f *MultiSink) Register(
 	}
 }
 
+// RegisterWithFilter is like Register but only passes on the messages for which keep returns true.
+// The skipped messages still count towards until.
+func (f *MultiSink) RegisterWithFilter(
+	ctx context.Context,
+	sink *muxrpc.ByteSink,
+	until int64,
+	keep func(msg []byte) bool,
+) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.sinks[sink] = sinkContext{
+		ctx:   ctx,
+		until: until,
+		keep:  keep,
+	}
+}
+
 func (f *MultiSink) Unregister(
 	sink *muxrpc.ByteSink,
 ) {
@@ -88,7 +106,10 @@ func (f *MultiSink) Send(msg []byte) {
 	defer f.mu.Unlock()
 
 	for s, ctx := range f.sinks {
-		_, err := s.Write(msg)
+		var err error
+		if ctx.keep == nil || ctx.keep(msg) {
+			_, err = s.Write(msg)
+		}
 		if err != nil || ctx.until <= f.seq {
 			delete(f.sinks, s)
 		}
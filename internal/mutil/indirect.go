@@ -73,7 +73,11 @@ func (il indirectLog) Query(args ...margaret.QuerySpec) (luigi.Source, error) {
 
 		ret, err := il.root.Get(vSeq)
 		if err != nil {
-			return nil, err
+			// like a query on the root log, nulled messages are passed on as values so that they don't end the stream
+			if !margaret.IsErrNulled(err) {
+				return nil, err
+			}
+			ret = margaret.ErrNulled
 		}
 
 		if isWrapped {
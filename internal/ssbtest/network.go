@@ -0,0 +1,217 @@
+// SPDX-FileCopyrightText: 2021 The Go-SSB Authors
+//
+// SPDX-License-Identifier: MIT
+
+// Package ssbtest sets up networks of bots for integration tests.
+package ssbtest
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.mindeco.de/log"
+
+	"github.com/ssbc/go-ssb"
+	refs "github.com/ssbc/go-ssb-refs"
+	"github.com/ssbc/go-ssb/internal/testutils"
+	"github.com/ssbc/go-ssb/sbot"
+)
+
+// DefaultTimeout is how long WaitFor waits for a message to arrive.
+const DefaultTimeout = 10 * time.Second
+
+// Option changes how Network sets up the bots.
+type Option func(*config)
+
+type config struct {
+	hops     uint
+	botOpts  []sbot.Option
+	nodeOpts map[int][]sbot.Option
+}
+
+// WithHops sets how far the bots replicate and accept peers, see sbot.WithHops. The default is 2.
+func WithHops(h uint) Option {
+	return func(c *config) {
+		c.hops = h
+	}
+}
+
+// WithBotOptions passes opts to all the bots. They are applied after the ones of Network, so they can override them.
+func WithBotOptions(opts ...sbot.Option) Option {
+	return func(c *config) {
+		c.botOpts = append(c.botOpts, opts...)
+	}
+}
+
+// WithNodeOptions passes opts only to node i, after the ones of WithBotOptions.
+func WithNodeOptions(i int, opts ...sbot.Option) Option {
+	return func(c *config) {
+		if c.nodeOpts == nil {
+			c.nodeOpts = make(map[int][]sbot.Option)
+		}
+		c.nodeOpts[i] = append(c.nodeOpts[i], opts...)
+	}
+}
+
+// Net is a set of bots which share an app key, made by Network.
+// The bots don't follow or know each other until Follow and Connect are used.
+type Net struct {
+	t testing.TB
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	serve  sync.WaitGroup
+
+	// Nodes are the bots of the network. The other methods take their index.
+	Nodes []*sbot.Sbot
+}
+
+// Network starts n bots on localhost with their repos in testrun/<test name>/node-<i>.
+// They are shut down when the test ends.
+func Network(t testing.TB, n int, opts ...Option) *Net {
+	r := require.New(t)
+
+	cfg := config{hops: 2}
+	for _, o := range opts {
+		o(&cfg)
+	}
+
+	testPath := filepath.Join("testrun", t.Name())
+	os.RemoveAll(testPath)
+
+	appKey := make([]byte, 32)
+	_, err := rand.Read(appKey)
+	r.NoError(err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	net := &Net{
+		t:      t,
+		ctx:    ctx,
+		cancel: cancel,
+	}
+	t.Cleanup(net.close)
+
+	logger := log.NewNopLogger()
+	if testing.Verbose() {
+		logger = testutils.NewRelativeTimeLogger(nil)
+	}
+
+	for i := 0; i < n; i++ {
+		botOpts := append([]sbot.Option{
+			sbot.WithAppKey(appKey),
+			sbot.WithContext(ctx),
+			sbot.WithInfo(log.With(logger, "node", i)),
+			sbot.WithRepoPath(filepath.Join(testPath, fmt.Sprintf("node-%d", i))),
+			sbot.WithListenAddr("localhost:0"),
+			sbot.WithHops(cfg.hops),
+		}, cfg.botOpts...)
+		botOpts = append(botOpts, cfg.nodeOpts[i]...)
+
+		bot, err := sbot.New(botOpts...)
+		r.NoError(err, "failed to make node %d", i)
+		net.Nodes = append(net.Nodes, bot)
+
+		net.serve.Add(1)
+		go func(i int) {
+			defer net.serve.Done()
+			err := bot.Network.Serve(ctx)
+			if err != nil && ctx.Err() == nil && !errors.Is(err, ssb.ErrShuttingDown) {
+				t.Errorf("ssbtest: node %d stopped serving: %s", i, err)
+			}
+		}(i)
+	}
+
+	return net
+}
+
+func (net *Net) close() {
+	net.cancel()
+	for _, bot := range net.Nodes {
+		bot.Shutdown()
+	}
+	for i, bot := range net.Nodes {
+		if err := bot.Close(); err != nil {
+			net.t.Errorf("ssbtest: failed to close node %d: %s", i, err)
+		}
+	}
+	net.serve.Wait()
+}
+
+// ID returns the feed of node i.
+func (net *Net) ID(i int) refs.FeedRef {
+	return net.Nodes[i].KeyPair.ID()
+}
+
+// Follow makes from follow to and waits until the graph of from has the follow.
+func (net *Net) Follow(from, to int) {
+	r := require.New(net.t)
+	_, err := ssb.PublishFollow(net.Nodes[from].PublishLog, net.ID(to), true)
+	r.NoError(err)
+	r.Eventually(func() bool {
+		fg, err := net.Nodes[from].GraphBuilder.Build()
+		return err == nil && fg.Follows(net.ID(from), net.ID(to))
+	}, DefaultTimeout, 10*time.Millisecond, "node %d doesn't follow node %d", from, to)
+
+	// the bot only updates its replication list once no new messages came in for a while,
+	// don't wait for that before accepting connections from to
+	net.Nodes[from].Replicate(net.ID(to))
+}
+
+// Friends makes a and b follow each other.
+func (net *Net) Friends(a, b int) {
+	net.Follow(a, b)
+	net.Follow(b, a)
+}
+
+// Connect dials from to to and waits until both have the connection.
+func (net *Net) Connect(from, to int) {
+	r := require.New(net.t)
+	err := net.Nodes[from].Network.Connect(net.ctx, net.Nodes[to].Network.GetListenAddr())
+	r.NoError(err, "node %d failed to connect to node %d", from, to)
+	r.Eventually(func() bool {
+		_, hasTo := net.Nodes[from].Network.GetEndpointFor(net.ID(to))
+		_, hasFrom := net.Nodes[to].Network.GetEndpointFor(net.ID(from))
+		return hasTo && hasFrom
+	}, DefaultTimeout, 10*time.Millisecond, "node %d and node %d are not connected", from, to)
+}
+
+// Chain makes each node friends with the next one and then connects them, node 0 to 1, 1 to 2 and so on.
+func (net *Net) Chain() {
+	for i := 0; i+1 < len(net.Nodes); i++ {
+		net.Friends(i, i+1)
+	}
+	for i := 0; i+1 < len(net.Nodes); i++ {
+		net.Connect(i, i+1)
+	}
+}
+
+// Publish publishes content on the feed of node i.
+func (net *Net) Publish(i int, content interface{}) refs.Message {
+	msg, err := net.Nodes[i].PublishLog.Publish(content)
+	require.NoError(net.t, err, "node %d failed to publish", i)
+	return msg
+}
+
+// Has returns true if node i stored msg.
+func (net *Net) Has(i int, msg refs.Message) bool {
+	note, err := net.Nodes[i].CurrentSequence(msg.Author())
+	if err != nil {
+		return false
+	}
+	return note.Seq >= msg.Seq()
+}
+
+// WaitFor fails the test if node i doesn't get msg within DefaultTimeout.
+func (net *Net) WaitFor(i int, msg refs.Message) {
+	require.Eventually(net.t, func() bool {
+		return net.Has(i, msg)
+	}, DefaultTimeout, 50*time.Millisecond, "node %d didn't get %s", i, msg.Key().ShortSigil())
+}
@@ -0,0 +1,65 @@
+// SPDX-FileCopyrightText: 2021 The Go-SSB Authors
+//
+// SPDX-License-Identifier: MIT
+
+package ssbtest
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	refs "github.com/ssbc/go-ssb-refs"
+	"github.com/ssbc/go-ssb/internal/storedrefs"
+	"github.com/ssbc/go-ssb/message"
+	"github.com/ssbc/go-ssb/sbot"
+)
+
+func TestNetworkReplicateChain(t *testing.T) {
+	net := Network(t, 3, WithHops(1))
+
+	// node 2 is only connected to node 1 but follows node 0 as well,
+	// so it has to get the feed of node 0 through node 1
+	net.Follow(2, 0)
+	net.Chain()
+
+	msg := net.Publish(0, refs.NewPost("hello from the start of the chain"))
+	net.WaitFor(1, msg)
+	net.WaitFor(2, msg)
+
+	reply := net.Publish(2, refs.NewPost("hello back"))
+	net.WaitFor(1, reply)
+}
+
+func TestNetworkSlicedFeed(t *testing.T) {
+	r := require.New(t)
+
+	net := Network(t, 2, WithBotOptions(
+		sbot.DisableEBT(true),
+		sbot.WithSlicedFeeds(5),
+	))
+
+	// node 1 replicates node 0 without following it, so it only fetches the latest messages
+	net.Follow(0, 1)
+	net.Nodes[1].Replicate(net.ID(0))
+
+	var last refs.Message
+	for i := 0; i < 19; i++ {
+		last = net.Publish(0, refs.NewPost(fmt.Sprintf("post %d", i)))
+	}
+
+	net.Connect(1, 0)
+	net.WaitFor(1, last)
+
+	note, err := net.Nodes[1].CurrentSequence(net.ID(0))
+	r.NoError(err)
+	r.EqualValues(20, note.Seq)
+
+	userLog, err := net.Nodes[1].Users.Get(storedrefs.Feed(net.ID(0)))
+	r.NoError(err)
+	r.EqualValues(4, userLog.Seq())
+	origin, err := message.FeedOrigin(net.Nodes[1].ReceiveLog, userLog)
+	r.NoError(err)
+	r.EqualValues(16, origin)
+}
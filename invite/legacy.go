@@ -7,12 +7,10 @@
 package invite
 
 import (
-	"bytes"
 	"context"
 	"fmt"
 
 	"github.com/ssbc/go-muxrpc/v2"
-	"github.com/ssbc/go-ssb"
 	refs "github.com/ssbc/go-ssb-refs"
 	"github.com/ssbc/go-ssb/client"
 )
@@ -22,7 +20,7 @@ import (
 // and place an 'invite.use' rpc call with it's longTerm key.
 // If the peer responds with a message it returns nil
 func Redeem(ctx context.Context, tok Token, longTerm refs.FeedRef) error {
-	inviteKeyPair, err := ssb.NewKeyPair(bytes.NewReader(tok.Seed[:]), refs.RefAlgoFeedSSB1)
+	inviteKeyPair, err := tok.KeyPair()
 	if err != nil {
 		return fmt.Errorf("invite: couldn't make keypair from seed: %w", err)
 	}
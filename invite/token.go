@@ -5,6 +5,7 @@
 package invite
 
 import (
+	"crypto/rand"
 	"encoding/base64"
 	"errors"
 	"fmt"
@@ -14,6 +15,7 @@ import (
 
 	"github.com/ssbc/go-netwrap"
 	"github.com/ssbc/go-secretstream"
+	"github.com/ssbc/go-ssb"
 	refs "github.com/ssbc/go-ssb-refs"
 )
 
@@ -26,6 +28,31 @@ type Token struct {
 	Seed [32]byte
 }
 
+// NewToken returns a token for the pub peer, which listens on host and port, with a new random seed.
+// A hostname is resolved, like ParseLegacyToken does.
+// The pub only accepts the token if it knows the seed, see legacyinvites.Service.Create.
+func NewToken(peer refs.FeedRef, host string, port int) (Token, error) {
+	tcpAddr, err := resolveTCPAddr(host, port)
+	if err != nil {
+		return Token{}, err
+	}
+
+	tok := Token{
+		Peer:    peer,
+		Address: netwrap.WrapAddr(tcpAddr, secretstream.Addr{PubKey: peer.PubKey()}),
+	}
+	if _, err := rand.Read(tok.Seed[:]); err != nil {
+		return Token{}, fmt.Errorf("invite: failed to roll seed: %w", err)
+	}
+	return tok, nil
+}
+
+// KeyPair returns the guest identity which is derived from the seed.
+// The token is redeemed with it and the pub uses its public key to find the invite.
+func (c Token) KeyPair() (ssb.KeyPair, error) {
+	return ssb.KeyPairFromSeed(c.Seed[:], refs.RefAlgoFeedSSB1)
+}
+
 func (c Token) String() string {
 	addr := netwrap.GetAddr(c.Address, "tcp")
 	if addr == nil {
@@ -126,22 +153,31 @@ func ParseLegacyToken(input string) (Token, error) {
 	}
 	copy(c.Seed[:], seed)
 
-	tcpAddr := net.TCPAddr{}
-	tcpAddr.IP = net.ParseIP(split[0])
-	if tcpAddr.IP == nil {
-		resolvedAddr, err := net.ResolveIPAddr("ip", split[0])
-		if err != nil {
-			// could be tor or other kind of overlay?
-			return Token{}, err
-		}
-		tcpAddr.IP = resolvedAddr.IP
+	port, err := strconv.Atoi(split[1])
+	if err != nil {
+		return Token{}, err
 	}
-	tcpAddr.Port, err = strconv.Atoi(split[1])
+
+	tcpAddr, err := resolveTCPAddr(split[0], port)
 	if err != nil {
 		return Token{}, err
 	}
 
-	c.Address = netwrap.WrapAddr(&tcpAddr, secretstream.Addr{PubKey: ref.PubKey()})
+	c.Address = netwrap.WrapAddr(tcpAddr, secretstream.Addr{PubKey: ref.PubKey()})
 
 	return c, nil
 }
+
+func resolveTCPAddr(host string, port int) (*net.TCPAddr, error) {
+	tcpAddr := net.TCPAddr{Port: port}
+	tcpAddr.IP = net.ParseIP(host)
+	if tcpAddr.IP == nil {
+		resolvedAddr, err := net.ResolveIPAddr("ip", host)
+		if err != nil {
+			// could be tor or other kind of overlay?
+			return nil, err
+		}
+		tcpAddr.IP = resolvedAddr.IP
+	}
+	return &tcpAddr, nil
+}
@@ -7,12 +7,15 @@ package invite
 import (
 	"bytes"
 	"net"
+	"strings"
 	"testing"
 
 	"github.com/ssbc/go-netwrap"
 	"github.com/ssbc/go-secretstream"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 
+	"github.com/ssbc/go-ssb"
 	refs "github.com/ssbc/go-ssb-refs"
 )
 
@@ -74,3 +77,43 @@ func TestParseParseLegacyToken(t *testing.T) {
 		}
 	}
 }
+
+func TestNewToken(t *testing.T) {
+	r := require.New(t)
+
+	pub, err := ssb.NewKeyPair(nil, refs.RefAlgoFeedSSB1)
+	r.NoError(err)
+
+	tok, err := NewToken(pub.ID(), "127.0.0.1", 8008)
+	r.NoError(err)
+	r.NotEqual([32]byte{}, tok.Seed)
+
+	code := tok.String()
+	r.True(strings.HasPrefix(code, "127.0.0.1:8008:"+pub.ID().String()+"~"), "wrong format: %s", code)
+
+	parsed, err := ParseLegacyToken(code)
+	r.NoError(err)
+	r.True(parsed.Peer.Equal(pub.ID()))
+	r.Equal(tok.Seed, parsed.Seed)
+	r.Equal(code, parsed.String())
+
+	// the secret-handshake address has the key of the pub
+	shsAddr, ok := netwrap.GetAddr(parsed.Address, secretstream.NetworkString).(secretstream.Addr)
+	r.True(ok, "no shs address")
+	r.Equal([]byte(pub.ID().PubKey()), shsAddr.PubKey)
+
+	// the guest identity is the same one older versions derived from the seed
+	guest, err := parsed.KeyPair()
+	r.NoError(err)
+	oldGuest, err := ssb.NewKeyPair(bytes.NewReader(parsed.Seed[:]), refs.RefAlgoFeedSSB1)
+	r.NoError(err)
+	r.True(guest.ID().Equal(oldGuest.ID()))
+	r.False(guest.ID().Equal(pub.ID()))
+
+	other, err := NewToken(pub.ID(), "127.0.0.1", 8008)
+	r.NoError(err)
+	r.NotEqual(tok.Seed, other.Seed, "seeds should be random")
+
+	_, err = NewToken(pub.ID(), "not a host.invalid", 8008)
+	r.Error(err)
+}
@@ -5,6 +5,7 @@
 package ssb
 
 import (
+	"bytes"
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
@@ -104,18 +105,77 @@ func NewKeyPair(r io.Reader, algo refs.RefAlgo) (KeyPair, error) {
 	return keyPair, nil
 }
 
+// KeyPairFromSeed deterministically derives a KeyPair from seed, which has to be ed25519.SeedSize long.
+// The same seed always results in the same identity, which is useful for tests and fixtures.
+// It should not be used for real identities, use NewKeyPair for those.
+func KeyPairFromSeed(seed []byte, algo refs.RefAlgo) (KeyPair, error) {
+	if algo == "" {
+		return nil, fmt.Errorf("ssb: empty feed format algo for keypair")
+	}
+	if n := len(seed); n != ed25519.SeedSize {
+		return nil, fmt.Errorf("ssb: keypair seed has wrong length: %d (expected %d)", n, ed25519.SeedSize)
+	}
+
+	if algo == refs.RefAlgoFeedBendyButt {
+		return metakeys.DeriveFromSeed(seed, "go-ssb-metafeed", refs.RefAlgoFeedBendyButt)
+	}
+
+	secret := ed25519.NewKeyFromSeed(seed)
+	public := secret.Public().(ed25519.PublicKey)
+
+	feed, err := refs.NewFeedRefFromBytes(public, algo)
+	if err != nil {
+		return nil, err
+	}
+
+	return LegacyKeyPair{
+		Feed: feed,
+		Pair: secrethandshake.EdKeyPair{
+			Public: public,
+			Secret: secret,
+		},
+	}, nil
+}
+
 // SaveKeyPair serializes the passed KeyPair to path.
 // It errors if path already exists.
-func SaveKeyPair(kp KeyPair, path string) error {
+// With WithSecretPassphrase the file is encrypted.
+func SaveKeyPair(kp KeyPair, path string, opts ...KeyPairOption) error {
 	if err := IsValidFeedFormat(kp.ID()); err != nil {
 		return err
 	}
 
+	o, err := newKeyPairOptions(opts)
+	if err != nil {
+		return err
+	}
+
 	if _, err := os.Stat(path); err == nil {
 		return fmt.Errorf("ssb.SaveKeyPair: key already exists:%q", path)
 	}
 
-	err := os.MkdirAll(filepath.Dir(path), 0700)
+	var data []byte
+	if enc, ok := kp.(json.Marshaler); ok {
+		data, err = enc.MarshalJSON()
+		if err != nil {
+			return err
+		}
+	} else {
+		var buf bytes.Buffer
+		if err := EncodeKeyPairAsJSON(kp, &buf); err != nil {
+			return err
+		}
+		data = buf.Bytes()
+	}
+
+	if o.passphrase != nil {
+		data, err = sealSecret(data, o.passphrase)
+		if err != nil {
+			return fmt.Errorf("ssb.SaveKeyPair: failed to encrypt secret: %w", err)
+		}
+	}
+
+	err = os.MkdirAll(filepath.Dir(path), 0700)
 	if err != nil && !os.IsExist(err) {
 		return fmt.Errorf("failed to create folder for keypair: %w", err)
 	}
@@ -125,24 +185,15 @@ func SaveKeyPair(kp KeyPair, path string) error {
 		return fmt.Errorf("ssb.SaveKeyPair: failed to create file: %w", err)
 	}
 
-	if enc, ok := kp.(json.Marshaler); ok {
-		data, err := enc.MarshalJSON()
-		if err != nil {
-			return err
-		}
-
-		n, err := f.Write(data)
-		if err != nil {
-			return err
-		}
+	n, err := f.Write(data)
+	if err != nil {
+		f.Close()
+		return err
+	}
 
-		if n != len(data) {
-			return fmt.Errorf("ssb.SaveKeyPair: failed to save all encoded bytes of the keypair")
-		}
-	} else {
-		if err := EncodeKeyPairAsJSON(kp, f); err != nil {
-			return err
-		}
+	if n != len(data) {
+		f.Close()
+		return fmt.Errorf("ssb.SaveKeyPair: failed to save all encoded bytes of the keypair")
 	}
 
 	if err := f.Close(); err != nil {
@@ -167,8 +218,15 @@ func EncodeKeyPairAsJSON(kp KeyPair, w io.Writer) error {
 	return nil
 }
 
-// LoadKeyPair opens fname, ignores any line starting with # and passes it ParseKeyPair
-func LoadKeyPair(fname string) (KeyPair, error) {
+// LoadKeyPair opens fname, ignores any line starting with # and passes it ParseKeyPair.
+// Encrypted files need the passphrase they were saved with, passed using WithSecretPassphrase.
+// Otherwise ErrBadPassphrase is returned.
+func LoadKeyPair(fname string, opts ...KeyPairOption) (KeyPair, error) {
+	o, err := newKeyPairOptions(opts)
+	if err != nil {
+		return nil, err
+	}
+
 	f, err := os.Open(fname)
 	if err != nil {
 		if os.IsNotExist(err) {
@@ -193,22 +251,25 @@ func LoadKeyPair(fname string) (KeyPair, error) {
 		}
 	}
 
-	kp, err := ParseKeyPair(nocomment.NewReader(f))
-	if err == nil {
-		return kp, nil
-	}
-
-	// roll back and read again
-	_, err = f.Seek(0, io.SeekStart)
+	keyData, err := ioutil.ReadAll(f)
 	if err != nil {
 		return nil, err
 	}
 
-	keyData, err := ioutil.ReadAll(f)
+	plain, encrypted, err := openSecret(keyData, o.passphrase)
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("ssb.LoadKeyPair: failed to decrypt key file %s: %w", fname, err)
+	}
+	if encrypted {
+		keyData = plain
+	}
+
+	kp, err := ParseKeyPair(nocomment.NewReader(bytes.NewReader(keyData)))
+	if err == nil {
+		return kp, nil
 	}
 
+	// try again as a metafeed keypair
 	var mkp metakeys.KeyPair
 	err = mkp.UnmarshalJSON(keyData)
 	if err != nil {
@@ -216,7 +277,6 @@ func LoadKeyPair(fname string) (KeyPair, error) {
 	}
 
 	return mkp, nil
-
 }
 
 // ParseKeyPair json decodes an object from the reader.
@@ -0,0 +1,169 @@
+// SPDX-FileCopyrightText: 2021 The Go-SSB Authors
+//
+// SPDX-License-Identifier: MIT
+
+package ssb
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"golang.org/x/crypto/nacl/secretbox"
+	"golang.org/x/crypto/scrypt"
+)
+
+// ErrBadPassphrase is returned by LoadKeyPair if an encrypted secret file can't be opened with the passed passphrase.
+var ErrBadPassphrase = errors.New("ssb: wrong or missing passphrase for secret")
+
+// KeyPairOption changes how SaveKeyPair and LoadKeyPair handle the secret file.
+type KeyPairOption func(*keyPairOptions) error
+
+type keyPairOptions struct {
+	passphrase []byte
+}
+
+// WithSecretPassphrase encrypts the secret file with a key derived from p when saving it.
+// Loading an encrypted file requires the same passphrase. Unencrypted files still load with it set.
+func WithSecretPassphrase(p []byte) KeyPairOption {
+	return func(o *keyPairOptions) error {
+		if len(p) == 0 {
+			return fmt.Errorf("ssb: empty secret passphrase")
+		}
+		o.passphrase = p
+		return nil
+	}
+}
+
+func newKeyPairOptions(opts []KeyPairOption) (keyPairOptions, error) {
+	var o keyPairOptions
+	for i, opt := range opts {
+		if err := opt(&o); err != nil {
+			return o, fmt.Errorf("ssb: failed to apply key pair option %d: %w", i, err)
+		}
+	}
+	return o, nil
+}
+
+const secretEncryptionScheme = "scrypt-xsalsa20poly1305"
+
+// the cost of the key derivation, following the recommendations for interactive logins
+const (
+	secretScryptN = 1 << 15
+	secretScryptR = 8
+	secretScryptP = 1
+
+	// upper bounds for the parameters read from a file, so that a crafted one can't take all the memory or stall the loading.
+	// scrypt needs 128*N*R bytes of memory, at most 256MiB with these.
+	secretScryptMaxN = 1 << 20
+	secretScryptMaxR = 32
+	secretScryptMaxP = 16
+
+	secretScryptMaxMemory = 256 << 20
+)
+
+// encryptedSecret is the envelope around the plain secret file, when it is protected with a passphrase.
+// The []byte fields are base64 encoded by encoding/json.
+type encryptedSecret struct {
+	Encryption string `json:"encryption"`
+
+	N int `json:"n"`
+	R int `json:"r"`
+	P int `json:"p"`
+
+	Salt  []byte `json:"salt"`
+	Nonce []byte `json:"nonce"`
+	Box   []byte `json:"box"`
+}
+
+func sealSecret(plain, passphrase []byte) ([]byte, error) {
+	es := encryptedSecret{
+		Encryption: secretEncryptionScheme,
+		N:          secretScryptN,
+		R:          secretScryptR,
+		P:          secretScryptP,
+		Salt:       make([]byte, 32),
+		Nonce:      make([]byte, 24),
+	}
+
+	if _, err := rand.Read(es.Salt); err != nil {
+		return nil, fmt.Errorf("failed to generate salt: %w", err)
+	}
+	if _, err := rand.Read(es.Nonce); err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %w", err)
+	}
+
+	key, err := es.deriveKey(passphrase)
+	if err != nil {
+		return nil, err
+	}
+
+	var nonce [24]byte
+	copy(nonce[:], es.Nonce)
+	es.Box = secretbox.Seal(nil, plain, &nonce, key)
+
+	return json.MarshalIndent(es, "", "  ")
+}
+
+// openSecret returns the plain secret file, if data is an encrypted one.
+// ok is false if data is not encrypted.
+func openSecret(data, passphrase []byte) (plain []byte, ok bool, err error) {
+	var es encryptedSecret
+	if err := json.Unmarshal(data, &es); err != nil || es.Encryption == "" {
+		return nil, false, nil
+	}
+
+	if es.Encryption != secretEncryptionScheme {
+		return nil, true, fmt.Errorf("unsupported secret encryption: %q", es.Encryption)
+	}
+
+	if len(passphrase) == 0 {
+		return nil, true, ErrBadPassphrase
+	}
+
+	if err := es.checkParams(); err != nil {
+		return nil, true, err
+	}
+
+	key, err := es.deriveKey(passphrase)
+	if err != nil {
+		return nil, true, err
+	}
+
+	var nonce [24]byte
+	copy(nonce[:], es.Nonce)
+	plain, valid := secretbox.Open(nil, es.Box, &nonce, key)
+	if !valid {
+		return nil, true, ErrBadPassphrase
+	}
+	return plain, true, nil
+}
+
+// checkParams rejects the parameters of an encrypted file which are invalid or too costly to derive the key with.
+func (es encryptedSecret) checkParams() error {
+	switch {
+	case es.N < 2 || es.N > secretScryptMaxN || es.N&(es.N-1) != 0:
+		return fmt.Errorf("invalid secret encryption parameters: N=%d", es.N)
+	case es.R < 1 || es.R > secretScryptMaxR:
+		return fmt.Errorf("invalid secret encryption parameters: R=%d", es.R)
+	case es.P < 1 || es.P > secretScryptMaxP:
+		return fmt.Errorf("invalid secret encryption parameters: P=%d", es.P)
+	case 128*int64(es.N)*int64(es.R) > secretScryptMaxMemory:
+		return fmt.Errorf("invalid secret encryption parameters: N=%d and R=%d need too much memory", es.N, es.R)
+	case len(es.Nonce) != 24:
+		return fmt.Errorf("invalid secret encryption parameters: nonce of %d bytes", len(es.Nonce))
+	}
+	return nil
+}
+
+func (es encryptedSecret) deriveKey(passphrase []byte) (*[32]byte, error) {
+	k, err := scrypt.Key(passphrase, es.Salt, es.N, es.R, es.P, 32)
+	if err != nil {
+		return nil, fmt.Errorf("failed to derive key from passphrase: %w", err)
+	}
+
+	var key [32]byte
+	copy(key[:], k)
+	return &key, nil
+}
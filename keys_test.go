@@ -5,6 +5,9 @@
 package ssb
 
 import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
 	"os"
 	"path"
 	"testing"
@@ -69,3 +72,108 @@ func TestLoadKeyPair(t *testing.T) {
 		})
 	}
 }
+
+func TestKeyPairPassphrase(t *testing.T) {
+	r := require.New(t)
+
+	fname := path.Join(t.TempDir(), "secret")
+
+	keys, err := NewKeyPair(nil, refs.RefAlgoFeedSSB1)
+	r.NoError(err)
+
+	pass := WithSecretPassphrase([]byte("correct horse battery staple"))
+	r.NoError(SaveKeyPair(keys, fname, pass))
+
+	data, err := os.ReadFile(fname)
+	r.NoError(err)
+	r.NotContains(string(data), base64.StdEncoding.EncodeToString(keys.Secret()), "secret stored in plaintext")
+
+	loaded, err := LoadKeyPair(fname, pass)
+	r.NoError(err)
+	r.True(loaded.ID().Equal(keys.ID()))
+	r.Equal(keys.Secret(), loaded.Secret())
+
+	_, err = LoadKeyPair(fname, WithSecretPassphrase([]byte("wrong")))
+	r.ErrorIs(err, ErrBadPassphrase)
+
+	_, err = LoadKeyPair(fname)
+	r.ErrorIs(err, ErrBadPassphrase, "encrypted file should not load without a passphrase")
+
+	// plaintext files still load
+	plainName := path.Join(t.TempDir(), "secret")
+	r.NoError(SaveKeyPair(keys, plainName))
+
+	loaded, err = LoadKeyPair(plainName)
+	r.NoError(err)
+	r.True(loaded.ID().Equal(keys.ID()))
+}
+
+func TestKeyPairPassphraseLimits(t *testing.T) {
+	r := require.New(t)
+
+	keys, err := NewKeyPair(nil, refs.RefAlgoFeedSSB1)
+	r.NoError(err)
+	pass := WithSecretPassphrase([]byte("correct horse battery staple"))
+
+	fname := path.Join(t.TempDir(), "secret")
+	r.NoError(SaveKeyPair(keys, fname, pass))
+	data, err := os.ReadFile(fname)
+	r.NoError(err)
+
+	var es encryptedSecret
+	r.NoError(json.Unmarshal(data, &es))
+
+	tcases := []struct {
+		name    string
+		n, r, p int
+	}{
+		{"huge N", 1 << 30, 8, 1},
+		{"N not a power of two", 3 << 10, 8, 1},
+		{"huge R", 1 << 15, 1 << 20, 1},
+		{"huge P", 1 << 15, 8, 1 << 20},
+		{"zero P", 1 << 15, 8, 0},
+		{"too much memory", 1 << 20, 32, 1},
+	}
+	for _, tc := range tcases {
+		crafted := es
+		crafted.N, crafted.R, crafted.P = tc.n, tc.r, tc.p
+		data, err := json.Marshal(crafted)
+		r.NoError(err)
+		r.NoError(os.WriteFile(fname, data, 0600))
+
+		_, err = LoadKeyPair(fname, pass)
+		r.Error(err, tc.name)
+		r.Contains(err.Error(), "invalid secret encryption parameters", tc.name)
+	}
+}
+
+func TestKeyPairFromSeed(t *testing.T) {
+	r := require.New(t)
+
+	seed := bytes.Repeat([]byte{0x42}, 32)
+
+	for _, algo := range []refs.RefAlgo{refs.RefAlgoFeedSSB1, refs.RefAlgoFeedGabby, refs.RefAlgoFeedBendyButt} {
+		kp1, err := KeyPairFromSeed(seed, algo)
+		r.NoError(err, algo)
+		r.Equal(algo, kp1.ID().Algo())
+
+		kp2, err := KeyPairFromSeed(seed, algo)
+		r.NoError(err, algo)
+		r.True(kp1.ID().Equal(kp2.ID()), "%s: not deterministic", algo)
+		r.True(kp1.Secret().Equal(kp2.Secret()), "%s: not deterministic", algo)
+
+		random, err := NewKeyPair(nil, algo)
+		r.NoError(err, algo)
+		r.False(kp1.ID().Equal(random.ID()), "%s: same as a random keypair", algo)
+
+		other, err := KeyPairFromSeed(bytes.Repeat([]byte{0x23}, 32), algo)
+		r.NoError(err, algo)
+		r.False(kp1.ID().Equal(other.ID()), "%s: different seeds, same keypair", algo)
+	}
+
+	_, err := KeyPairFromSeed([]byte("too short"), refs.RefAlgoFeedSSB1)
+	r.Error(err)
+
+	_, err = KeyPairFromSeed(seed, "")
+	r.Error(err)
+}
@@ -0,0 +1,94 @@
+// SPDX-FileCopyrightText: 2021 The Go-SSB Authors
+//
+// SPDX-License-Identifier: MIT
+
+package ssb
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	refs "github.com/ssbc/go-ssb-refs"
+)
+
+// Message is the JSON value of a signed message, like it is stored in the log and sent over the wire.
+// Its fields are decoded when one of them is accessed for the first time and then cached.
+// The content is only split off, not decoded, so code which only needs the header, like most indexes, doesn't pay for it.
+// It is safe for concurrent use.
+type Message struct {
+	raw []byte
+
+	once   sync.Once
+	header messageHeader
+	err    error
+}
+
+type messageHeader struct {
+	Previous *refs.MessageRef `json:"previous"`
+	Author   refs.FeedRef     `json:"author"`
+	Sequence int64            `json:"sequence"`
+	Content  json.RawMessage  `json:"content"`
+}
+
+// NewMessage wraps the JSON value of a message. raw is not copied and must not be changed afterwards.
+func NewMessage(raw []byte) *Message {
+	return &Message{raw: raw}
+}
+
+// Raw returns the JSON value the message was created with.
+func (m *Message) Raw() []byte { return m.raw }
+
+func (m *Message) decode() error {
+	m.once.Do(func() {
+		if err := json.Unmarshal(m.raw, &m.header); err != nil {
+			m.err = fmt.Errorf("ssb: failed to decode message: %w", err)
+		}
+	})
+	return m.err
+}
+
+// Author returns the feed which published the message.
+func (m *Message) Author() (refs.FeedRef, error) {
+	if err := m.decode(); err != nil {
+		return refs.FeedRef{}, err
+	}
+	return m.header.Author, nil
+}
+
+// Sequence returns the position of the message in the feed of its author, starting with 1.
+func (m *Message) Sequence() (int64, error) {
+	if err := m.decode(); err != nil {
+		return 0, err
+	}
+	return m.header.Sequence, nil
+}
+
+// Previous returns the message before this one in the feed of its author. It is nil for the first message.
+func (m *Message) Previous() (*refs.MessageRef, error) {
+	if err := m.decode(); err != nil {
+		return nil, err
+	}
+	return m.header.Previous, nil
+}
+
+// Content returns the content of the message as it is in the JSON value.
+// For private messages that is the boxed string, including its quotes.
+func (m *Message) Content() (json.RawMessage, error) {
+	if err := m.decode(); err != nil {
+		return nil, err
+	}
+	return m.header.Content, nil
+}
+
+// UnmarshalContent decodes the content of the message into v, like json.Unmarshal.
+func (m *Message) UnmarshalContent(v interface{}) error {
+	content, err := m.Content()
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(content, v); err != nil {
+		return fmt.Errorf("ssb: failed to decode message content: %w", err)
+	}
+	return nil
+}
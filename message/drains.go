@@ -16,6 +16,7 @@ import (
 	"github.com/ssbc/margaret"
 
 	gabbygrove "github.com/ssbc/go-gabbygrove"
+	"github.com/ssbc/go-ssb"
 	refs "github.com/ssbc/go-ssb-refs"
 	"github.com/ssbc/go-ssb/internal/storedrefs"
 	"github.com/ssbc/go-ssb/message/legacy"
@@ -31,36 +32,90 @@ type SaveMessager interface {
 	Save(refs.Message) error
 }
 
+// DefaultReorderWindow is how far ahead of the latest stored message of a feed a message can be,
+// to be held back by a verification sink until the messages in between arrive.
+const DefaultReorderWindow = 16
+
 // NewVerifySink returns a sink that does message verification and appends corret messages to the passed log.
 // it has to be used on a feed by feed bases, the feed format is decided by the passed feed reference.
+// Messages which arrive out of order, at most DefaultReorderWindow ahead, are held back and appended once the gap is filled.
 // TODO: start and abs could be the same parameter
 // TODO: needs configuration for hmac and what not..
 // => maybe construct those from a (global) ref register where all the suffixes live with their corresponding network configuration?
-func NewVerifySink(who refs.FeedRef, latest refs.Message, saver SaveMessager, hmacKey *[32]byte) (SequencedVerificationSink, error) {
+func NewVerifySink(who refs.FeedRef, latest refs.Message, saver SaveMessager, hmacKey *[32]byte, opts ...VerifyOption) (SequencedVerificationSink, error) {
+	v, err := newVerifier(who, hmacKey)
+	if err != nil {
+		return nil, fmt.Errorf("NewVerifySink: %w", err)
+	}
 	drain := &generalVerifyDrain{
+		verify: v,
+
 		who:       who,
 		latestSeq: int64(latest.Seq()),
 		latestMsg: latest,
 		storage:   saver,
+
+		window:  DefaultReorderWindow,
+		pending: make(map[int64]refs.Message),
+	}
+	for _, o := range opts {
+		o(drain)
+	}
+	return drain, nil
+}
+
+// VerifyOption adds checks to a verification sink.
+type VerifyOption func(*generalVerifyDrain)
+
+// WithMaxFutureSkew rejects messages whose claimed timestamp is more than d ahead of the local clock, with an ErrFutureTimestamp.
+// Messages from the past are always fine. The time a message was received is recorded like without the option.
+func WithMaxFutureSkew(d time.Duration) VerifyOption {
+	return func(ld *generalVerifyDrain) {
+		ld.maxFutureSkew = d
+	}
+}
+
+// ErrFutureTimestamp is returned for messages which claim to be from too far in the future, see WithMaxFutureSkew.
+type ErrFutureTimestamp struct {
+	Ref     refs.MessageRef
+	Claimed time.Time
+}
+
+func (e ErrFutureTimestamp) Error() string {
+	return fmt.Sprintf("message(%s): timestamp %s is too far in the future", e.Ref.ShortSigil(), e.Claimed.Format(time.RFC3339))
+}
+
+// NewSlicedVerifySink is like NewVerifySink for a feed of which nothing is stored yet,
+// but it doesn't need the feed to start at sequence 1.
+// The first valid message of who that it gets is trusted as the anchor of a slice of the feed and stored without checking its previous message,
+// the following ones are checked as usual. This way only the latest messages of a feed can be fetched, see FeedOrigin.
+func NewSlicedVerifySink(who refs.FeedRef, saver SaveMessager, hmacKey *[32]byte, opts ...VerifyOption) (SequencedVerificationSink, error) {
+	snk, err := NewVerifySink(who, firstMessage(who), saver, hmacKey, opts...)
+	if err != nil {
+		return nil, err
 	}
+	drain := snk.(*generalVerifyDrain)
+	drain.acceptAnchor = true
+	return drain, nil
+}
+
+func newVerifier(who refs.FeedRef, hmacKey *[32]byte) (verifier, error) {
 	switch who.Algo() {
 	case refs.RefAlgoFeedSSB1:
-		drain.verify = &legacyVerify{
+		return &legacyVerify{
 			hmacKey: hmacKey,
 			buf:     new(bytes.Buffer),
-		}
+		}, nil
 
 	case refs.RefAlgoFeedGabby:
-		drain.verify = &gabbyVerify{hmacKey: hmacKey}
+		return &gabbyVerify{hmacKey: hmacKey}, nil
 
 	case refs.RefAlgoFeedBendyButt:
-		drain.verify = &metafeedVerify{hmacKey: hmacKey}
+		return &metafeedVerify{hmacKey: hmacKey}, nil
 
 	default:
-		return nil, fmt.Errorf("NewVerifySink: unsupported feed algorithm %s", who.Algo())
-
+		return nil, fmt.Errorf("unsupported feed algorithm %s", who.Algo())
 	}
-	return drain, nil
 }
 
 type verifier interface {
@@ -149,6 +204,17 @@ type generalVerifyDrain struct {
 	latestSeq int64
 	latestMsg refs.Message
 
+	// verified messages that arrived ahead of the next sequence, by their sequence.
+	// They are at most window ahead of latestSeq.
+	window  int64
+	pending map[int64]refs.Message
+
+	// accept the first message as the start of a sliced feed
+	acceptAnchor bool
+
+	// reject messages which claim to be from further in the future, if not zero
+	maxFutureSkew time.Duration
+
 	storage SaveMessager
 }
 
@@ -170,15 +236,64 @@ func (ld *generalVerifyDrain) Verify(msg []byte) error {
 		return fmt.Errorf("message(%s:%d) verify failed: %w", ld.who.ShortSigil(), ld.latestSeq, err)
 	}
 
-	err = ValidateNext(ld.latestMsg, next)
+	if ld.maxFutureSkew > 0 {
+		if claimed := next.Claimed(); claimed.After(time.Now().Add(ld.maxFutureSkew)) {
+			return ErrFutureTimestamp{Ref: next.Key(), Claimed: claimed}
+		}
+	}
+
+	if ld.acceptAnchor {
+		if !ld.who.Equal(next.Author()) {
+			return fmt.Errorf("message(%s): slice anchor has the wrong author: %s", ld.who.ShortSigil(), next.Author().ShortSigil())
+		}
+		if err := ld.save(next); err != nil {
+			return err
+		}
+		ld.acceptAnchor = false
+		return nil
+	}
+
+	// hold back messages from the future until the gap is filled
+	if nextSeq := next.Seq(); nextSeq > ld.latestSeq+1 {
+		if nextSeq-ld.latestSeq > ld.window || !ld.who.Equal(next.Author()) {
+			return ssb.ErrSequenceGap{Ref: ld.who, Latest: ld.latestSeq, Got: nextSeq}
+		}
+		ld.pending[nextSeq] = next
+		return nil
+	}
+
+	if err := ld.append(next); err != nil {
+		return err
+	}
+
+	// apply the held back messages which are next now
+	for {
+		pending, has := ld.pending[ld.latestSeq+1]
+		if !has {
+			return nil
+		}
+		if err := ld.append(pending); err != nil {
+			return err
+		}
+	}
+}
+
+// append checks that next is the next message of the feed and saves it
+func (ld *generalVerifyDrain) append(next refs.Message) error {
+	delete(ld.pending, next.Seq())
+
+	err := ValidateNext(ld.latestMsg, next)
 	if err != nil {
 		if err == errSkip {
 			return nil
 		}
 		return err
 	}
+	return ld.save(next)
+}
 
-	err = ld.storage.Save(next)
+func (ld *generalVerifyDrain) save(next refs.Message) error {
+	err := ld.storage.Save(next)
 	if err != nil {
 		return fmt.Errorf("message(%s): failed to append message(%s:%d): %w", ld.who.ShortSigil(), next.Key().String(), next.Seq(), err)
 	}
@@ -0,0 +1,162 @@
+// SPDX-FileCopyrightText: 2021 The Go-SSB Authors
+//
+// SPDX-License-Identifier: MIT
+
+package message
+
+import (
+	"errors"
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/ssbc/go-ssb"
+	refs "github.com/ssbc/go-ssb-refs"
+	"github.com/ssbc/go-ssb/message/legacy"
+)
+
+type collectSaver struct {
+	saved []refs.Message
+}
+
+func (cs *collectSaver) Save(msg refs.Message) error {
+	cs.saved = append(cs.saved, msg)
+	return nil
+}
+
+// signedFeed returns the signed messages 1 to n of a new feed
+func signedFeed(t *testing.T, n int) (refs.FeedRef, [][]byte) {
+	return signedFeedWithSeed(t, 42, n)
+}
+
+func signedFeedWithSeed(t *testing.T, seed int64, n int) (refs.FeedRef, [][]byte) {
+	kp, err := ssb.NewKeyPair(rand.New(rand.NewSource(seed)), refs.RefAlgoFeedSSB1)
+	require.NoError(t, err)
+
+	var (
+		msgs [][]byte
+		prev *refs.MessageRef
+	)
+	for seq := int64(1); seq <= int64(n); seq++ {
+		ref, signed, err := legacy.LegacyMessage{
+			Previous:  prev,
+			Author:    kp.ID().String(),
+			Sequence:  seq,
+			Timestamp: seq,
+			Hash:      "sha256",
+			Content:   map[string]interface{}{"type": "test", "i": seq},
+		}.Sign(kp.Secret(), nil)
+		require.NoError(t, err)
+
+		msgs = append(msgs, signed)
+		prev = &ref
+	}
+	return kp.ID(), msgs
+}
+
+func savedSeqs(cs *collectSaver) []int64 {
+	var seqs []int64
+	for _, msg := range cs.saved {
+		seqs = append(seqs, msg.Seq())
+	}
+	return seqs
+}
+
+func TestVerifySinkReorder(t *testing.T) {
+	r := require.New(t)
+
+	feed, msgs := signedFeed(t, 6)
+
+	var saver collectSaver
+	snk, err := NewVerifySink(feed, firstMessage(feed), &saver, nil)
+	r.NoError(err)
+
+	for _, seq := range []int{1, 3, 2, 4} {
+		r.NoError(snk.Verify(msgs[seq-1]), "message %d", seq)
+	}
+	r.Equal([]int64{1, 2, 3, 4}, savedSeqs(&saver))
+	r.EqualValues(4, snk.Seq())
+
+	// duplicates of held back and stored messages are fine
+	r.NoError(snk.Verify(msgs[5]))
+	r.NoError(snk.Verify(msgs[5]))
+	r.NoError(snk.Verify(msgs[2]))
+	r.EqualValues(4, snk.Seq())
+	r.NoError(snk.Verify(msgs[4]))
+	r.Equal([]int64{1, 2, 3, 4, 5, 6}, savedSeqs(&saver))
+}
+
+func TestVerifySinkGapOverflow(t *testing.T) {
+	r := require.New(t)
+
+	feed, msgs := signedFeed(t, 5)
+
+	var saver collectSaver
+	snk, err := NewVerifySink(feed, firstMessage(feed), &saver, nil)
+	r.NoError(err)
+	snk.(*generalVerifyDrain).window = 2
+
+	r.NoError(snk.Verify(msgs[0]))
+
+	// 3 is within the window, 4 isn't
+	r.NoError(snk.Verify(msgs[2]))
+	err = snk.Verify(msgs[3])
+	var gapErr ssb.ErrSequenceGap
+	r.True(errors.As(err, &gapErr), "wrong error: %v", err)
+	r.EqualValues(1, gapErr.Latest)
+	r.EqualValues(4, gapErr.Got)
+
+	// the held back message is still applied
+	r.NoError(snk.Verify(msgs[1]))
+	r.Equal([]int64{1, 2, 3}, savedSeqs(&saver))
+}
+
+func TestVerifySinkFutureTimestamp(t *testing.T) {
+	r := require.New(t)
+
+	kp, err := ssb.NewKeyPair(rand.New(rand.NewSource(42)), refs.RefAlgoFeedSSB1)
+	r.NoError(err)
+
+	// an old message and one from a year in the future
+	past, first, err := legacy.LegacyMessage{
+		Author:    kp.ID().String(),
+		Sequence:  1,
+		Timestamp: 1,
+		Hash:      "sha256",
+		Content:   map[string]interface{}{"type": "test"},
+	}.Sign(kp.Secret(), nil)
+	r.NoError(err)
+	_, future, err := legacy.LegacyMessage{
+		Previous:  &past,
+		Author:    kp.ID().String(),
+		Sequence:  2,
+		Timestamp: time.Now().AddDate(1, 0, 0).UnixNano() / int64(time.Millisecond),
+		Hash:      "sha256",
+		Content:   map[string]interface{}{"type": "test"},
+	}.Sign(kp.Secret(), nil)
+	r.NoError(err)
+
+	var saver collectSaver
+	snk, err := NewVerifySink(kp.ID(), firstMessage(kp.ID()), &saver, nil, WithMaxFutureSkew(time.Hour))
+	r.NoError(err)
+
+	r.NoError(snk.Verify(first))
+	err = snk.Verify(future)
+	var futureErr ErrFutureTimestamp
+	r.True(errors.As(err, &futureErr), "wrong error: %v", err)
+	r.Equal([]int64{1}, savedSeqs(&saver))
+
+	// without the option it's fine
+	saver = collectSaver{}
+	snk, err = NewVerifySink(kp.ID(), firstMessage(kp.ID()), &saver, nil)
+	r.NoError(err)
+	r.NoError(snk.Verify(first))
+	r.NoError(snk.Verify(future))
+	r.Equal([]int64{1, 2}, savedSeqs(&saver))
+
+	stored := saver.saved[1]
+	r.True(stored.Claimed().After(time.Now()))
+	r.WithinDuration(time.Now(), stored.Received(), time.Minute, "received time not recorded")
+}
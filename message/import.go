@@ -0,0 +1,89 @@
+// SPDX-FileCopyrightText: 2021 The Go-SSB Authors
+//
+// SPDX-License-Identifier: MIT
+
+package message
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+
+	refs "github.com/ssbc/go-ssb-refs"
+)
+
+// ImportError is returned by ImportFeed for the message which couldn't be imported.
+type ImportError struct {
+	// Index is the position of the message in the array.
+	Index int
+
+	Err error
+}
+
+func (ie ImportError) Error() string {
+	return fmt.Sprintf("message %d: %s", ie.Index, ie.Err)
+}
+
+func (ie ImportError) Unwrap() error { return ie.Err }
+
+// ImportFeed stores the messages of a JSON array of signed messages, like an export of one or more feeds, in the receive log of the router.
+// The messages are checked like ValidateFeed does, but each feed continues from its latest stored message. Messages which are stored already are skipped.
+// The array is read one message at a time and each message is stored before the next one is read,
+// so the memory that is used doesn't depend on the size of the array.
+//
+// It stops at the first message that is invalid or can't be stored with an ImportError and returns how many messages were stored before it.
+func (vs *VerificationRouter) ImportFeed(rd io.Reader) (int, error) {
+	saver := &countingSaver{saver: vs.saver}
+	sinks := make(map[string]SequencedVerificationSink)
+	var authors []refs.FeedRef
+	defer func() {
+		// the open sinks of the router don't know about the imported messages
+		for _, author := range authors {
+			vs.CloseSink(author)
+		}
+	}()
+
+	err := decodeFeedArray(rd, func(i int, raw json.RawMessage) error {
+		author, err := messageAuthor(raw)
+		if err != nil {
+			return ImportError{Index: i, Err: fmt.Errorf("no author: %w", err)}
+		}
+
+		snk, has := sinks[author.String()]
+		if !has {
+			latest, err := vs.getLatestMsg(author)
+			if err != nil {
+				return ImportError{Index: i, Err: err}
+			}
+			snk, err = newInOrderVerifySink(author, latest, saver, vs.hmacSec, vs.opts...)
+			if err != nil {
+				return ImportError{Index: i, Err: err}
+			}
+			sinks[author.String()] = snk
+			authors = append(authors, author)
+		}
+
+		if err := snk.Verify(raw); err != nil {
+			return ImportError{Index: i, Err: err}
+		}
+		return nil
+	})
+	if err != nil {
+		return saver.count, fmt.Errorf("ImportFeed: %w", err)
+	}
+	return saver.count, nil
+}
+
+// countingSaver counts the messages it passes on
+type countingSaver struct {
+	count int
+	saver SaveMessager
+}
+
+func (cs *countingSaver) Save(msg refs.Message) error {
+	if err := cs.saver.Save(msg); err != nil {
+		return err
+	}
+	cs.count++
+	return nil
+}
@@ -0,0 +1,219 @@
+// SPDX-FileCopyrightText: 2021 The Go-SSB Authors
+//
+// SPDX-License-Identifier: MIT
+
+package message
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/ssbc/go-ssb"
+	refs "github.com/ssbc/go-ssb-refs"
+	"github.com/ssbc/go-ssb/internal/asynctesting"
+	"github.com/ssbc/go-ssb/internal/storedrefs"
+	"github.com/ssbc/go-ssb/message/legacy"
+	"github.com/ssbc/go-ssb/multilogs"
+	"github.com/ssbc/go-ssb/repo"
+)
+
+func openImportRouter(t *testing.T) (*VerificationRouter, func(refs.FeedRef) int64) {
+	r := require.New(t)
+
+	rpath := filepath.Join("testrun", t.Name())
+	os.RemoveAll(rpath)
+
+	testRepo := repo.New(rpath)
+	rl, err := repo.OpenLog(testRepo)
+	r.NoError(err)
+
+	userFeeds, userFeedsSnk, err := repo.OpenStandaloneMultiLog(testRepo, "testUsers", multilogs.UserFeedsUpdate)
+	r.NoError(err)
+
+	ctx, cancel := context.WithCancel(context.TODO())
+	errc := asynctesting.ServeLog(ctx, t.Name(), rl, userFeedsSnk, true)
+	t.Cleanup(func() {
+		cancel()
+		r.NoError(<-errc)
+		userFeeds.Close()
+		userFeedsSnk.Close()
+		rl.Close()
+	})
+
+	vs, err := NewVerificationRouter(rl, userFeeds, nil)
+	r.NoError(err)
+
+	// the sequence of the latest stored message of a feed, once the index has it
+	storedSeq := func(feed refs.FeedRef) int64 {
+		sublog, err := userFeeds.Get(storedrefs.Feed(feed))
+		r.NoError(err)
+		return sublog.Seq() + 1
+	}
+	return vs, storedSeq
+}
+
+func TestImportFeed(t *testing.T) {
+	r := require.New(t)
+
+	vs, storedSeq := openImportRouter(t)
+
+	alice, aliceMsgs := signedFeedWithSeed(t, 1, 6)
+	bob, bobMsgs := signedFeedWithSeed(t, 2, 4)
+
+	n, err := vs.ImportFeed(jsonArray(aliceMsgs[:3]...))
+	r.NoError(err)
+	r.Equal(3, n)
+	r.Eventually(func() bool { return storedSeq(alice) == 3 }, time.Second, 10*time.Millisecond)
+
+	// the stored part of alice is skipped, the rest continues it
+	var all [][]byte
+	all = append(all, aliceMsgs[:4]...)
+	all = append(all, bobMsgs...)
+	all = append(all, aliceMsgs[4:]...)
+	n, err = vs.ImportFeed(jsonArray(all...))
+	r.NoError(err)
+	r.Equal(7, n)
+	r.Eventually(func() bool { return storedSeq(alice) == 6 && storedSeq(bob) == 4 }, time.Second, 10*time.Millisecond)
+
+	// the position of the invalid message is reported and the ones before it are stored
+	carol, carolMsgs := signedFeedWithSeed(t, 3, 5)
+	broken := strings.Replace(string(carolMsgs[3]), `"sequence": 4`, `"sequence": 40`, 1)
+	r.NotEqual(string(carolMsgs[3]), broken)
+	carolMsgs[3] = []byte(broken)
+
+	n, err = vs.ImportFeed(jsonArray(carolMsgs...))
+	r.Error(err)
+	var ie ImportError
+	r.True(errors.As(err, &ie), "not an import error: %v", err)
+	r.Equal(3, ie.Index)
+	r.Equal(3, n)
+	r.Eventually(func() bool { return storedSeq(carol) == 3 }, time.Second, 10*time.Millisecond)
+
+	// a gap is an error, too
+	dave, daveMsgs := signedFeedWithSeed(t, 4, 3)
+	n, err = vs.ImportFeed(jsonArray(daveMsgs[0], daveMsgs[2]))
+	r.True(errors.As(err, &ie), "not an import error: %v", err)
+	r.Equal(1, ie.Index)
+	r.Equal(1, n)
+	r.Eventually(func() bool { return storedSeq(dave) == 1 }, time.Second, 10*time.Millisecond)
+}
+
+// writeSignedFeed writes a JSON array of n messages of a new feed to w, without keeping them around.
+// Each message has a text of size bytes.
+func writeSignedFeed(w io.Writer, n, size int) error {
+	kp, err := ssb.NewKeyPair(rand.New(rand.NewSource(42)), refs.RefAlgoFeedSSB1)
+	if err != nil {
+		return err
+	}
+	text := strings.Repeat("a", size)
+
+	if _, err := io.WriteString(w, "["); err != nil {
+		return err
+	}
+	var prev *refs.MessageRef
+	for seq := int64(1); seq <= int64(n); seq++ {
+		ref, signed, err := legacy.LegacyMessage{
+			Previous:  prev,
+			Author:    kp.ID().String(),
+			Sequence:  seq,
+			Timestamp: seq,
+			Hash:      "sha256",
+			Content:   map[string]interface{}{"type": "test", "text": text},
+		}.Sign(kp.Secret(), nil)
+		if err != nil {
+			return err
+		}
+		if seq > 1 {
+			if _, err := io.WriteString(w, ","); err != nil {
+				return err
+			}
+		}
+		if _, err := w.Write(signed); err != nil {
+			return err
+		}
+		prev = &ref
+	}
+	_, err = io.WriteString(w, "]")
+	return err
+}
+
+// heapSampler drops the messages and keeps track of the largest live heap while they are saved
+type heapSampler struct {
+	count   int
+	maxHeap uint64
+}
+
+func (hs *heapSampler) Save(refs.Message) error {
+	hs.count++
+	if hs.count%250 == 0 {
+		// only count what is still in use
+		runtime.GC()
+		var ms runtime.MemStats
+		runtime.ReadMemStats(&ms)
+		if ms.HeapAlloc > hs.maxHeap {
+			hs.maxHeap = ms.HeapAlloc
+		}
+	}
+	return nil
+}
+
+func TestImportFeedBoundedMemory(t *testing.T) {
+	if testing.Short() {
+		t.Skip("imports a large feed")
+	}
+	r := require.New(t)
+
+	vs, _ := openImportRouter(t)
+	sampler := &heapSampler{}
+	vs.saver = sampler
+
+	const (
+		msgCount = 2000
+		textSize = 6000
+	)
+
+	// the feed is produced while it is imported, so that only the import can hold it in memory
+	pr, pw := io.Pipe()
+	cr := &countingReader{rd: pr}
+	go func() {
+		pw.CloseWithError(writeSignedFeed(pw, msgCount, textSize))
+	}()
+
+	runtime.GC()
+	var before runtime.MemStats
+	runtime.ReadMemStats(&before)
+
+	n, err := vs.ImportFeed(cr)
+	r.NoError(err)
+	r.Equal(msgCount, n)
+	r.Equal(msgCount, sampler.count)
+
+	r.Greater(cr.n, int64(msgCount*textSize))
+	var grown uint64
+	if sampler.maxHeap > before.HeapAlloc {
+		grown = sampler.maxHeap - before.HeapAlloc
+	}
+	t.Logf("read %d bytes, heap grew by at most %d bytes", cr.n, grown)
+	r.Less(grown, uint64(cr.n/4), "heap grew with the size of the input")
+}
+
+type countingReader struct {
+	rd io.Reader
+	n  int64
+}
+
+func (cr *countingReader) Read(p []byte) (int, error) {
+	n, err := cr.rd.Read(p)
+	cr.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,165 @@
+// SPDX-FileCopyrightText: 2021 The Go-SSB Authors
+//
+// SPDX-License-Identifier: MIT
+
+package message
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/ssbc/go-luigi"
+	"github.com/ssbc/margaret"
+	"github.com/ssbc/margaret/multilog"
+
+	refs "github.com/ssbc/go-ssb-refs"
+	"github.com/ssbc/go-ssb/internal/storedrefs"
+)
+
+// Latest is the newest stored message of a feed. Seq is zero if nothing of the feed is stored.
+type Latest struct {
+	Seq int64
+	Key refs.MessageRef
+}
+
+// LatestCache keeps the latest message of each feed in memory, so that publishing and computing the frontier
+// don't need to look it up in the user feeds multilog and the root log every time.
+//
+// It is kept current by pouring the new messages of the root log into it, like with a live query.
+// Feeds it hasn't seen a message of yet are loaded from the multilog the first time they are asked for,
+// which is how it is filled again after a restart.
+// Feeds which are changed in the root log, like by nulling them, need to be removed with Invalidate or Purge.
+type LatestCache struct {
+	rootLog   margaret.Log
+	userFeeds multilog.MultiLog
+
+	// called before loading a feed from userFeeds, to make sure it has all the messages of the root log
+	waitForIndexes func()
+
+	mu     sync.Mutex
+	latest map[string]Latest
+}
+
+var _ luigi.Sink = (*LatestCache)(nil)
+
+// NewLatestCache returns an empty cache which loads missing feeds from userFeeds.
+// waitForIndexes is called before that and can be nil, if userFeeds is always up to date.
+func NewLatestCache(rootLog margaret.Log, userFeeds multilog.MultiLog, waitForIndexes func()) *LatestCache {
+	return &LatestCache{
+		rootLog:   rootLog,
+		userFeeds: userFeeds,
+
+		waitForIndexes: waitForIndexes,
+
+		latest: make(map[string]Latest),
+	}
+}
+
+// Latest returns the newest stored message of feed.
+// If that message is nulled, like by repo.DeleteMessage, it returns an error wrapping margaret.ErrNulled.
+func (c *LatestCache) Latest(feed refs.FeedRef) (Latest, error) {
+	k := feed.String()
+
+	c.mu.Lock()
+	l, has := c.latest[k]
+	c.mu.Unlock()
+	if has {
+		return l, nil
+	}
+
+	// don't hold the lock while reading from disk
+	loaded, err := c.load(feed)
+	if err != nil {
+		return Latest{}, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// a newer message might have been poured in the meantime
+	if l, has := c.latest[k]; has && l.Seq >= loaded.Seq {
+		return l, nil
+	}
+	c.latest[k] = loaded
+	return loaded, nil
+}
+
+func (c *LatestCache) load(feed refs.FeedRef) (Latest, error) {
+	if c.waitForIndexes != nil {
+		c.waitForIndexes()
+	}
+
+	userLog, err := c.userFeeds.Get(storedrefs.Feed(feed))
+	if err != nil {
+		return Latest{}, fmt.Errorf("latest cache: failed to open sublog of %s: %w", feed.ShortSigil(), err)
+	}
+
+	seq := userLog.Seq()
+	if seq < 0 {
+		return Latest{}, nil
+	}
+
+	rxSeq, err := userLog.Get(seq)
+	if err != nil {
+		return Latest{}, fmt.Errorf("latest cache: failed to get root log sequence of %s:%d: %w", feed.ShortSigil(), seq, err)
+	}
+	v, err := c.rootLog.Get(rxSeq.(int64))
+	if err != nil {
+		// the key of a nulled message is gone, so the feed can't be continued from it.
+		// Reporting an older message or an empty feed would make the next message fork the feed.
+		if errors.Is(err, margaret.ErrNulled) {
+			return Latest{}, fmt.Errorf("latest cache: the latest message of %s is nulled: %w", feed.ShortSigil(), err)
+		}
+		return Latest{}, fmt.Errorf("latest cache: failed to get latest message of %s: %w", feed.ShortSigil(), err)
+	}
+	msg, ok := v.(refs.Message)
+	if !ok {
+		return Latest{}, fmt.Errorf("latest cache: wrong message type: %T", v)
+	}
+	return Latest{Seq: msg.Seq(), Key: msg.Key()}, nil
+}
+
+// Pour updates the feed of the poured message, if it is newer than the one in the cache.
+// It takes messages of the root log, with or without their sequence wrapped around them.
+func (c *LatestCache) Pour(_ context.Context, v interface{}) error {
+	if sw, ok := v.(margaret.SeqWrapper); ok {
+		v = sw.Value()
+	}
+	msg, ok := v.(refs.Message)
+	if !ok {
+		// nulled messages are errors
+		return nil
+	}
+	c.update(msg)
+	return nil
+}
+
+func (c *LatestCache) update(msg refs.Message) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	k := msg.Author().String()
+	if l, has := c.latest[k]; has && l.Seq >= msg.Seq() {
+		return
+	}
+	c.latest[k] = Latest{Seq: msg.Seq(), Key: msg.Key()}
+}
+
+// Close does nothing. It is there to make the cache a luigi.Sink.
+func (c *LatestCache) Close() error { return nil }
+
+// Invalidate removes feed from the cache, so that the next Latest loads it again.
+func (c *LatestCache) Invalidate(feed refs.FeedRef) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.latest, feed.String())
+}
+
+// Purge removes all the feeds from the cache.
+func (c *LatestCache) Purge() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.latest = make(map[string]Latest)
+}
@@ -0,0 +1,134 @@
+// SPDX-FileCopyrightText: 2021 The Go-SSB Authors
+//
+// SPDX-License-Identifier: MIT
+
+package message
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ssbc/go-luigi"
+	"github.com/ssbc/margaret"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ssbc/go-ssb"
+	refs "github.com/ssbc/go-ssb-refs"
+	"github.com/ssbc/go-ssb/internal/asynctesting"
+	"github.com/ssbc/go-ssb/internal/storedrefs"
+	"github.com/ssbc/go-ssb/multilogs"
+	"github.com/ssbc/go-ssb/repo"
+)
+
+func TestLatestCache(t *testing.T) {
+	r := require.New(t)
+	ctx, cancel := context.WithCancel(context.TODO())
+	defer cancel()
+
+	rpath := filepath.Join("testrun", t.Name())
+	os.RemoveAll(rpath)
+
+	testRepo := repo.New(rpath)
+	rl, err := repo.OpenLog(testRepo)
+	r.NoError(err, "failed to open root log")
+	t.Cleanup(func() {
+		rl.Close()
+	})
+
+	userFeeds, userFeedsSnk, err := repo.OpenStandaloneMultiLog(testRepo, "testUsers", multilogs.UserFeedsUpdate)
+	r.NoError(err, "failed to get user feeds multilog")
+	t.Cleanup(func() {
+		userFeeds.Close()
+		userFeedsSnk.Close()
+	})
+	errc := asynctesting.ServeLog(ctx, t.Name(), rl, userFeedsSnk, true)
+
+	cache := NewLatestCache(rl, userFeeds, nil)
+	src, err := rl.Query(margaret.Live(true), margaret.SeqWrap(true))
+	r.NoError(err)
+	go luigi.Pump(ctx, cache, src)
+
+	staticRand := rand.New(rand.NewSource(42))
+	alice, err := ssb.NewKeyPair(staticRand, refs.RefAlgoFeedSSB1)
+	r.NoError(err)
+	bob, err := ssb.NewKeyPair(staticRand, refs.RefAlgoFeedSSB1)
+	r.NoError(err)
+
+	empty, err := cache.Latest(alice.ID())
+	r.NoError(err)
+	r.Equal(Latest{}, empty)
+
+	// alice publishes with the cache, bob's messages are only seen by the sink
+	alicePub, err := OpenPublishLog(rl, userFeeds, alice, UseLatestCache(cache))
+	r.NoError(err)
+	bobPub, err := OpenPublishLog(rl, userFeeds, bob, UseLatestCache(NewLatestCache(rl, userFeeds, nil)))
+	r.NoError(err)
+
+	var lastBob refs.Message
+	for i := 1; i <= 5; i++ {
+		msg, err := alicePub.Publish(map[string]interface{}{"type": "test", "i": i})
+		r.NoError(err)
+		r.EqualValues(i, msg.Seq())
+
+		latest, err := cache.Latest(alice.ID())
+		r.NoError(err)
+		r.Equal(Latest{Seq: msg.Seq(), Key: msg.Key()}, latest, "not advanced after %d", i)
+
+		lastBob, err = bobPub.Publish(map[string]interface{}{"type": "test", "i": i})
+		r.NoError(err)
+	}
+	r.Eventually(func() bool {
+		latest, err := cache.Latest(bob.ID())
+		return err == nil && latest.Seq == lastBob.Seq() && latest.Key.Equal(lastBob.Key())
+	}, time.Second, 10*time.Millisecond, "sink didn't update bob")
+
+	// compare with the multilog, like a cache after a restart
+	for _, kp := range []ssb.KeyPair{alice, bob} {
+		userLog, err := userFeeds.Get(storedrefs.Feed(kp.ID()))
+		r.NoError(err)
+		r.Eventually(func() bool { return userLog.Seq() == 4 }, time.Second, 10*time.Millisecond, "multilog not indexed")
+
+		rxSeq, err := userLog.Get(4)
+		r.NoError(err)
+		v, err := rl.Get(rxSeq.(int64))
+		r.NoError(err)
+		stored := v.(refs.Message)
+
+		cached, err := cache.Latest(kp.ID())
+		r.NoError(err)
+		r.Equal(Latest{Seq: stored.Seq(), Key: stored.Key()}, cached)
+
+		loaded, err := NewLatestCache(rl, userFeeds, nil).Latest(kp.ID())
+		r.NoError(err)
+		r.Equal(cached, loaded)
+	}
+
+	cache.Invalidate(alice.ID())
+	reloaded, err := cache.Latest(alice.ID())
+	r.NoError(err)
+	r.EqualValues(5, reloaded.Seq)
+
+	// a nulled latest message can't be continued, publishing would fork the feed
+	aliceLog, err := userFeeds.Get(storedrefs.Feed(alice.ID()))
+	r.NoError(err)
+	rxSeq, err := aliceLog.Get(aliceLog.Seq())
+	r.NoError(err)
+	r.NoError(rl.Null(rxSeq.(int64)))
+
+	restarted := NewLatestCache(rl, userFeeds, nil)
+	_, err = restarted.Latest(alice.ID())
+	r.True(errors.Is(err, margaret.ErrNulled), "got: %v", err)
+
+	alicePub, err = OpenPublishLog(rl, userFeeds, alice, UseLatestCache(restarted))
+	r.NoError(err)
+	_, err = alicePub.Publish(map[string]interface{}{"type": "test", "i": 6})
+	r.True(errors.Is(err, margaret.ErrNulled), "got: %v", err)
+
+	cancel()
+	r.NoError(<-errc, "serveLog failed")
+}
@@ -9,6 +9,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"math"
 	"strconv"
 	"strings"
 )
@@ -40,14 +41,28 @@ func (pp *prettyPrinter) formatArray(depth int) error {
 				return nil
 			case '{':
 				fmt.Fprint(b, strings.Repeat("  ", depth))
-				fmt.Fprint(b, "{\n")
-				if err := pp.formatObject(depth + 1); err != nil {
+				fmt.Fprint(b, "{")
+				var d = depth + 1
+				if dec.More() {
+					fmt.Fprint(b, "\n")
+				} else {
+					// empty object, see formatObject
+					d = 1
+				}
+				if err := pp.formatObject(d); err != nil {
 					return fmt.Errorf("formatArray(%d): decend failed: %w", depth, err)
 				}
 			case '[':
 				fmt.Fprint(b, strings.Repeat("  ", depth))
-				fmt.Fprint(b, "[\n")
-				if err := pp.formatArray(depth + 1); err != nil {
+				fmt.Fprint(b, "[")
+				var d = depth + 1
+				if dec.More() {
+					fmt.Fprint(b, "\n")
+				} else {
+					// empty array, see formatObject
+					d = 1
+				}
+				if err := pp.formatArray(d); err != nil {
 					return fmt.Errorf("formatArray(%d): decend failed: %w", depth, err)
 				}
 			default:
@@ -56,7 +71,17 @@ func (pp *prettyPrinter) formatArray(depth int) error {
 
 		case string:
 			fmt.Fprint(b, strings.Repeat("  ", depth))
-			fmt.Fprintf(b, "%q", v)
+			writeString(b, v)
+			if dec.More() {
+				fmt.Fprintf(b, ",")
+			}
+			fmt.Fprintf(b, "\n")
+
+		case json.Number:
+			fmt.Fprint(b, strings.Repeat("  ", depth))
+			if err := writeNumber(b, v); err != nil {
+				return fmt.Errorf("formatArray(%d): %w", depth, err)
+			}
 			if dec.More() {
 				fmt.Fprintf(b, ",")
 			}
@@ -150,10 +175,11 @@ func (pp *prettyPrinter) formatObject(depth int) error {
 				if depth == 1 {
 					pp.topLevelFields = append(pp.topLevelFields, v)
 				}
-				fmt.Fprintf(b, "%s%q: ", strings.Repeat("  ", depth), v)
+				fmt.Fprint(b, strings.Repeat("  ", depth))
+				writeString(b, v)
+				fmt.Fprint(b, ": ")
 			} else {
-				r := strings.NewReplacer("\\", `\\`, "\t", `\t`, "\n", `\n`, "\r", `\r`, `"`, `\"`)
-				fmt.Fprintf(b, `"%s"`, unicodeEscapeSome(r.Replace(v)))
+				writeString(b, v)
 				if dec.More() {
 					fmt.Fprint(b, ",")
 				}
@@ -161,6 +187,16 @@ func (pp *prettyPrinter) formatObject(depth int) error {
 			}
 			isKey = !isKey
 
+		case json.Number:
+			if err := writeNumber(b, v); err != nil {
+				return fmt.Errorf("formatObject(%d): %w", depth, err)
+			}
+			if dec.More() {
+				fmt.Fprintf(b, ",")
+			}
+			fmt.Fprintf(b, "\n")
+			isKey = !isKey
+
 		case float64:
 			b.WriteString(strconv.FormatFloat(v, 'f', -1, 64))
 			if dec.More() {
@@ -279,8 +315,7 @@ func PrettyPrint(input []byte, opts ...PrettyPrinterOption) ([]byte, error) {
 	pp.decoder = json.NewDecoder(bytes.NewReader(input))
 
 	// re float encoding: https://spec.scuttlebutt.nz/datamodel.html#signing-encoding-floats
-	// not particular excited to implement all of the above
-	// this keeps the original value as a string
+	// numbers are kept as strings and formatted by writeNumber
 	pp.decoder.UseNumber()
 
 	for _, o := range opts {
@@ -312,3 +347,59 @@ func PrettyPrint(input []byte, opts ...PrettyPrinterOption) ([]byte, error) {
 
 	return bytes.Trim(pp.buffer.Bytes(), "\n"), nil
 }
+
+// EncodeMessage encodes msg like JSON.stringify(msg, null, 2) does, which is what legacy messages are signed and hashed over.
+// The fields of structs are kept in the order they are defined in and the order of the keys of json.RawMessage values is preserved.
+// Go maps are encoded with sorted keys, though. Use json.RawMessage or structs where the order matters.
+func EncodeMessage(msg interface{}) ([]byte, error) {
+	var buf bytes.Buffer // might want to pass a bufpool around here
+	if err := json.NewEncoder(&buf).Encode(msg); err != nil {
+		return nil, fmt.Errorf("EncodeMessage: 1st-pass json flattning failed: %w", err)
+	}
+
+	// pretty-print v8-like
+	pp, err := PrettyPrint(buf.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("EncodeMessage: preserver order failed: %w", err)
+	}
+	return pp, nil
+}
+
+var jsStringReplacer = strings.NewReplacer("\\", `\\`, "\t", `\t`, "\n", `\n`, "\r", `\r`, `"`, `\"`)
+
+// writeString quotes s like JSON.stringify, for keys and values alike.
+// Unlike %q, it leaves all printable and non-printable runes above 0x1f as they are.
+func writeString(b *bytes.Buffer, s string) {
+	b.WriteByte('"')
+	b.WriteString(unicodeEscapeSome(jsStringReplacer.Replace(s)))
+	b.WriteByte('"')
+}
+
+// writeNumber formats n like JavaScript's Number.prototype.toString,
+// which means integers have no fraction, 1.50 becomes 1.5 and exponents are used outside of [1e-6, 1e21).
+// https://spec.scuttlebutt.nz/feed/datamodel.html#signing-encoding-floats
+func writeNumber(b *bytes.Buffer, n json.Number) error {
+	f, err := strconv.ParseFloat(string(n), 64)
+	if err != nil {
+		return fmt.Errorf("invalid number %q: %w", n, err)
+	}
+
+	if f == 0 {
+		// also for -0
+		b.WriteString("0")
+		return nil
+	}
+
+	abs := math.Abs(f)
+	if abs >= 1e-6 && abs < 1e21 {
+		b.WriteString(strconv.FormatFloat(f, 'f', -1, 64))
+		return nil
+	}
+
+	// go uses at least two digits in the exponent (1e-07), javascript doesn't
+	formatted := strconv.FormatFloat(f, 'e', -1, 64)
+	i := strings.IndexByte(formatted, 'e') + 2 // after the sign of the exponent
+	b.WriteString(formatted[:i])
+	b.WriteString(strings.TrimLeft(formatted[i:], "0"))
+	return nil
+}
@@ -14,6 +14,7 @@ import (
 	"testing"
 
 	"github.com/kylelemons/godebug/diff"
+	"github.com/stretchr/testify/require"
 
 	refs "github.com/ssbc/go-ssb-refs"
 )
@@ -169,3 +170,49 @@ func TestComparePreserve(t *testing.T) {
 		}
 	}
 }
+
+// TestEncodeJSVectors checks the encoding against the output of JSON.stringify in testdata-encode.json.
+// Run 'node ./encode_vectors.js' to recreate it.
+func TestEncodeJSVectors(t *testing.T) {
+	r := require.New(t)
+
+	data, err := ioutil.ReadFile("testdata-encode.json")
+	r.NoError(err)
+
+	var vectors []struct {
+		Name, Input, Output string
+	}
+	r.NoError(json.Unmarshal(data, &vectors))
+	r.NotEmpty(vectors)
+
+	for _, v := range vectors {
+		got, err := PrettyPrint([]byte(v.Input))
+		r.NoError(err, v.Name)
+		r.Equal(v.Output, string(got), "%s: %s", v.Name, diff.Diff(v.Output, string(got)))
+
+		// the same bytes have to come out when messages are created
+		var msg struct {
+			Previous  *refs.MessageRef `json:"previous"`
+			Author    string           `json:"author"`
+			Sequence  int64            `json:"sequence"`
+			Timestamp int64            `json:"timestamp"`
+			Hash      string           `json:"hash"`
+			Content   json.RawMessage  `json:"content"`
+		}
+		if err := json.Unmarshal([]byte(v.Input), &msg); err != nil {
+			// the timestamps of new messages are integers
+			continue
+		}
+
+		got, err = EncodeMessage(LegacyMessage{
+			Previous:  msg.Previous,
+			Author:    msg.Author,
+			Sequence:  msg.Sequence,
+			Timestamp: msg.Timestamp,
+			Hash:      msg.Hash,
+			Content:   msg.Content,
+		})
+		r.NoError(err, v.Name)
+		r.Equal(v.Output, string(got), "%s: %s", v.Name, diff.Diff(v.Output, string(got)))
+	}
+}
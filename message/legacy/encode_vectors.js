@@ -0,0 +1,25 @@
+// SPDX-FileCopyrightText: 2021 The Go-SSB Authors
+//
+// SPDX-License-Identifier: MIT
+
+// creates testdata-encode.json with the bytes JSON.stringify(msg, null, 2) produces for some tricky messages.
+// unlike encode_test.js it doesn't need any dependencies: node ./encode_vectors.js
+
+var fs = require('fs')
+
+var inputs = {
+  floats: '{"previous":null,"author":"@x","sequence":1,"timestamp":1600000000000.5,"hash":"sha256","content":{"type":"test","int":10,"float":1.50,"neg":-0.25,"exp":1.5e3,"big":1e21,"notbig":123456789012345678901e-1,"tiny":1e-7,"small":0.000001,"zero":-0,"list":[1.0,2.5e-8,[]]}}',
+  intTimestamp: '{"previous":null,"author":"@x","sequence":2,"timestamp":1600000000000.000,"hash":"sha256","content":{"type":"test"}}',
+  unicode: '{"previous":null,"author":"@x","sequence":3,"timestamp":1,"hash":"sha256","content":{"type":"test","text":"ü 日本 🐸 \\u0007 \\u007f \\u2028 \\u200b \\t\\n\\r \\b\\f \\"q\\" \\\\ </script>","k\\u00e9y \\u001f\\u200b":["\\u0000","\\u200b🐸",{"\\u007f":"\\u2029"}]}}',
+  nested: '{"previous":null,"author":"@x","sequence":4,"timestamp":1,"hash":"sha256","content":{"type":"test","zeta":{"b":1,"a":[{"y":true,"x":null},{},[],[[]],[{"c":{}}]]},"alpha":[],"mid":{}}}'
+}
+
+var vectors = Object.keys(inputs).map(function (name) {
+  return {
+    name: name,
+    input: inputs[name],
+    output: JSON.stringify(JSON.parse(inputs[name]), null, 2)
+  }
+})
+
+fs.writeFileSync('testdata-encode.json', JSON.stringify(vectors, null, 2) + '\n')
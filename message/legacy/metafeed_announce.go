@@ -41,7 +41,7 @@ func NewMetafeedAnnounce(theMeta, theUpgrading refs.FeedRef) MetafeedAnnounce {
 // it also takes an optional HMAC secret, if the network is using that signature mode.
 func (ma MetafeedAnnounce) Sign(priv ed25519.PrivateKey, hmacSecret *[32]byte) (json.RawMessage, error) {
 	// for compliance with JS, we need to indent and encode the message like V8 JSON.stringify would
-	announcementV8Format, err := jsonAndPreserve(ma)
+	announcementV8Format, err := EncodeMessage(ma)
 	if err != nil {
 		return nil, fmt.Errorf("legacySign: error during sign prepare: %w", err)
 	}
@@ -9,7 +9,6 @@ import (
 	"crypto/ed25519"
 	"crypto/sha256"
 	"encoding/base64"
-	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
@@ -140,22 +139,32 @@ type SignedLegacyMessage struct {
 
 // Sign preserves the filed order (up to content)
 func (msg LegacyMessage) Sign(priv ed25519.PrivateKey, hmacSecret *[32]byte) (refs.MessageRef, []byte, error) {
+	return msg.SignWith(func(data []byte) ([]byte, error) {
+		return ed25519.Sign(priv, data), nil
+	}, hmacSecret)
+}
+
+// SignWith is like Sign but leaves creating the signature to sign, for instance an external signer.
+func (msg LegacyMessage) SignWith(sign func(data []byte) ([]byte, error), hmacSecret *[32]byte) (refs.MessageRef, []byte, error) {
 	// flatten interface{} content value
-	pp, err := jsonAndPreserve(msg)
+	pp, err := EncodeMessage(msg)
 	if err != nil {
 		return refs.MessageRef{}, nil, fmt.Errorf("legacySign: error during sign prepare: %w", err)
 	}
 
 	pp = maybeHMAC(pp, hmacSecret)
 
-	sig := ed25519.Sign(priv, pp)
+	sig, err := sign(pp)
+	if err != nil {
+		return refs.MessageRef{}, nil, fmt.Errorf("legacySign: failed to sign message: %w", err)
+	}
 
 	var signedMsg SignedLegacyMessage
 	signedMsg.LegacyMessage = msg
 	signedMsg.Signature = sig
 
 	// encode again, now with the signature to get the hash of the message
-	ppWithSig, err := jsonAndPreserve(signedMsg)
+	ppWithSig, err := EncodeMessage(signedMsg)
 	if err != nil {
 		return refs.MessageRef{}, nil, fmt.Errorf("legacySign: error re-encoding signed message: %w", err)
 	}
@@ -171,17 +180,3 @@ func (msg LegacyMessage) Sign(priv ed25519.PrivateKey, hmacSecret *[32]byte) (re
 	mr, err := refs.NewMessageRefFromBytes(h.Sum(nil), refs.RefAlgoMessageSSB1)
 	return mr, ppWithSig, err
 }
-
-func jsonAndPreserve(msg interface{}) ([]byte, error) {
-	var buf bytes.Buffer // might want to pass a bufpool around here
-	if err := json.NewEncoder(&buf).Encode(msg); err != nil {
-		return nil, fmt.Errorf("jsonAndPreserve: 1st-pass json flattning failed: %w", err)
-	}
-
-	// pretty-print v8-like
-	pp, err := PrettyPrint(buf.Bytes())
-	if err != nil {
-		return nil, fmt.Errorf("jsonAndPreserve: preserver order failed: %w", err)
-	}
-	return pp, nil
-}
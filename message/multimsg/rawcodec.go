@@ -0,0 +1,204 @@
+// SPDX-FileCopyrightText: 2021 The Go-SSB Authors
+//
+// SPDX-License-Identifier: MIT
+
+package multimsg
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"time"
+
+	gabbygrove "github.com/ssbc/go-gabbygrove"
+	"github.com/ssbc/go-metafeed"
+	"github.com/ssbc/margaret"
+
+	"github.com/ssbc/go-ssb/internal/storedrefs"
+	"github.com/ssbc/go-ssb/message/legacy"
+)
+
+// RawCodec stores messages in the form they were signed in, instead of re-encoding them like MargaretCodec does.
+// An entry is the message type, the received time (unix nanoseconds), the length-prefixed key
+// and the length-prefixed signed bytes: the JSON of legacy messages or the wire encoding of gabbygrove and metafeed messages.
+// The other fields of legacy messages are read from the JSON again when decoding.
+//
+// It can't read logs written with MargaretCodec and vice versa.
+type RawCodec struct{}
+
+func (c RawCodec) NewEncoder(w io.Writer) margaret.Encoder { return rawEncoder{w: w} }
+func (c RawCodec) NewDecoder(r io.Reader) margaret.Decoder { return rawDecoder{r: r} }
+
+func (c RawCodec) Marshal(v interface{}) ([]byte, error) {
+	mm, ok := v.(MultiMessage)
+	if !ok {
+		return nil, fmt.Errorf("rawCodec: wrong type: %T", v)
+	}
+	return marshalRaw(mm)
+}
+
+func (c RawCodec) Unmarshal(data []byte) (interface{}, error) {
+	return unmarshalRaw(data)
+}
+
+type rawEncoder struct{ w io.Writer }
+
+func (enc rawEncoder) Encode(v interface{}) error {
+	mm, ok := v.(MultiMessage)
+	if !ok {
+		return fmt.Errorf("rawCodec: wrong type: %T", v)
+	}
+	bin, err := marshalRaw(mm)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(enc.w, bytes.NewReader(bin))
+	return err
+}
+
+type rawDecoder struct{ r io.Reader }
+
+func (dec rawDecoder) Decode() (interface{}, error) {
+	bin, err := ioutil.ReadAll(io.LimitReader(dec.r, 64*1024))
+	if err != nil {
+		return nil, err
+	}
+	return unmarshalRaw(bin)
+}
+
+func marshalRaw(mm MultiMessage) ([]byte, error) {
+	var (
+		signed   []byte
+		received = mm.Received()
+	)
+	switch mm.tipe {
+	case Legacy:
+		msg, ok := mm.AsLegacy()
+		if !ok {
+			return nil, fmt.Errorf("rawCodec: not a legacy message: %T", mm.Message)
+		}
+		signed = msg.Raw_
+		// legacy messages keep their received time in the stored message
+		received = msg.Timestamp_
+
+	case Gabby:
+		msg, ok := mm.AsGabby()
+		if !ok {
+			return nil, fmt.Errorf("rawCodec: not a gabbygrove: %T", mm.Message)
+		}
+		var err error
+		signed, err = msg.MarshalCBOR()
+		if err != nil {
+			return nil, fmt.Errorf("rawCodec: gabby encoding failed: %w", err)
+		}
+
+	case MetaFeed:
+		msg, ok := mm.AsMetaFeed()
+		if !ok {
+			return nil, fmt.Errorf("rawCodec: not a metafeed: %T", mm.Message)
+		}
+		var err error
+		signed, err = msg.MarshalBinary()
+		if err != nil {
+			return nil, fmt.Errorf("rawCodec: metafeed encoding failed: %w", err)
+		}
+
+	default:
+		return nil, fmt.Errorf("rawCodec: unsupported message type: %x", mm.tipe)
+	}
+
+	key, err := mm.Key().MarshalText()
+	if err != nil {
+		return nil, fmt.Errorf("rawCodec: invalid key: %w", err)
+	}
+
+	var buf bytes.Buffer
+	buf.WriteByte(byte(mm.tipe))
+	var rx [8]byte
+	binary.BigEndian.PutUint64(rx[:], uint64(received.UnixNano()))
+	buf.Write(rx[:])
+	writeLengthPrefixed(&buf, key)
+	writeLengthPrefixed(&buf, signed)
+	return buf.Bytes(), nil
+}
+
+func unmarshalRaw(data []byte) (*MultiMessage, error) {
+	if len(data) < 9 {
+		return nil, fmt.Errorf("rawCodec: data to short")
+	}
+
+	var mm MultiMessage
+	mm.tipe = MessageType(data[0])
+	mm.received = time.Unix(0, int64(binary.BigEndian.Uint64(data[1:9])))
+
+	key, rest, err := readLengthPrefixed(data[9:])
+	if err != nil {
+		return nil, fmt.Errorf("rawCodec: reading key failed: %w", err)
+	}
+	if err := mm.key.UnmarshalText(key); err != nil {
+		return nil, fmt.Errorf("rawCodec: invalid key: %w", err)
+	}
+	signed, _, err := readLengthPrefixed(rest)
+	if err != nil {
+		return nil, fmt.Errorf("rawCodec: reading message failed: %w", err)
+	}
+
+	switch mm.tipe {
+
+	case Legacy:
+		var dmsg legacy.DeserializedMessage
+		if err := json.Unmarshal(signed, &dmsg); err != nil {
+			return nil, fmt.Errorf("rawCodec: legacy decoding failed: %w", err)
+		}
+		msg := &legacy.StoredMessage{
+			Author_:    storedrefs.SerialzedFeed{FeedRef: dmsg.Author},
+			Key_:       storedrefs.SerialzedMessage{MessageRef: mm.key},
+			Sequence_:  dmsg.Sequence,
+			Timestamp_: mm.received,
+			Raw_:       signed,
+		}
+		if dmsg.Previous != nil {
+			msg.Previous_ = &storedrefs.SerialzedMessage{MessageRef: *dmsg.Previous}
+		}
+		mm.Message = msg
+
+	case Gabby:
+		var msg gabbygrove.Transfer
+		if err := msg.UnmarshalCBOR(signed); err != nil {
+			return nil, fmt.Errorf("rawCodec: gabby decoding failed: %w", err)
+		}
+		mm.Message = &msg
+
+	case MetaFeed:
+		var msg metafeed.Message
+		if err := msg.UnmarshalBinary(signed); err != nil {
+			return nil, fmt.Errorf("rawCodec: metafeed decoding failed: %w", err)
+		}
+		mm.Message = &msg
+
+	default:
+		return nil, fmt.Errorf("rawCodec: unsupported message type: %x", mm.tipe)
+	}
+	return &mm, nil
+}
+
+func writeLengthPrefixed(buf *bytes.Buffer, data []byte) {
+	var n [binary.MaxVarintLen64]byte
+	buf.Write(n[:binary.PutUvarint(n[:], uint64(len(data)))])
+	buf.Write(data)
+}
+
+func readLengthPrefixed(data []byte) ([]byte, []byte, error) {
+	n, read := binary.Uvarint(data)
+	if read <= 0 {
+		return nil, nil, fmt.Errorf("invalid length prefix")
+	}
+	data = data[read:]
+	if uint64(len(data)) < n {
+		return nil, nil, fmt.Errorf("want %d bytes but only %d are left", n, len(data))
+	}
+	return data[:n], data[n:], nil
+}
@@ -31,6 +31,9 @@ type publishLog struct {
 	receiveLog margaret.Log
 	waitForIndexesCallback func()
 
+	author refs.FeedRef
+	latest *LatestCache // optional, used instead of byAuthor to find the current message
+
 	create creater
 }
 
@@ -84,6 +87,10 @@ func (pl publishLog) Query(qry ...margaret.QuerySpec) (luigi.Source, error) {
 }
 
 func (pl *publishLog) Append(val interface{}) (int64, error) {
+	if pl.latest != nil {
+		return pl.appendLatest(val)
+	}
+
 	// wait for indexes to catch up before pulling a mutex so we're not locking unnecessarily
 	if pl.waitForIndexesCallback != nil {
 		pl.waitForIndexesCallback()
@@ -132,6 +139,31 @@ func (pl *publishLog) Append(val interface{}) (int64, error) {
 	return rlSeq, nil
 }
 
+// appendLatest is Append with the current message taken from the latest cache
+func (pl *publishLog) appendLatest(val interface{}) (int64, error) {
+	pl.mu.Lock()
+	defer pl.mu.Unlock()
+
+	current, err := pl.latest.Latest(pl.author)
+	if err != nil {
+		return -2, fmt.Errorf("publishLog: failed to establish current seq: %w", err)
+	}
+
+	nextMsg, err := pl.create.Create(val, current.Key, current.Seq+1)
+	if err != nil {
+		return -2, fmt.Errorf("failed to create next msg: %w", err)
+	}
+
+	rlSeq, err := pl.receiveLog.Append(nextMsg)
+	if err != nil {
+		return -2, fmt.Errorf("failed to append new msg: %w", err)
+	}
+
+	// don't rely on the sink of the cache for our own messages
+	pl.latest.update(nextMsg)
+	return rlSeq, nil
+}
+
 // OpenPublishLog needs the base datastore (root or receive log - offset2)
 // and the userfeeds with all the sublog and uses the passed keypair to find the corresponding user feed
 // the returned log's append function is then used to create new messages.
@@ -147,12 +179,19 @@ func OpenPublishLog(receiveLog margaret.Log, authorLogs multilog.MultiLog, kp ss
 	pl := &publishLog{
 		byAuthor:   authorLog,
 		receiveLog: receiveLog,
+		author:     kp.ID(),
+	}
+
+	// the encoders of the other formats need the private key
+	if kp.ID().Algo() != refs.RefAlgoFeedSSB1 && kp.Secret() == nil {
+		return nil, fmt.Errorf("publish: %s feeds can't be published with an external signer", kp.ID().Algo())
 	}
 
 	switch kp.ID().Algo() {
 	case refs.RefAlgoFeedSSB1:
 		pl.create = &legacyCreate{
 			key: kp,
+			now: time.Now,
 		}
 	case refs.RefAlgoFeedGabby:
 		pl.create = &gabbyCreate{
@@ -213,6 +252,22 @@ func UseNowTimestamps(yes bool) PublishOption {
 	}
 }
 
+// UseClock makes the publish log take the timestamps of new messages from now instead of time.Now, for instance to get the same messages in every test run.
+// The timestamps are only set with UseNowTimestamps. Only legacy feeds support it, the encoders of the other formats always use the system time.
+func UseClock(now func() time.Time) PublishOption {
+	return func(pl *publishLog) error {
+		if now == nil {
+			return fmt.Errorf("clock: nil clock")
+		}
+		cv, ok := pl.create.(*legacyCreate)
+		if !ok {
+			return fmt.Errorf("clock: unsupported creater: %T", pl.create)
+		}
+		cv.now = now
+		return nil
+	}
+}
+
 func UseWaitForIndexesCallback(cb func()) PublishOption {
 	return func(pl *publishLog) error {
 		pl.waitForIndexesCallback = cb
@@ -220,6 +275,15 @@ func UseWaitForIndexesCallback(cb func()) PublishOption {
 	}
 }
 
+// UseLatestCache makes the publish log look up the current message of the feed in c,
+// instead of in the sublog of the author, which needs to wait for the indexes.
+func UseLatestCache(c *LatestCache) PublishOption {
+	return func(pl *publishLog) error {
+		pl.latest = c
+		return nil
+	}
+}
+
 type creater interface {
 	Create(val interface{}, prev refs.MessageRef, seq int64) (refs.Message, error)
 }
@@ -228,12 +292,14 @@ type legacyCreate struct {
 	key          ssb.KeyPair
 	hmac         *[32]byte
 	setTimestamp bool
+	now          func() time.Time
 }
 
 func (lc legacyCreate) Create(val interface{}, prev refs.MessageRef, seq int64) (refs.Message, error) {
 	// prepare persisted message
 	var stored legacy.StoredMessage
-	stored.Timestamp_ = time.Now() // "rx"
+	now := lc.now()
+	stored.Timestamp_ = now // "rx"
 	stored.Author_ = storedrefs.SerialzedFeed{FeedRef: lc.key.ID()}
 
 	// set metadata
@@ -253,10 +319,15 @@ func (lc legacyCreate) Create(val interface{}, prev refs.MessageRef, seq int64)
 	}
 
 	if lc.setTimestamp {
-		newMsg.Timestamp = time.Now().UnixNano() / 1000000
+		newMsg.Timestamp = now.UnixNano() / 1000000
+	}
+
+	signer, err := ssb.KeyPairSigner(lc.key)
+	if err != nil {
+		return nil, err
 	}
 
-	mr, signedMessage, err := newMsg.Sign(lc.key.Secret(), lc.hmac)
+	mr, signedMessage, err := newMsg.SignWith(signer.Sign, lc.hmac)
 	if err != nil {
 		return nil, err
 	}
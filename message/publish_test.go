@@ -6,6 +6,7 @@ package message
 
 import (
 	"context"
+	"fmt"
 	"math/rand"
 	"os"
 	"path/filepath"
@@ -14,10 +15,13 @@ import (
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ed25519"
 
 	"github.com/ssbc/go-ssb"
 	refs "github.com/ssbc/go-ssb-refs"
 	"github.com/ssbc/go-ssb/internal/asynctesting"
+	"github.com/ssbc/go-ssb/internal/storedrefs"
+	"github.com/ssbc/go-ssb/message/legacy"
 	"github.com/ssbc/go-ssb/multilogs"
 	"github.com/ssbc/go-ssb/repo"
 )
@@ -108,3 +112,155 @@ func TestSignMessages(t *testing.T) {
 	cancel()
 	r.NoError(<-errc, "serveLog failed")
 }
+
+// mockSigner signs with a key the publisher never sees
+type mockSigner struct {
+	secret ed25519.PrivateKey
+	calls  int
+	fail   bool
+}
+
+func (s *mockSigner) Sign(data []byte) ([]byte, error) {
+	s.calls++
+	if s.fail {
+		return nil, fmt.Errorf("signer unavailable")
+	}
+	return ed25519.Sign(s.secret, data), nil
+}
+
+func (s *mockSigner) Public() []byte { return s.secret.Public().(ed25519.PublicKey) }
+
+func TestPublishWithSigner(t *testing.T) {
+	r := require.New(t)
+
+	rpath := filepath.Join("testrun", t.Name())
+	os.RemoveAll(rpath)
+
+	testRepo := repo.New(rpath)
+	rl, err := repo.OpenLog(testRepo)
+	r.NoError(err)
+	t.Cleanup(func() {
+		rl.Close()
+	})
+
+	userFeeds, userFeedsSnk, err := repo.OpenStandaloneMultiLog(testRepo, "testUsers", multilogs.UserFeedsUpdate)
+	r.NoError(err)
+	t.Cleanup(func() {
+		userFeeds.Close()
+		userFeedsSnk.Close()
+	})
+
+	ctx, cancel := context.WithCancel(context.TODO())
+	defer cancel()
+	errc := asynctesting.ServeLog(ctx, t.Name(), rl, userFeedsSnk, true)
+
+	_, secret, err := ed25519.GenerateKey(rand.New(rand.NewSource(42)))
+	r.NoError(err)
+	signer := &mockSigner{secret: secret}
+
+	kp, err := ssb.NewSignerKeyPair(signer)
+	r.NoError(err)
+	r.Nil(kp.Secret())
+	r.Equal([]byte(kp.ID().PubKey()), signer.Public())
+
+	w, err := OpenPublishLog(rl, userFeeds, kp)
+	r.NoError(err)
+
+	sublog, err := userFeeds.Get(storedrefs.Feed(kp.ID()))
+	r.NoError(err)
+
+	for i := 0; i < 3; i++ {
+		msg, err := w.Publish(map[string]interface{}{"type": "test", "i": i})
+		r.NoError(err)
+
+		// the message verifies against the public key the signer reported
+		r.True(msg.Author().Equal(kp.ID()))
+		_, _, err = legacy.Verify(msg.ValueContentJSON(), nil)
+		r.NoError(err)
+
+		r.Eventually(func() bool {
+			return sublog.Seq() == int64(i)
+		}, time.Second, 10*time.Millisecond)
+	}
+	r.Equal(3, signer.calls)
+
+	// errors of the signer are returned by publish
+	signer.fail = true
+	_, err = w.Publish(map[string]interface{}{"type": "test", "i": 3})
+	r.Error(err)
+	r.EqualValues(2, rl.Seq())
+
+	cancel()
+	r.NoError(<-errc)
+}
+
+func TestPublishWithClock(t *testing.T) {
+	r := require.New(t)
+
+	rpath := filepath.Join("testrun", t.Name())
+	os.RemoveAll(rpath)
+
+	testRepo := repo.New(rpath)
+	rl, err := repo.OpenLog(testRepo)
+	r.NoError(err)
+	t.Cleanup(func() {
+		rl.Close()
+	})
+
+	userFeeds, userFeedsSnk, err := repo.OpenStandaloneMultiLog(testRepo, "testUsers", multilogs.UserFeedsUpdate)
+	r.NoError(err)
+	t.Cleanup(func() {
+		userFeeds.Close()
+		userFeedsSnk.Close()
+	})
+
+	ctx, cancel := context.WithCancel(context.TODO())
+	defer cancel()
+	errc := asynctesting.ServeLog(ctx, t.Name(), rl, userFeedsSnk, true)
+
+	kp, err := ssb.NewKeyPair(rand.New(rand.NewSource(42)), refs.RefAlgoFeedSSB1)
+	r.NoError(err)
+
+	// a clock which advances by a second on every call
+	start := time.Date(2021, 3, 4, 5, 6, 7, 0, time.UTC)
+	ticks := 0
+	clock := func() time.Time {
+		now := start.Add(time.Duration(ticks) * time.Second)
+		ticks++
+		return now
+	}
+
+	w, err := OpenPublishLog(rl, userFeeds, kp, UseNowTimestamps(true), UseClock(clock))
+	r.NoError(err)
+
+	sublog, err := userFeeds.Get(storedrefs.Feed(kp.ID()))
+	r.NoError(err)
+
+	for i := 0; i < 3; i++ {
+		_, err := w.Publish(map[string]interface{}{"type": "test", "i": i})
+		r.NoError(err)
+
+		r.Eventually(func() bool {
+			return sublog.Seq() == int64(i)
+		}, time.Second, 10*time.Millisecond)
+	}
+
+	for i := 0; i < 3; i++ {
+		v, err := rl.Get(int64(i))
+		r.NoError(err)
+		msg := v.(refs.Message)
+
+		want := start.Add(time.Duration(i) * time.Second)
+		r.True(want.Equal(msg.Claimed()), "message %d: %s", i, msg.Claimed())
+		r.Contains(string(msg.ValueContentJSON()), fmt.Sprintf(`"timestamp": %d,`, want.UnixNano()/1000000))
+	}
+
+	// the encoders of the other formats can't use it
+	gabbyKP, err := ssb.NewKeyPair(nil, refs.RefAlgoFeedGabby)
+	r.NoError(err)
+	_, err = OpenPublishLog(rl, userFeeds, gabbyKP, UseClock(clock))
+	r.Error(err)
+
+	cancel()
+	r.NoError(<-errc)
+}
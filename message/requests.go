@@ -48,6 +48,10 @@ type CreateHistArgs struct {
 	Seq int64        `json:"seq,omitempty"`
 
 	AsJSON bool `json:"asJSON,omitempty"`
+
+	// Type only returns messages with public content of this type, see ssb.ContentType.
+	// Limit still counts all the messages of the feed.
+	Type string `json:"type,omitempty"`
 }
 
 func NewCreateHistoryStreamArgs() CreateHistArgs {
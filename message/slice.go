@@ -0,0 +1,95 @@
+// SPDX-FileCopyrightText: 2021 The Go-SSB Authors
+//
+// SPDX-License-Identifier: MIT
+
+package message
+
+import (
+	"errors"
+	"fmt"
+
+	refs "github.com/ssbc/go-ssb-refs"
+	"github.com/ssbc/margaret"
+)
+
+// FeedOrigin returns the sequence of the first stored message of a feed, which has userLog as its sublog.
+// It is 1 for complete feeds. Sliced feeds, which only have the messages from a trusted anchor onwards (see NewSlicedVerifySink),
+// start at the sequence of their anchor. The message at sequence s is stored at s-origin in the sublog.
+//
+// The first messages might be nulled, like the ones a retention policy dropped. Then the origin is taken from the first message which isn't,
+// which is searched for assuming that the nulled messages are at the start. If all of them are nulled, it returns an error wrapping margaret.ErrNulled.
+//
+// An empty sublog also has the origin 1.
+func FeedOrigin(rxlog, userLog margaret.Log) (int64, error) {
+	latest := userLog.Seq()
+	if latest < 0 {
+		return 1, nil
+	}
+
+	first, err := sublogMessage(rxlog, userLog, 0)
+	if err == nil {
+		return first.Seq(), nil
+	}
+	if !errors.Is(err, margaret.ErrNulled) {
+		return 0, fmt.Errorf("feed origin: %w", err)
+	}
+
+	// entry lo is nulled, entry hi is the first one known not to be
+	lo, hi := int64(0), latest+1
+	var found refs.Message
+	for hi-lo > 1 {
+		mid := lo + (hi-lo)/2
+		msg, err := sublogMessage(rxlog, userLog, mid)
+		if err != nil {
+			if !errors.Is(err, margaret.ErrNulled) {
+				return 0, fmt.Errorf("feed origin: %w", err)
+			}
+			lo = mid
+			continue
+		}
+		hi, found = mid, msg
+	}
+	if found == nil {
+		return 0, fmt.Errorf("feed origin: all messages are nulled: %w", err)
+	}
+	return found.Seq() - hi, nil
+}
+
+// sublogMessage returns the message of the entry i of userLog
+func sublogMessage(rxlog, userLog margaret.Log, i int64) (refs.Message, error) {
+	rxSeq, err := userLog.Get(i)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get sublog entry %d: %w", i, err)
+	}
+	rxIdx, ok := rxSeq.(int64)
+	if !ok {
+		return nil, fmt.Errorf("wrong sublog entry type: %T", rxSeq)
+	}
+
+	v, err := rxlog.Get(rxIdx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get message %d: %w", rxIdx, err)
+	}
+	msg, ok := v.(refs.Message)
+	if !ok {
+		return nil, fmt.Errorf("wrong message type: %T", v)
+	}
+	return msg, nil
+}
+
+// VerifyMessage checks the signature of a single message of the feed who, in the encoding used for replication, and returns it.
+// Unlike a verification sink, it doesn't check how the message fits into the feed and doesn't store it.
+func VerifyMessage(who refs.FeedRef, raw []byte, hmacKey *[32]byte) (refs.Message, error) {
+	v, err := newVerifier(who, hmacKey)
+	if err != nil {
+		return nil, err
+	}
+	msg, err := v.Verify(raw)
+	if err != nil {
+		return nil, err
+	}
+	if !msg.Author().Equal(who) {
+		return nil, fmt.Errorf("VerifyMessage: expected a message by %s, got one by %s", who.ShortSigil(), msg.Author().ShortSigil())
+	}
+	return msg, nil
+}
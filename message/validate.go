@@ -0,0 +1,184 @@
+// SPDX-FileCopyrightText: 2021 The Go-SSB Authors
+//
+// SPDX-License-Identifier: MIT
+
+package message
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+
+	refs "github.com/ssbc/go-ssb-refs"
+)
+
+// ValidationReport is the result of ValidateFeed.
+type ValidationReport struct {
+	// Total is the number of messages in the array.
+	Total int
+
+	// Valid is the number of messages that passed all checks.
+	Valid int
+
+	// FirstError is the index in the array of the first invalid message, or -1 if all are valid.
+	FirstError int
+
+	// Err says why the message at FirstError is invalid.
+	Err error
+
+	// Frontiers has the latest valid message of each feed in the array, sorted by feed.
+	Frontiers []FeedFrontier
+}
+
+// FeedFrontier is the latest valid message of a feed.
+type FeedFrontier struct {
+	Feed refs.FeedRef
+	Seq  int64
+	Key  refs.MessageRef
+}
+
+// ValidateFeed checks a JSON array of signed classic messages, like an export of one or more feeds, without storing anything.
+// The elements can also be key-value objects, then their value is checked.
+// Each message goes through the same checks as messages received from peers (see NewVerifySink): the signature with hmacKey (nil for the main network),
+// the sequence and the previous message of its feed, which has to start with the first message.
+// Unlike from peers, the messages of a feed have to be in order.
+//
+// The returned error is only for reading the array. Invalid messages are described in the report and the rest of their feed is skipped.
+func ValidateFeed(rd io.Reader, hmacKey *[32]byte) (ValidationReport, error) {
+	report := ValidationReport{FirstError: -1}
+
+	type feedState struct {
+		sink   SequencedVerificationSink
+		saver  *frontierSaver
+		broken bool
+	}
+	feeds := make(map[string]*feedState)
+
+	invalid := func(i int, err error) {
+		if report.FirstError == -1 {
+			report.FirstError = i
+			report.Err = err
+		}
+	}
+
+	err := decodeFeedArray(rd, func(i int, raw json.RawMessage) error {
+		report.Total++
+
+		author, err := messageAuthor(raw)
+		if err != nil {
+			invalid(i, fmt.Errorf("message %d: no author: %w", i, err))
+			return nil
+		}
+
+		fs, has := feeds[author.String()]
+		if !has {
+			saver := &frontierSaver{}
+			sink, err := newInOrderVerifySink(author, firstMessage(author), saver, hmacKey)
+			if err != nil {
+				invalid(i, fmt.Errorf("message %d: %w", i, err))
+				return nil
+			}
+			fs = &feedState{sink: sink, saver: saver}
+			feeds[author.String()] = fs
+		}
+		if fs.broken {
+			return nil
+		}
+
+		saved := fs.saver.count
+		if err := fs.sink.Verify(raw); err != nil {
+			fs.broken = true
+			invalid(i, fmt.Errorf("message %d: %w", i, err))
+			return nil
+		}
+		report.Valid += fs.saver.count - saved
+		return nil
+	})
+	if err != nil {
+		return report, fmt.Errorf("ValidateFeed: %w", err)
+	}
+
+	for _, fs := range feeds {
+		if fs.saver.latest == nil {
+			continue
+		}
+		report.Frontiers = append(report.Frontiers, FeedFrontier{
+			Feed: fs.saver.latest.Author(),
+			Seq:  fs.saver.latest.Seq(),
+			Key:  fs.saver.latest.Key(),
+		})
+	}
+	sort.Slice(report.Frontiers, func(i, j int) bool {
+		return report.Frontiers[i].Feed.String() < report.Frontiers[j].Feed.String()
+	})
+	return report, nil
+}
+
+// frontierSaver keeps the latest message instead of storing them
+type frontierSaver struct {
+	count  int
+	latest refs.Message
+}
+
+func (fs *frontierSaver) Save(msg refs.Message) error {
+	fs.count++
+	fs.latest = msg
+	return nil
+}
+
+// decodeFeedArray calls fn with each element of the JSON array read from rd and its index.
+// The elements are read one at a time, so only one of them is held in memory.
+// Key-value objects are unwrapped, fn gets their value. An error from fn stops the reading and is returned as is.
+func decodeFeedArray(rd io.Reader, fn func(i int, raw json.RawMessage) error) error {
+	dec := json.NewDecoder(rd)
+	if tok, err := dec.Token(); err != nil {
+		return fmt.Errorf("failed to read array: %w", err)
+	} else if delim, ok := tok.(json.Delim); !ok || delim != '[' {
+		return fmt.Errorf("expected an array, got %v", tok)
+	}
+
+	for i := 0; dec.More(); i++ {
+		var raw json.RawMessage
+		if err := dec.Decode(&raw); err != nil {
+			return fmt.Errorf("failed to read message %d: %w", i, err)
+		}
+
+		var wrapped struct {
+			Value json.RawMessage `json:"value"`
+		}
+		if err := json.Unmarshal(raw, &wrapped); err == nil && len(wrapped.Value) > 0 {
+			raw = wrapped.Value
+		}
+
+		if err := fn(i, raw); err != nil {
+			return err
+		}
+	}
+
+	if _, err := dec.Token(); err != nil {
+		return fmt.Errorf("failed to read end of array: %w", err)
+	}
+	return nil
+}
+
+func messageAuthor(raw json.RawMessage) (refs.FeedRef, error) {
+	var author struct {
+		Author refs.FeedRef `json:"author"`
+	}
+	err := json.Unmarshal(raw, &author)
+	return author.Author, err
+}
+
+// newInOrderVerifySink is NewVerifySink for the messages of an export, which have to be in order.
+// It doesn't wait for missing messages.
+func newInOrderVerifySink(who refs.FeedRef, latest refs.Message, saver SaveMessager, hmacKey *[32]byte, opts ...VerifyOption) (SequencedVerificationSink, error) {
+	sink, err := NewVerifySink(who, latest, saver, hmacKey, opts...)
+	if err != nil {
+		return nil, err
+	}
+	if drain, ok := sink.(*generalVerifyDrain); ok {
+		drain.window = 0
+	}
+	return sink, nil
+}
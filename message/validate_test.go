@@ -0,0 +1,130 @@
+// SPDX-FileCopyrightText: 2021 The Go-SSB Authors
+//
+// SPDX-License-Identifier: MIT
+
+package message
+
+import (
+	"bytes"
+	"math/rand"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/ssbc/go-ssb"
+	refs "github.com/ssbc/go-ssb-refs"
+	"github.com/ssbc/go-ssb/message/legacy"
+)
+
+func jsonArray(msgs ...[]byte) *bytes.Buffer {
+	return bytes.NewBufferString("[" + string(bytes.Join(msgs, []byte(","))) + "]")
+}
+
+func TestValidateFeed(t *testing.T) {
+	r := require.New(t)
+
+	alice, aliceMsgs := signedFeedWithSeed(t, 1, 5)
+	bob, bobMsgs := signedFeedWithSeed(t, 2, 3)
+
+	// two interleaved feeds
+	var all [][]byte
+	all = append(all, aliceMsgs[:2]...)
+	all = append(all, bobMsgs...)
+	all = append(all, aliceMsgs[2:]...)
+
+	report, err := ValidateFeed(jsonArray(all...), nil)
+	r.NoError(err)
+	r.Equal(8, report.Total)
+	r.Equal(8, report.Valid)
+	r.Equal(-1, report.FirstError)
+	r.NoError(report.Err)
+	r.Len(report.Frontiers, 2)
+	for _, f := range report.Frontiers {
+		switch {
+		case f.Feed.Equal(alice):
+			r.EqualValues(5, f.Seq)
+		case f.Feed.Equal(bob):
+			r.EqualValues(3, f.Seq)
+		default:
+			t.Fatal("unexpected feed", f.Feed)
+		}
+	}
+
+	// key-value objects work, too
+	wrapped := []byte(`{"key":"ignored","value":` + string(bobMsgs[0]) + `}`)
+	report, err = ValidateFeed(jsonArray(wrapped), nil)
+	r.NoError(err)
+	r.Equal(1, report.Valid)
+
+	// the signature is checked with the hmac key
+	var hmacKey [32]byte
+	report, err = ValidateFeed(jsonArray(aliceMsgs...), &hmacKey)
+	r.NoError(err)
+	r.Equal(0, report.FirstError)
+	r.Empty(report.Frontiers)
+
+	_, err = ValidateFeed(strings.NewReader(`{"not":"an array"}`), nil)
+	r.Error(err)
+}
+
+func TestValidateFeedBrokenLink(t *testing.T) {
+	r := require.New(t)
+
+	kp, err := ssb.NewKeyPair(rand.New(rand.NewSource(3)), refs.RefAlgoFeedSSB1)
+	r.NoError(err)
+
+	// the fourth message points to the second one instead of the third
+	var (
+		msgs [][]byte
+		keys []refs.MessageRef
+	)
+	for seq := int64(1); seq <= 6; seq++ {
+		var prev *refs.MessageRef
+		switch {
+		case seq == 4:
+			prev = &keys[1]
+		case seq > 1:
+			prev = &keys[seq-2]
+		}
+		ref, signed, err := legacy.LegacyMessage{
+			Previous:  prev,
+			Author:    kp.ID().String(),
+			Sequence:  seq,
+			Timestamp: seq,
+			Hash:      "sha256",
+			Content:   map[string]interface{}{"type": "test", "i": seq},
+		}.Sign(kp.Secret(), nil)
+		r.NoError(err)
+		msgs = append(msgs, signed)
+		keys = append(keys, ref)
+	}
+
+	_, other := signedFeedWithSeed(t, 4, 2)
+	all := append([][]byte{other[0]}, msgs...)
+	all = append(all, other[1])
+
+	report, err := ValidateFeed(jsonArray(all...), nil)
+	r.NoError(err)
+	r.Equal(8, report.Total)
+	r.Equal(4, report.FirstError, "the fourth message of the feed is at index 4")
+	r.Contains(report.Err.Error(), "previous compare failed")
+	r.Equal(5, report.Valid, "three of the broken feed and both of the other")
+
+	r.Len(report.Frontiers, 2)
+	for _, f := range report.Frontiers {
+		if f.Feed.Equal(kp.ID()) {
+			r.EqualValues(3, f.Seq)
+			r.True(f.Key.Equal(keys[2]))
+		} else {
+			r.EqualValues(2, f.Seq)
+		}
+	}
+
+	// a missing message is a gap
+	report, err = ValidateFeed(jsonArray(msgs[0], msgs[2]), nil)
+	r.NoError(err)
+	r.Equal(1, report.FirstError)
+	var gap ssb.ErrSequenceGap
+	r.ErrorAs(report.Err, &gap)
+}
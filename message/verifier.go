@@ -15,9 +15,11 @@ import (
 )
 
 // NewVerificationRouter supplies a unique drain per author that skip duplicate messages
-func NewVerificationRouter(rxlog margaret.Log, feeds multilog.MultiLog, hmacSec *[32]byte) (*VerificationRouter, error) {
+// The options are passed to each of the sinks.
+func NewVerificationRouter(rxlog margaret.Log, feeds multilog.MultiLog, hmacSec *[32]byte, opts ...VerifyOption) (*VerificationRouter, error) {
 	return &VerificationRouter{
 		hmacSec: hmacSec,
+		opts:    opts,
 
 		rxlog: rxlog,
 		feeds: feeds,
@@ -48,12 +50,14 @@ type VerificationRouter struct {
 	saver SaveMessager
 
 	hmacSec *[32]byte
+	opts    []VerifyOption
 
 	mu    *sync.Mutex
 	sinks verifyFanIn
 }
 
 // GetSink returns a verification sink for that author. If called twice for the same author it returns the same drink (for deduplication)
+// If complete is false and nothing of the feed is stored yet, the sink accepts a slice of the feed (see NewSlicedVerifySink).
 func (vs *VerificationRouter) GetSink(ref refs.FeedRef, complete bool) (SequencedVerificationSink, error) {
 	vs.mu.Lock()
 	defer vs.mu.Unlock()
@@ -71,7 +75,11 @@ func (vs *VerificationRouter) GetSink(ref refs.FeedRef, complete bool) (Sequence
 		return nil, err
 	}
 
-	snk, err = NewVerifySink(ref, msg, vs.saver, vs.hmacSec)
+	if !complete && msg.Seq() == 0 {
+		snk, err = NewSlicedVerifySink(ref, vs.saver, vs.hmacSec, vs.opts...)
+	} else {
+		snk, err = NewVerifySink(ref, msg, vs.saver, vs.hmacSec, vs.opts...)
+	}
 	if err != nil {
 		return nil, err
 	}
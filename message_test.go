@@ -0,0 +1,133 @@
+// SPDX-FileCopyrightText: 2021 The Go-SSB Authors
+//
+// SPDX-License-Identifier: MIT
+
+package ssb
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+
+	refs "github.com/ssbc/go-ssb-refs"
+	"github.com/stretchr/testify/require"
+)
+
+const testMessageAuthor = "@Wb3oYdI/t6X8GwR0W7BaKSFLGrAJJTCUZmtDIkPlvVE=.ed25519"
+
+// testMessage returns the JSON value of a post with the passed sequence and a text of textLen bytes
+func testMessage(seq int64, textLen int) []byte {
+	var mentions []string
+	for i := 0; i < 10; i++ {
+		mentions = append(mentions, fmt.Sprintf(`{"link":%q,"name":"friend%d"}`, testMessageAuthor, i))
+	}
+	previous := "null"
+	if seq > 1 {
+		previous = `"%R8heq/tQoxEIPkWf0Kxn1nCm/CsxG2CDpUYnAvdbXY8=.sha256"`
+	}
+	return []byte(fmt.Sprintf(`{
+  "previous": %s,
+  "author": %q,
+  "sequence": %d,
+  "timestamp": 1514517067954,
+  "hash": "sha256",
+  "content": {
+    "type": "post",
+    "text": %q,
+    "mentions": [%s]
+  },
+  "signature": "U5kcRU9ACUqTQ0EAHdGsjnt2v2IiVVfxaNBOKgz7nDdJQW5DvFNxlU5Z6bB6y1Kp/mzlgYLbmg0jUSLE4Q1zDg==.sig.ed25519"
+}`, previous, testMessageAuthor, seq, strings.Repeat("hello ", textLen/6), strings.Join(mentions, ",")))
+}
+
+func TestMessage(t *testing.T) {
+	r := require.New(t)
+
+	author, err := refs.ParseFeedRef(testMessageAuthor)
+	r.NoError(err)
+
+	first := NewMessage(testMessage(1, 60))
+	prev, err := first.Previous()
+	r.NoError(err)
+	r.Nil(prev)
+
+	msg := NewMessage(testMessage(2, 60))
+
+	// the fields are decoded once, concurrent access is fine
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			msg.Author()
+		}()
+	}
+	wg.Wait()
+
+	gotAuthor, err := msg.Author()
+	r.NoError(err)
+	r.True(gotAuthor.Equal(author))
+
+	seq, err := msg.Sequence()
+	r.NoError(err)
+	r.EqualValues(2, seq)
+
+	prev, err = msg.Previous()
+	r.NoError(err)
+	r.NotNil(prev)
+	r.Equal("%R8heq/tQoxEIPkWf0Kxn1nCm/CsxG2CDpUYnAvdbXY8=.sha256", prev.String())
+
+	content, err := msg.Content()
+	r.NoError(err)
+	tipe, ok := ContentType(content)
+	r.True(ok)
+	r.Equal("post", tipe)
+
+	var post refs.Post
+	r.NoError(msg.UnmarshalContent(&post))
+	r.Equal("post", post.Type)
+	r.Len(post.Mentions, 10)
+
+	broken := NewMessage([]byte(`{"author": "not a feed"}`))
+	_, err = broken.Sequence()
+	r.Error(err)
+	_, err = broken.Content()
+	r.Error(err, "the error should be cached")
+}
+
+// header-only access vs decoding the whole message, with a 2KiB post:
+//
+//	BenchmarkMessageHeader     	   79116	     12799 ns/op	    3552 B/op	       9 allocs/op
+//	BenchmarkMessageFullDecode 	   34156	     33591 ns/op	    7712 B/op	     120 allocs/op
+func BenchmarkMessageHeader(b *testing.B) {
+	raw := testMessage(2, 2048)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		msg := NewMessage(raw)
+		if _, err := msg.Author(); err != nil {
+			b.Fatal(err)
+		}
+		if _, err := msg.Sequence(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkMessageFullDecode(b *testing.B) {
+	raw := testMessage(2, 2048)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		var v struct {
+			Author   refs.FeedRef           `json:"author"`
+			Sequence int64                  `json:"sequence"`
+			Content  map[string]interface{} `json:"content"`
+		}
+		if err := json.Unmarshal(raw, &v); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
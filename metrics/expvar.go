@@ -0,0 +1,106 @@
+// SPDX-FileCopyrightText: 2021 The Go-SSB Authors
+//
+// SPDX-License-Identifier: MIT
+
+package metrics
+
+import (
+	"expvar"
+	"strings"
+	"sync"
+
+	kitmetrics "github.com/go-kit/kit/metrics"
+	kitexpvar "github.com/go-kit/kit/metrics/expvar"
+)
+
+// NewExpvar returns a collector which publishes the metrics with the expvar package as prefix.name,
+// so they show up on /debug/vars of the default HTTP server.
+//
+// Counters and gauges are published as maps, which have one entry per set of labels, like "index=get".
+// Metrics without labels use the empty key.
+// Histograms are published as quantiles (see the expvar package of go-kit) and ignore the labels.
+//
+// The expvar package is global to the process, collectors with the same prefix report to the same variables.
+func NewExpvar(prefix string) Collector {
+	return expvarCollector{prefix: prefix}
+}
+
+// published keeps track of the variables of all the collectors, since publishing a name twice panics
+var published = struct {
+	sync.Mutex
+	histograms map[string]*kitexpvar.Histogram
+}{histograms: make(map[string]*kitexpvar.Histogram)}
+
+type expvarCollector struct {
+	prefix string
+}
+
+func (ec expvarCollector) Counter(name string) kitmetrics.Counter {
+	return expvarCounter{expvarMetric{vars: publishedMap(ec.prefix + "." + name)}}
+}
+
+func (ec expvarCollector) Gauge(name string) kitmetrics.Gauge {
+	return expvarGauge{expvarMetric{vars: publishedMap(ec.prefix + "." + name)}}
+}
+
+func (ec expvarCollector) Histogram(name string) kitmetrics.Histogram {
+	published.Lock()
+	defer published.Unlock()
+
+	full := ec.prefix + "." + name
+	h, has := published.histograms[full]
+	if !has {
+		h = kitexpvar.NewHistogram(full, 50)
+		published.histograms[full] = h
+	}
+	return h
+}
+
+// publishedMap returns the map for name, publishing it if it doesn't exist yet
+func publishedMap(name string) *expvar.Map {
+	published.Lock()
+	defer published.Unlock()
+
+	if m, ok := expvar.Get(name).(*expvar.Map); ok {
+		return m
+	}
+	return expvar.NewMap(name)
+}
+
+// expvarMetric is a counter or gauge, which are both stored in the map by their labels
+type expvarMetric struct {
+	vars *expvar.Map
+	key  string
+}
+
+func (em expvarMetric) with(labelValues ...string) expvarMetric {
+	var pairs []string
+	if em.key != "" {
+		pairs = append(pairs, em.key)
+	}
+	for i := 0; i+1 < len(labelValues); i += 2 {
+		pairs = append(pairs, labelValues[i]+"="+labelValues[i+1])
+	}
+	return expvarMetric{vars: em.vars, key: strings.Join(pairs, ",")}
+}
+
+func (em expvarMetric) Add(delta float64) { em.vars.AddFloat(em.key, delta) }
+
+func (em expvarMetric) Set(value float64) {
+	f := new(expvar.Float)
+	f.Set(value)
+	em.vars.Set(em.key, f)
+}
+
+// expvarCounter and expvarGauge only differ in the type With returns
+type expvarCounter struct{ expvarMetric }
+
+func (ec expvarCounter) With(labelValues ...string) kitmetrics.Counter {
+	return expvarCounter{ec.with(labelValues...)}
+}
+
+type expvarGauge struct{ expvarMetric }
+
+func (eg expvarGauge) With(labelValues ...string) kitmetrics.Gauge {
+	return expvarGauge{eg.with(labelValues...)}
+}
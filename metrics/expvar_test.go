@@ -0,0 +1,38 @@
+// SPDX-FileCopyrightText: 2021 The Go-SSB Authors
+//
+// SPDX-License-Identifier: MIT
+
+package metrics
+
+import (
+	"expvar"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestExpvar(t *testing.T) {
+	r := require.New(t)
+
+	c := NewExpvar("test")
+	c.Counter(MessagesStored).Add(2)
+	c.Gauge(IndexLag).With("index", "get").Set(5)
+	c.Gauge(IndexLag).With("index", "contacts").Set(1)
+	c.Histogram("latency").Observe(0.5)
+
+	// the same prefix reports to the same variables instead of publishing them again
+	again := NewExpvar("test")
+	again.Counter(MessagesStored).Add(1)
+	again.Histogram("latency").Observe(1)
+
+	stored, ok := expvar.Get("test." + MessagesStored).(*expvar.Map)
+	r.True(ok)
+	r.Equal("3", stored.Get("").String())
+
+	lag, ok := expvar.Get("test." + IndexLag).(*expvar.Map)
+	r.True(ok)
+	r.Equal("5", lag.Get("index=get").String())
+	r.Equal("1", lag.Get("index=contacts").String())
+
+	r.NotNil(expvar.Get("test.latency.p50"))
+}
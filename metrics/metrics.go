@@ -0,0 +1,70 @@
+// SPDX-FileCopyrightText: 2021 The Go-SSB Authors
+//
+// SPDX-License-Identifier: MIT
+
+// Package metrics defines what the bot measures and the Collector it reports it to.
+//
+// The metrics are the ones of github.com/go-kit/kit/metrics, so a Collector can be backed by any of its implementations, like prometheus.
+// This package comes with Discard, which drops everything, and NewExpvar, which publishes the metrics with the expvar package.
+package metrics
+
+import (
+	kitmetrics "github.com/go-kit/kit/metrics"
+	"github.com/go-kit/kit/metrics/discard"
+)
+
+// Names of the metrics which are reported to a Collector.
+const (
+	// BlobsPut counts the blobs which were added to the blob store.
+	BlobsPut = "blobs_put"
+
+	// BlobsServed counts the blobs which were sent to peers.
+	BlobsServed = "blobs_served"
+
+	// HandshakesAccepted counts the incoming connections which completed the secret-handshake.
+	HandshakesAccepted = "handshakes_accepted"
+
+	// HandshakesRejected counts the incoming connections which failed the secret-handshake, like peers with a different app key.
+	HandshakesRejected = "handshakes_rejected"
+
+	// MessagesStored counts the messages which were appended to the root log, published or received.
+	MessagesStored = "messages_stored"
+
+	// PeerBytesSent and PeerBytesReceived count the bytes of the muxrpc sessions, before encryption.
+	// They have a label "peer" with the short sigil of the remote feed.
+	PeerBytesSent     = "peer_bytes_sent"
+	PeerBytesReceived = "peer_bytes_received"
+
+	// PeerWrites counts the writes of the muxrpc sessions, there are two for every packet (header and body).
+	// It has a label "peer" like PeerBytesSent.
+	PeerWrites = "peer_writes"
+
+	// PeerBytesInFlight is a gauge of the bytes which are being written to a peer but were not taken by the connection yet.
+	// It stays above zero while the send buffer to the peer is full. It has a label "peer" like PeerBytesSent.
+	PeerBytesInFlight = "peer_bytes_in_flight"
+
+	// SlowPeers counts the writes to peers which blocked for longer than the configured threshold.
+	SlowPeers = "slow_peers"
+
+	// IndexLag is a gauge of how many messages an index is behind the log it is built from.
+	// It has a label "index" with the name of the index.
+	IndexLag = "index_lag"
+)
+
+// Collector hands out the metrics by their name.
+// Asking for the same name again must return a metric which reports to the same place.
+// The components of the bot ask for their metrics once when they are created.
+type Collector interface {
+	Counter(name string) kitmetrics.Counter
+	Gauge(name string) kitmetrics.Gauge
+	Histogram(name string) kitmetrics.Histogram
+}
+
+// Discard returns a collector which drops all the metrics. It is the default if nothing is configured.
+func Discard() Collector { return discardCollector{} }
+
+type discardCollector struct{}
+
+func (discardCollector) Counter(string) kitmetrics.Counter     { return discard.NewCounter() }
+func (discardCollector) Gauge(string) kitmetrics.Gauge         { return discard.NewGauge() }
+func (discardCollector) Histogram(string) kitmetrics.Histogram { return discard.NewHistogram() }
@@ -76,7 +76,10 @@ func NewCombinedIndex(
 
 		file: idxStateFile,
 		l:    &sync.Mutex{},
+
+		droppedPath: r.GetPath(repo.PrefixMultiLog, "combined-retention.json"),
 	}
+	idx.loadDropped()
 	return idx, nil
 }
 
@@ -97,6 +100,10 @@ type CombinedIndex struct {
 
 	ebtState *statematrix.StateMatrix
 
+	retention   RetentionPolicy
+	droppedPath string
+	dropped     map[string]int64 // how many sublog entries of each feed were handed over to retention
+
 	file *os.File
 	l    *sync.Mutex
 }
@@ -221,6 +228,12 @@ func (idx *CombinedIndex) update(rxSeq int64, msg refs.Message) error {
 		return fmt.Errorf("error updating author sublog: %w", err)
 	}
 
+	if idx.retention != nil {
+		if err := idx.applyRetention(author); err != nil {
+			return err
+		}
+	}
+
 	// TODO: batch/debounce me
 	err = idx.ebtState.Fill(idx.self, []statematrix.ObservedFeed{{
 		Feed: author,
@@ -0,0 +1,116 @@
+// SPDX-FileCopyrightText: 2021 The Go-SSB Authors
+//
+// SPDX-License-Identifier: MIT
+
+package multilogs
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	refs "github.com/ssbc/go-ssb-refs"
+
+	"github.com/ssbc/go-ssb/internal/storedrefs"
+)
+
+// RetentionPolicy limits how many messages of a feed the combined index keeps in its sublog of the users multilog.
+type RetentionPolicy interface {
+	// Limit returns how many of the latest messages of feed are kept. 0 keeps all of them.
+	Limit(feed refs.FeedRef) int64
+
+	// Dropped is called with the receive log sequences of the messages of feed which exceed its limit.
+	// It should null them in the receive log and keep them in a way that survives a crash until it did, since the index won't report them again.
+	// If it fails, indexing stops with the error.
+	// It is called while the receive log is indexed, which means it can't use the receive log itself.
+	Dropped(feed refs.FeedRef, rxSeqs []int64) error
+}
+
+// SetRetention makes the index drop the older messages of the feeds which p limits.
+// The sublog of such a feed keeps the entries of the dropped messages, which are nulled by p,
+// so the feed starts with a run of nulled messages (see message.FeedOrigin).
+// It needs to be set before the index is used.
+func (idx *CombinedIndex) SetRetention(p RetentionPolicy) {
+	idx.retention = p
+}
+
+// applyRetention hands the messages of author which exceed its limit over to the retention policy.
+//
+// The sublog can only grow. Replacing it with a shorter one would end the live queries on it
+// and lose the feed if the process stopped before the new one was stored, so its entries stay.
+// Instead the number of entries which were handed over is stored for each feed, so only the new ones are handed over on each append.
+func (idx *CombinedIndex) applyRetention(author refs.FeedRef) error {
+	limit := idx.retention.Limit(author)
+	if limit <= 0 {
+		return nil
+	}
+
+	authorLog, err := idx.users.Get(storedrefs.Feed(author))
+	if err != nil {
+		return fmt.Errorf("retention: error opening sublog: %w", err)
+	}
+
+	feed := author.String()
+	dropped := idx.dropped[feed]
+	exceeding := authorLog.Seq() + 1 - limit
+	if exceeding <= dropped {
+		return nil
+	}
+
+	rxSeqs := make([]int64, 0, exceeding-dropped)
+	for i := dropped; i < exceeding; i++ {
+		v, err := authorLog.Get(i)
+		if err != nil {
+			return fmt.Errorf("retention: error getting sublog entry %d: %w", i, err)
+		}
+		rxSeq, ok := v.(int64)
+		if !ok {
+			return fmt.Errorf("retention: wrong sublog entry type: %T", v)
+		}
+		rxSeqs = append(rxSeqs, rxSeq)
+	}
+
+	if err := idx.retention.Dropped(author, rxSeqs); err != nil {
+		return fmt.Errorf("retention: error handing over dropped messages: %w", err)
+	}
+
+	idx.dropped[feed] = exceeding
+	if err := idx.storeDropped(); err != nil {
+		return fmt.Errorf("retention: %w", err)
+	}
+	return nil
+}
+
+// loadDropped reads how many entries of each feed were handed over to the retention policy.
+// A lost or damaged file only means that entries are handed over again, which nulls their messages a second time.
+func (idx *CombinedIndex) loadDropped() {
+	idx.dropped = make(map[string]int64)
+
+	data, err := ioutil.ReadFile(idx.droppedPath)
+	if err != nil {
+		return
+	}
+	var dropped map[string]int64
+	if err := json.Unmarshal(data, &dropped); err != nil {
+		return
+	}
+	idx.dropped = dropped
+}
+
+// storeDropped writes the handed over entries next to the file and renames it, so that the old one stays if that fails.
+func (idx *CombinedIndex) storeDropped() error {
+	data, err := json.Marshal(idx.dropped)
+	if err != nil {
+		return fmt.Errorf("error encoding dropped entries: %w", err)
+	}
+
+	tmpPath := idx.droppedPath + ".tmp"
+	if err := ioutil.WriteFile(tmpPath, data, 0600); err != nil {
+		return fmt.Errorf("error writing dropped entries: %w", err)
+	}
+	if err := os.Rename(tmpPath, idx.droppedPath); err != nil {
+		return fmt.Errorf("error replacing dropped entries: %w", err)
+	}
+	return nil
+}
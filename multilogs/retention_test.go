@@ -0,0 +1,144 @@
+// SPDX-FileCopyrightText: 2021 The Go-SSB Authors
+//
+// SPDX-License-Identifier: MIT
+
+package multilogs
+
+import (
+	"context"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ssbc/go-luigi"
+	"github.com/ssbc/margaret"
+	"github.com/ssbc/margaret/indexes"
+	multifs "github.com/ssbc/margaret/multilog/roaring/fs"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ssbc/go-ssb"
+	refs "github.com/ssbc/go-ssb-refs"
+	"github.com/ssbc/go-ssb/internal/storedrefs"
+	"github.com/ssbc/go-ssb/message"
+	"github.com/ssbc/go-ssb/repo"
+)
+
+// testRetention keeps limit messages of each feed and records the dropped ones
+type testRetention struct {
+	limit   int64
+	dropped []int64
+}
+
+func (tr *testRetention) Limit(refs.FeedRef) int64 { return tr.limit }
+
+func (tr *testRetention) Dropped(_ refs.FeedRef, rxSeqs []int64) error {
+	tr.dropped = append(tr.dropped, rxSeqs...)
+	return nil
+}
+
+// retentionSetup publishes messages of a single feed to a fresh root log, which a combined index with retention indexes
+type retentionSetup struct {
+	t      *testing.T
+	rxlog  margaret.Log
+	pub    ssb.Publisher
+	author refs.FeedRef
+	idx    indexes.SinkIndex
+}
+
+func newRetentionSetup(t *testing.T, policy RetentionPolicy) *retentionSetup {
+	r := require.New(t)
+
+	testPath := filepath.Join("testrun", t.Name())
+	os.RemoveAll(testPath)
+
+	rxlog, err := repo.OpenLog(repo.New(testPath))
+	r.NoError(err)
+	t.Cleanup(func() { rxlog.Close() })
+
+	users, idx, closer := setupCombinedIndex(t, rxlog, makeFsMlog)
+	t.Cleanup(func() { closer.Close() })
+	idx.(*CombinedIndex).SetRetention(policy)
+
+	kp, err := ssb.NewKeyPair(rand.New(rand.NewSource(42)), refs.RefAlgoFeedSSB1)
+	r.NoError(err)
+	latest := message.NewLatestCache(rxlog, users, nil)
+	pub, err := message.OpenPublishLog(rxlog, users, kp, message.UseLatestCache(latest))
+	r.NoError(err)
+
+	return &retentionSetup{t: t, rxlog: rxlog, pub: pub, author: kp.ID(), idx: idx}
+}
+
+// publish publishes n messages and indexes them
+func (rs *retentionSetup) publish(n int) {
+	r := require.New(rs.t)
+	for i := 0; i < n; i++ {
+		_, err := rs.pub.Publish(map[string]interface{}{"type": "test", "i": i})
+		r.NoError(err)
+	}
+
+	src, err := rs.rxlog.Query(rs.idx.QuerySpec())
+	r.NoError(err)
+	r.NoError(luigi.Pump(context.TODO(), rs.idx, src))
+}
+
+func TestRetentionCrash(t *testing.T) {
+	r := require.New(t)
+
+	policy := &testRetention{limit: 10}
+	rs := newRetentionSetup(t, policy)
+	idx := rs.idx.(*CombinedIndex)
+
+	rs.publish(15)
+	r.Equal([]int64{0, 1, 2, 3, 4}, policy.dropped)
+	r.NoError(idx.users.Flush())
+
+	// the process stops after these are indexed but before the sublogs are flushed again
+	rs.publish(5)
+	r.Equal([]int64{0, 1, 2, 3, 4, 5, 6, 7, 8, 9}, policy.dropped)
+
+	stored, err := multifs.NewMultiLog(filepath.Join("testrun", t.Name(), "combinedIndexes", "mlog", "user"))
+	r.NoError(err)
+	defer stored.Close()
+
+	// the feed is still there with the entries of the last flush
+	userLog, err := stored.Get(storedrefs.Feed(rs.author))
+	r.NoError(err)
+	r.EqualValues(14, userLog.Seq())
+
+	origin, err := message.FeedOrigin(rs.rxlog, userLog)
+	r.NoError(err)
+	r.EqualValues(1, origin)
+
+	// the dropped entries aren't handed over again
+	restarted := &CombinedIndex{droppedPath: idx.droppedPath}
+	restarted.loadDropped()
+	r.Equal(map[string]int64{rs.author.String(): 10}, restarted.dropped)
+}
+
+func TestRetentionLiveQuery(t *testing.T) {
+	r := require.New(t)
+	ctx, cancel := context.WithCancel(context.TODO())
+	defer cancel()
+
+	policy := &testRetention{limit: 3}
+	rs := newRetentionSetup(t, policy)
+	idx := rs.idx.(*CombinedIndex)
+
+	rs.publish(2)
+
+	userLog, err := idx.users.Get(storedrefs.Feed(rs.author))
+	r.NoError(err)
+	src, err := userLog.Query(margaret.Live(true), margaret.Gt(userLog.Seq()))
+	r.NoError(err)
+
+	// dropping messages doesn't end the query
+	rs.publish(8)
+	r.Equal([]int64{0, 1, 2, 3, 4, 5, 6}, policy.dropped)
+
+	for want := int64(2); want < 10; want++ {
+		v, err := src.Next(ctx)
+		r.NoError(err)
+		r.Equal(want, v)
+	}
+}
@@ -0,0 +1,164 @@
+// SPDX-FileCopyrightText: 2021 The Go-SSB Authors
+//
+// SPDX-License-Identifier: MIT
+
+package ssb
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/ssbc/go-netwrap"
+	"github.com/ssbc/go-secretstream"
+	refs "github.com/ssbc/go-ssb-refs"
+)
+
+// ErrNoUsableAddress is returned by ParseMultiserverAddress if none of the addresses it got has a net or ws transport with an shs key.
+var ErrNoUsableAddress = errors.New("ssb: no usable multiserver address")
+
+// The transports of an Address.
+const (
+	TransportNet = "net"
+	TransportWS  = "ws"
+	TransportWSS = "wss"
+)
+
+// Address is a multiserver address of a peer, like net:host:port~shs:key.
+// See https://github.com/ssbc/multiserver#address-format for the format.
+type Address struct {
+	// Transport is one of TransportNet, TransportWS or TransportWSS.
+	Transport string
+
+	// Host is the hostname or IP of the peer. Hostnames are resolved when the address is dialed, see WrappedAddr.
+	Host string
+	Port int
+
+	// PubKey is the key from the shs part of the address, which is the feed of the peer.
+	PubKey refs.FeedRef
+}
+
+// ParseMultiserverAddress parses a multiserver address.
+// Addresses can list alternatives, separated by ';'. Of these, the first with a net transport is used, or the first with a ws one if there is none.
+// Other transports, like onion or tunnel, are skipped.
+// Each needs to be followed by an shs transform with the public key of the peer.
+func ParseMultiserverAddress(s string) (*Address, error) {
+	var (
+		ws      *Address
+		lastErr error
+	)
+	for _, alt := range strings.Split(s, ";") {
+		addr, err := parseSingleAddress(alt)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		if addr == nil {
+			continue
+		}
+		if addr.Transport == TransportNet {
+			return addr, nil
+		}
+		if ws == nil {
+			ws = addr
+		}
+	}
+	if ws != nil {
+		return ws, nil
+	}
+	if lastErr != nil {
+		return nil, fmt.Errorf("%w: %s", ErrNoUsableAddress, lastErr)
+	}
+	return nil, ErrNoUsableAddress
+}
+
+// parseSingleAddress parses one of the alternatives of a multiserver address.
+// It returns nil and no error if the transport isn't one that can be used.
+func parseSingleAddress(s string) (*Address, error) {
+	parts := strings.Split(s, "~")
+	if len(parts) < 2 {
+		return nil, fmt.Errorf("ssb: multiserver address %q has no transform", s)
+	}
+
+	var addr Address
+	transport := parts[0]
+	switch {
+	case strings.HasPrefix(transport, "net:"):
+		addr.Transport = TransportNet
+		transport = strings.TrimPrefix(transport, "net:")
+	case strings.HasPrefix(transport, "ws:"), strings.HasPrefix(transport, "wss:"):
+		addr.Transport = TransportWS
+		if strings.HasPrefix(transport, "wss:") {
+			addr.Transport = TransportWSS
+		}
+		// both ws://host:port and ws:host:port are in use
+		transport = strings.TrimPrefix(transport, addr.Transport+":")
+		transport = strings.TrimPrefix(transport, "//")
+		transport = strings.TrimSuffix(transport, "/")
+	default:
+		return nil, nil
+	}
+
+	host, portStr, err := net.SplitHostPort(transport)
+	if err != nil {
+		return nil, fmt.Errorf("ssb: invalid host and port in multiserver address %q: %w", s, err)
+	}
+	if host == "" {
+		return nil, fmt.Errorf("ssb: no host in multiserver address %q", s)
+	}
+	port, err := strconv.Atoi(portStr)
+	if err != nil || port <= 0 || port > 65535 {
+		return nil, fmt.Errorf("ssb: invalid port in multiserver address %q", s)
+	}
+	addr.Host = host
+	addr.Port = port
+
+	for _, transform := range parts[1:] {
+		if !strings.HasPrefix(transform, "shs:") {
+			continue
+		}
+		// there might be more fields after the key, like a seed
+		key := strings.SplitN(strings.TrimPrefix(transform, "shs:"), ":", 2)[0]
+		pubKey, err := base64.StdEncoding.DecodeString(key)
+		if err != nil {
+			return nil, fmt.Errorf("ssb: invalid shs key in multiserver address %q: %w", s, err)
+		}
+		addr.PubKey, err = refs.NewFeedRefFromBytes(pubKey, refs.RefAlgoFeedSSB1)
+		if err != nil {
+			return nil, fmt.Errorf("ssb: invalid shs key in multiserver address %q: %w", s, err)
+		}
+		return &addr, nil
+	}
+	return nil, fmt.Errorf("ssb: no shs key in multiserver address %q", s)
+}
+
+// String returns the address in the format that ParseMultiserverAddress reads.
+func (a Address) String() string {
+	var sb strings.Builder
+	sb.WriteString(a.Transport)
+	if a.Transport == TransportNet {
+		sb.WriteString(":")
+	} else {
+		sb.WriteString("://")
+	}
+	sb.WriteString(net.JoinHostPort(a.Host, strconv.Itoa(a.Port)))
+	sb.WriteString("~shs:")
+	sb.WriteString(base64.StdEncoding.EncodeToString(a.PubKey.PubKey()))
+	return sb.String()
+}
+
+// WrappedAddr resolves the host of a net address and returns it with the key of the peer, as Network.Connect needs it.
+// The network node can't dial websocket addresses.
+func (a Address) WrappedAddr() (net.Addr, error) {
+	if a.Transport != TransportNet {
+		return nil, fmt.Errorf("ssb: can't dial %s addresses", a.Transport)
+	}
+	tcpAddr, err := net.ResolveTCPAddr("tcp", net.JoinHostPort(a.Host, strconv.Itoa(a.Port)))
+	if err != nil {
+		return nil, fmt.Errorf("ssb: failed to resolve %s: %w", a.Host, err)
+	}
+	return netwrap.WrapAddr(tcpAddr, secretstream.Addr{PubKey: a.PubKey.PubKey()}), nil
+}
@@ -0,0 +1,112 @@
+// SPDX-FileCopyrightText: 2021 The Go-SSB Authors
+//
+// SPDX-License-Identifier: MIT
+
+package ssb_test
+
+import (
+	"errors"
+	"net"
+	"testing"
+
+	"github.com/ssbc/go-netwrap"
+	"github.com/ssbc/go-secretstream"
+	refs "github.com/ssbc/go-ssb-refs"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ssbc/go-ssb"
+)
+
+const testMultiserverKey = "drNvbM6G1BSwklFzhKvRqeQZyHnxfkOKEbwPd3Fr3co="
+
+func TestParseMultiserverAddressNet(t *testing.T) {
+	r := require.New(t)
+
+	input := "net:localhost:8008~shs:" + testMultiserverKey
+	addr, err := ssb.ParseMultiserverAddress(input)
+	r.NoError(err)
+	r.Equal(ssb.TransportNet, addr.Transport)
+	r.Equal("localhost", addr.Host)
+	r.Equal(8008, addr.Port)
+	r.Equal("@"+testMultiserverKey+".ed25519", addr.PubKey.String())
+	r.Equal(input, addr.String())
+
+	again, err := ssb.ParseMultiserverAddress(addr.String())
+	r.NoError(err)
+	r.Equal(addr, again)
+
+	wrapped, err := addr.WrappedAddr()
+	r.NoError(err)
+	tcpAddr, ok := netwrap.GetAddr(wrapped, "tcp").(*net.TCPAddr)
+	r.True(ok, "no tcp address: %v", wrapped)
+	r.Equal(8008, tcpAddr.Port)
+	r.True(tcpAddr.IP.IsLoopback())
+	shsAddr, ok := netwrap.GetAddr(wrapped, "shs-bs").(secretstream.Addr)
+	r.True(ok, "no shs address: %v", wrapped)
+	r.Equal([]byte(addr.PubKey.PubKey()), shsAddr.PubKey)
+
+	// IPv6 hosts need brackets
+	addr, err = ssb.ParseMultiserverAddress("net:[fe80::1]:8008~shs:" + testMultiserverKey)
+	r.NoError(err)
+	r.Equal("fe80::1", addr.Host)
+	r.Equal("net:[fe80::1]:8008~shs:"+testMultiserverKey, addr.String())
+}
+
+func TestParseMultiserverAddressWebsocket(t *testing.T) {
+	r := require.New(t)
+
+	input := "ws://example.org:8989~shs:" + testMultiserverKey
+	addr, err := ssb.ParseMultiserverAddress(input)
+	r.NoError(err)
+	r.Equal(ssb.TransportWS, addr.Transport)
+	r.Equal("example.org", addr.Host)
+	r.Equal(8989, addr.Port)
+	r.Equal(input, addr.String())
+
+	_, err = addr.WrappedAddr()
+	r.Error(err, "websockets can't be dialed")
+
+	addr, err = ssb.ParseMultiserverAddress("wss:example.org:443~shs:" + testMultiserverKey)
+	r.NoError(err)
+	r.Equal(ssb.TransportWSS, addr.Transport)
+	r.Equal("wss://example.org:443~shs:"+testMultiserverKey, addr.String())
+
+	// the net address of a chain is preferred and other transports are skipped
+	chained := "onion:abcdef.onion:8008~shs:" + testMultiserverKey +
+		";ws://example.org:8989~shs:" + testMultiserverKey +
+		";net:192.168.1.2:8008~shs:" + testMultiserverKey
+	addr, err = ssb.ParseMultiserverAddress(chained)
+	r.NoError(err)
+	r.Equal(ssb.TransportNet, addr.Transport)
+	r.Equal("192.168.1.2", addr.Host)
+
+	addr, err = ssb.ParseMultiserverAddress("onion:abcdef.onion:8008~shs:" + testMultiserverKey + ";ws://example.org:8989~shs:" + testMultiserverKey)
+	r.NoError(err)
+	r.Equal(ssb.TransportWS, addr.Transport)
+
+	// the key is the same in all of them
+	want, err := refs.ParseFeedRef("@" + testMultiserverKey + ".ed25519")
+	r.NoError(err)
+	r.True(want.Equal(addr.PubKey))
+}
+
+func TestParseMultiserverAddressMalformed(t *testing.T) {
+	inputs := []string{
+		"",
+		"net:localhost:8008", // no shs
+		"net:localhost~shs:" + testMultiserverKey,             // no port
+		"net:localhost:port~shs:" + testMultiserverKey,        // port not a number
+		"net:localhost:70000~shs:" + testMultiserverKey,       // port out of range
+		"net::8008~shs:" + testMultiserverKey,                 // no host
+		"net:localhost:8008~shs:not-base64!",                  // key not base64
+		"net:localhost:8008~shs:drNvbM6G1BSwklFzhKvRqeQZyHnx", // key too short
+		"net:localhost:8008~noauth",                           // other transform
+		"onion:abcdef.onion:8008~shs:" + testMultiserverKey,   // unusable transport
+	}
+	for _, input := range inputs {
+		addr, err := ssb.ParseMultiserverAddress(input)
+		require.Error(t, err, "input: %q", input)
+		require.Nil(t, addr, "input: %q", input)
+		require.True(t, errors.Is(err, ssb.ErrNoUsableAddress), "input: %q, err: %v", input, err)
+	}
+}
@@ -6,6 +6,8 @@ package ssb
 
 import (
 	"context"
+	"encoding/base64"
+	"fmt"
 	"io"
 	"net"
 	"net/http"
@@ -15,6 +17,22 @@ import (
 	refs "github.com/ssbc/go-ssb-refs"
 )
 
+// DefaultAppKey is the secret-handshake app key (or network capability) of the main SSB network, base64 encoded.
+// Nodes can only connect to nodes with the same app key, so test nets and private deployments use their own.
+const DefaultAppKey = "1KHLiKZvAvjbY1ziZEHMXawbCEIM6qwjCDm3VYRan/s="
+
+// DecodeAppKey decodes a base64 encoded app key, like DefaultAppKey, and checks its length.
+func DecodeAppKey(appKey string) ([]byte, error) {
+	k, err := base64.StdEncoding.DecodeString(appKey)
+	if err != nil {
+		return nil, fmt.Errorf("ssb: failed to decode app key: %w", err)
+	}
+	if n := len(k); n != 32 {
+		return nil, fmt.Errorf("ssb: app key needs 32 bytes, got %d", n)
+	}
+	return k, nil
+}
+
 // EndpointStat gives some information about a connected peer
 type EndpointStat struct {
 	ID       refs.FeedRef
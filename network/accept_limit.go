@@ -0,0 +1,84 @@
+// SPDX-FileCopyrightText: 2021 The Go-SSB Authors
+//
+// SPDX-License-Identifier: MIT
+
+package network
+
+import (
+	"errors"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var errAcceptRateLimited = errors.New("network: accept rate limit reached")
+
+// acceptLimiter is a token bucket for incoming connections.
+// It sits in front of the secret-handshake, so that a flood of connections doesn't use up the CPU on crypto.
+type acceptLimiter struct {
+	mu       sync.Mutex
+	interval time.Duration // one token per interval
+	burst    int
+	tokens   int
+	last     time.Time
+	now      func() time.Time
+
+	dropped uint64
+	onDrop  func()
+}
+
+func newAcceptLimiter(perSecond, burst int) *acceptLimiter {
+	if burst < 1 {
+		burst = 1
+	}
+	return &acceptLimiter{
+		interval: time.Second / time.Duration(perSecond),
+		burst:    burst,
+		tokens:   burst,
+		now:      time.Now,
+	}
+}
+
+func (l *acceptLimiter) allow() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	if l.last.IsZero() {
+		l.last = now
+	}
+
+	if refill := int(now.Sub(l.last) / l.interval); refill > 0 {
+		l.tokens += refill
+		l.last = l.last.Add(time.Duration(refill) * l.interval)
+		if l.tokens >= l.burst {
+			l.tokens = l.burst
+			l.last = now
+		}
+	}
+
+	if l.tokens == 0 {
+		return false
+	}
+	l.tokens--
+	return true
+}
+
+// connWrapper closes connections right away if there is no token left for them
+func (l *acceptLimiter) connWrapper(c net.Conn) (net.Conn, error) {
+	if l.allow() {
+		return c, nil
+	}
+
+	c.Close()
+	atomic.AddUint64(&l.dropped, 1)
+	if l.onDrop != nil {
+		l.onDrop()
+	}
+	return nil, errAcceptRateLimited
+}
+
+func (l *acceptLimiter) droppedCount() uint64 {
+	return atomic.LoadUint64(&l.dropped)
+}
@@ -0,0 +1,92 @@
+// SPDX-FileCopyrightText: 2021 The Go-SSB Authors
+//
+// SPDX-License-Identifier: MIT
+
+package network
+
+import (
+	"errors"
+	"net"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestAcceptLimiter(t *testing.T) {
+	r := require.New(t)
+
+	lis, err := net.Listen("tcp", "localhost:0")
+	r.NoError(err)
+	defer lis.Close()
+
+	var (
+		mu  sync.Mutex
+		now = time.Unix(1000, 0)
+	)
+	limiter := newAcceptLimiter(10, 5)
+	limiter.now = func() time.Time {
+		mu.Lock()
+		defer mu.Unlock()
+		return now
+	}
+
+	var accepted uint64
+	acceptN := func(n int) {
+		for i := 0; i < n; i++ {
+			c, err := lis.Accept()
+			r.NoError(err)
+
+			c, err = limiter.connWrapper(c)
+			if errors.Is(err, errAcceptRateLimited) {
+				continue
+			}
+			r.NoError(err)
+			atomic.AddUint64(&accepted, 1)
+			c.Close()
+		}
+	}
+
+	dialN := func(n int) {
+		var wg sync.WaitGroup
+		for i := 0; i < n; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				c, err := net.Dial("tcp", lis.Addr().String())
+				if err == nil {
+					c.Close()
+				}
+			}()
+		}
+		wg.Wait()
+	}
+
+	// a flood at once only gets the burst through
+	go dialN(50)
+	acceptN(50)
+	r.EqualValues(5, atomic.LoadUint64(&accepted))
+	r.EqualValues(45, limiter.droppedCount())
+
+	// after half a second, half of the rate is available again
+	mu.Lock()
+	now = now.Add(500 * time.Millisecond)
+	mu.Unlock()
+
+	go dialN(50)
+	acceptN(50)
+	r.EqualValues(10, atomic.LoadUint64(&accepted))
+	r.EqualValues(90, limiter.droppedCount())
+
+	// the bucket doesn't fill over the burst
+	mu.Lock()
+	now = now.Add(time.Minute)
+	mu.Unlock()
+
+	go dialN(50)
+	acceptN(50)
+	r.EqualValues(15, atomic.LoadUint64(&accepted))
+	r.EqualValues(135, limiter.droppedCount())
+}
@@ -0,0 +1,118 @@
+// SPDX-FileCopyrightText: 2021 The Go-SSB Authors
+//
+// SPDX-License-Identifier: MIT
+
+package network_test
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/ssbc/go-muxrpc/v2"
+	"github.com/stretchr/testify/require"
+	"go.mindeco.de/log"
+
+	"github.com/ssbc/go-ssb"
+	refs "github.com/ssbc/go-ssb-refs"
+	"github.com/ssbc/go-ssb/network"
+)
+
+func TestAppKeyMismatch(t *testing.T) {
+	r := require.New(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	newAppKey := func() []byte {
+		k := make([]byte, 32)
+		_, err := rand.Read(k)
+		r.NoError(err)
+		return k
+	}
+	netA, netB := newAppKey(), newAppKey()
+
+	newNode := func(appKey []byte, listen bool) (*network.Node, refs.FeedRef) {
+		kp, err := ssb.NewKeyPair(nil, refs.RefAlgoFeedSSB1)
+		r.NoError(err)
+
+		opts := network.Options{
+			Logger:  log.NewNopLogger(),
+			AppKey:  appKey,
+			KeyPair: kp,
+
+			MakeHandler: func(net.Conn) (muxrpc.Handler, error) {
+				return manifestOnlyHandler{}, nil
+			},
+		}
+		if listen {
+			opts.ListenAddr = &net.TCPAddr{Port: 0}
+		}
+		n, err := network.New(opts)
+		r.NoError(err)
+		t.Cleanup(func() { n.Close() })
+		return n, kp.ID()
+	}
+
+	server, _ := newNode(netA, true)
+	serveErrc := make(chan error, 1)
+	go func() { serveErrc <- server.Serve(ctx) }()
+	serverAddr := server.GetListenAddr()
+
+	// a node of another network fails the handshake
+	stranger, strangerID := newNode(netB, false)
+	err := stranger.Connect(ctx, serverAddr)
+	r.Error(err)
+	_, has := server.GetEndpointFor(strangerID)
+	r.False(has)
+	r.Len(stranger.GetAllEndpoints(), 0)
+
+	// the server keeps serving its network
+	friend, friendID := newNode(netA, false)
+	r.NoError(friend.Connect(ctx, serverAddr))
+	r.Eventually(func() bool {
+		_, has := server.GetEndpointFor(friendID)
+		return has
+	}, 2*time.Second, 10*time.Millisecond)
+
+	// the main network is used by default, so it doesn't mix with others either
+	mainNet, mainNetID := newNode(nil, false)
+	r.Error(mainNet.Connect(ctx, serverAddr))
+	_, has = server.GetEndpointFor(mainNetID)
+	r.False(has)
+
+	// app keys need to have the right length
+	kp, err := ssb.NewKeyPair(nil, refs.RefAlgoFeedSSB1)
+	r.NoError(err)
+	_, err = network.New(network.Options{
+		Logger:  log.NewNopLogger(),
+		AppKey:  []byte("too short"),
+		KeyPair: kp,
+	})
+	r.Error(err)
+
+	cancel()
+	select {
+	case <-serveErrc:
+	case <-time.After(5 * time.Second):
+		t.Fatal("server didn't stop")
+	}
+}
+
+// manifestOnlyHandler only answers the manifest call, which is needed to finish setting up a connection
+type manifestOnlyHandler struct{}
+
+func (manifestOnlyHandler) Handled(muxrpc.Method) bool { return true }
+
+func (manifestOnlyHandler) HandleConnect(context.Context, muxrpc.Endpoint) {}
+
+func (manifestOnlyHandler) HandleCall(ctx context.Context, req *muxrpc.Request) {
+	if req.Method.String() == "manifest" {
+		req.Return(ctx, json.RawMessage(`{}`))
+		return
+	}
+	req.CloseWithError(fmt.Errorf("no such call: %s", req.Method))
+}
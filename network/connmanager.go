@@ -0,0 +1,308 @@
+// SPDX-FileCopyrightText: 2021 The Go-SSB Authors
+//
+// SPDX-License-Identifier: MIT
+
+package network
+
+import (
+	"context"
+	"net"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ssbc/go-muxrpc/v2"
+	refs "github.com/ssbc/go-ssb-refs"
+	"go.mindeco.de/log"
+	"go.mindeco.de/log/level"
+)
+
+// PeerDialer is what the ConnManager needs from a node, *Node implements it.
+type PeerDialer interface {
+	Connect(ctx context.Context, addr net.Addr) error
+	GetEndpointFor(refs.FeedRef) (muxrpc.Endpoint, bool)
+}
+
+var _ PeerDialer = (*Node)(nil)
+
+// ConnManager keeps connections to a set of known peers, like pubs, open.
+// Peers which can't be reached are dialed again with exponential backoff.
+// Each peer gets a score from its successful and failed connections, the best ones are dialed first
+// and the worst ones are disconnected if there are more than MaxConnections.
+type ConnManager struct {
+	dialer PeerDialer
+	logger log.Logger
+	now    func() time.Time
+
+	// MinBackoff is how long the manager waits before dialing a peer again after the first failure. It doubles after each failure up to MaxBackoff.
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+
+	// MaxDials is how many peers are dialed at the same time.
+	MaxDials int
+
+	// MaxConnections is how many of the peers are kept connected.
+	MaxConnections int
+
+	// DialTimeout is how long a dial can take, including the time until the connection shows up as an endpoint.
+	DialTimeout time.Duration
+
+	// CheckInterval is how often the connections are checked.
+	CheckInterval time.Duration
+
+	mu    sync.Mutex
+	peers map[string]*managedPeer
+	dials sync.WaitGroup
+}
+
+type managedPeer struct {
+	addr net.Addr
+	feed refs.FeedRef
+
+	successes, failures int
+
+	backoff  time.Duration
+	nextDial time.Time
+
+	dialing      bool
+	pendingUntil time.Time // after a dial until the endpoint shows up
+	connected    bool
+}
+
+// score is the share of successful connections, starting at one half for unknown peers
+func (p *managedPeer) score() float64 {
+	return float64(p.successes+1) / float64(p.successes+p.failures+2)
+}
+
+func (p *managedPeer) failed(now time.Time, min, max time.Duration) {
+	p.failures++
+	if p.backoff == 0 {
+		p.backoff = min
+	} else {
+		p.backoff *= 2
+	}
+	if p.backoff > max {
+		p.backoff = max
+	}
+	p.nextDial = now.Add(p.backoff)
+}
+
+// NewConnManager returns a manager which uses d to connect to peers.
+// It dials two peers at a time, keeps up to eight connected and waits between a second and five minutes before dialing a failed peer again.
+func NewConnManager(logger log.Logger, d PeerDialer) *ConnManager {
+	return &ConnManager{
+		dialer: d,
+		logger: logger,
+		now:    time.Now,
+
+		MinBackoff:     time.Second,
+		MaxBackoff:     5 * time.Minute,
+		MaxDials:       2,
+		MaxConnections: 8,
+		DialTimeout:    30 * time.Second,
+		CheckInterval:  5 * time.Second,
+
+		peers: make(map[string]*managedPeer),
+	}
+}
+
+// Add adds a peer to the set of peers to keep connected. addr needs to be dialable by the PeerDialer.
+// Adding a peer which is already known updates its address.
+func (cm *ConnManager) Add(addr net.Addr, feed refs.FeedRef) {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+
+	if p, has := cm.peers[feed.String()]; has {
+		p.addr = addr
+		return
+	}
+	cm.peers[feed.String()] = &managedPeer{addr: addr, feed: feed}
+}
+
+// Remove stops managing the connection to feed. An open connection is left alone.
+func (cm *ConnManager) Remove(feed refs.FeedRef) {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+	delete(cm.peers, feed.String())
+}
+
+// Connected returns the managed peers which are currently connected, sorted by their feed.
+func (cm *ConnManager) Connected() []refs.FeedRef {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+
+	var connected []refs.FeedRef
+	for _, p := range cm.peers {
+		if p.connected {
+			connected = append(connected, p.feed)
+		}
+	}
+	sort.Slice(connected, func(i, j int) bool {
+		return connected[i].String() < connected[j].String()
+	})
+	return connected
+}
+
+// PeerStatus is the state of a managed peer.
+type PeerStatus struct {
+	Feed      refs.FeedRef
+	Connected bool
+
+	Successes, Failures int
+	Score               float64
+
+	// Backoff is how long the manager waited after the last failure.
+	Backoff time.Duration
+}
+
+// Peers returns the state of all the managed peers, best score first.
+func (cm *ConnManager) Peers() []PeerStatus {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+
+	var status []PeerStatus
+	for _, p := range cm.sortedPeers() {
+		status = append(status, PeerStatus{
+			Feed:      p.feed,
+			Connected: p.connected,
+			Successes: p.successes,
+			Failures:  p.failures,
+			Score:     p.score(),
+			Backoff:   p.backoff,
+		})
+	}
+	return status
+}
+
+// Serve checks the connections every CheckInterval until ctx is canceled.
+// It waits for running dials before it returns.
+func (cm *ConnManager) Serve(ctx context.Context) error {
+	defer cm.dials.Wait()
+
+	tick := time.NewTicker(cm.CheckInterval)
+	defer tick.Stop()
+
+	for {
+		cm.check(ctx, cm.now())
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-tick.C:
+		}
+	}
+}
+
+func (cm *ConnManager) check(ctx context.Context, now time.Time) {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+
+	sorted := cm.sortedPeers()
+
+	// update the state of the connections
+	var connected, busy int
+	for _, p := range sorted {
+		_, has := cm.dialer.GetEndpointFor(p.feed)
+		switch {
+		case has:
+			if !p.connected {
+				p.connected = true
+				p.successes++
+				p.backoff = 0
+			}
+			p.pendingUntil = time.Time{}
+
+		case p.connected:
+			// dropped
+			p.connected = false
+			p.failed(now, cm.MinBackoff, cm.MaxBackoff)
+
+		case !p.pendingUntil.IsZero() && now.After(p.pendingUntil):
+			// the dial worked but the connection didn't stay up
+			p.pendingUntil = time.Time{}
+			p.failed(now, cm.MinBackoff, cm.MaxBackoff)
+		}
+
+		if p.connected {
+			connected++
+		} else if p.dialing || !p.pendingUntil.IsZero() {
+			busy++
+		}
+	}
+
+	// disconnect the worst peers if there are too many
+	for i := len(sorted) - 1; i >= 0 && connected > cm.MaxConnections; i-- {
+		p := sorted[i]
+		if !p.connected {
+			continue
+		}
+		if edp, has := cm.dialer.GetEndpointFor(p.feed); has {
+			edp.Terminate()
+		}
+		p.connected = false
+		connected--
+		level.Debug(cm.logger).Log("event", "peer dropped", "peer", p.feed.ShortSigil(), "score", p.score())
+	}
+
+	// dial the best peers which are due
+	var dialing int
+	for _, p := range sorted {
+		if p.dialing {
+			dialing++
+		}
+	}
+	for _, p := range sorted {
+		if connected+busy >= cm.MaxConnections || dialing >= cm.MaxDials {
+			break
+		}
+		if p.connected || p.dialing || !p.pendingUntil.IsZero() || now.Before(p.nextDial) {
+			continue
+		}
+
+		p.dialing = true
+		dialing++
+		busy++
+		cm.dials.Add(1)
+		go cm.dial(ctx, p)
+	}
+}
+
+func (cm *ConnManager) dial(ctx context.Context, p *managedPeer) {
+	defer cm.dials.Done()
+
+	cm.mu.Lock()
+	addr := p.addr
+	cm.mu.Unlock()
+
+	dialCtx, cancel := context.WithTimeout(ctx, cm.DialTimeout)
+	err := cm.dialer.Connect(dialCtx, addr)
+	cancel()
+
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+
+	p.dialing = false
+	now := cm.now()
+	if err != nil {
+		p.failed(now, cm.MinBackoff, cm.MaxBackoff)
+		level.Debug(cm.logger).Log("event", "dial failed", "peer", p.feed.ShortSigil(), "err", err, "backoff", p.backoff)
+		return
+	}
+	p.pendingUntil = now.Add(cm.DialTimeout)
+}
+
+// sortedPeers returns the peers by score, best first. cm.mu needs to be held.
+func (cm *ConnManager) sortedPeers() []*managedPeer {
+	sorted := make([]*managedPeer, 0, len(cm.peers))
+	for _, p := range cm.peers {
+		sorted = append(sorted, p)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		si, sj := sorted[i].score(), sorted[j].score()
+		if si != sj {
+			return si > sj
+		}
+		return sorted[i].feed.String() < sorted[j].feed.String()
+	})
+	return sorted
+}
@@ -0,0 +1,256 @@
+// SPDX-FileCopyrightText: 2021 The Go-SSB Authors
+//
+// SPDX-License-Identifier: MIT
+
+package network
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ssbc/go-muxrpc/v2"
+	refs "github.com/ssbc/go-ssb-refs"
+	"github.com/stretchr/testify/require"
+	"go.mindeco.de/log"
+)
+
+// fakePeerAddr is dialed by fakeDialer, it only carries the feed
+type fakePeerAddr struct{ feed refs.FeedRef }
+
+func (a fakePeerAddr) Network() string { return "fake" }
+func (a fakePeerAddr) String() string  { return a.feed.String() }
+
+type fakeEndpoint struct {
+	muxrpc.Endpoint
+
+	d    *fakeDialer
+	feed refs.FeedRef
+}
+
+func (e fakeEndpoint) Terminate() error {
+	e.d.mu.Lock()
+	defer e.d.mu.Unlock()
+	delete(e.d.connected, e.feed.String())
+	return nil
+}
+
+// fakeDialer connects to the feeds in reachable and fails for all others
+type fakeDialer struct {
+	mu        sync.Mutex
+	reachable map[string]bool
+	connected map[string]bool
+
+	dials, inFlight, maxInFlight int
+	block                        chan struct{}
+}
+
+func newFakeDialer(reachable ...refs.FeedRef) *fakeDialer {
+	d := &fakeDialer{
+		reachable: make(map[string]bool),
+		connected: make(map[string]bool),
+	}
+	for _, f := range reachable {
+		d.reachable[f.String()] = true
+	}
+	return d
+}
+
+func (d *fakeDialer) Connect(ctx context.Context, addr net.Addr) error {
+	d.mu.Lock()
+	d.dials++
+	d.inFlight++
+	if d.inFlight > d.maxInFlight {
+		d.maxInFlight = d.inFlight
+	}
+	block := d.block
+	d.mu.Unlock()
+
+	if block != nil {
+		<-block
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.inFlight--
+
+	if !d.reachable[addr.String()] {
+		return errors.New("connection refused")
+	}
+	d.connected[addr.String()] = true
+	return nil
+}
+
+func (d *fakeDialer) GetEndpointFor(feed refs.FeedRef) (muxrpc.Endpoint, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if !d.connected[feed.String()] {
+		return nil, false
+	}
+	return fakeEndpoint{d: d, feed: feed}, true
+}
+
+// drop closes the connection to feed, if there is one
+func (d *fakeDialer) drop(feed refs.FeedRef) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	delete(d.connected, feed.String())
+}
+
+func testConnManagerFeed(t *testing.T, i byte) refs.FeedRef {
+	ref, err := refs.NewFeedRefFromBytes(bytes.Repeat([]byte{i}, 32), refs.RefAlgoFeedSSB1)
+	require.NoError(t, err)
+	return ref
+}
+
+func TestConnManagerBackoff(t *testing.T) {
+	r := require.New(t)
+
+	good := testConnManagerFeed(t, 1)
+	flaky := testConnManagerFeed(t, 2)
+	bad := testConnManagerFeed(t, 3)
+
+	d := newFakeDialer(good, flaky)
+	cm := NewConnManager(log.NewNopLogger(), d)
+	cm.MinBackoff = time.Second
+	cm.MaxBackoff = 8 * time.Second
+	cm.MaxDials = 3
+
+	now := time.Unix(1000, 0)
+	cm.now = func() time.Time { return now }
+	for _, f := range []refs.FeedRef{good, flaky, bad} {
+		cm.Add(fakePeerAddr{f}, f)
+	}
+
+	status := func(feed refs.FeedRef) PeerStatus {
+		for _, ps := range cm.Peers() {
+			if ps.Feed.Equal(feed) {
+				return ps
+			}
+		}
+		t.Fatalf("no status for %s", feed.ShortSigil())
+		return PeerStatus{}
+	}
+
+	ctx := context.Background()
+	var badBackoffs []time.Duration
+	for i := 0; i < 60; i++ {
+		cm.check(ctx, now)
+		cm.dials.Wait()
+
+		if i > 0 {
+			r.Equal([]refs.FeedRef{good}, onlyGood(cm.Connected(), good), "good peer should stay connected (step %d)", i)
+		}
+
+		// the flaky peer drops every connection once it was noticed
+		if status(flaky).Connected {
+			d.drop(flaky)
+		}
+
+		if b := status(bad).Backoff; len(badBackoffs) == 0 || badBackoffs[len(badBackoffs)-1] != b {
+			badBackoffs = append(badBackoffs, b)
+		}
+
+		now = now.Add(500 * time.Millisecond)
+	}
+
+	r.Equal([]time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 8 * time.Second}, badBackoffs)
+
+	goodStatus, flakyStatus, badStatus := status(good), status(flaky), status(bad)
+	r.Equal(1, goodStatus.Successes)
+	r.Zero(goodStatus.Failures)
+	r.Zero(badStatus.Successes)
+	r.Greater(flakyStatus.Failures, 2)
+	r.Greater(flakyStatus.Successes, 2)
+
+	r.Greater(goodStatus.Score, flakyStatus.Score)
+	r.Greater(flakyStatus.Score, badStatus.Score)
+
+	peers := cm.Peers()
+	r.Len(peers, 3)
+	r.True(peers[0].Feed.Equal(good))
+	r.True(peers[2].Feed.Equal(bad))
+
+	// bad was dialed far less often than it was checked
+	d.mu.Lock()
+	dials := d.dials
+	d.mu.Unlock()
+	r.Less(dials, 60)
+}
+
+func onlyGood(connected []refs.FeedRef, good refs.FeedRef) []refs.FeedRef {
+	var got []refs.FeedRef
+	for _, f := range connected {
+		if f.Equal(good) {
+			got = append(got, f)
+		}
+	}
+	return got
+}
+
+func TestConnManagerLimits(t *testing.T) {
+	r := require.New(t)
+
+	var feeds []refs.FeedRef
+	for i := byte(1); i <= 4; i++ {
+		feeds = append(feeds, testConnManagerFeed(t, i))
+	}
+
+	d := newFakeDialer(feeds...)
+	d.block = make(chan struct{})
+
+	cm := NewConnManager(log.NewNopLogger(), d)
+	cm.MaxDials = 2
+	cm.MaxConnections = 3
+	for _, f := range feeds {
+		cm.Add(fakePeerAddr{f}, f)
+	}
+
+	// only MaxDials dials run at the same time
+	ctx := context.Background()
+	cm.check(ctx, time.Now())
+	cm.check(ctx, time.Now())
+	r.Eventually(func() bool {
+		d.mu.Lock()
+		defer d.mu.Unlock()
+		return d.inFlight == 2
+	}, time.Second, time.Millisecond)
+	close(d.block)
+	cm.dials.Wait()
+
+	for i := 0; i < 3; i++ {
+		cm.check(ctx, time.Now())
+		cm.dials.Wait()
+	}
+	r.Len(cm.Connected(), 3)
+
+	d.mu.Lock()
+	r.Equal(2, d.maxInFlight)
+	r.Equal(3, d.dials)
+	d.mu.Unlock()
+
+	// a peer that connected on its own goes over the limit and the worst one is dropped
+	d.mu.Lock()
+	for _, f := range feeds {
+		d.connected[f.String()] = true
+	}
+	d.mu.Unlock()
+
+	cm.check(ctx, time.Now())
+	r.Len(cm.Connected(), 3)
+	_, has := d.GetEndpointFor(feeds[3])
+	r.False(has, "the last peer should be disconnected")
+
+	// Serve stops once the context is canceled
+	ctx, cancel := context.WithCancel(context.Background())
+	cm.CheckInterval = time.Millisecond
+	errc := make(chan error)
+	go func() { errc <- cm.Serve(ctx) }()
+	time.Sleep(10 * time.Millisecond)
+	cancel()
+	r.NoError(<-errc)
+}
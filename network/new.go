@@ -13,6 +13,7 @@ import (
 	"net/http"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/go-kit/kit/metrics"
 	"github.com/ssbc/go-muxrpc/v2"
@@ -24,6 +25,7 @@ import (
 	"github.com/ssbc/go-ssb"
 	refs "github.com/ssbc/go-ssb-refs"
 	"github.com/ssbc/go-ssb/internal/neterr"
+	ssbmetrics "github.com/ssbc/go-ssb/metrics"
 )
 
 // DefaultPort is the default listening port for ScuttleButt.
@@ -38,8 +40,12 @@ type Options struct {
 	AdvertsSend      bool
 	AdvertsConnectTo bool
 
-	KeyPair     ssb.KeyPair
-	AppKey      []byte
+	KeyPair ssb.KeyPair
+
+	// AppKey is the secret-handshake app key, which identifies the network. Nil means ssb.DefaultAppKey.
+	// Connections to and from nodes with another app key fail in the handshake.
+	AppKey []byte
+
 	MakeHandler func(net.Conn) (muxrpc.Handler, error)
 
 	ConnTracker ssb.ConnTracker
@@ -51,14 +57,35 @@ type Options struct {
 	// AfterSecureWrappers are applied afterwards, usefull to debug muxrpc content
 	AfterSecureWrappers []netwrap.ConnWrapper
 
-	EventCounter    metrics.Counter
-	SystemGauge     metrics.Gauge
-	Latency         metrics.Histogram
+	EventCounter metrics.Counter
+	SystemGauge  metrics.Gauge
+	Latency      metrics.Histogram
+
+	// Metrics gets the handshakes of incoming connections, see ssbmetrics.HandshakesAccepted. By default they are discarded.
+	Metrics ssbmetrics.Collector
+
 	EndpointWrapper func(muxrpc.Endpoint) muxrpc.Endpoint
 
 	WebsocketAddr    string
 	WebsocketTLSCert string
 	WebsocketTLSKey  string
+
+	// AcceptRateLimit is the number of incoming connections per second that get to the secret-handshake.
+	// Connections over the limit are closed right away. Zero means no limit.
+	// Established connections and outgoing ones are not affected.
+	AcceptRateLimit int
+
+	// AcceptBurst is the number of incoming connections that can arrive at once before AcceptRateLimit applies.
+	AcceptBurst int
+
+	// SlowPeerThreshold is how long a write to a peer can block before OnSlowPeer is called.
+	// A write blocks when the send buffer of the connection is full, because the peer doesn't drain its streams.
+	// Zero turns the detection off. The traffic of each peer is reported to Metrics either way.
+	SlowPeerThreshold time.Duration
+
+	// OnSlowPeer is called for every write which blocked longer than SlowPeerThreshold, while it is still blocked.
+	// The peer is a candidate for disconnecting. It is called from its own goroutine.
+	OnSlowPeer func(peer refs.FeedRef, blocked time.Duration)
 }
 
 type Node struct {
@@ -82,13 +109,19 @@ type Node struct {
 	beforeCryptoConnWrappers []netwrap.ConnWrapper
 	afterSecureConnWrappers  []netwrap.ConnWrapper
 
+	acceptLimiter *acceptLimiter
+	peerMeter     *peerMeter
+
 	remotesLock sync.Mutex
 	remotes     map[string]muxrpc.Endpoint
 
 	edpWrapper func(muxrpc.Endpoint) muxrpc.Endpoint
 	evtCtr     metrics.Counter
 	sysGauge   metrics.Gauge
-	latency    metrics.Histogram
+
+	handshakesAccepted, handshakesRejected metrics.Counter
+
+	latency metrics.Histogram
 
 	// "ssb-ws"
 	httpLis     net.Listener
@@ -114,6 +147,17 @@ func New(opts Options) (*Node, error) {
 		n.dialer = netwrap.Dial
 	}
 
+	if opts.AppKey == nil {
+		opts.AppKey, err = ssb.DecodeAppKey(ssb.DefaultAppKey)
+		if err != nil {
+			return nil, err
+		}
+		n.opts.AppKey = opts.AppKey
+	}
+	if l := len(opts.AppKey); l != 32 {
+		return nil, fmt.Errorf("network: app key needs 32 bytes, got %d", l)
+	}
+
 	connKeyPair := ssb.EdKeyPair(opts.KeyPair)
 
 	n.secretClient, err = secretstream.NewClient(connKeyPair, opts.AppKey)
@@ -158,6 +202,23 @@ func New(opts Options) (*Node, error) {
 	}
 	n.log = opts.Logger
 
+	collector := opts.Metrics
+	if collector == nil {
+		collector = ssbmetrics.Discard()
+	}
+	n.handshakesAccepted = collector.Counter(ssbmetrics.HandshakesAccepted)
+	n.handshakesRejected = collector.Counter(ssbmetrics.HandshakesRejected)
+	n.peerMeter = newPeerMeter(collector, opts.SlowPeerThreshold, opts.OnSlowPeer)
+
+	if opts.AcceptRateLimit > 0 {
+		n.acceptLimiter = newAcceptLimiter(opts.AcceptRateLimit, opts.AcceptBurst)
+		n.acceptLimiter.onDrop = func() {
+			if n.evtCtr != nil {
+				n.evtCtr.With("event", "dropped").Add(1)
+			}
+		}
+	}
+
 	// local websocket
 	wsHandler := websockHandler(n)
 	httpHandler := http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
@@ -193,6 +254,14 @@ func New(opts Options) (*Node, error) {
 	return n, nil
 }
 
+// DroppedConnections returns the number of incoming connections that were closed because of the AcceptRateLimit.
+func (n *Node) DroppedConnections() uint64 {
+	if n.acceptLimiter == nil {
+		return 0
+	}
+	return n.acceptLimiter.droppedCount()
+}
+
 func (n *Node) HandleHTTP(h http.Handler) {
 	n.httpHandler = h
 }
@@ -322,7 +391,7 @@ func (n *Node) handleConnection(ctx context.Context, origConn net.Conn, isServer
 	// connLogger = level.NewFilter(connLogger, level.AllowInfo())
 	connLogger := log.NewNopLogger()
 
-	edp := muxrpc.Handle(muxrpc.NewPacker(conn), h,
+	edp := muxrpc.Handle(muxrpc.NewPacker(n.peerMeter.wrap(conn, remoteRef)), h,
 		muxrpc.WithContext(ctx),
 		muxrpc.WithLogger(connLogger),
 		// _isServer_ defines _are we a server_.
@@ -353,7 +422,13 @@ func (n *Node) handleConnection(ctx context.Context, origConn net.Conn, isServer
 func (n *Node) Serve(ctx context.Context, wrappers ...muxrpc.HandlerWrapper) error {
 	evtLog := log.With(n.log, "event", "network.Serve")
 	// TODO: make multiple listeners (localhost:8008 should not restrict or kill connections)
-	lisWrap := netwrap.NewListenerWrapper(n.secretServer.Addr(), append(n.opts.BefreCryptoWrappers, n.secretServer.ConnWrapper())...)
+	var lisWrappers []netwrap.ConnWrapper
+	if n.acceptLimiter != nil {
+		lisWrappers = append(lisWrappers, n.acceptLimiter.connWrapper)
+	}
+	lisWrappers = append(lisWrappers, n.opts.BefreCryptoWrappers...)
+	lisWrappers = append(lisWrappers, n.countHandshakes(n.secretServer.ConnWrapper()))
+	lisWrap := netwrap.NewListenerWrapper(n.secretServer.Addr(), lisWrappers...)
 	var err error
 
 	n.listenerLock.Lock()
@@ -440,6 +515,19 @@ func (n *Node) Serve(ctx context.Context, wrappers ...muxrpc.HandlerWrapper) err
 	}
 }
 
+// countHandshakes reports the outcome of the secret-handshake of incoming connections
+func (n *Node) countHandshakes(shs netwrap.ConnWrapper) netwrap.ConnWrapper {
+	return func(c net.Conn) (net.Conn, error) {
+		conn, err := shs(c)
+		if err != nil {
+			n.handshakesRejected.Add(1)
+			return nil, err
+		}
+		n.handshakesAccepted.Add(1)
+		return conn, nil
+	}
+}
+
 func (n *Node) Connect(ctx context.Context, addr net.Addr) error {
 	select {
 	case <-ctx.Done():
@@ -0,0 +1,103 @@
+// SPDX-FileCopyrightText: 2021 The Go-SSB Authors
+//
+// SPDX-License-Identifier: MIT
+
+package network
+
+import (
+	"net"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-kit/kit/metrics"
+	refs "github.com/ssbc/go-ssb-refs"
+
+	ssbmetrics "github.com/ssbc/go-ssb/metrics"
+)
+
+// peerMeter hands out meteredConns, which report the traffic of a muxrpc session to the metrics of the node
+type peerMeter struct {
+	sent, received, writes metrics.Counter
+	inFlight               metrics.Gauge
+	slow                   metrics.Counter
+
+	threshold time.Duration
+	onSlow    func(peer refs.FeedRef, blocked time.Duration)
+}
+
+func newPeerMeter(collector ssbmetrics.Collector, threshold time.Duration, onSlow func(refs.FeedRef, time.Duration)) *peerMeter {
+	return &peerMeter{
+		sent:     collector.Counter(ssbmetrics.PeerBytesSent),
+		received: collector.Counter(ssbmetrics.PeerBytesReceived),
+		writes:   collector.Counter(ssbmetrics.PeerWrites),
+		inFlight: collector.Gauge(ssbmetrics.PeerBytesInFlight),
+		slow:     collector.Counter(ssbmetrics.SlowPeers),
+
+		threshold: threshold,
+		onSlow:    onSlow,
+	}
+}
+
+func (pm *peerMeter) wrap(c net.Conn, peer refs.FeedRef) *meteredConn {
+	label := peer.ShortSigil()
+	return &meteredConn{
+		Conn: c,
+		peer: peer,
+		pm:   pm,
+
+		sent:     pm.sent.With("peer", label),
+		received: pm.received.With("peer", label),
+		writes:   pm.writes.With("peer", label),
+		inFlight: pm.inFlight.With("peer", label),
+	}
+}
+
+// meteredConn counts the bytes which go through the connection.
+// A write which doesn't return for longer than the threshold means the send buffer of the connection is full,
+// because the peer doesn't read fast enough. The meter is told about these stalls once per write.
+type meteredConn struct {
+	net.Conn
+
+	peer refs.FeedRef
+	pm   *peerMeter
+
+	sent, received, writes metrics.Counter
+	inFlight               metrics.Gauge
+
+	pending int64 // bytes passed to Write which didn't return yet
+}
+
+func (mc *meteredConn) Read(b []byte) (int, error) {
+	n, err := mc.Conn.Read(b)
+	if n > 0 {
+		mc.received.Add(float64(n))
+	}
+	return n, err
+}
+
+func (mc *meteredConn) Write(b []byte) (int, error) {
+	mc.writes.Add(1)
+	mc.inFlight.Set(float64(atomic.AddInt64(&mc.pending, int64(len(b)))))
+
+	var stalled *time.Timer
+	if mc.pm.threshold > 0 {
+		start := time.Now()
+		stalled = time.AfterFunc(mc.pm.threshold, func() {
+			mc.pm.slow.Add(1)
+			if mc.pm.onSlow != nil {
+				mc.pm.onSlow(mc.peer, time.Since(start))
+			}
+		})
+	}
+
+	n, err := mc.Conn.Write(b)
+
+	if stalled != nil {
+		stalled.Stop()
+	}
+	mc.inFlight.Set(float64(atomic.AddInt64(&mc.pending, -int64(len(b)))))
+	if n > 0 {
+		mc.sent.Add(float64(n))
+	}
+	return n, err
+}
@@ -0,0 +1,100 @@
+// SPDX-FileCopyrightText: 2021 The Go-SSB Authors
+//
+// SPDX-License-Identifier: MIT
+
+package network
+
+import (
+	"bytes"
+	"expvar"
+	"io"
+	"io/ioutil"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	refs "github.com/ssbc/go-ssb-refs"
+	ssbmetrics "github.com/ssbc/go-ssb/metrics"
+)
+
+func TestPeerMeterSlowPeer(t *testing.T) {
+	r := require.New(t)
+
+	// the expvar maps are global, start from zero when the test is run again
+	for _, name := range []string{ssbmetrics.PeerBytesSent, ssbmetrics.PeerBytesInFlight, ssbmetrics.SlowPeers} {
+		if m, ok := expvar.Get("peermeter." + name).(*expvar.Map); ok {
+			m.Init()
+		}
+	}
+
+	var (
+		mu      sync.Mutex
+		slow    []refs.FeedRef
+		blocked time.Duration
+	)
+	pm := newPeerMeter(ssbmetrics.NewExpvar("peermeter"), 50*time.Millisecond, func(peer refs.FeedRef, b time.Duration) {
+		mu.Lock()
+		blocked = b
+		slow = append(slow, peer)
+		mu.Unlock()
+	})
+	slowPeers := func() []refs.FeedRef {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]refs.FeedRef(nil), slow...)
+	}
+
+	fast, err := refs.NewFeedRefFromBytes(bytes.Repeat([]byte{1}, 32), refs.RefAlgoFeedSSB1)
+	r.NoError(err)
+	lazy, err := refs.NewFeedRefFromBytes(bytes.Repeat([]byte{2}, 32), refs.RefAlgoFeedSSB1)
+	r.NoError(err)
+
+	// net.Pipe has no buffer, so a write blocks until the other side reads it
+	payload := bytes.Repeat([]byte("x"), 1024)
+
+	fastConn, fastRemote := net.Pipe()
+	go io.Copy(ioutil.Discard, fastRemote)
+	fc := pm.wrap(fastConn, fast)
+	for i := 0; i < 100; i++ {
+		_, err := fc.Write(payload)
+		r.NoError(err)
+	}
+	fastConn.Close()
+	r.Empty(slowPeers(), "fast peer was reported")
+
+	lazyConn, lazyRemote := net.Pipe()
+	lc := pm.wrap(lazyConn, lazy)
+	written := make(chan error)
+	go func() {
+		_, err := lc.Write(payload)
+		written <- err
+	}()
+	r.Eventually(func() bool { return len(slowPeers()) == 1 }, time.Second, 10*time.Millisecond)
+	r.True(slowPeers()[0].Equal(lazy))
+	mu.Lock()
+	r.True(blocked >= 50*time.Millisecond, "blocked for %s", blocked)
+	mu.Unlock()
+
+	inFlight, ok := expvar.Get("peermeter." + ssbmetrics.PeerBytesInFlight).(*expvar.Map)
+	r.True(ok)
+	r.Equal("1024", inFlight.Get("peer="+lazy.ShortSigil()).String())
+
+	// the peer catches up
+	go io.Copy(ioutil.Discard, lazyRemote)
+	r.NoError(<-written)
+	r.Equal("0", inFlight.Get("peer="+lazy.ShortSigil()).String())
+	lazyConn.Close()
+	r.Len(slowPeers(), 1, "only reported once per write")
+
+	sent, ok := expvar.Get("peermeter." + ssbmetrics.PeerBytesSent).(*expvar.Map)
+	r.True(ok)
+	r.Equal("102400", sent.Get("peer="+fast.ShortSigil()).String())
+	r.Equal("1024", sent.Get("peer="+lazy.ShortSigil()).String())
+
+	slowCount, ok := expvar.Get("peermeter." + ssbmetrics.SlowPeers).(*expvar.Map)
+	r.True(ok)
+	r.Equal("1", slowCount.Get("").String())
+}
@@ -23,6 +23,15 @@ type Plugin interface {
 	Handler() muxrpc.Handler
 }
 
+// ManifestPlugin can be implemented by a Plugin to add its calls to the muxrpc manifest of the bot,
+// which clients check before they make a call.
+// Manifest maps the full method names, like "blobs.get", to their call type ("async", "source", "sink" or "duplex").
+type ManifestPlugin interface {
+	Plugin
+
+	Manifest() map[string]string
+}
+
 type PluginManager interface {
 	Register(Plugin)
 	MakeHandler(conn net.Conn) (muxrpc.Handler, error)
@@ -0,0 +1,201 @@
+// SPDX-FileCopyrightText: 2021 The Go-SSB Authors
+//
+// SPDX-License-Identifier: MIT
+
+// Package admin supplies maintenance calls for operators of a bot: admin.reindex, admin.gcBlobs and admin.fsck.
+// They are sources, which stream the progress of the operation back to the caller.
+//
+// Only the feed of the bot itself and the configured admins can call them, so the plugin can be mounted for public connections as well.
+package admin
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/ssbc/go-muxrpc/v2"
+	"github.com/ssbc/go-muxrpc/v2/typemux"
+	"go.mindeco.de/log/level"
+	"go.mindeco.de/logging"
+
+	"github.com/ssbc/go-ssb"
+	refs "github.com/ssbc/go-ssb-refs"
+)
+
+// ErrNotAdmin is returned to callers which are neither the bot itself nor one of its admins.
+var ErrNotAdmin = errors.New("admin: not allowed")
+
+// ProgressFunc is called by a Maintainer while an operation runs, with how much of it is done out of total.
+type ProgressFunc func(done, total int64)
+
+// Maintainer runs the operations of the admin calls.
+type Maintainer interface {
+	// Reindex applies all the messages to the index name again.
+	Reindex(ctx context.Context, name string, progress ProgressFunc) error
+
+	// GCBlobs deletes blobs which aren't needed anymore and returns how many it deleted.
+	GCBlobs(ctx context.Context, progress ProgressFunc) (int, error)
+
+	// FSCK checks the consistency of the stored messages. full selects the slower, complete check.
+	// Problems it found are returned as a list, an error means the check couldn't be done.
+	FSCK(ctx context.Context, full bool, progress ProgressFunc) ([]string, error)
+}
+
+// Progress is streamed to the caller of the admin calls.
+// The last one of a call has Finished set and the result of the operation, if it has one.
+type Progress struct {
+	Done  int64 `json:"done"`
+	Total int64 `json:"total"`
+
+	Finished bool        `json:"finished,omitempty"`
+	Result   interface{} `json:"result,omitempty"`
+}
+
+var (
+	_      ssb.Plugin = plugin{} // compile-time type check
+	method            = muxrpc.Method{"admin"}
+)
+
+// New returns the admin plugin. The calls are run by m and only allowed for self and admins.
+func New(log logging.Interface, self refs.FeedRef, m Maintainer, admins []refs.FeedRef) ssb.Plugin {
+	allowed := ssb.NewFeedSet(len(admins) + 1)
+	allowed.AddRef(self)
+	for _, a := range admins {
+		allowed.AddRef(a)
+	}
+
+	rootHdlr := typemux.New(log)
+
+	rootHdlr.RegisterSource(muxrpc.Method{"admin", "reindex"}, opHandler{
+		log:     log,
+		allowed: allowed,
+		run: func(ctx context.Context, args json.RawMessage, progress ProgressFunc) (interface{}, error) {
+			var a struct {
+				Index string `json:"index"`
+			}
+			if err := json.Unmarshal(args, &a); err != nil || a.Index == "" {
+				return nil, fmt.Errorf("admin.reindex: expected an object with the name of the index")
+			}
+			return nil, m.Reindex(ctx, a.Index, progress)
+		},
+	})
+
+	rootHdlr.RegisterSource(muxrpc.Method{"admin", "gcBlobs"}, opHandler{
+		log:     log,
+		allowed: allowed,
+		run: func(ctx context.Context, _ json.RawMessage, progress ProgressFunc) (interface{}, error) {
+			removed, err := m.GCBlobs(ctx, progress)
+			if err != nil {
+				return nil, err
+			}
+			return map[string]int{"removed": removed}, nil
+		},
+	})
+
+	rootHdlr.RegisterSource(muxrpc.Method{"admin", "fsck"}, opHandler{
+		log:     log,
+		allowed: allowed,
+		run: func(ctx context.Context, args json.RawMessage, progress ProgressFunc) (interface{}, error) {
+			var a struct {
+				Full bool `json:"full"`
+			}
+			if args != nil {
+				if err := json.Unmarshal(args, &a); err != nil {
+					return nil, fmt.Errorf("admin.fsck: invalid arguments: %w", err)
+				}
+			}
+			problems, err := m.FSCK(ctx, a.Full, progress)
+			if err != nil {
+				return nil, err
+			}
+			if problems == nil {
+				problems = []string{}
+			}
+			return map[string][]string{"problems": problems}, nil
+		},
+	})
+
+	return plugin{
+		h: &rootHdlr,
+	}
+}
+
+type plugin struct {
+	h muxrpc.Handler
+}
+
+func (plugin) Name() string { return "admin" }
+
+func (plugin) Method() muxrpc.Method {
+	return method
+}
+
+func (p plugin) Handler() muxrpc.Handler {
+	return p.h
+}
+
+// opHandler checks that the caller is allowed, runs the operation and streams its progress
+type opHandler struct {
+	log     logging.Interface
+	allowed *ssb.StrFeedSet
+
+	run func(ctx context.Context, args json.RawMessage, progress ProgressFunc) (interface{}, error)
+}
+
+func (h opHandler) HandleSource(ctx context.Context, req *muxrpc.Request, snk *muxrpc.ByteSink) error {
+	remote, err := ssb.GetFeedRefFromAddr(req.RemoteAddr())
+	if err != nil || !h.allowed.Has(remote) {
+		return ErrNotAdmin
+	}
+
+	var args []json.RawMessage
+	if err := json.Unmarshal(req.RawArgs, &args); err != nil {
+		return fmt.Errorf("%s: invalid arguments: %w", req.Method, err)
+	}
+	var arg json.RawMessage
+	if len(args) > 0 {
+		arg = args[0]
+	}
+
+	level.Info(h.log).Log("event", "admin call", "method", req.Method.String(), "caller", remote.ShortSigil())
+
+	snk.SetEncoding(muxrpc.TypeJSON)
+	enc := json.NewEncoder(snk)
+
+	// the operations call progress from their own goroutines
+	var (
+		mu       sync.Mutex
+		last     Progress
+		sendErr  error
+		finished bool
+	)
+	progress := func(done, total int64) {
+		mu.Lock()
+		defer mu.Unlock()
+		if sendErr != nil || finished {
+			return
+		}
+		last = Progress{Done: done, Total: total}
+		sendErr = enc.Encode(last)
+	}
+
+	result, err := h.run(ctx, arg, progress)
+	if err != nil {
+		return fmt.Errorf("%s failed: %w", req.Method, err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	finished = true
+	if sendErr != nil {
+		return fmt.Errorf("%s: failed to send progress: %w", req.Method, sendErr)
+	}
+	last.Finished = true
+	last.Result = result
+	if err := enc.Encode(last); err != nil {
+		return fmt.Errorf("%s: failed to send result: %w", req.Method, err)
+	}
+	return snk.Close()
+}
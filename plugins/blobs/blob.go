@@ -18,6 +18,8 @@ import (
 
 	"github.com/ssbc/go-ssb"
 	refs "github.com/ssbc/go-ssb-refs"
+	"github.com/ssbc/go-ssb/blobstore"
+	"github.com/ssbc/go-ssb/metrics"
 )
 
 /*
@@ -48,7 +50,52 @@ func checkAndLog(log logging.Interface, err error) {
 	}
 }
 
-func New(log logging.Interface, self refs.FeedRef, bs ssb.BlobStore, wm ssb.WantManager) ssb.Plugin {
+// Option changes the defaults of the plugin created with New.
+type Option func(*options)
+
+type options struct {
+	metrics metrics.Collector
+
+	maxServeSize uint
+	serveRate    int
+}
+
+// WithMetrics reports the blobs which are sent to peers as metrics.BlobsServed.
+func WithMetrics(c metrics.Collector) Option {
+	return func(o *options) {
+		o.metrics = c
+	}
+}
+
+// WithMaxServeSize sets the biggest blob that is sent to peers. By default that is blobstore.DefaultMaxSize, zero means there is no limit.
+// The want manager shouldn't offer bigger ones, see blobstore.WantWithMaxSize.
+func WithMaxServeSize(sz uint) Option {
+	return func(o *options) {
+		o.maxServeSize = sz
+	}
+}
+
+// WithServeRate limits how many bytes per second are sent to all the peers together. By default it is not limited.
+func WithServeRate(bytesPerSecond int) Option {
+	return func(o *options) {
+		o.serveRate = bytesPerSecond
+	}
+}
+
+func New(log logging.Interface, self refs.FeedRef, bs ssb.BlobStore, wm ssb.WantManager, opts ...Option) ssb.Plugin {
+	o := options{
+		metrics:      metrics.Discard(),
+		maxServeSize: blobstore.DefaultMaxSize,
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	var limit *byteLimiter
+	if o.serveRate > 0 {
+		limit = newByteLimiter(o.serveRate)
+	}
+
 	mux := typemux.New(log)
 
 	mux.RegisterSink(muxrpc.Method{"blobs", "add"}, addHandler{
@@ -66,8 +113,11 @@ func New(log logging.Interface, self refs.FeedRef, bs ssb.BlobStore, wm ssb.Want
 	// })
 
 	mux.RegisterSource(muxrpc.Method{"blobs", "get"}, getHandler{
-		log: log,
-		bs:  bs,
+		log:     log,
+		bs:      bs,
+		served:  o.metrics.Counter(metrics.BlobsServed),
+		maxSize: o.maxServeSize,
+		limit:   limit,
 	})
 
 	mux.RegisterAsync(muxrpc.Method{"blobs", "has"}, hasHandler{
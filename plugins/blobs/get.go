@@ -11,6 +11,7 @@ import (
 	"fmt"
 	"io"
 
+	kitmetrics "github.com/go-kit/kit/metrics"
 	"github.com/ssbc/go-muxrpc/v2"
 	"github.com/ssbc/go-ssb/blobstore"
 	"go.mindeco.de/log"
@@ -23,6 +24,13 @@ import (
 type getHandler struct {
 	bs  ssb.BlobStore
 	log logging.Interface
+
+	served kitmetrics.Counter
+
+	// maxSize is the biggest blob we send, if it is set
+	maxSize uint
+	// limit throttles sending, if it is set
+	limit *byteLimiter
 }
 
 func (getHandler) HandleConnect(context.Context, muxrpc.Endpoint) {}
@@ -66,6 +74,10 @@ func (h getHandler) HandleSource(ctx context.Context, req *muxrpc.Request, snk *
 		return errors.New("blob larger than you wanted")
 	}
 
+	if h.maxSize > 0 && uint(sz) > h.maxSize {
+		return errors.New("blob larger than we serve")
+	}
+
 	logger = log.With(logger, "blob", wantedRef.ShortSigil())
 
 	r, err := h.bs.Get(wantedRef)
@@ -75,7 +87,11 @@ func (h getHandler) HandleSource(ctx context.Context, req *muxrpc.Request, snk *
 
 	w := muxrpc.NewSinkWriter(snk)
 
-	_, err = io.Copy(w, r)
+	var out io.Writer = w
+	if h.limit != nil {
+		out = throttledWriter{ctx: ctx, w: w, l: h.limit}
+	}
+	_, err = io.Copy(out, r)
 	if err != nil {
 		return fmt.Errorf("error sending blob: %w", err)
 	}
@@ -84,6 +100,7 @@ func (h getHandler) HandleSource(ctx context.Context, req *muxrpc.Request, snk *
 	if err != nil {
 		return fmt.Errorf("error closing blob output: %w", err)
 	}
+	h.served.Add(1)
 	// if err == nil {
 	// 	info.Log("event", "transmission successfull", "took", time.Since(start))
 	// }
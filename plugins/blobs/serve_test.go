@@ -0,0 +1,133 @@
+// SPDX-FileCopyrightText: 2021 The Go-SSB Authors
+//
+// SPDX-License-Identifier: MIT
+
+package blobs
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ssbc/go-muxrpc/v2"
+	refs "github.com/ssbc/go-ssb-refs"
+	"github.com/stretchr/testify/require"
+	kitlog "go.mindeco.de/log"
+
+	"github.com/ssbc/go-ssb"
+	"github.com/ssbc/go-ssb/blobstore"
+	"github.com/ssbc/go-ssb/internal/broadcasts"
+	"github.com/ssbc/go-ssb/internal/testutils"
+	"github.com/ssbc/go-ssb/plugins/test"
+	"github.com/ssbc/go-ssb/repo"
+)
+
+func TestServeLimits(t *testing.T) {
+	r := require.New(t)
+	ctx, cancel := context.WithCancel(context.TODO())
+	defer cancel()
+
+	srcRepo, srcPath := test.MakeEmptyPeer(t)
+	dstRepo, dstPath := test.MakeEmptyPeer(t)
+	defer os.RemoveAll(srcPath)
+	defer os.RemoveAll(dstPath)
+
+	srcKP, err := repo.DefaultKeyPair(srcRepo, refs.RefAlgoFeedSSB1)
+	r.NoError(err)
+	dstKP, err := repo.DefaultKeyPair(dstRepo, refs.RefAlgoFeedSSB1)
+	r.NoError(err)
+
+	logger := testutils.NewRelativeTimeLogger(nil)
+
+	// src only offers blobs up to 1000 bytes and sends 500 bytes per second
+	const maxSize, rate = 1000, 500
+	srcBS, err := repo.OpenBlobStore(srcRepo)
+	r.NoError(err)
+	srcLog := kitlog.With(logger, "node", "src")
+	srcWM := blobstore.NewWantManager(srcBS, blobstore.WantWithLogger(srcLog), blobstore.WantWithMaxSize(maxSize))
+	srcPlug := New(srcLog, srcKP.ID(), srcBS, srcWM, WithMaxServeSize(maxSize), WithServeRate(rate))
+
+	dstBS, err := repo.OpenBlobStore(dstRepo)
+	r.NoError(err)
+	dstLog := kitlog.With(logger, "node", "dst")
+	dstWM := blobstore.NewWantManager(dstBS, blobstore.WantWithLogger(dstLog))
+	dstPlug := New(dstLog, dstKP.ID(), dstBS, dstWM)
+
+	small := bytes.Repeat([]byte("a"), maxSize)
+	big := bytes.Repeat([]byte("b"), 2*maxSize)
+	smallRef, err := srcBS.Put(bytes.NewReader(small))
+	r.NoError(err)
+	bigRef, err := srcBS.Put(bytes.NewReader(big))
+	r.NoError(err)
+
+	received := make(chan refs.BlobRef, 2)
+	dstBS.Register(broadcasts.BlobStoreFuncEmitter(func(n ssb.BlobStoreNotification) error {
+		if n.Op == ssb.BlobStoreOpPut {
+			received <- n.Ref
+		}
+		return nil
+	}))
+
+	r.NoError(dstWM.Want(smallRef))
+	r.NoError(dstWM.Want(bigRef))
+
+	pkr1, pkr2, _ := test.PrepareConnectAndServe(t, srcRepo, dstRepo)
+	manifest := json.RawMessage(`{"blobs": {"get": "source", "createWants": "source"}}`)
+	// Handle calls createWants on the other side, so both need to be set up at the same time
+	var (
+		srcEdp, dstEdp muxrpc.Endpoint
+		inited         sync.WaitGroup
+	)
+	inited.Add(2)
+	go func() {
+		srcEdp = muxrpc.Handle(pkr1, testManifestWrapper{root: srcPlug.Handler(), manifest: manifest})
+		inited.Done()
+		srcEdp.(muxrpc.Server).Serve()
+	}()
+	go func() {
+		dstEdp = muxrpc.Handle(pkr2, testManifestWrapper{root: dstPlug.Handler(), manifest: manifest})
+		inited.Done()
+		dstEdp.(muxrpc.Server).Serve()
+	}()
+	inited.Wait()
+
+	start := time.Now()
+	select {
+	case ref := <-received:
+		r.True(ref.Equal(smallRef), "got %s", ref.ShortSigil())
+	case <-time.After(10 * time.Second):
+		r.FailNow("the small blob wasn't sent")
+	}
+	// the first 500 bytes are in the bucket already
+	r.True(time.Since(start) > 800*time.Millisecond, "sending wasn't throttled: %s", time.Since(start))
+
+	// the blob store checked the hash while storing it
+	rd, err := dstBS.Get(smallRef)
+	r.NoError(err)
+	got, err := ioutil.ReadAll(rd)
+	r.NoError(err)
+	r.Equal(small, got)
+
+	// the big one isn't offered
+	select {
+	case ref := <-received:
+		r.FailNow("received another blob", ref.ShortSigil())
+	case <-time.After(time.Second):
+	}
+	r.True(dstWM.Wants(bigRef))
+
+	// and not sent if it is asked for directly
+	src, err := dstEdp.Source(ctx, 0, muxrpc.Method{"blobs", "get"}, blobstore.GetWithSize{Key: bigRef, Max: 10 * maxSize})
+	r.NoError(err)
+	_, err = ioutil.ReadAll(muxrpc.NewSourceReader(src))
+	r.Error(err)
+
+	// terminating waits for the open createWants streams, closing the connection doesn't
+	r.NoError(pkr1.Close())
+	r.NoError(pkr2.Close())
+}
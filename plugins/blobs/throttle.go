@@ -0,0 +1,87 @@
+// SPDX-FileCopyrightText: 2021 The Go-SSB Authors
+//
+// SPDX-License-Identifier: MIT
+
+package blobs
+
+import (
+	"context"
+	"io"
+	"sync"
+	"time"
+)
+
+// byteLimiter is a token bucket for the bytes of the blobs we send, shared by all connections.
+// It holds at most one second worth of bytes.
+type byteLimiter struct {
+	mu        sync.Mutex
+	perSecond int
+	tokens    float64
+	last      time.Time
+}
+
+func newByteLimiter(perSecond int) *byteLimiter {
+	return &byteLimiter{
+		perSecond: perSecond,
+		tokens:    float64(perSecond),
+		last:      time.Now(),
+	}
+}
+
+// wait takes n bytes from the bucket and blocks until they were available.
+func (l *byteLimiter) wait(ctx context.Context, n int) error {
+	l.mu.Lock()
+	now := time.Now()
+	l.tokens += now.Sub(l.last).Seconds() * float64(l.perSecond)
+	if max := float64(l.perSecond); l.tokens > max {
+		l.tokens = max
+	}
+	l.last = now
+	l.tokens -= float64(n)
+	missing := -l.tokens
+	l.mu.Unlock()
+
+	if missing <= 0 {
+		return nil
+	}
+	t := time.NewTimer(time.Duration(missing / float64(l.perSecond) * float64(time.Second)))
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// throttledWriter writes to w in chunks, as fast as the limiter allows.
+type throttledWriter struct {
+	ctx context.Context
+	w   io.Writer
+	l   *byteLimiter
+}
+
+func (tw throttledWriter) Write(p []byte) (int, error) {
+	chunk := tw.l.perSecond / 10
+	if chunk < 1 {
+		chunk = 1
+	}
+
+	var written int
+	for len(p) > 0 {
+		n := chunk
+		if n > len(p) {
+			n = len(p)
+		}
+		if err := tw.l.wait(tw.ctx, n); err != nil {
+			return written, err
+		}
+		n, err := tw.w.Write(p[:n])
+		written += n
+		if err != nil {
+			return written, err
+		}
+		p = p[n:]
+	}
+	return written, nil
+}
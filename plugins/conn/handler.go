@@ -14,8 +14,6 @@ import (
 
 	"github.com/ssbc/go-muxrpc/v2"
 	"github.com/ssbc/go-muxrpc/v2/typemux"
-	"github.com/ssbc/go-netwrap"
-	"github.com/ssbc/go-secretstream"
 	"go.mindeco.de/log/level"
 	"go.mindeco.de/logging"
 
@@ -169,17 +167,20 @@ func (h *handler) connect(ctx context.Context, req *muxrpc.Request) (interface{}
 	}
 	dest := args[0]
 
-	msaddr, err := multiserver.ParseNetAddress([]byte(dest))
+	msaddr, err := ssb.ParseMultiserverAddress(dest)
 	if err != nil {
 		return nil, fmt.Errorf("ctrl.connect call: failed to parse input %q: %w", dest, err)
 	}
 
-	wrappedAddr := netwrap.WrapAddr(&msaddr.Addr, secretstream.Addr{PubKey: msaddr.Ref.PubKey()})
-	level.Info(h.info).Log("event", "connecting to peer", "remote", msaddr.Ref.ShortSigil())
+	wrappedAddr, err := msaddr.WrappedAddr()
+	if err != nil {
+		return nil, fmt.Errorf("ctrl.connect call: %w", err)
+	}
+	level.Info(h.info).Log("event", "connecting to peer", "remote", msaddr.PubKey.ShortSigil())
 	// TODO: add context to tracker to cancel connections
 	err = h.node.Connect(context.Background(), wrappedAddr)
 	if err != nil {
-		return nil, fmt.Errorf("ctrl.connect call: error connecting to %q: %w", msaddr.Addr, err)
+		return nil, fmt.Errorf("ctrl.connect call: error connecting to %q: %w", msaddr, err)
 	}
 	return reply{"connected"}, nil
 }
@@ -6,6 +6,7 @@ package gossip
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
@@ -25,7 +26,6 @@ import (
 	"github.com/ssbc/go-ssb"
 	refs "github.com/ssbc/go-ssb-refs"
 	"github.com/ssbc/go-ssb/internal/luigiutils"
-	"github.com/ssbc/go-ssb/internal/mutil"
 	"github.com/ssbc/go-ssb/internal/storedrefs"
 	"github.com/ssbc/go-ssb/internal/transform"
 	"github.com/ssbc/go-ssb/message"
@@ -117,6 +117,7 @@ func (m *FeedManager) addLiveFeed(
 	sink *muxrpc.ByteSink,
 	ssbID string,
 	seq, limit int64,
+	tipe string,
 ) error {
 	// TODO: ensure all messages make it to the live query
 	//  Messages could be lost when written after the non-live portion and
@@ -139,7 +140,20 @@ func (m *FeedManager) addLiveFeed(
 		until = math.MaxInt64
 	}
 
-	liveFeed.Register(ctx, sink, until)
+	if tipe == "" {
+		liveFeed.Register(ctx, sink, until)
+	} else {
+		liveFeed.RegisterWithFilter(ctx, sink, until, func(value []byte) bool {
+			var msg struct {
+				Content json.RawMessage `json:"content"`
+			}
+			if err := json.Unmarshal(value, &msg); err != nil {
+				return false
+			}
+			t, ok := ssb.ContentType(msg.Content)
+			return ok && t == tipe
+		})
+	}
 
 	m.liveFeeds[ssbID] = liveFeed
 	// TODO: Remove multiSink from map when complete
@@ -196,8 +210,17 @@ func (m *FeedManager) CreateStreamHistory(
 
 	latest := int64(userLog.Seq())
 
+	// our idx is 0 ed and starts at the origin of sliced feeds
+	origin := int64(1)
 	if arg.Seq != 0 {
-		arg.Seq--             // our idx is 0 ed
+		origin, err = message.FeedOrigin(m.ReceiveLog, userLog)
+		if err != nil {
+			return err
+		}
+		arg.Seq -= origin
+		if arg.Seq < 0 { // older than we got
+			arg.Seq = 0
+		}
 		if arg.Seq > latest { // more than we got
 			if arg.Live {
 				return m.addLiveFeed(
@@ -205,6 +228,7 @@ func (m *FeedManager) CreateStreamHistory(
 					arg.ID.String(),
 					latest,
 					liveLimit(arg, latest),
+					arg.Type,
 				)
 			}
 			err = sink.Close()
@@ -218,29 +242,27 @@ func (m *FeedManager) CreateStreamHistory(
 		arg.Limit = -1
 	}
 
-	// Make query
-	limit := nonliveLimit(arg, latest)
-	qryArgs := []margaret.QuerySpec{
-		margaret.Limit(int(limit)),
-		margaret.Reverse(arg.Reverse),
-	}
-
-	if arg.Seq > 0 {
-		qryArgs = append(qryArgs, margaret.Gte(arg.Seq))
+	// Make query, the limit was already applied to the sequences and the type only skips messages
+	qry := ssb.NewFeedQuery().
+		Feed(arg.ID).
+		Origin(origin).
+		Gte(origin + arg.Seq).
+		Limit(int(nonliveLimit(arg, latest))).
+		Type(arg.Type)
+	if arg.Reverse {
+		qry = qry.Reverse()
 	}
-
+	// lt and gt are offsets in the stored part of the feed
 	if arg.Lt > 0 {
-		qryArgs = append(qryArgs, margaret.Lt(int64(arg.Lt)))
+		qry = qry.Lt(origin + int64(arg.Lt))
 	}
-
 	if arg.Gt > 0 {
-		qryArgs = append(qryArgs, margaret.Gt(int64(arg.Gt)))
+		qry = qry.Gt(origin + int64(arg.Gt))
 	}
 
-	resolved := mutil.Indirect(m.ReceiveLog, userLog)
-	src, err := resolved.Query(qryArgs...)
+	src, err := qry.Query(m.ReceiveLog, m.UserFeeds)
 	if err != nil {
-		return fmt.Errorf("invalid user log query: %w", err)
+		return err
 	}
 
 	var luigiSink luigi.Sink
@@ -295,6 +317,7 @@ func (m *FeedManager) CreateStreamHistory(
 			arg.ID.String(),
 			latest,
 			liveLimit(arg, latest),
+			arg.Type,
 		)
 	}
 	closeErr := sink.Close()
@@ -7,6 +7,7 @@ package gossip
 import (
 	"bytes"
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
@@ -29,6 +30,7 @@ import (
 	"github.com/ssbc/go-ssb/internal/storedrefs"
 	"github.com/ssbc/go-ssb/internal/testutils"
 	"github.com/ssbc/go-ssb/message"
+	"github.com/ssbc/go-ssb/message/legacy"
 	"github.com/ssbc/go-ssb/multilogs"
 	"github.com/ssbc/go-ssb/repo"
 )
@@ -197,3 +199,182 @@ func readAllPackets(r io.Reader) []*codec.Packet {
 	}
 	return pkts
 }
+
+func TestCreateHistoryStreamType(t *testing.T) {
+	r := require.New(t)
+
+	ctx, cancel := ctxutils.WithError(context.Background(), ssb.ErrShuttingDown)
+	defer cancel()
+
+	repoPath := filepath.Join("testrun", t.Name())
+	os.RemoveAll(repoPath)
+	testRepo := repo.New(repoPath)
+
+	keyPair, err := repo.DefaultKeyPair(testRepo, refs.RefAlgoFeedSSB1)
+	r.NoError(err)
+	rootLog, err := repo.OpenLog(testRepo)
+	r.NoError(err)
+	userFeeds, refresh, err := repo.OpenStandaloneMultiLog(testRepo, "userFeeds", multilogs.UserFeedsUpdate)
+	r.NoError(err)
+	defer userFeeds.Close()
+	pub, err := message.OpenPublishLog(rootLog, userFeeds, keyPair)
+	r.NoError(err)
+
+	// 3 posts between other types and private messages
+	for _, content := range []interface{}{
+		refs.NewPost("one"),
+		refs.NewContactFollow(keyPair.ID()),
+		refs.NewPost("two"),
+		"c2VjcmV0.box",
+		map[string]interface{}{"type": "vote"},
+		refs.NewPost("three"),
+	} {
+		_, err := pub.Publish(content)
+		r.NoError(err)
+	}
+	r.NoError(<-asynctesting.ServeLog(ctx, "helper", rootLog, refresh, false))
+
+	fm := NewFeedManager(ctx, rootLog, userFeeds, log.NewNopLogger(), nil, nil)
+
+	histType := func(args message.CreateHistArgs) []string {
+		args.ID = keyPair.ID()
+		var buf = new(bytes.Buffer)
+		r.NoError(fm.CreateStreamHistory(ctx, muxrpc.NewTestSink(buf), args))
+
+		var texts []string
+		pkts := readAllPackets(buf)
+		for _, pkt := range pkts[:len(pkts)-1] { // the last one is the end of the stream
+			var msg struct {
+				Content struct {
+					Type string
+					Text string
+				}
+			}
+			r.NoError(json.Unmarshal(pkt.Body, &msg))
+			r.Equal("post", msg.Content.Type)
+			texts = append(texts, msg.Content.Text)
+		}
+		return texts
+	}
+
+	all := message.NewCreateHistoryStreamArgs()
+	all.Type = "post"
+	r.Equal([]string{"one", "two", "three"}, histType(all))
+
+	later := message.NewCreateHistoryStreamArgs()
+	later.Type = "post"
+	later.Seq = 2
+	r.Equal([]string{"two", "three"}, histType(later))
+
+	// the limit counts the messages of the feed
+	limited := message.NewCreateHistoryStreamArgs()
+	limited.Type = "post"
+	limited.Limit = 2
+	r.Equal([]string{"one"}, histType(limited))
+}
+
+func TestCreateHistoryStreamSliced(t *testing.T) {
+	r := require.New(t)
+
+	ctx, cancel := ctxutils.WithError(context.Background(), ssb.ErrShuttingDown)
+	defer cancel()
+
+	repoPath := filepath.Join("testrun", t.Name())
+	os.RemoveAll(repoPath)
+	testRepo := repo.New(repoPath)
+
+	rootLog, err := repo.OpenLog(testRepo)
+	r.NoError(err)
+	userFeeds, refresh, err := repo.OpenStandaloneMultiLog(testRepo, "userFeeds", multilogs.UserFeedsUpdate)
+	r.NoError(err)
+	defer userFeeds.Close()
+
+	// a feed of 65 messages, of which only the ones from 50 on are stored
+	kp, err := ssb.NewKeyPair(nil, refs.RefAlgoFeedSSB1)
+	r.NoError(err)
+	var (
+		msgs [][]byte
+		prev *refs.MessageRef
+	)
+	for seq := int64(1); seq <= 65; seq++ {
+		ref, signed, err := legacy.LegacyMessage{
+			Previous:  prev,
+			Author:    kp.ID().String(),
+			Sequence:  seq,
+			Timestamp: seq,
+			Hash:      "sha256",
+			Content:   refs.NewPost(fmt.Sprintf("post %d", seq)),
+		}.Sign(kp.Secret(), nil)
+		r.NoError(err)
+		msgs = append(msgs, signed)
+		prev = &ref
+	}
+
+	vr, err := message.NewVerificationRouter(rootLog, userFeeds, nil)
+	r.NoError(err)
+	snk, err := vr.GetSink(kp.ID(), false)
+	r.NoError(err)
+	for _, msg := range msgs[49:60] {
+		r.NoError(snk.Verify(msg))
+	}
+	r.EqualValues(60, snk.Seq())
+
+	// messages after the anchor are still checked
+	_, forged, err := legacy.LegacyMessage{
+		Previous:  prev,
+		Author:    kp.ID().String(),
+		Sequence:  61,
+		Timestamp: 61,
+		Hash:      "sha256",
+		Content:   refs.NewPost("forged"),
+	}.Sign(kp.Secret(), nil)
+	r.NoError(err)
+	r.Error(snk.Verify(forged))
+	r.NoError(<-asynctesting.ServeLog(ctx, "helper", rootLog, refresh, false))
+
+	userLog, err := userFeeds.Get(storedrefs.Feed(kp.ID()))
+	r.NoError(err)
+	r.EqualValues(10, userLog.Seq())
+	origin, err := message.FeedOrigin(rootLog, userLog)
+	r.NoError(err)
+	r.EqualValues(50, origin)
+
+	// further appends work with a new sink, which starts from the stored messages
+	vr.CloseSink(kp.ID())
+	snk, err = vr.GetSink(kp.ID(), true)
+	r.NoError(err)
+	r.EqualValues(60, snk.Seq())
+	for _, msg := range msgs[60:] {
+		r.NoError(snk.Verify(msg))
+	}
+	r.NoError(<-asynctesting.ServeLog(ctx, "helper", rootLog, refresh, false))
+	r.EqualValues(15, userLog.Seq())
+
+	fm := NewFeedManager(ctx, rootLog, userFeeds, log.NewNopLogger(), nil, nil)
+	histSeqs := func(seq int64) []int64 {
+		args := message.NewCreateHistoryStreamArgs()
+		args.ID = kp.ID()
+		args.Seq = seq
+		var buf = new(bytes.Buffer)
+		r.NoError(fm.CreateStreamHistory(ctx, muxrpc.NewTestSink(buf), args))
+
+		var seqs []int64
+		pkts := readAllPackets(buf)
+		for _, pkt := range pkts[:len(pkts)-1] { // the last one is the end of the stream
+			var msg struct {
+				Sequence int64
+			}
+			r.NoError(json.Unmarshal(pkt.Body, &msg))
+			seqs = append(seqs, msg.Sequence)
+		}
+		return seqs
+	}
+
+	r.Equal([]int64{62, 63, 64, 65}, histSeqs(62))
+	all := histSeqs(0)
+	r.Len(all, 16)
+	r.EqualValues(50, all[0])
+	// asking for older messages gives the stored ones
+	r.Equal(all, histSeqs(10))
+	r.Empty(histSeqs(66))
+}
@@ -20,6 +20,7 @@ import (
 
 	refs "github.com/ssbc/go-ssb-refs"
 	"github.com/ssbc/go-ssb/internal/neterr"
+	"github.com/ssbc/go-ssb/internal/storedrefs"
 	"github.com/ssbc/go-ssb/message"
 )
 
@@ -129,9 +130,16 @@ func (h *LegacyGossip) fetchFeed(
 	default:
 	}
 
-	// wether to fetch this feed in full (TODO: should be passed in)
+	// wether to fetch this feed in full or only its latest messages
 	completeFeed := true
-	var err error
+	sliceStart, err := h.sliceStart(ctx, fr, edp)
+	if err != nil {
+		return err
+	}
+	if sliceStart > 1 {
+		completeFeed = false
+	}
+
 	snk, err := h.verifyRouter.GetSink(fr, completeFeed)
 	if err != nil {
 		return fmt.Errorf("failed to get verify sink for feed: %w", err)
@@ -146,6 +154,10 @@ func (h *LegacyGossip) fetchFeed(
 	var q = message.NewCreateHistoryStreamArgs()
 	q.ID = fr
 	q.Seq = int64(latestSeq + 1)
+	if latestSeq == 0 && sliceStart > 1 {
+		q.Seq = sliceStart
+		level.Debug(info).Log("msg", "fetching slice", "from", sliceStart)
+	}
 	q.Live = withLive
 
 	defer func() {
@@ -204,6 +216,67 @@ func (h *LegacyGossip) fetchFeed(
 	return nil
 }
 
+// sliceStart returns the sequence from which fr should be fetched, if only a slice of it should be stored.
+// It is 0 if the feed should be fetched in full or some of it is stored already.
+// To find the start, it asks edp for the latest message of the feed.
+func (h *LegacyGossip) sliceStart(ctx context.Context, fr refs.FeedRef, edp muxrpc.Endpoint) (int64, error) {
+	if h.sliceLength == nil {
+		return 0, nil
+	}
+	n := h.sliceLength(fr)
+	if n <= 0 {
+		return 0, nil
+	}
+
+	userLog, err := h.UserFeeds.Get(storedrefs.Feed(fr))
+	if err != nil {
+		return 0, fmt.Errorf("fetchFeed(%s): failed to open sublog: %w", fr.ShortSigil(), err)
+	}
+	if userLog.Seq() >= 0 {
+		return 0, nil
+	}
+
+	var q = message.NewCreateHistoryStreamArgs()
+	q.ID = fr
+	q.Limit = 1
+	q.Reverse = true
+
+	method := muxrpc.Method{"createHistoryStream"}
+	var src *muxrpc.ByteSource
+	switch fr.Algo() {
+	case refs.RefAlgoFeedSSB1:
+		src, err = edp.Source(ctx, muxrpc.TypeJSON, method, q)
+	case refs.RefAlgoFeedBendyButt, refs.RefAlgoFeedGabby:
+		src, err = edp.Source(ctx, muxrpc.TypeBinary, method, q)
+	default:
+		return 0, fmt.Errorf("fetchFeed(%s): unhandled feed format", fr.String())
+	}
+	if err != nil {
+		return 0, fmt.Errorf("fetchFeed(%s): failed to ask for latest message: %w", fr.String(), err)
+	}
+
+	var latest int64
+	for src.Next(ctx) {
+		raw, err := src.Bytes()
+		if err != nil {
+			return 0, err
+		}
+		msg, err := message.VerifyMessage(fr, raw, h.hmacSec)
+		if err != nil {
+			return 0, fmt.Errorf("fetchFeed(%s): invalid latest message: %w", fr.String(), err)
+		}
+		latest = msg.Seq()
+	}
+	if err := src.Err(); err != nil {
+		return 0, fmt.Errorf("fetchFeed(%s): failed to get latest message: %w", fr.String(), err)
+	}
+
+	if latest <= n {
+		return 0, nil
+	}
+	return latest - n + 1, nil
+}
+
 type TokenPool struct {
 	ch chan struct{}
 }
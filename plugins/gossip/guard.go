@@ -0,0 +1,38 @@
+// SPDX-FileCopyrightText: 2021 The Go-SSB Authors
+//
+// SPDX-License-Identifier: MIT
+
+package gossip
+
+import (
+	refs "github.com/ssbc/go-ssb-refs"
+
+	"github.com/ssbc/go-ssb/graph"
+)
+
+// HopsGuard makes createHistoryStream only serve feeds which the remote would replicate itself,
+// that is feeds which are within MaxHops of the remote in the graph (see graph.Graph.ShouldReplicate).
+// This stops peers from pulling arbitrary feeds through a pub.
+//
+// The own feed is always served, as are all feeds to self and in promisc mode.
+type HopsGuard struct {
+	// Graph returns the current follow graph, like graph.Builder.Build.
+	Graph func() (*graph.Graph, error)
+
+	MaxHops int
+}
+
+// allows checks if remote may request feed, the reason is only set if it was decided by the graph
+func (hg HopsGuard) allows(self, remote, feed refs.FeedRef) (bool, graph.Reason, error) {
+	if feed.Equal(self) {
+		return true, graph.ReasonSelf, nil
+	}
+
+	g, err := hg.Graph()
+	if err != nil {
+		return false, graph.ReasonUnknown, err
+	}
+
+	ok, reason := g.ShouldReplicate(remote, feed, hg.MaxHops)
+	return ok, reason, nil
+}
@@ -0,0 +1,137 @@
+// SPDX-FileCopyrightText: 2021 The Go-SSB Authors
+//
+// SPDX-License-Identifier: MIT
+
+package gossip
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"path/filepath"
+	"testing"
+
+	"github.com/ssbc/go-muxrpc/v2"
+	"github.com/ssbc/go-netwrap"
+	"github.com/ssbc/go-secretstream"
+	"github.com/stretchr/testify/require"
+	"go.mindeco.de/log"
+
+	"github.com/ssbc/go-ssb"
+	refs "github.com/ssbc/go-ssb-refs"
+	"github.com/ssbc/go-ssb/graph"
+	"github.com/ssbc/go-ssb/internal/testutils"
+	"github.com/ssbc/go-ssb/message"
+)
+
+func TestHistoryStreamHopsGuard(t *testing.T) {
+	r := require.New(t)
+	ctx, cancel := context.WithCancel(context.TODO())
+	defer cancel()
+
+	logger := testutils.NewRelativeTimeLogger(nil)
+
+	// the repo of the pub, which has the feed of carol
+	create, rootLog, userFeeds, carol := loadTestRepo(t, filepath.Join("testrun", t.Name()))
+	defer userFeeds.Close()
+	create(t, 3, "carol")
+
+	pub := guardTestFeed(t, 1)
+	bob := guardTestFeed(t, 2)
+	dave := guardTestFeed(t, 3)
+
+	// bob follows carol, dave only follows bob
+	g, err := graph.UnmarshalJS([]byte(`{
+		"` + bob.Sigil() + `": {"` + carol.ID().Sigil() + `": 1},
+		"` + dave.Sigil() + `": {"` + bob.Sigil() + `": 1}
+	}`))
+	r.NoError(err)
+	guard := HopsGuard{
+		Graph:   func() (*graph.Graph, error) { return g, nil },
+		MaxHops: 0,
+	}
+
+	fm := NewFeedManager(ctx, rootLog, userFeeds, logger, nil, nil)
+
+	// requests carol's feed from the pub as requester and returns how many messages were sent
+	fetch := func(requester refs.FeedRef, opts ...interface{}) int {
+		hist := NewServer(ctx, log.With(logger, "requester", requester.ShortSigil()), pub, rootLog, userFeeds, emptyLister{}, fm, opts...)
+
+		connPub, connRequester := guardTestConn(t)
+		requesterAddr := netwrap.WrapAddr(connPub.RemoteAddr(), secretstream.Addr{PubKey: requester.PubKey()})
+
+		// both sides need to be set up at the same time since they ask each other for their manifest
+		pubReady := make(chan struct{})
+		go func() {
+			edp := muxrpc.Handle(muxrpc.NewPacker(connPub), hist.Handler(), muxrpc.WithRemoteAddr(requesterAddr))
+			close(pubReady)
+			edp.(muxrpc.Server).Serve()
+		}()
+		requesterEdp := muxrpc.Handle(muxrpc.NewPacker(connRequester), nopHandler{})
+		go requesterEdp.(muxrpc.Server).Serve()
+		<-pubReady
+		defer connPub.Close()
+		defer connRequester.Close()
+
+		args := message.NewCreateHistoryStreamArgs()
+		args.ID = carol.ID()
+		args.Limit = -1
+		src, err := requesterEdp.Source(ctx, muxrpc.TypeJSON, muxrpc.Method{"createHistoryStream"}, args)
+		r.NoError(err)
+
+		var n int
+		for src.Next(ctx) {
+			var msg json.RawMessage
+			r.NoError(src.Reader(func(rd io.Reader) error {
+				return json.NewDecoder(rd).Decode(&msg)
+			}))
+			n++
+		}
+		r.NoError(src.Err())
+		return n
+	}
+
+	r.Equal(3, fetch(bob, guard), "bob follows carol")
+	r.Equal(0, fetch(dave, guard), "carol is out of reach for dave")
+	r.Equal(3, fetch(dave), "no guard")
+}
+
+// guardTestConn returns both ends of a tcp connection over localhost
+func guardTestConn(t *testing.T) (net.Conn, net.Conn) {
+	lis, err := net.Listen("tcp", "localhost:0")
+	require.NoError(t, err)
+	defer lis.Close()
+
+	accepted := make(chan net.Conn, 1)
+	go func() {
+		c, err := lis.Accept()
+		if err != nil {
+			t.Error(err)
+		}
+		accepted <- c
+	}()
+
+	dialed, err := net.Dial("tcp", lis.Addr().String())
+	require.NoError(t, err)
+	return <-accepted, dialed
+}
+
+func guardTestFeed(t *testing.T, i byte) refs.FeedRef {
+	ref, err := refs.NewFeedRefFromBytes(bytes.Repeat([]byte{i}, 32), refs.RefAlgoFeedSSB1)
+	require.NoError(t, err)
+	return ref
+}
+
+type emptyLister struct{}
+
+func (emptyLister) Authorize(refs.FeedRef) error     { return nil }
+func (emptyLister) ReplicationList() *ssb.StrFeedSet { return ssb.NewFeedSet(0) }
+func (emptyLister) BlockList() *ssb.StrFeedSet       { return ssb.NewFeedSet(0) }
+
+type nopHandler struct{}
+
+func (nopHandler) Handled(muxrpc.Method) bool                        { return false }
+func (nopHandler) HandleConnect(context.Context, muxrpc.Endpoint)    {}
+func (nopHandler) HandleCall(_ context.Context, req *muxrpc.Request) { req.CloseWithError(nil) }
@@ -49,8 +49,12 @@ type LegacyGossip struct {
 
 	promisc bool // ask for remote feed even if it's not on owns fetch list
 
+	hopsGuard *HopsGuard
+
 	enableLiveStreaming bool
 
+	sliceLength SliceLength
+
 	activeLock  *sync.Mutex
 	activeFetch map[string]struct{}
 
@@ -202,6 +206,19 @@ func (g *LegacyGossip) HandleCall(
 				return
 			}
 
+			if g.hopsGuard != nil {
+				ok, reason, err := g.hopsGuard.allows(g.Id, remote, query.ID)
+				if err != nil {
+					closeIfErr(fmt.Errorf("failed to check hops: %w", err))
+					return
+				}
+				if !ok {
+					level.Debug(hlog).Log("msg", "feed out of reach for remote", "reason", reason)
+					req.Stream.Close()
+					return
+				}
+			}
+
 			// TODO: write proper tests for this
 			// // see if there is a path from the wanted feed
 			// l, err := tg.MakeDijkstra(query.ID)
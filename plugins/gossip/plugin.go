@@ -28,6 +28,10 @@ type Promisc bool
 
 type WithLive bool
 
+// SliceLength decides for a feed of which nothing is stored yet how many of its latest messages are fetched.
+// It returns 0 to fetch the whole feed. The older messages of a sliced feed are never fetched, see message.FeedOrigin.
+type SliceLength func(refs.FeedRef) int64
+
 type NumberOfConcurrentReplicationsPerPeer int
 type NumberOfConcurrentReplications int
 
@@ -79,8 +83,12 @@ func NewFetcher(
 			h.hmacSec = v
 		case Promisc:
 			h.promisc = bool(v)
+		case HopsGuard:
+			h.hopsGuard = &v
 		case WithLive:
 			h.enableLiveStreaming = bool(v)
+		case SliceLength:
+			h.sliceLength = v
 		case NumberOfConcurrentReplicationsPerPeer:
 			h.numberOfConcurrentReplicationsPerPeer = int(v)
 		case NumberOfConcurrentReplications:
@@ -127,10 +135,14 @@ func NewServer(
 			h.sysCtr = v
 		case Promisc:
 			h.promisc = bool(v)
+		case HopsGuard:
+			h.hopsGuard = &v
 		case HMACSecret:
 			h.hmacSec = v
 		case WithLive:
 			// no consequence - the outgoing live code is fine
+		case SliceLength:
+			// only used for fetching
 		case NumberOfConcurrentReplicationsPerPeer:
 			h.numberOfConcurrentReplicationsPerPeer = int(v)
 		case NumberOfConcurrentReplications:
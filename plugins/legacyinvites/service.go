@@ -6,7 +6,6 @@
 package legacyinvites
 
 import (
-	"bytes"
 	"crypto/rand"
 	"encoding/json"
 	"errors"
@@ -119,7 +118,7 @@ func (s *Service) Create(uses uint, note string) (*invite.Token, error) {
 		for {
 			rand.Read(inv.Seed[:])
 
-			inviteKeyPair, err := ssb.NewKeyPair(bytes.NewReader(inv.Seed[:]), refs.RefAlgoFeedSSB1)
+			inviteKeyPair, err := inv.KeyPair()
 			if err != nil {
 				return fmt.Errorf("invite/create: generate seeded keypair (%w)", err)
 			}
@@ -0,0 +1,131 @@
+// SPDX-FileCopyrightText: 2021 The Go-SSB Authors
+//
+// SPDX-License-Identifier: MIT
+
+package replicate
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/ssbc/go-muxrpc/v2"
+	refs "github.com/ssbc/go-ssb-refs"
+	"github.com/ssbc/margaret"
+	"github.com/ssbc/margaret/multilog"
+
+	"github.com/ssbc/go-ssb"
+)
+
+// MaxFeedStateSize is the most feeds getFeedState answers with. Larger frontiers need to be asked for with fewer hops.
+const MaxFeedStateSize = 50000
+
+// ErrFeedStateTooLarge is returned by getFeedState if the frontier has more than MaxFeedStateSize feeds.
+var ErrFeedStateTooLarge = errors.New("replicate: feed state has too many feeds, ask for fewer hops")
+
+var feedStateMethod = muxrpc.Method{"getFeedState"}
+
+// FeedStateArgs are the arguments of getFeedState.
+type FeedStateArgs struct {
+	// Hops only returns the feeds that many hops away from the answering peer, like in ssb.HopsLister (0 are its direct follows).
+	// It is capped at the hops the peer replicates. Without it, all of those are returned.
+	Hops *int `json:"hops,omitempty"`
+}
+
+// NewFeedStatePlug returns the plugin for getFeedState, which answers with the frontier of self:
+// the latest stored sequence (see ssb.Frontier) of self and of the stored feeds within maxHops of it.
+// The messages of the sublogs of users are looked up in rxlog.
+func NewFeedStatePlug(rxlog margaret.Log, users multilog.MultiLog, self refs.FeedRef, hops HopsLister, maxHops int) ssb.Plugin {
+	return feedStatePlug{feedStateHandler{
+		rxlog:   rxlog,
+		users:   users,
+		self:    self,
+		hops:    hops,
+		maxHops: maxHops,
+	}}
+}
+
+type feedStatePlug struct {
+	h feedStateHandler
+}
+
+func (feedStatePlug) Name() string { return "getFeedState" }
+
+func (feedStatePlug) Method() muxrpc.Method { return feedStateMethod }
+
+func (p feedStatePlug) Handler() muxrpc.Handler { return p.h }
+
+type feedStateHandler struct {
+	rxlog   margaret.Log
+	users   multilog.MultiLog
+	self    refs.FeedRef
+	hops    HopsLister
+	maxHops int
+}
+
+func (feedStateHandler) Handled(m muxrpc.Method) bool { return m.String() == feedStateMethod.String() }
+
+func (feedStateHandler) HandleConnect(ctx context.Context, edp muxrpc.Endpoint) {}
+
+func (h feedStateHandler) HandleCall(ctx context.Context, req *muxrpc.Request) {
+	frontier, err := h.frontier(req)
+	if err != nil {
+		req.CloseWithError(err)
+		return
+	}
+	req.Return(ctx, frontier)
+}
+
+func (h feedStateHandler) frontier(req *muxrpc.Request) (map[string]int64, error) {
+	hops := h.maxHops
+	var args []FeedStateArgs
+	if len(req.RawArgs) > 0 {
+		if err := json.Unmarshal(req.RawArgs, &args); err != nil {
+			return nil, fmt.Errorf("getFeedState: invalid arguments: %w", err)
+		}
+	}
+	if len(args) > 0 && args[0].Hops != nil && *args[0].Hops < hops {
+		hops = *args[0].Hops
+	}
+
+	wanted := ssb.NewFeedSet(0)
+	if hops >= 0 {
+		if set := h.hops.Hops(h.self, hops); set != nil {
+			wanted = set
+		}
+	}
+	wanted.AddRef(h.self)
+
+	if n := wanted.Count(); n > MaxFeedStateSize {
+		return nil, fmt.Errorf("getFeedState: %w (%d)", ErrFeedStateTooLarge, n)
+	}
+
+	frontier, err := ssb.Frontier(h.rxlog, h.users)
+	if err != nil {
+		return nil, fmt.Errorf("getFeedState: %w", err)
+	}
+	for feed := range frontier {
+		ref, err := refs.ParseFeedRef(feed)
+		if err != nil || !wanted.Has(ref) {
+			delete(frontier, feed)
+		}
+	}
+	return frontier, nil
+}
+
+// GetFeedState asks the peer behind edp for its frontier, the latest sequences of the feeds within hops of it.
+// A negative hops leaves the choice to the peer. Compare the result with ssb.FeedsBehind.
+func GetFeedState(ctx context.Context, edp muxrpc.Endpoint, hops int) (map[string]int64, error) {
+	var args []interface{}
+	if hops >= 0 {
+		args = append(args, FeedStateArgs{Hops: &hops})
+	}
+
+	var frontier map[string]int64
+	err := edp.Async(ctx, &frontier, muxrpc.TypeJSON, feedStateMethod, args...)
+	if err != nil {
+		return nil, fmt.Errorf("getFeedState failed: %w", err)
+	}
+	return frontier, nil
+}
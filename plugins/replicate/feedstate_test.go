@@ -0,0 +1,151 @@
+// SPDX-FileCopyrightText: 2021 The Go-SSB Authors
+//
+// SPDX-License-Identifier: MIT
+
+package replicate_test
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.mindeco.de/log"
+
+	"github.com/ssbc/go-ssb"
+	refs "github.com/ssbc/go-ssb-refs"
+	"github.com/ssbc/go-ssb/internal/testutils"
+	"github.com/ssbc/go-ssb/plugins/replicate"
+	"github.com/ssbc/go-ssb/repo"
+	"github.com/ssbc/go-ssb/sbot"
+)
+
+func TestFeedStateExchange(t *testing.T) {
+	r := require.New(t)
+	ctx, cancel := context.WithCancel(context.TODO())
+	defer cancel()
+
+	testPath := filepath.Join("testrun", t.Name())
+	os.RemoveAll(testPath)
+
+	logger := testutils.NewRelativeTimeLogger(nil)
+
+	appKey := make([]byte, 32)
+	rand.Read(appKey)
+
+	// the bots accept each other without following, so that they don't replicate during the test
+	newBot := func(name string) *sbot.Sbot {
+		bot, err := sbot.New(
+			sbot.WithAppKey(appKey),
+			sbot.WithContext(ctx),
+			sbot.WithInfo(log.With(logger, "peer", name)),
+			sbot.WithRepoPath(filepath.Join(testPath, name)),
+			sbot.WithListenAddr(":0"),
+			sbot.WithHops(1),
+			sbot.WithPublicAuthorizer(allowAll{}),
+		)
+		r.NoError(err)
+		go func() {
+			err := bot.Network.Serve(ctx)
+			if err != nil && ctx.Err() == nil {
+				t.Error(err)
+			}
+		}()
+		return bot
+	}
+	ali := newBot("ali")
+	bob := newBot("bob")
+
+	// bob has two more feeds, carl which he follows and dora which is out of his hops
+	bobRepo := repo.New(filepath.Join(testPath, "bob"))
+	carl, err := repo.NewKeyPair(bobRepo, "carl", refs.RefAlgoFeedSSB1)
+	r.NoError(err)
+	_, err = repo.NewKeyPair(bobRepo, "dora", refs.RefAlgoFeedSSB1)
+	r.NoError(err)
+
+	publish := func(bot *sbot.Sbot, n int) {
+		for i := 0; i < n; i++ {
+			_, err := bot.PublishLog.Publish(refs.NewPost(fmt.Sprint(i)))
+			r.NoError(err)
+		}
+	}
+	publish(ali, 3)
+	publish(bob, 4)
+	_, err = bob.PublishLog.Publish(refs.NewContactFollow(carl.ID()))
+	r.NoError(err)
+	for i, nick := range []string{"carl", "carl", "dora"} {
+		_, err = bob.PublishAs(nick, refs.NewPost(fmt.Sprint(i)))
+		r.NoError(err)
+	}
+	bob.GraphBuilder.WaitUntilIndexesAreSynced()
+
+	r.NoError(ali.Network.Connect(ctx, bob.Network.GetListenAddr()))
+	r.Eventually(func() bool {
+		_, hasBob := ali.Network.GetEndpointFor(bob.KeyPair.ID())
+		_, hasAli := bob.Network.GetEndpointFor(ali.KeyPair.ID())
+		return hasBob && hasAli
+	}, 5*time.Second, 50*time.Millisecond)
+	edpBob, _ := ali.Network.GetEndpointFor(bob.KeyPair.ID())
+	edpAli, _ := bob.Network.GetEndpointFor(ali.KeyPair.ID())
+
+	alisFrontier, err := replicate.GetFeedState(ctx, edpAli, -1)
+	r.NoError(err)
+	r.Equal(map[string]int64{ali.KeyPair.ID().String(): 3}, alisFrontier)
+
+	bobsFrontier, err := replicate.GetFeedState(ctx, edpBob, -1)
+	r.NoError(err)
+	r.Equal(map[string]int64{
+		bob.KeyPair.ID().String(): 5,
+		carl.ID().String():        2,
+	}, bobsFrontier, "dora is not within the hops of bob")
+
+	// each side compares the frontier of the other with its own
+	ownOfAli, err := ssb.Frontier(ali.ReceiveLog, ali.Users)
+	r.NoError(err)
+	r.Equal(map[string]int64{
+		bob.KeyPair.ID().String(): 5,
+		carl.ID().String():        2,
+	}, ssb.FeedsBehind(ownOfAli, bobsFrontier))
+
+	ownOfBob, err := ssb.Frontier(bob.ReceiveLog, bob.Users)
+	r.NoError(err)
+	r.Len(ownOfBob, 3, "bob stores dora, too")
+	r.Equal(map[string]int64{
+		ali.KeyPair.ID().String(): 3,
+	}, ssb.FeedsBehind(ownOfBob, alisFrontier))
+
+	// once ali has some of carl, she is only behind on the rest
+	ownOfAli[carl.ID().String()] = 2
+	ownOfAli[bob.KeyPair.ID().String()] = 1
+	r.Equal(map[string]int64{
+		bob.KeyPair.ID().String(): 5,
+	}, ssb.FeedsBehind(ownOfAli, bobsFrontier))
+
+	// asking for more hops than bob replicates is capped
+	capped, err := replicate.GetFeedState(ctx, edpBob, 5)
+	r.NoError(err)
+	r.Equal(bobsFrontier, capped)
+
+	// ali isn't the master of bob but can ask for his latest sequences
+	seqs, err := replicate.LatestSequences(ctx, edpBob, []refs.FeedRef{bob.KeyPair.ID(), carl.ID(), ali.KeyPair.ID()})
+	r.NoError(err)
+	r.Equal(map[string]int64{
+		bob.KeyPair.ID().String(): 5,
+		carl.ID().String():        2,
+		ali.KeyPair.ID().String(): 0,
+	}, seqs)
+
+	ali.Shutdown()
+	bob.Shutdown()
+	cancel()
+	r.NoError(ali.Close())
+	r.NoError(bob.Close())
+}
+
+type allowAll struct{}
+
+func (allowAll) Authorize(refs.FeedRef) error { return nil }
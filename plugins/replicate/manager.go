@@ -0,0 +1,430 @@
+// SPDX-FileCopyrightText: 2021 The Go-SSB Authors
+//
+// SPDX-License-Identifier: MIT
+
+package replicate
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/ssbc/go-muxrpc/v2"
+	"go.mindeco.de/log"
+	"go.mindeco.de/log/level"
+	"go.mindeco.de/logging"
+
+	"github.com/ssbc/go-ssb"
+	refs "github.com/ssbc/go-ssb-refs"
+	"github.com/ssbc/go-ssb/internal/neterr"
+	"github.com/ssbc/go-ssb/message"
+)
+
+// HopsLister returns the feeds that are at most max hops away from a feed, like graph.Builder does.
+type HopsLister interface {
+	Hops(from refs.FeedRef, max int) *ssb.StrFeedSet
+}
+
+// ManagerOption changes the behaviour of a Manager
+type ManagerOption func(*Manager) error
+
+// WithSyncInterval sets how long the manager waits between fetch rounds, if no peer is registered in the meantime.
+func WithSyncInterval(d time.Duration) ManagerOption {
+	return func(m *Manager) error {
+		if d <= 0 {
+			return fmt.Errorf("replicate: sync interval needs to be positive")
+		}
+		m.interval = d
+		return nil
+	}
+}
+
+// WithConcurrentFeeds sets how many feeds are fetched at the same time.
+func WithConcurrentFeeds(n int) ManagerOption {
+	return func(m *Manager) error {
+		if n < 1 {
+			return fmt.Errorf("replicate: need to fetch at least one feed at a time")
+		}
+		m.concurrency = n
+		return nil
+	}
+}
+
+// WithConcurrentPerPeer sets how many history requests can be in flight to a single peer.
+func WithConcurrentPerPeer(n int) ManagerOption {
+	return func(m *Manager) error {
+		if n < 1 {
+			return fmt.Errorf("replicate: need to send at least one request per peer at a time")
+		}
+		m.perPeer = n
+		return nil
+	}
+}
+
+// WithBatchSize sets how many messages of a feed are requested in one turn.
+// A feed which has more goes to the back of the queue and gets another turn after the other feeds of the round.
+func WithBatchSize(n int) ManagerOption {
+	return func(m *Manager) error {
+		if n < 1 {
+			return fmt.Errorf("replicate: batch size needs to be positive")
+		}
+		m.batchSize = n
+		return nil
+	}
+}
+
+// PauseStore persists which feeds are paused, like repo.ReplStateIndex does.
+type PauseStore interface {
+	SetPaused(feed refs.FeedRef, paused bool) error
+	PausedFeeds() ([]refs.FeedRef, error)
+}
+
+// WithPauseStore keeps the feeds paused with Manager.Pause in ps, so that they stay paused after a restart.
+// Without it, they are only paused until the manager is gone.
+func WithPauseStore(ps PauseStore) ManagerOption {
+	return func(m *Manager) error {
+		m.pauseStore = ps
+		return nil
+	}
+}
+
+const (
+	defaultSyncInterval    = time.Minute
+	defaultConcurrentFeeds = 5
+	defaultPerPeer         = 2
+	defaultBatchSize       = 100
+)
+
+// Manager fetches the feeds in range of self from the registered peers using createHistoryStream.
+// Each feed is only requested from one peer at a time. The received messages are passed to the verification sinks of the router, which also check for forks.
+//
+// The feeds take turns: each turn requests at most a batch of messages, and feeds with more messages are queued again behind the others.
+// That way every feed makes progress, even if some of them have a long backlog.
+type Manager struct {
+	info logging.Interface
+
+	self    refs.FeedRef
+	hops    HopsLister
+	maxHops int
+
+	router *message.VerificationRouter
+
+	interval    time.Duration
+	concurrency int
+	perPeer     int
+	batchSize   int
+
+	wake chan struct{}
+
+	pauseStore PauseStore
+
+	mu     sync.Mutex
+	peers  map[string]*peer
+	active map[string]struct{}
+	paused map[string]struct{}
+}
+
+// NewManager creates a Manager which fetches the feeds that are at most maxHops away from self.
+func NewManager(info logging.Interface, self refs.FeedRef, hops HopsLister, maxHops int, vr *message.VerificationRouter, opts ...ManagerOption) (*Manager, error) {
+	m := &Manager{
+		info: info,
+
+		self:    self,
+		hops:    hops,
+		maxHops: maxHops,
+
+		router: vr,
+
+		interval:    defaultSyncInterval,
+		concurrency: defaultConcurrentFeeds,
+		perPeer:     defaultPerPeer,
+		batchSize:   defaultBatchSize,
+
+		wake: make(chan struct{}, 1),
+
+		peers:  make(map[string]*peer),
+		active: make(map[string]struct{}),
+		paused: make(map[string]struct{}),
+	}
+
+	for i, o := range opts {
+		if err := o(m); err != nil {
+			return nil, fmt.Errorf("replicate: failed to apply manager option %d: %w", i, err)
+		}
+	}
+
+	if m.pauseStore != nil {
+		paused, err := m.pauseStore.PausedFeeds()
+		if err != nil {
+			return nil, fmt.Errorf("replicate: failed to load paused feeds: %w", err)
+		}
+		for _, feed := range paused {
+			m.paused[feed.String()] = struct{}{}
+		}
+	}
+
+	return m, nil
+}
+
+// Pause stops fetching feed from peers, without unfollowing it. Fetches which already started are finished.
+func (m *Manager) Pause(feed refs.FeedRef) error {
+	return m.setPaused(feed, true)
+}
+
+// Resume fetches feed again, after it was paused.
+func (m *Manager) Resume(feed refs.FeedRef) error {
+	return m.setPaused(feed, false)
+}
+
+// Paused returns true if feed is paused.
+func (m *Manager) Paused(feed refs.FeedRef) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	_, paused := m.paused[feed.String()]
+	return paused
+}
+
+func (m *Manager) setPaused(feed refs.FeedRef, paused bool) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.pauseStore != nil {
+		if err := m.pauseStore.SetPaused(feed, paused); err != nil {
+			return fmt.Errorf("replicate: failed to persist pause of %s: %w", feed.ShortSigil(), err)
+		}
+	}
+
+	if paused {
+		m.paused[feed.String()] = struct{}{}
+	} else {
+		delete(m.paused, feed.String())
+	}
+	return nil
+}
+
+// peer is a registered endpoint and the tokens for the requests to it
+type peer struct {
+	edp    muxrpc.Endpoint
+	tokens chan struct{}
+}
+
+// Register adds a connected peer to fetch feeds from and starts a new fetch round.
+func (m *Manager) Register(edp muxrpc.Endpoint) {
+	m.mu.Lock()
+	m.peers[peerKey(edp)] = &peer{
+		edp:    edp,
+		tokens: make(chan struct{}, m.perPeer),
+	}
+	m.mu.Unlock()
+
+	select {
+	case m.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Unregister removes a peer, for instance after it disconnected.
+func (m *Manager) Unregister(edp muxrpc.Endpoint) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.peers, peerKey(edp))
+}
+
+func peerKey(peer muxrpc.Endpoint) string {
+	if ref, err := ssb.GetFeedRefFromAddr(peer.Remote()); err == nil {
+		return ref.String()
+	}
+	return peer.Remote().String()
+}
+
+// Serve runs fetch rounds until the context is canceled.
+// A round starts after every interval and when a peer is registered.
+func (m *Manager) Serve(ctx context.Context) error {
+	tick := time.NewTicker(m.interval)
+	defer tick.Stop()
+
+	for {
+		if err := m.Sync(ctx); err != nil {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-tick.C:
+		case <-m.wake:
+		}
+	}
+}
+
+// Sync does one fetch round. It requests every wanted feed, except the paused ones, from the registered peers and returns once all of them are done.
+// The feeds are fetched in turns of one batch, see WithBatchSize.
+func (m *Manager) Sync(ctx context.Context) error {
+	set := m.hops.Hops(m.self, m.maxHops)
+	if set == nil {
+		return nil
+	}
+
+	feeds, err := set.List()
+	if err != nil {
+		return fmt.Errorf("replicate: failed to list wanted feeds: %w", err)
+	}
+
+	var claimed []refs.FeedRef
+	for _, feed := range feeds {
+		if feed.Equal(m.self) || m.Paused(feed) {
+			continue
+		}
+
+		// another round is already fetching this feed
+		if !m.claim(feed) {
+			continue
+		}
+		claimed = append(claimed, feed)
+	}
+
+	queue := newFeedQueue(claimed)
+	var wg sync.WaitGroup
+	for i := 0; i < m.concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				feed, ok := queue.next()
+				if !ok {
+					return
+				}
+
+				more := m.fetchTurn(ctx, feed)
+				if !more {
+					m.release(feed)
+				}
+				queue.done(feed, more)
+			}
+		}()
+	}
+
+	wg.Wait()
+	return ctx.Err()
+}
+
+func (m *Manager) claim(feed refs.FeedRef) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, has := m.active[feed.String()]; has {
+		return false
+	}
+	m.active[feed.String()] = struct{}{}
+	return true
+}
+
+func (m *Manager) release(feed refs.FeedRef) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.active, feed.String())
+}
+
+func (m *Manager) peerList() []*peer {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	lst := make([]*peer, 0, len(m.peers))
+	for _, p := range m.peers {
+		lst = append(lst, p)
+	}
+	return lst
+}
+
+// fetchTurn asks the peers one after the other for the next batch of messages after the latest one we have.
+// It returns true if a peer sent a full batch of new messages, then there are probably more.
+// Messages which were already stored don't count, so a peer which keeps sending the same ones doesn't keep the feed in the queue.
+func (m *Manager) fetchTurn(ctx context.Context, feed refs.FeedRef) bool {
+	for _, p := range m.peerList() {
+		select {
+		case p.tokens <- struct{}{}:
+		case <-ctx.Done():
+			return false
+		}
+		stored, err := m.fetchFeed(ctx, feed, p.edp)
+		<-p.tokens
+
+		if err == nil {
+			if stored >= int64(m.batchSize) {
+				return true
+			}
+			continue
+		}
+
+		if errors.Is(err, context.Canceled) {
+			return false
+		}
+
+		info := log.With(m.info, "fr", feed.ShortSigil(), "peer", peerKey(p.edp))
+		if errors.Is(err, muxrpc.ErrSessionTerminated) || neterr.IsConnBrokenErr(err) {
+			level.Debug(info).Log("event", "dropping peer", "err", err)
+			m.Unregister(p.edp)
+			continue
+		}
+
+		// most likely a forked or otherwise invalid feed
+		level.Warn(info).Log("event", "skipped updating of stored feed", "err", err)
+	}
+	return false
+}
+
+// fetchFeed requests a batch of messages of feed from peer and returns by how much the stored feed advanced.
+func (m *Manager) fetchFeed(ctx context.Context, feed refs.FeedRef, peer muxrpc.Endpoint) (int64, error) {
+	snk, err := m.router.GetSink(feed, true)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get verify sink for feed: %w", err)
+	}
+
+	start := snk.Seq()
+
+	var q = message.NewCreateHistoryStreamArgs()
+	q.ID = feed
+	q.Seq = start + 1
+	q.Limit = int64(m.batchSize)
+
+	method := muxrpc.Method{"createHistoryStream"}
+
+	var src *muxrpc.ByteSource
+	switch feed.Algo() {
+	case refs.RefAlgoFeedSSB1:
+		src, err = peer.Source(ctx, muxrpc.TypeJSON, method, q)
+	case refs.RefAlgoFeedBendyButt, refs.RefAlgoFeedGabby:
+		src, err = peer.Source(ctx, muxrpc.TypeBinary, method, q)
+	default:
+		return 0, fmt.Errorf("fetchFeed(%s): unhandled feed format", feed.String())
+	}
+	if err != nil {
+		return 0, fmt.Errorf("fetchFeed(%s:%d) failed to create source: %w", feed.String(), q.Seq, err)
+	}
+
+	buf := &bytes.Buffer{}
+	for src.Next(ctx) {
+		err = src.Reader(func(r io.Reader) error {
+			_, err = buf.ReadFrom(r)
+			return err
+		})
+		if err != nil {
+			return snk.Seq() - start, err
+		}
+
+		err = snk.Verify(buf.Bytes())
+		if err != nil {
+			return snk.Seq() - start, err
+		}
+		buf.Reset()
+	}
+
+	if err := src.Err(); err != nil {
+		return snk.Seq() - start, fmt.Errorf("fetchFeed(%s:%d) pump failed: %w", feed.String(), q.Seq, err)
+	}
+	return snk.Seq() - start, nil
+}
@@ -0,0 +1,495 @@
+// SPDX-FileCopyrightText: 2021 The Go-SSB Authors
+//
+// SPDX-License-Identifier: MIT
+
+package replicate_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ssbc/go-muxrpc/v2"
+	"github.com/ssbc/go-muxrpc/v2/typemux"
+	"github.com/ssbc/go-netwrap"
+	"github.com/ssbc/go-secretstream"
+	"github.com/stretchr/testify/require"
+	"go.mindeco.de/log"
+
+	"github.com/ssbc/go-ssb"
+	refs "github.com/ssbc/go-ssb-refs"
+	"github.com/ssbc/go-ssb/internal/asynctesting"
+	"github.com/ssbc/go-ssb/internal/storedrefs"
+	"github.com/ssbc/go-ssb/message"
+	"github.com/ssbc/go-ssb/multilogs"
+	"github.com/ssbc/go-ssb/plugins/gossip"
+	"github.com/ssbc/go-ssb/plugins/replicate"
+	"github.com/ssbc/go-ssb/plugins/test"
+	"github.com/ssbc/go-ssb/repo"
+)
+
+type staticHops []refs.FeedRef
+
+func (sh staticHops) Hops(_ refs.FeedRef, _ int) *ssb.StrFeedSet {
+	set := ssb.NewFeedSet(len(sh))
+	for _, f := range sh {
+		set.AddRef(f)
+	}
+	return set
+}
+
+func TestManagerCatchesUp(t *testing.T) {
+	r := require.New(t)
+	ctx, cancel := context.WithCancel(context.TODO())
+	defer cancel()
+
+	logger := log.NewNopLogger()
+
+	aliceRepo, alicePath := test.MakeEmptyPeer(t)
+	defer os.RemoveAll(alicePath)
+	bobRepo, bobPath := test.MakeEmptyPeer(t)
+	defer os.RemoveAll(bobPath)
+
+	aliceKP, err := repo.DefaultKeyPair(aliceRepo, refs.RefAlgoFeedSSB1)
+	r.NoError(err)
+	bobKP, err := repo.DefaultKeyPair(bobRepo, refs.RefAlgoFeedSSB1)
+	r.NoError(err)
+
+	// alice has a feed with some messages
+	aliceRx, err := repo.OpenLog(aliceRepo)
+	r.NoError(err)
+	defer aliceRx.Close()
+
+	aliceUsers, aliceUsersSnk, err := repo.OpenStandaloneMultiLog(aliceRepo, "users", multilogs.UserFeedsUpdate)
+	r.NoError(err)
+	defer aliceUsers.Close()
+	aliceErrc := asynctesting.ServeLog(ctx, "alice users", aliceRx, aliceUsersSnk, true)
+
+	alicePublish, err := message.OpenPublishLog(aliceRx, aliceUsers, aliceKP)
+	r.NoError(err)
+
+	aliceSublog, err := aliceUsers.Get(storedrefs.Feed(aliceKP.ID()))
+	r.NoError(err)
+
+	const n = 10
+	for i := 0; i < n; i++ {
+		_, err = alicePublish.Publish(refs.NewPost(fmt.Sprint("hello ", i)))
+		r.NoError(err)
+		r.Eventually(func() bool { return aliceSublog.Seq() == int64(i) }, time.Second, 10*time.Millisecond)
+	}
+
+	fm := gossip.NewFeedManager(ctx, aliceRx, aliceUsers, logger, nil, nil)
+	server := gossip.NewServer(ctx, logger, aliceKP.ID(), aliceRx, aliceUsers, nil, fm, gossip.Promisc(true))
+
+	// bob wants alice's feed
+	bobRx, err := repo.OpenLog(bobRepo)
+	r.NoError(err)
+	defer bobRx.Close()
+
+	bobUsers, bobUsersSnk, err := repo.OpenStandaloneMultiLog(bobRepo, "users", multilogs.UserFeedsUpdate)
+	r.NoError(err)
+	defer bobUsers.Close()
+	bobErrc := asynctesting.ServeLog(ctx, "bob users", bobRx, bobUsersSnk, true)
+
+	vr, err := message.NewVerificationRouter(bobRx, bobUsers, nil)
+	r.NoError(err)
+
+	mgr, err := replicate.NewManager(logger, bobKP.ID(), staticHops{aliceKP.ID()}, 1, vr, replicate.WithSyncInterval(50*time.Millisecond))
+	r.NoError(err)
+
+	pkrAlice, pkrBob, serve := test.PrepareConnectAndServe(t, aliceRepo, bobRepo)
+	bobHandler := typemux.New(logger)
+
+	// both sides exchange manifests while setting up, so they need to be created concurrently
+	aliceEdp := make(chan muxrpc.Endpoint)
+	go func() { aliceEdp <- muxrpc.Handle(pkrAlice, server.Handler()) }()
+	rpcBob := muxrpc.Handle(pkrBob, &bobHandler)
+	done := serve(<-aliceEdp, rpcBob)
+
+	// rpcBob is bob's connection to alice
+	mgr.Register(rpcBob)
+	mgrErrc := make(chan error, 1)
+	go func() { mgrErrc <- mgr.Serve(ctx) }()
+
+	bobSublog, err := bobUsers.Get(storedrefs.Feed(aliceKP.ID()))
+	r.NoError(err)
+	r.Eventually(func() bool { return bobSublog.Seq() == n-1 }, 5*time.Second, 50*time.Millisecond, "bob didn't catch up")
+
+	// new messages are fetched in the next round
+	_, err = alicePublish.Publish(refs.NewPost("one more"))
+	r.NoError(err)
+	r.Eventually(func() bool { return bobSublog.Seq() == n }, 5*time.Second, 50*time.Millisecond, "bob didn't get the new message")
+
+	cancel()
+	r.ErrorIs(<-mgrErrc, context.Canceled)
+	done()
+	r.NoError(<-aliceErrc)
+	r.NoError(<-bobErrc)
+}
+
+func TestManagerPause(t *testing.T) {
+	r := require.New(t)
+	ctx, cancel := context.WithCancel(context.TODO())
+	defer cancel()
+
+	logger := log.NewNopLogger()
+
+	bobRepo, bobPath := test.MakeEmptyPeer(t)
+	defer os.RemoveAll(bobPath)
+	bobKP, err := repo.DefaultKeyPair(bobRepo, refs.RefAlgoFeedSSB1)
+	r.NoError(err)
+
+	bobRx, err := repo.OpenLog(bobRepo)
+	r.NoError(err)
+	defer bobRx.Close()
+	bobUsers, _, err := repo.OpenStandaloneMultiLog(bobRepo, "users", multilogs.UserFeedsUpdate)
+	r.NoError(err)
+	defer bobUsers.Close()
+	vr, err := message.NewVerificationRouter(bobRx, bobUsers, nil)
+	r.NoError(err)
+
+	alice, err := ssb.NewKeyPair(nil, refs.RefAlgoFeedSSB1)
+	r.NoError(err)
+	carl, err := ssb.NewKeyPair(nil, refs.RefAlgoFeedSSB1)
+	r.NoError(err)
+	hops := staticHops{alice.ID(), carl.ID()}
+
+	// the peer records which feeds are asked for and doesn't have any of them
+	var (
+		mu        sync.Mutex
+		requested []refs.FeedRef
+	)
+	peer := new(muxrpc.FakeEndpoint)
+	peer.RemoteReturns(&net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 8008})
+	peer.SourceCalls(func(_ context.Context, _ muxrpc.RequestEncoding, _ muxrpc.Method, args ...interface{}) (*muxrpc.ByteSource, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		requested = append(requested, args[0].(message.CreateHistArgs).ID)
+		return nil, errors.New("no such feed")
+	})
+	tick := func(mgr *replicate.Manager) []refs.FeedRef {
+		mu.Lock()
+		requested = nil
+		mu.Unlock()
+
+		r.NoError(mgr.Sync(ctx))
+
+		mu.Lock()
+		defer mu.Unlock()
+		sort.Slice(requested, func(i, j int) bool { return requested[i].String() < requested[j].String() })
+		return requested
+	}
+	both := []refs.FeedRef{alice.ID(), carl.ID()}
+	sort.Slice(both, func(i, j int) bool { return both[i].String() < both[j].String() })
+
+	rs, err := repo.ReplState(bobRepo)
+	r.NoError(err)
+	mgr, err := replicate.NewManager(logger, bobKP.ID(), hops, 1, vr, replicate.WithPauseStore(rs))
+	r.NoError(err)
+	mgr.Register(peer)
+	r.Equal(both, tick(mgr))
+
+	r.NoError(mgr.Pause(alice.ID()))
+	r.True(mgr.Paused(alice.ID()))
+	r.Equal([]refs.FeedRef{carl.ID()}, tick(mgr))
+
+	// the pause survives a restart
+	r.NoError(rs.Close())
+	rs, err = repo.ReplState(bobRepo)
+	r.NoError(err)
+	defer rs.Close()
+	paused, err := rs.PausedFeeds()
+	r.NoError(err)
+	r.Len(paused, 1)
+	r.True(paused[0].Equal(alice.ID()))
+
+	mgr, err = replicate.NewManager(logger, bobKP.ID(), hops, 1, vr, replicate.WithPauseStore(rs))
+	r.NoError(err)
+	mgr.Register(peer)
+	r.True(mgr.Paused(alice.ID()))
+	r.Equal([]refs.FeedRef{carl.ID()}, tick(mgr))
+
+	r.NoError(mgr.Resume(alice.ID()))
+	r.False(mgr.Paused(alice.ID()))
+	r.Equal(both, tick(mgr))
+
+	paused, err = rs.PausedFeeds()
+	r.NoError(err)
+	r.Empty(paused)
+}
+
+// recordingEndpoint remembers the feeds of the history requests made through it
+type recordingEndpoint struct {
+	muxrpc.Endpoint
+
+	mu        sync.Mutex
+	requested []message.CreateHistArgs
+}
+
+func (re *recordingEndpoint) Source(ctx context.Context, enc muxrpc.RequestEncoding, method muxrpc.Method, args ...interface{}) (*muxrpc.ByteSource, error) {
+	re.mu.Lock()
+	re.requested = append(re.requested, args[0].(message.CreateHistArgs))
+	re.mu.Unlock()
+	return re.Endpoint.Source(ctx, enc, method, args...)
+}
+
+func TestManagerFairness(t *testing.T) {
+	r := require.New(t)
+	ctx, cancel := context.WithCancel(context.TODO())
+	defer cancel()
+
+	logger := log.NewNopLogger()
+
+	aliceRepo, alicePath := test.MakeEmptyPeer(t)
+	defer os.RemoveAll(alicePath)
+	bobRepo, bobPath := test.MakeEmptyPeer(t)
+	defer os.RemoveAll(bobPath)
+
+	aliceKP, err := repo.DefaultKeyPair(aliceRepo, refs.RefAlgoFeedSSB1)
+	r.NoError(err)
+	bobKP, err := repo.DefaultKeyPair(bobRepo, refs.RefAlgoFeedSSB1)
+	r.NoError(err)
+
+	// alice has many feeds with a backlog for bob
+	aliceRx, err := repo.OpenLog(aliceRepo)
+	r.NoError(err)
+	defer aliceRx.Close()
+
+	aliceUsers, aliceUsersSnk, err := repo.OpenStandaloneMultiLog(aliceRepo, "users", multilogs.UserFeedsUpdate)
+	r.NoError(err)
+	defer aliceUsers.Close()
+	aliceErrc := asynctesting.ServeLog(ctx, "alice users", aliceRx, aliceUsersSnk, true)
+
+	const (
+		feedCount = 6
+		msgCount  = 12
+		batch     = 4
+	)
+	var lagging staticHops
+	for i := 0; i < feedCount; i++ {
+		kp, err := ssb.NewKeyPair(nil, refs.RefAlgoFeedSSB1)
+		r.NoError(err)
+		lagging = append(lagging, kp.ID())
+
+		publish, err := message.OpenPublishLog(aliceRx, aliceUsers, kp)
+		r.NoError(err)
+		sublog, err := aliceUsers.Get(storedrefs.Feed(kp.ID()))
+		r.NoError(err)
+		for j := 0; j < msgCount; j++ {
+			_, err = publish.Publish(refs.NewPost(fmt.Sprint("hello ", j)))
+			r.NoError(err)
+			r.Eventually(func() bool { return sublog.Seq() == int64(j) }, time.Second, 10*time.Millisecond)
+		}
+	}
+
+	fm := gossip.NewFeedManager(ctx, aliceRx, aliceUsers, logger, nil, nil)
+	server := gossip.NewServer(ctx, logger, aliceKP.ID(), aliceRx, aliceUsers, nil, fm, gossip.Promisc(true))
+
+	bobRx, err := repo.OpenLog(bobRepo)
+	r.NoError(err)
+	defer bobRx.Close()
+
+	bobUsers, bobUsersSnk, err := repo.OpenStandaloneMultiLog(bobRepo, "users", multilogs.UserFeedsUpdate)
+	r.NoError(err)
+	defer bobUsers.Close()
+	bobErrc := asynctesting.ServeLog(ctx, "bob users", bobRx, bobUsersSnk, true)
+
+	vr, err := message.NewVerificationRouter(bobRx, bobUsers, nil)
+	r.NoError(err)
+
+	mgr, err := replicate.NewManager(logger, bobKP.ID(), lagging, 1, vr,
+		replicate.WithConcurrentFeeds(2),
+		replicate.WithConcurrentPerPeer(1),
+		replicate.WithBatchSize(batch))
+	r.NoError(err)
+
+	// a tcp connection instead of the synchronous pipe of test.PrepareConnectAndServe,
+	// with several requests in flight both ends might write at the same time
+	connAlice, connBob := tcpConnPair(t)
+	defer connAlice.Close()
+	defer connBob.Close()
+	bobHandler := typemux.New(logger)
+
+	aliceEdp := make(chan muxrpc.Endpoint)
+	go func() {
+		edp := muxrpc.Handle(muxrpc.NewPacker(connAlice), server.Handler(),
+			muxrpc.WithRemoteAddr(netwrap.WrapAddr(connAlice.RemoteAddr(), secretstream.Addr{PubKey: bobKP.ID().PubKey()})))
+		aliceEdp <- edp
+		edp.(muxrpc.Server).Serve()
+	}()
+	rpcBob := muxrpc.Handle(muxrpc.NewPacker(connBob), &bobHandler,
+		muxrpc.WithRemoteAddr(netwrap.WrapAddr(connBob.RemoteAddr(), secretstream.Addr{PubKey: aliceKP.ID().PubKey()})))
+	go rpcBob.(muxrpc.Server).Serve()
+	<-aliceEdp
+
+	recorder := &recordingEndpoint{Endpoint: rpcBob}
+	mgr.Register(recorder)
+	r.NoError(mgr.Sync(ctx))
+
+	for _, feed := range lagging {
+		sublog, err := bobUsers.Get(storedrefs.Feed(feed))
+		r.NoError(err)
+		r.Eventually(func() bool { return sublog.Seq() == msgCount-1 }, time.Second, 10*time.Millisecond, "bob didn't catch up with %s", feed.ShortSigil())
+	}
+
+	// every feed needs three full batches and one more request to find out it's done
+	recorder.mu.Lock()
+	requested := recorder.requested
+	recorder.mu.Unlock()
+	r.Len(requested, feedCount*(msgCount/batch+1))
+
+	turns := make(map[string]int)
+	for i, args := range requested {
+		r.EqualValues(batch, args.Limit)
+
+		turns[args.ID.String()]++
+		// every feed has its first turn before any gets a second one
+		if i == feedCount-1 {
+			r.Len(turns, feedCount)
+		}
+
+		// and no feed gets far ahead of the others
+		min, max := msgCount, 0
+		for _, feed := range lagging {
+			n := turns[feed.String()]
+			if n < min {
+				min = n
+			}
+			if n > max {
+				max = n
+			}
+		}
+		r.LessOrEqual(max-min, 2, "request %d: feeds got between %d and %d turns", i, min, max)
+	}
+
+	cancel()
+	r.NoError(<-aliceErrc)
+	r.NoError(<-bobErrc)
+}
+
+// rewindingEndpoint always asks for a feed from the start, like a peer which ignores the requested sequence
+type rewindingEndpoint struct {
+	recordingEndpoint
+}
+
+func (re *rewindingEndpoint) Source(ctx context.Context, enc muxrpc.RequestEncoding, method muxrpc.Method, args ...interface{}) (*muxrpc.ByteSource, error) {
+	q := args[0].(message.CreateHistArgs)
+	q.Seq = 1
+	return re.recordingEndpoint.Source(ctx, enc, method, q)
+}
+
+func TestManagerStopsOnStaleBatches(t *testing.T) {
+	r := require.New(t)
+	ctx, cancel := context.WithCancel(context.TODO())
+	defer cancel()
+
+	logger := log.NewNopLogger()
+
+	aliceRepo, alicePath := test.MakeEmptyPeer(t)
+	defer os.RemoveAll(alicePath)
+	bobRepo, bobPath := test.MakeEmptyPeer(t)
+	defer os.RemoveAll(bobPath)
+
+	aliceKP, err := repo.DefaultKeyPair(aliceRepo, refs.RefAlgoFeedSSB1)
+	r.NoError(err)
+	bobKP, err := repo.DefaultKeyPair(bobRepo, refs.RefAlgoFeedSSB1)
+	r.NoError(err)
+
+	aliceRx, err := repo.OpenLog(aliceRepo)
+	r.NoError(err)
+	defer aliceRx.Close()
+
+	aliceUsers, aliceUsersSnk, err := repo.OpenStandaloneMultiLog(aliceRepo, "users", multilogs.UserFeedsUpdate)
+	r.NoError(err)
+	defer aliceUsers.Close()
+	aliceErrc := asynctesting.ServeLog(ctx, "alice users", aliceRx, aliceUsersSnk, true)
+
+	alicePublish, err := message.OpenPublishLog(aliceRx, aliceUsers, aliceKP)
+	r.NoError(err)
+	aliceSublog, err := aliceUsers.Get(storedrefs.Feed(aliceKP.ID()))
+	r.NoError(err)
+
+	const (
+		n     = 10
+		batch = 4
+	)
+	for i := 0; i < n; i++ {
+		_, err = alicePublish.Publish(refs.NewPost(fmt.Sprint("hello ", i)))
+		r.NoError(err)
+		r.Eventually(func() bool { return aliceSublog.Seq() == int64(i) }, time.Second, 10*time.Millisecond)
+	}
+
+	fm := gossip.NewFeedManager(ctx, aliceRx, aliceUsers, logger, nil, nil)
+	server := gossip.NewServer(ctx, logger, aliceKP.ID(), aliceRx, aliceUsers, nil, fm, gossip.Promisc(true))
+
+	bobRx, err := repo.OpenLog(bobRepo)
+	r.NoError(err)
+	defer bobRx.Close()
+
+	bobUsers, bobUsersSnk, err := repo.OpenStandaloneMultiLog(bobRepo, "users", multilogs.UserFeedsUpdate)
+	r.NoError(err)
+	defer bobUsers.Close()
+	bobErrc := asynctesting.ServeLog(ctx, "bob users", bobRx, bobUsersSnk, true)
+
+	vr, err := message.NewVerificationRouter(bobRx, bobUsers, nil)
+	r.NoError(err)
+
+	mgr, err := replicate.NewManager(logger, bobKP.ID(), staticHops{aliceKP.ID()}, 1, vr, replicate.WithBatchSize(batch))
+	r.NoError(err)
+
+	pkrAlice, pkrBob, serve := test.PrepareConnectAndServe(t, aliceRepo, bobRepo)
+	bobHandler := typemux.New(logger)
+
+	aliceEdp := make(chan muxrpc.Endpoint)
+	go func() { aliceEdp <- muxrpc.Handle(pkrAlice, server.Handler()) }()
+	rpcBob := muxrpc.Handle(pkrBob, &bobHandler)
+	done := serve(<-aliceEdp, rpcBob)
+
+	rewinding := &rewindingEndpoint{recordingEndpoint{Endpoint: rpcBob}}
+	mgr.Register(rewinding)
+
+	syncCtx, syncCancel := context.WithTimeout(ctx, 5*time.Second)
+	defer syncCancel()
+	r.NoError(mgr.Sync(syncCtx), "sync didn't finish")
+
+	// the first batch is new, the second one only has the same messages again
+	rewinding.mu.Lock()
+	requested := len(rewinding.requested)
+	rewinding.mu.Unlock()
+	r.Equal(2, requested)
+
+	bobSublog, err := bobUsers.Get(storedrefs.Feed(aliceKP.ID()))
+	r.NoError(err)
+	r.EqualValues(batch-1, bobSublog.Seq())
+
+	cancel()
+	done()
+	r.NoError(<-aliceErrc)
+	r.NoError(<-bobErrc)
+}
+
+// tcpConnPair returns both ends of a tcp connection over localhost
+func tcpConnPair(t *testing.T) (net.Conn, net.Conn) {
+	lis, err := net.Listen("tcp", "localhost:0")
+	require.NoError(t, err)
+	defer lis.Close()
+
+	accepted := make(chan net.Conn, 1)
+	go func() {
+		c, err := lis.Accept()
+		if err != nil {
+			t.Error(err)
+		}
+		accepted <- c
+	}()
+
+	dialed, err := net.Dial("tcp", lis.Addr().String())
+	require.NoError(t, err)
+	return <-accepted, dialed
+}
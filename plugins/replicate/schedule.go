@@ -0,0 +1,59 @@
+// SPDX-FileCopyrightText: 2021 The Go-SSB Authors
+//
+// SPDX-License-Identifier: MIT
+
+package replicate
+
+import (
+	"sync"
+
+	refs "github.com/ssbc/go-ssb-refs"
+)
+
+// feedQueue hands out the feeds of a fetch round to the workers in turns.
+// A feed which has more messages after its turn goes to the back of the queue,
+// so that feeds with a long backlog don't keep the workers from the others.
+type feedQueue struct {
+	mu       sync.Mutex
+	cond     *sync.Cond
+	queue    []refs.FeedRef
+	inFlight int
+}
+
+func newFeedQueue(feeds []refs.FeedRef) *feedQueue {
+	fq := &feedQueue{queue: feeds}
+	fq.cond = sync.NewCond(&fq.mu)
+	return fq
+}
+
+// next returns the feed for the next turn.
+// If the queue is empty, it waits for the turns in flight, since their feeds might come back.
+// It returns false once the queue is empty and no turn is in flight.
+func (fq *feedQueue) next() (refs.FeedRef, bool) {
+	fq.mu.Lock()
+	defer fq.mu.Unlock()
+
+	for len(fq.queue) == 0 {
+		if fq.inFlight == 0 {
+			return refs.FeedRef{}, false
+		}
+		fq.cond.Wait()
+	}
+
+	feed := fq.queue[0]
+	fq.queue = fq.queue[1:]
+	fq.inFlight++
+	return feed, true
+}
+
+// done ends the turn of feed. If more is true, the feed is queued for another turn.
+func (fq *feedQueue) done(feed refs.FeedRef, more bool) {
+	fq.mu.Lock()
+	defer fq.mu.Unlock()
+
+	fq.inFlight--
+	if more {
+		fq.queue = append(fq.queue, feed)
+	}
+	fq.cond.Broadcast()
+}
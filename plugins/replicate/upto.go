@@ -15,6 +15,7 @@ import (
 	"github.com/ssbc/go-muxrpc/v2"
 	"github.com/ssbc/go-muxrpc/v2/typemux"
 	refs "github.com/ssbc/go-ssb-refs"
+	"github.com/ssbc/margaret"
 	"github.com/ssbc/margaret/multilog"
 	"go.mindeco.de/log"
 
@@ -25,18 +26,25 @@ type replicatePlug struct {
 	h muxrpc.Handler
 }
 
+// NewPlug returns the replicate plugin, which looks up the messages of the sublogs of users in rxlog.
 // TODO: add request, block, changes
-func NewPlug(users multilog.MultiLog, self refs.FeedRef, lister ssb.ReplicationLister) ssb.Plugin {
+func NewPlug(rxlog margaret.Log, users multilog.MultiLog, self refs.FeedRef, lister ssb.ReplicationLister) ssb.Plugin {
 	plug := &replicatePlug{}
 
 	tm := typemux.New(log.NewNopLogger())
 
 	tm.RegisterSource(muxrpc.Method{"replicate", "upto"}, replicateHandler{
+		rxlog:  rxlog,
 		users:  users,
 		wanted: lister,
 		self:   self,
 	})
 
+	tm.RegisterAsync(latestSequencesMethod, latestSequencesHandler{
+		rxlog: rxlog,
+		users: users,
+	})
+
 	plug.h = &tm
 	return plug
 }
@@ -51,6 +59,7 @@ func (lt replicatePlug) Handler() muxrpc.Handler {
 }
 
 type replicateHandler struct {
+	rxlog  margaret.Log
 	users  multilog.MultiLog
 	self   refs.FeedRef
 	wanted ssb.ReplicationLister
@@ -64,7 +73,7 @@ func (g replicateHandler) HandleSource(ctx context.Context, req *muxrpc.Request,
 		return err
 	}
 
-	set, err := ssb.WantedFeedsWithSeqs(g.users, list)
+	set, err := ssb.WantedFeedsWithSeqs(g.rxlog, g.users, list)
 	if err != nil {
 		return fmt.Errorf("replicate: did not get feed source: %w", err)
 	}
@@ -81,3 +90,34 @@ func (g replicateHandler) HandleSource(ctx context.Context, req *muxrpc.Request,
 
 	return sink.Close()
 }
+
+var latestSequencesMethod = muxrpc.Method{"replicate", "latestSequences"}
+
+// LatestSequences asks the peer behind edp for the latest sequences it has of feeds, with 0 for the ones it doesn't have.
+func LatestSequences(ctx context.Context, edp muxrpc.Endpoint, feeds []refs.FeedRef) (map[string]int64, error) {
+	var seqs map[string]int64
+	err := edp.Async(ctx, &seqs, muxrpc.TypeJSON, latestSequencesMethod, feeds)
+	if err != nil {
+		return nil, fmt.Errorf("replicate.latestSequences failed: %w", err)
+	}
+	return seqs, nil
+}
+
+// latestSequencesHandler answers with the latest sequence of each of the requested feeds, so that a peer can decide what to fetch without replicating.
+type latestSequencesHandler struct {
+	rxlog margaret.Log
+	users multilog.MultiLog
+}
+
+func (h latestSequencesHandler) HandleAsync(ctx context.Context, req *muxrpc.Request) (interface{}, error) {
+	var args [][]refs.FeedRef
+	if err := json.Unmarshal(req.RawArgs, &args); err != nil {
+		return nil, fmt.Errorf("replicate: invalid arguments for latestSequences: %w", err)
+	}
+
+	if n := len(args); n != 1 {
+		return nil, fmt.Errorf("replicate: expected one list of feeds, got %d arguments", n)
+	}
+
+	return ssb.LatestSequences(h.rxlog, h.users, args[0])
+}
@@ -82,7 +82,7 @@ func TestListing(t *testing.T) {
 		feeds, err := set.List()
 		r.NoError(err)
 
-		respSet, err := ssb.WantedFeedsWithSeqs(mainbot.Users, feeds)
+		respSet, err := ssb.WantedFeedsWithSeqs(mainbot.ReceiveLog, mainbot.Users, feeds)
 		r.NoError(err)
 
 		assert.Len(t, respSet, wanted)
@@ -2,7 +2,7 @@
 //
 // SPDX-License-Identifier: MIT
 
-package private
+package box2
 
 import (
 	"crypto/sha256"
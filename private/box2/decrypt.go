@@ -0,0 +1,66 @@
+// SPDX-FileCopyrightText: 2021 The Go-SSB Authors
+//
+// SPDX-License-Identifier: MIT
+
+package box2
+
+import (
+	"fmt"
+
+	"github.com/ssbc/go-ssb"
+	refs "github.com/ssbc/go-ssb-refs"
+	"github.com/ssbc/go-ssb/private/keys"
+)
+
+// DecryptFor decrypts the ciphertext of a message by author, whose previous message is prev, for kp.
+// It tries the key for direct messages between kp and author and each of the groupKeys.
+// If none of them opens the message, the error wraps ErrCouldNotDecrypt.
+//
+// Unlike private.Manager it doesn't need a key store, which is useful for tools and clients that keep the group keys themselves.
+func DecryptFor(ctxt []byte, author refs.FeedRef, prev refs.MessageRef, kp ssb.KeyPair, groupKeys [][]byte) ([]byte, error) {
+	// header box and at least one slot
+	if len(ctxt) < 2*KeySize {
+		return nil, fmt.Errorf("box2: ciphertext too short: %w", ErrInvalid)
+	}
+
+	dmKey, err := DeriveDMKey(kp.ID(), kp.Secret(), author)
+	if err != nil {
+		return nil, fmt.Errorf("box2: failed to derive DM key: %w", err)
+	}
+
+	candidates := make(keys.Recipients, 0, len(groupKeys)+1)
+	candidates = append(candidates, keys.Recipient{
+		Key:    dmKey,
+		Scheme: keys.SchemeDiffieStyleConvertedED25519,
+	})
+	for _, gk := range groupKeys {
+		candidates = append(candidates, keys.Recipient{
+			Key:    gk,
+			Scheme: keys.SchemeLargeSymmetricGroup,
+		})
+	}
+
+	return NewBoxer(nil).Decrypt(ctxt, author, prev, candidates)
+}
+
+// Decrypter is a ssb.MessageDecrypter for box2 messages, with the keys of DecryptFor.
+// Pass it to ssb.DecodeContent so that the content of private group messages is decoded by its plaintext type.
+type Decrypter struct {
+	KeyPair   ssb.KeyPair
+	GroupKeys [][]byte
+}
+
+var _ ssb.MessageDecrypter = Decrypter{}
+
+// DecryptMessage returns the plaintext content of msg.
+func (d Decrypter) DecryptMessage(msg refs.Message) ([]byte, error) {
+	ctxt, err := GetCiphertextFromMessage(msg)
+	if err != nil {
+		return nil, err
+	}
+	prev := msg.Previous()
+	if prev == nil {
+		return nil, fmt.Errorf("box2: message without previous: %w", ErrInvalid)
+	}
+	return DecryptFor(ctxt, msg.Author(), *prev, d.KeyPair, d.GroupKeys)
+}
@@ -0,0 +1,94 @@
+// SPDX-FileCopyrightText: 2021 The Go-SSB Authors
+//
+// SPDX-License-Identifier: MIT
+
+package box2
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"testing"
+
+	refs "github.com/ssbc/go-ssb-refs"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ssbc/go-ssb"
+)
+
+// box2 ciphertexts by alice (the keypair of seed 0x01..), both with the previous message %CQkJ...
+// The first is a DM for bob (seed 0x02..), the second for the group with the key 0x05...
+const (
+	box2VectorPrev  = "%CQkJCQkJCQkJCQkJCQkJCQkJCQkJCQkJCQkJCQkJCQk=.sha256"
+	box2VectorDM    = "oueBHZJAoa5uvAOTdUaVtQqrwIxIq8kamBB18rfNGF0aiJDI8+Og9fEaYG0lcoXbpPcXkudUTbqOUhjzMSgSlKvXZOzPmC3qcEWmvRoK97mXjxrr2OzXVIMAhR18DiRU6EfidTHfxIK2hPSkEdb915LF"
+	box2VectorGroup = "21xNCuRK+p6jPd/nUHNpClsyDfn08brq2U2BIJ9wKjf7+GPnd+iT+qAWBSenfRj411zXsLdWUe9M7vB/LlQgOnEdvlhvxE4dpT6phUx7xrISaJh1+9tEk8u8tjMXQsOxFqUIu004zIjnsf18KT2+MtAAC+8="
+)
+
+func TestDecryptFor(t *testing.T) {
+	r := require.New(t)
+
+	kp := func(seed byte) ssb.KeyPair {
+		k, err := ssb.NewKeyPair(bytes.NewReader(bytes.Repeat([]byte{seed}, 32)), refs.RefAlgoFeedSSB1)
+		r.NoError(err)
+		return k
+	}
+	alice, bob, carol := kp(1), kp(2), kp(3)
+	groupKey := bytes.Repeat([]byte{5}, 32)
+
+	prev, err := refs.ParseMessageRef(box2VectorPrev)
+	r.NoError(err)
+	dm, err := base64.StdEncoding.DecodeString(box2VectorDM)
+	r.NoError(err)
+	group, err := base64.StdEncoding.DecodeString(box2VectorGroup)
+	r.NoError(err)
+
+	// bob reads the DM, with or without group keys
+	plain, err := DecryptFor(dm, alice.ID(), prev, bob, nil)
+	r.NoError(err)
+	r.Equal(`{"type":"post","text":"hello bob"}`, string(plain))
+	plain, err = DecryptFor(dm, alice.ID(), prev, bob, [][]byte{groupKey})
+	r.NoError(err)
+	r.Equal(`{"type":"post","text":"hello bob"}`, string(plain))
+
+	// carol only reads the group message
+	plain, err = DecryptFor(group, alice.ID(), prev, carol, [][]byte{bytes.Repeat([]byte{6}, 32), groupKey})
+	r.NoError(err)
+	r.Equal(`{"type":"post","text":"hello group"}`, string(plain))
+
+	_, err = DecryptFor(dm, alice.ID(), prev, carol, [][]byte{groupKey})
+	r.True(errors.Is(err, ErrCouldNotDecrypt), "unexpected error: %v", err)
+	_, err = DecryptFor(group, alice.ID(), prev, bob, nil)
+	r.True(errors.Is(err, ErrCouldNotDecrypt), "unexpected error: %v", err)
+
+	// the keys are bound to the author and the previous message
+	_, err = DecryptFor(group, bob.ID(), prev, carol, [][]byte{groupKey})
+	r.True(errors.Is(err, ErrCouldNotDecrypt), "unexpected error: %v", err)
+
+	_, err = DecryptFor([]byte("short"), alice.ID(), prev, bob, nil)
+	r.True(errors.Is(err, ErrInvalid), "unexpected error: %v", err)
+
+	// through the content dispatcher the group message is decoded by its plaintext type
+	msg := &box2Msg{author: alice.ID(), prev: &prev, content: []byte(`"` + box2VectorGroup + `.box2"`)}
+
+	dc, err := ssb.DecodeContent(msg, Decrypter{KeyPair: carol, GroupKeys: [][]byte{groupKey}})
+	r.NoError(err)
+	r.Equal(ssb.ContentPrivate, dc.Kind)
+	r.Equal("post", dc.Type)
+
+	dc, err = ssb.DecodeContent(msg, Decrypter{KeyPair: bob})
+	r.NoError(err)
+	r.Equal(ssb.ContentUnreadable, dc.Kind)
+}
+
+type box2Msg struct {
+	refs.Message
+
+	author  refs.FeedRef
+	prev    *refs.MessageRef
+	content []byte
+}
+
+func (msg *box2Msg) Key() refs.MessageRef       { return refs.MessageRef{} }
+func (msg *box2Msg) Author() refs.FeedRef       { return msg.author }
+func (msg *box2Msg) Previous() *refs.MessageRef { return msg.prev }
+func (msg *box2Msg) ContentBytes() []byte       { return msg.content }
@@ -0,0 +1,80 @@
+// SPDX-FileCopyrightText: 2021 The Go-SSB Authors
+//
+// SPDX-License-Identifier: MIT
+
+package box2
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"fmt"
+	"sort"
+
+	"golang.org/x/crypto/curve25519"
+	"golang.org/x/crypto/hkdf"
+
+	refs "github.com/ssbc/go-ssb-refs"
+	"github.com/ssbc/go-ssb-refs/tfk"
+	"github.com/ssbc/go-ssb/internal/extra25519"
+	"github.com/ssbc/go-ssb/internal/slp"
+)
+
+var (
+	dmSalt        = []byte{0x82, 0x84, 0xdc, 0x3, 0x87, 0x86, 0x4d, 0x44, 0x98, 0x1a, 0xa1, 0x4c, 0x66, 0xc4, 0xaf, 0xb7, 0xab, 0xd6, 0xe8, 0xdd, 0x14, 0xad, 0xb9, 0xdf, 0x2d, 0xd8, 0xb9, 0xe, 0x9f, 0xb9, 0xa, 0xb0}
+	dmInfoContext = []byte("envelope-ssb-dm-v1/key")
+)
+
+// DeriveDMKey derives the key for 1:1 messages between me, with the secret key mySecret, and other.
+// Both sides derive the same key. It is used with the keys.SchemeDiffieStyleConvertedED25519 scheme.
+func DeriveDMKey(me refs.FeedRef, mySecret ed25519.PrivateKey, other refs.FeedRef) ([]byte, error) {
+	// construct the key that should/can open the header sbox between me and other
+	var (
+		keyInput      [32]byte // the recipients sbox secret
+		otherCurvePub [32]byte // recpt' pub in curve space
+		myCurveSec    [32]byte
+		myCurvePub    [32]byte
+	)
+
+	// for key derivation
+	extra25519.PublicKeyToCurve25519(&myCurvePub, me.PubKey())
+
+	// shared key input
+	extra25519.PrivateKeyToCurve25519(&myCurveSec, mySecret)
+	extra25519.PublicKeyToCurve25519(&otherCurvePub, other.PubKey())
+	curve25519.ScalarMult(&keyInput, &myCurveSec, &otherCurvePub)
+
+	// hashed key derivation info preperation
+	tfkOther, err := tfk.Encode(other)
+	if err != nil {
+		return nil, err
+	}
+
+	tfkMy, err := tfk.Encode(me)
+	if err != nil {
+		return nil, err
+	}
+
+	// PSEUDO TFK
+	// TODO: add proper type 3 for these curve keys
+	bs := [][]byte{
+		append(append([]byte{03, 00}, myCurvePub[:]...), tfkMy...),
+		append(append([]byte{03, 00}, otherCurvePub[:]...), tfkOther...),
+	}
+	sort.Slice(bs, func(i, j int) bool { return bytes.Compare(bs[i], bs[j]) == -1 })
+
+	slpInfo, err := slp.Encode(nil, dmInfoContext, bs[0], bs[1])
+	if err != nil {
+		return nil, err
+	}
+
+	messageShared := make([]byte, KeySize)
+	n, err := hkdf.New(sha256.New, keyInput[:], dmSalt, slpInfo).Read(messageShared)
+	if err != nil {
+		return nil, err
+	}
+	if n != KeySize {
+		return nil, fmt.Errorf("box2: expected 32bytes from hkdf, got %d", n)
+	}
+	return messageShared, nil
+}
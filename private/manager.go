@@ -8,25 +8,18 @@ import (
 	"bytes"
 	"context"
 	"crypto/rand"
-	"crypto/sha256"
 	"encoding/base64"
 	"errors"
 	"fmt"
 	"io"
-	"sort"
 
 	"github.com/ssbc/go-luigi"
 	"github.com/ssbc/go-luigi/mfr"
 	"github.com/ssbc/margaret"
 	"github.com/ssbc/margaret/multilog"
-	"golang.org/x/crypto/curve25519"
-	"golang.org/x/crypto/hkdf"
 
 	"github.com/ssbc/go-ssb"
 	refs "github.com/ssbc/go-ssb-refs"
-	"github.com/ssbc/go-ssb-refs/tfk"
-	"github.com/ssbc/go-ssb/internal/extra25519"
-	"github.com/ssbc/go-ssb/internal/slp"
 	"github.com/ssbc/go-ssb/private/box"
 	"github.com/ssbc/go-ssb/private/box2"
 	"github.com/ssbc/go-ssb/private/keys"
@@ -46,6 +39,8 @@ type Manager struct {
 	rand   io.Reader
 }
 
+var _ ssb.MessageDecrypter = (*Manager)(nil)
+
 // NewManager creates a new Manager
 func NewManager(author ssb.KeyPair, publishLog ssb.Publisher, km *keys.Store, rxlog margaret.Log, getter ssb.Getter, tangles multilog.MultiLog) *Manager {
 	return &Manager{
@@ -62,11 +57,6 @@ func NewManager(author ssb.KeyPair, publishLog ssb.Publisher, km *keys.Store, rx
 	}
 }
 
-var (
-	dmSalt      = []byte{0x82, 0x84, 0xdc, 0x3, 0x87, 0x86, 0x4d, 0x44, 0x98, 0x1a, 0xa1, 0x4c, 0x66, 0xc4, 0xaf, 0xb7, 0xab, 0xd6, 0xe8, 0xdd, 0x14, 0xad, 0xb9, 0xdf, 0x2d, 0xd8, 0xb9, 0xe, 0x9f, 0xb9, 0xa, 0xb0}
-	infoContext = []byte("envelope-ssb-dm-v1/key")
-)
-
 // GetOrDeriveKeyFor derives an encryption key for 1:1 private messages with an other feed.
 func (mgr *Manager) GetOrDeriveKeyFor(other refs.FeedRef) (keys.Recipients, error) {
 	ourID := keys.ID(sortAndConcat(mgr.author.ID().PubKey(), other.PubKey()))
@@ -82,55 +72,11 @@ func (mgr *Manager) GetOrDeriveKeyFor(other refs.FeedRef) (keys.Recipients, erro
 			return nil, fmt.Errorf("ssb/private: key manager error code: %d", kerr.Code)
 		}
 
-		// construct the key that should/can open the header sbox between me and other
-		var (
-			keyInput      [32]byte // the recipients sbox secret
-			otherCurvePub [32]byte // recpt' pub in curve space
-			myCurveSec    [32]byte
-			myCurvePub    [32]byte
-		)
-
-		// for key derivation
-		extra25519.PublicKeyToCurve25519(&myCurvePub, mgr.author.ID().PubKey())
-
-		// shared key input
-		extra25519.PrivateKeyToCurve25519(&myCurveSec, mgr.author.Secret())
-		extra25519.PublicKeyToCurve25519(&otherCurvePub, other.PubKey())
-		curve25519.ScalarMult(&keyInput, &myCurveSec, &otherCurvePub)
-
-		// hashed key derivation info preperation
-		tfkOther, err := tfk.Encode(other)
+		messageShared, err := box2.DeriveDMKey(mgr.author.ID(), mgr.author.Secret(), other)
 		if err != nil {
 			return nil, err
 		}
 
-		tfkMy, err := tfk.Encode(mgr.author.ID())
-		if err != nil {
-			return nil, err
-		}
-
-		var messageShared = make([]byte, 32)
-
-		var bs = bytesSlice{
-			// PSEUDO TFK
-			// TODO: add proper type 3 for these curve keys
-			append(append([]byte{03, 00}, myCurvePub[:]...), tfkMy...),
-			append(append([]byte{03, 00}, otherCurvePub[:]...), tfkOther...),
-		}
-		sort.Sort(bs)
-
-		slpInfo, err := slp.Encode(nil, infoContext, bs[0], bs[1])
-		if err != nil {
-			return nil, err
-		}
-		n, err := hkdf.New(sha256.New, keyInput[:], dmSalt, slpInfo).Read(messageShared)
-		if err != nil {
-			return nil, err
-		}
-		if n != 32 {
-			return nil, fmt.Errorf("box2: expected 32bytes from hkdf, got %d", n)
-		}
-
 		r := keys.Recipient{
 			Scheme: scheme,
 			Key:    messageShared,
@@ -0,0 +1,75 @@
+// SPDX-FileCopyrightText: 2021 The Go-SSB Authors
+//
+// SPDX-License-Identifier: MIT
+
+package repo
+
+import (
+	"errors"
+	"time"
+
+	"github.com/dgraph-io/badger/v3"
+	"go.mindeco.de/log"
+	"go.mindeco.de/log/level"
+)
+
+// WithValueLogGC makes the repository run the value log garbage collection of its badger databases every interval.
+// A value log file is rewritten if at least ratio of it can be discarded, see badger.DB.RunValueLogGC.
+// It applies to the databases opened with OpenBadgerIndex and the ones passed to Interface.StartValueLogGC.
+// By default the value logs are never collected and keep growing.
+func WithValueLogGC(interval time.Duration, ratio float64) Option {
+	return func(r *repo) {
+		r.gcInterval = interval
+		r.gcRatio = ratio
+	}
+}
+
+func (r *repo) StartValueLogGC(db *badger.DB) {
+	if r.gcInterval <= 0 {
+		return
+	}
+
+	r.gcMu.Lock()
+	defer r.gcMu.Unlock()
+	if r.ctx.Err() != nil {
+		return
+	}
+	r.gcRunning.Add(1)
+	go r.runValueLogGC(db)
+}
+
+func (r *repo) runValueLogGC(db *badger.DB) {
+	defer r.gcRunning.Done()
+
+	logger := log.With(r.logger, "event", "value log gc", "db", db.Opts().Dir)
+
+	tick := time.NewTicker(r.gcInterval)
+	defer tick.Stop()
+
+	for {
+		select {
+		case <-r.ctx.Done():
+			return
+		case <-tick.C:
+		}
+
+		if db.IsClosed() {
+			return
+		}
+
+		err := db.RunValueLogGC(r.gcRatio)
+		switch {
+		case err == nil:
+			level.Debug(logger).Log("rewritten", true)
+
+		case errors.Is(err, badger.ErrNoRewrite):
+			level.Debug(logger).Log("rewritten", false)
+
+		case errors.Is(err, badger.ErrRejected):
+			// another collection is running or db is closing
+
+		default:
+			level.Warn(logger).Log("err", err)
+		}
+	}
+}
@@ -0,0 +1,75 @@
+// SPDX-FileCopyrightText: 2021 The Go-SSB Authors
+//
+// SPDX-License-Identifier: MIT
+
+package repo_test
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.mindeco.de/log"
+
+	"github.com/ssbc/go-ssb/internal/leakcheck"
+	"github.com/ssbc/go-ssb/repo"
+)
+
+func TestValueLogGC(t *testing.T) {
+	defer leakcheck.Check(t)
+	r := require.New(t)
+
+	var runs, warnings int64
+	countRuns := log.LoggerFunc(func(kv ...interface{}) error {
+		for i := 0; i < len(kv)-1; i += 2 {
+			switch kv[i] {
+			case "rewritten":
+				atomic.AddInt64(&runs, 1)
+			case "err":
+				atomic.AddInt64(&warnings, 1)
+			}
+		}
+		return nil
+	})
+
+	rpo := repo.New(t.TempDir(),
+		repo.WithLogger(countRuns),
+		repo.WithValueLogGC(10*time.Millisecond, 0.5),
+	)
+
+	db, err := repo.OpenBadgerDB(rpo.GetPath("gc-test"))
+	r.NoError(err)
+	rpo.StartValueLogGC(db)
+
+	r.Eventually(func() bool { return atomic.LoadInt64(&runs) >= 3 }, 5*time.Second, 10*time.Millisecond)
+
+	// Close waits for the collection to stop
+	r.NoError(rpo.Close())
+	stopped := atomic.LoadInt64(&runs)
+	time.Sleep(50 * time.Millisecond)
+	r.Equal(stopped, atomic.LoadInt64(&runs))
+	r.EqualValues(0, atomic.LoadInt64(&warnings), "no rewrites isn't an error")
+
+	// starting it on a closed repo does nothing
+	rpo.StartValueLogGC(db)
+
+	r.NoError(db.Close())
+}
+
+func TestValueLogGCStopsWithDB(t *testing.T) {
+	r := require.New(t)
+
+	rpo := repo.New(t.TempDir(), repo.WithValueLogGC(10*time.Millisecond, 0.5))
+	defer rpo.Close()
+
+	// checked before the repo is closed, so the collection has to stop because of the closed db
+	defer leakcheck.Check(t)
+
+	db, err := repo.OpenBadgerDB(rpo.GetPath("gc-test"))
+	r.NoError(err)
+	rpo.StartValueLogGC(db)
+
+	time.Sleep(30 * time.Millisecond)
+	r.NoError(db.Close())
+}
@@ -0,0 +1,203 @@
+// SPDX-FileCopyrightText: 2021 The Go-SSB Authors
+//
+// SPDX-License-Identifier: MIT
+
+package repo
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/ssbc/go-luigi"
+	refs "github.com/ssbc/go-ssb-refs"
+	"github.com/ssbc/margaret"
+	"github.com/ssbc/margaret/offset2"
+
+	"github.com/ssbc/go-ssb/message/multimsg"
+)
+
+// Compact rewrites the root log of the repo so that it only contains the messages for which keep returns true.
+// Nulled entries are dropped as well.
+//
+// The new log is written next to the old one, synced to disk and then swapped in by renaming it.
+// Since the sequences of the messages change, all the indexes of the repo (sublogs and indexes) are deleted before the swap so that they are rebuilt on the next start.
+// If Compact is interrupted before the swap, the old log stays in place. If it is interrupted during the swap, OpenLog finishes it.
+//
+// The repo must not be in use while it is compacted.
+func Compact(r Interface, keep func(refs.Message) bool) error {
+	logPath := r.GetPath("log")
+	newPath := r.GetPath("log.compact")
+	oldPath := r.GetPath("log.old")
+
+	// finish or clean up after an earlier interrupted run
+	if err := recoverCompaction(r); err != nil {
+		return fmt.Errorf("compact: %w", err)
+	}
+
+	from, err := OpenLog(r)
+	if err != nil {
+		return fmt.Errorf("compact: failed to open root log: %w", err)
+	}
+
+	err = compactInto(from, newPath, rootCodec(r), keep)
+	if err != nil {
+		from.Close()
+		return fmt.Errorf("compact: %w", err)
+	}
+
+	if err := from.Close(); err != nil {
+		return fmt.Errorf("compact: failed to close root log: %w", err)
+	}
+
+	// the sequences change so all the indexes need to be rebuilt.
+	// They are dropped first, so that no index of the old log is left if the swap is interrupted.
+	for _, idx := range []string{PrefixMultiLog, PrefixIndex} {
+		if err := os.RemoveAll(r.GetPath(idx)); err != nil {
+			return fmt.Errorf("compact: failed to drop %s: %w", idx, err)
+		}
+	}
+
+	// swap in the new log
+	if err := os.Rename(logPath, oldPath); err != nil {
+		return fmt.Errorf("compact: failed to move old log: %w", err)
+	}
+	if err := os.Rename(newPath, logPath); err != nil {
+		return fmt.Errorf("compact: failed to move new log in place: %w", err)
+	}
+	if err := os.RemoveAll(oldPath); err != nil {
+		return fmt.Errorf("compact: failed to remove old log: %w", err)
+	}
+
+	return nil
+}
+
+// recoverCompaction brings the root log back in place if Compact was interrupted.
+// The new log is only moved once it is complete, so if the log is missing but log.compact and log.old are there, the swap is finished.
+// Otherwise the leftovers are removed.
+func recoverCompaction(r Interface) error {
+	logPath := r.GetPath("log")
+	newPath := r.GetPath("log.compact")
+	oldPath := r.GetPath("log.old")
+
+	if _, err := os.Stat(logPath); os.IsNotExist(err) {
+		if _, err := os.Stat(oldPath); err != nil {
+			// no interrupted compaction
+			return nil
+		}
+
+		if _, err := os.Stat(newPath); err == nil {
+			// the swap was interrupted after the old log was moved away
+			if err := os.Rename(newPath, logPath); err != nil {
+				return fmt.Errorf("failed to move new log in place: %w", err)
+			}
+		} else {
+			if err := os.Rename(oldPath, logPath); err != nil {
+				return fmt.Errorf("failed to move old log back in place: %w", err)
+			}
+		}
+	}
+
+	for _, debris := range []string{newPath, oldPath} {
+		if err := os.RemoveAll(debris); err != nil {
+			return fmt.Errorf("failed to remove %s of an interrupted compaction: %w", filepath.Base(debris), err)
+		}
+	}
+	return nil
+}
+
+// compactInto copies the messages of from that should be kept into a new log at newPath, stored with codec, and syncs it to disk.
+func compactInto(from margaret.Log, newPath string, codec margaret.Codec, keep func(refs.Message) bool) error {
+	to, err := offset2.Open(newPath, codec)
+	if err != nil {
+		return fmt.Errorf("failed to create new log: %w", err)
+	}
+	toWrapped := multimsg.NewWrappedLog(to)
+
+	src, err := from.Query()
+	if err != nil {
+		to.Close()
+		return fmt.Errorf("failed to query root log: %w", err)
+	}
+
+	var kept int64
+	snk := luigi.FuncSink(func(ctx context.Context, v interface{}, err error) error {
+		if err != nil {
+			if luigi.IsEOS(err) {
+				return nil
+			}
+			return err
+		}
+
+		if errV, ok := v.(error); ok {
+			if margaret.IsErrNulled(errV) {
+				return nil
+			}
+			return errV
+		}
+
+		msg, ok := v.(refs.Message)
+		if !ok {
+			return fmt.Errorf("unexpected value in log: %T", v)
+		}
+
+		if !keep(msg) {
+			return nil
+		}
+
+		_, err = toWrapped.Append(msg)
+		if err != nil {
+			return fmt.Errorf("failed to append message %d: %w", kept, err)
+		}
+		kept++
+		return nil
+	})
+
+	err = luigi.Pump(context.TODO(), snk, src)
+	if err != nil {
+		to.Close()
+		return fmt.Errorf("failed to copy messages: %w", err)
+	}
+
+	if err := to.Close(); err != nil {
+		return fmt.Errorf("failed to close new log: %w", err)
+	}
+
+	if err := syncDir(newPath); err != nil {
+		return fmt.Errorf("failed to sync new log: %w", err)
+	}
+
+	return nil
+}
+
+// syncDir fsyncs all the files in dir and then dir itself.
+func syncDir(dir string) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+
+	for _, e := range entries {
+		if e.IsDir() {
+			continue
+		}
+		if err := syncPath(filepath.Join(dir, e.Name())); err != nil {
+			return err
+		}
+	}
+
+	return syncPath(dir)
+}
+
+func syncPath(pth string) error {
+	f, err := os.Open(pth)
+	if err != nil {
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
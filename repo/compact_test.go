@@ -0,0 +1,216 @@
+// SPDX-FileCopyrightText: 2021 The Go-SSB Authors
+//
+// SPDX-License-Identifier: MIT
+
+package repo_test
+
+import (
+	"context"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ssbc/go-luigi"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ssbc/go-ssb"
+	refs "github.com/ssbc/go-ssb-refs"
+	"github.com/ssbc/go-ssb/internal/asynctesting"
+	"github.com/ssbc/go-ssb/internal/mutil"
+	"github.com/ssbc/go-ssb/internal/storedrefs"
+	"github.com/ssbc/go-ssb/message"
+	"github.com/ssbc/go-ssb/message/multimsg"
+	"github.com/ssbc/go-ssb/multilogs"
+	"github.com/ssbc/go-ssb/repo"
+)
+
+func TestCompact(t *testing.T) {
+	t.Run("margaret", func(t *testing.T) { testCompact(t) })
+	// the entries have to be written with the codec of the repo
+	t.Run("raw", func(t *testing.T) { testCompact(t, repo.WithCodec(multimsg.RawCodec{})) })
+}
+
+func testCompact(t *testing.T, opts ...repo.Option) {
+	r := require.New(t)
+
+	rpath := filepath.Join("testrun", t.Name())
+	os.RemoveAll(rpath)
+	testRepo := repo.New(rpath, opts...)
+
+	staticRand := rand.New(rand.NewSource(42))
+	var authors []ssb.KeyPair
+	for i := 0; i < 3; i++ {
+		kp, err := ssb.NewKeyPair(staticRand, refs.RefAlgoFeedSSB1)
+		r.NoError(err)
+		authors = append(authors, kp)
+	}
+	survivor := authors[1].ID()
+
+	// fill the log with interleaved messages of three feeds
+	func() {
+		ctx, cancel := context.WithCancel(context.TODO())
+		defer cancel()
+
+		rl, err := repo.OpenLog(testRepo)
+		r.NoError(err)
+		defer rl.Close()
+
+		userFeeds, userFeedsSnk, err := repo.OpenStandaloneMultiLog(testRepo, "testUsers", multilogs.UserFeedsUpdate)
+		r.NoError(err)
+		defer userFeeds.Close()
+		usersErrc := asynctesting.ServeLog(ctx, "users", rl, userFeedsSnk, true)
+
+		var publishers []ssb.Publisher
+		for _, kp := range authors {
+			p, err := message.OpenPublishLog(rl, userFeeds, kp)
+			r.NoError(err)
+			publishers = append(publishers, p)
+		}
+
+		for i := 0; i < 4; i++ {
+			for j, p := range publishers {
+				_, err = p.Publish(map[string]interface{}{"type": "test", "i": i})
+				r.NoError(err)
+
+				// the publisher needs the indexed sublog for the next message
+				sublog, err := userFeeds.Get(storedrefs.Feed(authors[j].ID()))
+				r.NoError(err)
+				r.Eventually(func() bool {
+					return sublog.Seq() == int64(i)
+				}, time.Second, 10*time.Millisecond)
+			}
+		}
+		r.EqualValues(11, rl.Seq())
+
+		cancel()
+		r.NoError(<-usersErrc)
+		r.NoError(userFeedsSnk.Close())
+	}()
+
+	err := repo.Compact(testRepo, func(msg refs.Message) bool {
+		return msg.Author().Equal(survivor)
+	})
+	r.NoError(err)
+
+	_, err = os.Stat(testRepo.GetPath(repo.PrefixMultiLog))
+	r.True(os.IsNotExist(err), "sublogs should be dropped")
+
+	ctx, cancel := context.WithCancel(context.TODO())
+	defer cancel()
+
+	rl, err := repo.OpenLog(testRepo)
+	r.NoError(err)
+	defer rl.Close()
+	r.EqualValues(3, rl.Seq(), "only the four messages of the survivor should be left")
+
+	// rebuild the user feeds index and query the survivor through it
+	userFeeds, userFeedsSnk, err := repo.OpenStandaloneMultiLog(testRepo, "testUsers", multilogs.UserFeedsUpdate)
+	r.NoError(err)
+	defer userFeeds.Close()
+	usersErrc := asynctesting.ServeLog(ctx, "users", rl, userFeedsSnk, false)
+	r.NoError(<-usersErrc)
+
+	addrs, err := userFeeds.List()
+	r.NoError(err)
+	r.Len(addrs, 1)
+
+	sublog, err := userFeeds.Get(storedrefs.Feed(survivor))
+	r.NoError(err)
+	r.EqualValues(3, sublog.Seq(), "four messages should be left")
+
+	src, err := mutil.Indirect(rl, sublog).Query()
+	r.NoError(err)
+
+	var want int64 = 1
+	for {
+		v, err := src.Next(ctx)
+		if luigi.IsEOS(err) {
+			break
+		}
+		r.NoError(err)
+
+		msg, ok := v.(refs.Message)
+		r.True(ok, "got %T", v)
+		r.True(msg.Author().Equal(survivor))
+		r.Equal(want, msg.Seq())
+		want++
+	}
+	r.EqualValues(5, want)
+
+	r.NoError(userFeedsSnk.Close())
+}
+
+func TestCompactRecovery(t *testing.T) {
+	r := require.New(t)
+
+	rpath := filepath.Join("testrun", t.Name())
+	os.RemoveAll(rpath)
+	testRepo := repo.New(rpath)
+
+	rl, err := repo.OpenLog(testRepo)
+	r.NoError(err)
+	userFeeds, userFeedsSnk, err := repo.OpenStandaloneMultiLog(testRepo, "testUsers", multilogs.UserFeedsUpdate)
+	r.NoError(err)
+	ctx, cancel := context.WithCancel(context.TODO())
+	usersErrc := asynctesting.ServeLog(ctx, "users", rl, userFeedsSnk, true)
+
+	kp, err := ssb.NewKeyPair(nil, refs.RefAlgoFeedSSB1)
+	r.NoError(err)
+	publisher, err := message.OpenPublishLog(rl, userFeeds, kp)
+	r.NoError(err)
+	sublog, err := userFeeds.Get(storedrefs.Feed(kp.ID()))
+	r.NoError(err)
+	for i := 0; i < 3; i++ {
+		_, err = publisher.Publish(map[string]interface{}{"type": "test", "i": i})
+		r.NoError(err)
+		want := int64(i)
+		r.Eventually(func() bool { return sublog.Seq() == want }, time.Second, 10*time.Millisecond)
+	}
+
+	cancel()
+	r.NoError(<-usersErrc)
+	r.NoError(userFeeds.Close())
+	r.NoError(rl.Close())
+
+	logPath := testRepo.GetPath("log")
+	newPath := testRepo.GetPath("log.compact")
+	oldPath := testRepo.GetPath("log.old")
+
+	// interrupted between the two renames: the complete new log is there, the old one was moved away
+	copyDir(t, logPath, newPath)
+	r.NoError(os.Rename(logPath, oldPath))
+
+	rl, err = repo.OpenLog(testRepo)
+	r.NoError(err)
+	r.EqualValues(2, rl.Seq())
+	r.NoError(rl.Close())
+	for _, debris := range []string{newPath, oldPath} {
+		_, err = os.Stat(debris)
+		r.True(os.IsNotExist(err), "%s is still there", debris)
+	}
+
+	// interrupted before the old log was removed
+	copyDir(t, logPath, oldPath)
+	rl, err = repo.OpenLog(testRepo)
+	r.NoError(err)
+	r.EqualValues(2, rl.Seq())
+	r.NoError(rl.Close())
+	_, err = os.Stat(oldPath)
+	r.True(os.IsNotExist(err), "old log is still there")
+}
+
+// copyDir copies the files in from to a new directory to
+func copyDir(t *testing.T, from, to string) {
+	r := require.New(t)
+	r.NoError(os.MkdirAll(to, 0700))
+
+	entries, err := os.ReadDir(from)
+	r.NoError(err)
+	for _, e := range entries {
+		data, err := os.ReadFile(filepath.Join(from, e.Name()))
+		r.NoError(err)
+		r.NoError(os.WriteFile(filepath.Join(to, e.Name()), data, 0600))
+	}
+}
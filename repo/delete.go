@@ -0,0 +1,143 @@
+// SPDX-FileCopyrightText: 2021 The Go-SSB Authors
+//
+// SPDX-License-Identifier: MIT
+
+package repo
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/ssbc/go-luigi"
+	refs "github.com/ssbc/go-ssb-refs"
+	"github.com/ssbc/margaret"
+
+	"github.com/ssbc/go-ssb"
+	"github.com/ssbc/go-ssb/message/legacy"
+	"github.com/ssbc/go-ssb/message/multimsg"
+)
+
+// TombstoneType is the type of the content that DeleteMessage puts in place of the deleted one.
+const TombstoneType = "tombstone"
+
+// ErrMessageNotFound is returned by DeleteMessage if the root log doesn't have a message with the key.
+var ErrMessageNotFound = errors.New("repo: message not found")
+
+// DeleteMessage replaces the content of the message with key by a tombstone ({"type":"tombstone"}), for content takedowns.
+//
+// The key, sequence, previous and signature of the message are kept,
+// so the feed still links up and new messages can be appended to it, even though the signature of the tombstone doesn't verify anymore.
+// The root log sequence stays the same so lookups by key and the sublogs still resolve to it,
+// while indexes which look at the content (like types, channels or contacts) don't match the tombstone.
+// Content indexes which already picked up the message keep its sequence until they are rebuilt.
+//
+// The tombstone has to fit in the space of the stored message. If the content was shorter than the tombstone,
+// the message is nulled instead, like by the null feature, and the feed has a gap at its sequence.
+//
+// Only legacy messages are supported. The repo must not be in use while a message is deleted,
+// a GetCache which was used with it needs to Invalidate the key.
+func DeleteMessage(r Interface, key refs.MessageRef) error {
+	rootLog, err := OpenLog(r)
+	if err != nil {
+		return fmt.Errorf("delete: failed to open root log: %w", err)
+	}
+	defer rootLog.Close()
+
+	seq, mm, err := findMessage(rootLog, key)
+	if err != nil {
+		return fmt.Errorf("delete: %w", err)
+	}
+
+	stored, ok := mm.AsLegacy()
+	if !ok {
+		return fmt.Errorf("delete: %w", ssb.ErrUnuspportedFormat)
+	}
+
+	// the entry is replaced in place, so the tombstone needs to be encoded like the log stores its entries
+	codec := rootCodec(r)
+	orig, err := codec.Marshal(*mm)
+	if err != nil {
+		return fmt.Errorf("delete: failed to encode stored message: %w", err)
+	}
+
+	var signed legacy.SignedLegacyMessage
+	if err := json.Unmarshal(stored.Raw_, &signed); err != nil {
+		return fmt.Errorf("delete: failed to decode stored message: %w", err)
+	}
+	signed.Content = map[string]interface{}{"type": TombstoneType}
+
+	stored.Raw_, err = legacy.EncodeMessage(signed)
+	if err != nil {
+		return fmt.Errorf("delete: failed to encode tombstone: %w", err)
+	}
+
+	data, err := codec.Marshal(*multimsg.NewMultiMessageFromLegacy(stored))
+	if err != nil {
+		return fmt.Errorf("delete: failed to encode tombstone: %w", err)
+	}
+
+	// the log can only replace an entry with data that isn't longer
+	if len(data) > len(orig) {
+		if err := rootLog.Null(seq); err != nil {
+			return fmt.Errorf("delete: failed to null message: %w", err)
+		}
+		return nil
+	}
+
+	if err := rootLog.Replace(seq, data); err != nil {
+		return fmt.Errorf("delete: failed to replace message: %w", err)
+	}
+	return nil
+}
+
+// findMessage returns the root log sequence and the message with key
+func findMessage(rootLog margaret.Log, key refs.MessageRef) (int64, *multimsg.MultiMessage, error) {
+	src, err := rootLog.Query(margaret.SeqWrap(true))
+	if err != nil {
+		return 0, nil, fmt.Errorf("failed to query root log: %w", err)
+	}
+
+	ctx := context.Background()
+	for {
+		v, err := src.Next(ctx)
+		if err != nil {
+			if luigi.IsEOS(err) {
+				return 0, nil, fmt.Errorf("%w: %s", ErrMessageNotFound, key.ShortSigil())
+			}
+			return 0, nil, err
+		}
+
+		// nulled entries aren't wrapped with their sequence
+		if err, ok := v.(error); ok {
+			if margaret.IsErrNulled(err) {
+				continue
+			}
+			return 0, nil, err
+		}
+
+		sw, ok := v.(margaret.SeqWrapper)
+		if !ok {
+			return 0, nil, fmt.Errorf("unexpected value in root log: %T", v)
+		}
+
+		switch tv := sw.Value().(type) {
+		case error:
+			if margaret.IsErrNulled(tv) {
+				continue
+			}
+			return 0, nil, tv
+		case *multimsg.MultiMessage:
+			if tv.Key().Equal(key) {
+				return sw.Seq(), tv, nil
+			}
+		case multimsg.MultiMessage:
+			if tv.Key().Equal(key) {
+				return sw.Seq(), &tv, nil
+			}
+		default:
+			return 0, nil, fmt.Errorf("unexpected value in root log: %T", tv)
+		}
+	}
+}
@@ -0,0 +1,155 @@
+// SPDX-FileCopyrightText: 2021 The Go-SSB Authors
+//
+// SPDX-License-Identifier: MIT
+
+package repo_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ssbc/margaret"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ssbc/go-ssb"
+	refs "github.com/ssbc/go-ssb-refs"
+	"github.com/ssbc/go-ssb/internal/asynctesting"
+	"github.com/ssbc/go-ssb/internal/mutil"
+	"github.com/ssbc/go-ssb/internal/storedrefs"
+	"github.com/ssbc/go-ssb/message"
+	"github.com/ssbc/go-ssb/message/multimsg"
+	"github.com/ssbc/go-ssb/multilogs"
+	"github.com/ssbc/go-ssb/repo"
+)
+
+func TestDeleteMessage(t *testing.T) {
+	t.Run("margaret", func(t *testing.T) { testDeleteMessage(t) })
+	// the entries have to be written with the codec of the repo
+	t.Run("raw", func(t *testing.T) { testDeleteMessage(t, repo.WithCodec(multimsg.RawCodec{})) })
+}
+
+func testDeleteMessage(t *testing.T, opts ...repo.Option) {
+	r := require.New(t)
+
+	rpath := filepath.Join("testrun", t.Name())
+	os.RemoveAll(rpath)
+	testRepo := repo.New(rpath, opts...)
+
+	kp, err := ssb.NewKeyPair(rand.New(rand.NewSource(42)), refs.RefAlgoFeedSSB1)
+	r.NoError(err)
+
+	// publishes the contents and returns the keys of the messages
+	publish := func(contents ...interface{}) []refs.MessageRef {
+		ctx, cancel := context.WithCancel(context.TODO())
+		defer cancel()
+
+		rl, err := repo.OpenLog(testRepo)
+		r.NoError(err)
+		defer rl.Close()
+
+		userFeeds, userFeedsSnk, err := repo.OpenStandaloneMultiLog(testRepo, "testUsers", multilogs.UserFeedsUpdate)
+		r.NoError(err)
+		defer userFeeds.Close()
+		errc := asynctesting.ServeLog(ctx, "users", rl, userFeedsSnk, true)
+
+		p, err := message.OpenPublishLog(rl, userFeeds, kp)
+		r.NoError(err)
+
+		sublog, err := userFeeds.Get(storedrefs.Feed(kp.ID()))
+		r.NoError(err)
+
+		var keys []refs.MessageRef
+		for _, content := range contents {
+			want := sublog.Seq() + 1
+			msg, err := p.Publish(content)
+			r.NoError(err)
+			keys = append(keys, msg.Key())
+
+			r.Eventually(func() bool {
+				return sublog.Seq() == want
+			}, time.Second, 10*time.Millisecond)
+		}
+
+		cancel()
+		r.NoError(<-errc)
+		r.NoError(userFeedsSnk.Close())
+		return keys
+	}
+
+	post := func(text string) interface{} {
+		return map[string]interface{}{"type": "post", "text": text}
+	}
+
+	keys := publish(post("first"), post("secret plans"), post("third"))
+
+	r.NoError(repo.DeleteMessage(testRepo, keys[1]))
+
+	err = repo.DeleteMessage(testRepo, refs.MessageRef{})
+	r.True(errors.Is(err, repo.ErrMessageNotFound), "got: %v", err)
+
+	// the feed can still be continued after the tombstone
+	keys = append(keys, publish(post("fourth"))...)
+
+	// content shorter than the tombstone can't be replaced, so the message is nulled
+	tiny := publish(map[string]interface{}{"type": "tiny"})
+	r.NoError(repo.DeleteMessage(testRepo, tiny[0]))
+
+	rl, err := repo.OpenLog(testRepo)
+	r.NoError(err)
+	defer rl.Close()
+
+	userFeeds, userFeedsSnk, err := repo.OpenStandaloneMultiLog(testRepo, "testUsers", multilogs.UserFeedsUpdate)
+	r.NoError(err)
+	defer userFeeds.Close()
+	defer userFeedsSnk.Close()
+
+	sublog, err := userFeeds.Get(storedrefs.Feed(kp.ID()))
+	r.NoError(err)
+	feed := mutil.Indirect(rl, sublog)
+
+	r.EqualValues(4, feed.Seq())
+	_, err = feed.Get(4)
+	r.True(margaret.IsErrNulled(err), "got: %v", err)
+	err = repo.DeleteMessage(testRepo, tiny[0])
+	r.True(errors.Is(err, repo.ErrMessageNotFound), "got: %v", err)
+
+	var msgs []refs.Message
+	for i := int64(0); i < feed.Seq(); i++ {
+		v, err := feed.Get(i)
+		r.NoError(err)
+		msg, ok := v.(refs.Message)
+		r.True(ok, "unexpected value: %T", v)
+		msgs = append(msgs, msg)
+	}
+	r.Len(msgs, 4)
+
+	// the chain is intact
+	var prev refs.Message
+	for i, msg := range msgs {
+		r.True(msg.Key().Equal(keys[i]), "key of %d", i)
+		r.NoError(message.ValidateNext(prev, msg), "validate %d", i)
+		prev = msg
+	}
+
+	// but the content is gone
+	deleted := msgs[1]
+	r.EqualValues(2, deleted.Seq())
+	r.NotContains(string(deleted.ValueContentJSON()), "secret plans")
+
+	var content struct {
+		Type string `json:"type"`
+		Text string `json:"text"`
+	}
+	r.NoError(json.Unmarshal(deleted.ContentBytes(), &content))
+	r.Equal(repo.TombstoneType, content.Type)
+	r.Empty(content.Text)
+
+	r.NoError(json.Unmarshal(msgs[2].ContentBytes(), &content))
+	r.Equal("third", content.Text)
+}
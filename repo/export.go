@@ -0,0 +1,123 @@
+// SPDX-FileCopyrightText: 2021 The Go-SSB Authors
+//
+// SPDX-License-Identifier: MIT
+
+package repo
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/ssbc/go-luigi"
+	refs "github.com/ssbc/go-ssb-refs"
+	"github.com/ssbc/margaret"
+)
+
+// ExportFormat selects how Export writes the messages.
+type ExportFormat int
+
+const (
+	// ExportJSONArray writes all messages as one JSON array.
+	ExportJSONArray ExportFormat = iota
+
+	// ExportNDJSON writes one message per line (newline delimited JSON),
+	// so that the output can be processed while it is written, like by jq.
+	ExportNDJSON
+)
+
+// Export writes the messages of src to w in the passed format and returns how many it wrote.
+// Each message is written like createLogStream does with keys set: an object with key, value and timestamp.
+//
+// src can be the stream of Firehose or a query of a log.
+// It may emit refs.Message, margaret.SeqWrapper of them or FirehoseMessage. Nulled messages are skipped.
+// Export returns when src ends or ctx is canceled, which is how a live stream like the firehose is stopped.
+// In both cases a JSON array is closed properly.
+func Export(ctx context.Context, w io.Writer, src luigi.Source, format ExportFormat) (int, error) {
+	// the framing around the messages, ndjson only ends each message with a newline
+	var first, sep, last []byte
+	switch format {
+	case ExportJSONArray:
+		first, sep, last = []byte("["), []byte(","), []byte("]\n")
+	case ExportNDJSON:
+	default:
+		return 0, fmt.Errorf("export: unknown format %d", format)
+	}
+
+	if _, err := w.Write(first); err != nil {
+		return 0, fmt.Errorf("export: failed to write: %w", err)
+	}
+
+	n := 0
+	for {
+		v, err := src.Next(ctx)
+		if err != nil {
+			if luigi.IsEOS(err) || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+				break
+			}
+			return n, fmt.Errorf("export: failed to read message #%d: %w", n, err)
+		}
+
+		body, err := encodeExportMessage(v)
+		if err != nil {
+			return n, fmt.Errorf("export: message #%d: %w", n, err)
+		}
+		if body == nil { // nulled
+			continue
+		}
+
+		if n > 0 {
+			if _, err := w.Write(sep); err != nil {
+				return n, fmt.Errorf("export: failed to write: %w", err)
+			}
+		}
+		if format == ExportNDJSON {
+			body = append(body, '\n')
+		}
+		if _, err := w.Write(body); err != nil {
+			return n, fmt.Errorf("export: failed to write: %w", err)
+		}
+		n++
+	}
+
+	if _, err := w.Write(last); err != nil {
+		return n, fmt.Errorf("export: failed to write: %w", err)
+	}
+	return n, nil
+}
+
+// encodeExportMessage returns the key-value JSON of v, or nil if it is a nulled message.
+// The JSON is compact, so it doesn't contain newlines.
+func encodeExportMessage(v interface{}) ([]byte, error) {
+	if sw, ok := v.(margaret.SeqWrapper); ok {
+		v = sw.Value()
+	}
+
+	var msg refs.Message
+	switch tv := v.(type) {
+	case FirehoseMessage:
+		msg = tv.Message
+	case refs.Message:
+		msg = tv
+	case error:
+		if margaret.IsErrNulled(tv) {
+			return nil, nil
+		}
+		return nil, tv
+	default:
+		return nil, fmt.Errorf("unexpected value %T", v)
+	}
+
+	kv := refs.KeyValueRaw{
+		Key_:      msg.Key(),
+		Value:     *msg.ValueContent(),
+		Timestamp: refs.Millisecs(msg.Received()),
+	}
+	body, err := json.Marshal(kv)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode %s: %w", msg.Key().ShortSigil(), err)
+	}
+	return body, nil
+}
@@ -0,0 +1,124 @@
+// SPDX-FileCopyrightText: 2021 The Go-SSB Authors
+//
+// SPDX-License-Identifier: MIT
+
+package repo_test
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/ssbc/go-ssb"
+	refs "github.com/ssbc/go-ssb-refs"
+	"github.com/ssbc/go-ssb/internal/asynctesting"
+	"github.com/ssbc/go-ssb/internal/storedrefs"
+	"github.com/ssbc/go-ssb/message"
+	"github.com/ssbc/go-ssb/multilogs"
+	"github.com/ssbc/go-ssb/repo"
+	"github.com/ssbc/margaret"
+)
+
+func TestExport(t *testing.T) {
+	r := require.New(t)
+	ctx, cancel := context.WithCancel(context.TODO())
+	defer cancel()
+
+	rpath := filepath.Join("testrun", t.Name())
+	os.RemoveAll(rpath)
+	testRepo := repo.New(rpath)
+
+	rl, err := repo.OpenLog(testRepo)
+	r.NoError(err)
+
+	userFeeds, userFeedsSnk, err := repo.OpenStandaloneMultiLog(testRepo, "testUsers", multilogs.UserFeedsUpdate)
+	r.NoError(err)
+	defer userFeeds.Close()
+	usersErrc := asynctesting.ServeLog(ctx, "users", rl, userFeedsSnk, true)
+
+	kp, err := ssb.NewKeyPair(nil, refs.RefAlgoFeedSSB1)
+	r.NoError(err)
+	publisher, err := message.OpenPublishLog(rl, userFeeds, kp)
+	r.NoError(err)
+	sublog, err := userFeeds.Get(storedrefs.Feed(kp.ID()))
+	r.NoError(err)
+
+	const n = 10
+	for i := 0; i < n; i++ {
+		// a newline in the content must not end up in the output as one
+		_, err = publisher.Publish(map[string]interface{}{"type": "test", "i": i, "text": "two\nlines"})
+		r.NoError(err)
+
+		want := int64(i)
+		r.Eventually(func() bool {
+			return sublog.Seq() == want
+		}, time.Second, 10*time.Millisecond)
+	}
+
+	type exported struct {
+		Key   string `json:"key"`
+		Value struct {
+			Sequence int64 `json:"sequence"`
+			Content  struct {
+				I int `json:"i"`
+			} `json:"content"`
+		} `json:"value"`
+	}
+
+	// ndjson: every line is a message of its own
+	src, err := rl.Query(margaret.SeqWrap(true))
+	r.NoError(err)
+	var buf bytes.Buffer
+	cnt, err := repo.Export(ctx, &buf, src, repo.ExportNDJSON)
+	r.NoError(err)
+	r.Equal(n, cnt)
+
+	scanner := bufio.NewScanner(&buf)
+	lines := 0
+	for scanner.Scan() {
+		var msg exported
+		r.NoError(json.Unmarshal(scanner.Bytes(), &msg), "line %d", lines)
+		r.EqualValues(lines+1, msg.Value.Sequence)
+		r.Equal(lines, msg.Value.Content.I)
+		r.NotEmpty(msg.Key)
+		lines++
+	}
+	r.NoError(scanner.Err())
+	r.Equal(n, lines)
+
+	// the array holds the same messages
+	src, err = rl.Query()
+	r.NoError(err)
+	buf.Reset()
+	cnt, err = repo.Export(ctx, &buf, src, repo.ExportJSONArray)
+	r.NoError(err)
+	r.Equal(n, cnt)
+
+	var all []exported
+	r.NoError(json.Unmarshal(buf.Bytes(), &all))
+	r.Len(all, n)
+	r.EqualValues(n, all[n-1].Value.Sequence)
+
+	// the live firehose is stopped by canceling the context
+	fh, _, err := repo.Firehose(testRepo, repo.ResumeToken{})
+	r.NoError(err)
+	defer fh.Close()
+	fhCtx, fhCancel := context.WithTimeout(ctx, time.Second)
+	defer fhCancel()
+	buf.Reset()
+	cnt, err = repo.Export(fhCtx, &buf, fh, repo.ExportNDJSON)
+	r.NoError(err)
+	r.Equal(n, cnt)
+	r.Equal(n, bytes.Count(buf.Bytes(), []byte("\n")))
+
+	r.NoError(rl.Close())
+	cancel()
+	r.NoError(<-usersErrc)
+}
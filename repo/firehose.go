@@ -0,0 +1,169 @@
+// SPDX-FileCopyrightText: 2021 The Go-SSB Authors
+//
+// SPDX-License-Identifier: MIT
+
+package repo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/ssbc/go-luigi"
+	refs "github.com/ssbc/go-ssb-refs"
+	"github.com/ssbc/margaret"
+)
+
+// ErrResumeTokenAhead is returned by Firehose if the token points past the end of the root log,
+// like a token of a different repo or one from before the log was compacted.
+var ErrResumeTokenAhead = errors.New("repo: resume token is ahead of the root log")
+
+// ResumeToken is a position in the root log, in the order the messages were received.
+// The zero value is the start of the log.
+//
+// It can be persisted with MarshalText (or String) and read back with UnmarshalText (or ParseResumeToken).
+// Since Compact changes the sequences of the root log, tokens from before a compaction can't be used afterwards.
+type ResumeToken struct {
+	next int64 // the root log sequence of the next message
+}
+
+const resumeTokenPrefix = "rx:"
+
+// ParseResumeToken reads a token in the format of ResumeToken.String.
+func ParseResumeToken(s string) (ResumeToken, error) {
+	if !strings.HasPrefix(s, resumeTokenPrefix) {
+		return ResumeToken{}, fmt.Errorf("repo: invalid resume token %q", s)
+	}
+	next, err := strconv.ParseInt(strings.TrimPrefix(s, resumeTokenPrefix), 10, 64)
+	if err != nil || next < 0 {
+		return ResumeToken{}, fmt.Errorf("repo: invalid resume token %q", s)
+	}
+	return ResumeToken{next: next}, nil
+}
+
+func (rt ResumeToken) String() string {
+	return resumeTokenPrefix + strconv.FormatInt(rt.next, 10)
+}
+
+func (rt ResumeToken) MarshalText() ([]byte, error) {
+	return []byte(rt.String()), nil
+}
+
+func (rt *ResumeToken) UnmarshalText(text []byte) error {
+	parsed, err := ParseResumeToken(string(text))
+	if err != nil {
+		return err
+	}
+	*rt = parsed
+	return nil
+}
+
+// FirehoseMessage is what the source of Firehose emits.
+type FirehoseMessage struct {
+	Message refs.Message
+
+	// Token resumes the stream after this message.
+	Token ResumeToken
+}
+
+// Firehose streams all the messages of the root log in the order they were received, starting at since.
+// Once it reached the end, it keeps waiting for new messages until the context passed to Next is canceled.
+// Nulled messages are skipped.
+//
+// Each FirehoseMessage carries the token to resume after it, so a consumer which persists the token
+// of the last message it processed gets every message exactly once across restarts.
+// The returned token is the end of the log when Firehose was called, the messages after it are live.
+//
+// If the root log is open through OpenLog, like by a running bot, the stream uses it so that it sees the new messages.
+// Otherwise the log is opened for the stream and closed when the stream ends or is closed.
+func Firehose(r Interface, since ResumeToken) (FirehoseSource, ResumeToken, error) {
+	var (
+		rootLog margaret.Log
+		release = func() {}
+	)
+	if rp, ok := r.(*repo); ok {
+		rootLog = rp.openedRootLog()
+	}
+	if rootLog == nil {
+		opened, err := OpenLog(r)
+		if err != nil {
+			return nil, ResumeToken{}, fmt.Errorf("firehose: failed to open root log: %w", err)
+		}
+		rootLog = opened
+		release = func() { opened.Close() }
+	}
+
+	end := ResumeToken{next: rootLog.Seq() + 1}
+	if since.next > end.next {
+		release()
+		return nil, ResumeToken{}, fmt.Errorf("firehose: %w (%s > %s)", ErrResumeTokenAhead, since, end)
+	}
+
+	src, err := rootLog.Query(margaret.Gte(since.next), margaret.Live(true), margaret.SeqWrap(true))
+	if err != nil {
+		release()
+		return nil, ResumeToken{}, fmt.Errorf("firehose: failed to query root log: %w", err)
+	}
+
+	return &firehoseSource{src: src, release: release}, end, nil
+}
+
+// FirehoseSource is the stream of Firehose.
+// Close releases the root log if it was opened for the stream. Consumers which stop before the stream ends need to call it.
+type FirehoseSource interface {
+	luigi.Source
+	io.Closer
+}
+
+type firehoseSource struct {
+	src luigi.Source
+
+	releaseOnce sync.Once
+	release     func()
+}
+
+func (fs *firehoseSource) Close() error {
+	fs.releaseOnce.Do(fs.release)
+	return nil
+}
+
+func (fs *firehoseSource) Next(ctx context.Context) (interface{}, error) {
+	for {
+		v, err := fs.src.Next(ctx)
+		if err != nil {
+			fs.releaseOnce.Do(fs.release)
+			return nil, err
+		}
+
+		if err, ok := v.(error); ok {
+			if margaret.IsErrNulled(err) {
+				continue
+			}
+			return nil, fmt.Errorf("firehose: %w", err)
+		}
+
+		sw, ok := v.(margaret.SeqWrapper)
+		if !ok {
+			return nil, fmt.Errorf("firehose: unexpected value in root log: %T", v)
+		}
+
+		switch tv := sw.Value().(type) {
+		case refs.Message:
+			return FirehoseMessage{
+				Message: tv,
+				Token:   ResumeToken{next: sw.Seq() + 1},
+			}, nil
+		case error:
+			if margaret.IsErrNulled(tv) {
+				continue
+			}
+			return nil, fmt.Errorf("firehose: %w", tv)
+		default:
+			return nil, fmt.Errorf("firehose: unexpected value in root log: %T", tv)
+		}
+	}
+}
@@ -0,0 +1,43 @@
+// SPDX-FileCopyrightText: 2021 The Go-SSB Authors
+//
+// SPDX-License-Identifier: MIT
+
+package repo
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFirehoseClose(t *testing.T) {
+	r := require.New(t)
+
+	rpath := filepath.Join("testrun", t.Name())
+	os.RemoveAll(rpath)
+	testRepo := New(rpath).(*repo)
+
+	// without a running bot the stream opens the root log
+	src, _, err := Firehose(testRepo, ResumeToken{})
+	r.NoError(err)
+	r.NotNil(testRepo.openedRootLog())
+
+	// the consumer stops early
+	r.NoError(src.Close())
+	r.Nil(testRepo.openedRootLog(), "the root log wasn't released")
+	r.NoError(src.Close())
+
+	// a log which was open already stays open
+	rl, err := OpenLog(testRepo)
+	r.NoError(err)
+
+	src, _, err = Firehose(testRepo, ResumeToken{})
+	r.NoError(err)
+	r.NoError(src.Close())
+	r.NotNil(testRepo.openedRootLog())
+
+	r.NoError(rl.Close())
+	r.Nil(testRepo.openedRootLog())
+}
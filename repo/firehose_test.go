@@ -0,0 +1,153 @@
+// SPDX-FileCopyrightText: 2021 The Go-SSB Authors
+//
+// SPDX-License-Identifier: MIT
+
+package repo_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ssbc/go-luigi"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ssbc/go-ssb"
+	refs "github.com/ssbc/go-ssb-refs"
+	"github.com/ssbc/go-ssb/internal/asynctesting"
+	"github.com/ssbc/go-ssb/internal/storedrefs"
+	"github.com/ssbc/go-ssb/message"
+	"github.com/ssbc/go-ssb/multilogs"
+	"github.com/ssbc/go-ssb/repo"
+)
+
+func TestFirehose(t *testing.T) {
+	r := require.New(t)
+	ctx, cancel := context.WithCancel(context.TODO())
+	defer cancel()
+
+	rpath := filepath.Join("testrun", t.Name())
+	os.RemoveAll(rpath)
+	testRepo := repo.New(rpath)
+
+	rl, err := repo.OpenLog(testRepo)
+	r.NoError(err)
+
+	userFeeds, userFeedsSnk, err := repo.OpenStandaloneMultiLog(testRepo, "testUsers", multilogs.UserFeedsUpdate)
+	r.NoError(err)
+	defer userFeeds.Close()
+	usersErrc := asynctesting.ServeLog(ctx, "users", rl, userFeedsSnk, true)
+
+	kp, err := ssb.NewKeyPair(nil, refs.RefAlgoFeedSSB1)
+	r.NoError(err)
+	publisher, err := message.OpenPublishLog(rl, userFeeds, kp)
+	r.NoError(err)
+	sublog, err := userFeeds.Get(storedrefs.Feed(kp.ID()))
+	r.NoError(err)
+
+	published := 0
+	publish := func(n int) {
+		for i := 0; i < n; i++ {
+			_, err = publisher.Publish(map[string]interface{}{"type": "test", "i": published})
+			r.NoError(err)
+
+			// the publisher needs the indexed sublog for the next message
+			want := int64(published)
+			r.Eventually(func() bool {
+				return sublog.Seq() == want
+			}, time.Second, 10*time.Millisecond)
+			published++
+		}
+	}
+
+	// reads n messages from src and returns their numbers and the token of the last one
+	read := func(src luigi.Source, n int) ([]int, repo.ResumeToken) {
+		var (
+			got  []int
+			last repo.ResumeToken
+		)
+		for i := 0; i < n; i++ {
+			nextCtx, nextCancel := context.WithTimeout(ctx, 5*time.Second)
+			v, err := src.Next(nextCtx)
+			nextCancel()
+			r.NoError(err)
+
+			fm, ok := v.(repo.FirehoseMessage)
+			r.True(ok, "got %T", v)
+
+			var content struct{ I int }
+			r.NoError(json.Unmarshal(fm.Message.ContentBytes(), &content))
+			got = append(got, content.I)
+			last = fm.Token
+		}
+		return got, last
+	}
+
+	publish(5)
+
+	src, end, err := repo.Firehose(testRepo, repo.ResumeToken{})
+	r.NoError(err)
+	r.Equal("rx:5", end.String())
+
+	got, token := read(src, 3)
+	r.Equal([]int{0, 1, 2}, got)
+
+	// the consumer persists the token and stops
+	persisted, err := token.MarshalText()
+	r.NoError(err)
+
+	publish(2)
+
+	var resumed repo.ResumeToken
+	r.NoError(resumed.UnmarshalText(persisted))
+	src, end, err = repo.Firehose(testRepo, resumed)
+	r.NoError(err)
+	r.Equal("rx:7", end.String())
+
+	got, _ = read(src, 4)
+	r.Equal([]int{3, 4, 5, 6}, got)
+
+	// new messages are streamed live
+	publish(1)
+	got, token = read(src, 1)
+	r.Equal([]int{7}, got)
+	r.Equal("rx:8", token.String())
+
+	// and nothing else
+	nextCtx, nextCancel := context.WithTimeout(ctx, 100*time.Millisecond)
+	_, err = src.Next(nextCtx)
+	nextCancel()
+	r.True(errors.Is(err, context.DeadlineExceeded), "got %v", err)
+
+	// a token past the end of the log
+	ahead, err := repo.ParseResumeToken("rx:100")
+	r.NoError(err)
+	_, _, err = repo.Firehose(testRepo, ahead)
+	r.True(errors.Is(err, repo.ErrResumeTokenAhead), "got %v", err)
+
+	_, err = repo.ParseResumeToken("100")
+	r.Error(err)
+
+	cancel()
+	r.NoError(<-usersErrc)
+	r.NoError(rl.Close())
+
+	// without a running bot the log is opened for the stream
+	src, _, err = repo.Firehose(testRepo, token)
+	r.NoError(err)
+	nextCtx, nextCancel = context.WithTimeout(context.TODO(), 100*time.Millisecond)
+	_, err = src.Next(nextCtx)
+	nextCancel()
+	r.True(errors.Is(err, context.DeadlineExceeded), "got %v", err)
+
+	src, _, err = repo.Firehose(testRepo, resumed)
+	r.NoError(err)
+	ctx = context.TODO()
+	got, _ = read(src, 5)
+	r.Equal([]int{3, 4, 5, 6, 7}, got)
+	r.NoError(src.Close())
+}
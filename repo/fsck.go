@@ -0,0 +1,375 @@
+// SPDX-FileCopyrightText: 2021 The Go-SSB Authors
+//
+// SPDX-License-Identifier: MIT
+
+package repo
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/dgraph-io/badger/v3"
+	"github.com/ssbc/margaret"
+	"github.com/ssbc/margaret/multilog/roaring"
+	multibadger "github.com/ssbc/margaret/multilog/roaring/badger"
+	multifs "github.com/ssbc/margaret/multilog/roaring/fs"
+)
+
+// fsckSampleSize is how many sublogs of a multilog Fsck compares with the root log
+const fsckSampleSize = 100
+
+// IndexReport is what Fsck found out about one index.
+type IndexReport struct {
+	// Name is where the index is stored, like "sublogs/userFeeds" or "indexes/contacts/db:contacts".
+	Name string
+
+	// Seq is the sequence of the root log the index recorded as processed.
+	Seq int64
+
+	// Problems describes the inconsistencies. If there are any, the index should be dropped so that it is rebuilt.
+	Problems []string
+
+	// Dropped is true if the index was dropped because FsckRepair was passed.
+	Dropped bool
+}
+
+// Consistent returns true if no problems were found.
+func (ir IndexReport) Consistent() bool { return len(ir.Problems) == 0 }
+
+func (ir *IndexReport) problem(format string, args ...interface{}) {
+	ir.Problems = append(ir.Problems, fmt.Sprintf(format, args...))
+}
+
+// Report is the result of Fsck.
+type Report struct {
+	// RootSeq is the sequence of the last message in the root log.
+	RootSeq int64
+
+	Indexes []IndexReport
+}
+
+// Inconsistent returns the reports of the indexes with problems.
+func (rep Report) Inconsistent() []IndexReport {
+	var bad []IndexReport
+	for _, ir := range rep.Indexes {
+		if !ir.Consistent() {
+			bad = append(bad, ir)
+		}
+	}
+	return bad
+}
+
+type fsckOptions struct {
+	repair bool
+}
+
+// FsckOption changes how Fsck behaves.
+type FsckOption func(*fsckOptions)
+
+// FsckRepair lets Fsck drop the inconsistent indexes, so that they are rebuilt on the next start.
+func FsckRepair() FsckOption {
+	return func(o *fsckOptions) {
+		o.repair = true
+	}
+}
+
+// Fsck compares the indexes of the repo with its root log, for instance after a crash.
+// It checks that the sequence each index recorded as processed exists in the root log.
+// For the multilogs it also checks the latest entries of some of their sublogs against the recorded sequence and the root log.
+//
+// By default it only reads. With FsckRepair it drops the inconsistent indexes.
+// Like Snapshot, it fails with ErrRepoLocked if the repo is in use.
+func Fsck(r Interface, opts ...FsckOption) (Report, error) {
+	var o fsckOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	lock, err := AcquireLock(r)
+	if err != nil {
+		return Report{}, fmt.Errorf("fsck: %w", err)
+	}
+	defer lock.Close()
+
+	rootLog, err := OpenLog(r)
+	if err != nil {
+		return Report{}, fmt.Errorf("fsck: failed to open root log: %w", err)
+	}
+	defer rootLog.Close()
+
+	fc := fsck{
+		r:       r,
+		opts:    o,
+		rootLog: rootLog,
+		report:  Report{RootSeq: rootLog.Seq()},
+	}
+
+	if err := fc.checkMultiLogs(); err != nil {
+		return fc.report, fmt.Errorf("fsck: %w", err)
+	}
+
+	badgerDBs := []string{filepath.Join(PrefixMultiLog, sharedBadgerName)}
+	idxDirs, err := os.ReadDir(r.GetPath(PrefixIndex))
+	if err != nil && !os.IsNotExist(err) {
+		return fc.report, fmt.Errorf("fsck: failed to list indexes: %w", err)
+	}
+	for _, d := range idxDirs {
+		if d.IsDir() {
+			badgerDBs = append(badgerDBs, filepath.Join(PrefixIndex, d.Name(), "db"))
+		}
+	}
+	for _, db := range badgerDBs {
+		if err := fc.checkBadger(db); err != nil {
+			return fc.report, fmt.Errorf("fsck: %w", err)
+		}
+	}
+
+	return fc.report, nil
+}
+
+type fsck struct {
+	r       Interface
+	opts    fsckOptions
+	rootLog margaret.Log
+	report  Report
+}
+
+// checkMultiLogs checks the standalone multilogs with their own state file
+// and the ones which are updated together by the combined index.
+func (fc *fsck) checkMultiLogs() error {
+	dirs, err := os.ReadDir(fc.r.GetPath(PrefixMultiLog))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("failed to list multilogs: %w", err)
+	}
+
+	var combined []string
+	for _, d := range dirs {
+		if !d.IsDir() || d.Name() == sharedBadgerName {
+			continue
+		}
+
+		statePath := fc.r.GetPath(PrefixMultiLog, d.Name(), "state.json")
+		if _, err := os.Stat(statePath); os.IsNotExist(err) {
+			combined = append(combined, d.Name())
+			continue
+		}
+
+		ir := IndexReport{Name: filepath.Join(PrefixMultiLog, d.Name())}
+		fc.checkStateFile(&ir, statePath, []string{d.Name()})
+		err := fc.finish(ir, func() error {
+			return os.RemoveAll(fc.r.GetPath(PrefixMultiLog, d.Name()))
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	statePath := fc.r.GetPath(PrefixMultiLog, "combined-state.json")
+	if _, err := os.Stat(statePath); os.IsNotExist(err) {
+		return nil
+	}
+	ir := IndexReport{Name: filepath.Join(PrefixMultiLog, "combined")}
+	fc.checkStateFile(&ir, statePath, combined)
+	return fc.finish(ir, func() error {
+		for _, name := range combined {
+			if err := os.RemoveAll(fc.r.GetPath(PrefixMultiLog, name)); err != nil {
+				return err
+			}
+		}
+		return os.Remove(statePath)
+	})
+}
+
+// checkStateFile checks the sequence in a state file written by the multilog sinks and samples the multilogs it covers
+func (fc *fsck) checkStateFile(ir *IndexReport, statePath string, mlogs []string) {
+	ir.Seq = margaret.SeqEmpty
+	data, err := os.ReadFile(statePath)
+	if err != nil {
+		ir.problem("unreadable state file: %s", err)
+		return
+	}
+	// an empty file means nothing was indexed yet
+	if len(bytes.TrimSpace(data)) > 0 {
+		if err := json.Unmarshal(data, &ir.Seq); err != nil {
+			ir.problem("invalid state file: %s", err)
+			return
+		}
+	}
+	fc.checkSeq(ir)
+
+	for _, name := range mlogs {
+		mlog, err := openMultiLogForFsck(fc.r.GetPath(PrefixMultiLog, name))
+		if err != nil {
+			ir.problem("failed to open multilog %s: %s", name, err)
+			continue
+		}
+		fc.sample(ir, name, mlog)
+		if err := mlog.Close(); err != nil {
+			ir.problem("failed to close multilog %s: %s", name, err)
+		}
+	}
+}
+
+func openMultiLogForFsck(dir string) (*roaring.MultiLog, error) {
+	if _, err := os.Stat(filepath.Join(dir, "badger")); err == nil {
+		return multibadger.NewStandalone(filepath.Join(dir, "badger"))
+	}
+	if _, err := os.Stat(filepath.Join(dir, "fs-bitmaps")); err == nil {
+		return multifs.NewMultiLog(filepath.Join(dir, "fs-bitmaps"))
+	}
+	return nil, errors.New("unknown kind of multilog")
+}
+
+// sample compares the latest entries of some sublogs with the recorded sequence and the root log
+func (fc *fsck) sample(ir *IndexReport, name string, mlog *roaring.MultiLog) {
+	addrs, err := mlog.List()
+	if err != nil {
+		ir.problem("failed to list sublogs of %s: %s", name, err)
+		return
+	}
+	sort.Slice(addrs, func(i, j int) bool { return addrs[i] < addrs[j] })
+	if len(addrs) > fsckSampleSize {
+		addrs = addrs[:fsckSampleSize]
+	}
+
+	for _, addr := range addrs {
+		bmap, err := mlog.LoadInternalBitmap(addr)
+		if err != nil {
+			ir.problem("failed to load sublog %q of %s: %s", addr, name, err)
+			continue
+		}
+		if bmap.IsEmpty() {
+			continue
+		}
+		last := int64(bmap.Maximum())
+
+		if last > ir.Seq {
+			ir.problem("sublog %q of %s has entry %d past the recorded sequence", addr, name, last)
+			continue
+		}
+		if last > fc.report.RootSeq {
+			ir.problem("sublog %q of %s has entry %d past the root log", addr, name, last)
+			continue
+		}
+		v, err := fc.rootLog.Get(last)
+		if err == nil {
+			if errV, ok := v.(error); ok {
+				err = errV
+			}
+		}
+		if err != nil && !margaret.IsErrNulled(err) {
+			ir.problem("entry %d of sublog %q of %s can't be read from the root log: %s", last, addr, name, err)
+		}
+	}
+}
+
+// badgerIndexSeqKey is the suffix of the key the badger indexes of margaret store their sequence in
+var badgerIndexSeqKey = []byte("__current_observable")
+
+// checkBadger checks the sequences of the indexes in a badger database.
+// The database can hold several indexes, like the shared one, and each is checked on its own.
+func (fc *fsck) checkBadger(rel string) error {
+	pth := fc.r.GetPath(rel)
+	if _, err := os.Stat(pth); os.IsNotExist(err) {
+		return nil
+	}
+
+	db, err := OpenBadgerDB(pth)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", rel, err)
+	}
+	defer db.Close()
+
+	type seqEntry struct {
+		prefix []byte
+		seq    []byte
+	}
+	var entries []seqEntry
+	err = db.View(func(txn *badger.Txn) error {
+		iter := txn.NewIterator(badger.IteratorOptions{})
+		defer iter.Close()
+		for iter.Rewind(); iter.Valid(); iter.Next() {
+			k := iter.Item().Key()
+
+			var prefix []byte
+			switch {
+			case bytes.HasSuffix(k, badgerIndexSeqKey):
+				prefix = k[:len(k)-len(badgerIndexSeqKey)]
+			case bytes.Equal(k, replStateSeqKey):
+				// the replication state has one sequence for the whole database
+				prefix = []byte{}
+			default:
+				continue
+			}
+
+			v, err := iter.Item().ValueCopy(nil)
+			if err != nil {
+				return err
+			}
+			entries = append(entries, seqEntry{
+				prefix: append([]byte{}, prefix...),
+				seq:    v,
+			})
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", rel, err)
+	}
+
+	for _, e := range entries {
+		ir := IndexReport{Name: rel, Seq: margaret.SeqEmpty}
+		if len(e.prefix) > 0 {
+			ir.Name += ":" + string(e.prefix)
+		}
+
+		if len(e.seq) != 8 {
+			ir.problem("invalid sequence entry (%d bytes)", len(e.seq))
+		} else {
+			ir.Seq = int64(binary.BigEndian.Uint64(e.seq))
+			fc.checkSeq(&ir)
+		}
+
+		prefix := e.prefix
+		err := fc.finish(ir, func() error {
+			if len(prefix) == 0 {
+				return db.DropAll()
+			}
+			return db.DropPrefix(prefix)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (fc *fsck) checkSeq(ir *IndexReport) {
+	if ir.Seq < margaret.SeqEmpty {
+		ir.problem("invalid recorded sequence %d", ir.Seq)
+	} else if ir.Seq > fc.report.RootSeq {
+		ir.problem("recorded sequence %d is ahead of the root log (%d)", ir.Seq, fc.report.RootSeq)
+	}
+}
+
+// finish adds ir to the report and drops the index if it is inconsistent and repairing was asked for
+func (fc *fsck) finish(ir IndexReport, drop func() error) error {
+	if !ir.Consistent() && fc.opts.repair {
+		if err := drop(); err != nil {
+			fc.report.Indexes = append(fc.report.Indexes, ir)
+			return fmt.Errorf("failed to drop %s: %w", ir.Name, err)
+		}
+		ir.Dropped = true
+	}
+	fc.report.Indexes = append(fc.report.Indexes, ir)
+	return nil
+}
@@ -0,0 +1,104 @@
+// SPDX-FileCopyrightText: 2021 The Go-SSB Authors
+//
+// SPDX-License-Identifier: MIT
+
+package repo_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/ssbc/go-ssb"
+	refs "github.com/ssbc/go-ssb-refs"
+	"github.com/ssbc/go-ssb/internal/asynctesting"
+	"github.com/ssbc/go-ssb/internal/storedrefs"
+	"github.com/ssbc/go-ssb/message"
+	"github.com/ssbc/go-ssb/multilogs"
+	"github.com/ssbc/go-ssb/repo"
+)
+
+func TestFsck(t *testing.T) {
+	r := require.New(t)
+	ctx, cancel := context.WithCancel(context.TODO())
+
+	rpath := filepath.Join("testrun", t.Name())
+	os.RemoveAll(rpath)
+	testRepo := repo.New(rpath)
+
+	rl, err := repo.OpenLog(testRepo)
+	r.NoError(err)
+	userFeeds, userFeedsSnk, err := repo.OpenStandaloneMultiLog(testRepo, "testUsers", multilogs.UserFeedsUpdate)
+	r.NoError(err)
+	rs, err := repo.ReplState(testRepo)
+	r.NoError(err)
+	usersErrc := asynctesting.ServeLog(ctx, "users", rl, userFeedsSnk, true)
+	replErrc := asynctesting.ServeLog(ctx, "replstate", rl, rs, true)
+
+	kp, err := ssb.NewKeyPair(nil, refs.RefAlgoFeedSSB1)
+	r.NoError(err)
+	publisher, err := message.OpenPublishLog(rl, userFeeds, kp)
+	r.NoError(err)
+	sublog, err := userFeeds.Get(storedrefs.Feed(kp.ID()))
+	r.NoError(err)
+	for i := 0; i < 5; i++ {
+		_, err = publisher.Publish(refs.NewPost("hello"))
+		r.NoError(err)
+		want := int64(i)
+		r.Eventually(func() bool { return sublog.Seq() == want }, time.Second, 10*time.Millisecond)
+	}
+
+	cancel()
+	r.NoError(<-usersErrc)
+	r.NoError(<-replErrc)
+	r.NoError(userFeeds.Close())
+	r.NoError(rs.Close())
+	r.NoError(rl.Close())
+
+	// a clean repo
+	report, err := repo.Fsck(testRepo)
+	r.NoError(err)
+	r.EqualValues(4, report.RootSeq)
+	r.Len(report.Indexes, 2)
+	r.Empty(report.Inconsistent(), "%+v", report)
+
+	statePath := testRepo.GetPath(repo.PrefixMultiLog, "testUsers", "state.json")
+	checkUsers := func(seq string, problem string, opts ...repo.FsckOption) repo.IndexReport {
+		r.NoError(os.WriteFile(statePath, []byte(seq), 0700))
+
+		report, err := repo.Fsck(testRepo, opts...)
+		r.NoError(err)
+		bad := report.Inconsistent()
+		r.Len(bad, 1, "%+v", report)
+		r.Equal(filepath.Join(repo.PrefixMultiLog, "testUsers"), bad[0].Name)
+		r.Len(bad[0].Problems, 1)
+		r.Contains(bad[0].Problems[0], problem)
+		return bad[0]
+	}
+
+	// the state is ahead of the log
+	ir := checkUsers("1000", "ahead of the root log")
+	r.EqualValues(1000, ir.Seq)
+	r.False(ir.Dropped)
+	_, err = os.Stat(statePath)
+	r.NoError(err, "fsck shouldn't change anything by default")
+
+	// the state is behind the sublogs
+	checkUsers("2", "past the recorded sequence")
+	checkUsers("not a number", "invalid state file")
+
+	// and repair drops it
+	ir = checkUsers("1000", "ahead of the root log", repo.FsckRepair())
+	r.True(ir.Dropped)
+	_, err = os.Stat(testRepo.GetPath(repo.PrefixMultiLog, "testUsers"))
+	r.True(os.IsNotExist(err), "index wasn't dropped: %v", err)
+
+	report, err = repo.Fsck(testRepo)
+	r.NoError(err)
+	r.Len(report.Indexes, 1)
+	r.Empty(report.Inconsistent())
+}
@@ -0,0 +1,119 @@
+// SPDX-FileCopyrightText: 2021 The Go-SSB Authors
+//
+// SPDX-License-Identifier: MIT
+
+package repo
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/ssbc/go-luigi"
+	refs "github.com/ssbc/go-ssb-refs"
+	"github.com/ssbc/go-ssb-refs/tfk"
+	"github.com/ssbc/margaret"
+	"github.com/ssbc/margaret/multilog"
+
+	"github.com/ssbc/go-ssb/internal/mutil"
+	"github.com/ssbc/go-ssb/internal/storedrefs"
+)
+
+// GapRange is a range of sequences that are missing from a stored feed. Both ends are included.
+type GapRange struct {
+	From, To int64
+}
+
+func (gr GapRange) String() string {
+	if gr.From == gr.To {
+		return fmt.Sprint(gr.From)
+	}
+	return fmt.Sprintf("%d-%d", gr.From, gr.To)
+}
+
+// CheckFeed looks at the messages of feed in the user feeds multilog and returns the ranges of sequences
+// that are missing between 1 and the highest stored one.
+// No ranges mean the feed is complete. Nulled messages are counted as missing.
+func CheckFeed(rootLog margaret.Log, userFeeds multilog.MultiLog, feed refs.FeedRef) ([]GapRange, error) {
+	sublog, err := userFeeds.Get(storedrefs.Feed(feed))
+	if err != nil {
+		return nil, fmt.Errorf("checkFeed: failed to open sublog for %s: %w", feed.ShortSigil(), err)
+	}
+
+	src, err := mutil.Indirect(rootLog, sublog).Query()
+	if err != nil {
+		return nil, fmt.Errorf("checkFeed: failed to query %s: %w", feed.ShortSigil(), err)
+	}
+
+	// messages can be stored out of order
+	var seqs []int64
+	ctx := context.TODO()
+	for {
+		v, err := src.Next(ctx)
+		if err != nil {
+			if luigi.IsEOS(err) {
+				break
+			}
+			return nil, fmt.Errorf("checkFeed: failed to get message of %s: %w", feed.ShortSigil(), err)
+		}
+
+		switch tv := v.(type) {
+		case refs.Message:
+			seqs = append(seqs, tv.Seq())
+		case error:
+			if margaret.IsErrNulled(tv) {
+				continue
+			}
+			return nil, fmt.Errorf("checkFeed: failed to get message of %s: %w", feed.ShortSigil(), tv)
+		default:
+			return nil, fmt.Errorf("checkFeed: unexpected value in feed %s: %T", feed.ShortSigil(), v)
+		}
+	}
+	sort.Slice(seqs, func(i, j int) bool { return seqs[i] < seqs[j] })
+
+	var (
+		gaps []GapRange
+		next int64 = 1
+	)
+	for _, seq := range seqs {
+		if seq > next {
+			gaps = append(gaps, GapRange{From: next, To: seq - 1})
+		}
+		if seq >= next {
+			next = seq + 1
+		}
+	}
+	return gaps, nil
+}
+
+// CheckAll runs CheckFeed on all the feeds in userFeeds and returns the gaps of the incomplete ones, keyed by feed reference.
+func CheckAll(rootLog margaret.Log, userFeeds multilog.MultiLog) (map[string][]GapRange, error) {
+	addrs, err := userFeeds.List()
+	if err != nil {
+		return nil, fmt.Errorf("checkAll: failed to list feeds: %w", err)
+	}
+
+	all := make(map[string][]GapRange)
+	for _, addr := range addrs {
+		var sr tfk.Feed
+		err := sr.UnmarshalBinary([]byte(addr))
+		if err != nil {
+			return nil, fmt.Errorf("checkAll: invalid storage ref %q: %w", addr, err)
+		}
+
+		feed, err := sr.Feed()
+		if err != nil {
+			return nil, fmt.Errorf("checkAll: failed to get feed: %w", err)
+		}
+
+		gaps, err := CheckFeed(rootLog, userFeeds, feed)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(gaps) > 0 {
+			all[feed.String()] = gaps
+		}
+	}
+	return all, nil
+}
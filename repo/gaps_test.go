@@ -0,0 +1,121 @@
+// SPDX-FileCopyrightText: 2021 The Go-SSB Authors
+//
+// SPDX-License-Identifier: MIT
+
+package repo_test
+
+import (
+	"bytes"
+	"testing"
+
+	refs "github.com/ssbc/go-ssb-refs"
+	"github.com/ssbc/margaret"
+	"github.com/ssbc/margaret/indexes"
+	"github.com/ssbc/margaret/mem"
+	"github.com/ssbc/margaret/multilog"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ssbc/go-ssb/internal/storedrefs"
+	"github.com/ssbc/go-ssb/repo"
+)
+
+func TestCheckFeed(t *testing.T) {
+	r := require.New(t)
+
+	alice := gapsTestFeed(t, 1)
+	bob := gapsTestFeed(t, 2)
+	claire := gapsTestFeed(t, 3)
+
+	feeds := newGapsFeeds()
+	feeds.append(t, alice, 1, 2, 4, 5)
+	feeds.append(t, bob, 1, 2, 3)
+	// out of order, with a missing start and a longer gap
+	feeds.append(t, claire, 7, 3, 2, 8)
+
+	gaps, err := repo.CheckFeed(feeds.rootLog, feeds, alice)
+	r.NoError(err)
+	r.Equal([]repo.GapRange{{From: 3, To: 3}}, gaps)
+
+	gaps, err = repo.CheckFeed(feeds.rootLog, feeds, bob)
+	r.NoError(err)
+	r.Empty(gaps)
+
+	gaps, err = repo.CheckFeed(feeds.rootLog, feeds, claire)
+	r.NoError(err)
+	r.Equal([]repo.GapRange{{From: 1, To: 1}, {From: 4, To: 6}}, gaps)
+
+	gaps, err = repo.CheckFeed(feeds.rootLog, feeds, gapsTestFeed(t, 4))
+	r.NoError(err)
+	r.Empty(gaps, "unknown feeds have no gaps")
+
+	all, err := repo.CheckAll(feeds.rootLog, feeds)
+	r.NoError(err)
+	r.Equal(map[string][]repo.GapRange{
+		alice.String():  {{From: 3, To: 3}},
+		claire.String(): {{From: 1, To: 1}, {From: 4, To: 6}},
+	}, all)
+}
+
+// gapsFeeds is a minimal user feeds multilog over a root log
+type gapsFeeds struct {
+	multilog.MultiLog
+
+	rootLog margaret.Log
+	sublogs map[indexes.Addr]margaret.Log
+}
+
+func newGapsFeeds() *gapsFeeds {
+	return &gapsFeeds{
+		rootLog: mem.New(),
+		sublogs: make(map[indexes.Addr]margaret.Log),
+	}
+}
+
+func (gf *gapsFeeds) append(t *testing.T, author refs.FeedRef, seqs ...int64) {
+	addr := storedrefs.Feed(author)
+	sublog, has := gf.sublogs[addr]
+	if !has {
+		sublog = mem.New()
+		gf.sublogs[addr] = sublog
+	}
+
+	for _, seq := range seqs {
+		rxSeq, err := gf.rootLog.Append(gapsTestMsg{author: author, seq: seq})
+		require.NoError(t, err)
+		_, err = sublog.Append(rxSeq)
+		require.NoError(t, err)
+	}
+}
+
+func (gf *gapsFeeds) Get(addr indexes.Addr) (margaret.Log, error) {
+	sublog, has := gf.sublogs[addr]
+	if !has {
+		return mem.New(), nil
+	}
+	return sublog, nil
+}
+
+func (gf *gapsFeeds) List() ([]indexes.Addr, error) {
+	var addrs []indexes.Addr
+	for addr := range gf.sublogs {
+		addrs = append(addrs, addr)
+	}
+	return addrs, nil
+}
+
+// gapsTestMsg only has the parts of a message that CheckFeed looks at
+type gapsTestMsg struct {
+	refs.Message
+
+	author refs.FeedRef
+	seq    int64
+}
+
+func (msg gapsTestMsg) Author() refs.FeedRef { return msg.author }
+func (msg gapsTestMsg) Seq() int64           { return msg.seq }
+
+func gapsTestFeed(t *testing.T, i byte) refs.FeedRef {
+	ref, err := refs.NewFeedRefFromBytes(bytes.Repeat([]byte{i}, 32), refs.RefAlgoFeedSSB1)
+	require.NoError(t, err)
+	return ref
+}
@@ -0,0 +1,60 @@
+// SPDX-FileCopyrightText: 2021 The Go-SSB Authors
+//
+// SPDX-License-Identifier: MIT
+
+package repo
+
+import (
+	"context"
+	"fmt"
+
+	refs "github.com/ssbc/go-ssb-refs"
+	"github.com/ssbc/margaret"
+	librarian "github.com/ssbc/margaret/indexes"
+
+	"github.com/ssbc/go-ssb"
+	"github.com/ssbc/go-ssb/internal/storedrefs"
+)
+
+// Get looks up the root log sequence of the message with the passed key in byKey and loads it from rootLog.
+// byKey needs to map storedrefs.Message keys to sequences, like indexes.OpenGet does.
+// If the key isn't in the index, the error wraps ssb.ErrMsgNotFound.
+func Get(rootLog margaret.Log, byKey librarian.Index, key refs.MessageRef) (refs.Message, error) {
+	obs, err := byKey.Get(context.TODO(), storedrefs.Message(key))
+	if err != nil {
+		return nil, fmt.Errorf("repo/get: failed to get seq val from index: %w", err)
+	}
+
+	v, err := obs.Value()
+	if err != nil {
+		return nil, fmt.Errorf("repo/get: failed to get current value from obs: %w", err)
+	}
+
+	var seq int64
+	switch tv := v.(type) {
+	case int64:
+		if tv < 0 {
+			return nil, fmt.Errorf("repo/get: invalid sequence stored in index")
+		}
+		seq = tv
+	case librarian.UnsetValue:
+		return nil, fmt.Errorf("repo/get: %s: %w", key.ShortSigil(), ssb.ErrMsgNotFound)
+	default:
+		return nil, fmt.Errorf("repo/get: wrong sequence type in index: %T", v)
+	}
+
+	storedV, err := rootLog.Get(seq)
+	if err != nil {
+		return nil, fmt.Errorf("repo/get: failed to load message: %w", err)
+	}
+
+	msg, ok := storedV.(refs.Message)
+	if !ok {
+		if err, ok := storedV.(error); ok && margaret.IsErrNulled(err) {
+			return nil, fmt.Errorf("repo/get: %s was nulled: %w", key.ShortSigil(), ssb.ErrMsgNotFound)
+		}
+		return nil, fmt.Errorf("repo/get: wrong message type in storeage: %T", storedV)
+	}
+
+	return msg, nil
+}
@@ -0,0 +1,126 @@
+// SPDX-FileCopyrightText: 2021 The Go-SSB Authors
+//
+// SPDX-License-Identifier: MIT
+
+package repo
+
+import (
+	"container/list"
+	"sync"
+
+	refs "github.com/ssbc/go-ssb-refs"
+	"github.com/ssbc/margaret"
+	librarian "github.com/ssbc/margaret/indexes"
+)
+
+// DefaultGetCacheCapacity is a sensible number of messages for a GetCache, like the ones of a few long threads.
+const DefaultGetCacheCapacity = 1024
+
+// GetCache keeps the most recently looked up messages in memory, so that resolving the same keys again
+// (like when rendering a thread) doesn't need the by-key index and the root log.
+// It holds at most capacity messages and is safe for concurrent use.
+//
+// Messages which are changed in the root log, like by DeleteMessage or nulling a feed, need to be removed with Invalidate or Purge.
+type GetCache struct {
+	rootLog margaret.Log
+	byKey   librarian.Index
+
+	mu       sync.Mutex
+	capacity int
+	entries  map[string]*list.Element
+	lru      *list.List // the front is the most recently used message
+
+	// generation is advanced by Invalidate and Purge,
+	// so that messages which were read from disk before that aren't cached afterwards
+	generation uint64
+}
+
+// NewGetCache returns a cache in front of Get(rootLog, byKey, key) which holds up to capacity messages.
+// A capacity below one uses DefaultGetCacheCapacity.
+func NewGetCache(rootLog margaret.Log, byKey librarian.Index, capacity int) *GetCache {
+	if capacity < 1 {
+		capacity = DefaultGetCacheCapacity
+	}
+	return &GetCache{
+		rootLog: rootLog,
+		byKey:   byKey,
+
+		capacity: capacity,
+		entries:  make(map[string]*list.Element),
+		lru:      list.New(),
+	}
+}
+
+// Get returns the message with the passed key, from memory if it was looked up before.
+// Errors are returned like by Get and not cached.
+func (c *GetCache) Get(key refs.MessageRef) (refs.Message, error) {
+	k := key.Sigil()
+
+	c.mu.Lock()
+	if el, has := c.entries[k]; has {
+		c.lru.MoveToFront(el)
+		msg := el.Value.(refs.Message)
+		c.mu.Unlock()
+		return msg, nil
+	}
+	generation := c.generation
+	c.mu.Unlock()
+
+	// don't hold the lock while reading from disk
+	msg, err := Get(c.rootLog, c.byKey, key)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.generation != generation {
+		// the message might have been invalidated while it was read
+		return msg, nil
+	}
+
+	if el, has := c.entries[k]; has {
+		// someone else was faster
+		c.lru.MoveToFront(el)
+		return msg, nil
+	}
+
+	c.entries[k] = c.lru.PushFront(msg)
+	for c.lru.Len() > c.capacity {
+		oldest := c.lru.Back()
+		c.lru.Remove(oldest)
+		delete(c.entries, oldest.Value.(refs.Message).Key().Sigil())
+	}
+	return msg, nil
+}
+
+// Invalidate removes the message with key from the cache, so that the next Get loads it again.
+func (c *GetCache) Invalidate(key refs.MessageRef) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.generation++
+	k := key.Sigil()
+	if el, has := c.entries[k]; has {
+		c.lru.Remove(el)
+		delete(c.entries, k)
+	}
+}
+
+// Purge removes all the messages from the cache.
+func (c *GetCache) Purge() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.generation++
+	c.entries = make(map[string]*list.Element)
+	c.lru.Init()
+}
+
+// Len returns the number of cached messages.
+func (c *GetCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.lru.Len()
+}
@@ -0,0 +1,185 @@
+// SPDX-FileCopyrightText: 2021 The Go-SSB Authors
+//
+// SPDX-License-Identifier: MIT
+
+package repo_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/ssbc/go-luigi"
+	refs "github.com/ssbc/go-ssb-refs"
+	"github.com/ssbc/margaret/indexes"
+	"github.com/ssbc/margaret/mem"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ssbc/go-ssb"
+	"github.com/ssbc/go-ssb/internal/storedrefs"
+	"github.com/ssbc/go-ssb/repo"
+)
+
+func TestGetCache(t *testing.T) {
+	r := require.New(t)
+
+	rootLog := mem.New()
+	byKey := &countingByKey{seqs: make(map[indexes.Addr]int64)}
+
+	var keys []refs.MessageRef
+	for i := byte(1); i <= 3; i++ {
+		key, err := refs.NewMessageRefFromBytes(bytes.Repeat([]byte{i}, 32), refs.RefAlgoMessageSSB1)
+		r.NoError(err)
+		keys = append(keys, key)
+
+		seq, err := rootLog.Append(getCacheTestMsg{key: key})
+		r.NoError(err)
+		byKey.seqs[storedrefs.Message(key)] = seq
+	}
+
+	cache := repo.NewGetCache(rootLog, byKey, 2)
+
+	msg, err := cache.Get(keys[0])
+	r.NoError(err)
+	r.True(msg.Key().Equal(keys[0]))
+	r.Equal(1, byKey.count(keys[0]))
+
+	// the second lookup comes from memory
+	msg, err = cache.Get(keys[0])
+	r.NoError(err)
+	r.True(msg.Key().Equal(keys[0]))
+	r.Equal(1, byKey.count(keys[0]))
+
+	// filling the cache evicts the least recently used message
+	_, err = cache.Get(keys[1])
+	r.NoError(err)
+	_, err = cache.Get(keys[0])
+	r.NoError(err)
+	_, err = cache.Get(keys[2])
+	r.NoError(err)
+	r.Equal(2, cache.Len())
+
+	_, err = cache.Get(keys[0])
+	r.NoError(err)
+	r.Equal(1, byKey.count(keys[0]), "still cached")
+	_, err = cache.Get(keys[1])
+	r.NoError(err)
+	r.Equal(2, byKey.count(keys[1]), "evicted")
+
+	// invalidated messages are loaded again
+	cache.Invalidate(keys[1])
+	_, err = cache.Get(keys[1])
+	r.NoError(err)
+	r.Equal(3, byKey.count(keys[1]))
+
+	cache.Purge()
+	r.Equal(0, cache.Len())
+
+	// errors are not cached
+	unknown, err := refs.NewMessageRefFromBytes(bytes.Repeat([]byte{9}, 32), refs.RefAlgoMessageSSB1)
+	r.NoError(err)
+	for i := 1; i <= 2; i++ {
+		_, err = cache.Get(unknown)
+		r.True(errors.Is(err, ssb.ErrMsgNotFound), "got: %v", err)
+		r.Equal(i, byKey.count(unknown))
+	}
+
+	// concurrent lookups
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			key := keys[i%len(keys)]
+			msg, err := cache.Get(key)
+			if err != nil {
+				t.Error(err)
+			} else if !msg.Key().Equal(key) {
+				t.Errorf("wrong message for %s", key.ShortSigil())
+			}
+		}(i)
+	}
+	wg.Wait()
+	r.LessOrEqual(cache.Len(), 2)
+}
+
+func TestGetCacheInvalidateWhileReading(t *testing.T) {
+	r := require.New(t)
+
+	rootLog := mem.New()
+	byKey := &countingByKey{seqs: make(map[indexes.Addr]int64)}
+
+	key, err := refs.NewMessageRefFromBytes(bytes.Repeat([]byte{1}, 32), refs.RefAlgoMessageSSB1)
+	r.NoError(err)
+	seq, err := rootLog.Append(getCacheTestMsg{key: key})
+	r.NoError(err)
+	byKey.seqs[storedrefs.Message(key)] = seq
+
+	cache := repo.NewGetCache(rootLog, byKey, 2)
+
+	// the message is deleted while the first lookup reads it
+	byKey.onGet = func() { cache.Invalidate(key) }
+	msg, err := cache.Get(key)
+	r.NoError(err)
+	r.True(msg.Key().Equal(key))
+	r.Equal(0, cache.Len(), "the message read before the invalidation was cached")
+
+	byKey.onGet = nil
+	_, err = cache.Get(key)
+	r.NoError(err)
+	r.Equal(2, byKey.count(key))
+	r.Equal(1, cache.Len())
+
+	// the same goes for purging
+	cache.Purge()
+	byKey.onGet = cache.Purge
+	_, err = cache.Get(key)
+	r.NoError(err)
+	r.Equal(0, cache.Len())
+}
+
+// countingByKey is a by-key index which counts how often each key is looked up
+type countingByKey struct {
+	seqs map[indexes.Addr]int64
+
+	mu     sync.Mutex
+	counts map[indexes.Addr]int
+
+	// onGet is called for every lookup, if it is set
+	onGet func()
+}
+
+func (idx *countingByKey) Get(_ context.Context, addr indexes.Addr) (luigi.Observable, error) {
+	if idx.onGet != nil {
+		idx.onGet()
+	}
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	if idx.counts == nil {
+		idx.counts = make(map[indexes.Addr]int)
+	}
+	idx.counts[addr]++
+
+	seq, has := idx.seqs[addr]
+	if !has {
+		return luigi.NewObservable(indexes.UnsetValue{Addr: addr}), nil
+	}
+	return luigi.NewObservable(seq), nil
+}
+
+func (idx *countingByKey) count(key refs.MessageRef) int {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	return idx.counts[storedrefs.Message(key)]
+}
+
+// getCacheTestMsg only has the key of a message
+type getCacheTestMsg struct {
+	refs.Message
+
+	key refs.MessageRef
+}
+
+func (msg getCacheTestMsg) Key() refs.MessageRef { return msg.key }
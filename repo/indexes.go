@@ -26,6 +26,10 @@ func OpenIndex(db *badger.DB, name string, f func(librarian.SeqSetterIndex) libr
 type LibrarianIndexCreater func(*badger.DB) (librarian.SeqSetterIndex, librarian.SinkIndex)
 
 func OpenBadgerIndex(r Interface, name string, f LibrarianIndexCreater) (*badger.DB, librarian.SeqSetterIndex, librarian.SinkIndex, error) {
+	if err := finishReindex(r, name); err != nil {
+		return nil, nil, nil, fmt.Errorf("db/idx: failed to finish reindex of %s: %w", name, err)
+	}
+
 	pth := r.GetPath(PrefixIndex, name, "db")
 	err := os.MkdirAll(pth, 0700)
 	if err != nil {
@@ -36,6 +40,7 @@ func OpenBadgerIndex(r Interface, name string, f LibrarianIndexCreater) (*badger
 	if err != nil {
 		return nil, nil, nil, fmt.Errorf("db/idx: badger failed to open: %w", err)
 	}
+	r.StartValueLogGC(db)
 
 	idx, sinkidx := f(db)
 
@@ -5,13 +5,38 @@
 package repo
 
 import (
+	"context"
+
 	"github.com/dgraph-io/badger/v3"
 	librarian "github.com/ssbc/margaret/indexes"
 	"github.com/ssbc/margaret/multilog"
+	"go.mindeco.de/log"
+
+	"github.com/ssbc/go-ssb/metrics"
 )
 
 type Interface interface {
 	GetPath(...string) string
+
+	// Context is canceled by Close. Helpers like ServeIndex, Reindex and the Supervisor stop when it is done.
+	Context() context.Context
+
+	// Logger is used by the helpers of this package to report what they are doing.
+	Logger() log.Logger
+
+	// Metrics is where the helpers of this package report what they are doing, like OpenLog the stored messages.
+	Metrics() metrics.Collector
+
+	// KeyPairSeed is what DefaultKeyPair derives the identity of a fresh repository from. If it is nil, a random one is created.
+	KeyPairSeed() []byte
+
+	// StartValueLogGC runs the value log garbage collection of db in the background, if the repository was created with WithValueLogGC.
+	// It stops when the repository or db is closed.
+	StartValueLogGC(db *badger.DB)
+
+	// Close cancels the context of the repository and waits for its background work, like the value log garbage collection.
+	// It doesn't close the logs and indexes that were opened from it.
+	Close() error
 }
 
 type SimpleIndexMaker interface {
@@ -0,0 +1,121 @@
+// SPDX-FileCopyrightText: 2021 The Go-SSB Authors
+//
+// SPDX-License-Identifier: MIT
+
+package repo
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+)
+
+// ErrRepoLocked is returned by AcquireLock if another process already uses the repo.
+var ErrRepoLocked = errors.New("repo: locked by another process")
+
+// Lock is held by the process which uses a repo.
+type Lock struct {
+	f *os.File
+}
+
+// AcquireLock takes an exclusive lock on the lock file of the repo and writes the PID of this process into it.
+// Each badger database in the repo is opened on its own, so without it a second process could open parts of the repo and corrupt the indexes.
+//
+// The operating system drops the lock when the process exits, so a lock file left behind by a crashed process doesn't block.
+// If another process holds the lock, the error wraps ErrRepoLocked and contains its PID if it could be read.
+func AcquireLock(r Interface) (*Lock, error) {
+	if err := os.MkdirAll(r.GetPath(), 0700); err != nil {
+		return nil, fmt.Errorf("repo: failed to create repo folder: %w", err)
+	}
+	lockPath := r.GetPath("lock")
+
+	for {
+		f, err := os.OpenFile(lockPath, os.O_RDWR|os.O_CREATE, 0600)
+		if err != nil {
+			return nil, fmt.Errorf("repo: failed to open lock file: %w", err)
+		}
+
+		if err := lockFile(f); err != nil {
+			f.Close()
+			if !errors.Is(err, errLockHeld) {
+				return nil, fmt.Errorf("repo: failed to lock %s: %w", lockPath, err)
+			}
+
+			if pid, ok := readLockPID(lockPath); ok {
+				return nil, fmt.Errorf("%w (pid %d)", ErrRepoLocked, pid)
+			}
+			return nil, ErrRepoLocked
+		}
+
+		// the previous holder might have removed the file between our open and lock
+		if !stillLinked(f, lockPath) {
+			unlockFile(f)
+			f.Close()
+			continue
+		}
+
+		if err := writeLockPID(f); err != nil {
+			unlockFile(f)
+			f.Close()
+			return nil, fmt.Errorf("repo: failed to write pid to lock file: %w", err)
+		}
+
+		return &Lock{f: f}, nil
+	}
+}
+
+// Close removes the lock file and releases the lock.
+func (l *Lock) Close() error {
+	// remove it while we still hold the lock, so nobody can lock the old file afterwards
+	rmErr := os.Remove(l.f.Name())
+
+	err := unlockFile(l.f)
+	if cerr := l.f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return fmt.Errorf("repo: failed to release lock: %w", err)
+	}
+
+	if rmErr != nil && !os.IsNotExist(rmErr) {
+		// windows doesn't remove files that are still open
+		if err := os.Remove(l.f.Name()); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("repo: failed to remove lock file: %w", err)
+		}
+	}
+	return nil
+}
+
+func stillLinked(f *os.File, path string) bool {
+	opened, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	current, err := os.Stat(path)
+	if err != nil {
+		return false
+	}
+	return os.SameFile(opened, current)
+}
+
+func writeLockPID(f *os.File) error {
+	if err := f.Truncate(0); err != nil {
+		return err
+	}
+	_, err := f.WriteAt([]byte(strconv.Itoa(os.Getpid())), 0)
+	return err
+}
+
+func readLockPID(path string) (int, bool) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, false
+	}
+	pid, err := strconv.Atoi(string(bytes.TrimSpace(data)))
+	if err != nil || pid <= 0 {
+		return 0, false
+	}
+	return pid, true
+}
@@ -0,0 +1,70 @@
+// SPDX-FileCopyrightText: 2021 The Go-SSB Authors
+//
+// SPDX-License-Identifier: MIT
+
+package repo
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLock(t *testing.T) {
+	r := require.New(t)
+
+	rpath := filepath.Join("testrun", t.Name())
+	os.RemoveAll(rpath)
+
+	repo := New(rpath)
+
+	lock, err := AcquireLock(repo)
+	r.NoError(err)
+
+	// a second open fails, even from the same process
+	_, err = AcquireLock(New(rpath))
+	r.ErrorIs(err, ErrRepoLocked)
+	r.Contains(err.Error(), fmt.Sprintf("pid %d", os.Getpid()))
+
+	r.NoError(lock.Close())
+	r.NoFileExists(repo.GetPath("lock"))
+
+	// closed locks can be taken again
+	lock, err = AcquireLock(repo)
+	r.NoError(err)
+	r.NoError(lock.Close())
+
+	if !t.Failed() {
+		os.RemoveAll(rpath)
+	}
+}
+
+func TestLockStale(t *testing.T) {
+	r := require.New(t)
+
+	rpath := filepath.Join("testrun", t.Name())
+	os.RemoveAll(rpath)
+	r.NoError(os.MkdirAll(rpath, 0700))
+
+	repo := New(rpath)
+
+	// left behind by a process that crashed
+	err := os.WriteFile(repo.GetPath("lock"), []byte("999999"), 0600)
+	r.NoError(err)
+
+	lock, err := AcquireLock(repo)
+	r.NoError(err)
+
+	pid, ok := readLockPID(repo.GetPath("lock"))
+	r.True(ok)
+	r.Equal(os.Getpid(), pid)
+
+	r.NoError(lock.Close())
+
+	if !t.Failed() {
+		os.RemoveAll(rpath)
+	}
+}
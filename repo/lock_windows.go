@@ -0,0 +1,29 @@
+// SPDX-FileCopyrightText: 2021 The Go-SSB Authors
+//
+// SPDX-License-Identifier: MIT
+
+//go:build windows
+// +build windows
+
+package repo
+
+import (
+	"os"
+
+	"golang.org/x/sys/windows"
+)
+
+var errLockHeld = windows.ERROR_LOCK_VIOLATION
+
+// the lock covers a range far after the pid, so that other processes can still read it
+const lockOffset = 1 << 30
+
+func lockFile(f *os.File) error {
+	ol := &windows.Overlapped{Offset: lockOffset}
+	return windows.LockFileEx(windows.Handle(f.Fd()), windows.LOCKFILE_EXCLUSIVE_LOCK|windows.LOCKFILE_FAIL_IMMEDIATELY, 0, 1, 0, ol)
+}
+
+func unlockFile(f *os.File) error {
+	ol := &windows.Overlapped{Offset: lockOffset}
+	return windows.UnlockFileEx(windows.Handle(f.Fd()), 0, 1, 0, ol)
+}
@@ -8,6 +8,8 @@ import (
 	"fmt"
 
 	"github.com/ssbc/go-ssb/message/multimsg"
+	"github.com/ssbc/go-ssb/metrics"
+	"github.com/ssbc/margaret"
 	"github.com/ssbc/margaret/offset2"
 )
 
@@ -18,10 +20,37 @@ func OpenLog(r Interface, path ...string) (multimsg.AlterableLog, error) {
 		path[0] = "logs"
 	}
 
-	// TODO use proper log message type here
-	log, err := offset2.Open(r.GetPath(path...), multimsg.MargaretCodec{})
+	if len(path) == 1 {
+		if err := recoverCompaction(r); err != nil {
+			return nil, fmt.Errorf("failed to recover interrupted compaction: %w", err)
+		}
+	}
+
+	var codec margaret.Codec = multimsg.MargaretCodec{}
+	if len(path) == 1 {
+		codec = rootCodec(r)
+	}
+	log, err := offset2.Open(r.GetPath(path...), codec)
 	if err != nil {
 		return nil, fmt.Errorf("failed to open log: %w", err)
 	}
-	return multimsg.NewWrappedLog(log), nil
+	cl := &countingLog{
+		AlterableLog: multimsg.NewWrappedLog(log),
+		stored:       r.Metrics().Counter(metrics.MessagesStored),
+	}
+
+	// remember the root log while it is open, so that Firehose sees its appends
+	if rp, ok := r.(*repo); ok && len(path) == 1 {
+		rp.setRootLog(cl)
+		cl.closed = func() { rp.clearRootLog(cl) }
+	}
+	return cl, nil
+}
+
+// rootCodec returns the codec the root log of r is stored with, see WithCodec.
+func rootCodec(r Interface) margaret.Codec {
+	if rp, ok := r.(*repo); ok {
+		return rp.codec
+	}
+	return multimsg.MargaretCodec{}
 }
@@ -0,0 +1,73 @@
+// SPDX-FileCopyrightText: 2021 The Go-SSB Authors
+//
+// SPDX-License-Identifier: MIT
+
+package repo_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/ssbc/go-ssb"
+	refs "github.com/ssbc/go-ssb-refs"
+	"github.com/ssbc/go-ssb/internal/storedrefs"
+	"github.com/ssbc/go-ssb/message/legacy"
+	"github.com/ssbc/go-ssb/message/multimsg"
+	"github.com/ssbc/go-ssb/repo"
+)
+
+func TestRawCodec(t *testing.T) {
+	r := require.New(t)
+
+	rpath := filepath.Join("testrun", t.Name())
+	os.RemoveAll(rpath)
+	testRepo := repo.New(rpath, repo.WithCodec(multimsg.RawCodec{}))
+
+	kp, err := ssb.NewKeyPair(nil, refs.RefAlgoFeedSSB1)
+	r.NoError(err)
+
+	var lm legacy.LegacyMessage
+	lm.Hash = "sha256"
+	lm.Author = kp.ID().String()
+	lm.Sequence = 1
+	lm.Timestamp = 1234
+	lm.Content = map[string]interface{}{"type": "test", "text": "préservé  ✓"}
+	key, raw, err := lm.Sign(kp.Secret(), nil)
+	r.NoError(err)
+
+	rl, err := repo.OpenLog(testRepo)
+	r.NoError(err)
+
+	seq, err := rl.Append(&legacy.StoredMessage{
+		Author_:   storedrefs.SerialzedFeed{FeedRef: kp.ID()},
+		Key_:      storedrefs.SerialzedMessage{MessageRef: key},
+		Sequence_: 1,
+		Raw_:      raw,
+	})
+	r.NoError(err)
+	r.NoError(rl.Close())
+
+	// read it back from disk
+	rl, err = repo.OpenLog(testRepo)
+	r.NoError(err)
+	defer rl.Close()
+
+	v, err := rl.Get(seq)
+	r.NoError(err)
+	msg, ok := v.(refs.Message)
+	r.True(ok, "got %T", v)
+
+	r.Equal(raw, []byte(msg.ValueContentJSON()), "not the bytes that were signed")
+	r.True(msg.Key().Equal(key))
+	r.True(msg.Author().Equal(kp.ID()))
+	r.EqualValues(1, msg.Seq())
+	r.Nil(msg.Previous())
+	r.False(msg.Received().IsZero())
+
+	gotKey, _, err := legacy.Verify(msg.ValueContentJSON(), nil)
+	r.NoError(err)
+	r.True(gotKey.Equal(key))
+}
@@ -0,0 +1,83 @@
+// SPDX-FileCopyrightText: 2021 The Go-SSB Authors
+//
+// SPDX-License-Identifier: MIT
+
+package repo
+
+import (
+	"context"
+
+	kitmetrics "github.com/go-kit/kit/metrics"
+	"github.com/ssbc/go-luigi"
+	"github.com/ssbc/margaret"
+
+	"github.com/ssbc/go-ssb/message/multimsg"
+	"github.com/ssbc/go-ssb/metrics"
+)
+
+// countingLog reports the messages that are appended to the root log as metrics.MessagesStored
+type countingLog struct {
+	multimsg.AlterableLog
+
+	stored kitmetrics.Counter
+
+	// closed is called after the log was closed
+	closed func()
+}
+
+func (cl *countingLog) Close() error {
+	err := cl.AlterableLog.Close()
+	if cl.closed != nil {
+		cl.closed()
+	}
+	return err
+}
+
+func (cl *countingLog) Append(v interface{}) (int64, error) {
+	seq, err := cl.AlterableLog.Append(v)
+	if err == nil {
+		cl.stored.Add(1)
+	}
+	return seq, err
+}
+
+// NewIndexLagSink passes the messages from msgs on to snk and reports how far snk is behind msgs as metrics.IndexLag after each one.
+// The messages need to be wrapped with their sequence, like margaret.SeqWrap(true) does.
+func NewIndexLagSink(c metrics.Collector, name string, msgs margaret.Log, snk luigi.Sink) luigi.Sink {
+	return indexLagSink{
+		Sink: snk,
+		msgs: msgs,
+		lag:  c.Gauge(metrics.IndexLag).With("index", name),
+	}
+}
+
+type indexLagSink struct {
+	luigi.Sink
+
+	msgs margaret.Log
+	lag  kitmetrics.Gauge
+}
+
+func (ls indexLagSink) Pour(ctx context.Context, v interface{}) error {
+	if err := ls.Sink.Pour(ctx, v); err != nil {
+		return err
+	}
+	sw, ok := v.(margaret.SeqWrapper)
+	if !ok {
+		return nil
+	}
+	// msgs.Seq() can't be used here since logs pour into their live queries while they are locked.
+	// Their observable is updated after that, so it can be one behind the message.
+	current, err := ls.msgs.Changes().Value()
+	if err != nil {
+		return nil
+	}
+	if latest, ok := current.(int64); ok {
+		lag := latest - sw.Seq()
+		if lag < 0 {
+			lag = 0
+		}
+		ls.lag.Set(float64(lag))
+	}
+	return nil
+}
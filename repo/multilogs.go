@@ -34,9 +34,28 @@ func makeSinkIndex(dbPath string, mlog multilog.MultiLog, fn multilog.Func) (lib
 
 const PrefixMultiLog = "sublogs"
 
+// OpenBadgerError is returned by OpenBadgerDB if the database at Path can't be opened,
+// for instance because another process has it open or it is damaged.
+// The indexes of the repository can be rebuilt from the root log by removing their folder.
+type OpenBadgerError struct {
+	Path string
+	Err  error
+}
+
+func (e OpenBadgerError) Error() string {
+	return fmt.Sprintf("repo: failed to open badger database at %s: %s", e.Path, e.Err)
+}
+
+func (e OpenBadgerError) Unwrap() error { return e.Err }
+
+// OpenBadgerDB opens the badger database at path. If that fails, the error is an OpenBadgerError.
 func OpenBadgerDB(path string) (*badger.DB, error) {
 	opts := badgerOpts(path)
-	return badger.Open(opts)
+	db, err := badger.Open(opts)
+	if err != nil {
+		return nil, OpenBadgerError{Path: path, Err: err}
+	}
+	return db, nil
 }
 
 func OpenStandaloneMultiLog(r Interface, name string, f multilog.Func) (multilog.MultiLog, librarian.SinkIndex, error) {
@@ -0,0 +1,40 @@
+// SPDX-FileCopyrightText: 2021 The Go-SSB Authors
+//
+// SPDX-License-Identifier: MIT
+
+package repo
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestOpenBadgerError(t *testing.T) {
+	r := require.New(t)
+
+	dbPath := filepath.Join("testrun", t.Name(), "db")
+	os.RemoveAll(dbPath)
+
+	db, err := OpenBadgerDB(dbPath)
+	r.NoError(err)
+
+	// the directory is locked while it is open
+	_, err = OpenBadgerDB(dbPath)
+	r.Error(err)
+
+	var openErr OpenBadgerError
+	r.True(errors.As(err, &openErr), "wrong error type: %T", err)
+	r.Equal(dbPath, openErr.Path)
+	r.Error(openErr.Err)
+	r.Contains(err.Error(), dbPath)
+
+	r.NoError(db.Close())
+
+	db, err = OpenBadgerDB(dbPath)
+	r.NoError(err)
+	r.NoError(db.Close())
+}
@@ -0,0 +1,31 @@
+// SPDX-FileCopyrightText: 2021 The Go-SSB Authors
+//
+// SPDX-License-Identifier: MIT
+
+package repo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/ssbc/go-luigi"
+
+	"github.com/ssbc/go-ssb"
+)
+
+// RunPump pours src into snk for the index name, like luigi.Pump. It is meant for the loops which serve an index.
+// The end of src and a canceled context or shutdown are not errors, check ctx.Err() to tell them apart.
+// Other errors are wrapped with the name of the index.
+func RunPump(ctx context.Context, name string, snk luigi.Sink, src luigi.Source) error {
+	err := luigi.Pump(ctx, snk, src)
+
+	var eos luigi.EOS
+	if err == nil ||
+		luigi.IsEOS(err) || errors.As(err, &eos) ||
+		errors.Is(err, context.Canceled) ||
+		errors.Is(err, ssb.ErrShuttingDown) {
+		return nil
+	}
+	return fmt.Errorf("index(%s): %w", name, err)
+}
@@ -0,0 +1,76 @@
+// SPDX-FileCopyrightText: 2021 The Go-SSB Authors
+//
+// SPDX-License-Identifier: MIT
+
+package repo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/ssbc/go-luigi"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ssbc/go-ssb"
+)
+
+// pumpTestSource returns one value and then err
+type pumpTestSource struct {
+	sent bool
+	err  error
+}
+
+func (src *pumpTestSource) Next(ctx context.Context) (interface{}, error) {
+	if !src.sent {
+		src.sent = true
+		return 1, nil
+	}
+	return nil, src.err
+}
+
+func TestRunPump(t *testing.T) {
+	errBroken := errors.New("test: broken index")
+
+	type tcase struct {
+		name    string
+		srcErr  error // after the first value
+		sinkErr error // when pouring the first value
+		wantErr error
+	}
+	tcases := []tcase{
+		{name: "end", srcErr: luigi.EOS{}},
+		{name: "canceled", srcErr: context.Canceled},
+		{name: "canceled wrapped", srcErr: fmt.Errorf("query: %w", context.Canceled)},
+		{name: "shutdown", sinkErr: ssb.ErrShuttingDown},
+		{name: "sink closed", sinkErr: fmt.Errorf("sink: %w", luigi.EOS{})},
+		{name: "source failed", srcErr: errBroken, wantErr: errBroken},
+		{name: "sink failed", sinkErr: errBroken, wantErr: errBroken},
+	}
+
+	for _, tc := range tcases {
+		t.Run(tc.name, func(t *testing.T) {
+			r := require.New(t)
+
+			src := &pumpTestSource{err: tc.srcErr}
+			var poured int
+			snk := luigi.FuncSink(func(ctx context.Context, v interface{}, err error) error {
+				if err != nil {
+					return nil
+				}
+				poured++
+				return tc.sinkErr
+			})
+
+			err := RunPump(context.TODO(), "test", snk, src)
+			r.Equal(1, poured)
+			if tc.wantErr == nil {
+				r.NoError(err)
+				return
+			}
+			r.ErrorIs(err, tc.wantErr)
+			r.Contains(err.Error(), "index(test)")
+		})
+	}
+}
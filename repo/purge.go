@@ -0,0 +1,119 @@
+// SPDX-FileCopyrightText: 2021 The Go-SSB Authors
+//
+// SPDX-License-Identifier: MIT
+
+package repo
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/ssbc/go-luigi"
+	refs "github.com/ssbc/go-ssb-refs"
+	multibadger "github.com/ssbc/margaret/multilog/roaring/badger"
+
+	"github.com/ssbc/go-ssb"
+	"github.com/ssbc/go-ssb/internal/storedrefs"
+)
+
+// the shared badger db and the key prefix of the user feeds multilog, as opened by sbot
+const (
+	sharedBadgerName = "shared-badger"
+	userFeedsPrefix  = "mlog-userFeeds"
+)
+
+// BlockLister returns the feeds which are blocked by from, like (*graph.Graph).BlockedList does.
+type BlockLister interface {
+	BlockedList(from refs.FeedRef) *ssb.StrFeedSet
+}
+
+// PurgeBlocked removes the messages of all the feeds which self blocks in g from the repo.
+// Their entries in the root log are nulled and their sublogs are deleted from the user feeds multilog.
+// Feeds which are only blocked by other feeds are left alone.
+// It returns the number of purged feeds and of nulled messages.
+//
+// Other indexes (like the graph) still reference the nulled messages and should be rebuilt or updated by the caller.
+// The repo must not be in use while it is purged, it fails with ErrRepoLocked if it is.
+func PurgeBlocked(r Interface, self refs.FeedRef, g BlockLister) (feeds int, msgs int, err error) {
+	lock, err := AcquireLock(r)
+	if err != nil {
+		return 0, 0, fmt.Errorf("purge: %w", err)
+	}
+	defer lock.Close()
+
+	blocked, err := g.BlockedList(self).List()
+	if err != nil {
+		return 0, 0, fmt.Errorf("purge: failed to list blocked feeds: %w", err)
+	}
+	if len(blocked) == 0 {
+		return 0, 0, nil
+	}
+
+	rootLog, err := OpenLog(r)
+	if err != nil {
+		return 0, 0, fmt.Errorf("purge: failed to open root log: %w", err)
+	}
+	defer rootLog.Close()
+
+	db, err := OpenBadgerDB(r.GetPath(PrefixMultiLog, sharedBadgerName))
+	if err != nil {
+		return 0, 0, fmt.Errorf("purge: failed to open index db: %w", err)
+	}
+	defer db.Close()
+
+	userFeeds, err := multibadger.NewShared(db, []byte(userFeedsPrefix))
+	if err != nil {
+		return 0, 0, fmt.Errorf("purge: failed to open user feeds: %w", err)
+	}
+	defer userFeeds.Close()
+
+	ctx := context.Background()
+	for _, feed := range blocked {
+		if feed.Equal(self) {
+			continue
+		}
+		feedAddr := storedrefs.Feed(feed)
+
+		sublog, err := userFeeds.Get(feedAddr)
+		if err != nil {
+			return feeds, msgs, fmt.Errorf("purge: failed to open sublog of %s: %w", feed.ShortSigil(), err)
+		}
+
+		src, err := sublog.Query()
+		if err != nil {
+			return feeds, msgs, fmt.Errorf("purge: failed to query sublog of %s: %w", feed.ShortSigil(), err)
+		}
+
+		var n int
+		for {
+			v, err := src.Next(ctx)
+			if err != nil {
+				if luigi.IsEOS(err) {
+					break
+				}
+				return feeds, msgs, err
+			}
+
+			seq, ok := v.(int64)
+			if !ok {
+				return feeds, msgs, fmt.Errorf("purge: not a sequence in sublog of %s: %T", feed.ShortSigil(), v)
+			}
+
+			if err := rootLog.Null(seq); err != nil {
+				return feeds, msgs, fmt.Errorf("purge: failed to null message %d: %w", seq, err)
+			}
+			n++
+		}
+
+		if err := userFeeds.Delete(feedAddr); err != nil {
+			return feeds, msgs, fmt.Errorf("purge: failed to delete sublog of %s: %w", feed.ShortSigil(), err)
+		}
+
+		if n > 0 {
+			feeds++
+			msgs += n
+		}
+	}
+
+	return feeds, msgs, nil
+}
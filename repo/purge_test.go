@@ -0,0 +1,145 @@
+// SPDX-FileCopyrightText: 2021 The Go-SSB Authors
+//
+// SPDX-License-Identifier: MIT
+
+package repo_test
+
+import (
+	"encoding/json"
+	"errors"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+
+	refs "github.com/ssbc/go-ssb-refs"
+	"github.com/ssbc/margaret"
+	multibadger "github.com/ssbc/margaret/multilog/roaring/badger"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ssbc/go-ssb"
+	"github.com/ssbc/go-ssb/graph"
+	"github.com/ssbc/go-ssb/internal/storedrefs"
+	"github.com/ssbc/go-ssb/message"
+	"github.com/ssbc/go-ssb/repo"
+)
+
+func TestPurgeBlocked(t *testing.T) {
+	r := require.New(t)
+
+	rpath := filepath.Join("testrun", t.Name())
+	os.RemoveAll(rpath)
+	testRepo := repo.New(rpath)
+
+	staticRand := rand.New(rand.NewSource(42))
+	var kps []ssb.KeyPair
+	for i := 0; i < 4; i++ {
+		kp, err := ssb.NewKeyPair(staticRand, refs.RefAlgoFeedSSB1)
+		r.NoError(err)
+		kps = append(kps, kp)
+	}
+	var (
+		me      = kps[0].ID()
+		blocked = kps[1].ID()
+		friend  = kps[2].ID()
+		other   = kps[3].ID() // only blocked by friend
+	)
+
+	// the user feeds multilog, where sbot keeps it
+	sharedPath := testRepo.GetPath(repo.PrefixMultiLog, "shared-badger")
+
+	// publish three messages for every feed
+	func() {
+		rl, err := repo.OpenLog(testRepo)
+		r.NoError(err)
+		defer rl.Close()
+
+		db, err := repo.OpenBadgerDB(sharedPath)
+		r.NoError(err)
+		defer db.Close()
+
+		userFeeds, err := multibadger.NewShared(db, []byte("mlog-userFeeds"))
+		r.NoError(err)
+		defer userFeeds.Close()
+
+		for _, kp := range kps {
+			p, err := message.OpenPublishLog(rl, userFeeds, kp)
+			r.NoError(err)
+
+			sublog, err := userFeeds.Get(storedrefs.Feed(kp.ID()))
+			r.NoError(err)
+
+			for i := 0; i < 3; i++ {
+				_, err = p.Publish(map[string]interface{}{"type": "test", "i": i})
+				r.NoError(err)
+
+				// index the message right away
+				_, err = sublog.Append(rl.Seq())
+				r.NoError(err)
+			}
+		}
+		r.EqualValues(11, rl.Seq())
+	}()
+
+	jsGraph := map[string]map[string]int{
+		me.Sigil():     {blocked.Sigil(): -1, friend.Sigil(): 1},
+		friend.Sigil(): {other.Sigil(): -1, blocked.Sigil(): 1},
+	}
+	data, err := json.Marshal(jsGraph)
+	r.NoError(err)
+	g, err := graph.UnmarshalJS(data)
+	r.NoError(err)
+
+	// not while the repo is in use
+	lock, err := repo.AcquireLock(testRepo)
+	r.NoError(err)
+	_, _, err = repo.PurgeBlocked(testRepo, me, g)
+	r.True(errors.Is(err, repo.ErrRepoLocked), "got: %v", err)
+	r.NoError(lock.Close())
+
+	feeds, msgs, err := repo.PurgeBlocked(testRepo, me, g)
+	r.NoError(err)
+	r.Equal(1, feeds)
+	r.Equal(3, msgs)
+
+	rl, err := repo.OpenLog(testRepo)
+	r.NoError(err)
+
+	db, err := repo.OpenBadgerDB(sharedPath)
+	r.NoError(err)
+
+	userFeeds, err := multibadger.NewShared(db, []byte("mlog-userFeeds"))
+	r.NoError(err)
+
+	addrs, err := userFeeds.List()
+	r.NoError(err)
+	r.Len(addrs, 3)
+	r.NotContains(addrs, storedrefs.Feed(blocked))
+	for _, remaining := range []refs.FeedRef{me, friend, other} {
+		r.Contains(addrs, storedrefs.Feed(remaining))
+	}
+
+	// the messages of the blocked feed are nulled, the rest are untouched
+	for seq := int64(0); seq <= rl.Seq(); seq++ {
+		v, err := rl.Get(seq)
+		if seq >= 3 && seq < 6 {
+			r.True(margaret.IsErrNulled(err), "expected %d to be nulled: %v", seq, err)
+			continue
+		}
+		r.NoError(err)
+
+		msg, ok := v.(refs.Message)
+		r.True(ok, "unexpected value at %d: %T", seq, v)
+		r.False(msg.Author().Equal(blocked))
+	}
+
+	// purging again doesn't find anything new
+	r.NoError(userFeeds.Close())
+	r.NoError(db.Close())
+	r.NoError(rl.Close())
+
+	feeds, msgs, err = repo.PurgeBlocked(testRepo, me, g)
+	r.NoError(err)
+	r.Equal(0, feeds)
+	r.Equal(0, msgs)
+}
@@ -0,0 +1,152 @@
+// SPDX-FileCopyrightText: 2021 The Go-SSB Authors
+//
+// SPDX-License-Identifier: MIT
+
+package repo
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/ssbc/go-luigi"
+	"github.com/ssbc/margaret"
+)
+
+// Reindex builds the index name from scratch over the whole root log, with the index created by f.
+// It is useful to fill a newly added index from the messages that are already stored.
+//
+// The index is built under a temporary name next to the indexes and only moved in place once all the messages are processed.
+// If it fails or the context of the repo is canceled before that, the temporary index is removed and an existing index of that name is left as it was.
+// If the process stops while the finished index is moved in place, the next Reindex or OpenBadgerIndex of it finishes the move.
+// progress is called after every processed message with the number of processed messages and the number of messages to process.
+// It can be nil.
+//
+// The root log is only processed up to its end when Reindex is called.
+// Messages appended later are picked up as usual by ServeIndex, which continues after the sequence the new index stored.
+// The index must not be open while Reindex runs, since it is replaced on disk.
+func Reindex(r Interface, name string, f LibrarianIndexCreater, progress func(cur, total int64)) error {
+	newPath := r.GetPath(PrefixIndex, name+".reindex")
+
+	// a half-built index of an earlier run is removed, a finished one is moved in place
+	if err := os.RemoveAll(newPath); err != nil {
+		return fmt.Errorf("reindex(%s): failed to remove stale index: %w", name, err)
+	}
+	if err := finishReindex(r, name); err != nil {
+		return fmt.Errorf("reindex(%s): %w", name, err)
+	}
+
+	var rootLog margaret.Log
+	if rp, ok := r.(*repo); ok {
+		rootLog = rp.openedRootLog()
+	}
+	if rootLog == nil {
+		opened, err := OpenLog(r)
+		if err != nil {
+			return fmt.Errorf("reindex(%s): failed to open root log: %w", name, err)
+		}
+		defer opened.Close()
+		rootLog = opened
+	}
+
+	if err := reindexInto(r.Context(), name, rootLog, newPath, f, progress); err != nil {
+		os.RemoveAll(newPath)
+		return fmt.Errorf("reindex(%s): %w", name, err)
+	}
+
+	// from here on the new index is complete and replaces the existing one, even if the swap is interrupted
+	if err := os.Rename(newPath, r.GetPath(PrefixIndex, name+".ready")); err != nil {
+		os.RemoveAll(newPath)
+		return fmt.Errorf("reindex(%s): failed to mark new index as ready: %w", name, err)
+	}
+	if err := finishReindex(r, name); err != nil {
+		return fmt.Errorf("reindex(%s): %w", name, err)
+	}
+	return nil
+}
+
+// finishReindex moves a completely built index of Reindex in place of the index name and removes the old one.
+// It does nothing if there is no such index.
+func finishReindex(r Interface, name string) error {
+	idxPath := r.GetPath(PrefixIndex, name)
+	readyPath := r.GetPath(PrefixIndex, name+".ready")
+	oldPath := r.GetPath(PrefixIndex, name+".old")
+
+	if _, err := os.Stat(readyPath); err == nil {
+		// the old index of an interrupted swap isn't needed anymore
+		if err := os.RemoveAll(oldPath); err != nil {
+			return fmt.Errorf("failed to remove old index: %w", err)
+		}
+		if _, err := os.Stat(idxPath); err == nil {
+			if err := os.Rename(idxPath, oldPath); err != nil {
+				return fmt.Errorf("failed to move old index: %w", err)
+			}
+		}
+		if err := os.Rename(readyPath, idxPath); err != nil {
+			return fmt.Errorf("failed to move new index in place: %w", err)
+		}
+	}
+
+	if err := os.RemoveAll(oldPath); err != nil {
+		return fmt.Errorf("failed to remove old index: %w", err)
+	}
+	return nil
+}
+
+// reindexInto pours the messages of rootLog, up to its current end, into a new index at newPath
+func reindexInto(ctx context.Context, name string, rootLog margaret.Log, newPath string, f LibrarianIndexCreater, progress func(cur, total int64)) error {
+	if err := os.MkdirAll(newPath, 0700); err != nil {
+		return fmt.Errorf("failed to make index directory: %w", err)
+	}
+	db, err := OpenBadgerDB(filepath.Join(newPath, "db"))
+	if err != nil {
+		return fmt.Errorf("failed to open new index: %w", err)
+	}
+	_, snk := f(db)
+
+	total := rootLog.Seq() + 1
+	src, err := rootLog.Query(margaret.SeqWrap(true), margaret.Limit(int(total)))
+	if err != nil {
+		snk.Close()
+		db.Close()
+		return fmt.Errorf("failed to query root log: %w", err)
+	}
+
+	var cur int64
+	counter := luigi.FuncSink(func(ctx context.Context, v interface{}, err error) error {
+		if err != nil {
+			if luigi.IsEOS(err) {
+				return nil
+			}
+			return err
+		}
+		if err := snk.Pour(ctx, v); err != nil {
+			return err
+		}
+		cur++
+		if progress != nil {
+			progress(cur, total)
+		}
+		return nil
+	})
+
+	err = RunPump(ctx, name, counter, src)
+	if err == nil {
+		err = ctx.Err()
+	}
+	if err != nil {
+		snk.Close()
+		db.Close()
+		return fmt.Errorf("failed to process messages: %w", err)
+	}
+
+	if err := snk.Close(); err != nil {
+		db.Close()
+		return fmt.Errorf("failed to flush new index: %w", err)
+	}
+	if err := db.Close(); err != nil {
+		return fmt.Errorf("failed to close new index: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,159 @@
+// SPDX-FileCopyrightText: 2021 The Go-SSB Authors
+//
+// SPDX-License-Identifier: MIT
+
+package repo_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/dgraph-io/badger/v3"
+	librarian "github.com/ssbc/margaret/indexes"
+	libbadger "github.com/ssbc/margaret/indexes/badger"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ssbc/go-ssb"
+	refs "github.com/ssbc/go-ssb-refs"
+	"github.com/ssbc/go-ssb/internal/asynctesting"
+	"github.com/ssbc/go-ssb/internal/storedrefs"
+	"github.com/ssbc/go-ssb/message"
+	"github.com/ssbc/go-ssb/multilogs"
+	"github.com/ssbc/go-ssb/repo"
+)
+
+// typesIndex stores the content type of every message by its sequence.
+// It fails on the message with the sequence failAt, if that isn't negative.
+func typesIndex(failAt int64) repo.LibrarianIndexCreater {
+	return func(db *badger.DB) (librarian.SeqSetterIndex, librarian.SinkIndex) {
+		idx := libbadger.NewIndexWithKeyPrefix(db, "", []byte("types"))
+		return idx, librarian.NewSinkIndex(func(ctx context.Context, seq int64, val interface{}, idx librarian.SetterIndex) error {
+			if seq == failAt {
+				return errors.New("test: index failed")
+			}
+			msg, ok := val.(refs.Message)
+			if !ok {
+				return fmt.Errorf("unexpected value %T", val)
+			}
+			tipe, _ := ssb.ContentType(msg.ContentBytes())
+			return idx.Set(ctx, librarian.Addr(fmt.Sprint(seq)), tipe)
+		}, idx)
+	}
+}
+
+func TestReindex(t *testing.T) {
+	r := require.New(t)
+
+	rpath := filepath.Join("testrun", t.Name())
+	os.RemoveAll(rpath)
+	testRepo := repo.New(rpath)
+
+	// seed the log with ten messages of two types
+	func() {
+		ctx, cancel := context.WithCancel(context.TODO())
+		defer cancel()
+
+		rl, err := repo.OpenLog(testRepo)
+		r.NoError(err)
+		defer rl.Close()
+
+		userFeeds, userFeedsSnk, err := repo.OpenStandaloneMultiLog(testRepo, "testUsers", multilogs.UserFeedsUpdate)
+		r.NoError(err)
+		defer userFeeds.Close()
+		usersErrc := asynctesting.ServeLog(ctx, "users", rl, userFeedsSnk, true)
+
+		kp, err := ssb.NewKeyPair(nil, refs.RefAlgoFeedSSB1)
+		r.NoError(err)
+		publisher, err := message.OpenPublishLog(rl, userFeeds, kp)
+		r.NoError(err)
+		sublog, err := userFeeds.Get(storedrefs.Feed(kp.ID()))
+		r.NoError(err)
+
+		for i := 0; i < 10; i++ {
+			tipe := "even"
+			if i%2 == 1 {
+				tipe = "odd"
+			}
+			_, err = publisher.Publish(map[string]interface{}{"type": tipe, "i": i})
+			r.NoError(err)
+
+			// the publisher needs the indexed sublog for the next message
+			want := int64(i)
+			r.Eventually(func() bool {
+				return sublog.Seq() == want
+			}, time.Second, 10*time.Millisecond)
+		}
+
+		cancel()
+		r.NoError(<-usersErrc)
+		r.NoError(userFeedsSnk.Close())
+	}()
+
+	var calls [][2]int64
+	err := repo.Reindex(testRepo, "types", typesIndex(-1), func(cur, total int64) {
+		calls = append(calls, [2]int64{cur, total})
+	})
+	r.NoError(err)
+	r.Len(calls, 10)
+	for i, c := range calls {
+		r.Equal([2]int64{int64(i + 1), 10}, c)
+	}
+
+	checkIndex := func() {
+		db, idx, sink, err := repo.OpenBadgerIndex(testRepo, "types", typesIndex(-1))
+		r.NoError(err)
+		defer db.Close()
+		defer sink.Close()
+
+		seq, err := idx.GetSeq()
+		r.NoError(err)
+		r.EqualValues(9, seq)
+
+		for seq, want := range map[string]string{"0": "even", "7": "odd", "9": "odd"} {
+			obv, err := idx.Get(context.TODO(), librarian.Addr(seq))
+			r.NoError(err)
+			v, err := obv.Value()
+			r.NoError(err)
+			r.Equal(want, v, "seq %s", seq)
+		}
+	}
+	checkIndex()
+
+	// a failed rebuild leaves the existing index in place
+	calls = nil
+	err = repo.Reindex(testRepo, "types", typesIndex(5), func(cur, total int64) {
+		calls = append(calls, [2]int64{cur, total})
+	})
+	r.Error(err)
+	r.Len(calls, 5)
+	_, err = os.Stat(testRepo.GetPath(repo.PrefixIndex, "types.reindex"))
+	r.True(os.IsNotExist(err), "the half-built index should be removed")
+	checkIndex()
+
+	// a swap that was interrupted after the old index was moved away is finished when the index is opened
+	interruptSwap := func() {
+		r.NoError(os.Rename(testRepo.GetPath(repo.PrefixIndex, "types"), testRepo.GetPath(repo.PrefixIndex, "types.ready")))
+		r.NoError(os.MkdirAll(testRepo.GetPath(repo.PrefixIndex, "types.old", "db"), 0700))
+	}
+	interruptSwap()
+	checkIndex()
+	_, err = os.Stat(testRepo.GetPath(repo.PrefixIndex, "types.old"))
+	r.True(os.IsNotExist(err), "the old index should be removed")
+
+	// or by the next rebuild, before it starts
+	interruptSwap()
+	err = repo.Reindex(testRepo, "types", typesIndex(5), nil)
+	r.Error(err)
+	checkIndex()
+
+	// so does a canceled one
+	r.NoError(testRepo.Close())
+	err = repo.Reindex(testRepo, "types", typesIndex(-1), nil)
+	r.ErrorIs(err, context.Canceled)
+	checkIndex()
+}
@@ -0,0 +1,321 @@
+// SPDX-FileCopyrightText: 2021 The Go-SSB Authors
+//
+// SPDX-License-Identifier: MIT
+
+package repo
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/dgraph-io/badger/v3"
+	refs "github.com/ssbc/go-ssb-refs"
+	"github.com/ssbc/go-ssb-refs/tfk"
+	"github.com/ssbc/margaret"
+	librarian "github.com/ssbc/margaret/indexes"
+
+	"github.com/ssbc/go-ssb/internal/storedrefs"
+)
+
+// FeedReplState holds what we know about the replication of a single feed.
+type FeedReplState struct {
+	// StoredSeq is the highest sequence of the feed that is stored in the root log.
+	StoredSeq int64 `json:"storedSeq"`
+
+	// LastTry is the last time we asked a peer for new messages of the feed.
+	LastTry time.Time `json:"lastTry"`
+
+	// LastSuccess is the last time fetching new messages of the feed succeeded.
+	LastSuccess time.Time `json:"lastSuccess"`
+
+	// Paused is set while the feed shouldn't be fetched from peers.
+	Paused bool `json:"paused,omitempty"`
+}
+
+var (
+	replStateFeedPrefix = []byte("feed")
+	replStateSeqKey     = []byte("__current_seq")
+)
+
+// ReplStateIndex is a persisted index of FeedReplState values, keyed by feed.
+// It is also a sink index over the root log which keeps StoredSeq up to date.
+type ReplStateIndex struct {
+	mu sync.Mutex
+	db *badger.DB
+
+	seq int64
+}
+
+var _ librarian.SinkIndex = (*ReplStateIndex)(nil)
+
+// ReplState opens the replication state index of the repo.
+func ReplState(r Interface) (*ReplStateIndex, error) {
+	pth := r.GetPath(PrefixIndex, "replstate", "db")
+	err := os.MkdirAll(pth, 0700)
+	if err != nil {
+		return nil, fmt.Errorf("replstate: error making index directory: %w", err)
+	}
+
+	db, err := OpenBadgerDB(pth)
+	if err != nil {
+		return nil, fmt.Errorf("replstate: badger failed to open: %w", err)
+	}
+
+	rs := &ReplStateIndex{
+		db:  db,
+		seq: margaret.SeqEmpty,
+	}
+
+	err = db.View(func(txn *badger.Txn) error {
+		item, err := txn.Get(replStateSeqKey)
+		if err != nil {
+			return err
+		}
+		return item.Value(func(v []byte) error {
+			if len(v) != 8 {
+				return fmt.Errorf("invalid sequence entry (%d bytes)", len(v))
+			}
+			rs.seq = int64(binary.BigEndian.Uint64(v))
+			return nil
+		})
+	})
+	if err != nil && !errors.Is(err, badger.ErrKeyNotFound) {
+		db.Close()
+		return nil, fmt.Errorf("replstate: failed to load current sequence: %w", err)
+	}
+
+	return rs, nil
+}
+
+// Close closes the backing database.
+func (rs *ReplStateIndex) Close() error {
+	return rs.db.Close()
+}
+
+// Get returns the state of a feed. Unknown feeds return a zero value with StoredSeq set to -1.
+func (rs *ReplStateIndex) Get(feed refs.FeedRef) (FeedReplState, error) {
+	var st FeedReplState
+	err := rs.db.View(func(txn *badger.Txn) error {
+		var err error
+		st, err = getReplState(txn, feed)
+		return err
+	})
+	if err != nil {
+		return FeedReplState{}, fmt.Errorf("replstate: failed to get state of %s: %w", feed.ShortSigil(), err)
+	}
+	return st, nil
+}
+
+// SetLastTry records when we last tried to fetch messages for feed.
+func (rs *ReplStateIndex) SetLastTry(feed refs.FeedRef, when time.Time) error {
+	return rs.update(feed, func(st *FeedReplState) {
+		st.LastTry = when
+	})
+}
+
+// SetLastSuccess records when we last successfully fetched messages for feed.
+func (rs *ReplStateIndex) SetLastSuccess(feed refs.FeedRef, when time.Time) error {
+	return rs.update(feed, func(st *FeedReplState) {
+		st.LastSuccess = when
+	})
+}
+
+// SetPaused records if feed shouldn't be fetched from peers for now.
+func (rs *ReplStateIndex) SetPaused(feed refs.FeedRef, paused bool) error {
+	return rs.update(feed, func(st *FeedReplState) {
+		st.Paused = paused
+	})
+}
+
+// PausedFeeds returns all the feeds which are paused.
+func (rs *ReplStateIndex) PausedFeeds() ([]refs.FeedRef, error) {
+	paused, err := rs.feedsWhere(func(st FeedReplState) bool {
+		return st.Paused
+	})
+	if err != nil {
+		return nil, fmt.Errorf("replstate: failed to list paused feeds: %w", err)
+	}
+	return paused, nil
+}
+
+// StaleFeeds returns all known feeds which were not fetched successfully within olderThan.
+func (rs *ReplStateIndex) StaleFeeds(olderThan time.Duration) ([]refs.FeedRef, error) {
+	cutoff := time.Now().Add(-olderThan)
+
+	stale, err := rs.feedsWhere(func(st FeedReplState) bool {
+		return !st.LastSuccess.After(cutoff)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("replstate: failed to list stale feeds: %w", err)
+	}
+	return stale, nil
+}
+
+// feedsWhere returns the known feeds whose state matches
+func (rs *ReplStateIndex) feedsWhere(match func(FeedReplState) bool) ([]refs.FeedRef, error) {
+	var feeds []refs.FeedRef
+	err := rs.db.View(func(txn *badger.Txn) error {
+		iter := txn.NewIterator(badger.DefaultIteratorOptions)
+		defer iter.Close()
+
+		for iter.Seek(replStateFeedPrefix); iter.ValidForPrefix(replStateFeedPrefix); iter.Next() {
+			it := iter.Item()
+
+			var st FeedReplState
+			err := it.Value(func(v []byte) error {
+				return json.Unmarshal(v, &st)
+			})
+			if err != nil {
+				return fmt.Errorf("invalid state entry: %w", err)
+			}
+
+			if !match(st) {
+				continue
+			}
+
+			var sr tfk.Feed
+			err = sr.UnmarshalBinary(it.Key()[len(replStateFeedPrefix):])
+			if err != nil {
+				return fmt.Errorf("invalid feed key: %w", err)
+			}
+
+			fr, err := sr.Feed()
+			if err != nil {
+				return err
+			}
+			feeds = append(feeds, fr)
+		}
+		return nil
+	})
+	return feeds, err
+}
+
+// Pour updates the StoredSeq of the author of each message appended to the root log.
+func (rs *ReplStateIndex) Pour(ctx context.Context, swv interface{}) error {
+	sw, ok := swv.(margaret.SeqWrapper)
+	if !ok {
+		return fmt.Errorf("replstate: error casting seq wrapper. got type %T", swv)
+	}
+	rxSeq := sw.Seq()
+
+	v := sw.Value()
+	if errV, ok := v.(error); ok {
+		if margaret.IsErrNulled(errV) {
+			return rs.setSeq(rxSeq)
+		}
+		return errV
+	}
+
+	msg, ok := v.(refs.Message)
+	if !ok {
+		return fmt.Errorf("replstate: error casting message. got type %T", v)
+	}
+
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+
+	err := rs.db.Update(func(txn *badger.Txn) error {
+		st, err := getReplState(txn, msg.Author())
+		if err != nil {
+			return err
+		}
+
+		if msg.Seq() > st.StoredSeq {
+			st.StoredSeq = msg.Seq()
+			if err := setReplState(txn, msg.Author(), st); err != nil {
+				return err
+			}
+		}
+
+		return txn.Set(replStateSeqKey, encodeReplStateSeq(rxSeq))
+	})
+	if err != nil {
+		return fmt.Errorf("replstate: failed to update stored sequence: %w", err)
+	}
+	rs.seq = rxSeq
+	return nil
+}
+
+// QuerySpec returns the query spec that queries the next needed messages from the log
+func (rs *ReplStateIndex) QuerySpec() margaret.QuerySpec {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+
+	return margaret.MergeQuerySpec(
+		margaret.Gt(rs.seq),
+		margaret.SeqWrap(true),
+	)
+}
+
+func (rs *ReplStateIndex) setSeq(rxSeq int64) error {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+
+	err := rs.db.Update(func(txn *badger.Txn) error {
+		return txn.Set(replStateSeqKey, encodeReplStateSeq(rxSeq))
+	})
+	if err != nil {
+		return fmt.Errorf("replstate: failed to update current sequence: %w", err)
+	}
+	rs.seq = rxSeq
+	return nil
+}
+
+func (rs *ReplStateIndex) update(feed refs.FeedRef, fn func(*FeedReplState)) error {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+
+	err := rs.db.Update(func(txn *badger.Txn) error {
+		st, err := getReplState(txn, feed)
+		if err != nil {
+			return err
+		}
+		fn(&st)
+		return setReplState(txn, feed, st)
+	})
+	if err != nil {
+		return fmt.Errorf("replstate: failed to update state of %s: %w", feed.ShortSigil(), err)
+	}
+	return nil
+}
+
+func getReplState(txn *badger.Txn, feed refs.FeedRef) (FeedReplState, error) {
+	st := FeedReplState{StoredSeq: margaret.SeqEmpty}
+
+	item, err := txn.Get(replStateKey(feed))
+	if err != nil {
+		if errors.Is(err, badger.ErrKeyNotFound) {
+			return st, nil
+		}
+		return st, err
+	}
+
+	err = item.Value(func(v []byte) error {
+		return json.Unmarshal(v, &st)
+	})
+	return st, err
+}
+
+func setReplState(txn *badger.Txn, feed refs.FeedRef, st FeedReplState) error {
+	v, err := json.Marshal(st)
+	if err != nil {
+		return err
+	}
+	return txn.Set(replStateKey(feed), v)
+}
+
+func replStateKey(feed refs.FeedRef) []byte {
+	return append(append([]byte{}, replStateFeedPrefix...), storedrefs.Feed(feed)...)
+}
+
+func encodeReplStateSeq(seq int64) []byte {
+	raw := make([]byte, 8)
+	binary.BigEndian.PutUint64(raw, uint64(seq))
+	return raw
+}
@@ -0,0 +1,112 @@
+// SPDX-FileCopyrightText: 2021 The Go-SSB Authors
+//
+// SPDX-License-Identifier: MIT
+
+package repo_test
+
+import (
+	"context"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/ssbc/go-ssb"
+	refs "github.com/ssbc/go-ssb-refs"
+	"github.com/ssbc/go-ssb/internal/asynctesting"
+	"github.com/ssbc/go-ssb/message"
+	"github.com/ssbc/go-ssb/multilogs"
+	"github.com/ssbc/go-ssb/repo"
+)
+
+func TestReplState(t *testing.T) {
+	r := require.New(t)
+	ctx, cancel := context.WithCancel(context.TODO())
+	defer cancel()
+
+	rpath := filepath.Join("testrun", t.Name())
+	os.RemoveAll(rpath)
+
+	testRepo := repo.New(rpath)
+	rl, err := repo.OpenLog(testRepo)
+	r.NoError(err, "failed to open root log")
+	t.Cleanup(func() { rl.Close() })
+
+	userFeeds, userFeedsSnk, err := repo.OpenStandaloneMultiLog(testRepo, "testUsers", multilogs.UserFeedsUpdate)
+	r.NoError(err)
+	t.Cleanup(func() {
+		userFeeds.Close()
+		userFeedsSnk.Close()
+	})
+
+	rs, err := repo.ReplState(testRepo)
+	r.NoError(err)
+	t.Cleanup(func() { rs.Close() })
+
+	usersErrc := asynctesting.ServeLog(ctx, "users", rl, userFeedsSnk, true)
+	replErrc := asynctesting.ServeLog(ctx, "replstate", rl, rs, true)
+
+	staticRand := rand.New(rand.NewSource(42))
+	alice, err := ssb.NewKeyPair(staticRand, refs.RefAlgoFeedSSB1)
+	r.NoError(err)
+	bob, err := ssb.NewKeyPair(staticRand, refs.RefAlgoFeedSSB1)
+	r.NoError(err)
+
+	st, err := rs.Get(alice.ID())
+	r.NoError(err)
+	r.EqualValues(-1, st.StoredSeq, "unknown feed should be empty")
+
+	alicePublish, err := message.OpenPublishLog(rl, userFeeds, alice)
+	r.NoError(err)
+	bobPublish, err := message.OpenPublishLog(rl, userFeeds, bob)
+	r.NoError(err)
+
+	for i := 0; i < 3; i++ {
+		time.Sleep(100 * time.Millisecond)
+		_, err = alicePublish.Publish(map[string]interface{}{"type": "test", "i": i})
+		r.NoError(err)
+	}
+	time.Sleep(100 * time.Millisecond)
+	_, err = bobPublish.Publish(map[string]interface{}{"type": "test"})
+	r.NoError(err)
+	time.Sleep(250 * time.Millisecond)
+
+	st, err = rs.Get(alice.ID())
+	r.NoError(err)
+	r.EqualValues(3, st.StoredSeq)
+
+	st, err = rs.Get(bob.ID())
+	r.NoError(err)
+	r.EqualValues(1, st.StoredSeq)
+
+	// both feeds never succeeded, so they are stale
+	stale, err := rs.StaleFeeds(time.Hour)
+	r.NoError(err)
+	r.Len(stale, 2)
+
+	now := time.Now()
+	r.NoError(rs.SetLastTry(alice.ID(), now))
+	r.NoError(rs.SetLastSuccess(alice.ID(), now))
+	r.NoError(rs.SetLastSuccess(bob.ID(), now.Add(-2*time.Hour)))
+
+	stale, err = rs.StaleFeeds(time.Hour)
+	r.NoError(err)
+	r.Len(stale, 1)
+	r.True(stale[0].Equal(bob.ID()))
+
+	stale, err = rs.StaleFeeds(3 * time.Hour)
+	r.NoError(err)
+	r.Len(stale, 0)
+
+	st, err = rs.Get(alice.ID())
+	r.NoError(err)
+	r.EqualValues(3, st.StoredSeq, "setters should keep the stored sequence")
+	r.True(st.LastTry.Equal(now))
+
+	cancel()
+	r.NoError(<-usersErrc)
+	r.NoError(<-replErrc)
+}
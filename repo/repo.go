@@ -6,28 +6,145 @@
 package repo
 
 import (
+	"context"
 	"fmt"
 	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/ssbc/margaret"
+	"go.mindeco.de/log"
 
 	"github.com/ssbc/go-ssb"
 	"github.com/ssbc/go-ssb/blobstore"
+	"github.com/ssbc/go-ssb/message/multimsg"
+	"github.com/ssbc/go-ssb/metrics"
 )
 
-var _ Interface = repo{}
+var _ Interface = (*repo)(nil)
+
+// Option changes the defaults of a repository created with New.
+type Option func(*repo)
+
+// WithContext sets the parent of the context of the repository. By default it is context.Background().
+func WithContext(ctx context.Context) Option {
+	return func(r *repo) {
+		r.ctx = ctx
+	}
+}
+
+// WithLogger sets the logger the helpers of this package use for the repository. By default nothing is logged.
+func WithLogger(logger log.Logger) Option {
+	return func(r *repo) {
+		r.logger = logger
+	}
+}
+
+// WithMetrics sets where the helpers of this package report their metrics, like the stored messages and the lag of the indexes.
+// By default they are discarded.
+func WithMetrics(c metrics.Collector) Option {
+	return func(r *repo) {
+		r.metrics = c
+	}
+}
+
+// WithCodec sets how OpenLog stores the messages of the root log. By default that is multimsg.MargaretCodec.
+// Use multimsg.RawCodec to keep them in the exact bytes they were signed in.
+// A log can only be read with the codec it was written with.
+func WithCodec(c margaret.Codec) Option {
+	return func(r *repo) {
+		r.codec = c
+	}
+}
+
+// WithKeyPairSeed makes DefaultKeyPair derive the identity of a fresh repository from seed, using ssb.KeyPairFromSeed.
+// An existing secret file is still used as is. This is meant for tests which need a known identity.
+func WithKeyPairSeed(seed []byte) Option {
+	return func(r *repo) {
+		r.keyPairSeed = seed
+	}
+}
 
 // New creates a new repository value, it opens the keypair and database from basePath if it is already existing
-func New(basePath string) Interface {
-	return repo{basePath: basePath}
+func New(basePath string, opts ...Option) Interface {
+	r := &repo{
+		basePath: basePath,
+		ctx:      context.Background(),
+		logger:   log.NewNopLogger(),
+		metrics:  metrics.Discard(),
+		codec:    multimsg.MargaretCodec{},
+	}
+	for _, o := range opts {
+		o(r)
+	}
+	r.ctx, r.cancel = context.WithCancel(r.ctx)
+	return r
 }
 
 type repo struct {
 	basePath string
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	logger log.Logger
+
+	metrics metrics.Collector
+	codec   margaret.Codec
+
+	keyPairSeed []byte
+
+	gcInterval time.Duration
+	gcRatio    float64
+	gcMu       sync.Mutex // protects adding to gcRunning after Close
+	gcRunning  sync.WaitGroup
+
+	rootMu  sync.Mutex
+	rootLog margaret.Log // the root log while it is opened with OpenLog
 }
 
-func (r repo) GetPath(rel ...string) string {
+func (r *repo) GetPath(rel ...string) string {
 	return filepath.Join(append([]string{r.basePath}, rel...)...)
 }
 
+func (r *repo) Context() context.Context { return r.ctx }
+
+func (r *repo) Logger() log.Logger { return r.logger }
+
+func (r *repo) Metrics() metrics.Collector { return r.metrics }
+
+func (r *repo) KeyPairSeed() []byte { return r.keyPairSeed }
+
+func (r *repo) setRootLog(l margaret.Log) {
+	r.rootMu.Lock()
+	r.rootLog = l
+	r.rootMu.Unlock()
+}
+
+// clearRootLog forgets l, unless the root log was opened again in the meantime
+func (r *repo) clearRootLog(l margaret.Log) {
+	r.rootMu.Lock()
+	if r.rootLog == l {
+		r.rootLog = nil
+	}
+	r.rootMu.Unlock()
+}
+
+func (r *repo) openedRootLog() margaret.Log {
+	r.rootMu.Lock()
+	defer r.rootMu.Unlock()
+	return r.rootLog
+}
+
+// Close cancels the context of the repository and waits for the value log garbage collections to stop.
+func (r *repo) Close() error {
+	r.gcMu.Lock()
+	r.cancel()
+	r.gcMu.Unlock()
+
+	r.gcRunning.Wait()
+	return nil
+}
+
 func OpenBlobStore(r Interface) (ssb.BlobStore, error) {
 	bs, err := blobstore.New(r.GetPath("blobs"))
 	if err != nil {
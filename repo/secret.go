@@ -10,23 +10,41 @@ import (
 	"log"
 	"os"
 	"path/filepath"
+	"sort"
 
 	"github.com/ssbc/go-ssb"
 	refs "github.com/ssbc/go-ssb-refs"
 )
 
-func DefaultKeyPair(r Interface, algo refs.RefAlgo) (ssb.KeyPair, error) {
+// DefaultKeyPairName is the name of the secret file of the repo in KeyPairNamed and ListKeyPairs.
+// The other identities are stored in secrets/<name>.
+const DefaultKeyPairName = "-"
+
+func keyPairPath(r Interface, name string) string {
+	if name == DefaultKeyPairName || name == "" {
+		return r.GetPath("secret")
+	}
+	return r.GetPath("secrets", name)
+}
+
+// DefaultKeyPair loads the secret file of the repo, creating it if it doesn't exist.
+// The options are passed to ssb.LoadKeyPair and ssb.SaveKeyPair, to use an encrypted secret file.
+func DefaultKeyPair(r Interface, algo refs.RefAlgo, opts ...ssb.KeyPairOption) (ssb.KeyPair, error) {
 	secPath := r.GetPath("secret")
-	keyPair, err := ssb.LoadKeyPair(secPath)
+	keyPair, err := ssb.LoadKeyPair(secPath, opts...)
 	if err != nil {
 		if !os.IsNotExist(err) {
 			return nil, fmt.Errorf("repo: error opening key pair: %w", err)
 		}
-		keyPair, err = ssb.NewKeyPair(nil, algo)
+		if seed := r.KeyPairSeed(); seed != nil {
+			keyPair, err = ssb.KeyPairFromSeed(seed, algo)
+		} else {
+			keyPair, err = ssb.NewKeyPair(nil, algo)
+		}
 		if err != nil {
 			return nil, fmt.Errorf("repo: no keypair but couldn't create one either: %w", err)
 		}
-		if err := ssb.SaveKeyPair(keyPair, secPath); err != nil {
+		if err := ssb.SaveKeyPair(keyPair, secPath, opts...); err != nil {
 			return nil, fmt.Errorf("repo: error saving new identity file: %w", err)
 		}
 		log.Printf("saved identity %s to %s", keyPair.ID().String(), secPath)
@@ -34,6 +52,18 @@ func DefaultKeyPair(r Interface, algo refs.RefAlgo) (ssb.KeyPair, error) {
 	return keyPair, nil
 }
 
+// LoadKeyPairOnly loads the secret file of the repo at basePath without opening anything else of it,
+// for tools which only need the identity, like printing the public key.
+// Unlike DefaultKeyPair it doesn't create a missing secret file, the error wraps os.ErrNotExist then.
+func LoadKeyPairOnly(basePath string, opts ...ssb.KeyPairOption) (ssb.KeyPair, error) {
+	secPath := filepath.Join(basePath, "secret")
+	keyPair, err := ssb.LoadKeyPair(secPath, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("repo: failed to load key pair %q: %w", secPath, err)
+	}
+	return keyPair, nil
+}
+
 func NewKeyPair(r Interface, name string, algo refs.RefAlgo) (ssb.KeyPair, error) {
 	return newKeyPair(r, name, algo, nil)
 }
@@ -43,15 +73,10 @@ func NewKeyPairFromSeed(r Interface, name string, algo refs.RefAlgo, seed io.Rea
 }
 
 func newKeyPair(r Interface, name string, algo refs.RefAlgo, seed io.Reader) (ssb.KeyPair, error) {
-	var secPath string
-	if name == "-" {
-		secPath = r.GetPath("secret")
-	} else {
-		secPath = r.GetPath("secrets", name)
-		err := os.MkdirAll(filepath.Dir(secPath), 0700)
-		if err != nil && !os.IsExist(err) {
-			return nil, err
-		}
+	secPath := keyPairPath(r, name)
+	err := os.MkdirAll(filepath.Dir(secPath), 0700)
+	if err != nil && !os.IsExist(err) {
+		return nil, err
 	}
 	// TODO: move to refs pkg
 	if algo != refs.RefAlgoFeedSSB1 &&
@@ -75,15 +100,50 @@ func newKeyPair(r Interface, name string, algo refs.RefAlgo, seed io.Reader) (ss
 	return keyPair, nil
 }
 
-func LoadKeyPair(r Interface, name string) (ssb.KeyPair, error) {
-	secPath := r.GetPath("secrets", name)
-	keyPair, err := ssb.LoadKeyPair(secPath)
+// KeyPairNamed loads the identity with the passed name from the repo.
+// DefaultKeyPairName (or an empty name) is the secret file of the repo, which a repo with a single identity already has.
+// Unlike DefaultKeyPair, it doesn't create missing identities, use NewKeyPair for that.
+func KeyPairNamed(r Interface, name string, opts ...ssb.KeyPairOption) (ssb.KeyPair, error) {
+	if name != filepath.Base(name) || name == "." || name == ".." {
+		return nil, fmt.Errorf("repo: invalid key pair name %q", name)
+	}
+	secPath := keyPairPath(r, name)
+	keyPair, err := ssb.LoadKeyPair(secPath, opts...)
 	if err != nil {
 		return nil, fmt.Errorf("Load: failed to open %q: %w", secPath, err)
 	}
 	return keyPair, nil
 }
 
+// LoadKeyPair is the same as KeyPairNamed.
+func LoadKeyPair(r Interface, name string, opts ...ssb.KeyPairOption) (ssb.KeyPair, error) {
+	return KeyPairNamed(r, name, opts...)
+}
+
+// ListKeyPairs returns the sorted names of the identities in the repo, which can be loaded with KeyPairNamed.
+// DefaultKeyPairName is the first one if the repo has a secret file.
+func ListKeyPairs(r Interface) ([]string, error) {
+	var names []string
+	if _, err := os.Stat(r.GetPath("secret")); err == nil {
+		names = append(names, DefaultKeyPairName)
+	} else if !os.IsNotExist(err) {
+		return nil, fmt.Errorf("repo: failed to check secret file: %w", err)
+	}
+
+	entries, err := os.ReadDir(r.GetPath("secrets"))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("repo: failed to list key pairs: %w", err)
+	}
+	var named []string
+	for _, e := range entries {
+		if e.Type().IsRegular() {
+			named = append(named, e.Name())
+		}
+	}
+	sort.Strings(named)
+	return append(names, named...), nil
+}
+
 func AllKeyPairs(r Interface) (map[string]ssb.KeyPair, error) {
 	kps := make(map[string]ssb.KeyPair)
 	err := filepath.Walk(r.GetPath("secrets"), func(path string, info os.FileInfo, err error) error {
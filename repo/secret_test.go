@@ -5,11 +5,14 @@
 package repo
 
 import (
+	"bytes"
+	"fmt"
 	"os"
 	"path/filepath"
 	"testing"
 
 	"github.com/ssbc/go-metafeed/metakeys"
+	"github.com/ssbc/go-ssb"
 	refs "github.com/ssbc/go-ssb-refs"
 	"github.com/stretchr/testify/require"
 )
@@ -26,6 +29,30 @@ func TestDefaultKeyPair(t *testing.T) {
 	r.NoError(err, "failed to open key pair")
 }
 
+func TestLoadKeyPairOnly(t *testing.T) {
+	r := require.New(t)
+
+	rpath := filepath.Join("testrun", t.Name())
+	os.RemoveAll(rpath)
+
+	_, err := LoadKeyPairOnly(rpath)
+	r.ErrorIs(err, os.ErrNotExist)
+	_, err = os.Stat(filepath.Join(rpath, "secret"))
+	r.True(os.IsNotExist(err), "should not create a secret")
+
+	kp, err := DefaultKeyPair(New(rpath), refs.RefAlgoFeedSSB1)
+	r.NoError(err)
+
+	loaded, err := LoadKeyPairOnly(rpath)
+	r.NoError(err)
+	r.True(loaded.ID().Equal(kp.ID()))
+
+	entries, err := os.ReadDir(rpath)
+	r.NoError(err)
+	r.Len(entries, 1, "only the secret should be in the repo")
+	r.Equal("secret", entries[0].Name())
+}
+
 func TestSaveAndLoadBendyButtKeyPair(t *testing.T) {
 	r := require.New(t)
 
@@ -47,3 +74,81 @@ func TestSaveAndLoadBendyButtKeyPair(t *testing.T) {
 	r.True(ok, "not a metafeed keypair: %T", loadedKp)
 	r.Len(mfkp.Seed, metakeys.SeedLength)
 }
+
+func TestDefaultKeyPairWithSeed(t *testing.T) {
+	r := require.New(t)
+
+	seed := bytes.Repeat([]byte{0x42}, 32)
+	want, err := ssb.KeyPairFromSeed(seed, refs.RefAlgoFeedSSB1)
+	r.NoError(err)
+
+	for i := 0; i < 2; i++ {
+		rpath := filepath.Join("testrun", t.Name(), fmt.Sprint(i))
+		os.RemoveAll(rpath)
+
+		kp, err := DefaultKeyPair(New(rpath, WithKeyPairSeed(seed)), refs.RefAlgoFeedSSB1)
+		r.NoError(err)
+		r.True(kp.ID().Equal(want.ID()), "got %s", kp.ID())
+
+		// once it's saved, the secret file is used
+		loaded, err := DefaultKeyPair(New(rpath), refs.RefAlgoFeedSSB1)
+		r.NoError(err)
+		r.True(loaded.ID().Equal(want.ID()))
+	}
+
+	// other implementations of Interface pass the seed on, too
+	rpath := filepath.Join("testrun", t.Name(), "wrapped")
+	os.RemoveAll(rpath)
+	kp, err := DefaultKeyPair(wrappedRepo{New(rpath, WithKeyPairSeed(seed))}, refs.RefAlgoFeedSSB1)
+	r.NoError(err)
+	r.True(kp.ID().Equal(want.ID()), "got %s", kp.ID())
+}
+
+type wrappedRepo struct{ Interface }
+
+func TestNamedKeyPairs(t *testing.T) {
+	r := require.New(t)
+
+	rpath := filepath.Join("testrun", t.Name())
+	os.RemoveAll(rpath)
+
+	repo := New(rpath)
+
+	names, err := ListKeyPairs(repo)
+	r.NoError(err)
+	r.Empty(names)
+
+	// a repo with just the secret file has it as the default identity
+	def, err := DefaultKeyPair(repo, refs.RefAlgoFeedSSB1)
+	r.NoError(err)
+	names, err = ListKeyPairs(repo)
+	r.NoError(err)
+	r.Equal([]string{DefaultKeyPairName}, names)
+
+	loaded, err := KeyPairNamed(repo, DefaultKeyPairName)
+	r.NoError(err)
+	r.True(loaded.ID().Equal(def.ID()))
+
+	bob, err := NewKeyPair(repo, "bob", refs.RefAlgoFeedSSB1)
+	r.NoError(err)
+	alice, err := NewKeyPair(repo, "alice", refs.RefAlgoFeedSSB1)
+	r.NoError(err)
+	_, err = NewKeyPair(repo, "alice", refs.RefAlgoFeedSSB1)
+	r.Error(err, "name already taken")
+
+	names, err = ListKeyPairs(repo)
+	r.NoError(err)
+	r.Equal([]string{DefaultKeyPairName, "alice", "bob"}, names)
+
+	loaded, err = KeyPairNamed(repo, "alice")
+	r.NoError(err)
+	r.True(loaded.ID().Equal(alice.ID()))
+	loaded, err = KeyPairNamed(repo, "bob")
+	r.NoError(err)
+	r.True(loaded.ID().Equal(bob.ID()))
+
+	_, err = KeyPairNamed(repo, "claire")
+	r.Error(err)
+	_, err = KeyPairNamed(repo, "../secret")
+	r.Error(err)
+}
@@ -0,0 +1,96 @@
+// SPDX-FileCopyrightText: 2021 The Go-SSB Authors
+//
+// SPDX-License-Identifier: MIT
+
+package repo
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/ssbc/go-luigi"
+	"github.com/ssbc/margaret"
+	librarian "github.com/ssbc/margaret/indexes"
+	"go.mindeco.de/log"
+	"go.mindeco.de/log/level"
+)
+
+// ServeProgressInterval is how often ServeIndex logs its progress.
+var ServeProgressInterval = 5 * time.Second
+
+// ServeIndex pours the messages of msgs into snk, starting after the last message the index processed.
+// If live is false, it returns once it reached the end of msgs. Otherwise it keeps waiting for new messages.
+// It stops without an error when the context of the repository is canceled, for instance by r.Close(). Check r.Context().Err() to tell that apart from the end of msgs.
+// The number of processed messages and the current sequence are logged to the logger of r.
+func ServeIndex(r Interface, name string, msgs margaret.Log, snk librarian.SinkIndex, live bool) error {
+	ctx := r.Context()
+	logger := log.With(r.Logger(), "index", name)
+
+	src, err := msgs.Query(margaret.SeqWrap(true), snk.QuerySpec(), margaret.Live(live))
+	if err != nil {
+		return fmt.Errorf("serve index(%s): failed to query messages: %w", name, err)
+	}
+
+	cs := &countingSink{
+		backing: snk,
+		seq:     margaret.SeqEmpty,
+	}
+
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		tick := time.NewTicker(ServeProgressInterval)
+		defer tick.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-tick.C:
+				cs.log(level.Info(logger), "index-progress")
+			}
+		}
+	}()
+
+	err = RunPump(ctx, name, cs, src)
+	if err != nil {
+		level.Warn(logger).Log("event", "index-failed", "err", err)
+		return err
+	}
+	if ctx.Err() != nil {
+		cs.log(level.Debug(logger), "index-stopped")
+		return nil
+	}
+	cs.log(level.Debug(logger), "index-synced")
+	return nil
+}
+
+// countingSink keeps track of what ServeIndex processed.
+// Closing it doesn't close the index, which stays usable.
+type countingSink struct {
+	backing luigi.Sink
+
+	processed int64
+	seq       int64
+}
+
+func (cs *countingSink) Pour(ctx context.Context, v interface{}) error {
+	if err := cs.backing.Pour(ctx, v); err != nil {
+		return err
+	}
+
+	atomic.AddInt64(&cs.processed, 1)
+	if sw, ok := v.(margaret.SeqWrapper); ok {
+		atomic.StoreInt64(&cs.seq, sw.Seq())
+	}
+	return nil
+}
+
+func (cs *countingSink) Close() error { return nil }
+
+func (cs *countingSink) log(logger log.Logger, event string) {
+	logger.Log("event", event,
+		"processed", atomic.LoadInt64(&cs.processed),
+		"seq", atomic.LoadInt64(&cs.seq))
+}
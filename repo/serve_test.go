@@ -0,0 +1,104 @@
+// SPDX-FileCopyrightText: 2021 The Go-SSB Authors
+//
+// SPDX-License-Identifier: MIT
+
+package repo_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ssbc/margaret"
+	"github.com/ssbc/margaret/mem"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ssbc/go-ssb/repo"
+)
+
+func TestServeIndexStopsOnClose(t *testing.T) {
+	r := require.New(t)
+
+	rpo := repo.New(t.TempDir())
+
+	msgs := mem.New()
+	for i := 0; i < 3; i++ {
+		_, err := msgs.Append(i)
+		r.NoError(err)
+	}
+
+	snk := &seqCountIndex{}
+
+	errc := make(chan error, 1)
+	go func() {
+		errc <- repo.ServeIndex(rpo, "test", msgs, snk, true)
+	}()
+
+	r.Eventually(func() bool { return snk.count() == 3 }, 5*time.Second, 10*time.Millisecond)
+
+	// new messages are still picked up while it is live
+	_, err := msgs.Append(3)
+	r.NoError(err)
+	r.Eventually(func() bool { return snk.count() == 4 }, 5*time.Second, 10*time.Millisecond)
+
+	r.NoError(rpo.Close())
+	r.Error(rpo.Context().Err())
+
+	select {
+	case err := <-errc:
+		r.NoError(err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("serve loop didn't stop after the repo was closed")
+	}
+}
+
+func TestServeIndexParentContext(t *testing.T) {
+	r := require.New(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	rpo := repo.New(t.TempDir(), repo.WithContext(ctx))
+
+	msgs := mem.New()
+	snk := &seqCountIndex{}
+
+	errc := make(chan error, 1)
+	go func() {
+		errc <- repo.ServeIndex(rpo, "test", msgs, snk, true)
+	}()
+
+	cancel()
+
+	select {
+	case err := <-errc:
+		r.NoError(err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("serve loop didn't stop after the parent context was canceled")
+	}
+	r.Equal(0, snk.count())
+}
+
+// seqCountIndex counts the messages it was fed
+type seqCountIndex struct {
+	mu   sync.Mutex
+	seqs []int64
+}
+
+func (idx *seqCountIndex) Pour(ctx context.Context, v interface{}) error {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	idx.seqs = append(idx.seqs, v.(margaret.SeqWrapper).Seq())
+	return nil
+}
+
+func (idx *seqCountIndex) Close() error { return nil }
+
+func (idx *seqCountIndex) QuerySpec() margaret.QuerySpec {
+	return margaret.SeqWrap(true)
+}
+
+func (idx *seqCountIndex) count() int {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	return len(idx.seqs)
+}
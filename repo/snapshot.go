@@ -0,0 +1,289 @@
+// SPDX-FileCopyrightText: 2021 The Go-SSB Authors
+//
+// SPDX-License-Identifier: MIT
+
+package repo
+
+import (
+	"archive/tar"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// ErrRestoreNotEmpty is returned by Restore if the target already contains files and ForceRestore wasn't passed.
+var ErrRestoreNotEmpty = errors.New("repo: restore target is not empty")
+
+// Snapshot writes a tar archive of the repo to w, with the secret, the blobs, the root log and all the indexes.
+//
+// It holds the lock of the repo while the archive is written, so that no badger database or log is written to at the same time.
+// It fails with ErrRepoLocked if the repo is in use, stop the bot first.
+// The lock file itself, unix sockets and unfinished blobs are left out.
+func Snapshot(r Interface, w io.Writer) error {
+	lock, err := AcquireLock(r)
+	if err != nil {
+		return fmt.Errorf("snapshot: %w", err)
+	}
+	defer lock.Close()
+
+	base := r.GetPath()
+	tmpBlobs := r.GetPath("blobs", "tmp")
+	lockPath := r.GetPath("lock")
+
+	tw := tar.NewWriter(w)
+	err = filepath.WalkDir(base, func(pth string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if pth == base || pth == lockPath {
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+
+		if d.IsDir() {
+			return writeTarHeader(tw, base, pth, info)
+		}
+
+		// keep the tmp folder of the blobs but not the half written ones in it
+		if !info.Mode().IsRegular() || filepath.Dir(pth) == tmpBlobs {
+			return nil
+		}
+
+		if err := writeTarHeader(tw, base, pth, info); err != nil {
+			return err
+		}
+
+		f, err := os.Open(pth)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		n, err := io.Copy(tw, f)
+		if err != nil {
+			return err
+		}
+		if n != info.Size() {
+			return fmt.Errorf("%s changed while it was copied", pth)
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("snapshot: failed to archive the repo: %w", err)
+	}
+
+	if err := tw.Close(); err != nil {
+		return fmt.Errorf("snapshot: failed to finish archive: %w", err)
+	}
+	return nil
+}
+
+func writeTarHeader(tw *tar.Writer, base, pth string, info fs.FileInfo) error {
+	hdr, err := tar.FileInfoHeader(info, "")
+	if err != nil {
+		return err
+	}
+
+	rel, err := filepath.Rel(base, pth)
+	if err != nil {
+		return err
+	}
+	hdr.Name = filepath.ToSlash(rel)
+	if info.IsDir() {
+		hdr.Name += "/"
+	}
+
+	return tw.WriteHeader(hdr)
+}
+
+type restoreOptions struct {
+	force bool
+}
+
+// RestoreOption changes how Restore behaves.
+type RestoreOption func(*restoreOptions)
+
+// ForceRestore lets Restore replace the contents of a non-empty repo.
+func ForceRestore() RestoreOption {
+	return func(o *restoreOptions) {
+		o.force = true
+	}
+}
+
+// Restore unpacks an archive made by Snapshot into the repo at basePath.
+//
+// If basePath already contains files, it fails with ErrRestoreNotEmpty,
+// unless ForceRestore is passed in which case the existing contents are replaced.
+// The archive is unpacked into a folder next to basePath first and only moved into place
+// once it was read completely and contains the secret of a repo, so a broken archive leaves the repo as it was.
+// Like Snapshot, it fails with ErrRepoLocked if the repo is in use.
+func Restore(rd io.Reader, basePath string, opts ...RestoreOption) error {
+	var o restoreOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	r := New(basePath)
+	lock, err := AcquireLock(r)
+	if err != nil {
+		return fmt.Errorf("restore: %w", err)
+	}
+	defer lock.Close()
+
+	existing, err := repoEntries(basePath)
+	if err != nil {
+		return fmt.Errorf("restore: failed to read target: %w", err)
+	}
+	if len(existing) > 0 && !o.force {
+		return ErrRestoreNotEmpty
+	}
+
+	parent, name := filepath.Split(filepath.Clean(basePath))
+	staging, err := os.MkdirTemp(parent, name+".restore-")
+	if err != nil {
+		return fmt.Errorf("restore: failed to create staging folder: %w", err)
+	}
+	defer os.RemoveAll(staging)
+
+	if err := unpackArchive(rd, staging); err != nil {
+		return fmt.Errorf("restore: %w", err)
+	}
+	if _, err := os.Stat(filepath.Join(staging, "secret")); err != nil {
+		return fmt.Errorf("restore: archive doesn't contain the secret of a repo: %w", err)
+	}
+
+	// move the old contents out of the way, they are only removed once the new ones are in place
+	var old string
+	if len(existing) > 0 {
+		old, err = os.MkdirTemp(parent, name+".old-")
+		if err != nil {
+			return fmt.Errorf("restore: failed to create folder for the old contents: %w", err)
+		}
+		if err := moveEntries(basePath, old, existing); err != nil {
+			return fmt.Errorf("restore: failed to move old contents to %s: %w", old, err)
+		}
+	}
+
+	restored, err := repoEntries(staging)
+	if err != nil {
+		return fmt.Errorf("restore: failed to read staging folder: %w", err)
+	}
+	if err := moveEntries(staging, basePath, restored); err != nil {
+		if old != "" {
+			return fmt.Errorf("restore: failed to move restored contents in place, the old ones are in %s: %w", old, err)
+		}
+		return fmt.Errorf("restore: failed to move restored contents in place: %w", err)
+	}
+
+	if old != "" {
+		if err := os.RemoveAll(old); err != nil {
+			return fmt.Errorf("restore: failed to remove old contents: %w", err)
+		}
+	}
+	return nil
+}
+
+// repoEntries returns the names in dir, except for the lock file
+func repoEntries(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	for _, e := range entries {
+		if e.Name() == "lock" {
+			continue
+		}
+		names = append(names, e.Name())
+	}
+	return names, nil
+}
+
+func moveEntries(from, to string, names []string) error {
+	for _, name := range names {
+		if err := os.Rename(filepath.Join(from, name), filepath.Join(to, name)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// unpackArchive writes the entries of the tar archive in rd to dir.
+func unpackArchive(rd io.Reader, dir string) error {
+	lockPath := filepath.Join(dir, "lock")
+
+	tr := tar.NewReader(rd)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read archive: %w", err)
+		}
+
+		pth, err := restorePath(dir, hdr.Name)
+		if err != nil {
+			return err
+		}
+		if pth == lockPath {
+			continue
+		}
+
+		mode := hdr.FileInfo().Mode().Perm()
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(pth, mode|0700); err != nil {
+				return fmt.Errorf("failed to create folder: %w", err)
+			}
+
+		case tar.TypeReg:
+			if err := restoreFile(tr, pth, mode); err != nil {
+				return fmt.Errorf("failed to restore %s: %w", hdr.Name, err)
+			}
+
+		default:
+			return fmt.Errorf("unsupported entry %s (type %c)", hdr.Name, hdr.Typeflag)
+		}
+	}
+}
+
+// restorePath makes sure name stays inside of basePath
+func restorePath(basePath, name string) (string, error) {
+	clean := path.Clean(name)
+	if path.IsAbs(clean) || clean == ".." || strings.HasPrefix(clean, "../") {
+		return "", fmt.Errorf("invalid path in archive: %q", name)
+	}
+	return filepath.Join(basePath, filepath.FromSlash(clean)), nil
+}
+
+func restoreFile(rd io.Reader, pth string, mode fs.FileMode) error {
+	if err := os.MkdirAll(filepath.Dir(pth), 0700); err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(pth, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, mode)
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(f, rd); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,166 @@
+// SPDX-FileCopyrightText: 2021 The Go-SSB Authors
+//
+// SPDX-License-Identifier: MIT
+
+package repo_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	refs "github.com/ssbc/go-ssb-refs"
+	"github.com/ssbc/go-ssb/internal/asynctesting"
+	"github.com/ssbc/go-ssb/internal/storedrefs"
+	"github.com/ssbc/go-ssb/message"
+	"github.com/ssbc/go-ssb/multilogs"
+	"github.com/ssbc/go-ssb/repo"
+)
+
+func TestSnapshotRestore(t *testing.T) {
+	r := require.New(t)
+
+	base := filepath.Join("testrun", t.Name())
+	os.RemoveAll(base)
+	srcPath := filepath.Join(base, "src")
+	srcRepo := repo.New(srcPath)
+
+	kp, err := repo.DefaultKeyPair(srcRepo, refs.RefAlgoFeedSSB1)
+	r.NoError(err)
+
+	bs, err := repo.OpenBlobStore(srcRepo)
+	r.NoError(err)
+	blobContent := []byte("a blob that should survive")
+	blobRef, err := bs.Put(bytes.NewReader(blobContent))
+	r.NoError(err)
+
+	var published []refs.MessageRef
+	func() {
+		ctx, cancel := context.WithCancel(context.TODO())
+		defer cancel()
+
+		rl, err := repo.OpenLog(srcRepo)
+		r.NoError(err)
+		defer rl.Close()
+
+		userFeeds, userFeedsSnk, err := repo.OpenStandaloneMultiLog(srcRepo, "testUsers", multilogs.UserFeedsUpdate)
+		r.NoError(err)
+		defer userFeeds.Close()
+		errc := asynctesting.ServeLog(ctx, "users", rl, userFeedsSnk, true)
+
+		p, err := message.OpenPublishLog(rl, userFeeds, kp)
+		r.NoError(err)
+
+		sublog, err := userFeeds.Get(storedrefs.Feed(kp.ID()))
+		r.NoError(err)
+		for i := 0; i < 3; i++ {
+			msg, err := p.Publish(map[string]interface{}{"type": "test", "i": i})
+			r.NoError(err)
+			published = append(published, msg.Key())
+
+			r.Eventually(func() bool {
+				return sublog.Seq() == int64(i)
+			}, time.Second, 10*time.Millisecond)
+		}
+
+		cancel()
+		r.NoError(<-errc)
+		r.NoError(userFeedsSnk.Close())
+	}()
+
+	// a lock held by someone else stops the snapshot
+	lock, err := repo.AcquireLock(srcRepo)
+	r.NoError(err)
+	err = repo.Snapshot(srcRepo, ioutil.Discard)
+	r.True(errors.Is(err, repo.ErrRepoLocked), "got: %v", err)
+	r.NoError(lock.Close())
+
+	var snapshot bytes.Buffer
+	r.NoError(repo.Snapshot(srcRepo, &snapshot))
+
+	dstPath := filepath.Join(base, "dst")
+	r.NoError(repo.Restore(bytes.NewReader(snapshot.Bytes()), dstPath))
+	dstRepo := repo.New(dstPath)
+
+	// the identity
+	restoredKp, err := repo.DefaultKeyPair(dstRepo, refs.RefAlgoFeedSSB1)
+	r.NoError(err)
+	r.True(restoredKp.ID().Equal(kp.ID()))
+	srcInfo, err := os.Stat(srcRepo.GetPath("secret"))
+	r.NoError(err)
+	info, err := os.Stat(dstRepo.GetPath("secret"))
+	r.NoError(err)
+	r.Equal(srcInfo.Mode().Perm(), info.Mode().Perm())
+
+	// the blobs
+	restoredBs, err := repo.OpenBlobStore(dstRepo)
+	r.NoError(err)
+	rd, err := restoredBs.Get(blobRef)
+	r.NoError(err)
+	got, err := ioutil.ReadAll(rd)
+	r.NoError(err)
+	r.NoError(rd.Close())
+	r.Equal(blobContent, got)
+
+	// the root log and the user feeds index
+	rl, err := repo.OpenLog(dstRepo)
+	r.NoError(err)
+	r.EqualValues(2, rl.Seq())
+	for i, key := range published {
+		v, err := rl.Get(int64(i))
+		r.NoError(err)
+		r.True(v.(refs.Message).Key().Equal(key))
+	}
+
+	userFeeds, userFeedsSnk, err := repo.OpenStandaloneMultiLog(dstRepo, "testUsers", multilogs.UserFeedsUpdate)
+	r.NoError(err)
+	sublog, err := userFeeds.Get(storedrefs.Feed(kp.ID()))
+	r.NoError(err)
+	r.EqualValues(2, sublog.Seq())
+	r.NoError(userFeedsSnk.Close())
+	r.NoError(userFeeds.Close())
+	r.NoError(rl.Close())
+
+	// restoring into a non-empty repo needs to be forced
+	err = repo.Restore(bytes.NewReader(snapshot.Bytes()), dstPath)
+	r.True(errors.Is(err, repo.ErrRestoreNotEmpty), "got: %v", err)
+
+	stale := dstRepo.GetPath("stale-file")
+	r.NoError(ioutil.WriteFile(stale, []byte("old"), 0600))
+	r.NoError(repo.Restore(bytes.NewReader(snapshot.Bytes()), dstPath, repo.ForceRestore()))
+	_, err = os.Stat(stale)
+	r.True(os.IsNotExist(err), "old contents should be removed")
+	_, err = os.Stat(dstRepo.GetPath("secret"))
+	r.NoError(err)
+
+	// a broken archive fails before anything of the repo is replaced
+	r.NoError(ioutil.WriteFile(stale, []byte("old"), 0600))
+	truncated := snapshot.Bytes()[:snapshot.Len()/2]
+	err = repo.Restore(bytes.NewReader(truncated), dstPath, repo.ForceRestore())
+	r.Error(err)
+	_, err = os.Stat(stale)
+	r.NoError(err, "old contents should be kept")
+	restoredKp, err = repo.DefaultKeyPair(dstRepo, refs.RefAlgoFeedSSB1)
+	r.NoError(err)
+	r.True(restoredKp.ID().Equal(kp.ID()))
+
+	// as does an archive that isn't a repo
+	var notARepo bytes.Buffer
+	r.NoError(repo.Snapshot(repo.New(filepath.Join(base, "empty")), &notARepo))
+	err = repo.Restore(bytes.NewReader(notARepo.Bytes()), dstPath, repo.ForceRestore())
+	r.Error(err)
+	_, err = os.Stat(stale)
+	r.NoError(err, "old contents should be kept")
+
+	// no staging folders are left behind
+	leftovers, err := filepath.Glob(dstPath + ".*")
+	r.NoError(err)
+	r.Empty(leftovers)
+}
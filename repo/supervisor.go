@@ -0,0 +1,134 @@
+// SPDX-FileCopyrightText: 2021 The Go-SSB Authors
+//
+// SPDX-License-Identifier: MIT
+
+package repo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/ssbc/margaret"
+	"go.mindeco.de/log"
+	"go.mindeco.de/log/level"
+
+	"github.com/ssbc/go-ssb"
+)
+
+// ServeFunc processes rootLog until ctx is canceled or it is done.
+type ServeFunc func(ctx context.Context, rootLog margaret.Log) error
+
+// minSupervisorBackoff is the shortest wait between restarts, so that a MinBackoff of zero doesn't make a failing serve function spin.
+const minSupervisorBackoff = 10 * time.Millisecond
+
+// Supervisor runs serve functions, like the ones of indexes, under the context of a repository.
+// After the context is canceled, Wait returns once all of them exited.
+type Supervisor struct {
+	r       Interface
+	rootLog margaret.Log
+
+	// Restart makes the supervisor run a serve function again if it returns an error before the context is canceled.
+	Restart bool
+
+	// MinBackoff is how long the supervisor waits before the first restart. It doubles after each failure up to MaxBackoff.
+	// It is at least 10ms.
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+
+	// HealthyAfter is how long a serve function has to run before it failed, for the backoff to start at MinBackoff again.
+	HealthyAfter time.Duration
+
+	wg sync.WaitGroup
+
+	errMu sync.Mutex
+	errs  []error
+}
+
+// NewSupervisor returns a supervisor for the serve functions over rootLog.
+// It restarts failing serve functions after waiting between a second and a minute.
+// Once one ran for a minute, it is restarted after a second again.
+func NewSupervisor(r Interface, rootLog margaret.Log) *Supervisor {
+	return &Supervisor{
+		r:       r,
+		rootLog: rootLog,
+
+		Restart:      true,
+		MinBackoff:   time.Second,
+		MaxBackoff:   time.Minute,
+		HealthyAfter: time.Minute,
+	}
+}
+
+// Go runs serve in a new goroutine.
+// A serve function which returns without an error is done and not started again.
+func (s *Supervisor) Go(name string, serve ServeFunc) {
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		if err := s.run(name, serve); err != nil {
+			s.errMu.Lock()
+			s.errs = append(s.errs, err)
+			s.errMu.Unlock()
+		}
+	}()
+}
+
+func (s *Supervisor) run(name string, serve ServeFunc) error {
+	ctx := s.r.Context()
+	logger := log.With(s.r.Logger(), "serve", name)
+
+	minBackoff := s.MinBackoff
+	if minBackoff < minSupervisorBackoff {
+		minBackoff = minSupervisorBackoff
+	}
+	maxBackoff := s.MaxBackoff
+	if maxBackoff < minBackoff {
+		maxBackoff = minBackoff
+	}
+
+	backoff := minBackoff
+	for {
+		started := time.Now()
+		err := serve(ctx, s.rootLog)
+		if err == nil || ctx.Err() != nil || errors.Is(err, context.Canceled) || errors.Is(err, ssb.ErrShuttingDown) {
+			return nil
+		}
+
+		if !s.Restart {
+			level.Error(logger).Log("event", "serve-failed", "err", err)
+			return fmt.Errorf("supervisor: %s failed: %w", name, err)
+		}
+
+		if s.HealthyAfter > 0 && time.Since(started) >= s.HealthyAfter {
+			backoff = minBackoff
+		}
+
+		level.Warn(logger).Log("event", "serve-restart", "err", err, "backoff", backoff)
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(backoff):
+		}
+
+		backoff *= 2
+		if backoff > maxBackoff {
+			backoff = maxBackoff
+		}
+	}
+}
+
+// Wait blocks until all serve functions exited.
+// It returns the first error of the ones which failed and weren't restarted.
+func (s *Supervisor) Wait() error {
+	s.wg.Wait()
+
+	s.errMu.Lock()
+	defer s.errMu.Unlock()
+	if len(s.errs) == 0 {
+		return nil
+	}
+	return s.errs[0]
+}
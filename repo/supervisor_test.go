@@ -0,0 +1,153 @@
+// SPDX-FileCopyrightText: 2021 The Go-SSB Authors
+//
+// SPDX-License-Identifier: MIT
+
+package repo_test
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ssbc/margaret"
+	"github.com/ssbc/margaret/mem"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ssbc/go-ssb/repo"
+)
+
+func TestSupervisor(t *testing.T) {
+	r := require.New(t)
+
+	rpo := repo.New(t.TempDir())
+	rootLog := mem.New()
+
+	sv := repo.NewSupervisor(rpo, rootLog)
+	sv.MinBackoff = time.Millisecond
+	sv.MaxBackoff = 10 * time.Millisecond
+
+	errTransient := errors.New("transient")
+
+	// fails twice and then runs until it is canceled
+	var flakyRuns int32
+	sv.Go("flaky", func(ctx context.Context, log margaret.Log) error {
+		r.Equal(rootLog, log)
+		if atomic.AddInt32(&flakyRuns, 1) <= 2 {
+			return errTransient
+		}
+		<-ctx.Done()
+		return ctx.Err()
+	})
+
+	var doneRuns int32
+	sv.Go("done", func(ctx context.Context, log margaret.Log) error {
+		atomic.AddInt32(&doneRuns, 1)
+		return nil
+	})
+
+	r.Eventually(func() bool { return atomic.LoadInt32(&flakyRuns) == 3 }, 5*time.Second, time.Millisecond)
+
+	r.NoError(rpo.Close())
+
+	waitErr := make(chan error)
+	go func() { waitErr <- sv.Wait() }()
+	select {
+	case err := <-waitErr:
+		r.NoError(err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("supervisor didn't stop after cancel")
+	}
+
+	r.EqualValues(3, atomic.LoadInt32(&flakyRuns))
+	r.EqualValues(1, atomic.LoadInt32(&doneRuns), "finished serve functions aren't restarted")
+}
+
+func TestSupervisorNoRestart(t *testing.T) {
+	r := require.New(t)
+
+	rpo := repo.New(t.TempDir())
+	defer rpo.Close()
+
+	sv := repo.NewSupervisor(rpo, mem.New())
+	sv.Restart = false
+
+	errBroken := errors.New("broken")
+	var runs int32
+	sv.Go("broken", func(ctx context.Context, log margaret.Log) error {
+		atomic.AddInt32(&runs, 1)
+		return errBroken
+	})
+
+	err := sv.Wait()
+	r.True(errors.Is(err, errBroken), "wrong error: %v", err)
+	r.EqualValues(1, atomic.LoadInt32(&runs))
+}
+
+func TestSupervisorBackoff(t *testing.T) {
+	r := require.New(t)
+
+	rpo := repo.New(t.TempDir())
+	defer rpo.Close()
+
+	sv := repo.NewSupervisor(rpo, mem.New())
+	sv.MinBackoff = 10 * time.Millisecond
+	sv.MaxBackoff = time.Second
+	sv.HealthyAfter = 50 * time.Millisecond
+
+	errTransient := errors.New("transient")
+
+	// fails right away four times, which grows the backoff to 160ms,
+	// then fails after running for longer than HealthyAfter
+	var (
+		runs   int32
+		failed = make(chan time.Time, 1)
+		again  = make(chan time.Time, 1)
+	)
+	sv.Go("flaky", func(ctx context.Context, log margaret.Log) error {
+		switch n := atomic.AddInt32(&runs, 1); {
+		case n <= 4:
+			return errTransient
+		case n == 5:
+			time.Sleep(60 * time.Millisecond)
+			failed <- time.Now()
+			return errTransient
+		default:
+			again <- time.Now()
+			<-ctx.Done()
+			return ctx.Err()
+		}
+	})
+
+	failedAt := <-failed
+	restartedAt := <-again
+	r.Less(int64(restartedAt.Sub(failedAt)), int64(100*time.Millisecond), "backoff wasn't reset after a healthy run")
+
+	r.NoError(rpo.Close())
+	r.NoError(sv.Wait())
+}
+
+func TestSupervisorMinBackoffFloor(t *testing.T) {
+	r := require.New(t)
+
+	rpo := repo.New(t.TempDir())
+	defer rpo.Close()
+
+	sv := repo.NewSupervisor(rpo, mem.New())
+	sv.MinBackoff = 0
+	sv.MaxBackoff = 0
+
+	var runs int32
+	sv.Go("broken", func(ctx context.Context, log margaret.Log) error {
+		atomic.AddInt32(&runs, 1)
+		return errors.New("broken")
+	})
+
+	time.Sleep(100 * time.Millisecond)
+	r.NoError(rpo.Close())
+	r.NoError(sv.Wait())
+
+	// at most one restart every 10ms
+	r.LessOrEqual(atomic.LoadInt32(&runs), int32(12))
+}
@@ -0,0 +1,183 @@
+// SPDX-FileCopyrightText: 2021 The Go-SSB Authors
+//
+// SPDX-License-Identifier: MIT
+
+package repo
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/ssbc/margaret"
+
+	"github.com/ssbc/go-ssb/message/legacy"
+	"github.com/ssbc/go-ssb/message/multimsg"
+)
+
+// LogReport is the result of VerifyLog.
+type LogReport struct {
+	// RootSeq is the sequence of the last entry in the root log.
+	RootSeq int64
+
+	// Checked is how many entries were checked, Nulled how many of them were nulled and not checked any further.
+	Checked int64
+	Nulled  int64
+
+	// Failures is how many entries couldn't be decoded or have a message which doesn't match its key or signature.
+	Failures int64
+
+	// FirstBad is the sequence of the first of these, or margaret.SeqEmpty if there is none. FirstErr is what was wrong with it.
+	FirstBad int64
+	FirstErr error
+
+	// Next is the sequence of the next entry to check.
+	// If the scan was stopped before it reached the end of the log, VerifyLogResume continues from there.
+	Next int64
+}
+
+// Complete returns true if the scan reached the end of the log.
+func (lr LogReport) Complete() bool { return lr.Next > lr.RootSeq }
+
+// OK returns true if all the checked entries are fine.
+func (lr LogReport) OK() bool { return lr.Failures == 0 }
+
+func (lr *LogReport) fail(seq int64, err error) {
+	if lr.Failures == 0 {
+		lr.FirstBad = seq
+		lr.FirstErr = err
+	}
+	lr.Failures++
+}
+
+type verifyLogOptions struct {
+	ctx     context.Context
+	hmacKey *[32]byte
+	prev    *LogReport
+}
+
+// VerifyLogOption changes how VerifyLog behaves.
+type VerifyLogOption func(*verifyLogOptions)
+
+// VerifyLogContext stops the scan when ctx is canceled. VerifyLog then returns what it found so far and the error of ctx.
+func VerifyLogContext(ctx context.Context) VerifyLogOption {
+	return func(o *verifyLogOptions) {
+		o.ctx = ctx
+	}
+}
+
+// VerifyLogHMAC sets the key for the signatures of the messages, if the network uses HMAC signing.
+func VerifyLogHMAC(key *[32]byte) VerifyLogOption {
+	return func(o *verifyLogOptions) {
+		o.hmacKey = key
+	}
+}
+
+// VerifyLogResume continues the scan of prev, from prev.Next, and adds what it finds to it.
+func VerifyLogResume(prev LogReport) VerifyLogOption {
+	return func(o *verifyLogOptions) {
+		o.prev = &prev
+	}
+}
+
+// VerifyLog reads every entry of the root log of the repo and checks it: it needs to decode and its message needs to have
+// a valid signature and the key it is stored with. Nulled entries are skipped.
+// Corruption of the log is otherwise only noticed when the entry is used.
+//
+// It doesn't modify anything. Like Fsck, it fails with ErrRepoLocked if the repo is in use.
+// On a large log, the scan can be stopped with VerifyLogContext and continued later with VerifyLogResume.
+func VerifyLog(r Interface, opts ...VerifyLogOption) (LogReport, error) {
+	o := verifyLogOptions{ctx: context.Background()}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	report := LogReport{FirstBad: margaret.SeqEmpty}
+	if o.prev != nil {
+		report = *o.prev
+	}
+
+	lock, err := AcquireLock(r)
+	if err != nil {
+		return report, fmt.Errorf("verifyLog: %w", err)
+	}
+	defer lock.Close()
+
+	rootLog, err := OpenLog(r)
+	if err != nil {
+		return report, fmt.Errorf("verifyLog: failed to open root log: %w", err)
+	}
+	defer rootLog.Close()
+
+	report.RootSeq = rootLog.Seq()
+
+	var buf bytes.Buffer
+	for ; report.Next <= report.RootSeq; report.Next++ {
+		if err := o.ctx.Err(); err != nil {
+			return report, fmt.Errorf("verifyLog: stopped at %d: %w", report.Next, err)
+		}
+
+		seq := report.Next
+		report.Checked++
+
+		v, err := rootLog.Get(seq)
+		if err == nil {
+			if errV, ok := v.(error); ok {
+				err = errV
+			}
+		}
+		if err != nil {
+			if margaret.IsErrNulled(err) {
+				report.Nulled++
+				continue
+			}
+			report.fail(seq, fmt.Errorf("failed to decode entry: %w", err))
+			continue
+		}
+
+		if err := verifyStoredMessage(v, o.hmacKey, &buf); err != nil {
+			report.fail(seq, err)
+		}
+	}
+	return report, nil
+}
+
+// verifyStoredMessage checks the signature of an entry of the root log and that its key matches the message
+func verifyStoredMessage(v interface{}, hmacKey *[32]byte, buf *bytes.Buffer) error {
+	mm, ok := v.(*multimsg.MultiMessage)
+	if !ok {
+		return fmt.Errorf("unexpected entry type: %T", v)
+	}
+
+	if sm, ok := mm.AsLegacy(); ok {
+		buf.Reset()
+		ref, dmsg, err := legacy.VerifyWithBuffer(sm.Raw_, hmacKey, buf)
+		if err != nil {
+			return err
+		}
+		if !ref.Equal(sm.Key()) {
+			return fmt.Errorf("stored key %s doesn't match the message %s", sm.Key().ShortSigil(), ref.ShortSigil())
+		}
+		if !dmsg.Author.Equal(sm.Author()) || dmsg.Sequence != sm.Seq() {
+			return fmt.Errorf("stored author and sequence don't match the message")
+		}
+		return nil
+	}
+
+	if tr, ok := mm.AsGabby(); ok {
+		if !tr.Verify(hmacKey) {
+			return errors.New("invalid gabbygrove signature")
+		}
+		return nil
+	}
+
+	if msg, ok := mm.AsMetaFeed(); ok {
+		if !msg.Verify(hmacKey) {
+			return errors.New("invalid metafeed signature")
+		}
+		return nil
+	}
+
+	return errors.New("unknown message format")
+}
@@ -0,0 +1,100 @@
+// SPDX-FileCopyrightText: 2021 The Go-SSB Authors
+//
+// SPDX-License-Identifier: MIT
+
+package repo_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ssbc/margaret"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ssbc/go-ssb"
+	refs "github.com/ssbc/go-ssb-refs"
+	"github.com/ssbc/go-ssb/internal/asynctesting"
+	"github.com/ssbc/go-ssb/internal/storedrefs"
+	"github.com/ssbc/go-ssb/message"
+	"github.com/ssbc/go-ssb/multilogs"
+	"github.com/ssbc/go-ssb/repo"
+)
+
+func TestVerifyLog(t *testing.T) {
+	r := require.New(t)
+
+	rpath := filepath.Join("testrun", t.Name())
+	os.RemoveAll(rpath)
+	testRepo := repo.New(rpath)
+
+	rl, err := repo.OpenLog(testRepo)
+	r.NoError(err)
+	userFeeds, userFeedsSnk, err := repo.OpenStandaloneMultiLog(testRepo, "testUsers", multilogs.UserFeedsUpdate)
+	r.NoError(err)
+	ctx, cancel := context.WithCancel(context.TODO())
+	usersErrc := asynctesting.ServeLog(ctx, "users", rl, userFeedsSnk, true)
+
+	kp, err := ssb.NewKeyPair(nil, refs.RefAlgoFeedSSB1)
+	r.NoError(err)
+	publisher, err := message.OpenPublishLog(rl, userFeeds, kp)
+	r.NoError(err)
+	sublog, err := userFeeds.Get(storedrefs.Feed(kp.ID()))
+	r.NoError(err)
+	const msgCount = 10
+	for i := 0; i < msgCount; i++ {
+		_, err = publisher.Publish(refs.NewPost(fmt.Sprintf("hello %d", i)))
+		r.NoError(err)
+		want := int64(i)
+		r.Eventually(func() bool { return sublog.Seq() == want }, time.Second, 10*time.Millisecond)
+	}
+
+	cancel()
+	r.NoError(<-usersErrc)
+	r.NoError(userFeeds.Close())
+	r.NoError(rl.Null(2))
+	r.NoError(rl.Close())
+
+	report, err := repo.VerifyLog(testRepo)
+	r.NoError(err)
+	r.True(report.Complete())
+	r.True(report.OK(), "unexpected failure at %d: %v", report.FirstBad, report.FirstErr)
+	r.EqualValues(msgCount, report.Checked)
+	r.EqualValues(1, report.Nulled)
+	r.EqualValues(margaret.SeqEmpty, report.FirstBad)
+
+	// change the text of one message, without touching the structure of the log
+	dataPath := testRepo.GetPath("log", "data")
+	data, err := os.ReadFile(dataPath)
+	r.NoError(err)
+	r.Equal(1, bytes.Count(data, []byte("hello 6")))
+	data = bytes.Replace(data, []byte("hello 6"), []byte("jello 6"), 1)
+	r.NoError(os.WriteFile(dataPath, data, 0600))
+
+	// a canceled scan can be resumed
+	ctx, cancel = context.WithCancel(context.Background())
+	cancel()
+	report, err = repo.VerifyLog(testRepo, repo.VerifyLogContext(ctx))
+	r.True(errors.Is(err, context.Canceled), "unexpected error: %v", err)
+	r.False(report.Complete())
+	r.EqualValues(0, report.Next)
+
+	report, err = repo.VerifyLog(testRepo, repo.VerifyLogResume(report))
+	r.NoError(err)
+	r.True(report.Complete())
+	r.False(report.OK())
+	r.EqualValues(1, report.Failures)
+	r.EqualValues(6, report.FirstBad)
+	r.Error(report.FirstErr)
+	r.EqualValues(msgCount, report.Checked)
+
+	// the log wasn't changed
+	after, err := os.ReadFile(dataPath)
+	r.NoError(err)
+	r.Equal(data, after)
+}
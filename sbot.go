@@ -5,6 +5,7 @@
 package ssb
 
 import (
+	"errors"
 	"fmt"
 
 	refs "github.com/ssbc/go-ssb-refs"
@@ -106,9 +107,43 @@ func (upto ReplicateUpToResponse) Seq() int64 {
 
 type ReplicateUpToResponseSet map[string]ReplicateUpToResponse
 
-// FeedsWithSeqs returns a source that emits one ReplicateUpToResponse per stored feed in feedIndex
+// FeedsWithSeqs returns a source that emits one ReplicateUpToResponse per stored feed in feedIndex.
+// The messages of the sublogs are looked up in rxlog.
 // TODO: make cancelable and with no RAM overhead when only partially used (iterate on demand)
-func FeedsWithSeqs(feedIndex multilog.MultiLog) (ReplicateUpToResponseSet, error) {
+func FeedsWithSeqs(rxlog margaret.Log, feedIndex multilog.MultiLog) (ReplicateUpToResponseSet, error) {
+	allTheFeeds, err := storedFeeds(feedIndex)
+	if err != nil {
+		return nil, err
+	}
+
+	return WantedFeedsWithSeqs(rxlog, feedIndex, allTheFeeds)
+}
+
+// Frontier returns the sequence of the latest stored message of every feed in feedIndex, keyed by their string reference.
+// It is what we have of each feed, peers can compare it with theirs using FeedsBehind.
+func Frontier(rxlog margaret.Log, feedIndex multilog.MultiLog) (map[string]int64, error) {
+	allTheFeeds, err := storedFeeds(feedIndex)
+	if err != nil {
+		return nil, err
+	}
+
+	return LatestSequences(rxlog, feedIndex, allTheFeeds)
+}
+
+// FeedsBehind returns the feeds which are further along in theirs than in ours, with the sequence of theirs.
+// Feeds that are missing in ours count as sequence 0.
+func FeedsBehind(ours, theirs map[string]int64) map[string]int64 {
+	behind := make(map[string]int64)
+	for feed, seq := range theirs {
+		if seq > ours[feed] {
+			behind[feed] = seq
+		}
+	}
+	return behind
+}
+
+// storedFeeds lists the feeds of feedIndex
+func storedFeeds(feedIndex multilog.MultiLog) ([]refs.FeedRef, error) {
 	storedFeeds, err := feedIndex.List()
 	if err != nil {
 		return nil, fmt.Errorf("feedSrc: did not get user list: %w", err)
@@ -128,16 +163,35 @@ func FeedsWithSeqs(feedIndex multilog.MultiLog) (ReplicateUpToResponseSet, error
 			return nil, fmt.Errorf("feedSrc(%d): failed to get feed: %w", i, err)
 		}
 	}
-
-	return WantedFeedsWithSeqs(feedIndex, allTheFeeds)
+	return allTheFeeds, nil
 }
 
 // WantedFeedsWithSeqs is like FeedsWithSeqs but omits feeds that are not in the wanted list.
-func WantedFeedsWithSeqs(feedIndex multilog.MultiLog, wanted []refs.FeedRef) (ReplicateUpToResponseSet, error) {
+func WantedFeedsWithSeqs(rxlog margaret.Log, feedIndex multilog.MultiLog, wanted []refs.FeedRef) (ReplicateUpToResponseSet, error) {
+	latest, err := LatestSequences(rxlog, feedIndex, wanted)
+	if err != nil {
+		return nil, err
+	}
+
 	var feedsWithSeqs = make(ReplicateUpToResponseSet, len(wanted))
+	for _, author := range wanted {
+		feedsWithSeqs[author.String()] = ReplicateUpToResponse{
+			ID:       author,
+			Sequence: latest[author.String()],
+		}
+	}
+	return feedsWithSeqs, nil
+}
 
-	for i, author := range wanted {
+// LatestSequences returns the sequence of the latest stored message for each of the feeds, keyed by their string reference.
+// Feeds that are not stored have sequence 0.
+//
+// The sequence is read from the latest message in rxlog, since sliced feeds and feeds with a retention limit
+// have fewer entries in their sublog than messages.
+func LatestSequences(rxlog margaret.Log, feedIndex multilog.MultiLog, feeds []refs.FeedRef) (map[string]int64, error) {
+	var latest = make(map[string]int64, len(feeds))
 
+	for i, author := range feeds {
 		idxAddr := storedrefs.Feed(author)
 
 		isStored, err := multilog.Has(feedIndex, idxAddr)
@@ -146,10 +200,7 @@ func WantedFeedsWithSeqs(feedIndex multilog.MultiLog, wanted []refs.FeedRef) (Re
 		}
 
 		if !isStored {
-			feedsWithSeqs[author.String()] = ReplicateUpToResponse{
-				ID:       author,
-				Sequence: 0,
-			}
+			latest[author.String()] = 0
 			continue
 		}
 
@@ -158,12 +209,45 @@ func WantedFeedsWithSeqs(feedIndex multilog.MultiLog, wanted []refs.FeedRef) (Re
 			return nil, fmt.Errorf("feedSrc(%d): did not load sublog: %w", i, err)
 		}
 
-		feedsWithSeqs[author.String()] = ReplicateUpToResponse{
-			ID:       author,
-			Sequence: subLog.Seq() + 1,
+		latest[author.String()], err = latestSequence(rxlog, subLog)
+		if err != nil {
+			return nil, fmt.Errorf("feedSrc(%d): %w", i, err)
 		}
+	}
+
+	return latest, nil
+}
 
+// latestSequence returns the sequence of the latest message of subLog.
+// If it is nulled, it counts on from the newest one which isn't.
+func latestSequence(rxlog, subLog margaret.Log) (int64, error) {
+	latest := subLog.Seq()
+	if latest < 0 {
+		return 0, nil
 	}
 
-	return feedsWithSeqs, nil
+	for i := latest; i >= 0; i-- {
+		v, err := subLog.Get(i)
+		if err != nil {
+			return 0, fmt.Errorf("failed to get sublog entry %d: %w", i, err)
+		}
+		rxSeq, ok := v.(int64)
+		if !ok {
+			return 0, fmt.Errorf("wrong sublog entry type: %T", v)
+		}
+
+		mv, err := rxlog.Get(rxSeq)
+		if err != nil {
+			if errors.Is(err, margaret.ErrNulled) {
+				continue
+			}
+			return 0, fmt.Errorf("failed to get message %d: %w", rxSeq, err)
+		}
+		msg, ok := mv.(refs.Message)
+		if !ok {
+			return 0, fmt.Errorf("wrong message type: %T", mv)
+		}
+		return msg.Seq() + latest - i, nil
+	}
+	return 0, fmt.Errorf("all messages of the sublog are nulled: %w", margaret.ErrNulled)
 }
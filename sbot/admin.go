@@ -0,0 +1,205 @@
+// SPDX-FileCopyrightText: 2021 The Go-SSB Authors
+//
+// SPDX-License-Identifier: MIT
+
+package sbot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/ssbc/go-luigi"
+	"github.com/ssbc/margaret"
+	librarian "github.com/ssbc/margaret/indexes"
+	"go.mindeco.de/log/level"
+
+	"github.com/ssbc/go-ssb"
+	refs "github.com/ssbc/go-ssb-refs"
+	"github.com/ssbc/go-ssb/blobstore"
+	"github.com/ssbc/go-ssb/internal/mutil"
+	"github.com/ssbc/go-ssb/internal/storedrefs"
+	"github.com/ssbc/go-ssb/plugins/admin"
+)
+
+// DefaultBlobGCGracePeriod is how old an unreferenced blob needs to be before GCBlobs deletes it, see WithBlobGCGracePeriod.
+// Blobs are usually added before the message which mentions them is published.
+const DefaultBlobGCGracePeriod = 24 * time.Hour
+
+// GCBlobs deletes the stored blobs which aren't referenced by any stored message and aren't wanted, and returns how many it deleted.
+// The references come from the BlobRefs index, which only looks at the content of public messages, and from the private messages the bot can decrypt.
+// Blobs which were stored less than the grace period ago (see WithBlobGCGracePeriod) are kept, since they might be about to be mentioned.
+// progress is called after every blob with the number of checked blobs and the number of stored blobs, it can be nil.
+func (s *Sbot) GCBlobs(ctx context.Context, progress func(done, total int64)) (int, error) {
+	modTimer, ok := s.BlobStore.(blobstore.ModTimer)
+	if !ok {
+		return 0, fmt.Errorf("sbot/gcBlobs: blob store %T can't tell the age of blobs", s.BlobStore)
+	}
+
+	grace := s.blobGCGrace
+	if grace == 0 {
+		grace = DefaultBlobGCGracePeriod
+	}
+	cutoff := time.Now().Add(-grace)
+
+	s.WaitUntilIndexesAreSynced()
+
+	privateRefs, err := s.privateBlobRefs(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("sbot/gcBlobs: %w", err)
+	}
+
+	var stored []refs.BlobRef
+	blobs := s.BlobStore.List()
+	for {
+		v, err := blobs.Next(ctx)
+		if err != nil {
+			if luigi.IsEOS(err) {
+				break
+			}
+			return 0, fmt.Errorf("sbot/gcBlobs: failed to list blobs: %w", err)
+		}
+		br, ok := v.(refs.BlobRef)
+		if !ok {
+			return 0, fmt.Errorf("sbot/gcBlobs: wrong blob list type: %T", v)
+		}
+		stored = append(stored, br)
+	}
+
+	var (
+		removed int
+		total   = int64(len(stored))
+	)
+	for i, br := range stored {
+		if err := ctx.Err(); err != nil {
+			return removed, err
+		}
+		if progress != nil {
+			progress(int64(i+1), total)
+		}
+
+		if s.WantManager != nil && s.WantManager.Wants(br) {
+			continue
+		}
+		if _, has := privateRefs[br.Sigil()]; has {
+			continue
+		}
+
+		storedAt, err := modTimer.ModTime(br)
+		if err != nil {
+			if errors.Is(err, blobstore.ErrNoSuchBlob) {
+				continue
+			}
+			return removed, fmt.Errorf("sbot/gcBlobs: failed to get age of %s: %w", br.ShortSigil(), err)
+		}
+		if storedAt.After(cutoff) {
+			continue
+		}
+
+		n, err := s.BlobRefs.Count(s.ReceiveLog, br)
+		if err != nil {
+			return removed, fmt.Errorf("sbot/gcBlobs: failed to count references of %s: %w", br.ShortSigil(), err)
+		}
+		if n > 0 {
+			continue
+		}
+
+		err = s.BlobStore.Delete(br)
+		if err != nil && !errors.Is(err, blobstore.ErrNoSuchBlob) {
+			return removed, fmt.Errorf("sbot/gcBlobs: failed to delete %s: %w", br.ShortSigil(), err)
+		}
+		removed++
+	}
+	level.Info(s.info).Log("event", "blob gc", "removed", removed)
+	return removed, nil
+}
+
+// privateBlobRefs returns the blobs referenced by the private messages the bot can decrypt, by their sigil.
+func (s *Sbot) privateBlobRefs(ctx context.Context) (map[string]struct{}, error) {
+	found := make(map[string]struct{})
+	for _, box := range []string{"box1:", "box2:"} {
+		readable, err := s.Private.Get(librarian.Addr(box) + storedrefs.Feed(s.KeyPair.ID()))
+		if err != nil {
+			return nil, fmt.Errorf("failed to open %s private sublog: %w", box, err)
+		}
+
+		src, err := mutil.Indirect(s.ReceiveLog, readable).Query()
+		if err != nil {
+			return nil, fmt.Errorf("failed to query %s private sublog: %w", box, err)
+		}
+		for {
+			v, err := src.Next(ctx)
+			if err != nil {
+				if luigi.IsEOS(err) {
+					break
+				}
+				if margaret.IsErrNulled(err) {
+					continue
+				}
+				return nil, fmt.Errorf("failed to get private message: %w", err)
+			}
+
+			msg, ok := v.(refs.Message)
+			if !ok {
+				if err, ok := v.(error); ok && margaret.IsErrNulled(err) {
+					continue
+				}
+				return nil, fmt.Errorf("unexpected private message type: %T", v)
+			}
+
+			content, err := s.Groups.DecryptMessage(msg)
+			if err != nil {
+				continue
+			}
+			blobs, err := ssb.ExtractBlobRefs(content)
+			if err != nil {
+				continue
+			}
+			for _, br := range blobs {
+				found[br.Sigil()] = struct{}{}
+			}
+		}
+	}
+	return found, nil
+}
+
+// maintainer runs the calls of the admin plugin
+type maintainer struct {
+	*Sbot
+}
+
+var _ admin.Maintainer = maintainer{}
+
+func (m maintainer) Reindex(ctx context.Context, name string, progress admin.ProgressFunc) error {
+	return m.Sbot.Reindex(ctx, name, progress)
+}
+
+func (m maintainer) GCBlobs(ctx context.Context, progress admin.ProgressFunc) (int, error) {
+	return m.Sbot.GCBlobs(ctx, progress)
+}
+
+func (m maintainer) FSCK(_ context.Context, full bool, progress admin.ProgressFunc) ([]string, error) {
+	mode := FSCKModeLength
+	if full {
+		mode = FSCKModeSequences
+	}
+
+	err := m.Sbot.FSCK(FSCKWithMode(mode), FSCKWithProgress(func(percentage float64, _ time.Duration) {
+		progress(int64(percentage), 100)
+	}))
+
+	var problems ErrConsistencyProblems
+	if errors.As(err, &problems) {
+		var found []string
+		for _, p := range problems.Errors {
+			found = append(found, p.Error())
+		}
+		return found, nil
+	}
+	var wrongSeq ssb.ErrWrongSequence
+	if errors.As(err, &wrongSeq) {
+		return []string{wrongSeq.Error()}, nil
+	}
+	return nil, err
+}
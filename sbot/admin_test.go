@@ -0,0 +1,123 @@
+// SPDX-FileCopyrightText: 2021 The Go-SSB Authors
+//
+// SPDX-License-Identifier: MIT
+
+package sbot_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/ssbc/go-muxrpc/v2"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ssbc/go-ssb"
+	refs "github.com/ssbc/go-ssb-refs"
+	"github.com/ssbc/go-ssb/blobstore"
+	"github.com/ssbc/go-ssb/internal/ssbtest"
+	"github.com/ssbc/go-ssb/plugins/admin"
+	"github.com/ssbc/go-ssb/sbot"
+)
+
+func TestAdminCalls(t *testing.T) {
+	r := require.New(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	adminKP, err := ssb.NewKeyPair(nil, refs.RefAlgoFeedSSB1)
+	r.NoError(err)
+
+	// node 1 is an admin of node 0, node 2 isn't
+	net := ssbtest.Network(t, 3,
+		ssbtest.WithNodeOptions(0, sbot.WithAdmins(adminKP.ID()), sbot.WithBlobGCGracePeriod(time.Second)),
+		ssbtest.WithNodeOptions(1, sbot.WithKeyPair(adminKP)),
+	)
+	net.Friends(0, 1)
+	net.Friends(0, 2)
+	net.Connect(1, 0)
+	net.Connect(2, 0)
+
+	pub := net.Nodes[0]
+	unused, err := pub.BlobStore.Put(bytes.NewReader([]byte("not mentioned anywhere")))
+	r.NoError(err)
+	used, err := pub.BlobStore.Put(bytes.NewReader([]byte("mentioned in a post")))
+	r.NoError(err)
+	net.Publish(0, map[string]interface{}{
+		"type":     "post",
+		"text":     "look at this",
+		"mentions": []interface{}{map[string]string{"link": used.Sigil()}},
+	})
+
+	// a blob which is only mentioned in a private message
+	private, err := pub.BlobStore.Put(bytes.NewReader([]byte("mentioned in a private message")))
+	r.NoError(err)
+	plain, err := json.Marshal(map[string]interface{}{
+		"type":     "post",
+		"text":     "only for me",
+		"mentions": []interface{}{map[string]string{"link": private.Sigil()}},
+	})
+	r.NoError(err)
+	boxed, err := pub.Groups.EncryptBox1(plain, pub.KeyPair.ID())
+	r.NoError(err)
+	net.Publish(0, base64.StdEncoding.EncodeToString(boxed)+".box")
+
+	// a blob which was just added is kept until it's older than the grace period
+	time.Sleep(1500 * time.Millisecond)
+	fresh, err := pub.BlobStore.Put(bytes.NewReader([]byte("not mentioned yet")))
+	r.NoError(err)
+
+	call := func(caller int, method string, args ...interface{}) ([]admin.Progress, error) {
+		edp, has := net.Nodes[caller].Network.GetEndpointFor(net.ID(0))
+		r.True(has)
+
+		src, err := edp.Source(ctx, muxrpc.TypeJSON, muxrpc.Method{"admin", method}, args...)
+		r.NoError(err)
+
+		var updates []admin.Progress
+		for src.Next(ctx) {
+			body, err := src.Bytes()
+			r.NoError(err)
+			var p admin.Progress
+			r.NoError(json.Unmarshal(body, &p))
+			updates = append(updates, p)
+		}
+		return updates, src.Err()
+	}
+
+	_, err = call(2, "gcBlobs")
+	r.Error(err, "non-admin could call gcBlobs")
+	_, err = pub.BlobStore.Size(unused)
+	r.NoError(err, "blob deleted by non-admin")
+
+	updates, err := call(1, "gcBlobs")
+	r.NoError(err)
+	r.True(len(updates) > 1, "expected progress before the result")
+	last := updates[len(updates)-1]
+	r.True(last.Finished)
+	r.Equal(map[string]interface{}{"removed": float64(1)}, last.Result)
+
+	_, err = pub.BlobStore.Size(unused)
+	r.True(errors.Is(err, blobstore.ErrNoSuchBlob), "unmentioned blob still there: %v", err)
+	for _, kept := range []refs.BlobRef{used, private, fresh} {
+		_, err = pub.BlobStore.Size(kept)
+		r.NoError(err, "blob %s was deleted", kept.ShortSigil())
+	}
+
+	updates, err = call(1, "reindex", map[string]string{"index": "get"})
+	r.NoError(err)
+	last = updates[len(updates)-1]
+	r.True(last.Finished)
+	r.Equal(last.Total, last.Done)
+
+	_, err = call(1, "reindex", map[string]string{"index": "nope"})
+	r.Error(err)
+
+	updates, err = call(1, "fsck")
+	r.NoError(err)
+	r.Equal(map[string]interface{}{"problems": []interface{}{}}, updates[len(updates)-1].Result)
+}
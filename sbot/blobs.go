@@ -0,0 +1,62 @@
+// SPDX-FileCopyrightText: 2021 The Go-SSB Authors
+//
+// SPDX-License-Identifier: MIT
+
+package sbot
+
+import (
+	"math"
+	"sync"
+
+	refs "github.com/ssbc/go-ssb-refs"
+
+	"github.com/ssbc/go-ssb/blobstore"
+	"github.com/ssbc/go-ssb/graph"
+)
+
+// blobFeedDistance tells the WantManager how far feeds are away from us in the follow graph,
+// so that it fetches the blobs of closer feeds first.
+// The lookup is only recomputed when the graph changed.
+func (s *Sbot) blobFeedDistance() blobstore.FeedDistance {
+	var (
+		mu        sync.Mutex
+		lastGraph *graph.Graph
+		lookup    *graph.Lookup
+	)
+	return func(feed refs.FeedRef) (int, bool) {
+		self := s.KeyPair.ID()
+		if feed.Equal(self) {
+			return 0, false
+		}
+
+		// the want manager is created before the graph
+		if s.GraphBuilder == nil {
+			return -1, false
+		}
+		g, err := s.GraphBuilder.Build()
+		if err != nil {
+			return -1, false
+		}
+		if g.Blocks(self, feed) {
+			return -1, true
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+		if g != lastGraph {
+			lookup, err = g.MakeDijkstra(self)
+			if err != nil {
+				lastGraph = nil
+				return -1, false
+			}
+			lastGraph = g
+		}
+
+		// the path includes us and the feed
+		p, d := lookup.Dist(feed)
+		if math.IsInf(d, 0) || len(p) < 2 {
+			return -1, false
+		}
+		return len(p) - 1, false
+	}
+}
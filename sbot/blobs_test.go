@@ -16,6 +16,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/ssbc/go-muxrpc/v2"
 	"github.com/ssbc/go-muxrpc/v2/debug"
 	"github.com/ssbc/go-ssb"
 	refs "github.com/ssbc/go-ssb-refs"
@@ -26,6 +27,7 @@ import (
 	"golang.org/x/sync/errgroup"
 
 	"github.com/ssbc/go-ssb/blobstore"
+	"github.com/ssbc/go-ssb/client"
 	"github.com/ssbc/go-ssb/internal/broadcasts"
 	"github.com/ssbc/go-ssb/internal/leakcheck"
 	"github.com/ssbc/go-ssb/internal/testutils"
@@ -613,3 +615,78 @@ func TestBlobsTooBig(t *testing.T) {
 	r.NoError(ali.Close())
 	r.NoError(bob.Close())
 }
+
+func TestBlobsServeLimitsOnlyForPeers(t *testing.T) {
+	r := require.New(t)
+	ctx, cancel := context.WithCancel(context.TODO())
+	defer cancel()
+
+	testPath := filepath.Join("testrun", t.Name())
+	os.RemoveAll(testPath)
+
+	appKey := make([]byte, 32)
+	rand.Read(appKey)
+	info := testutils.NewRelativeTimeLogger(nil)
+
+	srvGroup, ctx := errgroup.WithContext(ctx)
+	const maxServe = 100
+	ali, err := New(
+		WithAppKey(appKey),
+		WithContext(ctx),
+		WithInfo(log.With(info, "peer", "ali")),
+		WithRepoPath(filepath.Join(testPath, "ali")),
+		WithListenAddr(":0"),
+		WithBlobMaxServeSize(maxServe),
+		LateOption(WithUNIXSocket()),
+	)
+	r.NoError(err)
+	srvGroup.Go(func() error { return ali.Network.Serve(ctx) })
+
+	bob, err := New(
+		WithAppKey(appKey),
+		WithContext(ctx),
+		WithInfo(log.With(info, "peer", "bob")),
+		WithRepoPath(filepath.Join(testPath, "bob")),
+		WithListenAddr(":0"),
+	)
+	r.NoError(err)
+	srvGroup.Go(func() error { return bob.Network.Serve(ctx) })
+
+	big := bytes.Repeat([]byte("x"), 10*maxServe)
+	ref, err := ali.BlobStore.Put(bytes.NewReader(big))
+	r.NoError(err)
+
+	// the bot's own clients get it
+	c, err := client.NewUnix(filepath.Join(testPath, "ali", "socket"))
+	r.NoError(err)
+	rd, err := c.BlobsGet(ref)
+	r.NoError(err)
+	got, err := io.ReadAll(rd)
+	r.NoError(err)
+	r.Equal(big, got)
+	r.NoError(c.Close())
+
+	// peers don't
+	ali.Replicate(bob.KeyPair.ID())
+	bob.Replicate(ali.KeyPair.ID())
+	r.NoError(bob.Network.Connect(ctx, ali.Network.GetListenAddr()))
+	var edp muxrpc.Endpoint
+	r.Eventually(func() bool {
+		var has bool
+		edp, has = bob.Network.GetEndpointFor(ali.KeyPair.ID())
+		return has
+	}, 5*time.Second, 50*time.Millisecond)
+
+	src, err := edp.Source(ctx, muxrpc.TypeBinary, muxrpc.Method{"blobs", "get"}, ref)
+	r.NoError(err)
+	for src.Next(ctx) {
+	}
+	r.Error(src.Err(), "peer got a blob larger than the limit")
+
+	cancel()
+	ali.Shutdown()
+	bob.Shutdown()
+	r.NoError(ali.Close())
+	r.NoError(bob.Close())
+	srvGroup.Wait()
+}
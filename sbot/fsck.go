@@ -22,6 +22,8 @@ import (
 	"go.mindeco.de/log/level"
 
 	"github.com/ssbc/go-ssb"
+	"github.com/ssbc/go-ssb/internal/storedrefs"
+	"github.com/ssbc/go-ssb/message"
 	"github.com/ssbc/go-ssb/multilogs"
 )
 
@@ -133,7 +135,7 @@ func (s *Sbot) FSCK(opts ...FSCKOption) error {
 		return lengthFSCK(opt.feedsIdx, s.ReceiveLog)
 
 	case FSCKModeSequences:
-		return sequenceFSCK(s.ReceiveLog, opt.progressFn)
+		return sequenceFSCK(opt.feedsIdx, s.ReceiveLog, opt.progressFn)
 
 	default:
 		return errors.New("sbot: unknown fsck mode")
@@ -142,7 +144,8 @@ func (s *Sbot) FSCK(opts ...FSCKOption) error {
 
 // lengthFSCK just checks the length of each stored feed.
 // It expects a multilog as first parameter where each sublog is one feed
-// and each entry maps to another entry in the receiveLog
+// and each entry maps to another entry in the receiveLog.
+// Sliced feeds don't start at 1, so the length is counted from the origin of the feed.
 func lengthFSCK(authorMlog multilog.MultiLog, receiveLog margaret.Log) error {
 	feeds, err := authorMlog.List()
 	if err != nil {
@@ -179,6 +182,14 @@ func lengthFSCK(authorMlog multilog.MultiLog, receiveLog margaret.Log) error {
 		if !ok {
 			return fmt.Errorf("fsck/length: failed to get rxlog entry for index entry %d for author %q: %w", currentSeqFromIndex, author, err)
 		}
+
+		origin, err := message.FeedOrigin(receiveLog, subLog)
+		if err != nil {
+			if margaret.IsErrNulled(err) {
+				continue
+			}
+			return fmt.Errorf("fsck/length: failed to get origin of %q: %w", author, err)
+		}
 		rv, err := receiveLog.Get(rxSeq)
 		if err != nil {
 			if margaret.IsErrNulled(err) {
@@ -188,8 +199,8 @@ func lengthFSCK(authorMlog multilog.MultiLog, receiveLog margaret.Log) error {
 		}
 		msg := rv.(refs.Message)
 
-		// margaret indexes are 0-based, therefore +1
-		if msg.Seq() != currentSeqFromIndex+1 {
+		// margaret indexes are 0-based and start at the origin
+		if msg.Seq() != currentSeqFromIndex+origin {
 			fr, err := sr.Feed()
 			if err != nil {
 				return fmt.Errorf("fsck/length: failed to feed reference for author (%q): %w", author, err)
@@ -226,8 +237,9 @@ func (p *processedCounter) N() int64 {
 func (p *processedCounter) Err() error { return nil }
 
 // sequenceFSCK goes through every message in the receiveLog
-// and checks tha the sequence of a feed is correctly increasing by one each message
-func sequenceFSCK(receiveLog margaret.Log, progressFn FSCKUpdateFunc) error {
+// and checks tha the sequence of a feed is correctly increasing by one each message.
+// The first message of a feed has to be 1 or, for sliced feeds, the origin of the feed in the authorMlog.
+func sequenceFSCK(authorMlog multilog.MultiLog, receiveLog margaret.Log, progressFn FSCKUpdateFunc) error {
 	ctx := context.Background()
 
 	// the last sequence number we saw of that author
@@ -297,7 +309,20 @@ func sequenceFSCK(receiveLog margaret.Log, progressFn FSCKUpdateFunc) error {
 		currSeq, has := lastSequence[authorRef]
 
 		if !has {
-			if msgSeq != 1 { // not seen yet, so has to be the first
+			// not seen yet, so has to be the first or where the sliced feed starts.
+			// The messages before it might be nulled, like the ones dropped by the retention of the feed.
+			var origin int64 = 1
+			if msgSeq != 1 {
+				subLog, err := authorMlog.Get(storedrefs.Feed(msg.Author()))
+				if err != nil {
+					return fmt.Errorf("fsck/sequence: failed to get sublog for %s: %w", msg.Author().ShortSigil(), err)
+				}
+				origin, err = message.FeedOrigin(receiveLog, subLog)
+				if err != nil && !margaret.IsErrNulled(err) {
+					return fmt.Errorf("fsck/sequence: failed to get origin of %s: %w", msg.Author().ShortSigil(), err)
+				}
+			}
+			if msgSeq < origin {
 				seqErr := ssb.ErrWrongSequence{
 					Ref:     msg.Author(),
 					Stored:  sw.Seq(),
@@ -307,7 +332,7 @@ func sequenceFSCK(receiveLog margaret.Log, progressFn FSCKUpdateFunc) error {
 				lastSequence[authorRef] = -1
 				continue
 			}
-			lastSequence[authorRef] = 1
+			lastSequence[authorRef] = msgSeq
 			continue
 		}
 
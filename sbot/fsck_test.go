@@ -65,6 +65,7 @@ func TestFSCK(t *testing.T) {
 	t.Run("correct", testFSCKcorrect)
 	t.Run("double", testFSCKdouble)
 	t.Run("multipleFeeds", testFSCKmultipleFeeds)
+	t.Run("sliced", testFSCKsliced)
 	// t.Run("rerpo", testFSCKrerpo)
 }
 
@@ -242,6 +243,69 @@ func testFSCKmultipleFeeds(t *testing.T) {
 	r.NoError(theBot.Close())
 }
 
+func testFSCKsliced(t *testing.T) {
+	r := require.New(t)
+	ctx, cancel := context.WithCancel(context.TODO())
+	sourceBot, botOptions := makeFSCKTestBot(t)
+
+	const n = 10
+	for i := 1; i <= n; i++ {
+		post := refs.NewPost(fmt.Sprintf("test:%d", i))
+		_, err := sourceBot.PublishLog.Publish(post)
+		r.NoError(err)
+	}
+
+	// store the feed of the source from the 5th message onwards, like a sliced feed is stored
+	const origin = 5
+	slicedPath := filepath.Join("testrun", t.Name()+"-target")
+	theBot, err := New(append(botOptions, WithRepoPath(slicedPath))...)
+	r.NoError(err)
+
+	src, err := sourceBot.ReceiveLog.Query(margaret.Gt(origin - 2))
+	r.NoError(err)
+	for {
+		v, err := src.Next(ctx)
+		if err != nil {
+			if luigi.IsEOS(err) {
+				break
+			}
+			r.NoError(err)
+		}
+
+		_, err = theBot.ReceiveLog.Append(v)
+		r.NoError(err)
+	}
+
+	note, err := theBot.CurrentSequence(sourceBot.KeyPair.ID())
+	r.NoError(err)
+	r.EqualValues(n, note.Seq)
+
+	err = theBot.FSCK(FSCKWithMode(FSCKModeLength))
+	r.NoError(err)
+
+	err = theBot.FSCK(FSCKWithMode(FSCKModeSequences))
+	r.NoError(err)
+
+	// a repeated message after the origin is still found
+	last, err := sourceBot.ReceiveLog.Get(sourceBot.ReceiveLog.Seq())
+	r.NoError(err)
+	_, err = theBot.ReceiveLog.Append(last)
+	r.NoError(err)
+
+	err = theBot.FSCK(FSCKWithMode(FSCKModeLength))
+	r.Error(err)
+
+	err = theBot.FSCK(FSCKWithMode(FSCKModeSequences))
+	r.Error(err)
+
+	// cleanup
+	theBot.Shutdown()
+	sourceBot.Shutdown()
+	cancel()
+	r.NoError(theBot.Close())
+	r.NoError(sourceBot.Close())
+}
+
 // to use this, put the repo in
 func testFSCKrepro(t *testing.T) {
 	r := require.New(t)
@@ -10,6 +10,8 @@ import (
 	"github.com/ssbc/go-ssb"
 	refs "github.com/ssbc/go-ssb-refs"
 	"github.com/ssbc/go-ssb/internal/storedrefs"
+	"github.com/ssbc/go-ssb/message"
+	"github.com/ssbc/go-ssb/repo"
 )
 
 func (s *Sbot) Get(ref refs.MessageRef) (refs.Message, error) {
@@ -18,41 +20,38 @@ func (s *Sbot) Get(ref refs.MessageRef) (refs.Message, error) {
 		return nil, fmt.Errorf("sbot: get index disabled")
 	}
 
-	obs, err := getIdx.Get(s.rootCtx, storedrefs.Message(ref))
-	if err != nil {
-		return nil, fmt.Errorf("sbot/get: failed to get seq val from index: %w", err)
+	var (
+		msg refs.Message
+		err error
+	)
+	if s.getCache != nil {
+		msg, err = s.getCache.Get(ref)
+	} else {
+		msg, err = repo.Get(s.ReceiveLog, getIdx, ref)
 	}
-
-	v, err := obs.Value()
 	if err != nil {
-		return nil, fmt.Errorf("sbot/get: failed to get current value from obs: %w", err)
-	}
-
-	var seq int64
-	switch tv := v.(type) {
-	case int64:
-		if tv < 0 {
-			return nil, fmt.Errorf("invalid sequence stored in index")
-		}
-		seq = int64(tv)
-	default:
-		return nil, fmt.Errorf("sbot/get: wrong sequence type in index: %T", v)
+		return nil, fmt.Errorf("sbot/get: %w", err)
 	}
-
-	storedV, err := s.ReceiveLog.Get(seq)
-	if err != nil {
-		return nil, fmt.Errorf("sbot/get: failed to load message: %w", err)
-	}
-
-	msg, ok := storedV.(refs.Message)
-	if !ok {
-		return nil, fmt.Errorf("sbot/get: wrong message type in storeage: %T", storedV)
-	}
-
 	return msg, nil
 }
 
 func (s *Sbot) CurrentSequence(feed refs.FeedRef) (ssb.Note, error) {
+	if s.latestCache != nil {
+		latest, err := s.latestCache.Latest(feed)
+		if err != nil {
+			return ssb.Note{}, fmt.Errorf("failed to get latest message of %s: %w", feed.ShortSigil(), err)
+		}
+		currSeq := latest.Seq
+		if currSeq == 0 {
+			currSeq = -1
+		}
+		return ssb.Note{
+			Seq:       currSeq,
+			Replicate: true,
+			Receive:   true,
+		}, nil
+	}
+
 	l, err := s.Users.Get(storedrefs.Feed(feed))
 	if err != nil {
 		return ssb.Note{}, fmt.Errorf("failed to get user log for %s: %w", feed.ShortSigil(), err)
@@ -60,7 +59,12 @@ func (s *Sbot) CurrentSequence(feed refs.FeedRef) (ssb.Note, error) {
 
 	currSeq := l.Seq()
 	if currSeq != -1 {
-		currSeq++
+		// sliced feeds don't start at 1
+		origin, err := message.FeedOrigin(s.ReceiveLog, l)
+		if err != nil {
+			return ssb.Note{}, fmt.Errorf("failed to get origin of %s: %w", feed.ShortSigil(), err)
+		}
+		currSeq += origin
 	}
 
 	return ssb.Note{
@@ -12,10 +12,12 @@ import (
 	"github.com/ssbc/go-ssb/repo"
 )
 
+// PublishAs publishes val as the identity with the name nick from the repo of the bot, see repo.KeyPairNamed and repo.ListKeyPairs.
+// Each identity has its own feed.
 func (sbot *Sbot) PublishAs(nick string, val interface{}) (refs.Message, error) {
 	r := repo.New(sbot.repoPath)
 
-	kp, err := repo.LoadKeyPair(r, nick)
+	kp, err := repo.KeyPairNamed(r, nick)
 	if err != nil {
 		return nil, err
 	}
@@ -27,6 +29,9 @@ func (sbot *Sbot) PublishAs(nick string, val interface{}) (refs.Message, error)
 	if sbot.signHMACsecret != nil { // all feeds use the same settings right now
 		pubopts = append(pubopts, message.SetHMACKey(sbot.signHMACsecret))
 	}
+	if sbot.clock != nil {
+		pubopts = append(pubopts, message.UseClock(sbot.clock))
+	}
 
 	pl, err := message.OpenPublishLog(sbot.ReceiveLog, sbot.Users, kp, pubopts...)
 	if err != nil {
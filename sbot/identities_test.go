@@ -8,6 +8,7 @@ import (
 	"context"
 	"crypto/rand"
 	"encoding/json"
+	"fmt"
 	"os"
 	"path/filepath"
 	"testing"
@@ -157,3 +158,57 @@ func XTestMultipleIdentities(t *testing.T) {
 	mainbot.Shutdown()
 	r.NoError(mainbot.Close())
 }
+
+func TestPublishAsNamed(t *testing.T) {
+	defer leakcheck.Check(t)
+	r := require.New(t)
+
+	tRepoPath := filepath.Join("testrun", t.Name())
+	os.RemoveAll(tRepoPath)
+	tRepo := repo.New(tRepoPath)
+
+	kpAlice, err := repo.NewKeyPair(tRepo, "alice", refs.RefAlgoFeedSSB1)
+	r.NoError(err)
+	kpBob, err := repo.NewKeyPair(tRepo, "bob", refs.RefAlgoFeedSSB1)
+	r.NoError(err)
+
+	bot, err := New(
+		WithInfo(log.NewNopLogger()),
+		WithRepoPath(tRepoPath),
+		WithNamedKeyPair("alice"),
+		DisableNetworkNode(),
+	)
+	r.NoError(err)
+	r.True(bot.KeyPair.ID().Equal(kpAlice.ID()), "the bot isn't using the named identity")
+
+	_, err = bot.PublishLog.Publish(refs.NewPost("from the bot"))
+	r.NoError(err)
+	for i, as := range []string{"alice", "bob", "bob"} {
+		msg, err := bot.PublishAs(as, refs.NewPost(fmt.Sprint("hello ", i)))
+		r.NoError(err)
+		if as == "alice" {
+			r.True(msg.Author().Equal(kpAlice.ID()))
+		} else {
+			r.True(msg.Author().Equal(kpBob.ID()))
+		}
+	}
+	_, err = bot.PublishAs("claire", refs.NewPost("nobody"))
+	r.Error(err)
+
+	// each identity has its own feed
+	bot.WaitUntilIndexesAreSynced()
+	for _, tc := range []struct {
+		kp  ssb.KeyPair
+		seq int64
+	}{
+		{kpAlice, 1},
+		{kpBob, 1},
+	} {
+		feed, err := bot.Users.Get(storedrefs.Feed(tc.kp.ID()))
+		r.NoError(err)
+		r.Equal(tc.seq, feed.Seq())
+	}
+
+	bot.Shutdown()
+	r.NoError(bot.Close())
+}
@@ -6,7 +6,6 @@ package sbot
 
 import (
 	"context"
-	"errors"
 	"fmt"
 	"sync"
 	"sync/atomic"
@@ -163,6 +162,23 @@ func (s *Sbot) AreIndexesSynced() bool {
 	return s.idxNumSyncing == 0
 }
 
+// serveLatestCache pours the messages which are added to the receive log from now on into the latest cache.
+// The ones from before are loaded by the cache itself.
+func (s *Sbot) serveLatestCache() error {
+	src, err := s.ReceiveLog.Query(margaret.Live(true), margaret.SeqWrap(true), margaret.Gt(s.ReceiveLog.Seq()))
+	if err != nil {
+		return fmt.Errorf("sbot: failed to query receive log for the latest cache: %w", err)
+	}
+	s.idxDone.Go(func() error {
+		err := repo.RunPump(s.repo.Context(), "latest", s.latestCache, src)
+		if err != nil {
+			return fmt.Errorf("sbot: latest cache update failed: %w", err)
+		}
+		return nil
+	})
+	return nil
+}
+
 // the default is to fill an index with all messages
 func (s *Sbot) serveIndex(name string, snk librarian.SinkIndex) {
 	s.serveIndexFrom(name, snk, s.ReceiveLog)
@@ -174,63 +190,56 @@ contactLog, err := s.ByType.Get(librarian.Addr("contact"))
 if err != nil { ... }
 msgs := mutil.Indirect(s.ReceiveLog, contactLog)
 */
-func (s *Sbot) serveIndexFrom(name string, snk librarian.SinkIndex, msgs margaret.Log) {
+func (s *Sbot) serveIndexFrom(name string, idxSink librarian.SinkIndex, msgs margaret.Log) {
 	s.indexSyncStart()
 
+	// Reindex pours into the index as well
+	snk := &servedIndex{SinkIndex: idxSink, msgs: msgs}
+
 	s.indexStateMu.Lock()
 	s.indexStates[name] = "pending"
+	s.indexSinks[name] = snk
 	s.indexStateMu.Unlock()
 
 	s.idxDone.Go(func() error {
-
-		src, err := msgs.Query(margaret.Live(false), margaret.SeqWrap(true), snk.QuerySpec())
-		if err != nil {
-			return fmt.Errorf("sbot index(%s) error querying receiveLog for message backlog: %w", name, err)
-		}
-
-		logger := log.With(s.info, "index", name)
+		ctx := s.repo.Context()
+		logger := log.With(s.repo.Logger(), "index", name)
 
 		var ps progressSink
-		ps.backing = snk
+		ps.backing = repo.NewIndexLagSink(s.metrics, name, msgs, snk)
 
 		totalMessages := msgs.Seq()
 
-		ctx, cancel := context.WithCancel(s.rootCtx)
+		progressCtx, cancel := context.WithCancel(ctx)
 		go func() {
-			p := progress.NewTicker(ctx, &ps, int64(totalMessages), 7*time.Second)
-			pinfo := log.With(level.Info(logger), "event", "index-progress")
+			p := progress.NewTicker(progressCtx, &ps, int64(totalMessages), 7*time.Second)
 			for remaining := range p {
 				// how much time until it's done?
 				estDone := remaining.Estimated()
 				timeLeft := estDone.Sub(time.Now()).Round(time.Second)
 
-				pinfo.Log("done", remaining.Percent(), "time-left", timeLeft)
-
 				s.indexStateMu.Lock()
 				s.indexStates[name] = fmt.Sprintf("%.2f%% (time left:%s)", remaining.Percent(), timeLeft)
 				s.indexStateMu.Unlock()
 			}
 		}()
 
-		err = luigi.Pump(s.rootCtx, &ps, src)
+		// the repo logs the progress and stops serving when it is closed
+		err := repo.ServeIndex(s.repo, name, msgs, progressIndex{Sink: &ps, SinkIndex: snk}, false)
 		cancel()
 		s.indexSyncDone() // this needs to be before we can return for errors or idxInSync will not be updated correctly
-		if errors.Is(err, ssb.ErrShuttingDown) || errors.Is(err, context.Canceled) {
-			return nil
-		}
 		if err != nil {
 			s.indexStateMu.Lock()
 			s.indexStates[name] = err.Error()
 			s.indexStateMu.Unlock()
-			level.Warn(logger).Log("event", "index stopped", "err", err)
 			return fmt.Errorf("sbot index(%s) update of backlog failed: %w", name, err)
 		}
 
-		if !s.liveIndexUpdates {
+		if !s.liveIndexUpdates || ctx.Err() != nil {
 			return nil
 		}
 
-		src, err = msgs.Query(margaret.Live(true), margaret.SeqWrap(true), snk.QuerySpec())
+		src, err := msgs.Query(margaret.Live(true), margaret.SeqWrap(true), snk.QuerySpec())
 		if err != nil {
 			return fmt.Errorf("sbot index(%s) failed to query receive log for live updates: %w", name, err)
 		}
@@ -239,27 +248,8 @@ func (s *Sbot) serveIndexFrom(name string, snk librarian.SinkIndex, msgs margare
 		s.indexStates[name] = "live"
 		s.indexStateMu.Unlock()
 
-		startWaiting := func() {
-		}
-		doneWaiting := func() {
-		}
-		startProcessing := func() {
-			s.indexSyncStart()
-		}
-		doneProcessing := func() {
-			// don't clear the waitgroup right away but give it a little time in case it needs to continue on to another message.
-			// this adds a short (theoretically unnecessary) delay to publish operations but not append operations where
-			// we have received a message from somewhere else.
-			// TODO: eliminate this delay by finding a way to directly check if the luigi queue is completely empty
-			time.AfterFunc(100 * time.Millisecond, func() {
-				s.indexSyncDone()
-			})
-		}
-
-		err = luigi.PumpWithStatus(s.rootCtx, snk, src, startWaiting, doneWaiting, startProcessing, doneProcessing)
-		if errors.Is(err, ssb.ErrShuttingDown) || errors.Is(err, context.Canceled) {
-			return nil
-		}
+		live := syncingSink{s: s, backing: repo.NewIndexLagSink(s.metrics, name, msgs, snk)}
+		err = repo.RunPump(ctx, name, live, src)
 		if err != nil {
 			s.indexStateMu.Lock()
 			s.indexStates[name] = err.Error()
@@ -271,6 +261,94 @@ func (s *Sbot) serveIndexFrom(name string, snk librarian.SinkIndex, msgs margare
 	})
 }
 
+// syncingSink counts the live updates of an index as syncing, like the backlog
+type syncingSink struct {
+	s       *Sbot
+	backing luigi.Sink
+}
+
+func (ss syncingSink) Pour(ctx context.Context, v interface{}) error {
+	ss.s.indexSyncStart()
+	err := ss.backing.Pour(ctx, v)
+	// don't clear the waitgroup right away but give it a little time in case it needs to continue on to another message.
+	// this adds a short (theoretically unnecessary) delay to publish operations but not append operations where
+	// we have received a message from somewhere else.
+	// TODO: eliminate this delay by finding a way to directly check if the luigi queue is completely empty
+	time.AfterFunc(100*time.Millisecond, ss.s.indexSyncDone)
+	return err
+}
+
+func (ss syncingSink) Close() error { return ss.backing.Close() }
+
+// progressIndex pours into the progress sink of an index, which passes the messages on to the index
+type progressIndex struct {
+	luigi.Sink
+	librarian.SinkIndex
+}
+
+func (pi progressIndex) Pour(ctx context.Context, v interface{}) error { return pi.Sink.Pour(ctx, v) }
+
+func (pi progressIndex) Close() error { return pi.Sink.Close() }
+
+// servedIndex serializes the updates of an index, which can come from serveIndexFrom and Reindex at the same time
+type servedIndex struct {
+	mu sync.Mutex
+	librarian.SinkIndex
+
+	// the messages the index is made from
+	msgs margaret.Log
+}
+
+func (si *servedIndex) Pour(ctx context.Context, v interface{}) error {
+	si.mu.Lock()
+	defer si.mu.Unlock()
+	return si.SinkIndex.Pour(ctx, v)
+}
+
+// Reindex applies all the messages to the served index name again, while it keeps being updated with new ones.
+// This fills in entries which are missing from the index, but it doesn't remove stale ones, since the index isn't emptied first.
+// To build an index from scratch, use repo.Reindex while the bot isn't running.
+// progress is called after every message with the number of processed messages and the number of messages to process, it can be nil.
+func (s *Sbot) Reindex(ctx context.Context, name string, progress func(done, total int64)) error {
+	s.indexStateMu.Lock()
+	idx, has := s.indexSinks[name]
+	s.indexStateMu.Unlock()
+	if !has {
+		return fmt.Errorf("sbot: no index named %q", name)
+	}
+
+	total := idx.msgs.Seq() + 1
+	src, err := idx.msgs.Query(margaret.SeqWrap(true), margaret.Limit(int(total)))
+	if err != nil {
+		return fmt.Errorf("sbot/reindex(%s): failed to query messages: %w", name, err)
+	}
+
+	var done int64
+	snk := luigi.FuncSink(func(ctx context.Context, v interface{}, err error) error {
+		if err != nil {
+			if luigi.IsEOS(err) {
+				return nil
+			}
+			return err
+		}
+		if err := idx.Pour(ctx, v); err != nil {
+			return err
+		}
+		done++
+		if progress != nil {
+			progress(done, total)
+		}
+		return nil
+	})
+
+	level.Info(s.info).Log("event", "reindex", "index", name, "messages", total)
+	err = luigi.Pump(ctx, snk, src)
+	if err != nil && !luigi.IsEOS(err) {
+		return fmt.Errorf("sbot/reindex(%s): %w", name, err)
+	}
+	return nil
+}
+
 type progressSink struct {
 	erred error
 
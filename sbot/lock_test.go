@@ -0,0 +1,51 @@
+// SPDX-FileCopyrightText: 2021 The Go-SSB Authors
+//
+// SPDX-License-Identifier: MIT
+
+package sbot
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/ssbc/go-ssb/internal/testutils"
+	"github.com/ssbc/go-ssb/repo"
+)
+
+func TestRepoLockReleased(t *testing.T) {
+	r := require.New(t)
+
+	testPath := filepath.Join("testrun", t.Name())
+	os.RemoveAll(testPath)
+
+	botOptions := []Option{
+		WithInfo(testutils.NewRelativeTimeLogger(nil)),
+		WithRepoPath(testPath),
+		DisableNetworkNode(),
+	}
+
+	// fail after the repo is locked and some of it is opened
+	errLate := errors.New("late failure")
+	_, err := New(append(botOptions, LateOption(func(*Sbot) error { return errLate }))...)
+	r.ErrorIs(err, errLate)
+
+	lock, err := repo.AcquireLock(repo.New(testPath))
+	r.NoError(err, "lock not released after failed New")
+	r.NoError(lock.Close())
+
+	theBot, err := New(botOptions...)
+	r.NoError(err)
+	_, err = repo.AcquireLock(repo.New(testPath))
+	r.ErrorIs(err, repo.ErrRepoLocked)
+
+	theBot.Shutdown()
+	r.NoError(theBot.Close())
+
+	lock, err = repo.AcquireLock(repo.New(testPath))
+	r.NoError(err, "lock not released after Close")
+	r.NoError(lock.Close())
+}
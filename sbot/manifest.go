@@ -8,6 +8,7 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"strings"
 
 	"github.com/ssbc/go-muxrpc/v2"
 )
@@ -40,6 +41,53 @@ func (h manifestHandler) HandleCall(ctx context.Context, req *muxrpc.Request) {
 	}
 }
 
+// extendManifest adds calls, which map dotted method names to their call type, to the manifest.
+func extendManifest(manifest manifestHandler, calls map[string]string) (manifestHandler, error) {
+	if len(calls) == 0 {
+		return manifest, nil
+	}
+
+	manifestMap := make(map[string]interface{})
+	if err := json.Unmarshal([]byte(manifest), &manifestMap); err != nil {
+		return "", err
+	}
+
+	for method, typ := range calls {
+		switch typ {
+		case "async", "sync", "source", "sink", "duplex":
+		default:
+			return "", fmt.Errorf("invalid call type %q for %s", typ, method)
+		}
+
+		parts := strings.Split(method, ".")
+		level := manifestMap
+		for _, part := range parts[:len(parts)-1] {
+			switch v := level[part].(type) {
+			case nil:
+				next := make(map[string]interface{})
+				level[part] = next
+				level = next
+			case map[string]interface{}:
+				level = v
+			default:
+				return "", fmt.Errorf("%s: %s is already a call", method, part)
+			}
+		}
+
+		last := parts[len(parts)-1]
+		if _, isGroup := level[last].(map[string]interface{}); isGroup {
+			return "", fmt.Errorf("%s is already a group of calls", method)
+		}
+		level[last] = typ
+	}
+
+	extended, err := json.Marshal(manifestMap)
+	if err != nil {
+		return "", err
+	}
+	return manifestHandler(extended), nil
+}
+
 func init() {
 	manifestMap := make(map[string]interface{})
 	err := json.Unmarshal([]byte(manifestBlob), &manifestMap)
@@ -59,6 +107,11 @@ func init() {
 // hardcoded manifest for MUXRPC clients
 var manifestBlob manifestHandler = `
 {
+	"admin": {
+		"fsck": "source",
+		"gcBlobs": "source",
+		"reindex": "source"
+	},
 	"blobs": {
 		"add": "sink",
 		"createWants": "source",
@@ -86,6 +139,7 @@ var manifestBlob manifestHandler = `
 		"isFollowing": "async"
 	},
 	"get": "async",
+	"getFeedState": "async",
 	"gossip": {
 		"connect": "async",
 		"ping": "duplex"
@@ -115,6 +169,7 @@ var manifestBlob manifestHandler = `
 		"read":"source"
 	},
 	"replicate": {
+		"latestSequences": "async",
 		"upto": "source"
 	},
 	"status": "sync",
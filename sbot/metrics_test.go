@@ -0,0 +1,164 @@
+// SPDX-FileCopyrightText: 2021 The Go-SSB Authors
+//
+// SPDX-License-Identifier: MIT
+
+package sbot
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	kitmetrics "github.com/go-kit/kit/metrics"
+	refs "github.com/ssbc/go-ssb-refs"
+	"github.com/stretchr/testify/require"
+	"go.mindeco.de/log"
+	"golang.org/x/sync/errgroup"
+
+	"github.com/ssbc/go-ssb/internal/leakcheck"
+	"github.com/ssbc/go-ssb/internal/testutils"
+	ssbmetrics "github.com/ssbc/go-ssb/metrics"
+)
+
+func TestMetrics(t *testing.T) {
+	defer leakcheck.Check(t)
+	r := require.New(t)
+	ctx, cancel := context.WithCancel(context.TODO())
+	botgroup, ctx := errgroup.WithContext(ctx)
+
+	info := testutils.NewRelativeTimeLogger(nil)
+	bs := newBotServer(ctx, info)
+
+	testPath := filepath.Join("testrun", t.Name())
+	os.RemoveAll(testPath)
+
+	appKey := make([]byte, 32)
+	rand.Read(appKey)
+
+	newBot := func(name string, appKey []byte, c ssbmetrics.Collector) *Sbot {
+		bot, err := New(
+			WithAppKey(appKey),
+			WithContext(ctx),
+			WithInfo(log.With(info, "peer", name)),
+			WithRepoPath(filepath.Join(testPath, name)),
+			WithListenAddr(":0"),
+			WithMetrics(c),
+		)
+		r.NoError(err)
+		botgroup.Go(bs.Serve(bot))
+		return bot
+	}
+
+	aliMetrics, bobMetrics := newRecordingCollector(), newRecordingCollector()
+	ali := newBot("ali", appKey, aliMetrics)
+	bob := newBot("bob", appKey, bobMetrics)
+	ali.Replicate(bob.KeyPair.ID())
+	bob.Replicate(ali.KeyPair.ID())
+
+	// a peer from a different network can't complete the handshake
+	wrongKey := make([]byte, 32)
+	rand.Read(wrongKey)
+	eve := newBot("eve", wrongKey, ssbmetrics.Discard())
+
+	_, err := bob.PublishLog.Publish(refs.NewContactFollow(ali.KeyPair.ID()))
+	r.NoError(err)
+
+	randBuf := make([]byte, 1024)
+	rand.Read(randBuf)
+	blob, err := bob.BlobStore.Put(bytes.NewReader(randBuf))
+	r.NoError(err)
+
+	r.Error(eve.Network.Connect(ctx, ali.Network.GetListenAddr()))
+	r.NoError(bob.Network.Connect(ctx, ali.Network.GetListenAddr()))
+
+	r.NoError(ali.WantManager.Want(blob))
+	r.Eventually(func() bool {
+		_, err := ali.BlobStore.Get(blob)
+		return err == nil
+	}, 10*time.Second, 100*time.Millisecond, "ali didn't get the blob")
+
+	for _, name := range []string{
+		ssbmetrics.MessagesStored,
+		ssbmetrics.BlobsPut,
+		ssbmetrics.BlobsServed,
+		ssbmetrics.IndexLag,
+	} {
+		r.True(bobMetrics.fired(name), "bob didn't report %s", name)
+	}
+	r.Eventually(func() bool {
+		return aliMetrics.fired(ssbmetrics.HandshakesRejected)
+	}, time.Second, 50*time.Millisecond, "ali didn't report the handshake with eve")
+	r.True(aliMetrics.fired(ssbmetrics.HandshakesAccepted))
+	r.True(aliMetrics.fired(ssbmetrics.BlobsPut))
+	r.False(aliMetrics.fired(ssbmetrics.BlobsServed))
+
+	ali.Shutdown()
+	bob.Shutdown()
+	eve.Shutdown()
+	cancel()
+
+	r.NoError(ali.Close())
+	r.NoError(bob.Close())
+	r.NoError(eve.Close())
+	r.NoError(botgroup.Wait())
+}
+
+// recordingCollector remembers which metrics were reported to, ignoring their labels and values
+type recordingCollector struct {
+	mu    sync.Mutex
+	names map[string]bool
+}
+
+func newRecordingCollector() *recordingCollector {
+	return &recordingCollector{names: make(map[string]bool)}
+}
+
+func (rc *recordingCollector) fired(name string) bool {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	return rc.names[name]
+}
+
+func (rc *recordingCollector) record(name string) {
+	rc.mu.Lock()
+	rc.names[name] = true
+	rc.mu.Unlock()
+}
+
+func (rc *recordingCollector) Counter(name string) kitmetrics.Counter {
+	return recordedCounter{recordedMetric{rc, name}}
+}
+
+func (rc *recordingCollector) Gauge(name string) kitmetrics.Gauge {
+	return recordedGauge{recordedMetric{rc, name}}
+}
+
+func (rc *recordingCollector) Histogram(name string) kitmetrics.Histogram {
+	return recordedHistogram{recordedMetric{rc, name}}
+}
+
+type recordedMetric struct {
+	rc   *recordingCollector
+	name string
+}
+
+func (rm recordedMetric) Add(float64)     { rm.rc.record(rm.name) }
+func (rm recordedMetric) Set(float64)     { rm.rc.record(rm.name) }
+func (rm recordedMetric) Observe(float64) { rm.rc.record(rm.name) }
+
+type recordedCounter struct{ recordedMetric }
+
+func (rc recordedCounter) With(...string) kitmetrics.Counter { return rc }
+
+type recordedGauge struct{ recordedMetric }
+
+func (rg recordedGauge) With(...string) kitmetrics.Gauge { return rg }
+
+type recordedHistogram struct{ recordedMetric }
+
+func (rh recordedHistogram) With(...string) kitmetrics.Histogram { return rh }
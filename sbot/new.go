@@ -6,7 +6,6 @@ package sbot
 
 import (
 	"context"
-	"encoding/base64"
 	"fmt"
 	"io"
 	"net"
@@ -20,6 +19,7 @@ import (
 
 	"github.com/dgraph-io/badger/v3"
 	"github.com/go-kit/kit/metrics"
+	multierror "github.com/hashicorp/go-multierror"
 	"github.com/rs/cors"
 	"github.com/ssbc/go-metafeed/metamngmt"
 	"github.com/ssbc/go-muxrpc/v2"
@@ -39,14 +39,17 @@ import (
 	"github.com/ssbc/go-ssb/blobstore"
 	"github.com/ssbc/go-ssb/graph"
 	"github.com/ssbc/go-ssb/indexes"
+	"github.com/ssbc/go-ssb/internal/broadcasts"
 	"github.com/ssbc/go-ssb/internal/multicloser"
 	"github.com/ssbc/go-ssb/internal/mutil"
 	"github.com/ssbc/go-ssb/internal/statematrix"
 	"github.com/ssbc/go-ssb/internal/storedrefs"
 	"github.com/ssbc/go-ssb/message"
 	"github.com/ssbc/go-ssb/message/multimsg"
+	ssbmetrics "github.com/ssbc/go-ssb/metrics"
 	"github.com/ssbc/go-ssb/multilogs"
 	"github.com/ssbc/go-ssb/network"
+	"github.com/ssbc/go-ssb/plugins/admin"
 	"github.com/ssbc/go-ssb/plugins/blobs"
 	"github.com/ssbc/go-ssb/plugins/conn"
 	"github.com/ssbc/go-ssb/plugins/ebt"
@@ -91,9 +94,27 @@ type Sbot struct {
 	closedMu sync.Mutex
 	closeErr error
 
+	// the indexes are served under its context and logger, closing it stops them
+	repo repo.Interface
+	// released after the closers, when all the databases are closed
+	repoLock *repo.Lock
+
 	promisc  bool
 	hopCount uint
 
+	sliceLength int64
+
+	retention *feedRetention // optional, see WithFeedRetention
+
+	maxFutureSkew time.Duration
+
+	clock func() time.Time // optional, for the timestamps of published messages
+
+	historyStreamGuard bool
+
+	admins      []refs.FeedRef
+	blobGCGrace time.Duration // zero means DefaultBlobGCGracePeriod
+
 	disableEBT                   bool
 	disableLegacyLiveReplication bool
 
@@ -107,10 +128,27 @@ type Sbot struct {
 	networkConnTracker ssb.ConnTracker
 	preSecureWrappers  []netwrap.ConnWrapper
 	postSecureWrappers []netwrap.ConnWrapper
+	acceptRateLimit    int
+	acceptBurst        int
+	slowPeerThreshold  time.Duration
+	onSlowPeer         func(refs.FeedRef, time.Duration)
+	blobServeRate      int
+	blobMaxServeSize   uint
 
 	public ssb.PluginManager
 	master ssb.PluginManager
 
+	valueLogGCInterval time.Duration
+	valueLogGCRatio    float64
+
+	getCacheCapacity int
+	getCache         *repo.GetCache
+
+	latestCache *message.LatestCache
+
+	// calls of the plugins from WithPublicPlugins and WithMasterPlugins for the manifest
+	manifestCalls map[string]string
+
 	authorizer ssb.Authorizer
 
 	enableAdverts   bool
@@ -126,6 +164,8 @@ type Sbot struct {
 	repoPath string
 	KeyPair  ssb.KeyPair
 
+	secretPassphrase []byte
+
 	Groups *private.Manager
 
 	ReceiveLog multimsg.AlterableLog // the stream of messages as they arrived
@@ -141,6 +181,8 @@ type Sbot struct {
 	ByType  *roaring.MultiLog // one sublog per type: ... (special cases for private messages by suffix)
 	Tangles *roaring.MultiLog // one sublog per root:%ref (actual root is in the get index)
 
+	BlobRefs *indexes.BlobRefsIndex // the messages which reference a blob
+
 	indexStore *badger.DB
 
 	// plugin indexes
@@ -150,6 +192,7 @@ type Sbot struct {
 	liveIndexUpdates bool
 	indexStateMu     sync.Mutex
 	indexStates      map[string]string
+	indexSinks       map[string]*servedIndex
 
 	ebtState *statematrix.StateMatrix
 
@@ -165,6 +208,8 @@ type Sbot struct {
 	systemGauge  metrics.Gauge
 	latency      metrics.Histogram
 
+	metrics ssbmetrics.Collector
+
 	enableMetafeeds bool
 	MetaFeeds       ssb.MetaFeeds
 	IndexFeeds      ssb.IndexFeedManager
@@ -173,7 +218,7 @@ type Sbot struct {
 }
 
 // New creates an sbot instance using the passed options to configure it.
-func New(fopts ...Option) (*Sbot, error) {
+func New(fopts ...Option) (_ *Sbot, retErr error) {
 	var s = new(Sbot)
 	s.liveIndexUpdates = true
 
@@ -183,6 +228,7 @@ func New(fopts ...Option) (*Sbot, error) {
 	s.mlogIndicies = make(map[string]multilog.MultiLog)
 	s.simpleIndex = make(map[string]librarian.Index)
 	s.indexStates = make(map[string]string)
+	s.indexSinks = make(map[string]*servedIndex)
 
 	s.disableLegacyLiveReplication = true
 
@@ -203,7 +249,7 @@ func New(fopts ...Option) (*Sbot, error) {
 	}
 
 	if s.appKey == nil {
-		ak, err := base64.StdEncoding.DecodeString("1KHLiKZvAvjbY1ziZEHMXawbCEIM6qwjCDm3VYRan/s=")
+		ak, err := ssb.DecodeAppKey(ssb.DefaultAppKey)
 		if err != nil {
 			return nil, fmt.Errorf("failed to decode default appkey: %w", err)
 		}
@@ -229,15 +275,51 @@ func New(fopts ...Option) (*Sbot, error) {
 	}
 	ctx := s.rootCtx
 
-	storageRepo := repo.New(s.repoPath)
+	if s.metrics == nil {
+		s.metrics = ssbmetrics.Discard()
+	}
+
+	repoOpts := []repo.Option{
+		repo.WithContext(ctx),
+		repo.WithLogger(log.With(s.info, "module", "repo")),
+		repo.WithMetrics(s.metrics),
+	}
+	if s.valueLogGCInterval > 0 {
+		repoOpts = append(repoOpts, repo.WithValueLogGC(s.valueLogGCInterval, s.valueLogGCRatio))
+	}
+	storageRepo := repo.New(s.repoPath, repoOpts...)
+	s.repo = storageRepo
 
 	var err error
+	s.repoLock, err = repo.AcquireLock(storageRepo)
+	if err != nil {
+		return nil, fmt.Errorf("sbot: failed to lock repo: %w", err)
+	}
+	defer func() {
+		if retErr == nil {
+			return
+		}
+		// stop what was started so far and close what was opened, the lock last
+		s.Shutdown()
+		if err := s.closers.Close(); err != nil {
+			level.Warn(s.info).Log("event", "sbot init failed", "msg", "failed to close databases", "err", err)
+		}
+		if err := s.repoLock.Close(); err != nil {
+			level.Warn(s.info).Log("event", "sbot init failed", "msg", "failed to unlock repo", "err", err)
+		}
+	}()
+	s.closers.AddCloser(storageRepo)
+
 	if s.KeyPair == nil {
 		algo := refs.RefAlgoFeedSSB1
 		if s.enableMetafeeds {
 			algo = refs.RefAlgoFeedBendyButt
 		}
-		s.KeyPair, err = repo.DefaultKeyPair(storageRepo, algo)
+		var kpOpts []ssb.KeyPairOption
+		if s.secretPassphrase != nil {
+			kpOpts = append(kpOpts, ssb.WithSecretPassphrase(s.secretPassphrase))
+		}
+		s.KeyPair, err = repo.DefaultKeyPair(storageRepo, algo, kpOpts...)
 		if err != nil {
 			return nil, fmt.Errorf("sbot: failed to get keypair: %w", err)
 		}
@@ -259,14 +341,30 @@ func New(fopts ...Option) (*Sbot, error) {
 		}
 	}
 
+	blobsPut := s.metrics.Counter(ssbmetrics.BlobsPut)
+	s.BlobStore.Register(broadcasts.BlobStoreFuncEmitter(func(n ssb.BlobStoreNotification) error {
+		if n.Op == ssb.BlobStoreOpPut {
+			blobsPut.Add(1)
+		}
+		return nil
+	}))
+
+	wantsDB, err := repo.OpenBadgerDB(storageRepo.GetPath(repo.PrefixIndex, "blob-wants", "db"))
+	if err != nil {
+		return nil, fmt.Errorf("sbot: failed to open blob wants store: %w", err)
+	}
+
 	wantsLog := log.With(s.info, "module", "WantManager")
 	wm := blobstore.NewWantManager(s.BlobStore,
 		blobstore.WantWithLogger(wantsLog),
 		blobstore.WantWithContext(s.rootCtx),
 		blobstore.WantWithMetrics(s.systemGauge, s.eventCounter),
+		blobstore.WantWithFeedDistance(s.blobFeedDistance()),
+		blobstore.WantWithStore(wantsDB),
 	)
 	s.WantManager = wm
 	s.closers.AddCloser(wm)
+	s.closers.AddCloser(wantsDB)
 
 	for _, opt := range s.lateInit {
 		err := opt(s)
@@ -294,10 +392,18 @@ func New(fopts ...Option) (*Sbot, error) {
 	s.closers.AddCloser(idxTimestamps)
 	s.serveIndex("timestamps", idxTimestamps)
 
+	s.BlobRefs, err = indexes.NewBlobRefs(storageRepo)
+	if err != nil {
+		return nil, fmt.Errorf("sbot: failed to open blob references index: %w", err)
+	}
+	s.closers.AddCloser(s.BlobRefs)
+	s.serveIndex("blobRefs", s.BlobRefs)
+
 	s.indexStore, err = repo.OpenBadgerDB(storageRepo.GetPath(repo.PrefixMultiLog, "shared-badger"))
 	if err != nil {
 		return nil, err
 	}
+	storageRepo.StartValueLogGC(s.indexStore)
 
 	// default multilogs
 	var mlogs = []struct {
@@ -322,14 +428,24 @@ func New(fopts ...Option) (*Sbot, error) {
 		*index.Mlog = mlog
 	}
 
+	// latest message of each feed, kept current with the new messages of the receive log
+	s.latestCache = message.NewLatestCache(s.ReceiveLog, s.Users, s.WaitUntilIndexesAreSynced)
+	if err := s.serveLatestCache(); err != nil {
+		return nil, err
+	}
+
 	// publish
 	var pubopts = []message.PublishOption{
 		message.UseNowTimestamps(true),
 		message.UseWaitForIndexesCallback(s.WaitUntilIndexesAreSynced),
+		message.UseLatestCache(s.latestCache),
 	}
 	if s.signHMACsecret != nil {
 		pubopts = append(pubopts, message.SetHMACKey(s.signHMACsecret))
 	}
+	if s.clock != nil {
+		pubopts = append(pubopts, message.UseClock(s.clock))
+	}
 	s.PublishLog, err = message.OpenPublishLog(s.ReceiveLog, s.Users, s.KeyPair, pubopts...)
 	if err != nil {
 		return nil, fmt.Errorf("sbot: failed to create publish log: %w", err)
@@ -340,6 +456,9 @@ func New(fopts ...Option) (*Sbot, error) {
 	s.closers.AddCloser(updateSink)
 	s.serveIndex("get", updateSink)
 	s.simpleIndex["get"] = getIdx
+	if s.getCacheCapacity > 0 {
+		s.getCache = repo.NewGetCache(s.ReceiveLog, getIdx, s.getCacheCapacity)
+	}
 
 	// groups2
 	idxKeys := libbadger.NewIndexWithKeyPrefix(s.indexStore, keys.Recipients{}, []byte("group-and-signing"))
@@ -372,6 +491,17 @@ func New(fopts ...Option) (*Sbot, error) {
 	if err != nil {
 		return nil, fmt.Errorf("sbot: failed to open combined application index: %w", err)
 	}
+	if s.retention != nil {
+		err = s.retention.open(storageRepo.GetPath("retention-pending"))
+		if err != nil {
+			return nil, err
+		}
+		s.closers.AddCloser(s.retention)
+		combIdx.SetRetention(s.retention)
+		s.idxDone.Go(func() error {
+			return s.nullDropped(s.rootCtx)
+		})
+	}
 	s.serveIndex("combined", combIdx)
 	s.closers.AddCloser(combIdx)
 
@@ -646,10 +776,20 @@ func New(fopts ...Option) (*Sbot, error) {
 	s.public.Register(whoami)
 	s.master.Register(whoami)
 
-	// blobs
-	blobs := blobs.New(log.With(s.info, "unit", "blobs"), s.KeyPair.ID(), s.BlobStore, wm)
-	s.public.Register(blobs)
-	s.master.Register(blobs) // TODO: does not need to open a createWants on this one?!
+	// blobs, peers are limited in size and rate, the bot's own clients aren't
+	publicBlobsOpts := []blobs.Option{blobs.WithMetrics(s.metrics)}
+	if s.blobServeRate > 0 {
+		publicBlobsOpts = append(publicBlobsOpts, blobs.WithServeRate(s.blobServeRate))
+	}
+	if s.blobMaxServeSize > 0 {
+		publicBlobsOpts = append(publicBlobsOpts, blobs.WithMaxServeSize(s.blobMaxServeSize))
+	}
+	s.public.Register(blobs.New(log.With(s.info, "unit", "blobs"), s.KeyPair.ID(), s.BlobStore, wm, publicBlobsOpts...))
+	masterBlobs := blobs.New(log.With(s.info, "unit", "blobs"), s.KeyPair.ID(), s.BlobStore, wm,
+		blobs.WithMetrics(s.metrics),
+		blobs.WithMaxServeSize(0),
+	)
+	s.master.Register(masterBlobs) // TODO: does not need to open a createWants on this one?!
 
 	// gossiping (legacy and ebt)
 	fm := gossip.NewFeedManager(
@@ -678,6 +818,13 @@ func New(fopts ...Option) (*Sbot, error) {
 		histOpts = append(histOpts, gossip.HMACSecret(s.signHMACsecret))
 	}
 
+	if s.historyStreamGuard {
+		histOpts = append(histOpts, gossip.HopsGuard{
+			Graph:   s.GraphBuilder.Build,
+			MaxHops: int(s.hopCount),
+		})
+	}
+
 	if s.numberOfConcurrentReplicationsPerPeer != 0 {
 		histOpts = append(histOpts, gossip.NumberOfConcurrentReplicationsPerPeer(s.numberOfConcurrentReplicationsPerPeer))
 	}
@@ -686,7 +833,15 @@ func New(fopts ...Option) (*Sbot, error) {
 		histOpts = append(histOpts, gossip.NumberOfConcurrentReplications(s.numberOfConcurrentReplications))
 	}
 
-	s.verifyRouter, err = message.NewVerificationRouter(s.ReceiveLog, s.Users, s.signHMACsecret)
+	if s.sliceLength > 0 {
+		histOpts = append(histOpts, gossip.SliceLength(s.distantSliceLength))
+	}
+
+	var verifyOpts []message.VerifyOption
+	if s.maxFutureSkew > 0 {
+		verifyOpts = append(verifyOpts, message.WithMaxFutureSkew(s.maxFutureSkew))
+	}
+	s.verifyRouter, err = message.NewVerificationRouter(s.ReceiveLog, s.Users, s.signHMACsecret, verifyOpts...)
 	if err != nil {
 		return nil, err
 	}
@@ -772,12 +927,24 @@ func New(fopts ...Option) (*Sbot, error) {
 	s.master.Register(rawread.NewSortedStream(s.info, s.ReceiveLog, s.SeqResolver))
 	s.master.Register(hist) // createHistoryStream
 
-	s.master.Register(replicate.NewPlug(s.Users, s.KeyPair.ID(), s.Lister()))
+	// peers ask for the latest sequences we have
+	replicatePlug := replicate.NewPlug(s.ReceiveLog, s.Users, s.KeyPair.ID(), s.Lister())
+	s.public.Register(replicatePlug)
+	s.master.Register(replicatePlug)
+
+	// peers compare their frontiers before syncing
+	feedState := replicate.NewFeedStatePlug(s.ReceiveLog, s.Users, s.KeyPair.ID(), s.GraphBuilder, int(s.hopCount))
+	s.public.Register(feedState)
+	s.master.Register(feedState)
 
 	s.master.Register(friends.New(s.info, s.KeyPair.ID(), s.GraphBuilder))
 
+	manifest, err := extendManifest(manifestBlob, s.manifestCalls)
+	if err != nil {
+		return nil, fmt.Errorf("sbot: failed to add plugin calls to manifest: %w", err)
+	}
 	mh := namedPlugin{
-		h:    manifestBlob,
+		h:    manifest,
 		name: "manifest"}
 	s.master.Register(mh)
 	s.public.Register(mh)
@@ -810,10 +977,17 @@ func New(fopts ...Option) (*Sbot, error) {
 		SystemGauge:     s.systemGauge,
 		EndpointWrapper: s.edpWrapper,
 		Latency:         s.latency,
+		Metrics:         s.metrics,
 
 		WebsocketAddr:    s.websocketAddr,
 		WebsocketTLSCert: s.websocketTLSCert,
 		WebsocketTLSKey:  s.websocketTLSKey,
+
+		AcceptRateLimit: s.acceptRateLimit,
+		AcceptBurst:     s.acceptBurst,
+
+		SlowPeerThreshold: s.slowPeerThreshold,
+		OnSlowPeer:        s.onSlowPeer,
 	}
 
 	networkNode, err := network.New(opts)
@@ -884,6 +1058,10 @@ func New(fopts ...Option) (*Sbot, error) {
 	s.master.Register(conn.NewPlug(log.With(s.info, "unit", "conn"), networkNode, s))
 	s.master.Register(status.New(s))
 
+	adminPlug := admin.New(log.With(s.info, "unit", "admin"), s.KeyPair.ID(), maintainer{s}, s.admins)
+	s.master.Register(adminPlug)
+	s.public.Register(adminPlug)
+
 	s.public.Register(networkNode.TunnelPlugin())
 	s.Network = networkNode
 
@@ -902,23 +1080,40 @@ func (s *Sbot) Close() error {
 	closeEvt := log.With(s.info, "event", "sbot closing")
 	s.closed = true
 
+	// try to close everything, even if a step fails
+	var closeErr error
+
 	if s.Network != nil {
 		if err := s.Network.Close(); err != nil {
-			s.closeErr = fmt.Errorf("sbot: failed to close own network node: %w", err)
-			return s.closeErr
+			closeErr = multierror.Append(closeErr, fmt.Errorf("sbot: failed to close own network node: %w", err))
 		}
 		s.Network.GetConnTracker().CloseAll()
 		level.Debug(closeEvt).Log("msg", "connections closed")
 	}
 
 	if err := s.idxDone.Wait(); err != nil {
-		s.closeErr = fmt.Errorf("sbot: index group shutdown failed: %w", err)
-		return s.closeErr
+		closeErr = multierror.Append(closeErr, fmt.Errorf("sbot: index group shutdown failed: %w", err))
 	}
 	level.Debug(closeEvt).Log("msg", "waited for indexes to close")
 
+	if s.retention != nil {
+		// the indexes might have dropped more messages after nullDropped stopped
+		if err := s.nullPendingDropped(); err != nil {
+			closeErr = multierror.Append(closeErr, err)
+		}
+	}
+
 	if err := s.closers.Close(); err != nil {
-		s.closeErr = err
+		closeErr = multierror.Append(closeErr, err)
+	}
+
+	// released last, when all the databases are closed
+	if err := s.repoLock.Close(); err != nil {
+		closeErr = multierror.Append(closeErr, fmt.Errorf("sbot: failed to unlock repo: %w", err))
+	}
+
+	if closeErr != nil {
+		s.closeErr = closeErr
 		return s.closeErr
 	}
 
@@ -0,0 +1,61 @@
+// SPDX-FileCopyrightText: 2021 The Go-SSB Authors
+//
+// SPDX-License-Identifier: MIT
+
+package sbot
+
+import (
+	"context"
+	"fmt"
+
+	refs "github.com/ssbc/go-ssb-refs"
+	"github.com/ssbc/margaret"
+
+	"github.com/ssbc/go-ssb"
+	"github.com/ssbc/go-ssb/graph"
+)
+
+// Node is a small facade over Sbot for callers that just want a running node.
+// It opens the repo, starts the index and graph processing and exposes the most commonly needed parts.
+type Node struct {
+	bot *Sbot
+}
+
+// NewNode assembles a node in repoPath. Canceling ctx or calling Close stops all background processing.
+// The passed options are applied after the repo path and context, so they can still override them.
+func NewNode(ctx context.Context, repoPath string, opts ...Option) (*Node, error) {
+	opts = append([]Option{
+		WithContext(ctx),
+		WithRepoPath(repoPath),
+	}, opts...)
+
+	bot, err := New(opts...)
+	if err != nil {
+		return nil, fmt.Errorf("sbot: failed to create node: %w", err)
+	}
+
+	return &Node{bot: bot}, nil
+}
+
+// Sbot returns the underlying server, for everything the facade doesn't cover.
+func (n *Node) Sbot() *Sbot { return n.bot }
+
+// KeyPair returns the keypair of the node.
+func (n *Node) KeyPair() ssb.KeyPair { return n.bot.KeyPair }
+
+// RootLog returns the log of all the messages the node has, in the order they were received.
+func (n *Node) RootLog() margaret.Log { return n.bot.ReceiveLog }
+
+// Graph returns the builder of the follow and block graph.
+func (n *Node) Graph() graph.Builder { return n.bot.GraphBuilder }
+
+// Publish publishes content on the feed of the node.
+func (n *Node) Publish(content interface{}) (refs.Message, error) {
+	return n.bot.PublishLog.Publish(content)
+}
+
+// Close stops the index processing and the network and closes the repo.
+func (n *Node) Close() error {
+	n.bot.Shutdown()
+	return n.bot.Close()
+}
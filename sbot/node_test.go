@@ -0,0 +1,54 @@
+// SPDX-FileCopyrightText: 2021 The Go-SSB Authors
+//
+// SPDX-License-Identifier: MIT
+
+package sbot
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	refs "github.com/ssbc/go-ssb-refs"
+	"github.com/stretchr/testify/require"
+	"go.mindeco.de/log"
+
+	"github.com/ssbc/go-ssb/internal/leakcheck"
+)
+
+func TestNodeSmoke(t *testing.T) {
+	defer leakcheck.Check(t)
+	r := require.New(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	tRepoPath := filepath.Join("testrun", t.Name())
+	os.RemoveAll(tRepoPath)
+
+	node, err := NewNode(ctx, tRepoPath,
+		WithInfo(log.NewNopLogger()),
+		DisableNetworkNode(),
+	)
+	r.NoError(err)
+
+	msg, err := node.Publish(refs.NewPost("hello, world"))
+	r.NoError(err)
+	r.True(msg.Author().Equal(node.KeyPair().ID()))
+
+	r.EqualValues(0, node.RootLog().Seq())
+
+	v, err := node.RootLog().Get(0)
+	r.NoError(err)
+	stored, ok := v.(refs.Message)
+	r.True(ok, "got %T", v)
+	r.True(msg.Key().Equal(stored.Key()))
+
+	node.Sbot().WaitUntilIndexesAreSynced()
+	g, err := node.Graph().Build()
+	r.NoError(err)
+	r.NotNil(g)
+
+	r.NoError(node.Close())
+}
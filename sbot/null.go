@@ -54,6 +54,13 @@ func (s *Sbot) NullFeed(ref refs.FeedRef) error {
 		}
 	}
 
+	if s.getCache != nil {
+		s.getCache.Purge()
+	}
+	if s.latestCache != nil {
+		s.latestCache.Invalidate(ref)
+	}
+
 	err = s.Users.Delete(feedAddr)
 	if err != nil {
 		return fmt.Errorf("NullFeed: error while deleting feed from userFeeds index: %w", err)
@@ -79,6 +79,10 @@ func (s *Sbot) NullContent(fr refs.FeedRef, seq uint) error {
 	if err != nil {
 		return fmt.Errorf("nullContent: failed to execute replace operation: %w", err)
 	}
+
+	if s.getCache != nil {
+		s.getCache.Invalidate(mm.Key())
+	}
 	return nil
 }
 
@@ -13,6 +13,7 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/go-kit/kit/metrics"
 	"github.com/ssbc/go-muxrpc/v2"
@@ -22,8 +23,10 @@ import (
 	"go.mindeco.de/logging"
 
 	"github.com/ssbc/go-ssb"
+	refs "github.com/ssbc/go-ssb-refs"
 	"github.com/ssbc/go-ssb/internal/ctxutils"
 	"github.com/ssbc/go-ssb/internal/netwraputil"
+	ssbmetrics "github.com/ssbc/go-ssb/metrics"
 	"github.com/ssbc/go-ssb/repo"
 )
 
@@ -243,12 +246,13 @@ func WithAppKey(k []byte) Option {
 	}
 }
 
-// WithNamedKeyPair changes from the default `secret` file, useful for testing.
+// WithNamedKeyPair changes from the default `secret` file to another identity of the repo, see repo.KeyPairNamed.
+// The bot publishes and connects to peers as that identity. PublishAs can still publish as the others.
 func WithNamedKeyPair(name string) Option {
 	return func(s *Sbot) error {
 		r := repo.New(s.repoPath)
 		var err error
-		s.KeyPair, err = repo.LoadKeyPair(r, name)
+		s.KeyPair, err = repo.KeyPairNamed(r, name)
 		if err != nil {
 			return fmt.Errorf("loading named key-pair %q failed: %w", name, err)
 		}
@@ -256,6 +260,18 @@ func WithNamedKeyPair(name string) Option {
 	}
 }
 
+// WithSecretPassphrase encrypts the default secret file of the repo with the passed passphrase.
+// An existing encrypted secret file can only be loaded with the passphrase it was saved with.
+func WithSecretPassphrase(p []byte) Option {
+	return func(s *Sbot) error {
+		if len(p) == 0 {
+			return fmt.Errorf("sbot: empty secret passphrase")
+		}
+		s.secretPassphrase = p
+		return nil
+	}
+}
+
 // WithJSONKeyPair expectes a JSON-string as blob and calls ssb.ParseKeyPair on it.
 // This is useful if you dont't want to place the keypair on the filesystem.
 func WithJSONKeyPair(blob string) Option {
@@ -321,6 +337,56 @@ func WithPostSecureConnWrapper(cw netwrap.ConnWrapper) Option {
 	}
 }
 
+// WithAcceptRateLimit limits how many incoming connections per second get to the secret-handshake.
+// Up to burst connections can arrive at once, the ones over the limit are closed right away and counted as dropped.
+func WithAcceptRateLimit(perSecond, burst int) Option {
+	return func(s *Sbot) error {
+		if perSecond < 1 {
+			return fmt.Errorf("WithAcceptRateLimit: rate needs to be positive (%d)", perSecond)
+		}
+		s.acceptRateLimit = perSecond
+		s.acceptBurst = burst
+		return nil
+	}
+}
+
+// WithSlowPeerHandler calls fn when a write to a peer blocks for longer than threshold,
+// because the peer doesn't drain its streams. See network.Options.OnSlowPeer.
+func WithSlowPeerHandler(threshold time.Duration, fn func(peer refs.FeedRef, blocked time.Duration)) Option {
+	return func(s *Sbot) error {
+		if threshold <= 0 {
+			return fmt.Errorf("WithSlowPeerHandler: threshold needs to be positive (%s)", threshold)
+		}
+		s.slowPeerThreshold = threshold
+		s.onSlowPeer = fn
+		return nil
+	}
+}
+
+// WithBlobServeRate limits how many bytes of blobs per second the bot sends to all its peers together.
+// The bot's own clients aren't throttled.
+func WithBlobServeRate(bytesPerSecond int) Option {
+	return func(s *Sbot) error {
+		if bytesPerSecond < 1 {
+			return fmt.Errorf("WithBlobServeRate: rate needs to be positive (%d)", bytesPerSecond)
+		}
+		s.blobServeRate = bytesPerSecond
+		return nil
+	}
+}
+
+// WithBlobMaxServeSize sets the biggest blob the bot sends to its peers. By default that is blobstore.DefaultMaxSize.
+// Like WithBlobServeRate, it doesn't apply to the bot's own clients.
+func WithBlobMaxServeSize(sz uint) Option {
+	return func(s *Sbot) error {
+		if sz < 1 {
+			return fmt.Errorf("WithBlobMaxServeSize: size needs to be positive")
+		}
+		s.blobMaxServeSize = sz
+		return nil
+	}
+}
+
 // WithEventMetrics sets up latency and counter metrics
 func WithEventMetrics(ctr metrics.Counter, lvls metrics.Gauge, lat metrics.Histogram) Option {
 	return func(s *Sbot) error {
@@ -331,6 +397,15 @@ func WithEventMetrics(ctr metrics.Counter, lvls metrics.Gauge, lat metrics.Histo
 	}
 }
 
+// WithMetrics reports what the bot is doing to c, like stored messages, blobs, handshakes and the lag of the indexes.
+// See the metrics package for the names.
+func WithMetrics(c ssbmetrics.Collector) Option {
+	return func(s *Sbot) error {
+		s.metrics = c
+		return nil
+	}
+}
+
 // WithEndpointWrapper sets a MuxrpcEndpointWrapper for new connections.
 func WithEndpointWrapper(mw MuxrpcEndpointWrapper) Option {
 	return func(s *Sbot) error {
@@ -416,6 +491,85 @@ func WithPromisc(yes bool) Option {
 	}
 }
 
+// WithSlicedFeeds makes legacy replication only fetch the n latest messages of feeds which aren't followed directly, instead of their whole history.
+// This only applies to feeds of which nothing is stored yet and only to replication without EBT, see DisableEBT.
+// The stored part of such a feed starts at its first fetched message, see message.FeedOrigin.
+func WithSlicedFeeds(n int64) Option {
+	return func(s *Sbot) error {
+		s.sliceLength = n
+		return nil
+	}
+}
+
+// WithFeedRetention only keeps the n latest messages of feed, for feeds with many short-lived messages.
+// Older messages are nulled in the receive log, the sublog of the feed keeps their entries so that queries on it continue.
+// Only the kept messages are served, and new messages are verified against the latest one.
+// Other indexes, like the contact graph, keep what they got from the dropped messages.
+func WithFeedRetention(feed refs.FeedRef, n int64) Option {
+	return func(s *Sbot) error {
+		if n <= 0 {
+			return fmt.Errorf("sbot: feed retention needs to keep at least one message")
+		}
+		if s.retention == nil {
+			s.retention = newFeedRetention()
+		}
+		s.retention.limits[feed.String()] = n
+		return nil
+	}
+}
+
+// WithMaxFutureSkew rejects received messages which claim to be from more than d in the future, see message.WithMaxFutureSkew.
+// Replication of such a feed stops at that message, until the local clock catches up.
+func WithMaxFutureSkew(d time.Duration) Option {
+	return func(s *Sbot) error {
+		if d <= 0 {
+			return fmt.Errorf("sbot: max future skew needs to be positive")
+		}
+		s.maxFutureSkew = d
+		return nil
+	}
+}
+
+// WithClock makes the bot take the timestamps of the messages it publishes from now instead of time.Now, see message.UseClock.
+// It is meant for tests which need the same messages in every run. Only legacy feeds support it.
+func WithClock(now func() time.Time) Option {
+	return func(s *Sbot) error {
+		if now == nil {
+			return fmt.Errorf("sbot: clock can't be nil")
+		}
+		s.clock = now
+		return nil
+	}
+}
+
+// WithAdmins lets the passed feeds use the admin calls (admin.reindex, admin.gcBlobs and admin.fsck), in addition to the feed of the bot itself.
+func WithAdmins(feeds ...refs.FeedRef) Option {
+	return func(s *Sbot) error {
+		s.admins = append(s.admins, feeds...)
+		return nil
+	}
+}
+
+// WithBlobGCGracePeriod sets how old an unreferenced blob needs to be before GCBlobs deletes it. The default is DefaultBlobGCGracePeriod.
+func WithBlobGCGracePeriod(d time.Duration) Option {
+	return func(s *Sbot) error {
+		if d <= 0 {
+			return fmt.Errorf("sbot: blob gc grace period needs to be positive")
+		}
+		s.blobGCGrace = d
+		return nil
+	}
+}
+
+// WithHistoryStreamGuard when enabled only serves feeds in createHistoryStream which are within the hops (see WithHops) of the remote.
+// This stops peers from pulling arbitrary feeds through this bot. It has no effect with WithPromisc.
+func WithHistoryStreamGuard(yes bool) Option {
+	return func(s *Sbot) error {
+		s.historyStreamGuard = yes
+		return nil
+	}
+}
+
 // WithPublicAuthorizer configures who is considered "public" when accepting connections.
 // By default, this is covered by the list of followed and blocked peers using the graph implementation.
 func WithPublicAuthorizer(auth ssb.Authorizer) Option {
@@ -436,6 +590,29 @@ func WithReplicator(r ssb.Replicator) Option {
 	}
 }
 
+// WithValueLogGC runs the value log garbage collection of the badger databases every interval, see repo.WithValueLogGC.
+func WithValueLogGC(interval time.Duration, ratio float64) Option {
+	return func(s *Sbot) error {
+		if ratio <= 0 || ratio >= 1 {
+			return fmt.Errorf("sbot: value log gc ratio needs to be between 0 and 1")
+		}
+		s.valueLogGCInterval = interval
+		s.valueLogGCRatio = ratio
+		return nil
+	}
+}
+
+// WithGetCache keeps up to capacity messages which were looked up by key in memory, see repo.GetCache.
+func WithGetCache(capacity int) Option {
+	return func(s *Sbot) error {
+		if capacity < 1 {
+			return fmt.Errorf("sbot: get cache capacity needs to be at least one")
+		}
+		s.getCacheCapacity = capacity
+		return nil
+	}
+}
+
 // LateOption is a bit of a hack, it loads options after the _basic_ inititialisation is done (like repo location and keypair)
 // this is mainly usefull for plugins that want to use a configured bot.
 func LateOption(o Option) Option {
@@ -464,3 +641,44 @@ func WithNumberOfConcurrentReplications(n uint) Option {
 		return nil
 	}
 }
+
+// WithPublicPlugins registers additional muxrpc plugins which can be called by remote peers and local clients.
+// Incoming calls are routed to the plugin with the longest matching method prefix.
+// Plugins of the bot itself are registered later and take precedence if they use the same method.
+// If a plugin implements ssb.ManifestPlugin, its calls are added to the manifest.
+func WithPublicPlugins(plugs ...ssb.Plugin) Option {
+	return func(s *Sbot) error {
+		for _, p := range plugs {
+			s.public.Register(p)
+			s.master.Register(p)
+			s.addManifestCalls(p)
+		}
+		return nil
+	}
+}
+
+// WithMasterPlugins registers additional muxrpc plugins which can only be called by the bot's own identity,
+// like clients on the unix socket.
+// Plugins of the bot itself are registered later and take precedence if they use the same method.
+func WithMasterPlugins(plugs ...ssb.Plugin) Option {
+	return func(s *Sbot) error {
+		for _, p := range plugs {
+			s.master.Register(p)
+			s.addManifestCalls(p)
+		}
+		return nil
+	}
+}
+
+func (s *Sbot) addManifestCalls(p ssb.Plugin) {
+	mp, ok := p.(ssb.ManifestPlugin)
+	if !ok {
+		return
+	}
+	if s.manifestCalls == nil {
+		s.manifestCalls = make(map[string]string)
+	}
+	for method, typ := range mp.Manifest() {
+		s.manifestCalls[method] = typ
+	}
+}
@@ -0,0 +1,173 @@
+// SPDX-FileCopyrightText: 2021 The Go-SSB Authors
+//
+// SPDX-License-Identifier: MIT
+
+package sbot
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ssbc/go-muxrpc/v2"
+	"github.com/ssbc/go-muxrpc/v2/typemux"
+	"github.com/stretchr/testify/require"
+	"go.mindeco.de/log"
+	"golang.org/x/sync/errgroup"
+
+	"github.com/ssbc/go-ssb"
+	refs "github.com/ssbc/go-ssb-refs"
+	"github.com/ssbc/go-ssb/client"
+	"github.com/ssbc/go-ssb/internal/leakcheck"
+)
+
+// testPlugin wraps a typemux handler to register it on a bot
+type testPlugin struct {
+	method   muxrpc.Method
+	h        muxrpc.Handler
+	manifest map[string]string
+}
+
+func (p testPlugin) Name() string            { return p.method.String() }
+func (p testPlugin) Method() muxrpc.Method   { return p.method }
+func (p testPlugin) Handler() muxrpc.Handler { return p.h }
+
+func (p testPlugin) Manifest() map[string]string { return p.manifest }
+
+func newPingPlugin() ssb.Plugin {
+	mux := typemux.New(log.NewNopLogger())
+	mux.RegisterAsync(muxrpc.Method{"ping"}, typemux.AsyncFunc(func(ctx context.Context, r *muxrpc.Request) (interface{}, error) {
+		return "pong", nil
+	}))
+	return testPlugin{
+		method:   muxrpc.Method{"ping"},
+		h:        &mux,
+		manifest: map[string]string{"ping": "async"},
+	}
+}
+
+func newCountPlugin() ssb.Plugin {
+	mux := typemux.New(log.NewNopLogger())
+	mux.RegisterSource(muxrpc.Method{"test", "count"}, typemux.SourceFunc(func(ctx context.Context, r *muxrpc.Request, snk *muxrpc.ByteSink) error {
+		snk.SetEncoding(muxrpc.TypeJSON)
+		for _, v := range []string{"1", "2", "3"} {
+			if _, err := snk.Write([]byte(v)); err != nil {
+				return err
+			}
+		}
+		return snk.Close()
+	}))
+	return testPlugin{
+		method:   muxrpc.Method{"test"},
+		h:        &mux,
+		manifest: map[string]string{"test.count": "source"},
+	}
+}
+
+func TestCustomPlugins(t *testing.T) {
+	defer leakcheck.Check(t)
+	r := require.New(t)
+
+	tRepoPath := filepath.Join("testrun", t.Name())
+	os.RemoveAll(tRepoPath)
+
+	bot, err := New(
+		WithInfo(log.NewNopLogger()),
+		WithRepoPath(tRepoPath),
+		WithListenAddr(":0"),
+		WithPromisc(true),
+		WithPublicPlugins(newPingPlugin()),
+		WithMasterPlugins(newCountPlugin()),
+		LateOption(WithUNIXSocket()),
+	)
+	r.NoError(err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	botgroup, ctx := errgroup.WithContext(ctx)
+	bs := newBotServer(ctx, log.NewNopLogger())
+	botgroup.Go(bs.Serve(bot))
+
+	// a remote peer can only call the public plugin
+	peerKp, err := ssb.NewKeyPair(nil, refs.RefAlgoFeedSSB1)
+	r.NoError(err)
+
+	peer, err := client.NewTCP(peerKp, bot.Network.GetListenAddr())
+	r.NoError(err)
+
+	var pong string
+	err = peer.Async(ctx, &pong, muxrpc.TypeString, muxrpc.Method{"ping"})
+	r.NoError(err)
+	r.Equal("pong", pong)
+
+	src, err := peer.Source(ctx, muxrpc.TypeJSON, muxrpc.Method{"test", "count"})
+	r.NoError(err)
+	r.False(src.Next(ctx))
+	r.Error(src.Err(), "expected master plugin to be unavailable for peers")
+
+	var v interface{}
+	err = peer.Async(ctx, &v, muxrpc.TypeJSON, muxrpc.Method{"no", "such", "method"})
+	r.Error(err)
+	r.NoError(peer.Close())
+
+	// the local client can call both
+	local, err := client.NewUnix(filepath.Join(tRepoPath, "socket"))
+	r.NoError(err)
+
+	pong = ""
+	err = local.Async(ctx, &pong, muxrpc.TypeString, muxrpc.Method{"ping"})
+	r.NoError(err)
+	r.Equal("pong", pong)
+
+	src, err = local.Source(ctx, muxrpc.TypeJSON, muxrpc.Method{"test", "count"})
+	r.NoError(err)
+
+	var got []string
+	for src.Next(ctx) {
+		b, err := src.Bytes()
+		r.NoError(err)
+		got = append(got, string(b))
+	}
+	r.NoError(src.Err())
+	r.Equal([]string{"1", "2", "3"}, got)
+
+	r.NoError(local.Close())
+
+	bot.Shutdown()
+	cancel()
+	r.NoError(bot.Close())
+	r.NoError(botgroup.Wait())
+}
+
+func TestExtendManifest(t *testing.T) {
+	r := require.New(t)
+
+	m, err := extendManifest(manifestBlob, nil)
+	r.NoError(err)
+	r.Equal(manifestBlob, m)
+
+	m, err = extendManifest(`{"blobs":{"get":"source"},"whoami":"async"}`, map[string]string{
+		"ping":            "async",
+		"blobs.list":      "source",
+		"room.members.ls": "source",
+	})
+	r.NoError(err)
+	r.JSONEq(`{
+		"blobs":{"get":"source","list":"source"},
+		"whoami":"async",
+		"ping":"async",
+		"room":{"members":{"ls":"source"}}
+	}`, string(m))
+
+	_, err = extendManifest(manifestBlob, map[string]string{"whoami.sub": "async"})
+	r.Error(err, "whoami is a call")
+
+	_, err = extendManifest(manifestBlob, map[string]string{"blobs": "async"})
+	r.Error(err, "blobs is a group")
+
+	_, err = extendManifest(manifestBlob, map[string]string{"ping": "stream"})
+	r.Error(err, "invalid type")
+}
@@ -55,6 +55,19 @@ func (sbot *Sbot) DontReplicate(r refs.FeedRef) {
 	sbot.Replicator.DontReplicate(r)
 }
 
+// distantSliceLength is used as gossip.SliceLength, to only fetch the latest messages of feeds which aren't followed directly
+func (sbot *Sbot) distantSliceLength(r refs.FeedRef) int64 {
+	self := sbot.KeyPair.ID()
+	if r.Equal(self) {
+		return 0
+	}
+	g, err := sbot.GraphBuilder.Build()
+	if err != nil || g.Follows(self, r) {
+		return 0
+	}
+	return sbot.sliceLength
+}
+
 type graphReplicator struct {
 	bot     *Sbot
 	current *lister
@@ -0,0 +1,211 @@
+// SPDX-FileCopyrightText: 2021 The Go-SSB Authors
+//
+// SPDX-License-Identifier: MIT
+
+package sbot
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sync"
+
+	refs "github.com/ssbc/go-ssb-refs"
+
+	"github.com/ssbc/go-ssb/multilogs"
+)
+
+// feedRetention is the retention policy of the combined index for the feeds from WithFeedRetention.
+// The index can't change the receive log while it is indexing it,
+// so the messages it drops are collected here and nulled by nullDropped.
+// Their sequences are also written to a file in the repo before the index goes on,
+// so that they are still nulled after a restart if the bot stopped before it got to them.
+type feedRetention struct {
+	limits map[string]int64
+
+	mu      sync.Mutex
+	path    string
+	file    *os.File // the pending sequences, 8 bytes big-endian each
+	pending []int64
+	wake    chan struct{}
+}
+
+var _ multilogs.RetentionPolicy = (*feedRetention)(nil)
+
+func newFeedRetention() *feedRetention {
+	return &feedRetention{
+		limits: make(map[string]int64),
+		wake:   make(chan struct{}, 1),
+	}
+}
+
+// open loads the sequences which weren't nulled yet from the file at path and keeps it for the new ones.
+func (fr *feedRetention) open(path string) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("sbot/retention: failed to read pending file: %w", err)
+	}
+
+	fr.mu.Lock()
+	defer fr.mu.Unlock()
+
+	// a partially written sequence was never handed over
+	data = data[:len(data)-len(data)%8]
+	for i := 0; i < len(data); i += 8 {
+		fr.pending = append(fr.pending, int64(binary.BigEndian.Uint64(data[i:])))
+	}
+
+	fr.path = path
+	if err := fr.rewrite(); err != nil {
+		return err
+	}
+
+	if len(fr.pending) > 0 {
+		fr.wake <- struct{}{}
+	}
+	return nil
+}
+
+func (fr *feedRetention) Limit(feed refs.FeedRef) int64 {
+	return fr.limits[feed.String()]
+}
+
+func (fr *feedRetention) Dropped(_ refs.FeedRef, rxSeqs []int64) error {
+	fr.mu.Lock()
+	fr.pending = append(fr.pending, rxSeqs...)
+	err := fr.add(rxSeqs)
+	fr.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	select {
+	case fr.wake <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+func (fr *feedRetention) takePending() []int64 {
+	fr.mu.Lock()
+	defer fr.mu.Unlock()
+	seqs := fr.pending
+	fr.pending = nil
+	return seqs
+}
+
+// nulled removes the sequences which were nulled from the file, which still has the ones that were added since takePending.
+func (fr *feedRetention) nulled() error {
+	fr.mu.Lock()
+	defer fr.mu.Unlock()
+	return fr.rewrite()
+}
+
+// add appends seqs to the file and syncs it. fr.mu needs to be held.
+func (fr *feedRetention) add(seqs []int64) error {
+	if fr.file == nil {
+		return nil
+	}
+
+	if _, err := fr.file.Write(encodeSeqs(seqs)); err != nil {
+		return fmt.Errorf("sbot/retention: failed to write pending file: %w", err)
+	}
+	if err := fr.file.Sync(); err != nil {
+		return fmt.Errorf("sbot/retention: failed to sync pending file: %w", err)
+	}
+	return nil
+}
+
+// rewrite replaces the file with one that has the pending sequences. fr.mu needs to be held.
+// The new file is written next to it and renamed, so the old one stays if that fails.
+func (fr *feedRetention) rewrite() error {
+	if fr.path == "" {
+		return nil
+	}
+
+	tmpPath := fr.path + ".tmp"
+	err := ioutil.WriteFile(tmpPath, encodeSeqs(fr.pending), 0600)
+	if err != nil {
+		return fmt.Errorf("sbot/retention: failed to write pending file: %w", err)
+	}
+	if err := syncFile(tmpPath); err != nil {
+		return fmt.Errorf("sbot/retention: failed to sync pending file: %w", err)
+	}
+
+	if fr.file != nil {
+		fr.file.Close()
+		fr.file = nil
+	}
+	if err := os.Rename(tmpPath, fr.path); err != nil {
+		return fmt.Errorf("sbot/retention: failed to replace pending file: %w", err)
+	}
+
+	fr.file, err = os.OpenFile(fr.path, os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return fmt.Errorf("sbot/retention: failed to open pending file: %w", err)
+	}
+	return nil
+}
+
+func encodeSeqs(seqs []int64) []byte {
+	buf := make([]byte, 8*len(seqs))
+	for i, seq := range seqs {
+		binary.BigEndian.PutUint64(buf[8*i:], uint64(seq))
+	}
+	return buf
+}
+
+func syncFile(path string) error {
+	f, err := os.OpenFile(path, os.O_RDWR, 0600)
+	if err != nil {
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func (fr *feedRetention) Close() error {
+	fr.mu.Lock()
+	defer fr.mu.Unlock()
+	if fr.file == nil {
+		return nil
+	}
+	return fr.file.Close()
+}
+
+// nullDropped nulls the messages which the retention dropped, until ctx is canceled.
+func (s *Sbot) nullDropped(ctx context.Context) error {
+	for {
+		select {
+		case <-ctx.Done():
+			return s.nullPendingDropped()
+		case <-s.retention.wake:
+			if err := s.nullPendingDropped(); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func (s *Sbot) nullPendingDropped() error {
+	seqs := s.retention.takePending()
+	if len(seqs) == 0 {
+		return nil
+	}
+
+	for _, seq := range seqs {
+		if err := s.ReceiveLog.Null(seq); err != nil {
+			return fmt.Errorf("sbot: failed to null dropped message %d: %w", seq, err)
+		}
+	}
+
+	if s.getCache != nil {
+		s.getCache.Purge()
+	}
+	return s.retention.nulled()
+}
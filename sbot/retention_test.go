@@ -0,0 +1,166 @@
+// SPDX-FileCopyrightText: 2021 The Go-SSB Authors
+//
+// SPDX-License-Identifier: MIT
+
+package sbot
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ssbc/go-luigi"
+	refs "github.com/ssbc/go-ssb-refs"
+	"github.com/ssbc/margaret"
+	"github.com/stretchr/testify/require"
+	"go.mindeco.de/log"
+
+	"github.com/ssbc/go-ssb"
+	"github.com/ssbc/go-ssb/internal/mutil"
+	"github.com/ssbc/go-ssb/internal/storedrefs"
+	"github.com/ssbc/go-ssb/message"
+)
+
+func TestFeedRetention(t *testing.T) {
+	r := require.New(t)
+
+	tRepoPath := filepath.Join("testrun", t.Name())
+	os.RemoveAll(tRepoPath)
+
+	kp, err := ssb.NewKeyPair(nil, refs.RefAlgoFeedSSB1)
+	r.NoError(err)
+
+	const keep = 10
+	openBot := func() *Sbot {
+		bot, err := New(
+			WithInfo(log.NewNopLogger()),
+			WithRepoPath(tRepoPath),
+			WithKeyPair(kp),
+			WithFeedRetention(kp.ID(), keep),
+			DisableNetworkNode(),
+		)
+		r.NoError(err)
+		return bot
+	}
+	closeBot := func(bot *Sbot) {
+		bot.Shutdown()
+		r.NoError(bot.Close())
+	}
+
+	// checkRetained checks that the messages with the sequences from first to last are stored
+	checkRetained := func(bot *Sbot, first, last int64) {
+		bot.WaitUntilIndexesAreSynced()
+
+		// the sublog keeps the entries of the dropped messages
+		userLog, err := bot.Users.Get(storedrefs.Feed(kp.ID()))
+		r.NoError(err)
+		r.EqualValues(last-1, userLog.Seq())
+
+		origin, err := message.FeedOrigin(bot.ReceiveLog, userLog)
+		r.NoError(err)
+		r.EqualValues(1, origin)
+
+		src, err := mutil.Indirect(bot.ReceiveLog, userLog).Query(margaret.Gte(first - origin))
+		r.NoError(err)
+		want := first
+		for {
+			v, err := src.Next(context.TODO())
+			if luigi.IsEOS(err) {
+				break
+			}
+			r.NoError(err)
+			msg, ok := v.(refs.Message)
+			r.True(ok, "not a message: %T", v)
+			r.Equal(want, msg.Seq())
+			want++
+		}
+		r.Equal(last+1, want)
+
+		note, err := bot.CurrentSequence(kp.ID())
+		r.NoError(err)
+		r.Equal(last, note.Seq)
+	}
+
+	bot := openBot()
+
+	var published []refs.MessageRef
+	for i := 0; i < 25; i++ {
+		msg, err := bot.PublishLog.Publish(map[string]interface{}{"type": "test", "i": i})
+		r.NoError(err)
+		published = append(published, msg.Key())
+	}
+	checkRetained(bot, 16, 25)
+
+	// the dropped messages are nulled in the receive log
+	r.Eventually(func() bool {
+		for _, ref := range published[:15] {
+			if _, err := bot.Get(ref); err == nil {
+				return false
+			}
+		}
+		return true
+	}, 5*time.Second, 50*time.Millisecond)
+	for _, ref := range published[15:] {
+		_, err := bot.Get(ref)
+		r.NoError(err)
+	}
+	_, err = bot.ReceiveLog.Get(0)
+	r.True(margaret.IsErrNulled(err), "first message not nulled: %v", err)
+
+	closeBot(bot)
+
+	// the feed continues from the kept messages after a restart
+	bot = openBot()
+	checkRetained(bot, 16, 25)
+
+	msg, err := bot.PublishLog.Publish(map[string]interface{}{"type": "test", "i": 25})
+	r.NoError(err)
+	checkRetained(bot, 17, 26)
+	r.Equal(published[24].String(), msg.Previous().String())
+
+	closeBot(bot)
+}
+
+func TestFeedRetentionPendingFile(t *testing.T) {
+	r := require.New(t)
+
+	tRepoPath := filepath.Join("testrun", t.Name())
+	os.RemoveAll(tRepoPath)
+	r.NoError(os.MkdirAll(tRepoPath, 0700))
+	pendingPath := filepath.Join(tRepoPath, "retention-pending")
+
+	var feed refs.FeedRef
+
+	fr := newFeedRetention()
+	r.NoError(fr.open(pendingPath))
+	r.NoError(fr.Dropped(feed, []int64{3, 4}))
+	r.NoError(fr.Dropped(feed, []int64{7}))
+	// stopped before the dropped messages were nulled
+	r.NoError(fr.Close())
+
+	fr = newFeedRetention()
+	r.NoError(fr.open(pendingPath))
+	select {
+	case <-fr.wake:
+	default:
+		r.Fail("not woken up for the pending messages")
+	}
+	r.Equal([]int64{3, 4, 7}, fr.takePending())
+
+	// dropped while the others were nulled
+	r.NoError(fr.Dropped(feed, []int64{9}))
+	r.NoError(fr.nulled())
+	r.NoError(fr.Close())
+
+	fr = newFeedRetention()
+	r.NoError(fr.open(pendingPath))
+	r.Equal([]int64{9}, fr.takePending())
+	r.NoError(fr.nulled())
+	r.NoError(fr.Close())
+
+	data, err := os.ReadFile(pendingPath)
+	r.NoError(err)
+	r.Empty(data)
+}
@@ -0,0 +1,92 @@
+// SPDX-FileCopyrightText: 2021 The Go-SSB Authors
+//
+// SPDX-License-Identifier: MIT
+
+package ssb
+
+import (
+	"testing"
+
+	refs "github.com/ssbc/go-ssb-refs"
+	"github.com/ssbc/margaret"
+	multibadger "github.com/ssbc/margaret/multilog/roaring/badger"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ssbc/go-ssb/internal/storedrefs"
+)
+
+func TestLatestSequences(t *testing.T) {
+	r := require.New(t)
+
+	users, err := multibadger.NewStandalone(t.TempDir())
+	r.NoError(err)
+	defer users.Close()
+
+	var (
+		rxlog   testReceiveLog
+		known   []refs.FeedRef
+		unknown []refs.FeedRef
+	)
+	for i := 0; i < 50; i++ {
+		kp, err := NewKeyPair(nil, refs.RefAlgoFeedSSB1)
+		r.NoError(err)
+
+		if i%2 == 1 {
+			unknown = append(unknown, kp.ID())
+			continue
+		}
+		known = append(known, kp.ID())
+
+		// the k-th known feed is sliced and has k+1 messages from sequence k+1 onwards
+		k := int64(len(known) - 1)
+		sublog, err := users.Get(storedrefs.Feed(kp.ID()))
+		r.NoError(err)
+		for j := int64(0); j <= k; j++ {
+			msg := refs.Message(seqMessage{seq: k + 1 + j})
+			switch {
+			case j == 0 && k%2 == 1:
+				// dropped by a retention limit
+				msg = nil
+			case j == k && k%3 == 2:
+				// the latest message was nulled
+				msg = nil
+			}
+			_, err = sublog.Append(int64(len(rxlog.msgs)))
+			r.NoError(err)
+			rxlog.msgs = append(rxlog.msgs, msg)
+		}
+	}
+
+	latest, err := LatestSequences(rxlog, users, append(known, unknown...))
+	r.NoError(err)
+	r.Len(latest, 50)
+
+	for k, feed := range known {
+		r.EqualValues(2*k+1, latest[feed.String()], "wrong sequence for known feed %d", k)
+	}
+	for i, feed := range unknown {
+		seq, has := latest[feed.String()]
+		r.True(has, "unknown feed %d not reported", i)
+		r.EqualValues(0, seq, "wrong sequence for unknown feed %d", i)
+	}
+}
+
+// testReceiveLog has the messages of TestLatestSequences, nil ones are nulled
+type testReceiveLog struct {
+	margaret.Log
+	msgs []refs.Message
+}
+
+func (l testReceiveLog) Get(seq int64) (interface{}, error) {
+	if l.msgs[seq] == nil {
+		return nil, margaret.ErrNulled
+	}
+	return l.msgs[seq], nil
+}
+
+type seqMessage struct {
+	refs.Message
+	seq int64
+}
+
+func (m seqMessage) Seq() int64 { return m.seq }
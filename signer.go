@@ -0,0 +1,75 @@
+// SPDX-FileCopyrightText: 2021 The Go-SSB Authors
+//
+// SPDX-License-Identifier: MIT
+
+package ssb
+
+import (
+	"fmt"
+
+	"golang.org/x/crypto/ed25519"
+
+	refs "github.com/ssbc/go-ssb-refs"
+)
+
+// Signer creates signatures for a feed, without necessarily exposing the private key to the process.
+// External signers, like hardware modules or key agents, can implement it.
+type Signer interface {
+	// Sign returns the ed25519 signature of data.
+	Sign(data []byte) ([]byte, error)
+
+	// Public returns the ed25519 public key the signatures verify against.
+	Public() []byte
+}
+
+// KeyPairSigner returns the Signer of kp.
+// If kp has its own (like the ones from NewSignerKeyPair), that one is used.
+// Otherwise the signatures are created in memory with kp.Secret(), which fails if it isn't a valid private key.
+func KeyPairSigner(kp KeyPair) (Signer, error) {
+	if sk, ok := kp.(interface{ Signer() Signer }); ok {
+		return sk.Signer(), nil
+	}
+	return NewEd25519Signer(kp.Secret())
+}
+
+// NewEd25519Signer returns the default, in-memory Signer for a private key.
+// It fails if secret doesn't have the length of an ed25519 private key.
+func NewEd25519Signer(secret ed25519.PrivateKey) (Signer, error) {
+	if len(secret) != ed25519.PrivateKeySize {
+		return nil, fmt.Errorf("ssb: invalid private key length: %d", len(secret))
+	}
+	return ed25519Signer{secret: secret}, nil
+}
+
+type ed25519Signer struct {
+	secret ed25519.PrivateKey
+}
+
+func (s ed25519Signer) Sign(data []byte) ([]byte, error) {
+	return ed25519.Sign(s.secret, data), nil
+}
+
+func (s ed25519Signer) Public() []byte {
+	return s.secret.Public().(ed25519.PublicKey)
+}
+
+// NewSignerKeyPair returns a KeyPair for the legacy feed of s, which signs using s.
+// Its Secret() is nil, so it can only be used to publish messages, not for connections or private messages.
+func NewSignerKeyPair(s Signer) (KeyPair, error) {
+	feed, err := refs.NewFeedRefFromBytes(s.Public(), refs.RefAlgoFeedSSB1)
+	if err != nil {
+		return nil, fmt.Errorf("ssb: invalid public key of signer: %w", err)
+	}
+	return signerKeyPair{feed: feed, signer: s}, nil
+}
+
+type signerKeyPair struct {
+	feed   refs.FeedRef
+	signer Signer
+}
+
+func (skp signerKeyPair) ID() refs.FeedRef { return skp.feed }
+
+func (skp signerKeyPair) Secret() ed25519.PrivateKey { return nil }
+
+func (skp signerKeyPair) Signer() Signer { return skp.signer }
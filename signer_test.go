@@ -0,0 +1,45 @@
+// SPDX-FileCopyrightText: 2021 The Go-SSB Authors
+//
+// SPDX-License-Identifier: MIT
+
+package ssb
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ed25519"
+
+	refs "github.com/ssbc/go-ssb-refs"
+)
+
+func TestEd25519Signer(t *testing.T) {
+	r := require.New(t)
+
+	for _, secret := range []ed25519.PrivateKey{nil, make([]byte, 32)} {
+		s, err := NewEd25519Signer(secret)
+		r.Error(err, "key with %d bytes", len(secret))
+		r.Nil(s)
+	}
+
+	kp, err := NewKeyPair(nil, refs.RefAlgoFeedSSB1)
+	r.NoError(err)
+
+	s, err := KeyPairSigner(kp)
+	r.NoError(err)
+	r.Equal([]byte(kp.ID().PubKey()), s.Public())
+
+	sig, err := s.Sign([]byte("hello"))
+	r.NoError(err)
+	r.True(ed25519.Verify(s.Public(), []byte("hello"), sig))
+
+	// a key pair without a secret and without its own signer can't sign
+	_, err = KeyPairSigner(noSecretKeyPair{kp.ID()})
+	r.Error(err)
+}
+
+type noSecretKeyPair struct{ feed refs.FeedRef }
+
+func (kp noSecretKeyPair) ID() refs.FeedRef { return kp.feed }
+
+func (kp noSecretKeyPair) Secret() ed25519.PrivateKey { return nil }
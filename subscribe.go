@@ -0,0 +1,134 @@
+// SPDX-FileCopyrightText: 2021 The Go-SSB Authors
+//
+// SPDX-License-Identifier: MIT
+
+package ssb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/ssbc/go-luigi"
+	refs "github.com/ssbc/go-ssb-refs"
+	"github.com/ssbc/margaret"
+	"github.com/ssbc/margaret/multilog"
+
+	"github.com/ssbc/go-ssb/internal/mutil"
+	"github.com/ssbc/go-ssb/internal/storedrefs"
+)
+
+// FeedSubscription is a source of the new messages of a set of feeds, see SubscribeFeeds.
+type FeedSubscription struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	msgs chan refs.Message
+	errc chan error
+}
+
+var _ luigi.Source = (*FeedSubscription)(nil)
+
+// SubscribeFeeds returns a source of the messages which are added to the passed feeds from now on.
+// It runs a live query for each of them and returns their messages in the order the queries return them.
+// Nothing is read ahead: the queries wait until the caller asks for the next message.
+// userFeeds needs to be the multilog of sequences in rxLog by author (see storedrefs.Feed).
+// Close stops all queries, afterwards Next returns luigi.EOS.
+func SubscribeFeeds(rxLog margaret.Log, userFeeds multilog.MultiLog, feeds []refs.FeedRef) (*FeedSubscription, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	sub := &FeedSubscription{
+		ctx:    ctx,
+		cancel: cancel,
+
+		msgs: make(chan refs.Message),
+		errc: make(chan error, 1),
+	}
+
+	srcs := make([]luigi.Source, len(feeds))
+	for i, feed := range feeds {
+		userLog, err := userFeeds.Get(storedrefs.Feed(feed))
+		if err != nil {
+			cancel()
+			return nil, fmt.Errorf("subscribe feeds: failed to open sublog for %s: %w", feed.ShortSigil(), err)
+		}
+
+		// only what comes after the current end
+		src, err := mutil.Indirect(rxLog, userLog).Query(margaret.Live(true), margaret.Gt(userLog.Seq()))
+		if err != nil {
+			cancel()
+			return nil, fmt.Errorf("subscribe feeds: failed to query %s: %w", feed.ShortSigil(), err)
+		}
+		srcs[i] = src
+	}
+
+	sub.wg.Add(len(srcs))
+	for _, src := range srcs {
+		go sub.forward(src)
+	}
+	return sub, nil
+}
+
+func (sub *FeedSubscription) forward(src luigi.Source) {
+	defer sub.wg.Done()
+	for {
+		v, err := src.Next(sub.ctx)
+		if err != nil {
+			if sub.ctx.Err() != nil || luigi.IsEOS(err) || errors.Is(err, context.Canceled) {
+				return
+			}
+			sub.fail(err)
+			return
+		}
+
+		if err, ok := v.(error); ok {
+			if margaret.IsErrNulled(err) {
+				continue
+			}
+			sub.fail(err)
+			return
+		}
+
+		msg, ok := v.(refs.Message)
+		if !ok {
+			sub.fail(fmt.Errorf("subscribe feeds: unexpected value in feed: %T", v))
+			return
+		}
+
+		select {
+		case sub.msgs <- msg:
+		case <-sub.ctx.Done():
+			return
+		}
+	}
+}
+
+// fail passes the first error of a query to Next
+func (sub *FeedSubscription) fail(err error) {
+	select {
+	case sub.errc <- err:
+	default:
+	}
+}
+
+// Next returns the next message of the subscribed feeds as a refs.Message.
+func (sub *FeedSubscription) Next(ctx context.Context) (interface{}, error) {
+	select {
+	case msg := <-sub.msgs:
+		return msg, nil
+	case err := <-sub.errc:
+		return nil, err
+	case <-sub.ctx.Done():
+		return nil, luigi.EOS{}
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// Close stops the queries of all feeds and waits for them to exit.
+func (sub *FeedSubscription) Close() error {
+	sub.cancel()
+	sub.wg.Wait()
+	return nil
+}
@@ -0,0 +1,126 @@
+// SPDX-FileCopyrightText: 2021 The Go-SSB Authors
+//
+// SPDX-License-Identifier: MIT
+
+package ssb
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ssbc/go-luigi"
+	refs "github.com/ssbc/go-ssb-refs"
+	"github.com/ssbc/margaret"
+	"github.com/ssbc/margaret/indexes"
+	"github.com/ssbc/margaret/mem"
+	"github.com/ssbc/margaret/multilog"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ssbc/go-ssb/internal/storedrefs"
+)
+
+func TestSubscribeFeeds(t *testing.T) {
+	r := require.New(t)
+
+	alice, bob, claire := testFeedRef(t, 1), testFeedRef(t, 2), testFeedRef(t, 3)
+
+	feeds := newSubscribeFixture()
+	// existing messages aren't returned
+	feeds.append(t, alice, 1)
+	feeds.append(t, bob, 1)
+
+	sub, err := SubscribeFeeds(feeds.rootLog, feeds, []refs.FeedRef{alice, bob})
+	r.NoError(err)
+
+	next := func() (refs.FeedRef, int64) {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		v, err := sub.Next(ctx)
+		r.NoError(err)
+		msg, ok := v.(refs.Message)
+		r.True(ok, "wrong type %T", v)
+		return msg.Author(), msg.Seq()
+	}
+
+	type entry struct {
+		author refs.FeedRef
+		seq    int64
+	}
+	want := []entry{{alice, 2}, {bob, 2}, {alice, 3}, {bob, 3}}
+	for _, e := range want {
+		feeds.append(t, e.author, e.seq)
+		// not subscribed
+		feeds.append(t, claire, e.seq)
+
+		author, seq := next()
+		r.True(author.Equal(e.author), "got message of %s instead of %s", author.ShortSigil(), e.author.ShortSigil())
+		r.Equal(e.seq, seq)
+	}
+
+	// nothing is lost if the consumer is slow
+	feeds.append(t, bob, 4)
+	feeds.append(t, bob, 5)
+	feeds.append(t, alice, 4)
+	got := map[string][]int64{}
+	for i := 0; i < 3; i++ {
+		author, seq := next()
+		got[author.String()] = append(got[author.String()], seq)
+	}
+	r.Equal(map[string][]int64{
+		alice.String(): {4},
+		bob.String():   {4, 5},
+	}, got)
+
+	r.NoError(sub.Close())
+
+	feeds.append(t, alice, 5)
+	_, err = sub.Next(context.Background())
+	r.True(luigi.IsEOS(err), "expected EOS after close, got %v", err)
+}
+
+// subscribeFixture is a root log with a user feeds multilog
+type subscribeFixture struct {
+	multilog.MultiLog
+
+	rootLog margaret.Log
+	sublogs map[indexes.Addr]margaret.Log
+}
+
+func newSubscribeFixture() *subscribeFixture {
+	return &subscribeFixture{
+		rootLog: mem.New(),
+		sublogs: make(map[indexes.Addr]margaret.Log),
+	}
+}
+
+func (sf *subscribeFixture) Get(addr indexes.Addr) (margaret.Log, error) {
+	sub, has := sf.sublogs[addr]
+	if !has {
+		sub = mem.New()
+		sf.sublogs[addr] = sub
+	}
+	return sub, nil
+}
+
+func (sf *subscribeFixture) append(t *testing.T, author refs.FeedRef, seq int64) {
+	rxSeq, err := sf.rootLog.Append(&subscribeMsg{author: author, seq: seq})
+	require.NoError(t, err)
+
+	sub, err := sf.Get(storedrefs.Feed(author))
+	require.NoError(t, err)
+	_, err = sub.Append(rxSeq)
+	require.NoError(t, err)
+}
+
+// subscribeMsg only has the parts of a message the test looks at
+type subscribeMsg struct {
+	refs.Message
+
+	author refs.FeedRef
+	seq    int64
+}
+
+func (msg *subscribeMsg) Author() refs.FeedRef { return msg.author }
+
+func (msg *subscribeMsg) Seq() int64 { return msg.seq }
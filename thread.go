@@ -0,0 +1,167 @@
+// SPDX-FileCopyrightText: 2021 The Go-SSB Authors
+//
+// SPDX-License-Identifier: MIT
+
+package ssb
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/ssbc/go-luigi"
+	refs "github.com/ssbc/go-ssb-refs"
+	"github.com/ssbc/margaret"
+	"github.com/ssbc/margaret/multilog"
+
+	"github.com/ssbc/go-ssb/internal/storedrefs"
+)
+
+// Thread returns the root message and all the replies to it, which are the messages that have their root field set to it.
+// byRoot needs to be the multilog of v1 tangles (see storedrefs.TangleV1), like the tangles index of the sbot.
+//
+// The messages are ordered so that each one comes after the messages it points to with its branch field.
+// Replies that point to messages outside of the thread or which are missing are attached to the root.
+// Messages that can't be ordered, because their branch links form a cycle, come last.
+// Otherwise the order of the root log is kept.
+func Thread(get Getter, rootLog margaret.Log, byRoot multilog.MultiLog, root refs.MessageRef) ([]refs.Message, error) {
+	rootMsg, err := get.Get(root)
+	if err != nil {
+		return nil, fmt.Errorf("thread: failed to get root message %s: %w", root.ShortSigil(), err)
+	}
+
+	replies, err := threadReplies(rootLog, byRoot, root)
+	if err != nil {
+		return nil, fmt.Errorf("thread: %w", err)
+	}
+
+	return sortThread(rootMsg, replies), nil
+}
+
+func threadReplies(rootLog margaret.Log, byRoot multilog.MultiLog, root refs.MessageRef) ([]refs.Message, error) {
+	sublog, err := byRoot.Get(storedrefs.TangleV1(root))
+	if err != nil {
+		return nil, fmt.Errorf("failed to open tangle sublog: %w", err)
+	}
+
+	src, err := sublog.Query()
+	if err != nil {
+		return nil, fmt.Errorf("failed to query tangle sublog: %w", err)
+	}
+
+	var replies []refs.Message
+	ctx := context.TODO()
+	for {
+		v, err := src.Next(ctx)
+		if err != nil {
+			if luigi.IsEOS(err) {
+				break
+			}
+			return nil, err
+		}
+
+		rxSeq, ok := v.(int64)
+		if !ok {
+			return nil, fmt.Errorf("unexpected value in tangle sublog: %T", v)
+		}
+
+		mv, err := rootLog.Get(rxSeq)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get reply %d: %w", rxSeq, err)
+		}
+
+		if errV, ok := mv.(error); ok {
+			if margaret.IsErrNulled(errV) {
+				continue
+			}
+			return nil, errV
+		}
+
+		msg, ok := mv.(refs.Message)
+		if !ok {
+			return nil, fmt.Errorf("unexpected value in root log: %T", mv)
+		}
+		replies = append(replies, msg)
+	}
+	return replies, nil
+}
+
+// sortThread does a topological sort of the replies by their branch links.
+// If more than one message can come next, the one earliest in replies is picked.
+func sortThread(root refs.Message, replies []refs.Message) []refs.Message {
+	rootKey := root.Key().String()
+
+	// drop duplicates and replies claiming to be the root
+	var (
+		msgs  = make([]refs.Message, 0, len(replies))
+		index = make(map[string]int, len(replies))
+	)
+	for _, msg := range replies {
+		k := msg.Key().String()
+		if k == rootKey {
+			continue
+		}
+		if _, has := index[k]; has {
+			continue
+		}
+		index[k] = len(msgs)
+		msgs = append(msgs, msg)
+	}
+
+	// how many replies in the thread each reply waits for and who waits for it
+	waitingFor := make([]int, len(msgs))
+	unblocks := make([][]int, len(msgs))
+	for i, msg := range msgs {
+		var content struct {
+			Branch refs.MessageRefs `json:"branch"`
+		}
+		// a missing or broken branch field attaches the reply to the root
+		json.Unmarshal(msg.ContentBytes(), &content)
+
+		seen := make(map[int]struct{})
+		for _, br := range content.Branch {
+			j, has := index[br.String()]
+			if !has || j == i {
+				continue
+			}
+			if _, dupe := seen[j]; dupe {
+				continue
+			}
+			seen[j] = struct{}{}
+			waitingFor[i]++
+			unblocks[j] = append(unblocks[j], i)
+		}
+	}
+
+	sorted := make([]refs.Message, 1, len(msgs)+1)
+	sorted[0] = root
+
+	done := make([]bool, len(msgs))
+	for {
+		next := -1
+		for i := range msgs {
+			if !done[i] && waitingFor[i] == 0 {
+				next = i
+				break
+			}
+		}
+		if next == -1 {
+			break
+		}
+
+		done[next] = true
+		sorted = append(sorted, msgs[next])
+		for _, j := range unblocks[next] {
+			waitingFor[j]--
+		}
+	}
+
+	// whatever is left is part of or waits for a cycle
+	for i, msg := range msgs {
+		if !done[i] {
+			sorted = append(sorted, msg)
+		}
+	}
+
+	return sorted
+}
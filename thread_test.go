@@ -0,0 +1,158 @@
+// SPDX-FileCopyrightText: 2021 The Go-SSB Authors
+//
+// SPDX-License-Identifier: MIT
+
+package ssb
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	refs "github.com/ssbc/go-ssb-refs"
+	"github.com/ssbc/margaret"
+	"github.com/ssbc/margaret/indexes"
+	"github.com/ssbc/margaret/mem"
+	"github.com/ssbc/margaret/multilog"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ssbc/go-ssb/internal/storedrefs"
+)
+
+func TestThread(t *testing.T) {
+	r := require.New(t)
+
+	root := newThreadMsg(t, 1, nil)
+	reply1 := newThreadMsg(t, 2, &root.key, root.key)
+	reply2 := newThreadMsg(t, 3, &root.key, root.key, testMessageRef(t, 99))
+	nested := newThreadMsg(t, 4, &root.key, reply1.key)
+
+	// the nested reply arrived before the message it points to
+	th := newThreadFixture(t, root, nested, reply2, reply1)
+
+	msgs, err := Thread(th.byKey, th.rootLog, th.byRoot, root.key)
+	r.NoError(err)
+	r.Equal([]string{"1", "3", "2", "4"}, threadTexts(t, msgs))
+
+	_, err = Thread(th.byKey, th.rootLog, th.byRoot, testMessageRef(t, 100))
+	r.Error(err, "expected an error for an unknown root")
+}
+
+func TestThreadCycles(t *testing.T) {
+	r := require.New(t)
+
+	root := newThreadMsg(t, 1, nil)
+	a, b := testMessageRef(t, 2), testMessageRef(t, 3)
+	msgA := &threadMsg{key: a, content: threadContent(t, "2", &root.key, b)}
+	msgB := &threadMsg{key: b, content: threadContent(t, "3", &root.key, a)}
+	self := newThreadMsg(t, 4, &root.key, testMessageRef(t, 4))
+	after := newThreadMsg(t, 5, &root.key, root.key)
+
+	th := newThreadFixture(t, root, msgA, self, msgB, after, self)
+
+	msgs, err := Thread(th.byKey, th.rootLog, th.byRoot, root.key)
+	r.NoError(err)
+	r.Equal([]string{"1", "4", "5", "2", "3"}, threadTexts(t, msgs))
+}
+
+// threadFixture holds a root log with the messages of one thread
+// and serves them by key and through the tangle sublog of the root.
+type threadFixture struct {
+	rootLog margaret.Log
+	byKey   threadGetter
+	byRoot  threadTangles
+}
+
+func newThreadFixture(t *testing.T, root *threadMsg, replies ...*threadMsg) *threadFixture {
+	th := &threadFixture{
+		rootLog: mem.New(),
+		byKey:   make(threadGetter),
+		byRoot: threadTangles{
+			root:   root.key,
+			tangle: mem.New(),
+		},
+	}
+
+	seq, err := th.rootLog.Append(root)
+	require.NoError(t, err)
+	th.byKey[root.key.String()] = root
+
+	for _, msg := range replies {
+		seq, err = th.rootLog.Append(msg)
+		require.NoError(t, err)
+		th.byKey[msg.key.String()] = msg
+
+		_, err = th.byRoot.tangle.Append(seq)
+		require.NoError(t, err)
+	}
+	return th
+}
+
+type threadGetter map[string]refs.Message
+
+func (g threadGetter) Get(ref refs.MessageRef) (refs.Message, error) {
+	msg, has := g[ref.String()]
+	if !has {
+		return nil, fmt.Errorf("no such message: %s", ref.ShortSigil())
+	}
+	return msg, nil
+}
+
+// threadTangles is a multilog that only knows the tangle of one root
+type threadTangles struct {
+	multilog.MultiLog
+
+	root   refs.MessageRef
+	tangle margaret.Log
+}
+
+func (tt threadTangles) Get(addr indexes.Addr) (margaret.Log, error) {
+	if addr != storedrefs.TangleV1(tt.root) {
+		return mem.New(), nil
+	}
+	return tt.tangle, nil
+}
+
+// threadMsg only has the parts of a message that Thread looks at
+type threadMsg struct {
+	refs.Message
+
+	key     refs.MessageRef
+	content []byte
+}
+
+func (msg *threadMsg) Key() refs.MessageRef { return msg.key }
+func (msg *threadMsg) ContentBytes() []byte { return msg.content }
+
+func newThreadMsg(t *testing.T, i byte, root *refs.MessageRef, branch ...refs.MessageRef) *threadMsg {
+	return &threadMsg{
+		key:     testMessageRef(t, i),
+		content: threadContent(t, fmt.Sprint(i), root, branch...),
+	}
+}
+
+func threadContent(t *testing.T, text string, root *refs.MessageRef, branch ...refs.MessageRef) []byte {
+	post := refs.NewPost(text)
+	post.Root = root
+	post.Branch = branch
+	content, err := json.Marshal(post)
+	require.NoError(t, err)
+	return content
+}
+
+func testMessageRef(t *testing.T, i byte) refs.MessageRef {
+	ref, err := refs.NewMessageRefFromBytes(bytes.Repeat([]byte{i}, 32), refs.RefAlgoMessageSSB1)
+	require.NoError(t, err)
+	return ref
+}
+
+func threadTexts(t *testing.T, msgs []refs.Message) []string {
+	texts := make([]string, len(msgs))
+	for i, msg := range msgs {
+		var post refs.Post
+		require.NoError(t, json.Unmarshal(msg.ContentBytes(), &post))
+		texts[i] = post.Text
+	}
+	return texts
+}